@@ -0,0 +1,68 @@
+package main
+
+import (
+	"car-svc/internal/app"
+	"car-svc/internal/lib/config"
+	"car-svc/internal/lib/spanner"
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	lib_env "github.com/tomwangsvc/lib-svc/env"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+const (
+	idempotencyKeyTtl = 24 * time.Hour
+	importChunkSize   = 500
+	spannerMinOpened  = 1
+)
+
+// defaultSettings are overridden by the config file, the environment and the flags
+var defaultSettings = config.Settings{
+	SpannerSessionPoolMinOpened: spannerMinOpened,
+}
+
+// loadSettings loads the settings of the command line and exports them to the environment read by lib_env and the spanner client
+func loadSettings() (*config.Settings, error) {
+	settings, err := config.Load(flag.CommandLine, os.Args[1:], defaultSettings)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed loading settings")
+	}
+	if err := settings.Export(); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed exporting settings")
+	}
+	return settings, nil
+}
+
+type Config struct {
+	App     app.Config
+	Spanner spanner.Config
+}
+
+func newConfig(ctx context.Context, env lib_env.Env, settings config.Settings) *Config {
+	lib_log.Info(ctx, "Initializing config")
+
+	config := Config{
+		App: app.Config{
+			Env: env,
+		},
+
+		Spanner: spanner.Config{
+			ClientConfig:           settings.SpannerClientConfig(env),
+			DatabaseId:             env.SpannerDatabaseId,
+			Env:                    env,
+			IdempotencyKeyTtl:      idempotencyKeyTtl,
+			ImportChunkSize:        importChunkSize,
+			InMemory:               settings.SpannerInMemory,
+			InstanceId:             env.SpannerInstanceId,
+			PostgresDataSourceName: settings.PostgresDataSourceName,
+			ProjectId:              env.GcpProjectId,
+		},
+	}
+
+	lib_log.Info(ctx, "Initialized config")
+	return &config
+}
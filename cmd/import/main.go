@@ -0,0 +1,126 @@
+// Command import creates the cars of a CSV or JSONL fleet file and writes the errors of the failed rows to a CSV report
+//
+// Usage:
+//
+//	import -file fleet.csv [-format csv|jsonl] [-report fleet.report.csv] [-test] [-config config.json]
+//
+// The settings of the service, e.g. -spanner-emulator-host, are also accepted as flags.
+package main
+
+import (
+	"car-svc/internal/app"
+	"car-svc/internal/lib/actor"
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/importer"
+	"car-svc/internal/lib/publisher"
+	"car-svc/internal/lib/rbac"
+	"car-svc/internal/lib/schema"
+	"car-svc/internal/lib/spanner"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_env "github.com/tomwangsvc/lib-svc/env"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_schema "github.com/tomwangsvc/lib-svc/schema"
+)
+
+//revive:disable:cyclomatic
+func main() {
+	file := flag.String("file", "", "path of the CSV or JSONL fleet file")
+	format := flag.String("format", "", "format of the fleet file, csv or jsonl, defaults to the extension of the file")
+	report := flag.String("report", "", "path of the CSV report of the failed rows, defaults to the file with a .report.csv extension")
+	test := flag.Bool("test", false, "import the cars as test cars")
+	settings, err := loadSettings()
+	if err != nil {
+		log.Fatal("Failed initializing settings: ", err)
+	}
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+		if *format == "ndjson" {
+			*format = importer.FormatJsonl
+		}
+	}
+	if *report == "" {
+		*report = strings.TrimSuffix(*file, filepath.Ext(*file)) + ".report.csv"
+	}
+
+	env, err := lib_env.New("car-svc")
+	if err != nil {
+		log.Fatal("Failed initializing env: ", err)
+	}
+	ctx := lib_context.WithTest(lib_context.NewStartUpContext(), *test)
+	// The operator running the import is recorded as the actor of the created cars
+	ctx = actor.WithActor(ctx, os.Getenv("USER"))
+	// The import is run by an operator rather than authorized by a policy so it may create cars of any branch
+	ctx = rbac.WithTrusted(ctx)
+
+	// Logs are written to stdout when running locally as there is no logging client
+	if !settings.Local {
+		if err = lib_log.Init(ctx, *env); err != nil {
+			log.Fatal("Failed initializing logger: ", err)
+		}
+	}
+
+	config := newConfig(ctx, *env, *settings)
+
+	schemaClient, err := lib_schema.NewClient(ctx, schema.SupportedSchema())
+	if err != nil {
+		lib_log.Fatal(ctx, "Failed initializing schema client", lib_log.FmtError(err))
+	}
+
+	spannerClient, err := spanner.NewClient(ctx, config.Spanner)
+	if err != nil {
+		lib_log.Fatal(ctx, "Failed initializing spanner client", lib_log.FmtError(err))
+	}
+	defer spannerClient.Close()
+
+	// The events of the imported cars are left in the outbox for the relay of the service to publish and deliver to webhooks
+	appClient := app.NewClient(config.App, publisher.NewInMemoryClient(ctx), schemaClient, spannerClient, nil)
+
+	f, err := os.Open(*file)
+	if err != nil {
+		lib_log.Fatal(ctx, "Failed opening file", lib_log.FmtError(err))
+	}
+	defer f.Close()
+
+	rows, err := importer.DecodeRows(*format, f)
+	if err != nil {
+		lib_log.Fatal(ctx, "Failed decoding rows", lib_log.FmtError(err))
+	}
+
+	carsImportReport, err := appClient.ImportCars(ctx, dto.CarsImport{
+		Format: *format,
+		Rows:   rows,
+		Test:   *test,
+	})
+	if err != nil {
+		lib_log.Fatal(ctx, "Failed importing cars", lib_log.FmtError(err))
+	}
+
+	carsImportReportCsv, err := importer.EncodeReportCsv(*carsImportReport)
+	if err != nil {
+		lib_log.Fatal(ctx, "Failed encoding cars import report csv", lib_log.FmtError(err))
+	}
+	if err := ioutil.WriteFile(*report, carsImportReportCsv, 0644); err != nil {
+		lib_log.Fatal(ctx, "Failed writing cars import report", lib_log.FmtError(err))
+	}
+
+	lib_log.Info(ctx, "Imported",
+		lib_log.FmtString("carsImportReport.CarsImportId", carsImportReport.CarsImportId),
+		lib_log.FmtInt("carsImportReport.RowsTotal", carsImportReport.RowsTotal),
+		lib_log.FmtInt("carsImportReport.RowsImported", carsImportReport.RowsImported),
+		lib_log.FmtInt("carsImportReport.RowsFailed", carsImportReport.RowsFailed),
+		lib_log.FmtString("report", *report),
+	)
+	//revive:enable:cyclomatic
+}
@@ -0,0 +1,56 @@
+// Command purge hard deletes the cars of every tenant that were soft deleted longer ago than the retention period, with their rentals, history and outbox events
+//
+// Usage:
+//
+//	purge [-config config.json]
+//
+// The settings of the service, e.g. -spanner-emulator-host, are also accepted as flags. It is run daily as a Cloud Run job triggered by Cloud Scheduler, see README.md.
+package main
+
+import (
+	"car-svc/internal/app"
+	"car-svc/internal/lib/publisher"
+	"car-svc/internal/lib/spanner"
+	"log"
+
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_env "github.com/tomwangsvc/lib-svc/env"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+func main() {
+	settings, err := loadSettings()
+	if err != nil {
+		log.Fatal("Failed initializing settings: ", err)
+	}
+
+	env, err := lib_env.New("car-svc")
+	if err != nil {
+		log.Fatal("Failed initializing env: ", err)
+	}
+	ctx := lib_context.NewStartUpContext()
+
+	// Logs are written to stdout when running locally as there is no logging client
+	if !settings.Local {
+		if err = lib_log.Init(ctx, *env); err != nil {
+			log.Fatal("Failed initializing logger: ", err)
+		}
+	}
+
+	config := newConfig(ctx, *env, *settings)
+
+	spannerClient, err := spanner.NewClient(ctx, config.Spanner)
+	if err != nil {
+		lib_log.Fatal(ctx, "Failed initializing spanner client", lib_log.FmtError(err))
+	}
+	defer spannerClient.Close()
+
+	appClient := app.NewClient(config.App, publisher.NewInMemoryClient(ctx), nil, spannerClient, nil)
+
+	count, err := appClient.PurgeCars(ctx)
+	if err != nil {
+		lib_log.Fatal(ctx, "Failed purging cars", lib_log.FmtError(err))
+	}
+
+	lib_log.Info(ctx, "Purged", lib_log.FmtInt64("count", count))
+}
@@ -3,38 +3,188 @@ package main
 import (
 	"car-svc/internal/app"
 	"car-svc/internal/http"
+	"car-svc/internal/lib/certificates"
+	"car-svc/internal/lib/config"
+	"car-svc/internal/lib/health"
+	"car-svc/internal/lib/rbac"
 	"car-svc/internal/lib/spanner"
+	"car-svc/internal/lib/webhook"
+	"car-svc/internal/relay"
 	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
 
+	lib_certificates "github.com/tomwangsvc/lib-svc/certificates"
 	lib_env "github.com/tomwangsvc/lib-svc/env"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_integration "github.com/tomwangsvc/lib-svc/integration"
 	lib_log "github.com/tomwangsvc/lib-svc/log"
-	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+	lib_pubsub "github.com/tomwangsvc/lib-svc/pubsub"
+	lib_secrets "github.com/tomwangsvc/lib-svc/secrets"
+	lib_token_gcp "github.com/tomwangsvc/lib-svc/token/gcp"
+	lib_token_iam "github.com/tomwangsvc/lib-svc/token/iam"
+	lib_token_svc "github.com/tomwangsvc/lib-svc/token/svc"
 )
 
+const (
+	carChangesPollInterval = time.Second
+	drainDelay             = 2 * time.Second
+	fleetMetricsInterval   = time.Minute
+	healthCheckTimeout     = 2 * time.Second
+	httpIdleTimeout        = 2 * time.Minute
+	httpLongPollTimeout    = 40 * time.Second
+	httpReadHeaderTimeout  = 10 * time.Second
+	httpReadTimeout        = 30 * time.Second
+	httpRequestTimeout     = 30 * time.Second
+	httpWriteTimeout       = 45 * time.Second
+	// idempotencyKeyPendingTtl exceeds the write timeout, so that a pending key is only reclaimed once its request can no longer be running
+	idempotencyKeyPendingTtl = time.Minute
+	idempotencyKeyTtl        = 24 * time.Hour
+	importChunkSize          = 500
+	metricsPort              = 9090
+	outboxBatchSize          = 100
+	outboxRelayInterval      = time.Second
+	outboxRelayTimeout       = 30 * time.Second
+	outboxTopicId            = "car-svc-events"
+	rbacPolicyFile           = "rbac_policy.json"
+	// shutdownTimeout is within the 10 seconds Cloud Run waits between SIGTERM and SIGKILL
+	shutdownTimeout        = 9 * time.Second
+	spannerMinOpened       = 80
+	versionRetentionPeriod = time.Hour
+	webhookBatchSize       = 100
+	webhookDispatchTimeout = 2 * time.Minute
+	webhookMaxAttempts     = 10
+	webhookRetryDelayBase  = 30 * time.Second
+	webhookRetryDelayMax   = 6 * time.Hour
+	webhookTimeout         = 10 * time.Second
+)
+
+// defaultSettings are overridden by the config file, the environment and the flags
+var defaultSettings = config.Settings{
+	MetricsPort:                 metricsPort,
+	SpannerSessionPoolMinOpened: spannerMinOpened,
+}
+
+// loadSettings loads the settings of the command line and exports them to the environment read by lib_env and the spanner client
+func loadSettings() (*config.Settings, error) {
+	settings, err := config.Load(flag.CommandLine, os.Args[1:], defaultSettings)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed loading settings")
+	}
+	if err := settings.Export(); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed exporting settings")
+	}
+	return settings, nil
+}
+
 type Config struct {
-	App     app.Config
-	Http    http.Config
-	Spanner spanner.Config
+	App          app.Config
+	Certificates lib_certificates.Config
+	Health       health.Config
+	Http         http.Config
+	Integration  lib_integration.Config
+	// LocalCertificates replaces Certificates when running locally, as the certificates bucket is not available
+	LocalCertificates certificates.Config
+	Pubsub            lib_pubsub.Config
+	Rbac              rbac.Config
+	Relay             relay.Config
+	Secrets           lib_secrets.Config
+	Spanner           spanner.Config
+	Webhook           webhook.Config
+	TokenGcp          lib_token_gcp.Config
+	TokenIam          lib_token_iam.Config
+	TokenSvc          lib_token_svc.Config
 }
 
-func newConfig(ctx context.Context, env lib_env.Env) *Config {
+func newConfig(ctx context.Context, env lib_env.Env, settings config.Settings) *Config {
 	lib_log.Info(ctx, "Initializing config")
 
+	tokenIamConfig := lib_token_iam.Config{
+		Env: env,
+	}
+	tokenSvcConfig := lib_token_svc.Config{
+		Env: env,
+	}
+
 	config := Config{
 		App: app.Config{
-			Env: env,
+			CarChangesPollInterval: carChangesPollInterval,
+			Env:                    env,
+			OutboxBatchSize:        outboxBatchSize,
+			OutboxTopicId:          outboxTopicId,
+
+			WebhookBatchSize:      webhookBatchSize,
+			WebhookMaxAttempts:    webhookMaxAttempts,
+			WebhookRetryDelayBase: webhookRetryDelayBase,
+			WebhookRetryDelayMax:  webhookRetryDelayMax,
+		},
+		Certificates: lib_certificates.Config{
+			BucketName: fmt.Sprintf("%s-certificates", env.GcpProjectId),
+			Env:        env,
+			Required:   lib_certificates.ReduceRequired(lib_token_iam.RequiredCertificates(), lib_token_svc.RequiredCertificates(tokenSvcConfig)),
+		},
+		Health: health.Config{
+			Timeout: healthCheckTimeout,
 		},
 		Http: http.Config{
+			DrainDelay:        drainDelay,
+			Env:               env,
+			IdleTimeout:       httpIdleTimeout,
+			LongPollTimeout:   httpLongPollTimeout,
+			MetricsPort:       settings.MetricsPort,
+			ReadHeaderTimeout: httpReadHeaderTimeout,
+			ReadTimeout:       httpReadTimeout,
+			RequestTimeout:    httpRequestTimeout,
+			WriteTimeout:      httpWriteTimeout,
+		},
+		Integration: lib_integration.Config{
+			Env: env,
+		},
+		LocalCertificates: certificates.Config{
+			JwksFile: settings.IamJwksFile,
+			KeyFile:  settings.IamKeyFile,
+			Required: lib_token_iam.RequiredCertificates(),
+		},
+		Pubsub: lib_pubsub.Config{
 			Env: env,
 		},
+		Rbac: rbac.Config{
+			PolicyFile: rbacPolicyFile,
+		},
+		Relay: relay.Config{
+			DispatchTimeout: webhookDispatchTimeout,
+			Interval:        outboxRelayInterval,
+			RelayTimeout:    outboxRelayTimeout,
+		},
+		Secrets: lib_secrets.Config{
+			BucketName: fmt.Sprintf("%s-secrets", env.GcpProjectId),
+			Env:        env,
+			Required:   lib_secrets.ReduceRequired(lib_token_iam.RequiredSecrets(tokenIamConfig), lib_token_svc.RequiredSecrets(tokenSvcConfig)),
+		},
 
 		Spanner: spanner.Config{
-			ClientConfig: lib_spanner.ClientConfigWithMinOpened(env, 80),
-			DatabaseId:   env.SpannerDatabaseId,
-			Env:          env,
-			InstanceId:   env.SpannerInstanceId,
-			ProjectId:    env.GcpProjectId,
+			ClientConfig:             settings.SpannerClientConfig(env),
+			DatabaseId:               env.SpannerDatabaseId,
+			Env:                      env,
+			IdempotencyKeyPendingTtl: idempotencyKeyPendingTtl,
+			IdempotencyKeyTtl:        idempotencyKeyTtl,
+			ImportChunkSize:          importChunkSize,
+			InMemory:                 settings.SpannerInMemory,
+			InstanceId:               env.SpannerInstanceId,
+			PostgresDataSourceName:   settings.PostgresDataSourceName,
+			ProjectId:                env.GcpProjectId,
+			VersionRetentionPeriod:   versionRetentionPeriod,
+		},
+		Webhook: webhook.Config{
+			Timeout: webhookTimeout,
+		},
+		TokenGcp: lib_token_gcp.Config{
+			Env: env,
 		},
+		TokenIam: tokenIamConfig,
+		TokenSvc: tokenSvcConfig,
 	}
 
 	lib_log.Info(ctx, "Initialized config")
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"car-svc/internal/lib/health"
+	"car-svc/internal/lib/spanner"
+	"context"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_pubsub "github.com/tomwangsvc/lib-svc/pubsub"
+	lib_storage "github.com/tomwangsvc/lib-svc/storage"
+	"google.golang.org/api/iterator"
+)
+
+// newHealthChecks returns the checks of readiness, storage and pubsub are only checked when the service uses them
+func newHealthChecks(config Config, spannerClient spanner.Client, libStorageClient lib_storage.Client, pubsubClient lib_pubsub.Client) map[string]health.Check {
+	checkByDependency := map[string]health.Check{
+		"spanner": spannerClient.Ping,
+	}
+
+	if libStorageClient != nil {
+		// Listing a single object needs only the object viewer role that reading the certificates already requires
+		checkByDependency["storage"] = func(ctx context.Context) error {
+			objects := libStorageClient.Bucket(config.Certificates.BucketName).Objects(ctx, nil)
+			objects.PageInfo().MaxSize = 1
+			if _, err := objects.Next(); err != nil && err != iterator.Done {
+				return lib_errors.Wrap(err, "Failed listing certificates bucket")
+			}
+			return nil
+		}
+	}
+
+	if pubsubClient != nil {
+		checkByDependency["pubsub"] = func(ctx context.Context) error {
+			if _, err := pubsubClient.Topic(ctx, outboxTopicId); err != nil {
+				return lib_errors.Wrap(err, "Failed retrieving outbox topic")
+			}
+			return nil
+		}
+	}
+
+	return checkByDependency
+}
@@ -3,37 +3,57 @@ package main
 import (
 	"car-svc/internal/app"
 	"car-svc/internal/http"
+	"car-svc/internal/lib/certificates"
+	"car-svc/internal/lib/health"
+	"car-svc/internal/lib/publisher"
+	"car-svc/internal/lib/rbac"
 	"car-svc/internal/lib/schema"
 	"car-svc/internal/lib/spanner"
+	"car-svc/internal/lib/webhook"
+	"car-svc/internal/relay"
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	lib_certificates "github.com/tomwangsvc/lib-svc/certificates"
 	lib_context "github.com/tomwangsvc/lib-svc/context"
 	lib_countries "github.com/tomwangsvc/lib-svc/countries"
 	lib_env "github.com/tomwangsvc/lib-svc/env"
+	lib_integration "github.com/tomwangsvc/lib-svc/integration"
 	lib_log "github.com/tomwangsvc/lib-svc/log"
-	lib_os "github.com/tomwangsvc/lib-svc/os"
+	lib_pubsub "github.com/tomwangsvc/lib-svc/pubsub"
 	lib_schema "github.com/tomwangsvc/lib-svc/schema"
+	lib_secrets "github.com/tomwangsvc/lib-svc/secrets"
 	lib_storage "github.com/tomwangsvc/lib-svc/storage"
+	lib_token_gcp "github.com/tomwangsvc/lib-svc/token/gcp"
+	lib_token_iam "github.com/tomwangsvc/lib-svc/token/iam"
+	lib_token_svc "github.com/tomwangsvc/lib-svc/token/svc"
 )
 
 //revive:disable:cyclomatic
 func main() {
+	settings, err := loadSettings()
+	if err != nil {
+		log.Fatal("Failed initializing settings: ", err)
+	}
+
 	env, err := lib_env.New("car-svc")
 	if err != nil {
 		log.Fatal("Failed initializing env: ", err)
 	}
-	env.SpannerDatabaseId = "car-svc"
-	env.SpannerInstanceId = "tom-wang-dev"
-	env.GcpProjectId = "data-fabric-323905"
-	env.GcpProjectNumber = "518937487179"
 	ctx := lib_context.NewStartUpContext()
 
-	if err = lib_log.Init(ctx, *env); err != nil {
-		log.Fatal("Failed initializing logger: ", err)
+	// Logs are written to stdout when running locally as there is no logging client
+	if !settings.Local {
+		if err = lib_log.Init(ctx, *env); err != nil {
+			log.Fatal("Failed initializing logger: ", err)
+		}
 	}
 
 	lib_log.Info(ctx, "Initializing config")
-	config := newConfig(ctx, *env)
+	config := newConfig(ctx, *env, *settings)
 	lib_log.Info(ctx, "Initialized config")
 
 	schemaClient, err := lib_schema.NewClient(ctx, schema.SupportedSchema())
@@ -41,42 +61,139 @@ func main() {
 		lib_log.Fatal(ctx, "Failed initializing schema client", lib_log.FmtError(err))
 	}
 
-	libStorageClient, err := lib_storage.NewClient(ctx)
-	if err != nil {
-		lib_log.Fatal(ctx, "Failed initializing storage client", lib_log.FmtError(err))
-	}
-	defer func() {
-		if err := libStorageClient.Close(); err != nil {
-			lib_log.Error(ctx, "Failed closing storage client", lib_log.FmtError(err))
+	var libStorageClient lib_storage.Client
+	var publisherClient publisher.Client
+	var pubsubClient lib_pubsub.Client
+	var tokenIamClient lib_token_iam.Client
+	var tokenSvcClient lib_token_svc.Client
+	if settings.Local {
+		certificatesClient, err := certificates.NewClient(ctx, config.LocalCertificates)
+		if err != nil {
+			lib_log.Fatal(ctx, "Failed initializing certificates client", lib_log.FmtError(err))
 		}
-	}()
+
+		// Secrets are only required by the token iam client when the service is IAM
+		tokenIamClient, err = lib_token_iam.NewClient(ctx, config.TokenIam, certificatesClient, nil)
+		if err != nil {
+			lib_log.Fatal(ctx, "Failed initializing token iam client", lib_log.FmtError(err))
+		}
+
+		// Events are kept in memory, pubsub push and api tokens are not available when running locally
+		publisherClient = publisher.NewInMemoryClient(ctx)
+
+	} else {
+		libStorageClient, err = lib_storage.NewClient(ctx)
+		if err != nil {
+			lib_log.Fatal(ctx, "Failed initializing storage client", lib_log.FmtError(err))
+		}
+
+		certificatesClient, err := lib_certificates.NewClient(ctx, config.Certificates, libStorageClient)
+		if err != nil {
+			lib_log.Fatal(ctx, "Failed initializing certificates client", lib_log.FmtError(err))
+		}
+
+		secretsClient, err := lib_secrets.NewClient(ctx, config.Secrets, libStorageClient)
+		if err != nil {
+			lib_log.Fatal(ctx, "Failed initializing secrets client", lib_log.FmtError(err))
+		}
+
+		tokenIamClient, err = lib_token_iam.NewClient(ctx, config.TokenIam, certificatesClient, secretsClient)
+		if err != nil {
+			lib_log.Fatal(ctx, "Failed initializing token iam client", lib_log.FmtError(err))
+		}
+
+		tokenSvcClient, err = lib_token_svc.NewClient(ctx, config.TokenSvc, certificatesClient, secretsClient)
+		if err != nil {
+			lib_log.Fatal(ctx, "Failed initializing token svc client", lib_log.FmtError(err))
+		}
+
+		integrationClient := lib_integration.NewClient(ctx, config.Integration, tokenIamClient, tokenSvcClient)
+
+		tokenGcpClient := lib_token_gcp.NewClient(ctx, config.TokenGcp, integrationClient)
+
+		pubsubClient, err = lib_pubsub.NewClient(ctx, config.Pubsub, tokenSvcClient, tokenGcpClient)
+		if err != nil {
+			lib_log.Fatal(ctx, "Failed initializing pubsub client", lib_log.FmtError(err))
+		}
+		publisherClient = publisher.NewClient(ctx, pubsubClient)
+	}
 
 	spannerClient, err := spanner.NewClient(ctx, config.Spanner)
 	if err != nil {
 		lib_log.Fatal(ctx, "Failed initializing spanner client", lib_log.FmtError(err))
 	}
-	defer spannerClient.Close()
 
-	appClient := app.NewClient(config.App, spannerClient)
+	addFleetMetricsCollector(spannerClient)
+
+	appClient := app.NewClient(config.App, publisherClient, schemaClient, spannerClient, webhook.NewClient(config.Webhook))
+
+	ctxRelay, cancelRelay := context.WithCancel(ctx)
+	relayStopped := make(chan struct{})
+	go func() {
+		relay.Run(ctxRelay, config.Relay, appClient)
+		close(relayStopped)
+	}()
 
 	countriesMetadata, err := lib_countries.NewMetadata(ctx)
 	if err != nil {
 		lib_log.Fatal(ctx, "Failed initializing country metadata", lib_log.FmtError(err))
 	}
 
+	rbacPolicy, err := rbac.LoadPolicy(ctx, config.Rbac)
+	if err != nil {
+		lib_log.Fatal(ctx, "Failed loading rbac policy", lib_log.FmtError(err))
+	}
+
+	healthClient := health.NewClient(ctx, config.Health, newHealthChecks(*config, spannerClient, libStorageClient, pubsubClient))
+
 	lib_log.Info(ctx, "Initializing http client")
-	httpClient, err := http.NewClient(config.Http, appClient, schemaClient, *countriesMetadata)
+	httpClient, err := http.NewClient(config.Http, appClient, pubsubClient, schemaClient, tokenIamClient, tokenSvcClient, *rbacPolicy, *countriesMetadata, healthClient)
 	if err != nil {
 		lib_log.Fatal(ctx, "Failed initializing http client", lib_log.FmtError(err))
 	}
 	lib_log.Info(ctx, "Initialized http client")
 
-	lib_os.CleanUpAndExitOnInterrupt(ctx, []lib_os.Closer{spannerClient}, []lib_os.CloserWithError{libStorageClient}, []lib_os.Flusher{})
+	ctxSignal, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	lib_log.Info(ctx, "Listening and serving HTTP client", lib_log.FmtInt("config.Http.Env.Port", config.Http.Env.Port))
-	if err := httpClient.ListenAndServe(); err != nil {
-		lib_log.Fatal(ctx, "HTTP client unexpectedly returned with error, terminating...", lib_log.FmtError(err))
+	lib_log.Info(ctx, "Listening and serving HTTP client", lib_log.FmtInt("config.Http.Env.Port", config.Http.Env.Port), lib_log.FmtInt("config.Http.MetricsPort", config.Http.MetricsPort))
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpClient.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		lib_log.Fatal(ctx, "HTTP client unexpectedly returned, terminating...", lib_log.FmtError(err))
+	case <-ctxSignal.Done():
 	}
-	lib_log.Fatal(ctx, "HTTP client unexpectedly returned, terminating...")
+
+	// In-flight requests are drained before the relay is stopped, the clients they use are closed last
+	ctx, cancel := context.WithTimeout(lib_context.NewCleanUpContext(), shutdownTimeout)
+	defer cancel()
+	lib_log.Notice(ctx, "Shutting down")
+
+	if err := httpClient.Shutdown(ctx); err != nil {
+		lib_log.Error(ctx, "Failed draining HTTP client", lib_log.FmtError(err))
+	}
+
+	// Events and deliveries the relay did not finish are left in the outbox and retried by another instance
+	cancelRelay()
+	select {
+	case <-relayStopped:
+	case <-ctx.Done():
+		lib_log.Error(ctx, "Failed stopping relay before shutdown deadline")
+	}
+
+	if err := publisherClient.Close(); err != nil {
+		lib_log.Error(ctx, "Failed closing publisher client", lib_log.FmtError(err))
+	}
+	spannerClient.Close()
+	if libStorageClient != nil {
+		if err := libStorageClient.Close(); err != nil {
+			lib_log.Error(ctx, "Failed closing storage client", lib_log.FmtError(err))
+		}
+	}
+
+	lib_log.Notice(ctx, "Shut down")
 	//revive:enable:cyclomatic
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"car-svc/internal/lib/metrics"
+	"car-svc/internal/lib/spanner"
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+)
+
+const (
+	carStatusActive  = "active"
+	carStatusDeleted = "deleted"
+)
+
+var (
+	carSvcCars = promauto.With(metrics.Default).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "car_svc_cars",
+		Help: "Cars by status across tenants, test cars are not counted.",
+	}, []string{"status"})
+	carSvcRentalsActive = promauto.With(metrics.Default).NewGauge(prometheus.GaugeOpts{
+		Name: "car_svc_rentals_active",
+		Help: "Rentals started and not yet ended or cancelled across tenants, test rentals are not counted.",
+	})
+)
+
+// addFleetMetricsCollector adds the collector of the business gauges, they are counted at most once per interval however often the service is scraped
+func addFleetMetricsCollector(spannerClient spanner.Client) {
+	metrics.Default.AddCollector("fleet", fleetMetricsInterval, func(ctx context.Context) error {
+		fleetCounts, err := spannerClient.ReadFleetCounts(ctx)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading fleet counts")
+		}
+		carSvcCars.WithLabelValues(carStatusActive).Set(float64(fleetCounts.CarsActive))
+		carSvcCars.WithLabelValues(carStatusDeleted).Set(float64(fleetCounts.CarsDeleted))
+		carSvcRentalsActive.Set(float64(fleetCounts.RentalsActive))
+		return nil
+	})
+}
@@ -3,14 +3,24 @@ module car-svc
 go 1.16
 
 require (
+	cloud.google.com/go v0.93.3
 	cloud.google.com/go/kms v0.1.0 // indirect
+	cloud.google.com/go/pubsub v1.10.1
 	cloud.google.com/go/spanner v1.25.0
 	github.com/go-chi/chi/v5 v5.0.3
+	github.com/golang-jwt/jwt/v4 v4.5.2
 	github.com/google/uuid v1.3.0
+	github.com/lib/pq v1.9.0
+	github.com/prometheus/client_golang v1.11.1
 	github.com/stretchr/testify v1.7.0 // indirect
 	github.com/tomwangsvc/lib-svc v0.0.0-20210825220105-ea4808546d32
+	github.com/xeipuuv/gojsonschema v1.2.0
+	go.opencensus.io v0.23.0
 	golang.org/x/sys v0.0.0-20210823070655-63515b42dcdf // indirect
 	google.golang.org/api v0.54.0
 	google.golang.org/genproto v0.0.0-20210825212027-de86158e7fda
 	google.golang.org/grpc v1.40.0
 )
+
+// jwt-go is no longer maintained and is vulnerable to CVE-2020-26160, lib-svc verifies tokens with its maintained fork instead
+replace github.com/dgrijalva/jwt-go => github.com/golang-jwt/jwt v3.2.2+incompatible
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"car-svc/internal/lib/apikey"
+	"car-svc/internal/lib/dto"
+	"context"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/civil"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+// CreateApiKey generates the key and stores its hash, the key is only returned here
+func (c client) CreateApiKey(ctx context.Context, apiKeyCreate dto.ApiKeyCreate) (*dto.ApiKeyCreated, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtString("apiKeyCreate.UserInput.Name", apiKeyCreate.UserInput.Name))
+
+	key, keyPrefix, err := apikey.Generate()
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed generating api key")
+	}
+	apiKeyCreate.KeyHash = apikey.Hash(key)
+	apiKeyCreate.KeyPrefix = keyPrefix
+
+	apiKeyId, err := c.spannerClient.CreateApiKey(ctx, apiKeyCreate)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating api key")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("apiKeyId", apiKeyId))
+	return &dto.ApiKeyCreated{
+		ApiKeyId: apiKeyId,
+		Key:      key,
+	}, nil
+}
+
+func (c client) SearchApiKeys(ctx context.Context, apiKeysSearch dto.ApiKeysSearch) ([]byte, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("apiKeysSearch", apiKeysSearch))
+
+	apiKeys, pagination, err := c.spannerClient.SearchApiKeys(ctx, apiKeysSearch)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed searching api keys")
+	}
+
+	apiKeysResponse, err := c.spannerClient.TransformApiKeysToJson(ctx, apiKeys)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed transforming api keys to response")
+	}
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(apiKeysResponse)", len(apiKeysResponse)))
+	return apiKeysResponse, pagination, nil
+}
+
+// RotateApiKey generates the key that replaces the api key, the key is only returned here
+func (c client) RotateApiKey(ctx context.Context, apiKeyRotate dto.ApiKeyRotate) (*dto.ApiKeyCreated, error) {
+	lib_log.Info(ctx, "Rotating", lib_log.FmtString("apiKeyRotate.Id", apiKeyRotate.Id))
+
+	key, keyPrefix, err := apikey.Generate()
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed generating api key")
+	}
+	apiKeyRotate.KeyHash = apikey.Hash(key)
+	apiKeyRotate.KeyPrefix = keyPrefix
+
+	apiKeyId, err := c.spannerClient.RotateApiKey(ctx, apiKeyRotate)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed rotating api key")
+	}
+
+	lib_log.Info(ctx, "Rotated", lib_log.FmtString("apiKeyId", apiKeyId))
+	return &dto.ApiKeyCreated{
+		ApiKeyId: apiKeyId,
+		Key:      key,
+	}, nil
+}
+
+func (c client) RevokeApiKey(ctx context.Context, apiKeyRevoke dto.ApiKeyRevoke) error {
+	lib_log.Info(ctx, "Revoking", lib_log.FmtAny("apiKeyRevoke", apiKeyRevoke))
+
+	if err := c.spannerClient.RevokeApiKey(ctx, apiKeyRevoke); err != nil {
+		return lib_errors.Wrap(err, "Failed revoking api key")
+	}
+
+	lib_log.Info(ctx, "Revoked")
+	return nil
+}
+
+// AuthenticateApiKey returns the api key of a key that is neither revoked nor expired, any other key is unauthorized without saying why
+func (c client) AuthenticateApiKey(ctx context.Context, key string) (*dto.ApiKey, error) {
+	lib_log.Info(ctx, "Authenticating")
+
+	apiKey, err := c.spannerClient.ReadApiKeyByKeyHash(ctx, apikey.Hash(key))
+	if err != nil {
+		if lib_errors.IsCustomWithCode(err, http.StatusNotFound) {
+			return nil, lib_errors.NewCustom(http.StatusUnauthorized, "Api key not recognized")
+		}
+		return nil, lib_errors.Wrap(err, "Failed reading api key by key hash")
+	}
+	if !apiKey.Usable(time.Now()) {
+		return nil, lib_errors.NewCustom(http.StatusUnauthorized, "Api key revoked or expired")
+	}
+	if !apiKey.TenantId.Valid {
+		return nil, lib_errors.NewCustom(http.StatusUnauthorized, "Api key not in a tenant")
+	}
+
+	lib_log.Info(ctx, "Authenticated", lib_log.FmtString("apiKey.ApiKeyId", apiKey.ApiKeyId))
+	return &dto.ApiKey{
+		ApiKeyId:          apiKey.ApiKeyId,
+		Burst:             apiKey.Burst,
+		DailyQuota:        apiKey.DailyQuota,
+		LineageApiKeyId:   apiKey.Lineage(),
+		Name:              apiKey.Name,
+		RequestsPerSecond: apiKey.RequestsPerSecond,
+		Scopes:            apiKey.Scopes,
+		TenantId:          apiKey.TenantId.StringVal,
+		Test:              apiKey.Test,
+	}, nil
+}
+
+// ConsumeApiKeyQuota counts a request against the daily quota of the lineage of a key, a request over the quota is refused
+func (c client) ConsumeApiKeyQuota(ctx context.Context, lineageApiKeyId string, day civil.Date, dailyQuota int64) (int64, error) {
+	lib_log.Info(ctx, "Consuming", lib_log.FmtString("lineageApiKeyId", lineageApiKeyId))
+
+	used, err := c.spannerClient.ConsumeApiKeyQuota(ctx, lineageApiKeyId, day, dailyQuota)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed consuming api key quota")
+	}
+
+	lib_log.Info(ctx, "Consumed", lib_log.FmtInt64("used", used))
+	return used, nil
+}
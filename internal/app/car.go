@@ -2,7 +2,10 @@ package app
 
 import (
 	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/schema"
 	"context"
+	"encoding/json"
+	"time"
 
 	lib_errors "github.com/tomwangsvc/lib-svc/errors"
 	lib_log "github.com/tomwangsvc/lib-svc/log"
@@ -29,7 +32,7 @@ func (c client) SearchCars(ctx context.Context, carsSearch dto.CarsSearch) ([]by
 		return nil, nil, lib_errors.Wrap(err, "Failed searching cars")
 	}
 
-	carsResponse, err := c.spannerClient.TransformCarsToJson(ctx, cars)
+	carsResponse, err := c.spannerClient.TransformCarsToJson(ctx, cars, carsSearch.Fields)
 	if err != nil {
 		return nil, nil, lib_errors.Wrap(err, "Failed transforming cars to response")
 	}
@@ -46,7 +49,7 @@ func (c client) ReadCar(ctx context.Context, carRead dto.CarRead) ([]byte, error
 		return nil, lib_errors.Wrap(err, "Failed read car")
 	}
 
-	carResponse, err := c.spannerClient.TransformCarToJson(ctx, *car)
+	carResponse, err := c.spannerClient.TransformCarToJson(ctx, *car, carRead.Fields)
 	if err != nil {
 		return nil, lib_errors.Wrap(err, "Failed transforming car to response")
 	}
@@ -66,6 +69,25 @@ func (c client) UpdateCar(ctx context.Context, carUpdate dto.CarUpdate) error {
 	return nil
 }
 
+func (c client) PatchCar(ctx context.Context, carPatch dto.CarPatch) error {
+	lib_log.Info(ctx, "Patching", lib_log.FmtAny("carPatch", carPatch))
+
+	if err := c.spannerClient.PatchCar(ctx, carPatch, c.checkCar); err != nil {
+		return lib_errors.Wrap(err, "Failed patching car")
+	}
+
+	lib_log.Info(ctx, "Patched")
+	return nil
+}
+
+// checkCar checks a car that has been changed within a transaction against the full car schema before it is written
+func (c client) checkCar(ctx context.Context, car []byte) error {
+	if err := c.schemaClient.CheckBodyAgainstSchema(ctx, schema.Car, car); err != nil {
+		return lib_errors.Wrap(err, "Failed checking car against schema")
+	}
+	return nil
+}
+
 func (c client) DeleteCar(ctx context.Context, carDelete dto.CarDelete) error {
 	lib_log.Info(ctx, "Deleting", lib_log.FmtAny("carDelete", carDelete))
 
@@ -76,3 +98,45 @@ func (c client) DeleteCar(ctx context.Context, carDelete dto.CarDelete) error {
 	lib_log.Info(ctx, "Deleted", lib_log.FmtAny("carDelete", carDelete))
 	return nil
 }
+
+func (c client) RestoreCar(ctx context.Context, carRestore dto.CarRestore) error {
+	lib_log.Info(ctx, "Restoring", lib_log.FmtAny("carRestore", carRestore))
+
+	if err := c.spannerClient.RestoreCar(ctx, carRestore); err != nil {
+		return lib_errors.Wrap(err, "Failed restoring car")
+	}
+
+	lib_log.Info(ctx, "Restored", lib_log.FmtAny("carRestore", carRestore))
+	return nil
+}
+
+// PurgeCars hard deletes the cars of every tenant that were soft deleted longer ago than the retention period
+func (c client) PurgeCars(ctx context.Context) (int64, error) {
+	dateDeletedBefore := time.Now().Add(-c.config.DeletedCarRetention)
+	lib_log.Info(ctx, "Purging", lib_log.FmtTime("dateDeletedBefore", dateDeletedBefore))
+
+	count, err := c.spannerClient.PurgeCars(ctx, dateDeletedBefore)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed purging cars")
+	}
+
+	lib_log.Info(ctx, "Purged", lib_log.FmtInt64("count", count))
+	return count, nil
+}
+
+func (c client) BatchCars(ctx context.Context, carsBatch dto.CarsBatch) ([]byte, error) {
+	lib_log.Info(ctx, "Batching", lib_log.FmtString("carsBatch.Mode", carsBatch.Mode))
+
+	results, err := c.spannerClient.BatchCars(ctx, carsBatch)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed batching cars")
+	}
+
+	resultsResponse, err := json.Marshal(results)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed marshalling results")
+	}
+
+	lib_log.Info(ctx, "Batched", lib_log.FmtInt("len(resultsResponse)", len(resultsResponse)))
+	return resultsResponse, nil
+}
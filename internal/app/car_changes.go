@@ -0,0 +1,62 @@
+package app
+
+import (
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/spanner"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// ReadCarChanges reads the changes after the since token, when there are none it polls until changes are committed or the wait elapses
+func (c client) ReadCarChanges(ctx context.Context, carChangesRead dto.CarChangesRead) (*dto.CarChanges, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("carChangesRead", carChangesRead))
+
+	deadline := time.Now().Add(carChangesRead.Wait)
+	for {
+		carHistory, next, err := c.spannerClient.ReadCarChanges(ctx, carChangesRead)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car changes")
+		}
+
+		if len(carHistory) > 0 || carChangesRead.Since == nil || !time.Now().Add(c.config.CarChangesPollInterval).Before(deadline) {
+			carChanges := newCarChanges(carHistory, *next)
+			lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carChanges.Changes)", len(carChanges.Changes)), lib_log.FmtString("carChanges.NextSince", carChanges.NextSince))
+			return &carChanges, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			carChanges := newCarChanges(nil, *next)
+			lib_log.Info(ctx, "Read, context done", lib_log.FmtString("carChanges.NextSince", carChanges.NextSince))
+			return &carChanges, nil
+		case <-time.After(c.config.CarChangesPollInterval):
+		}
+	}
+}
+
+func newCarChanges(carHistory []spanner.CarHistory, next dto.CarChangesToken) dto.CarChanges {
+	carChanges := dto.CarChanges{
+		Changes:   []dto.CarChange{},
+		Next:      next,
+		NextSince: NewCarChangesSince(next),
+	}
+	for _, v := range carHistory {
+		carChanges.Changes = append(carChanges.Changes, dto.CarChange{
+			CarHistoryId: v.CarHistoryId,
+			CarId:        v.CarId,
+			DateCreated:  v.DateCreated,
+			Operation:    v.Operation,
+		})
+	}
+	return carChanges
+}
+
+// NewCarChangesSince encodes the token as the opaque since param returned to clients, it is decoded by the parser
+func NewCarChangesSince(carChangesToken dto.CarChangesToken) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s,%s", carChangesToken.DateCreated.UTC().Format(time.RFC3339Nano), carChangesToken.CarHistoryId)))
+}
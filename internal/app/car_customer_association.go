@@ -1 +1,21 @@
 package app
+
+import (
+	"car-svc/internal/lib/dto"
+	"context"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+func (c client) CreateCarCustomerAssociation(ctx context.Context, carCustomerAssociationCreate dto.CarCustomerAssociationCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtAny("carCustomerAssociationCreate", carCustomerAssociationCreate))
+
+	carCustomerAssociationId, err := c.spannerClient.CreateCarCustomerAssociation(ctx, carCustomerAssociationCreate)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating car customer association")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("carCustomerAssociationId", carCustomerAssociationId))
+	return carCustomerAssociationId, nil
+}
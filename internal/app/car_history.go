@@ -0,0 +1,38 @@
+package app
+
+import (
+	"car-svc/internal/lib/dto"
+	"context"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+func (c client) SearchCarHistory(ctx context.Context, carHistorySearch dto.CarHistorySearch) ([]byte, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("carHistorySearch", carHistorySearch))
+
+	carHistory, pagination, err := c.spannerClient.SearchCarHistory(ctx, carHistorySearch)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed searching car history")
+	}
+
+	carHistoryResponse, err := c.spannerClient.TransformCarHistoryToJson(ctx, carHistory)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed transforming car history to response")
+	}
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(carHistoryResponse)", len(carHistoryResponse)))
+	return carHistoryResponse, pagination, nil
+}
+
+func (c client) RevertCar(ctx context.Context, carRevert dto.CarRevert) error {
+	lib_log.Info(ctx, "Reverting", lib_log.FmtAny("carRevert", carRevert))
+
+	if err := c.spannerClient.RevertCar(ctx, carRevert); err != nil {
+		return lib_errors.Wrap(err, "Failed reverting car")
+	}
+
+	lib_log.Info(ctx, "Reverted", lib_log.FmtAny("carRevert", carRevert))
+	return nil
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/spanner"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// carsExportChunkSize is the number of cars encoded between flushes of the writer, so that a client receives the export as it is read
+const carsExportChunkSize = 100
+
+// ExportCars encodes every car matching the filters to the writer as it is read from spanner, the writer is flushed after each chunk of cars when it is a http.Flusher. Cars are encoded with the same json fields as the search response
+func (c client) ExportCars(ctx context.Context, carsExport dto.CarsExport, w io.Writer) (int, error) {
+	lib_log.Info(ctx, "Exporting", lib_log.FmtAny("carsExport", carsExport))
+
+	var encodeCar spanner.ExportCar
+	var flush func() error
+	switch carsExport.ContentType {
+	case constants.ContentTypeCsv:
+		encodeCar, flush = newCarsExportCsvEncoder(w, carsExport.Fields)
+	case constants.ContentTypeNdjson:
+		encodeCar, flush = newCarsExportNdjsonEncoder(w, carsExport.Fields)
+	default:
+		return 0, lib_errors.Errorf("Not recognized: carsExport.ContentType = %s", carsExport.ContentType)
+	}
+
+	flushChunk := func() error {
+		if err := flush(); err != nil {
+			return lib_errors.Wrap(err, "Failed flushing cars export")
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	var encoded int
+	count, err := c.spannerClient.ExportCars(ctx, carsExport, func(car spanner.Car) error {
+		if err := encodeCar(car); err != nil {
+			return lib_errors.Wrap(err, "Failed encoding car")
+		}
+		encoded++
+		if encoded%carsExportChunkSize == 0 {
+			if err := flushChunk(); err != nil {
+				return lib_errors.Wrap(err, "Failed flushing chunk")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed exporting cars")
+	}
+	if err := flushChunk(); err != nil {
+		return 0, lib_errors.Wrap(err, "Failed flushing chunk")
+	}
+
+	lib_log.Info(ctx, "Exported", lib_log.FmtInt("count", count))
+	return count, nil
+}
+
+func newCarsExportNdjsonEncoder(w io.Writer, fields []string) (spanner.ExportCar, func() error) {
+	filterBy := strings.Join(fields, ",")
+	return func(car spanner.Car) error {
+			carJson, err := lib_json.GenerateJson(car, spanner.CarFieldMetaData, filterBy)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed generating car json")
+			}
+			if _, err := w.Write(append(carJson, '\n')); err != nil {
+				return lib_errors.Wrap(err, "Failed writing car json")
+			}
+			return nil
+		}, func() error {
+			return nil
+		}
+}
+
+// newCarsExportCsvEncoder writes a header of the fields followed by a record per car, null values are written as empty strings
+func newCarsExportCsvEncoder(w io.Writer, fields []string) (spanner.ExportCar, func() error) {
+	if len(fields) == 0 {
+		fields = spanner.CarExportColumns
+	}
+	filterBy := strings.Join(fields, ",")
+	csvWriter := csv.NewWriter(w)
+	var headerWritten bool
+
+	return func(car spanner.Car) error {
+			if !headerWritten {
+				if err := csvWriter.Write(fields); err != nil {
+					return lib_errors.Wrap(err, "Failed writing csv header")
+				}
+				headerWritten = true
+			}
+
+			carJson, err := lib_json.GenerateJson(car, spanner.CarFieldMetaData, filterBy)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed generating car json")
+			}
+			var carMap map[string]interface{}
+			if err := json.Unmarshal(carJson, &carMap); err != nil {
+				return lib_errors.Wrap(err, "Failed unmarshalling car json")
+			}
+
+			record := make([]string, len(fields))
+			for i, field := range fields {
+				if v, ok := carMap[field]; ok && v != nil {
+					record[i] = fmt.Sprint(v)
+				}
+			}
+			if err := csvWriter.Write(record); err != nil {
+				return lib_errors.Wrap(err, "Failed writing csv record")
+			}
+			return nil
+		}, func() error {
+			if !headerWritten {
+				if err := csvWriter.Write(fields); err != nil {
+					return lib_errors.Wrap(err, "Failed writing csv header")
+				}
+			}
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	spanner_mock "car-svc/internal/lib/spanner/mock"
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_client_ExportCars(t *testing.T) {
+	type expected struct {
+		result string
+		err    error
+	}
+	var data = []struct {
+		desc string
+		client
+		input dto.CarsExport
+		expected
+	}{
+		{
+			desc:   "spanner error",
+			client: clientErrorSpanner,
+			input:  dto.CarsExport{ContentType: constants.ContentTypeCsv},
+			expected: expected{
+				err: lib_errors.Wrap(spanner_mock.ExpectedErrorClient, "Failed exporting cars"),
+			},
+		},
+		{
+			desc:   "csv",
+			client: clientSuccess,
+			input:  dto.CarsExport{ContentType: constants.ContentTypeCsv, Fields: []string{"car_id", "model_name", "test"}},
+			expected: expected{
+				result: "car_id,model_name,test\n,,false\n",
+			},
+		},
+		{
+			desc:   "csv without fields",
+			client: clientSuccess,
+			input:  dto.CarsExport{ContentType: constants.ContentTypeCsv},
+			expected: expected{
+				result: "branch_id,brand_name,car_id,date_created,date_deleted,date_updated,model_name,test\n,,,0001-01-01T00:00:00Z,,,,false\n",
+			},
+		},
+		{
+			desc:   "ndjson",
+			client: clientSuccess,
+			input:  dto.CarsExport{ContentType: constants.ContentTypeNdjson, Fields: []string{"car_id", "test"}},
+			expected: expected{
+				result: "{\"car_id\":\"\",\"test\":false}\n",
+			},
+		},
+	}
+
+	for i, d := range data {
+		w := httptest.NewRecorder()
+		_, err := d.client.ExportCars(context.Background(), d.input, w)
+		result := w.Body.String()
+
+		if d.expected.err != nil {
+			if !reflect.DeepEqual(err, d.expected.err) {
+				var r interface{} = err
+				if err != nil {
+					r = err.Error()
+				}
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err not equal",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   d.expected.err.Error(),
+					Result:     r,
+				}))
+			}
+		} else if err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err exists",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   nil,
+				Result:     err.Error(),
+			}))
+
+		} else if !w.Flushed {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "flushed",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   true,
+				Result:     w.Flushed,
+			}))
+
+		} else if result != d.expected.result {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.result,
+				Result:     result,
+			}))
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/importer"
+	"car-svc/internal/lib/schema"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_formatters "github.com/tomwangsvc/lib-svc/formatters"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// ImportCars validates and normalizes every row before the valid rows are created, the report of the import is stored so that it can be downloaded later
+func (c client) ImportCars(ctx context.Context, carsImport dto.CarsImport) (*dto.CarsImportReport, error) {
+	lib_log.Info(ctx, "Importing", lib_log.FmtString("carsImport.Format", carsImport.Format), lib_log.FmtInt("len(carsImport.Rows)", len(carsImport.Rows)))
+
+	var reportRows []dto.CarsImportReportRow
+	var carsImportCars []dto.CarsImportCar
+	seen := make(map[[2]string]bool)
+	for _, row := range carsImport.Rows {
+		carCreate, err := c.parseCarsImportRow(ctx, row, carsImport.Test)
+		if err != nil {
+			lib_log.Info(ctx, "Failed parsing row, will report row", lib_log.FmtInt("row.Number", row.Number), lib_log.FmtError(err))
+			reportRows = append(reportRows, newCarsImportErrorRow(row.Number, err))
+			continue
+		}
+
+		key := [2]string{carCreate.UserInput.BrandName, carCreate.UserInput.ModelName}
+		if seen[key] {
+			reportRows = append(reportRows, newCarsImportErrorRow(row.Number, lib_errors.NewCustom(http.StatusConflict, constants.ConflictDuplicateImportRow)))
+			continue
+		}
+		seen[key] = true
+
+		carsImportCars = append(carsImportCars, dto.CarsImportCar{
+			CarCreate: *carCreate,
+			Number:    row.Number,
+		})
+	}
+
+	if len(carsImportCars) > 0 {
+		importedRows, err := c.spannerClient.ImportCars(ctx, carsImportCars)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed importing cars")
+		}
+		reportRows = append(reportRows, importedRows...)
+	}
+	sort.SliceStable(reportRows, func(i, j int) bool {
+		return reportRows[i].Number < reportRows[j].Number
+	})
+
+	carsImportReport := dto.CarsImportReport{
+		Rows:      reportRows,
+		RowsTotal: len(carsImport.Rows),
+	}
+	for _, v := range reportRows {
+		if v.Status == http.StatusCreated {
+			carsImportReport.RowsImported++
+		} else {
+			carsImportReport.RowsFailed++
+		}
+	}
+
+	carsImportId, err := c.spannerClient.CreateCarsImport(ctx, carsImportReport, carsImport.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating cars import")
+	}
+	carsImportReport.CarsImportId = carsImportId
+
+	lib_log.Info(ctx, "Imported", lib_log.FmtString("carsImportId", carsImportId), lib_log.FmtInt("carsImportReport.RowsImported", carsImportReport.RowsImported), lib_log.FmtInt("carsImportReport.RowsFailed", carsImportReport.RowsFailed))
+	return &carsImportReport, nil
+}
+
+// parseCarsImportRow checks the row against the same schema as a single car create and normalizes the casing of the brand and model names
+func (c client) parseCarsImportRow(ctx context.Context, row dto.CarsImportRow, test bool) (*dto.CarCreate, error) {
+	if row.Error != nil {
+		return nil, row.Error
+	}
+	if err := c.schemaClient.CheckBodyAgainstSchema(ctx, schema.CarCreate, row.Body); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking row against schema")
+	}
+
+	carCreate := dto.CarCreate{
+		Test: test,
+	}
+	if err := json.Unmarshal(row.Body, &carCreate.UserInput); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed unmarshalling row into dto.CarCreate")
+	}
+	carCreate.UserInput.BrandName = lib_formatters.FormatTitleCase(carCreate.UserInput.BrandName)
+	carCreate.UserInput.ModelName = lib_formatters.FormatTitleCase(carCreate.UserInput.ModelName)
+
+	return &carCreate, nil
+}
+
+func newCarsImportErrorRow(number int, err error) dto.CarsImportReportRow {
+	row := dto.CarsImportReportRow{
+		Number: number,
+		Status: http.StatusInternalServerError,
+	}
+	if cerr, ok := err.(lib_errors.Custom); ok {
+		row.Status = cerr.Code
+		if body, _ := cerr.Render(); body != nil {
+			row.Errors, _ = lib_errors.ItemsFromRenderedCustomError(body)
+		}
+	}
+	return row
+}
+
+func (c client) ReadCarsImportReport(ctx context.Context, carsImportReportRead dto.CarsImportReportRead) ([]byte, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("carsImportReportRead", carsImportReportRead))
+
+	carsImportReport, err := c.spannerClient.ReadCarsImportReport(ctx, carsImportReportRead)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading cars import report")
+	}
+
+	carsImportReportCsv, err := importer.EncodeReportCsv(*carsImportReport)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed encoding cars import report csv")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carsImportReportCsv)", len(carsImportReportCsv)))
+	return carsImportReportCsv, nil
+}
@@ -2,33 +2,83 @@ package app
 
 import (
 	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/publisher"
 	"car-svc/internal/lib/spanner"
+	"car-svc/internal/lib/webhook"
 	"context"
+	"io"
+	"time"
 
+	"cloud.google.com/go/civil"
 	lib_env "github.com/tomwangsvc/lib-svc/env"
 	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+	lib_schema "github.com/tomwangsvc/lib-svc/schema"
 )
 
 type Client interface {
 	CreateCar(ctx context.Context, carCreate dto.CarCreate) (string, error)
 	SearchCars(ctx context.Context, categoriesSearch dto.CarsSearch) ([]byte, *lib_pagination.Pagination, error)
+	ExportCars(ctx context.Context, carsExport dto.CarsExport, w io.Writer) (int, error)
 	ReadCar(ctx context.Context, carRead dto.CarRead) ([]byte, error)
 	UpdateCar(ctx context.Context, carUpdate dto.CarUpdate) error
+	PatchCar(ctx context.Context, carPatch dto.CarPatch) error
 	DeleteCar(ctx context.Context, carDelete dto.CarDelete) error
+	RestoreCar(ctx context.Context, carRestore dto.CarRestore) error
+	PurgeCars(ctx context.Context) (int64, error)
+	BatchCars(ctx context.Context, carsBatch dto.CarsBatch) ([]byte, error)
+	ClaimIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, test bool) (*dto.IdempotentResponse, error)
+	CompleteIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, idempotentResponse dto.IdempotentResponse, test bool) error
+	ReleaseIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey) error
+	ImportCars(ctx context.Context, carsImport dto.CarsImport) (*dto.CarsImportReport, error)
+	ReadCarsImportReport(ctx context.Context, carsImportReportRead dto.CarsImportReportRead) ([]byte, error)
+	SearchCarHistory(ctx context.Context, carHistorySearch dto.CarHistorySearch) ([]byte, *lib_pagination.Pagination, error)
+	RevertCar(ctx context.Context, carRevert dto.CarRevert) error
+	ReadCarChanges(ctx context.Context, carChangesRead dto.CarChangesRead) (*dto.CarChanges, error)
+	CreateCarCustomerAssociation(ctx context.Context, carCustomerAssociationCreate dto.CarCustomerAssociationCreate) (string, error)
+	RelayOutboxEvents(ctx context.Context) (int, error)
+	ReadCustomer(ctx context.Context, customerRead dto.CustomerRead) ([]byte, error)
+	ConsumeCustomerEvent(ctx context.Context, customerEvent dto.CustomerEvent) error
+	CreateWebhookSubscription(ctx context.Context, webhookSubscriptionCreate dto.WebhookSubscriptionCreate) (string, error)
+	SearchWebhookSubscriptions(ctx context.Context, webhookSubscriptionsSearch dto.WebhookSubscriptionsSearch) ([]byte, *lib_pagination.Pagination, error)
+	DeleteWebhookSubscription(ctx context.Context, webhookSubscriptionDelete dto.WebhookSubscriptionDelete) error
+	SearchWebhookDeliveries(ctx context.Context, webhookDeliveriesSearch dto.WebhookDeliveriesSearch) ([]byte, *lib_pagination.Pagination, error)
+	RedeliverWebhookDelivery(ctx context.Context, webhookDeliveryRedeliver dto.WebhookDeliveryRedeliver) error
+	DispatchWebhookDeliveries(ctx context.Context) (int, error)
+	CreateApiKey(ctx context.Context, apiKeyCreate dto.ApiKeyCreate) (*dto.ApiKeyCreated, error)
+	SearchApiKeys(ctx context.Context, apiKeysSearch dto.ApiKeysSearch) ([]byte, *lib_pagination.Pagination, error)
+	RotateApiKey(ctx context.Context, apiKeyRotate dto.ApiKeyRotate) (*dto.ApiKeyCreated, error)
+	RevokeApiKey(ctx context.Context, apiKeyRevoke dto.ApiKeyRevoke) error
+	AuthenticateApiKey(ctx context.Context, key string) (*dto.ApiKey, error)
+	ConsumeApiKeyQuota(ctx context.Context, lineageApiKeyId string, day civil.Date, dailyQuota int64) (int64, error)
 }
 
 type Config struct {
-	Env lib_env.Env
+	CarChangesPollInterval time.Duration
+	DeletedCarRetention    time.Duration
+	Env                    lib_env.Env
+	OutboxBatchSize        int
+	OutboxTopicId          string
+
+	WebhookBatchSize      int
+	WebhookMaxAttempts    int
+	WebhookRetryDelayBase time.Duration
+	WebhookRetryDelayMax  time.Duration
 }
 
-func NewClient(config Config, spannerClient spanner.Client) Client {
+func NewClient(config Config, publisherClient publisher.Client, schemaClient lib_schema.Client, spannerClient spanner.Client, webhookClient webhook.Client) Client {
 	return client{
-		config:        config,
-		spannerClient: spannerClient,
+		config:          config,
+		publisherClient: publisherClient,
+		schemaClient:    schemaClient,
+		spannerClient:   spannerClient,
+		webhookClient:   webhookClient,
 	}
 }
 
 type client struct {
-	config        Config
-	spannerClient spanner.Client
+	config          Config
+	publisherClient publisher.Client
+	schemaClient    lib_schema.Client
+	spannerClient   spanner.Client
+	webhookClient   webhook.Client
 }
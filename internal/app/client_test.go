@@ -1,10 +1,15 @@
 package app
 
 import (
+	publisher_mock "car-svc/internal/lib/publisher/mock"
 	spanner_mock "car-svc/internal/lib/spanner/mock"
 )
 
 var (
+	clientErrorPublisher = client{
+		publisherClient: publisher_mock.ClientError,
+		spannerClient:   spanner_mock.ClientSuccess,
+	}
 	clientErrorSpanner = client{
 		spannerClient: spanner_mock.ClientError,
 	}
@@ -12,6 +17,7 @@ var (
 		spannerClient: spanner_mock.ClientErrorTransform,
 	}
 	clientSuccess = client{
-		spannerClient: spanner_mock.ClientSuccess,
+		publisherClient: publisher_mock.ClientSuccess,
+		spannerClient:   spanner_mock.ClientSuccess,
 	}
 )
@@ -1 +1,46 @@
 package app
+
+import (
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/rbac"
+	"context"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// ReadCustomer reads the customer and redacts the fields the caller is not permitted to read
+func (c client) ReadCustomer(ctx context.Context, customerRead dto.CustomerRead) ([]byte, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("customerRead", customerRead))
+
+	customer, err := c.spannerClient.ReadCustomer(ctx, customerRead)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading customer")
+	}
+
+	customerResponse, err := c.spannerClient.TransformCustomerToJson(ctx, *customer, rbac.Redactions(ctx, rbac.ResourceCustomer))
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed transforming customer to response")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(customerResponse)", len(customerResponse)))
+	return customerResponse, nil
+}
+
+func (c client) ConsumeCustomerEvent(ctx context.Context, customerEvent dto.CustomerEvent) error {
+	lib_log.Info(ctx, "Consuming", lib_log.FmtAny("customerEvent", customerEvent))
+
+	switch customerEvent.EventType {
+	case dto.EventTypeCustomerBlocked, dto.EventTypeCustomerDeleted:
+	default:
+		lib_log.Info(ctx, "Consumed, event type is not handled", lib_log.FmtString("customerEvent.EventType", customerEvent.EventType))
+		return nil
+	}
+
+	if err := c.spannerClient.BlockCustomer(ctx, customerEvent); err != nil {
+		return lib_errors.Wrap(err, "Failed blocking customer")
+	}
+
+	lib_log.Info(ctx, "Consumed", lib_log.FmtAny("customerEvent", customerEvent))
+	return nil
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"car-svc/internal/lib/dto"
+	"context"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// ClaimIdempotencyKey returns the stored response for a retry of the same request, nil is returned when the key has been claimed for the request
+func (c client) ClaimIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, test bool) (*dto.IdempotentResponse, error) {
+	lib_log.Info(ctx, "Claiming", lib_log.FmtString("idempotencyKey.Key", idempotencyKey.Key))
+
+	idempotentResponse, err := c.spannerClient.ClaimIdempotencyKey(ctx, idempotencyKey, test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed claiming idempotency key")
+	}
+
+	lib_log.Info(ctx, "Claimed", lib_log.FmtBool("idempotentResponse != nil", idempotentResponse != nil))
+	return idempotentResponse, nil
+}
+
+func (c client) CompleteIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, idempotentResponse dto.IdempotentResponse, test bool) error {
+	lib_log.Info(ctx, "Completing", lib_log.FmtString("idempotencyKey.Key", idempotencyKey.Key))
+
+	if err := c.spannerClient.CompleteIdempotencyKey(ctx, idempotencyKey, idempotentResponse, test); err != nil {
+		return lib_errors.Wrap(err, "Failed completing idempotency key")
+	}
+
+	lib_log.Info(ctx, "Completed")
+	return nil
+}
+
+func (c client) ReleaseIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey) error {
+	lib_log.Info(ctx, "Releasing", lib_log.FmtString("idempotencyKey.Key", idempotencyKey.Key))
+
+	if err := c.spannerClient.ReleaseIdempotencyKey(ctx, idempotencyKey); err != nil {
+		return lib_errors.Wrap(err, "Failed releasing idempotency key")
+	}
+
+	lib_log.Info(ctx, "Released")
+	return nil
+}
@@ -4,7 +4,10 @@ import (
 	"car-svc/internal/app"
 	"car-svc/internal/lib/dto"
 	"context"
+	"io"
 
+	"cloud.google.com/go/civil"
+	lib_brand "github.com/tomwangsvc/lib-svc/brand"
 	lib_errors "github.com/tomwangsvc/lib-svc/errors"
 	lib_mock "github.com/tomwangsvc/lib-svc/mock"
 	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
@@ -27,6 +30,10 @@ func (clientError) SearchCars(_ context.Context, _ dto.CarsSearch) ([]byte, *lib
 	return nil, nil, ExpectedErrorClient
 }
 
+func (clientError) ExportCars(_ context.Context, _ dto.CarsExport, _ io.Writer) (int, error) {
+	return 0, ExpectedErrorClient
+}
+
 func (clientError) ReadCar(_ context.Context, _ dto.CarRead) ([]byte, error) {
 	return nil, ExpectedErrorClient
 }
@@ -35,10 +42,122 @@ func (clientError) UpdateCar(_ context.Context, _ dto.CarUpdate) error {
 	return ExpectedErrorClient
 }
 
+func (clientError) PatchCar(_ context.Context, _ dto.CarPatch) error {
+	return ExpectedErrorClient
+}
+
 func (clientError) DeleteCar(_ context.Context, _ dto.CarDelete) error {
 	return ExpectedErrorClient
 }
 
+func (clientError) RestoreCar(_ context.Context, _ dto.CarRestore) error {
+	return ExpectedErrorClient
+}
+
+func (clientError) PurgeCars(_ context.Context) (int64, error) {
+	return 0, ExpectedErrorClient
+}
+
+func (clientError) BatchCars(_ context.Context, _ dto.CarsBatch) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ClaimIdempotencyKey(_ context.Context, _ dto.IdempotencyKey, _ bool) (*dto.IdempotentResponse, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) CompleteIdempotencyKey(_ context.Context, _ dto.IdempotencyKey, _ dto.IdempotentResponse, _ bool) error {
+	return ExpectedErrorClient
+}
+
+func (clientError) ReleaseIdempotencyKey(_ context.Context, _ dto.IdempotencyKey) error {
+	return ExpectedErrorClient
+}
+
+func (clientError) ImportCars(_ context.Context, _ dto.CarsImport) (*dto.CarsImportReport, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ReadCarsImportReport(_ context.Context, _ dto.CarsImportReportRead) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) SearchCarHistory(_ context.Context, _ dto.CarHistorySearch) ([]byte, *lib_pagination.Pagination, error) {
+	return nil, nil, ExpectedErrorClient
+}
+
+func (clientError) RevertCar(_ context.Context, _ dto.CarRevert) error {
+	return ExpectedErrorClient
+}
+
+func (clientError) ReadCarChanges(_ context.Context, _ dto.CarChangesRead) (*dto.CarChanges, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) CreateCarCustomerAssociation(_ context.Context, _ dto.CarCustomerAssociationCreate) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (clientError) RelayOutboxEvents(_ context.Context) (int, error) {
+	return 0, ExpectedErrorClient
+}
+
+func (clientError) ReadCustomer(_ context.Context, _ dto.CustomerRead) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ConsumeCustomerEvent(_ context.Context, _ dto.CustomerEvent) error {
+	return ExpectedErrorClient
+}
+
+func (clientError) CreateWebhookSubscription(_ context.Context, _ dto.WebhookSubscriptionCreate) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (clientError) SearchWebhookSubscriptions(_ context.Context, _ dto.WebhookSubscriptionsSearch) ([]byte, *lib_pagination.Pagination, error) {
+	return nil, nil, ExpectedErrorClient
+}
+
+func (clientError) DeleteWebhookSubscription(_ context.Context, _ dto.WebhookSubscriptionDelete) error {
+	return ExpectedErrorClient
+}
+
+func (clientError) SearchWebhookDeliveries(_ context.Context, _ dto.WebhookDeliveriesSearch) ([]byte, *lib_pagination.Pagination, error) {
+	return nil, nil, ExpectedErrorClient
+}
+
+func (clientError) RedeliverWebhookDelivery(_ context.Context, _ dto.WebhookDeliveryRedeliver) error {
+	return ExpectedErrorClient
+}
+
+func (clientError) DispatchWebhookDeliveries(_ context.Context) (int, error) {
+	return 0, ExpectedErrorClient
+}
+
+func (clientError) CreateApiKey(_ context.Context, _ dto.ApiKeyCreate) (*dto.ApiKeyCreated, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) SearchApiKeys(_ context.Context, _ dto.ApiKeysSearch) ([]byte, *lib_pagination.Pagination, error) {
+	return nil, nil, ExpectedErrorClient
+}
+
+func (clientError) RotateApiKey(_ context.Context, _ dto.ApiKeyRotate) (*dto.ApiKeyCreated, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) RevokeApiKey(_ context.Context, _ dto.ApiKeyRevoke) error {
+	return ExpectedErrorClient
+}
+
+func (clientError) ConsumeApiKeyQuota(_ context.Context, _ string, _ civil.Date, _ int64) (int64, error) {
+	return 0, ExpectedErrorClient
+}
+
+func (clientError) AuthenticateApiKey(_ context.Context, _ string) (*dto.ApiKey, error) {
+	return nil, ExpectedErrorClient
+}
+
 type clientSuccess struct{}
 
 func (clientSuccess) CreateCar(_ context.Context, _ dto.CarCreate) (string, error) {
@@ -49,6 +168,13 @@ func (clientSuccess) SearchCars(_ context.Context, _ dto.CarsSearch) ([]byte, *l
 	return lib_mock.ExpectedResultBytes, nil, nil
 }
 
+func (clientSuccess) ExportCars(_ context.Context, _ dto.CarsExport, w io.Writer) (int, error) {
+	if _, err := w.Write(lib_mock.ExpectedResultBytes); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
 func (clientSuccess) ReadCar(_ context.Context, _ dto.CarRead) ([]byte, error) {
 	return lib_mock.ExpectedResultBytes, nil
 }
@@ -57,6 +183,128 @@ func (clientSuccess) UpdateCar(_ context.Context, _ dto.CarUpdate) error {
 	return nil
 }
 
+func (clientSuccess) PatchCar(_ context.Context, _ dto.CarPatch) error {
+	return nil
+}
+
 func (clientSuccess) DeleteCar(_ context.Context, _ dto.CarDelete) error {
 	return nil
 }
+
+func (clientSuccess) RestoreCar(_ context.Context, _ dto.CarRestore) error {
+	return nil
+}
+
+func (clientSuccess) PurgeCars(_ context.Context) (int64, error) {
+	return 1, nil
+}
+
+func (clientSuccess) BatchCars(_ context.Context, _ dto.CarsBatch) ([]byte, error) {
+	return lib_mock.ExpectedResultBytes, nil
+}
+
+func (clientSuccess) ClaimIdempotencyKey(_ context.Context, _ dto.IdempotencyKey, _ bool) (*dto.IdempotentResponse, error) {
+	return nil, nil
+}
+
+func (clientSuccess) CompleteIdempotencyKey(_ context.Context, _ dto.IdempotencyKey, _ dto.IdempotentResponse, _ bool) error {
+	return nil
+}
+
+func (clientSuccess) ReleaseIdempotencyKey(_ context.Context, _ dto.IdempotencyKey) error {
+	return nil
+}
+
+func (clientSuccess) ImportCars(_ context.Context, _ dto.CarsImport) (*dto.CarsImportReport, error) {
+	return &dto.CarsImportReport{CarsImportId: lib_mock.ExpectedResultString}, nil
+}
+
+func (clientSuccess) ReadCarsImportReport(_ context.Context, _ dto.CarsImportReportRead) ([]byte, error) {
+	return lib_mock.ExpectedResultBytes, nil
+}
+
+func (clientSuccess) SearchCarHistory(_ context.Context, _ dto.CarHistorySearch) ([]byte, *lib_pagination.Pagination, error) {
+	return lib_mock.ExpectedResultBytes, nil, nil
+}
+
+func (clientSuccess) RevertCar(_ context.Context, _ dto.CarRevert) error {
+	return nil
+}
+
+func (clientSuccess) ReadCarChanges(_ context.Context, _ dto.CarChangesRead) (*dto.CarChanges, error) {
+	return &dto.CarChanges{Changes: []dto.CarChange{{}}}, nil
+}
+
+func (clientSuccess) CreateCarCustomerAssociation(_ context.Context, _ dto.CarCustomerAssociationCreate) (string, error) {
+	return lib_mock.ExpectedResultString, nil
+}
+
+func (clientSuccess) RelayOutboxEvents(_ context.Context) (int, error) {
+	return 1, nil
+}
+
+func (clientSuccess) ReadCustomer(_ context.Context, _ dto.CustomerRead) ([]byte, error) {
+	return lib_mock.ExpectedResultBytes, nil
+}
+
+func (clientSuccess) ConsumeCustomerEvent(_ context.Context, _ dto.CustomerEvent) error {
+	return nil
+}
+
+func (clientSuccess) CreateWebhookSubscription(_ context.Context, _ dto.WebhookSubscriptionCreate) (string, error) {
+	return lib_mock.ExpectedResultString, nil
+}
+
+func (clientSuccess) SearchWebhookSubscriptions(_ context.Context, _ dto.WebhookSubscriptionsSearch) ([]byte, *lib_pagination.Pagination, error) {
+	return lib_mock.ExpectedResultBytes, nil, nil
+}
+
+func (clientSuccess) DeleteWebhookSubscription(_ context.Context, _ dto.WebhookSubscriptionDelete) error {
+	return nil
+}
+
+func (clientSuccess) SearchWebhookDeliveries(_ context.Context, _ dto.WebhookDeliveriesSearch) ([]byte, *lib_pagination.Pagination, error) {
+	return lib_mock.ExpectedResultBytes, nil, nil
+}
+
+func (clientSuccess) RedeliverWebhookDelivery(_ context.Context, _ dto.WebhookDeliveryRedeliver) error {
+	return nil
+}
+
+func (clientSuccess) DispatchWebhookDeliveries(_ context.Context) (int, error) {
+	return 1, nil
+}
+
+func (clientSuccess) CreateApiKey(_ context.Context, _ dto.ApiKeyCreate) (*dto.ApiKeyCreated, error) {
+	return &dto.ApiKeyCreated{ApiKeyId: lib_mock.ExpectedResultString, Key: lib_mock.ExpectedResultString}, nil
+}
+
+func (clientSuccess) SearchApiKeys(_ context.Context, _ dto.ApiKeysSearch) ([]byte, *lib_pagination.Pagination, error) {
+	return lib_mock.ExpectedResultBytes, &lib_pagination.Pagination{}, nil
+}
+
+func (clientSuccess) RotateApiKey(_ context.Context, _ dto.ApiKeyRotate) (*dto.ApiKeyCreated, error) {
+	return &dto.ApiKeyCreated{ApiKeyId: lib_mock.ExpectedResultString, Key: lib_mock.ExpectedResultString}, nil
+}
+
+func (clientSuccess) RevokeApiKey(_ context.Context, _ dto.ApiKeyRevoke) error {
+	return nil
+}
+
+func (clientSuccess) ConsumeApiKeyQuota(_ context.Context, _ string, _ civil.Date, _ int64) (int64, error) {
+	return 1, nil
+}
+
+// AuthenticateApiKey returns an api key granted car:read with a burst and quota of a single request
+func (clientSuccess) AuthenticateApiKey(_ context.Context, _ string) (*dto.ApiKey, error) {
+	return &dto.ApiKey{
+		ApiKeyId:          lib_mock.ExpectedResultString,
+		Burst:             1,
+		DailyQuota:        1,
+		LineageApiKeyId:   lib_mock.ExpectedResultString,
+		Name:              lib_mock.ExpectedResultString,
+		RequestsPerSecond: 1,
+		Scopes:            []string{"car:read"},
+		TenantId:          lib_brand.BoxerId,
+	}, nil
+}
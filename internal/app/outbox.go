@@ -0,0 +1,97 @@
+package app
+
+import (
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/spanner"
+	"context"
+	"encoding/json"
+
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// RelayOutboxEvents publishes a batch of the events committed to the outbox, creates their webhook deliveries and marks them as published, an event is published again if marking fails so consumers must de-duplicate by event id.
+// The webhook subscriptions are read once for the batch rather than for each run of events with the same attributes
+func (c client) RelayOutboxEvents(ctx context.Context) (int, error) {
+	lib_log.Info(ctx, "Relaying", lib_log.FmtInt("c.config.OutboxBatchSize", c.config.OutboxBatchSize))
+
+	outboxEvents, err := c.spannerClient.ReadOutboxEventsUnpublished(ctx, c.config.OutboxBatchSize)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed reading unpublished outbox events")
+	}
+	if len(outboxEvents) == 0 {
+		lib_log.Info(ctx, "Relayed")
+		return 0, nil
+	}
+
+	webhookSubscriptions, err := c.spannerClient.ReadWebhookSubscriptions(ctx)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed reading webhook subscriptions")
+	}
+
+	var count int
+	for _, outboxEventsWithSameAttributes := range groupOutboxEventsByAttributes(outboxEvents) {
+		// Attributes are read from the context by lib_pubsub, so they are set to those of the request that committed the events
+		ctxPublish := lib_context.WithCorrelationId(ctx, outboxEventsWithSameAttributes[0].CorrelationId)
+		ctxPublish = lib_context.WithTest(ctxPublish, outboxEventsWithSameAttributes[0].Test)
+
+		var datas [][]byte
+		var events []dto.Event
+		var outboxEventIds []string
+		for _, v := range outboxEventsWithSameAttributes {
+			event := newEvent(v)
+			data, err := json.Marshal(event)
+			if err != nil {
+				return count, lib_errors.Wrap(err, "Failed marshalling event")
+			}
+			datas = append(datas, data)
+			events = append(events, event)
+			outboxEventIds = append(outboxEventIds, v.OutboxEventId)
+		}
+
+		if _, err := c.publisherClient.Publish(ctxPublish, c.config.OutboxTopicId, datas); err != nil {
+			return count, lib_errors.Wrap(err, "Failed publishing events")
+		}
+
+		if _, err := c.spannerClient.CreateWebhookDeliveries(ctxPublish, events, webhookSubscriptions); err != nil {
+			return count, lib_errors.Wrap(err, "Failed creating webhook deliveries")
+		}
+
+		if err := c.spannerClient.UpdateOutboxEventsPublished(ctx, outboxEventIds); err != nil {
+			return count, lib_errors.Wrap(err, "Failed updating outbox events published")
+		}
+		count += len(outboxEventIds)
+	}
+
+	lib_log.Info(ctx, "Relayed", lib_log.FmtInt("count", count))
+	return count, nil
+}
+
+// groupOutboxEventsByAttributes splits the events into runs with the same message attributes, keeping the order in which they were committed
+func groupOutboxEventsByAttributes(outboxEvents []spanner.OutboxEvent) [][]spanner.OutboxEvent {
+	var groups [][]spanner.OutboxEvent
+	for _, v := range outboxEvents {
+		if n := len(groups); n > 0 && groups[n-1][0].CorrelationId == v.CorrelationId && groups[n-1][0].Test == v.Test {
+			groups[n-1] = append(groups[n-1], v)
+			continue
+		}
+		groups = append(groups, []spanner.OutboxEvent{v})
+	}
+	return groups
+}
+
+func newEvent(outboxEvent spanner.OutboxEvent) dto.Event {
+	event := dto.Event{
+		AggregateId: outboxEvent.AggregateId,
+		DateCreated: outboxEvent.DateCreated,
+		EventId:     outboxEvent.OutboxEventId,
+		EventType:   outboxEvent.EventType,
+		TenantId:    outboxEvent.TenantId.StringVal,
+		Test:        outboxEvent.Test,
+	}
+	if outboxEvent.Data.Valid {
+		event.Data = json.RawMessage(outboxEvent.Data.StringVal)
+	}
+	return event
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	publisher_mock "car-svc/internal/lib/publisher/mock"
+	spanner_mock "car-svc/internal/lib/spanner/mock"
+	"context"
+	"reflect"
+	"testing"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_client_RelayOutboxEvents(t *testing.T) {
+	type expected struct {
+		result int
+		err    error
+	}
+	var data = []struct {
+		desc string
+		client
+		expected
+	}{
+		{
+			desc:   "spanner error",
+			client: clientErrorSpanner,
+			expected: expected{
+				err: lib_errors.Wrap(spanner_mock.ExpectedErrorClient, "Failed reading unpublished outbox events"),
+			},
+		},
+		{
+			desc:   "publisher error",
+			client: clientErrorPublisher,
+			expected: expected{
+				err: lib_errors.Wrap(publisher_mock.ExpectedErrorClient, "Failed publishing events"),
+			},
+		},
+		{
+			desc:   "success",
+			client: clientSuccess,
+			expected: expected{
+				result: 1,
+			},
+		},
+	}
+
+	for i, d := range data {
+		result, err := d.client.RelayOutboxEvents(context.Background())
+
+		if d.expected.err != nil {
+			if !reflect.DeepEqual(err, d.expected.err) {
+				var r interface{} = err
+				if err != nil {
+					r = err.Error()
+				}
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err not equal",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   d.expected.err.Error(),
+					Result:     r,
+				}))
+			}
+		} else if err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err exists",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   nil,
+				Result:     err.Error(),
+			}))
+
+		} else {
+			if !reflect.DeepEqual(result, d.expected.result) {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "result",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   d.expected.result,
+					Result:     result,
+				}))
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package app
+
+import (
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/spanner"
+	"car-svc/internal/lib/webhook"
+	"context"
+	"time"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+func (c client) CreateWebhookSubscription(ctx context.Context, webhookSubscriptionCreate dto.WebhookSubscriptionCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtString("webhookSubscriptionCreate.UserInput.Url", webhookSubscriptionCreate.UserInput.Url))
+
+	webhookSubscriptionId, err := c.spannerClient.CreateWebhookSubscription(ctx, webhookSubscriptionCreate)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating webhook subscription")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("webhookSubscriptionId", webhookSubscriptionId))
+	return webhookSubscriptionId, nil
+}
+
+func (c client) SearchWebhookSubscriptions(ctx context.Context, webhookSubscriptionsSearch dto.WebhookSubscriptionsSearch) ([]byte, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("webhookSubscriptionsSearch", webhookSubscriptionsSearch))
+
+	webhookSubscriptions, pagination, err := c.spannerClient.SearchWebhookSubscriptions(ctx, webhookSubscriptionsSearch)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed searching webhook subscriptions")
+	}
+
+	webhookSubscriptionsResponse, err := c.spannerClient.TransformWebhookSubscriptionsToJson(ctx, webhookSubscriptions)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed transforming webhook subscriptions to response")
+	}
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(webhookSubscriptionsResponse)", len(webhookSubscriptionsResponse)))
+	return webhookSubscriptionsResponse, pagination, nil
+}
+
+func (c client) DeleteWebhookSubscription(ctx context.Context, webhookSubscriptionDelete dto.WebhookSubscriptionDelete) error {
+	lib_log.Info(ctx, "Deleting", lib_log.FmtAny("webhookSubscriptionDelete", webhookSubscriptionDelete))
+
+	if err := c.spannerClient.DeleteWebhookSubscription(ctx, webhookSubscriptionDelete); err != nil {
+		return lib_errors.Wrap(err, "Failed deleting webhook subscription")
+	}
+
+	lib_log.Info(ctx, "Deleted")
+	return nil
+}
+
+func (c client) SearchWebhookDeliveries(ctx context.Context, webhookDeliveriesSearch dto.WebhookDeliveriesSearch) ([]byte, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("webhookDeliveriesSearch", webhookDeliveriesSearch))
+
+	webhookDeliveries, pagination, err := c.spannerClient.SearchWebhookDeliveries(ctx, webhookDeliveriesSearch)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed searching webhook deliveries")
+	}
+
+	webhookDeliveriesResponse, err := c.spannerClient.TransformWebhookDeliveriesToJson(ctx, webhookDeliveries)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed transforming webhook deliveries to response")
+	}
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(webhookDeliveriesResponse)", len(webhookDeliveriesResponse)))
+	return webhookDeliveriesResponse, pagination, nil
+}
+
+func (c client) RedeliverWebhookDelivery(ctx context.Context, webhookDeliveryRedeliver dto.WebhookDeliveryRedeliver) error {
+	lib_log.Info(ctx, "Redelivering", lib_log.FmtAny("webhookDeliveryRedeliver", webhookDeliveryRedeliver))
+
+	if err := c.spannerClient.RedeliverWebhookDelivery(ctx, webhookDeliveryRedeliver); err != nil {
+		return lib_errors.Wrap(err, "Failed redelivering webhook delivery")
+	}
+
+	lib_log.Info(ctx, "Redelivered")
+	return nil
+}
+
+// DispatchWebhookDeliveries sends a batch of the deliveries that are due, a delivery that fails is retried with exponential backoff and moved to the dead letter status after the max attempts
+func (c client) DispatchWebhookDeliveries(ctx context.Context) (int, error) {
+	lib_log.Info(ctx, "Dispatching", lib_log.FmtInt("c.config.WebhookBatchSize", c.config.WebhookBatchSize))
+
+	webhookDeliveriesDue, err := c.spannerClient.ReadWebhookDeliveriesDue(ctx, c.config.WebhookBatchSize)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed reading webhook deliveries due")
+	}
+
+	var count int
+	for _, v := range webhookDeliveriesDue {
+		statusCode, err := c.webhookClient.Send(ctx, webhook.Delivery{
+			DeliveryId: v.WebhookDeliveryId,
+			EventId:    v.EventId,
+			EventType:  v.EventType,
+			Payload:    []byte(v.Payload),
+			Secret:     v.Secret,
+			Url:        v.Url,
+		})
+
+		webhookDeliveryAttempt := c.newWebhookDeliveryAttempt(v.WebhookDelivery, statusCode, err)
+		if err := c.spannerClient.UpdateWebhookDeliveryAttempted(ctx, v.WebhookDelivery, webhookDeliveryAttempt); err != nil {
+			return count, lib_errors.Wrap(err, "Failed updating webhook delivery attempted")
+		}
+		if webhookDeliveryAttempt.Status == dto.WebhookDeliveryStatusSucceeded {
+			count++
+		}
+	}
+
+	lib_log.Info(ctx, "Dispatched", lib_log.FmtInt("len(webhookDeliveriesDue)", len(webhookDeliveriesDue)), lib_log.FmtInt("count", count))
+	return count, nil
+}
+
+func (c client) newWebhookDeliveryAttempt(webhookDelivery spanner.WebhookDelivery, statusCode int, errSend error) dto.WebhookDeliveryAttempt {
+	webhookDeliveryAttempt := dto.WebhookDeliveryAttempt{}
+	if errSend != nil {
+		e := errSend.Error()
+		webhookDeliveryAttempt.Error = &e
+	} else {
+		webhookDeliveryAttempt.ResponseStatusCode = &statusCode
+		if statusCode >= 200 && statusCode < 300 {
+			webhookDeliveryAttempt.Status = dto.WebhookDeliveryStatusSucceeded
+			return webhookDeliveryAttempt
+		}
+	}
+
+	attempts := int(webhookDelivery.Attempts) + 1
+	if attempts >= c.config.WebhookMaxAttempts {
+		webhookDeliveryAttempt.Status = dto.WebhookDeliveryStatusDeadLetter
+		return webhookDeliveryAttempt
+	}
+
+	dateNextAttempt := time.Now().UTC().Add(webhook.RetryDelay(attempts, c.config.WebhookRetryDelayBase, c.config.WebhookRetryDelayMax))
+	webhookDeliveryAttempt.DateNextAttempt = &dateNextAttempt
+	webhookDeliveryAttempt.Status = dto.WebhookDeliveryStatusPending
+	return webhookDeliveryAttempt
+}
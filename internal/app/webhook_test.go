@@ -0,0 +1,82 @@
+package app
+
+import (
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/spanner"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_client_newWebhookDeliveryAttempt(t *testing.T) {
+	c := client{
+		config: Config{
+			WebhookMaxAttempts:    3,
+			WebhookRetryDelayBase: time.Minute,
+			WebhookRetryDelayMax:  time.Hour,
+		},
+	}
+
+	type expected struct {
+		status          string
+		dateNextAttempt bool
+		error           bool
+	}
+	var data = []struct {
+		desc       string
+		attempts   int64
+		statusCode int
+		errSend    error
+		expected
+	}{
+		{
+			desc:       "success",
+			statusCode: http.StatusNoContent,
+			expected: expected{
+				status: dto.WebhookDeliveryStatusSucceeded,
+			},
+		},
+		{
+			desc:       "error status code",
+			statusCode: http.StatusInternalServerError,
+			expected: expected{
+				status:          dto.WebhookDeliveryStatusPending,
+				dateNextAttempt: true,
+			},
+		},
+		{
+			desc:    "send error",
+			errSend: errors.New("connection refused"),
+			expected: expected{
+				status:          dto.WebhookDeliveryStatusPending,
+				dateNextAttempt: true,
+				error:           true,
+			},
+		},
+		{
+			desc:       "last attempt",
+			attempts:   2,
+			statusCode: http.StatusInternalServerError,
+			expected: expected{
+				status: dto.WebhookDeliveryStatusDeadLetter,
+			},
+		},
+	}
+
+	for i, d := range data {
+		result := c.newWebhookDeliveryAttempt(spanner.WebhookDelivery{Attempts: d.attempts}, d.statusCode, d.errSend)
+
+		if result.Status != d.expected.status || (result.DateNextAttempt != nil) != d.expected.dateNextAttempt || (result.Error != nil) != d.expected.error {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
@@ -3,68 +3,250 @@ package http
 import (
 	"car-svc/internal/app"
 	"car-svc/internal/http/routes"
+	"car-svc/internal/lib/drain"
+	"car-svc/internal/lib/health"
+	"car-svc/internal/lib/metrics"
+	"car-svc/internal/lib/ratelimit"
+	"car-svc/internal/lib/rbac"
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	lib_countries "github.com/tomwangsvc/lib-svc/countries"
 	lib_env "github.com/tomwangsvc/lib-svc/env"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
 	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pubsub "github.com/tomwangsvc/lib-svc/pubsub"
 	lib_schema "github.com/tomwangsvc/lib-svc/schema"
+	lib_token_iam "github.com/tomwangsvc/lib-svc/token/iam"
+	lib_token_svc "github.com/tomwangsvc/lib-svc/token/svc"
 )
 
 // @title car-svc
 
 type Client interface {
 	ListenAndServe() error
+	Shutdown(ctx context.Context) error
 }
 
 type Config struct {
-	Env lib_env.Env
+	// DrainDelay is how long health fails before the server stops accepting connections, so that the load balancer stops routing to the instance first
+	DrainDelay time.Duration
+	Env        lib_env.Env
+
+	// The timeouts are those of http.Server, WriteTimeout must allow for the timeouts of the routes
+	IdleTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+
+	// MetricsPort is the port of the metrics server, it is not that of the service so that metrics are only reachable by the sidecar that scrapes them, metrics are not served when it is 0
+	MetricsPort int
+
+	// LongPollTimeout bounds a long poll of the feed of car changes, which waits for changes for up to 30 seconds, RequestTimeout bounds every other request that does not stream its response
+	LongPollTimeout time.Duration
+	RequestTimeout  time.Duration
 }
 
 type client struct {
-	config Config
-	router *chi.Mux
+	config        Config
+	drain         *drain.Drain
+	metricsServer *http.Server
+	server        *http.Server
 }
 
 func NewClient(
 	config Config,
 	appClient app.Client,
+	pubsubClient lib_pubsub.Client,
 	schemaClient lib_schema.Client,
+	tokenIamClient lib_token_iam.Client,
+	tokenSvcClient lib_token_svc.Client,
+	rbacPolicy rbac.Policy,
 	countriesMetadata lib_countries.Metadata,
+	healthClient health.Client,
 ) (Client, error) {
 
-	routesClient := routes.NewClient(routes.Config{Env: config.Env}, appClient, schemaClient, countriesMetadata)
+	// The burst of an api key is smoothed by each instance on its own, its daily quota is counted in storage so that it holds across the instances
+	limiter := ratelimit.NewLimiter(appClient.ConsumeApiKeyQuota)
+
+	d := drain.New()
+	routesClient := routes.NewClient(routes.Config{Env: config.Env}, appClient, pubsubClient, schemaClient, countriesMetadata, d, healthClient)
 
 	r := chi.NewRouter()
-	lib_http.GeneralMiddleware(r, config.Env.Id, config.Env.MaintenanceMode, []string{"/car-svc?health=true"})
+	// The permission of a route is looked up with the root router as the pattern of a route is only complete once the request has been routed
+	root := r
+	r.Use(timeout(config.RequestTimeout, config.LongPollTimeout))
+	r.Use(measure)
+	lib_http.GeneralMiddlewareWithNoTimeout(r, config.Env.Id, config.Env.MaintenanceMode, []string{"/car-svc?health=true", "/car-svc/health/live", "/car-svc/health/ready"})
 
 	r.Route("/car-svc", func(r chi.Router) {
 		r.Get("/", routesClient.Health())
+		r.Get("/health/live", routesClient.Liveness())
+		r.Get("/health/ready", routesClient.Readiness())
 	})
 
+	// Pubsub push is authorized with the token of the push subscription, it is only available when there is a pubsub client
+	if pubsubClient != nil {
+		r.Route("/car-svc/v1/pubsub", func(r chi.Router) {
+			r.Use(pubsubClient.Authorize)
+			r.Post("/customer-events", routesClient.ConsumeCustomerEvent())
+		})
+	}
+
+	// Every other v1 route is authorized with an IAM or api token verified locally
 	r.Route("/car-svc/v1", func(r chi.Router) {
-		// TODO: authorize locally
-		// r.Use(iamClient.Authorize)
+		r.Use(authorize(tokenIamClient, tokenSvcClient, appClient))
+		r.Use(limitRate(limiter))
+		r.Use(authorizeRoles(rbacPolicy, root))
+		// Creating a car and batching cars store the idempotent response in the transaction of the request, every other POST is made idempotent by the middleware
+		r.Post("/cars:batch", routesClient.BatchCars())
+		r.With(idempotent(appClient)).Post("/cars:import", routesClient.ImportCars())
+		r.Get("/cars-imports/{id}/report", routesClient.ReadCarsImportReport())
+		r.Get("/customers/{id}", routesClient.ReadCustomer())
+		r.Route("/api-keys", func(r chi.Router) {
+			r.With(idempotent(appClient)).Post("/", routesClient.CreateApiKey())
+			r.Get("/", routesClient.SearchApiKeys())
+
+			r.Route("/{id}", func(r chi.Router) {
+				r.Delete("/", routesClient.RevokeApiKey())
+				r.With(idempotent(appClient)).Post("/rotate", routesClient.RotateApiKey())
+			})
+		})
+		r.Route("/webhook-subscriptions", func(r chi.Router) {
+			r.With(idempotent(appClient)).Post("/", routesClient.CreateWebhookSubscription())
+			r.Get("/", routesClient.SearchWebhookSubscriptions())
+
+			r.Route("/{id}", func(r chi.Router) {
+				r.Delete("/", routesClient.DeleteWebhookSubscription())
+				r.Get("/deliveries", routesClient.SearchWebhookDeliveries())
+				r.With(idempotent(appClient)).Post("/deliveries/{delivery_id}/redeliver", routesClient.RedeliverWebhookDelivery())
+			})
+		})
 		r.Route("/cars", func(r chi.Router) {
 			r.Post("/", routesClient.CreateCar())
 			r.Get("/", routesClient.SearchCars())
+			r.Get("/export", routesClient.ExportCars())
+			r.Get("/changes", routesClient.ReadCarChanges())
 
 			r.Route("/{id}", func(r chi.Router) {
 				r.Get("/", routesClient.ReadCar())
 				r.Put("/", routesClient.UpdateCar())
+				r.Patch("/", routesClient.PatchCar())
 				r.Delete("/", routesClient.DeleteCar())
+				r.With(idempotent(appClient)).Post("/restore", routesClient.RestoreCar())
+				r.Get("/history", routesClient.SearchCarHistory())
+				r.With(idempotent(appClient)).Post("/revert", routesClient.RevertCar())
+				r.With(idempotent(appClient)).Post("/rentals", routesClient.CreateCarCustomerAssociation())
 			})
 		})
 	})
 
+	// A route cannot be added without declaring the permission it requires
+	if err := rbacPolicy.CheckRoutes(r, isAuthorizedRoute); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking routes against rbac policy")
+	}
+
 	return client{
-		config: config,
-		router: r,
+		config:        config,
+		drain:         d,
+		metricsServer: newMetricsServer(config),
+		server: &http.Server{
+			Addr:              fmt.Sprintf(":%d", config.Env.Port),
+			ConnContext:       withConn,
+			Handler:           r,
+			IdleTimeout:       config.IdleTimeout,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			ReadTimeout:       config.ReadTimeout,
+			WriteTimeout:      config.WriteTimeout,
+		},
 	}, nil
 }
 
+// isAuthorizedRoute reports whether the route is authorized with an IAM or api token, pubsub push is authorized with the token of the push subscription instead
+func isAuthorizedRoute(pattern string) bool {
+	return strings.HasPrefix(pattern, "/car-svc/v1/") && !strings.HasPrefix(pattern, "/car-svc/v1/pubsub/")
+}
+
+// newMetricsServer returns the server of the metrics port, it is nil when there is no metrics port.
+// Metrics are scraped at the path Prometheus expects by default, they are not served by the router of the service so that they are not public.
+func newMetricsServer(config Config) *http.Server {
+	if config.MetricsPort == 0 {
+		return nil
+	}
+	r := chi.NewRouter()
+	r.Get("/metrics", metrics.Default.Handler())
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", config.MetricsPort),
+		Handler:           r,
+		IdleTimeout:       config.IdleTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+	}
+}
+
+// ListenAndServe serves the metrics server alongside the server, it returns the first error of either and nil once Shutdown has been called.
+// When either fails the other is closed before returning, so that an instance does not keep serving requests without metrics or metrics without requests.
 func (c client) ListenAndServe() error {
-	return http.ListenAndServe(fmt.Sprintf(":%d", c.config.Env.Port), c.router)
+	servers := []*http.Server{c.server}
+	if c.metricsServer != nil {
+		servers = append(servers, c.metricsServer)
+	}
+	errs := make(chan error, len(servers))
+	for _, v := range servers {
+		go func(server *http.Server) {
+			errs <- server.ListenAndServe()
+		}(v)
+	}
+
+	var errListenAndServe error
+	for range servers {
+		err := <-errs
+		if err == nil || err == http.ErrServerClosed || errListenAndServe != nil {
+			continue
+		}
+		errListenAndServe = err
+		for _, v := range servers {
+			if err := v.Close(); err != nil {
+				lib_log.Error(context.Background(), "Failed closing server", lib_log.FmtString("v.Addr", v.Addr), lib_log.FmtError(err))
+			}
+		}
+	}
+	if errListenAndServe != nil {
+		return lib_errors.Wrap(errListenAndServe, "Failed listening and serving")
+	}
+	return nil
+}
+
+// Shutdown fails health, waits for the drain delay and then stops accepting connections and waits for in-flight requests until the context is done, the connections left are closed
+func (c client) Shutdown(ctx context.Context) error {
+	c.drain.Start()
+
+	select {
+	case <-time.After(c.config.DrainDelay):
+	case <-ctx.Done():
+	}
+
+	if err := c.server.Shutdown(ctx); err != nil {
+		if err := c.server.Close(); err != nil {
+			return lib_errors.Wrap(err, "Failed closing server")
+		}
+		return lib_errors.Wrap(err, "Failed shutting down server, connections closed")
+	}
+
+	// Metrics are served until the requests of the service are drained, so that the drain is scraped
+	if c.metricsServer != nil {
+		if err := c.metricsServer.Shutdown(ctx); err != nil {
+			if err := c.metricsServer.Close(); err != nil {
+				return lib_errors.Wrap(err, "Failed closing metrics server")
+			}
+			return lib_errors.Wrap(err, "Failed shutting down metrics server, connections closed")
+		}
+	}
+	return nil
 }
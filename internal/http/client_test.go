@@ -0,0 +1,41 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_client_ListenAndServe(t *testing.T) {
+	// The metrics port is taken so that the metrics server fails while the server is serving
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	c := client{
+		metricsServer: &http.Server{Addr: listener.Addr().String()},
+		server:        &http.Server{Addr: "127.0.0.1:0"},
+	}
+	if err := c.ListenAndServe(); err == nil {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "err",
+			Desc:       "metrics port taken",
+			Expected:   "error",
+			Result:     err,
+		}))
+	}
+
+	// The server is closed with the metrics server rather than left serving
+	if err := c.server.ListenAndServe(); err != http.ErrServerClosed {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "err",
+			Desc:       "server after metrics server failed",
+			Expected:   http.ErrServerClosed,
+			Result:     err,
+		}))
+	}
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"car-svc/internal/lib/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// routeUnmatched is the route of a request that matched no route pattern, so that a scan of unknown paths does not add a series per path
+	routeUnmatched = "unmatched"
+
+	methodOther = "OTHER"
+)
+
+var (
+	httpRequestsTotal = promauto.With(metrics.Default).NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Requests by method, chi route pattern and status code.",
+	}, []string{"method", "route", "code"})
+	httpRequestDurationSeconds = promauto.With(metrics.Default).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Request latency in seconds by method, chi route pattern and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+)
+
+// measure records the count and latency of every request by the pattern of the route it matched, it must be the first middleware of the root router so that the time of every other middleware is included
+func measure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		// The pattern is only complete once the request has been routed
+		route := routeUnmatched
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		// A handler that writes nothing responds 200
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		labelValues := []string{metricsMethod(r.Method), route, strconv.Itoa(code)}
+		httpRequestsTotal.WithLabelValues(labelValues...).Inc()
+		httpRequestDurationSeconds.WithLabelValues(labelValues...).Observe(time.Since(start).Seconds())
+	})
+}
+
+// metricsMethod limits the methods recorded to those of the standard, so that a client cannot add a series per method
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPatch, http.MethodPost, http.MethodPut, http.MethodTrace:
+		return method
+	}
+	return methodOther
+}
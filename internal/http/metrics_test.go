@@ -0,0 +1,76 @@
+package http
+
+import (
+	"car-svc/internal/lib/metrics"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_measure(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(measure)
+	r.Route("/metrics-test/cars", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		r.Post("/", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	var data = []struct {
+		desc   string
+		method string
+		path   string
+		// expected is the series of the request, the id of the car is not a label as the route is its pattern
+		expected string
+	}{
+		{
+			desc:     "route pattern",
+			method:   http.MethodGet,
+			path:     "/metrics-test/cars/1",
+			expected: `http_requests_total{code="204",method="GET",route="/metrics-test/cars/{id}"}`,
+		},
+		{
+			desc:     "nothing written",
+			method:   http.MethodPost,
+			path:     "/metrics-test/cars",
+			expected: `http_requests_total{code="200",method="POST",route="/metrics-test/cars/"}`,
+		},
+		{
+			desc:     "unmatched",
+			method:   http.MethodGet,
+			path:     "/metrics-test/unknown",
+			expected: `http_requests_total{code="404",method="GET",route="unmatched"}`,
+		},
+		{
+			desc:     "non standard method",
+			method:   "PROPFIND",
+			path:     "/metrics-test/cars/1",
+			expected: `http_requests_total{code="405",method="OTHER",route="unmatched"}`,
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(d.method, d.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		rr := httptest.NewRecorder()
+		metrics.Default.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if !strings.Contains(rr.Body.String(), d.expected+" ") {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "metrics",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     rr.Body.String(),
+			}))
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package http
+
+import (
+	"bytes"
+	"car-svc/internal/app"
+	"car-svc/internal/http/routes/parser"
+	"car-svc/internal/lib/actor"
+	"car-svc/internal/lib/apikey"
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/ratelimit"
+	"car-svc/internal/lib/rbac"
+	"car-svc/internal/lib/tenant"
+	"context"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_svc "github.com/tomwangsvc/lib-svc/svc"
+	lib_token_iam "github.com/tomwangsvc/lib-svc/token/iam"
+	lib_token_svc "github.com/tomwangsvc/lib-svc/token/svc"
+)
+
+// authorize verifies the bearer token locally with the public key of its issuer, tokens issued by IAM identify a user and any other issuer is a service calling with its api token.
+// The identity in the verified claims is put on the context and recorded as the actor of every change made by the request, partners authenticate with an api key instead of a token.
+// Every request is authorized for a single tenant, the brand of the identity provider of a user or the brand named by a service, and a partner is in the tenant of its api key.
+func authorize(tokenIamClient lib_token_iam.Client, tokenSvcClient lib_token_svc.Client, appClient app.Client) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			lib_log.Info(ctx, "Authorizing")
+
+			if key, ok := apikey.FromAuthorizationHeader(r.Header); ok {
+				apiKey, err := appClient.AuthenticateApiKey(ctx, key)
+				if err != nil {
+					lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed authenticating api key"))
+					return
+				}
+
+				ctx = lib_context.WithIamTokenClientId(ctx, apiKey.ApiKeyId)
+				ctx = lib_context.WithIamTokenClientName(ctx, apiKey.Name)
+				if apiKey.Test {
+					ctx = lib_context.WithTest(ctx, true)
+				}
+				ctx = tenant.WithTenantId(ctx, apiKey.TenantId)
+				ctx = apikey.WithApiKey(ctx, *apiKey)
+				ctx = actor.WithActor(ctx, actor.FromApiKey(*apiKey))
+
+				lib_log.Info(ctx, "Authorized", lib_log.FmtString("actor.Actor(ctx)", actor.Actor(ctx)))
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			token, err := lib_http.TokenFromAuthorizationHeader(r.Header)
+			if err != nil {
+				lib_http.RenderIamAuthError(ctx, w, lib_errors.Wrap(err, "Failed reading token from authorization header"))
+				return
+			}
+
+			unverifiedClaims, err := tokenIamClient.ExtractUnverifiedClaims(ctx, token)
+			if err != nil {
+				lib_http.RenderIamAuthError(ctx, w, lib_errors.Wrap(err, "Failed extracting unverified claims"))
+				return
+			}
+
+			var claims *lib_token_iam.Claims
+			if unverifiedClaims.Issuer == lib_svc.IamId {
+				claims, err = tokenIamClient.VerifyTokenAndExtractClaims(ctx, token)
+				if err != nil {
+					lib_http.RenderIamAuthError(ctx, w, lib_errors.Wrap(err, "Failed verifying iam token"))
+					return
+				}
+
+			} else {
+				if tokenSvcClient == nil {
+					lib_http.RenderIamAuthError(ctx, w, lib_errors.Errorf("Api tokens not supported, unable to verify token issued by %q", unverifiedClaims.Issuer))
+					return
+				}
+				svcClaims, err := tokenSvcClient.VerifyTokenAndExtractClaims(ctx, token)
+				if err != nil {
+					lib_http.RenderIamAuthError(ctx, w, lib_errors.Wrap(err, "Failed verifying api token"))
+					return
+				}
+				claims = &lib_token_iam.Claims{
+					ClientId:       svcClaims.ClientId,
+					ClientName:     svcClaims.ClientName,
+					Env:            svcClaims.Env,
+					StandardClaims: svcClaims.StandardClaims,
+				}
+			}
+
+			ctx = lib_context.WithIamTokenClientId(ctx, claims.ClientId)
+			ctx = lib_context.WithIamTokenClientName(ctx, claims.ClientName)
+			ctx = lib_context.WithIamTokenEmail(ctx, claims.Email)
+			ctx = lib_context.WithIamTokenIdentityExternalId(ctx, claims.IdentityExternalId)
+			ctx = lib_context.WithIamTokenIdentityId(ctx, claims.IdentityId)
+			ctx = lib_context.WithIamTokenIdentityProvider(ctx, claims.IdentityProvider)
+			ctx = lib_context.WithIamTokenName(ctx, claims.Name)
+			ctx = lib_context.WithIamTokenRoles(ctx, claims.Roles)
+			if claims.Test {
+				// A test token only ever reaches test data
+				ctx = lib_context.WithTest(ctx, true)
+			}
+			tenantId, err := tenant.FromRequest(r, *claims)
+			if err != nil {
+				lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed getting tenant of request"))
+				return
+			}
+			ctx = tenant.WithTenantId(ctx, tenantId)
+			ctx = actor.WithActor(ctx, actor.FromClaims(*claims))
+
+			lib_log.Info(ctx, "Authorized", lib_log.FmtString("actor.Actor(ctx)", actor.Actor(ctx)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// limitRate applies the rate limit and daily quota of the lineage of the api key the request was authenticated with, requests authorized with a token are not limited.
+// The limit closest to being exhausted is returned in the RateLimit headers so that partners can slow down before they are refused.
+func limitRate(limiter ratelimit.Limiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			apiKey, ok := apikey.FromContext(ctx)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := limiter.Allow(ctx, apiKey.LineageApiKeyId, ratelimit.Limit{
+				Burst:             apiKey.Burst,
+				DailyQuota:        apiKey.DailyQuota,
+				RequestsPerSecond: apiKey.RequestsPerSecond,
+			})
+			if err != nil {
+				lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed applying rate limit"))
+				return
+			}
+			reset := strconv.FormatInt(int64(math.Ceil(result.Reset.Seconds())), 10)
+			w.Header().Set("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+			w.Header().Set("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+			w.Header().Set("RateLimit-Reset", reset)
+
+			if !result.Allowed {
+				message := constants.TooManyRequestsRateLimitExceeded
+				if result.QuotaExceeded {
+					message = constants.TooManyRequestsQuotaExceeded
+				}
+				w.Header().Set("Retry-After", reset)
+				lib_http.RenderError(ctx, w, lib_errors.NewCustom(http.StatusTooManyRequests, message))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorizeRoles checks the roles of the caller grant the permission the policy requires for the route, api tokens have no roles and are granted the roles of their service in the policy.
+// Api keys have no roles either, they are granted the permissions in their scopes.
+// The scope of the permission is put on the context so that changes to cars outside the branches of the caller are denied, the field policies so that fields the caller may not read are redacted.
+func authorizeRoles(policy rbac.Policy, routes chi.Routes) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			rctx := chi.NewRouteContext()
+			if !routes.Match(rctx, r.Method, r.URL.Path) {
+				// Not found and method not allowed are rendered by the router
+				next.ServeHTTP(w, r)
+				return
+			}
+			permission, ok := policy.Permission(r.Method, rctx.RoutePattern())
+			if !ok {
+				lib_http.RenderAuthError(ctx, w, lib_errors.NewCustom(http.StatusForbidden, constants.ForbiddenPermissionDenied))
+				return
+			}
+
+			var grants rbac.Grants
+			if apiKey, ok := apikey.FromContext(ctx); ok {
+				grants = policy.ScopeGrants(apiKey.Scopes)
+			} else {
+				roles := lib_context.IamTokenRoles(ctx)
+				if lib_context.IamTokenIdentityId(ctx) == "" {
+					roles = policy.Services[lib_context.IamTokenClientName(ctx)]
+				}
+				grants = policy.Grants(roles)
+			}
+			scope, ok := grants[permission]
+			if !ok {
+				lib_http.RenderAuthError(ctx, w, lib_errors.NewCustomWithMetadata(http.StatusForbidden, constants.ForbiddenPermissionDenied, map[string]interface{}{
+					"permission": permission,
+				}))
+				return
+			}
+
+			lib_log.Info(ctx, "Authorized roles", lib_log.FmtString("permission", permission), lib_log.FmtAny("scope", scope))
+			ctx = rbac.WithGrants(ctx, grants, scope)
+			ctx = rbac.WithFields(ctx, policy.Fields)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// idempotent replays the response of a request retried with the same idempotency key, for routes whose handlers do not store the response in the transaction of the request.
+// The key is claimed before the request is handled so that a concurrent retry is refused rather than handled twice, the response is stored once the request succeeds and a request that fails releases the key so that it can be retried.
+// A key that is left pending, because the request crashed or its response could not be stored, can be claimed by a retry once its pending ttl expires, the retry then handles the request again.
+func idempotent(appClient app.Client) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed reading body"))
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			idempotencyKey, err := parser.ParseIdempotencyKey(r, body)
+			if err != nil {
+				lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing idempotency key"))
+				return
+			}
+			if idempotencyKey == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			test := lib_context.Test(ctx)
+			idempotentResponse, err := appClient.ClaimIdempotencyKey(ctx, *idempotencyKey, test)
+			if err != nil {
+				lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed claiming idempotency key"))
+				return
+			}
+			if idempotentResponse != nil {
+				lib_log.Info(ctx, "Replaying idempotent response", lib_log.FmtInt("idempotentResponse.StatusCode", idempotentResponse.StatusCode))
+				if idempotentResponse.Location != "" {
+					w.Header().Set("Location", idempotentResponse.Location)
+				}
+				if len(idempotentResponse.Body) > 0 {
+					w.Header().Set("Content-Type", "application/json")
+				}
+				w.WriteHeader(idempotentResponse.StatusCode)
+				if _, err := w.Write(idempotentResponse.Body); err != nil {
+					lib_log.Error(ctx, "Failed writing idempotent response", lib_log.FmtError(err))
+				}
+				return
+			}
+
+			var responseBody bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&responseBody)
+			next.ServeHTTP(ww, r)
+
+			// A handler that writes nothing responds 200
+			statusCode := ww.Status()
+			if statusCode == 0 {
+				statusCode = http.StatusOK
+			}
+			if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+				if err := appClient.ReleaseIdempotencyKey(ctx, *idempotencyKey); err != nil {
+					lib_log.Error(ctx, "Failed releasing idempotency key, the key is pending until its pending ttl expires", lib_log.FmtError(err))
+				}
+				return
+			}
+			if err := appClient.CompleteIdempotencyKey(ctx, *idempotencyKey, dto.IdempotentResponse{
+				Body:       responseBody.Bytes(),
+				Location:   ww.Header().Get("Location"),
+				StatusCode: statusCode,
+			}, test); err != nil {
+				lib_log.Error(ctx, "Failed completing idempotency key, the key is pending until its pending ttl expires", lib_log.FmtError(err))
+			}
+		})
+	}
+}
+
+// pathCarChanges is the feed of car changes, it is long-polled or streamed and so is not bound by the timeout of the other routes
+const pathCarChanges = "/car-svc/v1/cars/changes"
+
+// pathCarsExport streams every car matching the search, it is not bound by the timeout of the other routes as a large export takes longer
+const pathCarsExport = "/car-svc/v1/cars/export"
+
+// timeout bounds each request by the timeout of its route, a long poll of the feed of car changes waits for changes for longer than the other routes are allowed and a stream of it or an export is not bounded at all.
+// The write deadline of the server is cleared for a stream, which is open until the client disconnects or the service drains. The deadline is cleared on the connection put on the context by the server as the response writers of the general middleware cannot all be unwrapped to it
+func timeout(requestTimeout, longPollTimeout time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withRequestTimeout := middleware.Timeout(requestTimeout)(next)
+		withLongPollTimeout := middleware.Timeout(longPollTimeout)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == pathCarsExport:
+			case r.URL.Path != pathCarChanges:
+				withRequestTimeout.ServeHTTP(w, r)
+				return
+			case !parser.IsEventStreamAccepted(r):
+				withLongPollTimeout.ServeHTTP(w, r)
+				return
+			}
+
+			if err := clearWriteDeadline(r); err != nil {
+				lib_http.RenderError(r.Context(), w, lib_errors.Wrap(err, "Failed clearing write deadline"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type connContextKey struct{}
+
+// withConn is the ConnContext of the server, the connection is put on the context of its requests so that the write deadline set by the server can be cleared by a request
+func withConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+// clearWriteDeadline clears the write deadline the server sets on the connection when it reads the request, a connection serves a single request at a time
+func clearWriteDeadline(r *http.Request) error {
+	conn, ok := r.Context().Value(connContextKey{}).(net.Conn)
+	if !ok {
+		return lib_errors.New("Connection not on context")
+	}
+	if err := conn.SetWriteDeadline(time.Time{}); err != nil {
+		return lib_errors.Wrap(err, "Failed setting write deadline")
+	}
+	return nil
+}
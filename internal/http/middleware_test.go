@@ -0,0 +1,800 @@
+package http
+
+import (
+	"car-svc/internal/app"
+	app_mock "car-svc/internal/app/mock"
+	"car-svc/internal/http/routes/parser"
+	"car-svc/internal/lib/actor"
+	"car-svc/internal/lib/apikey"
+	"car-svc/internal/lib/certificates"
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/ratelimit"
+	"car-svc/internal/lib/rbac"
+	"car-svc/internal/lib/spanner"
+	"car-svc/internal/lib/tenant"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+	lib_brand "github.com/tomwangsvc/lib-svc/brand"
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_env "github.com/tomwangsvc/lib-svc/env"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_mock "github.com/tomwangsvc/lib-svc/mock"
+	lib_secrets "github.com/tomwangsvc/lib-svc/secrets"
+	lib_svc "github.com/tomwangsvc/lib-svc/svc"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+	lib_token_iam "github.com/tomwangsvc/lib-svc/token/iam"
+	lib_token_svc "github.com/tomwangsvc/lib-svc/token/svc"
+)
+
+// secretsClient has no key, the svc token client only needs it to create tokens and the tests only verify them
+type secretsClient struct {
+	lib_secrets.Client
+}
+
+func (secretsClient) ValueFromBase64AsBytes(secretDomain, secretType string) ([]byte, error) {
+	return nil, nil
+}
+
+func Test_authorize(t *testing.T) {
+	ctx := context.Background()
+	env := lib_env.Env{Id: "dev", SvcId: "car-svc"}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	certificatesClient, err := certificates.NewClient(ctx, certificates.Config{KeyFile: keyFile, Required: append(lib_token_iam.RequiredCertificates(), "customer-svc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenIamClient, err := lib_token_iam.NewClient(ctx, lib_token_iam.Config{Env: env}, certificatesClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenSvcClient, err := lib_token_svc.NewClient(ctx, lib_token_svc.Config{Env: env}, certificatesClient, secretsClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newToken := func(key *rsa.PrivateKey, issuer, identityProvider string, test bool) string {
+		now := time.Now()
+		claims := lib_token_iam.Claims{
+			ClientId:           "client-id",
+			ClientName:         "client-name",
+			Email:              "tom@example.com",
+			Env:                env.Id,
+			IdentityExternalId: "identity-external-id",
+			IdentityId:         "identity-id",
+			IdentityProvider:   identityProvider,
+			Name:               "Tom",
+			Test:               test,
+		}
+		claims.Audience = lib_svc.IamId
+		claims.ExpiresAt = now.Add(time.Minute).Unix()
+		claims.Id = "jti"
+		claims.IssuedAt = now.Add(-time.Minute).Unix()
+		claims.Issuer = issuer
+		claims.NotBefore = now.Add(-time.Minute).Unix()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+
+	newSvcToken := func(key *rsa.PrivateKey, issuer string) string {
+		now := time.Now()
+		claims := lib_token_svc.Claims{
+			ClientId:   issuer,
+			ClientName: issuer,
+			Env:        env.Id,
+		}
+		claims.Audience = env.SvcId
+		claims.ExpiresAt = now.Add(time.Minute).Unix()
+		claims.Id = "jti"
+		claims.IssuedAt = now.Add(-time.Minute).Unix()
+		claims.Issuer = issuer
+		claims.NotBefore = now.Add(-time.Minute).Unix()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+
+	type expected struct {
+		actor  string
+		code   int
+		tenant string
+		test   bool
+	}
+	var data = []struct {
+		desc           string
+		authorization  string
+		tenantHeader   string
+		appClient      app.Client
+		tokenSvcClient lib_token_svc.Client
+		expected
+	}{
+		{
+			desc:          "no token",
+			authorization: "",
+			expected: expected{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			desc:          "malformed token",
+			authorization: "Bearer token",
+			expected: expected{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			desc:          "token signed by another key",
+			authorization: newToken(otherKey, lib_svc.IamId, lib_brand.BoxerIdentityProvider, false),
+			expected: expected{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			desc:          "api token without token svc client",
+			authorization: newToken(key, "customer-svc", "", false),
+			expected: expected{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			desc:          "iam token",
+			authorization: newToken(key, lib_svc.IamId, lib_brand.BoxerIdentityProvider, false),
+			expected: expected{
+				actor:  "tom@example.com",
+				code:   http.StatusOK,
+				tenant: lib_brand.BoxerId,
+			},
+		},
+		{
+			desc:          "iam token naming its own tenant",
+			authorization: newToken(key, lib_svc.IamId, lib_brand.BoxerIdentityProvider, false),
+			tenantHeader:  lib_brand.BoxerId,
+			expected: expected{
+				actor:  "tom@example.com",
+				code:   http.StatusOK,
+				tenant: lib_brand.BoxerId,
+			},
+		},
+		{
+			desc:          "iam token naming another tenant",
+			authorization: newToken(key, lib_svc.IamId, lib_brand.BoxerIdentityProvider, false),
+			tenantHeader:  lib_brand.TomWangId,
+			expected: expected{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			desc:          "iam token of identity provider not of a brand without tenant",
+			authorization: newToken(key, lib_svc.IamId, "identity-provider", false),
+			expected: expected{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			desc:          "iam token of identity provider not of a brand naming tenant not recognized",
+			authorization: newToken(key, lib_svc.IamId, "identity-provider", false),
+			tenantHeader:  "UNKNOWN",
+			expected: expected{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			desc:          "iam token of identity provider not of a brand naming tenant",
+			authorization: newToken(key, lib_svc.IamId, "identity-provider", false),
+			tenantHeader:  lib_brand.TomWangId,
+			expected: expected{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			desc:           "api token naming tenant",
+			authorization:  newSvcToken(key, "customer-svc"),
+			tenantHeader:   lib_brand.TomWangId,
+			tokenSvcClient: tokenSvcClient,
+			expected: expected{
+				actor:  "customer-svc",
+				code:   http.StatusOK,
+				tenant: lib_brand.TomWangId,
+			},
+		},
+		{
+			desc:           "api token without tenant",
+			authorization:  newSvcToken(key, "customer-svc"),
+			tokenSvcClient: tokenSvcClient,
+			expected: expected{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			desc:          "api key not recognized",
+			authorization: "ApiKey key",
+			appClient:     app_mock.ClientError,
+			expected: expected{
+				code: app_mock.ExpectedErrorClient.Code,
+			},
+		},
+		{
+			desc:          "api key",
+			authorization: "ApiKey key",
+			appClient:     app_mock.ClientSuccess,
+			expected: expected{
+				actor:  "api_key:" + lib_mock.ExpectedResultString,
+				code:   http.StatusOK,
+				tenant: lib_brand.BoxerId,
+			},
+		},
+		{
+			desc:          "iam test token",
+			authorization: newToken(key, lib_svc.IamId, lib_brand.BoxerIdentityProvider, true),
+			expected: expected{
+				actor:  "tom@example.com",
+				code:   http.StatusOK,
+				tenant: lib_brand.BoxerId,
+				test:   true,
+			},
+		},
+	}
+
+	for i, d := range data {
+		var resultActor, resultTenant string
+		var resultTest bool
+		handler := authorize(tokenIamClient, d.tokenSvcClient, d.appClient)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			resultActor = actor.Actor(r.Context())
+			resultTenant, _ = tenant.TenantId(r.Context())
+			resultTest = lib_context.Test(r.Context())
+		}))
+
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.authorization != "" {
+			req.Header.Set("Authorization", d.authorization)
+		}
+		if d.tenantHeader != "" {
+			req.Header.Set(tenant.HeaderKeyXLcTenantId, d.tenantHeader)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if code := rr.Code; code != d.expected.code {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "code",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.code,
+				Result:     code,
+			}))
+		}
+		if resultActor != d.expected.actor || resultTenant != d.expected.tenant || resultTest != d.expected.test {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "context",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     []interface{}{resultActor, resultTenant, resultTest},
+			}))
+		}
+	}
+}
+
+func Test_authorizeRoles(t *testing.T) {
+	policy := rbac.Policy{
+		Permissions: []string{"car:read", "car:write", rbac.PermissionCarReadDeleted},
+		Roles: map[string]rbac.Role{
+			"branch_agent": {BranchScoped: true, Permissions: []string{"car:read", "car:write"}},
+			"viewer":       {Permissions: []string{"car:read"}},
+		},
+		Routes: []rbac.Route{
+			{Method: http.MethodGet, Pattern: "/cars/{id}", Permission: "car:read"},
+			{Method: http.MethodPatch, Pattern: "/cars/{id}", Permission: "car:write"},
+		},
+		Services: map[string][]string{
+			"customer-svc": {"viewer"},
+		},
+		Version: rbac.PolicyVersion,
+	}
+	handler := func(http.ResponseWriter, *http.Request) {}
+	routes := chi.NewRouter()
+	routes.Get("/cars/{id}", handler)
+	routes.Patch("/cars/{id}", handler)
+	routes.Delete("/cars/{id}", handler)
+
+	type expected struct {
+		code        int
+		otherBranch bool
+	}
+	var data = []struct {
+		desc       string
+		method     string
+		clientName string
+		identityId string
+		roles      []string
+		scopes     []string
+		expected
+	}{
+		{
+			desc:       "route not in policy",
+			method:     http.MethodDelete,
+			identityId: "identity-id",
+			roles:      []string{"viewer"},
+			expected: expected{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			desc:       "role without permission",
+			method:     http.MethodPatch,
+			identityId: "identity-id",
+			roles:      []string{"viewer"},
+			expected: expected{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			desc:       "role with permission",
+			method:     http.MethodGet,
+			identityId: "identity-id",
+			roles:      []string{"viewer"},
+			expected: expected{
+				code:        http.StatusOK,
+				otherBranch: true,
+			},
+		},
+		{
+			desc:       "branch scoped role with permission",
+			method:     http.MethodPatch,
+			identityId: "identity-id",
+			roles:      []string{"branch_agent/branches/branch-id"},
+			expected: expected{
+				code: http.StatusOK,
+			},
+		},
+		{
+			desc:       "api token of service in policy",
+			method:     http.MethodGet,
+			clientName: "customer-svc",
+			expected: expected{
+				code:        http.StatusOK,
+				otherBranch: true,
+			},
+		},
+		{
+			desc:   "api key with scope",
+			method: http.MethodGet,
+			scopes: []string{"car:read"},
+			expected: expected{
+				code:        http.StatusOK,
+				otherBranch: true,
+			},
+		},
+		{
+			desc:   "api key without scope",
+			method: http.MethodPatch,
+			scopes: []string{"car:read"},
+			expected: expected{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			desc:       "api token of service not in policy",
+			method:     http.MethodGet,
+			clientName: "other-svc",
+			expected: expected{
+				code: http.StatusForbidden,
+			},
+		},
+	}
+
+	for i, d := range data {
+		var resultOtherBranch bool
+		next := authorizeRoles(policy, routes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			resultOtherBranch = rbac.CheckBranch(r.Context(), "other-branch-id") == nil
+		}))
+
+		req, err := http.NewRequest(d.method, "/cars/car-id", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := lib_context.WithIamTokenClientName(req.Context(), d.clientName)
+		ctx = lib_context.WithIamTokenIdentityId(ctx, d.identityId)
+		ctx = lib_context.WithIamTokenRoles(ctx, d.roles)
+		if d.scopes != nil {
+			ctx = apikey.WithApiKey(ctx, dto.ApiKey{ApiKeyId: "api-key-id", Scopes: d.scopes})
+		}
+		rr := httptest.NewRecorder()
+		next.ServeHTTP(rr, req.WithContext(ctx))
+
+		if code := rr.Code; code != d.expected.code {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "code",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.code,
+				Result:     code,
+			}))
+		}
+		if resultOtherBranch != d.expected.otherBranch {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "other branch in scope",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.otherBranch,
+				Result:     resultOtherBranch,
+			}))
+		}
+	}
+}
+
+func Test_limitRate(t *testing.T) {
+	apiKey := dto.ApiKey{ApiKeyId: "api-key-id", Burst: 2, DailyQuota: 10, LineageApiKeyId: "api-key-id", RequestsPerSecond: 1}
+
+	type expected struct {
+		code      int
+		remaining string
+	}
+	var data = []struct {
+		desc  string
+		ctx   func(context.Context) context.Context
+		count int
+		expected
+	}{
+		{
+			desc:  "token not limited",
+			ctx:   func(ctx context.Context) context.Context { return ctx },
+			count: 5,
+			expected: expected{
+				code: http.StatusOK,
+			},
+		},
+		{
+			desc:  "api key within burst",
+			ctx:   func(ctx context.Context) context.Context { return apikey.WithApiKey(ctx, apiKey) },
+			count: 2,
+			expected: expected{
+				code:      http.StatusOK,
+				remaining: "0",
+			},
+		},
+		{
+			desc:  "api key over burst",
+			ctx:   func(ctx context.Context) context.Context { return apikey.WithApiKey(ctx, apiKey) },
+			count: 3,
+			expected: expected{
+				code:      http.StatusTooManyRequests,
+				remaining: "0",
+			},
+		},
+	}
+
+	for i, d := range data {
+		handler := limitRate(ratelimit.NewLimiter(app_mock.ClientSuccess.ConsumeApiKeyQuota))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		var rr *httptest.ResponseRecorder
+		for n := 0; n < d.count; n++ {
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, req.WithContext(d.ctx(req.Context())))
+		}
+
+		if code := rr.Code; code != d.expected.code {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "code",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.code,
+				Result:     code,
+			}))
+		}
+		if remaining := rr.Header().Get("RateLimit-Remaining"); remaining != d.expected.remaining {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "remaining",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.remaining,
+				Result:     remaining,
+			}))
+		}
+		if retryAfter := rr.Header().Get("Retry-After"); (retryAfter != "") != (d.expected.code == http.StatusTooManyRequests) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "retry after",
+				Desc:       d.desc,
+				At:         i,
+				Result:     retryAfter,
+			}))
+		}
+	}
+}
+
+func Test_idempotent(t *testing.T) {
+	ctx := actor.WithActor(tenant.WithTenantId(context.Background(), lib_brand.BoxerId), "tom@example.com")
+	appClient := app.NewClient(app.Config{}, nil, nil, spanner.NewInMemoryClient(ctx, spanner.Config{IdempotencyKeyTtl: time.Hour}), nil)
+
+	var handled int
+	handler := idempotent(appClient)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled++
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", "id")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"handled":%d}`, handled)
+	}))
+
+	type expected struct {
+		body     string
+		code     int
+		handled  int
+		location string
+	}
+	var data = []struct {
+		desc           string
+		idempotencyKey string
+		body           string
+		expected
+	}{
+		{
+			desc:           "key not used",
+			idempotencyKey: "key",
+			body:           "body",
+			expected: expected{
+				body:     `{"handled":1}`,
+				code:     http.StatusCreated,
+				handled:  1,
+				location: "id",
+			},
+		},
+		{
+			desc:           "retry replayed",
+			idempotencyKey: "key",
+			body:           "body",
+			expected: expected{
+				body:     `{"handled":1}`,
+				code:     http.StatusCreated,
+				handled:  1,
+				location: "id",
+			},
+		},
+		{
+			desc:           "key reused for a different request",
+			idempotencyKey: "key",
+			body:           "other body",
+			expected: expected{
+				code:    http.StatusUnprocessableEntity,
+				handled: 1,
+			},
+		},
+		{
+			desc: "no key",
+			body: "body",
+			expected: expected{
+				body:     `{"handled":2}`,
+				code:     http.StatusCreated,
+				handled:  2,
+				location: "id",
+			},
+		},
+		{
+			desc:           "request failed",
+			idempotencyKey: "key failed",
+			body:           "fail",
+			expected: expected{
+				code:    http.StatusInternalServerError,
+				handled: 3,
+			},
+		},
+		{
+			desc:           "retry of request failed handled again",
+			idempotencyKey: "key failed",
+			body:           "fail",
+			expected: expected{
+				code:    http.StatusInternalServerError,
+				handled: 4,
+			},
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodPost, "/cars:import", strings.NewReader(d.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.idempotencyKey != "" {
+			req.Header.Set(parser.HeaderKeyIdempotencyKey, d.idempotencyKey)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req.WithContext(ctx))
+
+		result := expected{
+			code:     rr.Code,
+			handled:  handled,
+			location: rr.Header().Get("Location"),
+		}
+		if result.code != http.StatusUnprocessableEntity {
+			result.body = rr.Body.String()
+		}
+		if result != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_timeout(t *testing.T) {
+	const (
+		requestTimeout  = 100 * time.Millisecond
+		longPollTimeout = 200 * time.Millisecond
+		writeTimeout    = 300 * time.Millisecond
+		streamEvents    = 10
+		streamInterval  = 50 * time.Millisecond
+	)
+
+	// The handler streams for longer than every timeout, a long poll waits as long before responding and an export always streams
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if !parser.IsEventStreamAccepted(r) && r.URL.Path != pathCarsExport {
+			select {
+			case <-ctx.Done():
+			case <-time.After(streamEvents * streamInterval):
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", constants.ContentTypeEventStream)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for n := 0; n < streamEvents; n++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(streamInterval):
+			}
+			fmt.Fprintf(w, "data: %d\n\n", n)
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	r := chi.NewRouter()
+	r.Use(timeout(requestTimeout, longPollTimeout))
+	r.Use(measure)
+	lib_http.GeneralMiddlewareWithNoTimeout(r, "dev", false, nil)
+	r.Get(pathCarChanges, handler)
+	r.Get(pathCarsExport, handler)
+	r.Get("/car-svc/v1/cars", handler)
+
+	server := httptest.NewUnstartedServer(r)
+	server.Config.ConnContext = withConn
+	server.Config.WriteTimeout = writeTimeout
+	server.Start()
+	defer server.Close()
+
+	type expected struct {
+		code     int
+		complete bool
+	}
+	var data = []struct {
+		desc   string
+		path   string
+		stream bool
+		expected
+	}{
+		{
+			desc:   "stream of car changes outlives the request timeout and the write timeout",
+			path:   pathCarChanges,
+			stream: true,
+			expected: expected{
+				code:     http.StatusOK,
+				complete: true,
+			},
+		},
+		{
+			desc: "long poll of car changes bound by the long poll timeout",
+			path: pathCarChanges,
+			expected: expected{
+				code:     http.StatusGatewayTimeout,
+				complete: false,
+			},
+		},
+		{
+			desc: "export outlives the request timeout and the write timeout",
+			path: pathCarsExport,
+			expected: expected{
+				code:     http.StatusOK,
+				complete: true,
+			},
+		},
+		{
+			desc:   "stream of another route bound by the request timeout",
+			path:   "/car-svc/v1/cars",
+			stream: true,
+			expected: expected{
+				code:     http.StatusOK,
+				complete: false,
+			},
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodGet, server.URL+d.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.stream {
+			req.Header.Set("Accept", constants.ContentTypeEventStream)
+		}
+		res, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A stream cut short by a timeout may end without an error, it is complete when every event was received
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		if code := res.StatusCode; code != d.expected.code {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "code",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.code,
+				Result:     code,
+			}))
+		}
+		if complete := strings.Count(string(body), "data: ") == streamEvents; complete != d.expected.complete {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "complete",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.complete,
+				Result:     complete,
+			}))
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"net/http"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// @Summary create api key
+// @Param Authorization header string true "IAM token"
+// @Param Idempotency-Key header string false "key identifying retries of the same request, the stored response is replayed for retries"
+// @Description create an api key for a partner, the key is returned once and is sent in the Authorization header as 'ApiKey {key}'
+// @Description See schema file api_key_create.json for body requirements, the scopes are the permissions granted to the key and every request made with it counts against its rate limit and daily quota
+// @Success 201
+// @Router /v1/api-keys [post]
+func (c client) CreateApiKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Creating")
+
+		apiKeyCreate, err := c.parserClient.ParseCreateApiKey(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing create api key request"))
+			return
+		}
+
+		apiKeyCreated, err := c.appClient.CreateApiKey(ctx, *apiKeyCreate)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed creating api key"))
+			return
+		}
+
+		lib_log.Info(ctx, "Created", lib_log.FmtString("apiKeyCreated.ApiKeyId", apiKeyCreated.ApiKeyId))
+		lib_http.RenderCreatedWithBody(ctx, w, apiKeyCreated.ApiKeyId, apiKeyCreated)
+	}
+}
+
+// @Summary search api keys
+// @Param Authorization header string true "IAM token"
+// @Description search api keys, only the prefix of a key is returned
+// @Success 200
+// @Success 204
+// @Router /v1/api-keys [get]
+func (c client) SearchApiKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Searching")
+
+		apiKeysSearch, err := c.parserClient.ParseSearchApiKeys(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing search api keys request"))
+			return
+		}
+
+		apiKeysBytes, pagination, err := c.appClient.SearchApiKeys(ctx, *apiKeysSearch)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed searching api keys"))
+			return
+		}
+
+		if len(apiKeysBytes) == 0 {
+			lib_http.RenderNoContent(ctx, w)
+			return
+		}
+
+		lib_log.Info(ctx, "Searched", lib_log.FmtBytes("apiKeysBytes", apiKeysBytes), lib_log.FmtAny("pagination", pagination))
+		lib_http.RenderJsonBytesWithPagination(ctx, w, apiKeysBytes, *pagination)
+	}
+}
+
+// @Summary rotate api key
+// @Param Authorization header string true "IAM token"
+// @Param Idempotency-Key header string false "key identifying retries of the same request, the stored response is replayed for retries"
+// @Description replace an api key with a new key with the same scopes and limits, the new key is returned once and the old key keeps working until the overlap has elapsed
+// @Description See schema file api_key_rotate.json for body requirements, the overlap defaults to a day
+// @Success 201
+// @Router /v1/api-keys/{api_key_id}/rotate [post]
+func (c client) RotateApiKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Rotating")
+
+		apiKeyRotate, err := c.parserClient.ParseRotateApiKey(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing rotate api key request"))
+			return
+		}
+
+		apiKeyCreated, err := c.appClient.RotateApiKey(ctx, *apiKeyRotate)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed rotating api key"))
+			return
+		}
+
+		lib_log.Info(ctx, "Rotated", lib_log.FmtString("apiKeyCreated.ApiKeyId", apiKeyCreated.ApiKeyId))
+		lib_http.RenderCreatedWithBody(ctx, w, apiKeyCreated.ApiKeyId, apiKeyCreated)
+	}
+}
+
+// @Summary revoke api key
+// @Param Authorization header string true "IAM token"
+// @Description revoke an api key, requests made with it are unauthorized at once
+// @Success 204
+// @Router /v1/api-keys/{api_key_id} [delete]
+func (c client) RevokeApiKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Revoking")
+
+		apiKeyRevoke, err := c.parserClient.ParseRevokeApiKey(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing revoke api key request"))
+			return
+		}
+
+		if err := c.appClient.RevokeApiKey(ctx, *apiKeyRevoke); err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed revoking api key"))
+			return
+		}
+
+		lib_log.Info(ctx, "Revoked")
+		lib_http.RenderNoContent(ctx, w)
+	}
+}
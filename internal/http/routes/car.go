@@ -1,7 +1,10 @@
 package routes
 
 import (
+	"car-svc/internal/http/routes/parser"
+	"car-svc/internal/lib/constants"
 	"car-svc/internal/lib/schema"
+	"fmt"
 	"net/http"
 
 	lib_errors "github.com/tomwangsvc/lib-svc/errors"
@@ -11,6 +14,7 @@ import (
 
 // @Summary create car
 // @Param Authorization header string true "IAM token"
+// @Param Idempotency-Key header string false "key identifying retries of the same request, the stored response is replayed for retries"
 // @Description create car
 // @Description See schema file car_create.json for body requirements
 // @Success 201
@@ -40,14 +44,23 @@ func (c client) CreateCar() http.HandlerFunc {
 
 // @Summary search cars
 // @Param Authorization header string true "IAM token"
+// @Param Accept header string false "text/csv or application/x-ndjson to export every matching car, see /v1/cars/export"
 // @Description search cars
 // @Description See schema file cars_search.json for query params
+// @Param fields query string false "comma separated fields to return, e.g. car_id,brand_name"
+// @Param as_of query string false "RFC3339 time to read the cars as they were at, must be within the version retention period of the database"
+// @Param include_deleted query bool false "true to include soft deleted cars, for admins"
 // @Description See schema file cars.json for response
 // @Success 200
 // @Router /v1/cars [get]
 func (c client) SearchCars() http.HandlerFunc {
+	exportCars := c.ExportCars()
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
+		if parser.NegotiateExportContentType(r) != "" {
+			exportCars(w, r)
+			return
+		}
 		lib_log.Info(ctx, "Searching")
 
 		carsSearch, err := c.parserClient.ParseSearchCars(r)
@@ -80,9 +93,80 @@ func (c client) SearchCars() http.HandlerFunc {
 	}
 }
 
+// @Summary export cars
+// @Param Authorization header string true "IAM token"
+// @Param Accept header string false "text/csv (default) or application/x-ndjson"
+// @Description export every car matching the search without pagination, as an attachment
+// @Description See schema file cars_search.json for query params
+// @Param fields query string false "comma separated fields to export, e.g. car_id,brand_name"
+// @Param format query string false "csv or ndjson, overrides the Accept header"
+// @Success 200
+// @Router /v1/cars/export [get]
+func (c client) ExportCars() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Exporting")
+
+		carsExport, err := c.parserClient.ParseExportCars(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing export cars request"))
+			return
+		}
+
+		fileName := "cars.csv"
+		if carsExport.ContentType == constants.ContentTypeNdjson {
+			fileName = "cars.ndjson"
+		}
+
+		cw := &carsExportResponseWriter{ResponseWriter: w, contentType: carsExport.ContentType, fileName: fileName}
+		count, err := c.appClient.ExportCars(ctx, *carsExport, cw)
+		if err != nil {
+			if cw.written {
+				lib_log.Error(ctx, "Failed exporting cars after the response was started, closing response", lib_log.FmtError(err))
+				return
+			}
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed exporting cars"))
+			return
+		}
+
+		if !cw.written {
+			lib_http.RenderBytesWithFileNameAsAttachment(ctx, w, nil, carsExport.ContentType, fileName)
+		}
+
+		lib_log.Info(ctx, "Exported", lib_log.FmtInt("count", count))
+	}
+}
+
+// carsExportResponseWriter writes the headers of the attachment with the first chunk of the export, so that an error before any car is written can still be rendered
+type carsExportResponseWriter struct {
+	http.ResponseWriter
+	contentType string
+	fileName    string
+	written     bool
+}
+
+func (w *carsExportResponseWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.Header().Set("Content-Type", w.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", w.fileName))
+		w.WriteHeader(http.StatusOK)
+		w.written = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *carsExportResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 // @Summary read car
 // @Param Authorization header string true "IAM token"
 // @Description read car
+// @Param fields query string false "comma separated fields to return, e.g. car_id,brand_name"
+// @Param as_of query string false "RFC3339 time to read the cars as they were at, must be within the version retention period of the database"
+// @Param include_deleted query bool false "true to include soft deleted cars, for admins"
 // @Description See schema file car_read.json for response
 // @Success 200
 // @Router /v1/cars/{car_id} [get]
@@ -118,6 +202,7 @@ func (c client) ReadCar() http.HandlerFunc {
 
 // @Summary update car
 // @Param Authorization header string true "IAM token"
+// @Param If-Unmodified-Since header string false "RFC3339 date_updated of the car when last read, the update fails with 412 when the car has been modified since"
 // @Description update car
 // @Description See schema file car_update.json for user input
 // @Success 204
@@ -143,6 +228,34 @@ func (c client) UpdateCar() http.HandlerFunc {
 	}
 }
 
+// @Summary patch car
+// @Param Authorization header string true "IAM token"
+// @Param Content-Type header string true "application/merge-patch+json or application/json-patch+json"
+// @Description patch car with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902)
+// @Description See schema file car.json for the patched car
+// @Success 204
+// @Router /v1/cars/{car_id} [patch]
+func (c client) PatchCar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Patching")
+
+		carPatch, err := c.parserClient.ParsePatchCar(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing patch car request"))
+			return
+		}
+
+		if err := c.appClient.PatchCar(ctx, *carPatch); err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed patching car"))
+			return
+		}
+
+		lib_log.Info(ctx, "Patched")
+		lib_http.RenderNoContent(ctx, w)
+	}
+}
+
 // @Summary delete car
 // @Param Authorization header string true "IAM token"
 // @Description delete car
@@ -169,3 +282,60 @@ func (c client) DeleteCar() http.HandlerFunc {
 		lib_http.RenderNoContent(ctx, w)
 	}
 }
+
+// @Summary restore car
+// @Param Authorization header string true "IAM token"
+// @Param Idempotency-Key header string false "key identifying retries of the same request, the stored response is replayed for retries"
+// @Description restore a soft deleted car, restoring a car that is not deleted has no effect
+// @Success 204
+// @Router /v1/cars/{car_id}/restore [post]
+func (c client) RestoreCar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Restoring")
+
+		carRestore, err := c.parserClient.ParseRestoreCar(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing restore car request"))
+			return
+		}
+
+		if err := c.appClient.RestoreCar(ctx, *carRestore); err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed restoring car"))
+			return
+		}
+
+		lib_log.Info(ctx, "Restored")
+		lib_http.RenderNoContent(ctx, w)
+	}
+}
+
+// @Summary batch create update and delete cars
+// @Param Authorization header string true "IAM token"
+// @Param Idempotency-Key header string false "key identifying retries of the same request, the stored response is replayed for retries"
+// @Description batch create update and delete cars, the operations are executed in a single transaction for ALL_OR_NOTHING mode and individually for BEST_EFFORT mode
+// @Description See schema file cars_batch.json for body requirements, the body of each operation is checked against car_create.json or car_update.json
+// @Description The response holds a result per operation with the status the single car route would have returned
+// @Success 200
+// @Router /v1/cars:batch [post]
+func (c client) BatchCars() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Batching")
+
+		carsBatch, err := c.parserClient.ParseBatchCars(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing batch cars request"))
+			return
+		}
+
+		resultsBytes, err := c.appClient.BatchCars(ctx, *carsBatch)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed batching cars"))
+			return
+		}
+
+		lib_log.Info(ctx, "Batched", lib_log.FmtBytes("resultsBytes", resultsBytes))
+		lib_http.RenderJsonBytes(ctx, w, resultsBytes)
+	}
+}
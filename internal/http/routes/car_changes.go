@@ -0,0 +1,125 @@
+package routes
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+const (
+	// carChangesStreamWait is how long a read of the event stream waits for changes before a keep-alive is sent
+	carChangesStreamWait = 15 * time.Second
+)
+
+// @Summary read car changes
+// @Param Authorization header string true "IAM token"
+// @Description read the feed of changes to cars in commit order, a row per change holding the car id and the operation
+// @Description Pass next_since as since to resume after the last change read, without since the feed starts now and returns no changes
+// @Param since query string false "opaque token returned as next_since by a previous read"
+// @Param wait query int false "seconds, at most 30, to wait for changes when there are none"
+// @Param limit query int false "maximum number of changes to return"
+// @Param Accept header string false "text/event-stream to stream changes as server-sent events, the id of each event is the since token and Last-Event-ID resumes the stream"
+// @Success 200
+// @Router /v1/cars/changes [get]
+func (c client) ReadCarChanges() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Reading")
+
+		carChangesRead, err := c.parserClient.ParseReadCarChanges(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing read car changes request"))
+			return
+		}
+
+		if carChangesRead.Stream {
+			c.streamCarChanges(w, r, *carChangesRead)
+			return
+		}
+
+		// A read waiting for changes returns the changes so far when the service drains
+		ctxRead, cancel := c.untilDrain(ctx)
+		defer cancel()
+		carChanges, err := c.appClient.ReadCarChanges(ctxRead, *carChangesRead)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed reading car changes"))
+			return
+		}
+
+		lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carChanges.Changes)", len(carChanges.Changes)))
+		lib_http.RenderResponse(ctx, w, carChanges)
+	}
+}
+
+// streamCarChanges writes the changes as server-sent events until the client disconnects, a keep-alive carrying the since token is sent when no changes are committed for a while.
+// The stream ends when the service drains so that shutdown is not held up, the client resumes from another instance with Last-Event-ID.
+func (c client) streamCarChanges(w http.ResponseWriter, r *http.Request, carChangesRead dto.CarChangesRead) {
+	ctx, cancel := c.untilDrain(r.Context())
+	defer cancel()
+	lib_log.Info(ctx, "Streaming")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		lib_http.RenderError(ctx, w, lib_errors.NewCustom(http.StatusInternalServerError, "Streaming not supported by response writer"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", constants.ContentTypeEventStream)
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	carChangesRead.Wait = carChangesStreamWait
+	for {
+		carChanges, err := c.appClient.ReadCarChanges(ctx, carChangesRead)
+		if ctx.Err() != nil {
+			if c.drain.Draining() {
+				lib_log.Info(ctx, "Streamed, service draining")
+				return
+			}
+			lib_log.Info(ctx, "Streamed, client disconnected")
+			return
+		}
+		if err != nil {
+			lib_log.Error(ctx, "Failed reading car changes, closing stream", lib_log.FmtError(err))
+			return
+		}
+
+		if len(carChanges.Changes) == 0 {
+			fmt.Fprintf(w, ": keep-alive\nid: %s\n\n", carChanges.NextSince)
+		} else {
+			data, err := json.Marshal(carChanges)
+			if err != nil {
+				lib_log.Error(ctx, "Failed marshalling car changes, closing stream", lib_log.FmtError(err))
+				return
+			}
+			fmt.Fprintf(w, "id: %s\nevent: changes\ndata: %s\n\n", carChanges.NextSince, data)
+		}
+		flusher.Flush()
+
+		next := carChanges.Next
+		carChangesRead.Since = &next
+	}
+}
+
+// untilDrain returns a context that is done when the service starts draining, so that reads waiting for changes do not hold up shutdown
+func (c client) untilDrain(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-c.drain.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
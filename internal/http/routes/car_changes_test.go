@@ -0,0 +1,97 @@
+package routes
+
+import (
+	app_mock "car-svc/internal/app/mock"
+	parser_mock "car-svc/internal/http/routes/parser/mock"
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_client_ReadCarChanges(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := chi.NewRouter()
+
+	type expected struct {
+		code int
+	}
+	var data = []struct {
+		desc string
+		client
+		expected
+	}{
+		{
+			desc:   "app error",
+			client: clientErrorApp,
+			expected: expected{
+				code: app_mock.ExpectedErrorClient.Code,
+			},
+		},
+		{
+			desc:   "parser error",
+			client: clientErrorParser,
+			expected: expected{
+				code: parser_mock.ExpectedErrorClient.Code,
+			},
+		},
+		{
+			desc:   "success",
+			client: clientSuccess,
+			expected: expected{
+				code: http.StatusOK,
+			},
+		},
+	}
+
+	for i, d := range data {
+		router.Get("/", d.client.ReadCarChanges())
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if code := rr.Code; code != d.expected.code {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "code",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.code,
+				Result:     code,
+			}))
+		}
+	}
+}
+
+func Test_client_streamCarChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	clientSuccess.streamCarChanges(rr, req, dto.CarChangesRead{Stream: true})
+
+	if code := rr.Code; code != http.StatusOK {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "code",
+			Expected:   http.StatusOK,
+			Result:     code,
+		}))
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != constants.ContentTypeEventStream {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "content type",
+			Expected:   constants.ContentTypeEventStream,
+			Result:     contentType,
+		}))
+	}
+}
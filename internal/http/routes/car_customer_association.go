@@ -1 +1,38 @@
 package routes
+
+import (
+	"net/http"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// @Summary create rental
+// @Param Authorization header string true "IAM token"
+// @Param Idempotency-Key header string false "key identifying retries of the same request, the stored response is replayed for retries"
+// @Description rent the car to a customer, see schema file car_customer_association_create.json for body requirements
+// @Description a customer blocked by customer-svc cannot rent a car, the request is rejected with a 409 and the code CUSTOMER_BLOCKED
+// @Success 201
+// @Router /v1/cars/{car_id}/rentals [post]
+func (c client) CreateCarCustomerAssociation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Creating")
+
+		carCustomerAssociationCreate, err := c.parserClient.ParseCreateCarCustomerAssociation(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing create car customer association request"))
+			return
+		}
+
+		carCustomerAssociationId, err := c.appClient.CreateCarCustomerAssociation(ctx, *carCustomerAssociationCreate)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed creating car customer association"))
+			return
+		}
+
+		lib_log.Info(ctx, "Created", lib_log.FmtString("carCustomerAssociationId", carCustomerAssociationId))
+		lib_http.RenderCreated(ctx, w, carCustomerAssociationId)
+	}
+}
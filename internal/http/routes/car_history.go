@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"net/http"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// @Summary search car history
+// @Param Authorization header string true "IAM token"
+// @Description search the history of a car, a row per change holding the actor, the correlation id, the operation and the car before and after the change
+// @Description The history is deleted with the car when the car is purged
+// @Success 200
+// @Success 204
+// @Router /v1/cars/{car_id}/history [get]
+func (c client) SearchCarHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Searching")
+
+		carHistorySearch, err := c.parserClient.ParseSearchCarHistory(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing search car history request"))
+			return
+		}
+
+		carHistoryBytes, pagination, err := c.appClient.SearchCarHistory(ctx, *carHistorySearch)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed searching car history"))
+			return
+		}
+
+		if len(carHistoryBytes) == 0 {
+			lib_http.RenderNoContent(ctx, w)
+			return
+		}
+
+		lib_log.Info(ctx, "Searched", lib_log.FmtBytes("carHistoryBytes", carHistoryBytes), lib_log.FmtAny("pagination", pagination))
+		lib_http.RenderJsonBytesWithPagination(ctx, w, carHistoryBytes, *pagination)
+	}
+}
+
+// @Summary revert car
+// @Param Authorization header string true "IAM token"
+// @Param If-Unmodified-Since header string true "RFC3339 date_updated of the car when last read, the revert fails with 428 when it is missing and with 412 when the car has been modified since"
+// @Param Idempotency-Key header string false "key identifying retries of the same request, the stored response is replayed for retries"
+// @Description revert a car to the values it had after the change recorded by a history row, identified by car_history_id or the latest change at a date
+// @Description See schema file car_revert.json for body requirements, the revert is recorded in the history of the car
+// @Success 204
+// @Router /v1/cars/{car_id}/revert [post]
+func (c client) RevertCar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Reverting")
+
+		carRevert, err := c.parserClient.ParseRevertCar(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing revert car request"))
+			return
+		}
+
+		if err := c.appClient.RevertCar(ctx, *carRevert); err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed reverting car"))
+			return
+		}
+
+		lib_log.Info(ctx, "Reverted")
+		lib_http.RenderNoContent(ctx, w)
+	}
+}
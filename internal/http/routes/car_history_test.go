@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"bytes"
+	"car-svc/internal/app"
+	"car-svc/internal/http/routes/parser"
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/rbac"
+	"car-svc/internal/lib/spanner"
+	"car-svc/internal/lib/tenant"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	lib_brand "github.com/tomwangsvc/lib-svc/brand"
+	lib_countries "github.com/tomwangsvc/lib-svc/countries"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+	lib_schema_mock "github.com/tomwangsvc/lib-svc/schema/mock"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_client_RevertCar(t *testing.T) {
+	ctx := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	spannerClient := spanner.NewInMemoryClient(ctx, spanner.Config{})
+	carId, err := spannerClient.CreateCar(ctx, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "brand_name", ModelName: "model_name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	car, err := spannerClient.ReadCar(ctx, dto.CarRead{Id: carId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	carHistory, _, err := spannerClient.SearchCarHistory(ctx, dto.CarHistorySearch{CarId: carId, Pagination: lib_pagination.Pagination{Limit: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(carHistory) != 1 {
+		t.Fatalf("Expected the history of the created car, got %v", carHistory)
+	}
+
+	// The revert is parsed and applied by the service rather than by mocks, so that the precondition is checked against the stored car
+	c := clientSuccess
+	c.appClient = app.NewClient(app.Config{}, nil, nil, spannerClient, nil)
+	c.parserClient = parser.NewClient(parser.Config{}, nil, lib_schema_mock.ClientSuccess, lib_countries.Metadata{})
+	router := chi.NewRouter()
+	router.Post("/cars/{id}/revert", c.RevertCar())
+
+	var data = []struct {
+		desc              string
+		ifUnmodifiedSince string
+		expected          int
+	}{
+		{
+			desc:     "if unmodified since missing",
+			expected: http.StatusPreconditionRequired,
+		},
+		{
+			desc:              "car modified since",
+			ifUnmodifiedSince: car.DateCreated.Add(-time.Second).Format(time.RFC3339Nano),
+			expected:          http.StatusPreconditionFailed,
+		},
+		{
+			desc:              "car not modified since",
+			ifUnmodifiedSince: car.DateCreated.Format(time.RFC3339Nano),
+			expected:          http.StatusNoContent,
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/cars/%s/revert", carId), bytes.NewBufferString(fmt.Sprintf(`{"car_history_id":%q}`, carHistory[0].CarHistoryId)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.ifUnmodifiedSince != "" {
+			req.Header.Set("If-Unmodified-Since", d.ifUnmodifiedSince)
+		}
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "code",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     rr.Code,
+			}))
+		}
+	}
+}
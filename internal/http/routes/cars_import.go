@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"car-svc/internal/lib/constants"
+	"fmt"
+	"net/http"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// @Summary import cars
+// @Param Authorization header string true "IAM token"
+// @Param Content-Type header string true "text/csv with a header row naming the car fields, or application/x-ndjson with a car per line"
+// @Param Idempotency-Key header string false "key identifying retries of the same request, the stored response is replayed for retries"
+// @Description import cars from a fleet file, each row is checked against car_create.json and the brand and model names are title cased
+// @Description Rows duplicating another row of the file or an existing car are reported and not created
+// @Description The response holds the result of each row, the errors of the failed rows can be downloaded from the report
+// @Success 201
+// @Header 201 {string} Location "id"
+// @Router /v1/cars:import [post]
+func (c client) ImportCars() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Importing")
+
+		carsImport, err := c.parserClient.ParseImportCars(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing import cars request"))
+			return
+		}
+
+		carsImportReport, err := c.appClient.ImportCars(ctx, *carsImport)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed importing cars"))
+			return
+		}
+
+		lib_log.Info(ctx, "Imported", lib_log.FmtString("carsImportReport.CarsImportId", carsImportReport.CarsImportId))
+		lib_http.RenderCreatedWithBody(ctx, w, carsImportReport.CarsImportId, carsImportReport)
+	}
+}
+
+// @Summary read cars import report
+// @Param Authorization header string true "IAM token"
+// @Description download the errors of the failed rows of a cars import as csv, a line per error
+// @Success 200
+// @Router /v1/cars-imports/{id}/report [get]
+func (c client) ReadCarsImportReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Reading")
+
+		carsImportReportRead, err := c.parserClient.ParseReadCarsImportReport(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing read cars import report request"))
+			return
+		}
+
+		carsImportReportCsv, err := c.appClient.ReadCarsImportReport(ctx, *carsImportReportRead)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed reading cars import report"))
+			return
+		}
+
+		lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carsImportReportCsv)", len(carsImportReportCsv)))
+		lib_http.RenderBytesWithFileNameAsAttachment(ctx, w, carsImportReportCsv, constants.ContentTypeCsv, fmt.Sprintf("cars_import_%s_report.csv", carsImportReportRead.Id))
+	}
+}
@@ -3,32 +3,60 @@ package routes
 import (
 	"car-svc/internal/app"
 	"car-svc/internal/http/routes/parser"
+	"car-svc/internal/lib/drain"
+	"car-svc/internal/lib/health"
 	"net/http"
 
 	lib_countries "github.com/tomwangsvc/lib-svc/countries"
 	lib_env "github.com/tomwangsvc/lib-svc/env"
+	lib_pubsub "github.com/tomwangsvc/lib-svc/pubsub"
 	lib_schema "github.com/tomwangsvc/lib-svc/schema"
 )
 
 type Client interface {
 	Health() http.HandlerFunc
+	Liveness() http.HandlerFunc
+	Readiness() http.HandlerFunc
 	CreateCar() http.HandlerFunc
 	SearchCars() http.HandlerFunc
+	ExportCars() http.HandlerFunc
 	ReadCar() http.HandlerFunc
 	UpdateCar() http.HandlerFunc
+	PatchCar() http.HandlerFunc
 	DeleteCar() http.HandlerFunc
+	RestoreCar() http.HandlerFunc
+	BatchCars() http.HandlerFunc
+	ImportCars() http.HandlerFunc
+	ReadCarsImportReport() http.HandlerFunc
+	SearchCarHistory() http.HandlerFunc
+	RevertCar() http.HandlerFunc
+	ReadCarChanges() http.HandlerFunc
+	CreateCarCustomerAssociation() http.HandlerFunc
+	ReadCustomer() http.HandlerFunc
+	ConsumeCustomerEvent() http.HandlerFunc
+	CreateWebhookSubscription() http.HandlerFunc
+	SearchWebhookSubscriptions() http.HandlerFunc
+	DeleteWebhookSubscription() http.HandlerFunc
+	SearchWebhookDeliveries() http.HandlerFunc
+	RedeliverWebhookDelivery() http.HandlerFunc
+	CreateApiKey() http.HandlerFunc
+	SearchApiKeys() http.HandlerFunc
+	RotateApiKey() http.HandlerFunc
+	RevokeApiKey() http.HandlerFunc
 }
 
 type Config struct {
 	Env lib_env.Env
 }
 
-func NewClient(config Config, appClient app.Client, schemaClient lib_schema.Client, countriesMetadata lib_countries.Metadata) Client {
+func NewClient(config Config, appClient app.Client, pubsubClient lib_pubsub.Client, schemaClient lib_schema.Client, countriesMetadata lib_countries.Metadata, drain *drain.Drain, healthClient health.Client) Client {
 	return client{
 		config:            config,
 		appClient:         appClient,
 		countriesMetadata: countriesMetadata,
-		parserClient:      parser.NewClient(parser.Config{Env: config.Env}, schemaClient, countriesMetadata),
+		drain:             drain,
+		healthClient:      healthClient,
+		parserClient:      parser.NewClient(parser.Config{Env: config.Env}, pubsubClient, schemaClient, countriesMetadata),
 		schemaClient:      schemaClient,
 	}
 }
@@ -37,6 +65,8 @@ type client struct {
 	config            Config
 	appClient         app.Client
 	countriesMetadata lib_countries.Metadata
+	drain             *drain.Drain
+	healthClient      health.Client
 	parserClient      parser.Client
 	schemaClient      lib_schema.Client
 }
@@ -1 +1,68 @@
 package routes
+
+import (
+	"net/http"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// @Summary read customer
+// @Param Authorization header string true "IAM token"
+// @Description read customer, age, ethnicity and gender are redacted unless the caller is permitted to read sensitive customer fields
+// @Success 200
+// @Router /v1/customers/{customer_id} [get]
+func (c client) ReadCustomer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Reading")
+
+		customerRead, err := c.parserClient.ParseReadCustomer(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing read customer request"))
+			return
+		}
+
+		customer, err := c.appClient.ReadCustomer(ctx, *customerRead)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed reading customer"))
+			return
+		}
+
+		lib_log.Info(ctx, "Read", lib_log.FmtInt("len(customer)", len(customer)))
+		lib_http.RenderJsonBytes(ctx, w, customer)
+	}
+}
+
+// @Summary consume customer event
+// @Param Authorization header string true "GCP token of the pubsub push subscription"
+// @Description apply a customer lifecycle event pushed by pubsub, future rentals of a deleted or blocked customer are cancelled and new rentals are blocked, redelivered messages have no effect
+// @Success 204
+// @Router /v1/pubsub/customer-events [post]
+func (c client) ConsumeCustomerEvent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Consuming")
+
+		ctx, customerEvent, err := c.parserClient.ParseConsumeCustomerEvent(r)
+		if err != nil {
+			if lib_errors.IsCustomWithCode(err, http.StatusBadRequest) {
+				// Retrying a malformed message cannot succeed, it is logged and then ACKed in the same way as lib_pubsub does for unauthorized messages
+				lib_log.Warn(ctx, "Malformed customer event, will respond with No Content so that message is ACKed", lib_log.FmtError(err))
+				lib_http.RenderNoContent(ctx, w)
+				return
+			}
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing consume customer event request"))
+			return
+		}
+
+		if err := c.appClient.ConsumeCustomerEvent(ctx, *customerEvent); err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed consuming customer event"))
+			return
+		}
+
+		lib_log.Info(ctx, "Consumed")
+		lib_http.RenderNoContent(ctx, w)
+	}
+}
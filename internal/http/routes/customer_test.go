@@ -0,0 +1,122 @@
+package routes
+
+import (
+	app_mock "car-svc/internal/app/mock"
+	parser_mock "car-svc/internal/http/routes/parser/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_client_ReadCustomer(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := chi.NewRouter()
+
+	type expected struct {
+		code int
+	}
+	var data = []struct {
+		desc string
+		client
+		expected
+	}{
+		{
+			desc:   "app error",
+			client: clientErrorApp,
+			expected: expected{
+				code: app_mock.ExpectedErrorClient.Code,
+			},
+		},
+		{
+			desc:   "parser error",
+			client: clientErrorParser,
+			expected: expected{
+				code: parser_mock.ExpectedErrorClient.Code,
+			},
+		},
+		{
+			desc:   "success",
+			client: clientSuccess,
+			expected: expected{
+				code: http.StatusOK,
+			},
+		},
+	}
+
+	for i, d := range data {
+		router.Get("/", d.client.ReadCustomer())
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if code := rr.Code; code != d.expected.code {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "code",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.code,
+				Result:     code,
+			}))
+		}
+	}
+}
+
+func Test_client_ConsumeCustomerEvent(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := chi.NewRouter()
+
+	type expected struct {
+		code int
+	}
+	var data = []struct {
+		desc string
+		client
+		expected
+	}{
+		{
+			desc:   "app error",
+			client: clientErrorApp,
+			expected: expected{
+				code: app_mock.ExpectedErrorClient.Code,
+			},
+		},
+		{
+			desc:   "parser error",
+			client: clientErrorParser,
+			expected: expected{
+				code: parser_mock.ExpectedErrorClient.Code,
+			},
+		},
+		{
+			desc:   "success",
+			client: clientSuccess,
+			expected: expected{
+				code: http.StatusNoContent,
+			},
+		},
+	}
+
+	for i, d := range data {
+		router.Post("/", d.client.ConsumeCustomerEvent())
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if code := rr.Code; code != d.expected.code {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "code",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.code,
+				Result:     code,
+			}))
+		}
+	}
+}
@@ -1,28 +1,98 @@
 package routes
 
 import (
+	"car-svc/internal/lib/build"
+	"car-svc/internal/lib/constants"
 	"net/http"
 
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
 	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+const (
+	HealthStatusDraining = "DRAINING"
+	HealthStatusFailed   = "FAILED"
+	HealthStatusOk       = "OK"
 )
 
 // @Summary health check
-// @Param type query string true "health=true"
+// @Param type query string false "health=true"
 // @Produce json
 // @Success 200
 // @Router /car-svc [get]
 func (c client) Health() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Query().Get("health") == "true" {
-			lib_http.RenderResponse(r.Context(), w, Health{
-				BuildDate:   "@foo_BUILD_DATE@",
-				BuildNumber: "@foo_BUILD_NUMBER@",
-				CommitId:    "@foo_COMMIT_ID@",
-				Env:         c.config.Env.Id,
-				Status:      "OK",
-				Svc:         c.config.Env.SvcId,
+		// Health fails from the start of the drain so that no new requests are routed to the instance while in-flight requests finish
+		if c.drain.Draining() {
+			lib_http.RenderError(r.Context(), w, lib_errors.NewCustom(http.StatusServiceUnavailable, constants.ServiceUnavailableDraining))
+			return
+		}
+		lib_http.RenderResponse(r.Context(), w, c.newHealth())
+	}
+}
+
+// @Summary liveness check, it does not check dependencies so that an instance is not restarted when a dependency fails
+// @Produce json
+// @Success 200
+// @Router /car-svc/health/live [get]
+func (c client) Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lib_http.RenderResponse(r.Context(), w, c.newHealth())
+	}
+}
+
+// @Summary readiness check, the status and latency of each dependency are returned and it fails when any dependency fails or the service is draining
+// @Produce json
+// @Success 200
+// @Router /car-svc/health/ready [get]
+func (c client) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if c.drain.Draining() {
+			lib_http.RenderCustomErrorWithBody(ctx, w, lib_errors.NewCustom(http.StatusServiceUnavailable, constants.ServiceUnavailableDraining), Readiness{
+				Dependencies: []ReadinessDependency{},
+				Status:       HealthStatusDraining,
 			})
+			return
+		}
+
+		readiness := Readiness{
+			Dependencies: []ReadinessDependency{},
+			Status:       HealthStatusOk,
+		}
+		for _, v := range c.healthClient.Check(ctx) {
+			dependency := ReadinessDependency{
+				LatencyMs: float64(v.Latency.Microseconds()) / 1000,
+				Name:      v.Dependency,
+				Status:    HealthStatusOk,
+			}
+			if v.Err != nil {
+				// The error is logged rather than returned as readiness is not authorized
+				lib_log.Error(ctx, "Failed checking dependency", lib_log.FmtString("v.Dependency", v.Dependency), lib_log.FmtError(v.Err))
+				dependency.Status = HealthStatusFailed
+				readiness.Status = HealthStatusFailed
+			}
+			readiness.Dependencies = append(readiness.Dependencies, dependency)
+		}
+
+		if readiness.Status != HealthStatusOk {
+			lib_http.RenderCustomErrorWithBody(ctx, w, lib_errors.NewCustom(http.StatusServiceUnavailable, constants.ServiceUnavailableDependencyFailed), readiness)
+			return
 		}
+		lib_http.RenderResponse(ctx, w, readiness)
+	}
+}
+
+func (c client) newHealth() Health {
+	return Health{
+		BuildDate:   build.Date,
+		BuildNumber: build.Number,
+		CommitId:    build.CommitId,
+		Env:         c.config.Env.Id,
+		Status:      HealthStatusOk,
+		Svc:         c.config.Env.SvcId,
 	}
 }
 
@@ -34,3 +104,14 @@ type Health struct {
 	Status      string `json:"status"`
 	Svc         string `json:"svc"`
 }
+
+type Readiness struct {
+	Dependencies []ReadinessDependency `json:"dependencies"`
+	Status       string                `json:"status"`
+}
+
+type ReadinessDependency struct {
+	LatencyMs float64 `json:"latency_ms"`
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+}
@@ -1,10 +1,18 @@
 package routes
 
 import (
+	"car-svc/internal/lib/build"
+	"car-svc/internal/lib/drain"
+	"car-svc/internal/lib/health"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 
 	lib_env "github.com/tomwangsvc/lib-svc/env"
 	lib_testing "github.com/tomwangsvc/lib-svc/testing"
@@ -16,7 +24,7 @@ func Test_client_Health(t *testing.T) {
 		t.Fatal(err)
 	}
 	rr := httptest.NewRecorder()
-	http.HandlerFunc(client{config: Config{Env: lib_env.Env{Id: "dev"}}}.Health()).ServeHTTP(rr, req)
+	http.HandlerFunc(client{config: Config{Env: lib_env.Env{Id: "dev"}}, drain: drain.New()}.Health()).ServeHTTP(rr, req)
 
 	expectedStatus := http.StatusOK
 	if status := rr.Code; status != expectedStatus {
@@ -27,7 +35,7 @@ func Test_client_Health(t *testing.T) {
 		}))
 	}
 
-	expectedBody := fmt.Sprintf("{\"build_date\":\"%s\",\"build_number\":\"%s\",\"commit_id\":\"%s\",\"env\":\"dev\",\"status\":\"OK\",\"svc\":\"\"}\n", "@foo_BUILD_DATE@", "@foo_BUILD_NUMBER@", "@foo_COMMIT_ID@")
+	expectedBody := fmt.Sprintf("{\"build_date\":\"%s\",\"build_number\":\"%s\",\"commit_id\":\"%s\",\"env\":\"dev\",\"status\":\"OK\",\"svc\":\"\"}\n", build.Date, build.Number, build.CommitId)
 	if body := rr.Body.String(); body != expectedBody {
 		t.Error(lib_testing.Errorf(lib_testing.Error{
 			Unexpected: "body",
@@ -36,3 +44,125 @@ func Test_client_Health(t *testing.T) {
 		}))
 	}
 }
+
+func Test_client_Health_draining(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/?health=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := drain.New()
+	d.Start()
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(client{config: Config{Env: lib_env.Env{Id: "dev"}}, drain: d}.Health()).ServeHTTP(rr, req)
+
+	expectedStatus := http.StatusServiceUnavailable
+	if status := rr.Code; status != expectedStatus {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "status",
+			Expected:   expectedStatus,
+			Result:     status,
+		}))
+	}
+}
+
+func Test_client_Readiness(t *testing.T) {
+	drainStarted := drain.New()
+	drainStarted.Start()
+
+	type input struct {
+		drain   *drain.Drain
+		results healthClientResults
+	}
+	type expected struct {
+		code      int
+		readiness Readiness
+	}
+	var data = []struct {
+		desc string
+		input
+		expected
+	}{
+		{
+			desc: "dependencies ok",
+			input: input{
+				drain:   drain.New(),
+				results: healthClientResults{{Dependency: "spanner", Latency: 1500 * time.Microsecond}, {Dependency: "storage"}},
+			},
+			expected: expected{
+				code: http.StatusOK,
+				readiness: Readiness{
+					Dependencies: []ReadinessDependency{{LatencyMs: 1.5, Name: "spanner", Status: HealthStatusOk}, {Name: "storage", Status: HealthStatusOk}},
+					Status:       HealthStatusOk,
+				},
+			},
+		},
+		{
+			desc: "dependency failed",
+			input: input{
+				drain:   drain.New(),
+				results: healthClientResults{{Dependency: "spanner", Err: errors.New("unavailable")}, {Dependency: "storage"}},
+			},
+			expected: expected{
+				code: http.StatusServiceUnavailable,
+				readiness: Readiness{
+					Dependencies: []ReadinessDependency{{Name: "spanner", Status: HealthStatusFailed}, {Name: "storage", Status: HealthStatusOk}},
+					Status:       HealthStatusFailed,
+				},
+			},
+		},
+		{
+			desc: "draining",
+			input: input{
+				drain:   drainStarted,
+				results: healthClientResults{{Dependency: "spanner"}},
+			},
+			expected: expected{
+				code: http.StatusServiceUnavailable,
+				readiness: Readiness{
+					Dependencies: []ReadinessDependency{},
+					Status:       HealthStatusDraining,
+				},
+			},
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodGet, "/car-svc/health/ready", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(client{config: Config{Env: lib_env.Env{Id: "dev"}}, drain: d.input.drain, healthClient: d.input.results}.Readiness()).ServeHTTP(rr, req)
+
+		if code := rr.Code; code != d.expected.code {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "code",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.code,
+				Result:     code,
+			}))
+			continue
+		}
+
+		var readiness Readiness
+		if err := json.Unmarshal(rr.Body.Bytes(), &readiness); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(readiness, d.expected.readiness) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "readiness",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.readiness,
+				Result:     readiness,
+			}))
+		}
+	}
+}
+
+type healthClientResults []health.Result
+
+func (c healthClientResults) Check(_ context.Context) []health.Result {
+	return c
+}
@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/schema"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+const (
+	// apiKeyRotationOverlapDefault gives a partner a day to switch to the new key when the overlap is not given
+	apiKeyRotationOverlapDefault = 24 * time.Hour
+)
+
+func (c client) ParseCreateApiKey(r *http.Request) (*dto.ApiKeyCreate, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	body, err := lib_http.ReadRequestBody(r, true)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding body for request")
+	}
+	if err := c.schemaClient.CheckBodyAgainstSchema(ctx, schema.ApiKeyCreate, body); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking body against schema")
+	}
+
+	apiKeyCreate := dto.ApiKeyCreate{
+		Test: lib_context.Test(ctx),
+	}
+	if err := json.Unmarshal(body, &apiKeyCreate.UserInput); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed unmarshalling body into dto.ApiKeyCreate")
+	}
+	if err := checkDateExpires(apiKeyCreate.UserInput.DateExpires); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking date expires")
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("apiKeyCreate", apiKeyCreate))
+	return &apiKeyCreate, nil
+}
+
+func (c client) ParseSearchApiKeys(r *http.Request) (*dto.ApiKeysSearch, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	pagination, err := lib_pagination.NewPagination(r, nil)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating pagination")
+	}
+
+	apiKeysSearch := dto.ApiKeysSearch{
+		Pagination: *pagination,
+		Test:       lib_context.Test(ctx),
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("apiKeysSearch", apiKeysSearch))
+	return &apiKeysSearch, nil
+}
+
+func (c client) ParseRotateApiKey(r *http.Request) (*dto.ApiKeyRotate, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+
+	body, err := lib_http.ReadRequestBody(r, true)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding body for request")
+	}
+	if err := c.schemaClient.CheckBodyAgainstSchema(ctx, schema.ApiKeyRotate, body); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking body against schema")
+	}
+
+	apiKeyRotate := dto.ApiKeyRotate{
+		Id:      id,
+		Overlap: apiKeyRotationOverlapDefault,
+		Test:    lib_context.Test(ctx),
+	}
+	if err := json.Unmarshal(body, &apiKeyRotate.UserInput); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed unmarshalling body into dto.ApiKeyRotate")
+	}
+	if err := checkDateExpires(apiKeyRotate.UserInput.DateExpires); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking date expires")
+	}
+	if apiKeyRotate.UserInput.OverlapSeconds != nil {
+		apiKeyRotate.Overlap = time.Duration(*apiKeyRotate.UserInput.OverlapSeconds) * time.Second
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("apiKeyRotate", apiKeyRotate))
+	return &apiKeyRotate, nil
+}
+
+// checkDateExpires checks a new key does not expire before it can be used
+func checkDateExpires(dateExpires time.Time) error {
+	if !dateExpires.After(time.Now()) {
+		return lib_errors.NewCustomf(http.StatusBadRequest, "Invalid date_expires %q, must be in the future", dateExpires.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (c client) ParseRevokeApiKey(r *http.Request) (*dto.ApiKeyRevoke, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+
+	apiKeyRevoke := dto.ApiKeyRevoke{
+		Id:   id,
+		Test: lib_context.Test(ctx),
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("apiKeyRevoke", apiKeyRevoke))
+	return &apiKeyRevoke, nil
+}
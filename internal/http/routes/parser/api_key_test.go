@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_ParseRotateApiKey(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	var data = []struct {
+		desc          string
+		input         string
+		expected      time.Duration
+		expectedError bool
+	}{
+		{
+			desc:     "overlap not given",
+			input:    fmt.Sprintf(`{"date_expires":%q}`, future),
+			expected: apiKeyRotationOverlapDefault,
+		},
+		{
+			desc:     "overlap given",
+			input:    fmt.Sprintf(`{"date_expires":%q,"overlap_seconds":0}`, future),
+			expected: 0,
+		},
+		{
+			desc:          "date expires in the past",
+			input:         fmt.Sprintf(`{"date_expires":%q}`, past),
+			expectedError: true,
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodPost, "/api-keys/api-key-id/rotate", bytes.NewBufferString(d.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "api-key-id")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		result, err := clientSuccess.ParseRotateApiKey(req)
+		if d.expectedError {
+			if cerr, ok := err.(lib_errors.Custom); !ok || cerr.Code != http.StatusBadRequest {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   http.StatusBadRequest,
+					Result:     err,
+				}))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Overlap != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "overlap",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result.Overlap,
+			}))
+		}
+	}
+}
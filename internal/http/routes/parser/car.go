@@ -1,10 +1,16 @@
 package parser
 
 import (
+	"car-svc/internal/lib/constants"
 	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/patch"
+	"car-svc/internal/lib/rbac"
 	"car-svc/internal/lib/schema"
 	"encoding/json"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	lib_context "github.com/tomwangsvc/lib-svc/context"
@@ -13,6 +19,7 @@ import (
 	lib_log "github.com/tomwangsvc/lib-svc/log"
 	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
 	lib_search "github.com/tomwangsvc/lib-svc/search"
+	lib_time "github.com/tomwangsvc/lib-svc/time"
 )
 
 func (c client) ParseCreateCar(r *http.Request) (*dto.CarCreate, error) {
@@ -27,8 +34,14 @@ func (c client) ParseCreateCar(r *http.Request) (*dto.CarCreate, error) {
 		return nil, lib_errors.Wrap(err, "Failed checking body against schema")
 	}
 
+	idempotencyKey, err := ParseIdempotencyKey(r, body)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing idempotency key")
+	}
+
 	carCreate := dto.CarCreate{
-		Test: lib_context.Test(ctx),
+		IdempotencyKey: idempotencyKey,
+		Test:           lib_context.Test(ctx),
 	}
 	if err := json.Unmarshal(body, &carCreate.UserInput); err != nil {
 		return nil, lib_errors.Wrap(err, "Failed unmarshalling body into dto.CarCreate")
@@ -41,6 +54,92 @@ func (c client) ParseCreateCar(r *http.Request) (*dto.CarCreate, error) {
 func (c client) ParseSearchCars(r *http.Request) (*dto.CarsSearch, error) {
 	ctx := r.Context()
 	lib_log.Info(ctx, "Parsing")
+
+	filters, err := c.parseCarsSearchFilters(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing cars search filters")
+	}
+
+	pagination, err := lib_pagination.NewPagination(r, nil)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating pagination")
+	}
+
+	asOf, err := parseAsOf(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing as of")
+	}
+
+	fields, err := parseFields(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing fields")
+	}
+
+	carsSearch := dto.CarsSearch{
+		AsOf:       asOf,
+		Fields:     fields,
+		Filters:    *filters,
+		Pagination: *pagination,
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carsSearch", carsSearch))
+	return &carsSearch, nil
+}
+
+func (c client) ParseExportCars(r *http.Request) (*dto.CarsExport, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	filters, err := c.parseCarsSearchFilters(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing cars search filters")
+	}
+
+	contentType := NegotiateExportContentType(r)
+	if contentType == "" {
+		contentType = constants.ContentTypeCsv
+	}
+
+	fields, err := parseFields(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing fields")
+	}
+
+	carsExport := dto.CarsExport{
+		ContentType: contentType,
+		Fields:      fields,
+		Filters:     *filters,
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carsExport", carsExport))
+	return &carsExport, nil
+}
+
+// NegotiateExportContentType returns the export content type requested by the format query param or the Accept header, an empty string is returned when an export is not requested
+func NegotiateExportContentType(r *http.Request) string {
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		return constants.ContentTypeCsv
+	case "ndjson":
+		return constants.ContentTypeNdjson
+	}
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case constants.ContentTypeCsv, constants.ContentTypeNdjson:
+			return mediaType
+		}
+	}
+	return ""
+}
+
+// parseCarsSearchFilters parses the query into linked filters checked against the cars search schema, the filters are shared by search and export
+func (c client) parseCarsSearchFilters(r *http.Request) (*dto.CarsSearchFilters, error) {
+	ctx := r.Context()
+
 	queryEncodedQuery, err := lib_search.QueryEncodedQueryFromRawQuery(r.URL.RawQuery)
 	if err != nil {
 		return nil, lib_errors.Wrap(err, "Failed getting query encoded query from raw query")
@@ -58,21 +157,77 @@ func (c client) ParseSearchCars(r *http.Request) (*dto.CarsSearch, error) {
 		return nil, lib_errors.Wrap(err, "Failed checking content against schema")
 	}
 
-	pagination, err := lib_pagination.NewPagination(r, nil)
+	includeDeleted, err := parseIncludeDeleted(r)
 	if err != nil {
-		return nil, lib_errors.Wrap(err, "Failed creating pagination")
+		return nil, lib_errors.Wrap(err, "Failed parsing include deleted")
 	}
 
-	carsSearch := dto.CarsSearch{
-		Filters: dto.CarsSearchFilters{
-			Test:          lib_context.Test(ctx),
-			LinkedFilters: linkedFilters,
-		},
-		Pagination: *pagination,
+	return &dto.CarsSearchFilters{
+		IncludeDeleted: includeDeleted,
+		Test:           test,
+		LinkedFilters:  linkedFilters,
+	}, nil
+}
+
+// parseIfUnmodifiedSince parses the If-Unmodified-Since header holding the date_updated of the car when the caller last read it, the change fails when the car has been modified since
+func parseIfUnmodifiedSince(r *http.Request) (*time.Time, error) {
+	ifUnmodifiedSinceHeader := r.Header.Get("If-Unmodified-Since")
+	if ifUnmodifiedSinceHeader == "" {
+		return nil, nil
+	}
+	ifUnmodifiedSince, err := lib_time.ParseFormattedTimeWithFullPrecision(ifUnmodifiedSinceHeader)
+	if err != nil {
+		return nil, lib_errors.NewCustomWithCause(http.StatusBadRequest, "Failed to parse value in If-Unmodified-Since header", err)
 	}
+	return ifUnmodifiedSince, nil
+}
 
-	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carsSearch", carsSearch))
-	return &carsSearch, nil
+// parseAsOf parses the RFC3339 as_of query param requesting a read of the cars as they were at that time
+func parseAsOf(r *http.Request) (*time.Time, error) {
+	asOf := r.URL.Query().Get("as_of")
+	if asOf == "" {
+		return nil, nil
+	}
+	t, err := lib_time.ParseFormattedTimeWithFullPrecision(asOf)
+	if err != nil {
+		return nil, lib_errors.NewCustomWithCauseAndMetadata(http.StatusBadRequest, constants.BadRequestMalformedAsOf, err, map[string]interface{}{
+			"as_of": constants.BadRequestMalformedAsOf,
+		})
+	}
+	return t, nil
+}
+
+// parseIncludeDeleted reports whether soft deleted cars are requested, the option requires the read deleted permission
+func parseIncludeDeleted(r *http.Request) (bool, error) {
+	if r.URL.Query().Get("include_deleted") != "true" {
+		return false, nil
+	}
+	if !rbac.Permitted(r.Context(), rbac.PermissionCarReadDeleted) {
+		return false, lib_errors.NewCustomWithMetadata(http.StatusForbidden, constants.ForbiddenPermissionDenied, map[string]interface{}{
+			"permission": rbac.PermissionCarReadDeleted,
+		})
+	}
+	return true, nil
+}
+
+// parseFields splits the comma separated fields query param, a field named twice is kept once so that its column is not selected twice
+func parseFields(r *http.Request) ([]string, error) {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, v := range strings.Split(r.URL.Query().Get("fields"), ",") {
+		field := strings.TrimSpace(v)
+		if field == "" || seen[field] {
+			continue
+		}
+		if !dto.IsCarField(field) {
+			return nil, lib_errors.NewCustomWithMetadata(http.StatusBadRequest, constants.BadRequestFieldNotRecognized, map[string]interface{}{
+				"fields": constants.BadRequestFieldNotRecognized,
+			})
+		}
+		seen[field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
 }
 
 func (c client) ParseReadCar(r *http.Request) (*dto.CarRead, error) {
@@ -84,8 +239,26 @@ func (c client) ParseReadCar(r *http.Request) (*dto.CarRead, error) {
 		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
 	}
 
+	asOf, err := parseAsOf(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing as of")
+	}
+
+	includeDeleted, err := parseIncludeDeleted(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing include deleted")
+	}
+
+	fields, err := parseFields(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing fields")
+	}
+
 	carRead := dto.CarRead{
-		Id: id,
+		AsOf:           asOf,
+		Fields:         fields,
+		Id:             id,
+		IncludeDeleted: includeDeleted,
 	}
 
 	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carRead", carRead))
@@ -101,9 +274,15 @@ func (c client) ParseUpdateCar(r *http.Request) (*dto.CarUpdate, error) {
 		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
 	}
 
+	ifUnmodifiedSince, err := parseIfUnmodifiedSince(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing if unmodified since")
+	}
+
 	carUpdate := dto.CarUpdate{
-		Id:   id,
-		Test: lib_context.Test(ctx),
+		Id:                id,
+		IfUnmodifiedSince: ifUnmodifiedSince,
+		Test:              lib_context.Test(ctx),
 	}
 
 	body, err := lib_http.ReadRequestBody(r, true)
@@ -117,22 +296,43 @@ func (c client) ParseUpdateCar(r *http.Request) (*dto.CarUpdate, error) {
 		return nil, lib_errors.Wrap(err, "Failed unmarshalling body into dto.CarUpdate")
 	}
 
-	// TODO: handle concurrency from mutiple users
-	// ifUnmodifiedSinceHeader := r.Header.Get("If-Unmodified-Since")
-	// if ifUnmodifiedSinceHeader != "" {
-	// 	var err error
-	// 	ifUnmodifiedSince, err := lib_time.ParseFormattedTimeWithFullPrecision(ifUnmodifiedSinceHeader)
-	// 	if err != nil {
-	// 		return nil, lib_errors.Wrap(err, "Failed to parse value in If-Unmodified-Since header")
-	// 	}
-
-	// 	carUpdate.IfUnmodifiedSince = ifUnmodifiedSince
-	// }
-
 	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carUpdate", carUpdate))
 	return &carUpdate, nil
 }
 
+func (c client) ParsePatchCar(r *http.Request) (*dto.CarPatch, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, lib_errors.NewCustomWithCause(http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType), err)
+	}
+
+	body, err := lib_http.ReadRequestBody(r, true)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding body for request")
+	}
+	if err := patch.Check(contentType, body); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking patch")
+	}
+
+	carPatch := dto.CarPatch{
+		ContentType: contentType,
+		Id:          id,
+		Patch:       body,
+		Test:        lib_context.Test(ctx),
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carPatch", carPatch))
+	return &carPatch, nil
+}
+
 func (c client) ParseDeleteCar(r *http.Request) (*dto.CarDelete, error) {
 	ctx := r.Context()
 	lib_log.Info(ctx, "Parsing")
@@ -150,3 +350,113 @@ func (c client) ParseDeleteCar(r *http.Request) (*dto.CarDelete, error) {
 	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carDelete", carDelete))
 	return &carDelete, nil
 }
+
+func (c client) ParseRestoreCar(r *http.Request) (*dto.CarRestore, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+
+	carRestore := dto.CarRestore{
+		Id:   id,
+		Test: lib_context.Test(ctx),
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carRestore", carRestore))
+	return &carRestore, nil
+}
+
+func (c client) ParseBatchCars(r *http.Request) (*dto.CarsBatch, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	body, err := lib_http.ReadRequestBody(r, true)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding body for request")
+	}
+	if err := c.schemaClient.CheckBodyAgainstSchema(ctx, schema.CarsBatch, body); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking body against schema")
+	}
+
+	idempotencyKey, err := ParseIdempotencyKey(r, body)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing idempotency key")
+	}
+
+	var userInput struct {
+		Mode       string `json:"mode"`
+		Operations []struct {
+			Body   json.RawMessage `json:"body"`
+			CarId  string          `json:"car_id"`
+			Method string          `json:"method"`
+		} `json:"operations"`
+	}
+	if err := json.Unmarshal(body, &userInput); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed unmarshalling body into dto.CarsBatch")
+	}
+
+	test := lib_context.Test(ctx)
+	carsBatch := dto.CarsBatch{
+		IdempotencyKey: idempotencyKey,
+		Mode:           userInput.Mode,
+		Operations:     make([]dto.CarsBatchOperation, len(userInput.Operations)),
+		Test:           test,
+	}
+	for i, v := range userInput.Operations {
+		operation, err := c.parseCarsBatchOperation(r, v.Method, v.CarId, v.Body, test)
+		if err != nil {
+			if carsBatch.Mode == dto.CarsBatchModeAllOrNothing {
+				return nil, lib_errors.Wrapf(err, "Failed parsing operation %d", i)
+			}
+			lib_log.Info(ctx, "Failed parsing operation, will return per item result", lib_log.FmtInt("i", i), lib_log.FmtError(err))
+			operation = &dto.CarsBatchOperation{Error: err}
+		}
+		carsBatch.Operations[i] = *operation
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carsBatch", carsBatch))
+	return &carsBatch, nil
+}
+
+// parseCarsBatchOperation checks the body of an operation against the schema used by the single car route for the same method
+func (c client) parseCarsBatchOperation(r *http.Request, method, carId string, body []byte, test bool) (*dto.CarsBatchOperation, error) {
+	ctx := r.Context()
+
+	switch method {
+	case "CREATE":
+		if err := c.schemaClient.CheckBodyAgainstSchema(ctx, schema.CarCreate, body); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking body against schema")
+		}
+		carCreate := dto.CarCreate{
+			Test: test,
+		}
+		if err := json.Unmarshal(body, &carCreate.UserInput); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed unmarshalling body into dto.CarCreate")
+		}
+		return &dto.CarsBatchOperation{CarCreate: &carCreate}, nil
+
+	case "UPDATE":
+		if err := c.schemaClient.CheckBodyAgainstSchema(ctx, schema.CarUpdate, body); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking body against schema")
+		}
+		carUpdate := dto.CarUpdate{
+			Id:   carId,
+			Test: test,
+		}
+		if err := json.Unmarshal(body, &carUpdate.UserInput); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed unmarshalling body into dto.CarUpdate")
+		}
+		return &dto.CarsBatchOperation{CarUpdate: &carUpdate}, nil
+
+	case "DELETE":
+		return &dto.CarsBatchOperation{CarDelete: &dto.CarDelete{
+			Id:   carId,
+			Test: test,
+		}}, nil
+	}
+
+	return nil, lib_errors.NewCustomf(http.StatusBadRequest, "Not recognized: method = %s", method)
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+const (
+	carChangesWaitMax = 30 * time.Second
+)
+
+func (c client) ParseReadCarChanges(r *http.Request) (*dto.CarChangesRead, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	pagination, err := lib_pagination.NewPagination(r, nil)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating pagination")
+	}
+
+	since, err := parseSince(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing since")
+	}
+
+	wait, err := parseWait(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing wait")
+	}
+
+	carChangesRead := dto.CarChangesRead{
+		Pagination: *pagination,
+		Since:      since,
+		Stream:     IsEventStreamAccepted(r),
+		Test:       lib_context.Test(ctx),
+		Wait:       wait,
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carChangesRead", carChangesRead))
+	return &carChangesRead, nil
+}
+
+// parseSince decodes the since token returned by a previous read, a reconnecting event stream sends it in the Last-Event-ID header
+func parseSince(r *http.Request) (*dto.CarChangesToken, error) {
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		since = r.Header.Get("Last-Event-ID")
+	}
+	if since == "" {
+		return nil, nil
+	}
+
+	malformed := func(err error) error {
+		return lib_errors.NewCustomWithCauseAndMetadata(http.StatusBadRequest, constants.BadRequestMalformedSince, err, map[string]interface{}{
+			"since": constants.BadRequestMalformedSince,
+		})
+	}
+	b, err := base64.RawURLEncoding.DecodeString(since)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	parts := strings.SplitN(string(b), ",", 2)
+	if len(parts) != 2 {
+		return nil, malformed(lib_errors.Errorf("Not recognized: since = %s", since))
+	}
+	dateCreated, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, malformed(err)
+	}
+	return &dto.CarChangesToken{
+		CarHistoryId: parts[1],
+		DateCreated:  dateCreated,
+	}, nil
+}
+
+// parseWait parses the seconds a read waits for changes when there are none
+func parseWait(r *http.Request) (time.Duration, error) {
+	wait := r.URL.Query().Get("wait")
+	if wait == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(wait)
+	if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > carChangesWaitMax {
+		return 0, lib_errors.NewCustomWithCauseAndMetadata(http.StatusBadRequest, constants.BadRequestMalformedWait, err, map[string]interface{}{
+			"wait": constants.BadRequestMalformedWait,
+		})
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// IsEventStreamAccepted reports whether the changes are streamed as server-sent events, the timeout of the request depends on it
+func IsEventStreamAccepted(r *http.Request) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err == nil && mediaType == constants.ContentTypeEventStream {
+			return true
+		}
+	}
+	return false
+}
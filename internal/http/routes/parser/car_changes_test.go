@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"car-svc/internal/lib/dto"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_parseSince(t *testing.T) {
+	var data = []struct {
+		desc          string
+		input         string
+		lastEventId   string
+		expected      *dto.CarChangesToken
+		expectedError bool
+	}{
+		{
+			desc:     "no since",
+			input:    "/",
+			expected: nil,
+		},
+		{
+			desc:  "since",
+			input: "/?since=MjAyMS0wOC0yNVQyMjowMTowNS4xMjNaLGMyYTE",
+			expected: &dto.CarChangesToken{
+				CarHistoryId: "c2a1",
+				DateCreated:  time.Date(2021, 8, 25, 22, 1, 5, 123000000, time.UTC),
+			},
+		},
+		{
+			desc:        "last event id",
+			input:       "/",
+			lastEventId: "MjAyMS0wOC0yNVQyMjowMTowNS4xMjNaLGMyYTE",
+			expected: &dto.CarChangesToken{
+				CarHistoryId: "c2a1",
+				DateCreated:  time.Date(2021, 8, 25, 22, 1, 5, 123000000, time.UTC),
+			},
+		},
+		{
+			desc:          "malformed since",
+			input:         "/?since=yesterday",
+			expectedError: true,
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodGet, d.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.lastEventId != "" {
+			req.Header.Set("Last-Event-ID", d.lastEventId)
+		}
+
+		result, err := parseSince(req)
+		if d.expectedError {
+			if cerr, ok := err.(lib_errors.Custom); !ok || cerr.Code != http.StatusBadRequest {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   http.StatusBadRequest,
+					Result:     err,
+				}))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, d.expected) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_parseWait(t *testing.T) {
+	var data = []struct {
+		desc          string
+		input         string
+		expected      time.Duration
+		expectedError bool
+	}{
+		{
+			desc:     "no wait",
+			input:    "/",
+			expected: 0,
+		},
+		{
+			desc:     "wait",
+			input:    "/?wait=20",
+			expected: 20 * time.Second,
+		},
+		{
+			desc:          "wait too long",
+			input:         "/?wait=31",
+			expectedError: true,
+		},
+		{
+			desc:          "malformed wait",
+			input:         "/?wait=forever",
+			expectedError: true,
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodGet, d.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := parseWait(req)
+		if d.expectedError {
+			if cerr, ok := err.(lib_errors.Custom); !ok || cerr.Code != http.StatusBadRequest {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   http.StatusBadRequest,
+					Result:     err,
+				}))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
@@ -1 +1,47 @@
 package parser
+
+import (
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/schema"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+func (c client) ParseCreateCarCustomerAssociation(r *http.Request) (*dto.CarCustomerAssociationCreate, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	carId := chi.URLParam(r, "id")
+	if carId == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+
+	body, err := lib_http.ReadRequestBody(r, true)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding body for request")
+	}
+	if err := c.schemaClient.CheckBodyAgainstSchema(ctx, schema.CarCustomerAssociationCreate, body); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking body against schema")
+	}
+
+	carCustomerAssociationCreate := dto.CarCustomerAssociationCreate{
+		CarId: carId,
+		Test:  lib_context.Test(ctx),
+	}
+	if err := json.Unmarshal(body, &carCustomerAssociationCreate.UserInput); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed unmarshalling body into dto.CarCustomerAssociationCreate")
+	}
+	if !carCustomerAssociationCreate.UserInput.DateRentalEnd.After(carCustomerAssociationCreate.UserInput.DateRentalStart) {
+		return nil, lib_errors.NewCustomf(http.StatusBadRequest, "Invalid date_rental_end %q, must be after date_rental_start", carCustomerAssociationCreate.UserInput.DateRentalEnd.Format(time.RFC3339))
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carCustomerAssociationCreate", carCustomerAssociationCreate))
+	return &carCustomerAssociationCreate, nil
+}
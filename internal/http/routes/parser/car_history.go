@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/schema"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+func (c client) ParseSearchCarHistory(r *http.Request) (*dto.CarHistorySearch, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+
+	pagination, err := lib_pagination.NewPagination(r, nil)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating pagination")
+	}
+
+	carHistorySearch := dto.CarHistorySearch{
+		CarId:      id,
+		Pagination: *pagination,
+		Test:       lib_context.Test(ctx),
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carHistorySearch", carHistorySearch))
+	return &carHistorySearch, nil
+}
+
+func (c client) ParseRevertCar(r *http.Request) (*dto.CarRevert, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+
+	ifUnmodifiedSince, err := parseIfUnmodifiedSince(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing if unmodified since")
+	}
+	// A revert replaces every field of the car, so it is only applied to the version of the car the caller read
+	if ifUnmodifiedSince == nil {
+		return nil, lib_errors.NewCustomWithMetadata(http.StatusPreconditionRequired, constants.PreconditionRequiredIfUnmodifiedSince, map[string]interface{}{
+			"if_unmodified_since": constants.PreconditionRequiredIfUnmodifiedSince,
+		})
+	}
+
+	carRevert := dto.CarRevert{
+		Id:                id,
+		IfUnmodifiedSince: ifUnmodifiedSince,
+		Test:              lib_context.Test(ctx),
+	}
+
+	body, err := lib_http.ReadRequestBody(r, true)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding body for request")
+	}
+	if err := c.schemaClient.CheckBodyAgainstSchema(ctx, schema.CarRevert, body); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking body against schema")
+	}
+	if err := json.Unmarshal(body, &carRevert.UserInput); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed unmarshalling body into dto.CarRevert")
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carRevert", carRevert))
+	return &carRevert, nil
+}
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_ParseRevertCar(t *testing.T) {
+	ifUnmodifiedSince := time.Date(2021, 8, 25, 22, 1, 5, 123000000, time.UTC)
+
+	var data = []struct {
+		desc         string
+		input        string
+		expected     *time.Time
+		expectedCode int
+	}{
+		{
+			desc:         "no if unmodified since",
+			input:        "",
+			expectedCode: http.StatusPreconditionRequired,
+		},
+		{
+			desc:         "malformed if unmodified since",
+			input:        "yesterday",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			desc:     "if unmodified since",
+			input:    "2021-08-25T22:01:05.123Z",
+			expected: &ifUnmodifiedSince,
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodPost, "/cars/car-id/revert", bytes.NewBufferString(`{"car_history_id":"car-history-id"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.input != "" {
+			req.Header.Set("If-Unmodified-Since", d.input)
+		}
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "car-id")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		result, err := clientSuccess.ParseRevertCar(req)
+		if d.expectedCode != 0 {
+			if !lib_errors.IsCustomWithCode(err, d.expectedCode) {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   d.expectedCode,
+					Result:     err,
+				}))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Id != "car-id" || result.IfUnmodifiedSince == nil || !result.IfUnmodifiedSince.Equal(*d.expected) || result.UserInput.CarHistoryId == nil || *result.UserInput.CarHistoryId != "car-history-id" {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
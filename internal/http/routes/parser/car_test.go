@@ -3,18 +3,33 @@ package parser
 import (
 	"bytes"
 	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/rbac"
+	"car-svc/internal/lib/schema"
 	"context"
 	"encoding/json"
 	"net/http"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	lib_context "github.com/tomwangsvc/lib-svc/context"
 	lib_errors "github.com/tomwangsvc/lib-svc/errors"
 	lib_schema_mock "github.com/tomwangsvc/lib-svc/schema/mock"
 	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+	"github.com/xeipuuv/gojsonschema"
 )
 
+// repoDir returns the absolute path of the root of the repository, the schema files are read from there
+func repoDir(t *testing.T) string {
+	dir, err := filepath.Abs(filepath.Join("..", "..", "..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
 func Test_ParseCreateCar(t *testing.T) {
 	carCreate := dto.CarCreate{
 		Test: true,
@@ -120,3 +135,398 @@ func Test_ParseCreateCar(t *testing.T) {
 		}
 	}
 }
+
+func Test_parseFields(t *testing.T) {
+	type expected struct {
+		code   int
+		fields []string
+	}
+	var data = []struct {
+		desc  string
+		input string
+		expected
+	}{
+		{
+			desc:     "no fields",
+			input:    "/",
+			expected: expected{fields: nil},
+		},
+		{
+			desc:     "empty fields",
+			input:    "/?fields=",
+			expected: expected{fields: nil},
+		},
+		{
+			desc:     "fields",
+			input:    "/?fields=car_id,%20brand_name,,model_name",
+			expected: expected{fields: []string{"car_id", "brand_name", "model_name"}},
+		},
+		{
+			desc:     "field named twice",
+			input:    "/?fields=car_id,car_id,brand_name",
+			expected: expected{fields: []string{"car_id", "brand_name"}},
+		},
+		{
+			desc:     "field not recognized",
+			input:    "/?fields=car_id,tenant_id",
+			expected: expected{code: http.StatusBadRequest},
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodGet, d.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := parseFields(req)
+		if d.expected.code != 0 {
+			if !lib_errors.IsCustomWithCode(err, d.expected.code) {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   d.expected.code,
+					Result:     err,
+				}))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, d.expected.fields) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.fields,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_parseAsOf(t *testing.T) {
+	asOf := time.Date(2021, 8, 25, 22, 1, 5, 123000000, time.UTC)
+
+	var data = []struct {
+		desc          string
+		input         string
+		expected      *time.Time
+		expectedError bool
+	}{
+		{
+			desc:     "no as of",
+			input:    "/",
+			expected: nil,
+		},
+		{
+			desc:     "as of",
+			input:    "/?as_of=2021-08-25T22:01:05.123Z",
+			expected: &asOf,
+		},
+		{
+			desc:          "malformed as of",
+			input:         "/?as_of=yesterday",
+			expectedError: true,
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodGet, d.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := parseAsOf(req)
+		if d.expectedError {
+			if cerr, ok := err.(lib_errors.Custom); !ok || cerr.Code != http.StatusBadRequest {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   http.StatusBadRequest,
+					Result:     err,
+				}))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (result == nil) != (d.expected == nil) || (result != nil && !result.Equal(*d.expected)) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_parseIncludeDeleted(t *testing.T) {
+	var data = []struct {
+		desc         string
+		input        string
+		grants       rbac.Grants
+		expected     bool
+		expectedCode int
+	}{
+		{
+			desc:     "no include deleted",
+			input:    "/",
+			expected: false,
+		},
+		{
+			desc:     "include deleted false",
+			input:    "/?include_deleted=false",
+			expected: false,
+		},
+		{
+			desc:         "include deleted true without grants",
+			input:        "/?include_deleted=true",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			desc:     "include deleted true with read deleted permission",
+			input:    "/?include_deleted=true",
+			grants:   rbac.Grants{rbac.PermissionCarReadDeleted: rbac.Scope{All: true}},
+			expected: true,
+		},
+		{
+			desc:         "include deleted true without read deleted permission",
+			input:        "/?include_deleted=true",
+			grants:       rbac.Grants{"car:read": rbac.Scope{All: true}},
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodGet, d.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.grants != nil {
+			req = req.WithContext(rbac.WithGrants(req.Context(), d.grants, rbac.Scope{All: true}))
+		}
+
+		result, err := parseIncludeDeleted(req)
+		if d.expectedCode != 0 {
+			if cerr, ok := err.(lib_errors.Custom); !ok || cerr.Code != d.expectedCode {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   d.expectedCode,
+					Result:     err,
+				}))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_ParseBatchCars(t *testing.T) {
+	// The mock schema client accepts any body, so every body is checked against the batch schema here to keep the cases to those the service can receive
+	carsBatchSchema, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader("file://" + filepath.Join(repoDir(t), "schema", schema.CarsBatch)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	brandName := "brand_name"
+	newRequest := func(mode, operation string) *http.Request {
+		body := []byte(`{"mode":"` + mode + `","operations":[` +
+			`{"method":"CREATE","body":{"brand_name":"brand_name","model_name":"model_name"}},` +
+			`{"method":"UPDATE","car_id":"car_id","body":{"brand_name":"brand_name"}},` +
+			operation + `]}`)
+		result, err := carsBatchSchema.Validate(gojsonschema.NewBytesLoader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Valid() {
+			t.Fatalf("body not valid against %s: %v", schema.CarsBatch, result.Errors())
+		}
+		req, err := http.NewRequest(http.MethodPost, "/car-svc/v1/cars:batch", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req.WithContext(lib_context.WithTest(context.Background(), true))
+	}
+	// The body of the invalid create is an object as the batch schema requires, but its brand name is not a string as car_create.json requires
+	operationCreateInvalid := `{"method":"CREATE","body":{"brand_name":1,"model_name":"model_name"}}`
+	operationDelete := `{"method":"DELETE","car_id":"car_id"}`
+	operations := []dto.CarsBatchOperation{
+		{CarCreate: &dto.CarCreate{Test: true, UserInput: dto.CarCreateUserInput{BrandName: "brand_name", ModelName: "model_name"}}},
+		{CarUpdate: &dto.CarUpdate{Id: "car_id", Test: true, UserInput: dto.CarUpdateUserInput{BrandName: &brandName}}},
+		{CarDelete: &dto.CarDelete{Id: "car_id", Test: true}},
+	}
+
+	type expected struct {
+		hasError            bool
+		mode                string
+		operations          []dto.CarsBatchOperation
+		operationsWithError []int
+	}
+	var data = []struct {
+		desc string
+		client
+		input *http.Request
+		expected
+	}{
+		{
+			desc:   "success",
+			client: clientSuccess,
+			input:  newRequest(dto.CarsBatchModeAllOrNothing, operationDelete),
+			expected: expected{
+				mode:       dto.CarsBatchModeAllOrNothing,
+				operations: operations,
+			},
+		},
+		{
+			desc:   "all or nothing with invalid operation",
+			client: clientSuccess,
+			input:  newRequest(dto.CarsBatchModeAllOrNothing, operationCreateInvalid),
+			expected: expected{
+				hasError: true,
+			},
+		},
+		{
+			desc:   "best effort with invalid operation",
+			client: clientSuccess,
+			input:  newRequest(dto.CarsBatchModeBestEffort, operationCreateInvalid),
+			expected: expected{
+				mode:                dto.CarsBatchModeBestEffort,
+				operations:          operations[:2],
+				operationsWithError: []int{2},
+			},
+		},
+		{
+			desc:   "schema error",
+			client: clientErrorLibSchema,
+			input:  newRequest(dto.CarsBatchModeAllOrNothing, operationDelete),
+			expected: expected{
+				hasError: true,
+			},
+		},
+	}
+
+	for i, d := range data {
+		result, err := d.client.ParseBatchCars(d.input)
+
+		if d.expected.hasError {
+			if err == nil {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err not exist",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   nil,
+					Result:     result,
+				}))
+			}
+
+		} else if err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err exists",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   nil,
+				Result:     err.Error(),
+			}))
+
+		} else {
+			if result.Mode != d.expected.mode || !result.Test || len(result.Operations) != len(d.expected.operations)+len(d.expected.operationsWithError) {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "result",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   d.expected,
+					Result:     result,
+				}))
+				continue
+			}
+			for j, v := range d.expected.operations {
+				if !reflect.DeepEqual(result.Operations[j], v) {
+					t.Error(lib_testing.Errorf(lib_testing.Error{
+						Unexpected: "result.Operations",
+						Desc:       d.desc,
+						At:         i,
+						Expected:   v,
+						Result:     result.Operations[j],
+					}))
+				}
+			}
+			for _, j := range d.expected.operationsWithError {
+				if result.Operations[j].Error == nil {
+					t.Error(lib_testing.Errorf(lib_testing.Error{
+						Unexpected: "result.Operations.Error not exist",
+						Desc:       d.desc,
+						At:         i,
+						Expected:   j,
+						Result:     result.Operations[j],
+					}))
+				}
+			}
+		}
+	}
+}
+
+func Test_carsBatchSchema_maxOperations(t *testing.T) {
+	carsBatchSchema, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader("file://" + filepath.Join(repoDir(t), "schema", schema.CarsBatch)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newBody := func(n int) []byte {
+		operations := make([]string, n)
+		for i := range operations {
+			operations[i] = `{"method":"DELETE","car_id":"car_id"}`
+		}
+		return []byte(`{"mode":"ALL_OR_NOTHING","operations":[` + strings.Join(operations, ",") + `]}`)
+	}
+
+	var data = []struct {
+		desc     string
+		input    []byte
+		expected bool
+	}{
+		{
+			desc:     "operations at the limit",
+			input:    newBody(dto.CarsBatchMaxOperations),
+			expected: true,
+		},
+		{
+			desc:  "operations over the limit",
+			input: newBody(dto.CarsBatchMaxOperations + 1),
+		},
+	}
+
+	for i, d := range data {
+		result, err := carsBatchSchema.Validate(gojsonschema.NewBytesLoader(d.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Valid() != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result.Valid()",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result.Valid(),
+			}))
+		}
+	}
+}
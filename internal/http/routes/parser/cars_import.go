@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/importer"
+	"mime"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+func (c client) ParseImportCars(r *http.Request) (*dto.CarsImport, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, lib_errors.NewCustomWithCause(http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType), err)
+	}
+	format, err := importer.FormatForContentType(contentType)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting format for content type")
+	}
+
+	rows, err := importer.DecodeRows(format, r.Body)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding rows")
+	}
+
+	carsImport := dto.CarsImport{
+		Format: format,
+		Rows:   rows,
+		Test:   lib_context.Test(ctx),
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtString("carsImport.Format", carsImport.Format), lib_log.FmtInt("len(carsImport.Rows)", len(carsImport.Rows)))
+	return &carsImport, nil
+}
+
+func (c client) ParseReadCarsImportReport(r *http.Request) (*dto.CarsImportReportRead, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+
+	carsImportReportRead := dto.CarsImportReportRead{
+		Id:   id,
+		Test: lib_context.Test(ctx),
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("carsImportReportRead", carsImportReportRead))
+	return &carsImportReportRead, nil
+}
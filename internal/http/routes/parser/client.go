@@ -2,28 +2,52 @@ package parser
 
 import (
 	"car-svc/internal/lib/dto"
+	"context"
 	"net/http"
 
 	lib_countries "github.com/tomwangsvc/lib-svc/countries"
 	lib_env "github.com/tomwangsvc/lib-svc/env"
+	lib_pubsub "github.com/tomwangsvc/lib-svc/pubsub"
 	lib_schema "github.com/tomwangsvc/lib-svc/schema"
 )
 
 type Client interface {
 	ParseCreateCar(r *http.Request) (*dto.CarCreate, error)
 	ParseSearchCars(r *http.Request) (*dto.CarsSearch, error)
+	ParseExportCars(r *http.Request) (*dto.CarsExport, error)
 	ParseReadCar(r *http.Request) (*dto.CarRead, error)
 	ParseUpdateCar(r *http.Request) (*dto.CarUpdate, error)
+	ParsePatchCar(r *http.Request) (*dto.CarPatch, error)
 	ParseDeleteCar(r *http.Request) (*dto.CarDelete, error)
+	ParseRestoreCar(r *http.Request) (*dto.CarRestore, error)
+	ParseBatchCars(r *http.Request) (*dto.CarsBatch, error)
+	ParseImportCars(r *http.Request) (*dto.CarsImport, error)
+	ParseReadCarsImportReport(r *http.Request) (*dto.CarsImportReportRead, error)
+	ParseSearchCarHistory(r *http.Request) (*dto.CarHistorySearch, error)
+	ParseRevertCar(r *http.Request) (*dto.CarRevert, error)
+	ParseReadCarChanges(r *http.Request) (*dto.CarChangesRead, error)
+	ParseCreateCarCustomerAssociation(r *http.Request) (*dto.CarCustomerAssociationCreate, error)
+	ParseReadCustomer(r *http.Request) (*dto.CustomerRead, error)
+	ParseConsumeCustomerEvent(r *http.Request) (context.Context, *dto.CustomerEvent, error)
+	ParseCreateWebhookSubscription(r *http.Request) (*dto.WebhookSubscriptionCreate, error)
+	ParseSearchWebhookSubscriptions(r *http.Request) (*dto.WebhookSubscriptionsSearch, error)
+	ParseDeleteWebhookSubscription(r *http.Request) (*dto.WebhookSubscriptionDelete, error)
+	ParseSearchWebhookDeliveries(r *http.Request) (*dto.WebhookDeliveriesSearch, error)
+	ParseRedeliverWebhookDelivery(r *http.Request) (*dto.WebhookDeliveryRedeliver, error)
+	ParseCreateApiKey(r *http.Request) (*dto.ApiKeyCreate, error)
+	ParseSearchApiKeys(r *http.Request) (*dto.ApiKeysSearch, error)
+	ParseRotateApiKey(r *http.Request) (*dto.ApiKeyRotate, error)
+	ParseRevokeApiKey(r *http.Request) (*dto.ApiKeyRevoke, error)
 }
 
 type Config struct {
 	Env lib_env.Env
 }
 
-func NewClient(config Config, schemaClient lib_schema.Client, countriesMetadata lib_countries.Metadata) Client {
+func NewClient(config Config, pubsubClient lib_pubsub.Client, schemaClient lib_schema.Client, countriesMetadata lib_countries.Metadata) Client {
 	return client{
 		config:            config,
+		pubsubClient:      pubsubClient,
 		schemaClient:      schemaClient,
 		countriesMetadata: countriesMetadata,
 	}
@@ -31,6 +55,7 @@ func NewClient(config Config, schemaClient lib_schema.Client, countriesMetadata
 
 type client struct {
 	config            Config
+	pubsubClient      lib_pubsub.Client
 	schemaClient      lib_schema.Client
 	countriesMetadata lib_countries.Metadata
 }
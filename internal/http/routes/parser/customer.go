@@ -1 +1,80 @@
 package parser
+
+import (
+	"car-svc/internal/lib/dto"
+	"context"
+	"net/http"
+	"strconv"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/go-chi/chi/v5"
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+const (
+	subscriptionCustomerEvents = "car-svc-customer-events"
+	topicCustomerEvents        = "customer-svc-events"
+)
+
+func (c client) ParseReadCustomer(r *http.Request) (*dto.CustomerRead, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+
+	customerRead := dto.CustomerRead{
+		Id: id,
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("customerRead", customerRead))
+	return &customerRead, nil
+}
+
+// ParseConsumeCustomerEvent parses a customer event pushed by pubsub and returns the context restored from the message, the request must have been authorized by lib_pubsub which replaces the body with the message data
+func (c client) ParseConsumeCustomerEvent(r *http.Request) (context.Context, *dto.CustomerEvent, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	body, err := lib_http.ReadRequestBody(r, true)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed decoding body for request")
+	}
+
+	pubsubMessageId := lib_context.PubsubMessageId(ctx)
+	if pubsubMessageId == "" {
+		return nil, nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing pubsub message id")
+	}
+
+	// The attributes of the push message are already in the context, they are passed on so that unmarshalling restores the same correlation context as a pulled message
+	var event dto.Event
+	ctx, _, _, err = c.pubsubClient.Unmarshal(ctx, topicCustomerEvents, subscriptionCustomerEvents, &pubsub.Message{
+		Attributes: map[string]string{
+			"test": strconv.FormatBool(lib_context.Test(ctx)),
+		},
+		Data:        body,
+		ID:          pubsubMessageId,
+		PublishTime: lib_context.PubsubMessagePublishTime(ctx),
+	}, &event)
+	if err != nil {
+		return nil, nil, lib_errors.NewCustomWithCause(http.StatusBadRequest, "Malformed customer event", err)
+	}
+	if event.AggregateId == "" {
+		return nil, nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing aggregate_id in customer event")
+	}
+
+	customerEvent := dto.CustomerEvent{
+		CustomerId:      event.AggregateId,
+		EventType:       event.EventType,
+		PubsubMessageId: pubsubMessageId,
+		Test:            lib_context.Test(ctx),
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("customerEvent", customerEvent))
+	return ctx, &customerEvent, nil
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+)
+
+const (
+	HeaderKeyIdempotencyKey = "Idempotency-Key"
+
+	idempotencyKeyMaxLength = 255
+)
+
+// ParseIdempotencyKey returns nil when the request does not have an idempotency key
+// -> the request hash covers the method, path, test flag and body so that a key reused for a different request can be rejected
+func ParseIdempotencyKey(r *http.Request, body []byte) (*dto.IdempotencyKey, error) {
+	key := strings.TrimSpace(r.Header.Get(HeaderKeyIdempotencyKey))
+	if key == "" {
+		return nil, nil
+	}
+	if len(key) > idempotencyKeyMaxLength {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, constants.BadRequestIdempotencyKeyTooLong)
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s %t\n", r.Method, r.URL.Path, lib_context.Test(r.Context()))
+	hash.Write(body)
+
+	return &dto.IdempotencyKey{
+		Key:         key,
+		RequestHash: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
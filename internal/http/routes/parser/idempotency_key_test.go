@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_ParseIdempotencyKey(t *testing.T) {
+	newRequest := func(key, body string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "/car-svc/v1/cars", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != "" {
+			req.Header.Set(HeaderKeyIdempotencyKey, key)
+		}
+		return req
+	}
+
+	if result, err := ParseIdempotencyKey(newRequest("", "{}"), []byte("{}")); err != nil || result != nil {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "result exists",
+			Desc:       "no header",
+			Expected:   nil,
+			Result:     result,
+		}))
+	}
+
+	if _, err := ParseIdempotencyKey(newRequest(strings.Repeat("a", idempotencyKeyMaxLength+1), "{}"), []byte("{}")); !lib_errors.IsCustomWithCode(err, http.StatusBadRequest) {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "err",
+			Desc:       "too long",
+			Expected:   http.StatusBadRequest,
+			Result:     err,
+		}))
+	}
+
+	first, err := ParseIdempotencyKey(newRequest("key", `{"a":1}`), []byte(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry, err := ParseIdempotencyKey(newRequest("key", `{"a":1}`), []byte(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	different, err := ParseIdempotencyKey(newRequest("key", `{"a":2}`), []byte(`{"a":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Key != "key" || first.RequestHash != retry.RequestHash {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "request hash of retry",
+			Desc:       "retry",
+			Expected:   first,
+			Result:     retry,
+		}))
+	}
+	if first.RequestHash == different.RequestHash {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "request hash of different request",
+			Desc:       "different request",
+			Expected:   first,
+			Result:     different,
+		}))
+	}
+}
@@ -3,6 +3,7 @@ package mock
 import (
 	"car-svc/internal/http/routes/parser"
 	"car-svc/internal/lib/dto"
+	"context"
 	"net/http"
 
 	lib_errors "github.com/tomwangsvc/lib-svc/errors"
@@ -25,6 +26,10 @@ func (clientError) ParseSearchCars(_ *http.Request) (*dto.CarsSearch, error) {
 	return nil, ExpectedErrorClient
 }
 
+func (clientError) ParseExportCars(_ *http.Request) (*dto.CarsExport, error) {
+	return nil, ExpectedErrorClient
+}
+
 func (clientError) ParseReadCar(_ *http.Request) (*dto.CarRead, error) {
 	return nil, ExpectedErrorClient
 }
@@ -33,10 +38,90 @@ func (clientError) ParseUpdateCar(_ *http.Request) (*dto.CarUpdate, error) {
 	return nil, ExpectedErrorClient
 }
 
+func (clientError) ParsePatchCar(_ *http.Request) (*dto.CarPatch, error) {
+	return nil, ExpectedErrorClient
+}
+
 func (clientError) ParseDeleteCar(_ *http.Request) (*dto.CarDelete, error) {
 	return nil, ExpectedErrorClient
 }
 
+func (clientError) ParseRestoreCar(_ *http.Request) (*dto.CarRestore, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseBatchCars(_ *http.Request) (*dto.CarsBatch, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseImportCars(_ *http.Request) (*dto.CarsImport, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseReadCarsImportReport(_ *http.Request) (*dto.CarsImportReportRead, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseSearchCarHistory(_ *http.Request) (*dto.CarHistorySearch, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseRevertCar(_ *http.Request) (*dto.CarRevert, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseReadCarChanges(_ *http.Request) (*dto.CarChangesRead, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseCreateCarCustomerAssociation(_ *http.Request) (*dto.CarCustomerAssociationCreate, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseReadCustomer(_ *http.Request) (*dto.CustomerRead, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseConsumeCustomerEvent(r *http.Request) (context.Context, *dto.CustomerEvent, error) {
+	return r.Context(), nil, ExpectedErrorClient
+}
+
+func (clientError) ParseCreateWebhookSubscription(_ *http.Request) (*dto.WebhookSubscriptionCreate, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseSearchWebhookSubscriptions(_ *http.Request) (*dto.WebhookSubscriptionsSearch, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseDeleteWebhookSubscription(_ *http.Request) (*dto.WebhookSubscriptionDelete, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseSearchWebhookDeliveries(_ *http.Request) (*dto.WebhookDeliveriesSearch, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseRedeliverWebhookDelivery(_ *http.Request) (*dto.WebhookDeliveryRedeliver, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseCreateApiKey(_ *http.Request) (*dto.ApiKeyCreate, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseSearchApiKeys(_ *http.Request) (*dto.ApiKeysSearch, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseRotateApiKey(_ *http.Request) (*dto.ApiKeyRotate, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (clientError) ParseRevokeApiKey(_ *http.Request) (*dto.ApiKeyRevoke, error) {
+	return nil, ExpectedErrorClient
+}
+
 type clientSuccess struct{}
 
 func (clientSuccess) ParseCreateCar(_ *http.Request) (*dto.CarCreate, error) {
@@ -47,6 +132,10 @@ func (clientSuccess) ParseSearchCars(_ *http.Request) (*dto.CarsSearch, error) {
 	return &dto.CarsSearch{}, nil
 }
 
+func (clientSuccess) ParseExportCars(_ *http.Request) (*dto.CarsExport, error) {
+	return &dto.CarsExport{}, nil
+}
+
 func (clientSuccess) ParseReadCar(_ *http.Request) (*dto.CarRead, error) {
 	return &dto.CarRead{}, nil
 }
@@ -55,6 +144,86 @@ func (clientSuccess) ParseUpdateCar(_ *http.Request) (*dto.CarUpdate, error) {
 	return &dto.CarUpdate{}, nil
 }
 
+func (clientSuccess) ParsePatchCar(_ *http.Request) (*dto.CarPatch, error) {
+	return &dto.CarPatch{}, nil
+}
+
 func (clientSuccess) ParseDeleteCar(_ *http.Request) (*dto.CarDelete, error) {
 	return &dto.CarDelete{}, nil
 }
+
+func (clientSuccess) ParseRestoreCar(_ *http.Request) (*dto.CarRestore, error) {
+	return &dto.CarRestore{}, nil
+}
+
+func (clientSuccess) ParseBatchCars(_ *http.Request) (*dto.CarsBatch, error) {
+	return &dto.CarsBatch{}, nil
+}
+
+func (clientSuccess) ParseImportCars(_ *http.Request) (*dto.CarsImport, error) {
+	return &dto.CarsImport{}, nil
+}
+
+func (clientSuccess) ParseReadCarsImportReport(_ *http.Request) (*dto.CarsImportReportRead, error) {
+	return &dto.CarsImportReportRead{}, nil
+}
+
+func (clientSuccess) ParseSearchCarHistory(_ *http.Request) (*dto.CarHistorySearch, error) {
+	return &dto.CarHistorySearch{}, nil
+}
+
+func (clientSuccess) ParseRevertCar(_ *http.Request) (*dto.CarRevert, error) {
+	return &dto.CarRevert{}, nil
+}
+
+func (clientSuccess) ParseReadCarChanges(_ *http.Request) (*dto.CarChangesRead, error) {
+	return &dto.CarChangesRead{}, nil
+}
+
+func (clientSuccess) ParseCreateCarCustomerAssociation(_ *http.Request) (*dto.CarCustomerAssociationCreate, error) {
+	return &dto.CarCustomerAssociationCreate{}, nil
+}
+
+func (clientSuccess) ParseReadCustomer(_ *http.Request) (*dto.CustomerRead, error) {
+	return &dto.CustomerRead{}, nil
+}
+
+func (clientSuccess) ParseConsumeCustomerEvent(r *http.Request) (context.Context, *dto.CustomerEvent, error) {
+	return r.Context(), &dto.CustomerEvent{}, nil
+}
+
+func (clientSuccess) ParseCreateWebhookSubscription(_ *http.Request) (*dto.WebhookSubscriptionCreate, error) {
+	return &dto.WebhookSubscriptionCreate{}, nil
+}
+
+func (clientSuccess) ParseSearchWebhookSubscriptions(_ *http.Request) (*dto.WebhookSubscriptionsSearch, error) {
+	return &dto.WebhookSubscriptionsSearch{}, nil
+}
+
+func (clientSuccess) ParseDeleteWebhookSubscription(_ *http.Request) (*dto.WebhookSubscriptionDelete, error) {
+	return &dto.WebhookSubscriptionDelete{}, nil
+}
+
+func (clientSuccess) ParseSearchWebhookDeliveries(_ *http.Request) (*dto.WebhookDeliveriesSearch, error) {
+	return &dto.WebhookDeliveriesSearch{}, nil
+}
+
+func (clientSuccess) ParseRedeliverWebhookDelivery(_ *http.Request) (*dto.WebhookDeliveryRedeliver, error) {
+	return &dto.WebhookDeliveryRedeliver{}, nil
+}
+
+func (clientSuccess) ParseCreateApiKey(_ *http.Request) (*dto.ApiKeyCreate, error) {
+	return &dto.ApiKeyCreate{}, nil
+}
+
+func (clientSuccess) ParseSearchApiKeys(_ *http.Request) (*dto.ApiKeysSearch, error) {
+	return &dto.ApiKeysSearch{}, nil
+}
+
+func (clientSuccess) ParseRotateApiKey(_ *http.Request) (*dto.ApiKeyRotate, error) {
+	return &dto.ApiKeyRotate{}, nil
+}
+
+func (clientSuccess) ParseRevokeApiKey(_ *http.Request) (*dto.ApiKeyRevoke, error) {
+	return &dto.ApiKeyRevoke{}, nil
+}
@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/schema"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+	lib_strings "github.com/tomwangsvc/lib-svc/strings"
+)
+
+func (c client) ParseCreateWebhookSubscription(r *http.Request) (*dto.WebhookSubscriptionCreate, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	body, err := lib_http.ReadRequestBody(r, true)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding body for request")
+	}
+	if err := c.schemaClient.CheckBodyAgainstSchema(ctx, schema.WebhookSubscriptionCreate, body); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking body against schema")
+	}
+
+	webhookSubscriptionCreate := dto.WebhookSubscriptionCreate{
+		Test: lib_context.Test(ctx),
+	}
+	if err := json.Unmarshal(body, &webhookSubscriptionCreate.UserInput); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed unmarshalling body into dto.WebhookSubscriptionCreate")
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtString("webhookSubscriptionCreate.UserInput.Url", webhookSubscriptionCreate.UserInput.Url))
+	return &webhookSubscriptionCreate, nil
+}
+
+func (c client) ParseSearchWebhookSubscriptions(r *http.Request) (*dto.WebhookSubscriptionsSearch, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	pagination, err := lib_pagination.NewPagination(r, nil)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating pagination")
+	}
+
+	webhookSubscriptionsSearch := dto.WebhookSubscriptionsSearch{
+		Pagination: *pagination,
+		Test:       lib_context.Test(ctx),
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("webhookSubscriptionsSearch", webhookSubscriptionsSearch))
+	return &webhookSubscriptionsSearch, nil
+}
+
+func (c client) ParseDeleteWebhookSubscription(r *http.Request) (*dto.WebhookSubscriptionDelete, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+
+	webhookSubscriptionDelete := dto.WebhookSubscriptionDelete{
+		Id:   id,
+		Test: lib_context.Test(ctx),
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("webhookSubscriptionDelete", webhookSubscriptionDelete))
+	return &webhookSubscriptionDelete, nil
+}
+
+func (c client) ParseSearchWebhookDeliveries(r *http.Request) (*dto.WebhookDeliveriesSearch, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+
+	status, err := parseWebhookDeliveryStatus(r)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing webhook delivery status")
+	}
+
+	pagination, err := lib_pagination.NewPagination(r, nil)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating pagination")
+	}
+
+	webhookDeliveriesSearch := dto.WebhookDeliveriesSearch{
+		Pagination:            *pagination,
+		Status:                status,
+		Test:                  lib_context.Test(ctx),
+		WebhookSubscriptionId: id,
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("webhookDeliveriesSearch", webhookDeliveriesSearch))
+	return &webhookDeliveriesSearch, nil
+}
+
+func parseWebhookDeliveryStatus(r *http.Request) (*string, error) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		return nil, nil
+	}
+	if !lib_strings.Contains(dto.WebhookDeliveryStatuses, status) {
+		return nil, lib_errors.NewCustomf(http.StatusBadRequest, "Invalid status %q", status)
+	}
+	return &status, nil
+}
+
+func (c client) ParseRedeliverWebhookDelivery(r *http.Request) (*dto.WebhookDeliveryRedeliver, error) {
+	ctx := r.Context()
+	lib_log.Info(ctx, "Parsing")
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing id in url params")
+	}
+	deliveryId := chi.URLParam(r, "delivery_id")
+	if deliveryId == "" {
+		return nil, lib_errors.NewCustom(http.StatusBadRequest, "Missing delivery_id in url params")
+	}
+
+	webhookDeliveryRedeliver := dto.WebhookDeliveryRedeliver{
+		Id:                    deliveryId,
+		Test:                  lib_context.Test(ctx),
+		WebhookSubscriptionId: id,
+	}
+
+	lib_log.Info(ctx, "Parsed", lib_log.FmtAny("webhookDeliveryRedeliver", webhookDeliveryRedeliver))
+	return &webhookDeliveryRedeliver, nil
+}
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"car-svc/internal/lib/dto"
+	"net/http"
+	"reflect"
+	"testing"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_parseWebhookDeliveryStatus(t *testing.T) {
+	deadLetter := dto.WebhookDeliveryStatusDeadLetter
+
+	var data = []struct {
+		desc          string
+		input         string
+		expected      *string
+		expectedError bool
+	}{
+		{
+			desc:     "no status",
+			input:    "/",
+			expected: nil,
+		},
+		{
+			desc:     "status",
+			input:    "/?status=DEAD_LETTER",
+			expected: &deadLetter,
+		},
+		{
+			desc:          "invalid status",
+			input:         "/?status=FAILED",
+			expectedError: true,
+		},
+	}
+
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodGet, d.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := parseWebhookDeliveryStatus(req)
+		if d.expectedError {
+			if cerr, ok := err.(lib_errors.Custom); !ok || cerr.Code != http.StatusBadRequest {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   http.StatusBadRequest,
+					Result:     err,
+				}))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, d.expected) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
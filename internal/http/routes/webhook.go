@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"net/http"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_http "github.com/tomwangsvc/lib-svc/http"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// @Summary create webhook subscription
+// @Param Authorization header string true "IAM token"
+// @Param Idempotency-Key header string false "key identifying retries of the same request, the stored response is replayed for retries"
+// @Description subscribe a url to events, each delivery is a POST of the event signed in the X-Car-Svc-Signature header with the HMAC-SHA256 of the X-Car-Svc-Timestamp header, a dot and the body, keyed by the secret
+// @Description See schema file webhook_subscription_create.json for body requirements, deliveries that do not get a 2xx response are retried with exponential backoff and then moved to the DEAD_LETTER status
+// @Success 201
+// @Router /v1/webhook-subscriptions [post]
+func (c client) CreateWebhookSubscription() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Creating")
+
+		webhookSubscriptionCreate, err := c.parserClient.ParseCreateWebhookSubscription(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing create webhook subscription request"))
+			return
+		}
+
+		webhookSubscriptionId, err := c.appClient.CreateWebhookSubscription(ctx, *webhookSubscriptionCreate)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed creating webhook subscription"))
+			return
+		}
+
+		lib_log.Info(ctx, "Created", lib_log.FmtString("webhookSubscriptionId", webhookSubscriptionId))
+		lib_http.RenderCreated(ctx, w, webhookSubscriptionId)
+	}
+}
+
+// @Summary search webhook subscriptions
+// @Param Authorization header string true "IAM token"
+// @Description search webhook subscriptions, the secret is never returned
+// @Success 200
+// @Success 204
+// @Router /v1/webhook-subscriptions [get]
+func (c client) SearchWebhookSubscriptions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Searching")
+
+		webhookSubscriptionsSearch, err := c.parserClient.ParseSearchWebhookSubscriptions(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing search webhook subscriptions request"))
+			return
+		}
+
+		webhookSubscriptionsBytes, pagination, err := c.appClient.SearchWebhookSubscriptions(ctx, *webhookSubscriptionsSearch)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed searching webhook subscriptions"))
+			return
+		}
+
+		if len(webhookSubscriptionsBytes) == 0 {
+			lib_http.RenderNoContent(ctx, w)
+			return
+		}
+
+		lib_log.Info(ctx, "Searched", lib_log.FmtBytes("webhookSubscriptionsBytes", webhookSubscriptionsBytes), lib_log.FmtAny("pagination", pagination))
+		lib_http.RenderJsonBytesWithPagination(ctx, w, webhookSubscriptionsBytes, *pagination)
+	}
+}
+
+// @Summary delete webhook subscription
+// @Param Authorization header string true "IAM token"
+// @Description delete a webhook subscription and its deliveries, pending deliveries are not sent
+// @Success 204
+// @Router /v1/webhook-subscriptions/{webhook_subscription_id} [delete]
+func (c client) DeleteWebhookSubscription() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Deleting")
+
+		webhookSubscriptionDelete, err := c.parserClient.ParseDeleteWebhookSubscription(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing delete webhook subscription request"))
+			return
+		}
+
+		if err := c.appClient.DeleteWebhookSubscription(ctx, *webhookSubscriptionDelete); err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed deleting webhook subscription"))
+			return
+		}
+
+		lib_log.Info(ctx, "Deleted")
+		lib_http.RenderNoContent(ctx, w)
+	}
+}
+
+// @Summary search webhook deliveries
+// @Param Authorization header string true "IAM token"
+// @Param status query string false "PENDING, SUCCEEDED or DEAD_LETTER"
+// @Description search the deliveries of a webhook subscription with the number of attempts and the outcome of the last attempt
+// @Success 200
+// @Success 204
+// @Router /v1/webhook-subscriptions/{webhook_subscription_id}/deliveries [get]
+func (c client) SearchWebhookDeliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Searching")
+
+		webhookDeliveriesSearch, err := c.parserClient.ParseSearchWebhookDeliveries(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing search webhook deliveries request"))
+			return
+		}
+
+		webhookDeliveriesBytes, pagination, err := c.appClient.SearchWebhookDeliveries(ctx, *webhookDeliveriesSearch)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed searching webhook deliveries"))
+			return
+		}
+
+		if len(webhookDeliveriesBytes) == 0 {
+			lib_http.RenderNoContent(ctx, w)
+			return
+		}
+
+		lib_log.Info(ctx, "Searched", lib_log.FmtBytes("webhookDeliveriesBytes", webhookDeliveriesBytes), lib_log.FmtAny("pagination", pagination))
+		lib_http.RenderJsonBytesWithPagination(ctx, w, webhookDeliveriesBytes, *pagination)
+	}
+}
+
+// @Summary redeliver webhook delivery
+// @Param Authorization header string true "IAM token"
+// @Param Idempotency-Key header string false "key identifying retries of the same request, the stored response is replayed for retries"
+// @Description make a delivery pending again with a new set of attempts, e.g. after a partner has fixed its endpoint
+// @Success 204
+// @Router /v1/webhook-subscriptions/{webhook_subscription_id}/deliveries/{webhook_delivery_id}/redeliver [post]
+func (c client) RedeliverWebhookDelivery() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		lib_log.Info(ctx, "Redelivering")
+
+		webhookDeliveryRedeliver, err := c.parserClient.ParseRedeliverWebhookDelivery(r)
+		if err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed parsing redeliver webhook delivery request"))
+			return
+		}
+
+		if err := c.appClient.RedeliverWebhookDelivery(ctx, *webhookDeliveryRedeliver); err != nil {
+			lib_http.RenderError(ctx, w, lib_errors.Wrap(err, "Failed redelivering webhook delivery"))
+			return
+		}
+
+		lib_log.Info(ctx, "Redelivered")
+		lib_http.RenderNoContent(ctx, w)
+	}
+}
@@ -0,0 +1,41 @@
+package actor
+
+import (
+	"car-svc/internal/lib/dto"
+	"context"
+
+	lib_iam "github.com/tomwangsvc/lib-svc/token/iam"
+)
+
+const (
+	Unknown = "unknown"
+)
+
+type contextKey struct{}
+
+// Actor returns the identity that made the request, the identity is recorded against every change it makes
+func Actor(ctx context.Context) string {
+	if v, ok := ctx.Value(contextKey{}).(string); ok && v != "" {
+		return v
+	}
+	return Unknown
+}
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, contextKey{}, actor)
+}
+
+// FromApiKey identifies the partner by the id of its api key, the id is kept when the key is revoked so that changes can still be traced to the partner
+func FromApiKey(apiKey dto.ApiKey) string {
+	return "api_key:" + apiKey.ApiKeyId
+}
+
+// FromClaims prefers the identity of a user over the identity of the client acting on behalf of the user
+func FromClaims(claims lib_iam.Claims) string {
+	for _, v := range []string{claims.Email, claims.IdentityId, claims.ClientName, claims.ClientId, claims.Subject} {
+		if v != "" {
+			return v
+		}
+	}
+	return Unknown
+}
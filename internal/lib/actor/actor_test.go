@@ -0,0 +1,74 @@
+package actor
+
+import (
+	"context"
+	"testing"
+
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+	lib_iam "github.com/tomwangsvc/lib-svc/token/iam"
+)
+
+func Test_FromClaims(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    lib_iam.Claims
+		expected string
+	}{
+		{
+			desc:     "email",
+			input:    lib_iam.Claims{ClientId: "client-id", Email: "tom@example.com", IdentityId: "identity-id"},
+			expected: "tom@example.com",
+		},
+		{
+			desc:     "identity id",
+			input:    lib_iam.Claims{ClientId: "client-id", IdentityId: "identity-id"},
+			expected: "identity-id",
+		},
+		{
+			desc:     "client name",
+			input:    lib_iam.Claims{ClientId: "client-id", ClientName: "client-name"},
+			expected: "client-name",
+		},
+		{
+			desc:     "client id",
+			input:    lib_iam.Claims{ClientId: "client-id"},
+			expected: "client-id",
+		},
+		{
+			desc:     "no identity",
+			input:    lib_iam.Claims{Test: true},
+			expected: Unknown,
+		},
+	}
+
+	for i, d := range data {
+		if result := FromClaims(d.input); result != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_Actor(t *testing.T) {
+	if result := Actor(context.Background()); result != Unknown {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "result",
+			Desc:       "no actor",
+			Expected:   Unknown,
+			Result:     result,
+		}))
+	}
+	if result := Actor(WithActor(context.Background(), "tom@example.com")); result != "tom@example.com" {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "result",
+			Desc:       "actor",
+			Expected:   "tom@example.com",
+			Result:     result,
+		}))
+	}
+}
@@ -0,0 +1,60 @@
+package apikey
+
+import (
+	"car-svc/internal/lib/dto"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+)
+
+const (
+	// AuthorizationScheme is sent in the Authorization header rather than a header of its own so that the key is redacted from request logs like tokens are
+	AuthorizationScheme = "ApiKey"
+
+	keyPrefix       = "carsvc_"
+	keyPrefixLength = len(keyPrefix) + 6
+	keyRandomBytes  = 32
+)
+
+// Generate returns a new key and the prefix that identifies it in listings, the key is only ever known to the partner once it has been returned
+func Generate() (key, prefix string, err error) {
+	b := make([]byte, keyRandomBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", lib_errors.Wrap(err, "Failed reading random bytes")
+	}
+	key = keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:keyPrefixLength], nil
+}
+
+// Hash returns the hash the key is stored and looked up by, a fast hash is enough as the key is random rather than chosen by a person
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// FromAuthorizationHeader returns the key of an Authorization header with the ApiKey scheme, ok is false for any other scheme
+func FromAuthorizationHeader(header http.Header) (key string, ok bool) {
+	w := strings.Split(header.Get("Authorization"), " ")
+	if len(w) != 2 || w[0] != AuthorizationScheme || w[1] == "" {
+		return "", false
+	}
+	return w[1], true
+}
+
+type contextKey struct{}
+
+func WithApiKey(ctx context.Context, apiKey dto.ApiKey) context.Context {
+	return context.WithValue(ctx, contextKey{}, apiKey)
+}
+
+// FromContext returns the api key the request was authenticated with, ok is false when the request was authorized with a token
+func FromContext(ctx context.Context) (apiKey dto.ApiKey, ok bool) {
+	apiKey, ok = ctx.Value(contextKey{}).(dto.ApiKey)
+	return apiKey, ok
+}
@@ -0,0 +1,82 @@
+package apikey
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_Generate(t *testing.T) {
+	key, prefix, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, prefix) || len(prefix) != keyPrefixLength || strings.Contains(key, ".") {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "key",
+			Result:     []string{key, prefix},
+		}))
+	}
+
+	otherKey, _, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherKey == key || Hash(otherKey) == Hash(key) {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "otherKey",
+			Expected:   key,
+			Result:     otherKey,
+		}))
+	}
+}
+
+func Test_FromAuthorizationHeader(t *testing.T) {
+	type expected struct {
+		key string
+		ok  bool
+	}
+	var data = []struct {
+		desc  string
+		input string
+		expected
+	}{
+		{
+			desc: "no header",
+		},
+		{
+			desc:  "bearer token",
+			input: "Bearer token",
+		},
+		{
+			desc:  "missing key",
+			input: "ApiKey ",
+		},
+		{
+			desc:  "api key",
+			input: "ApiKey carsvc_key",
+			expected: expected{
+				key: "carsvc_key",
+				ok:  true,
+			},
+		},
+	}
+
+	for i, d := range data {
+		header := make(http.Header)
+		if d.input != "" {
+			header.Set("Authorization", d.input)
+		}
+		if key, ok := FromAuthorizationHeader(header); key != d.expected.key || ok != d.expected.ok {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     []interface{}{key, ok},
+			}))
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package build
+
+// The metadata of the build is injected at build time, e.g. go build -ldflags "-X car-svc/internal/lib/build.CommitId=$(git rev-parse HEAD)"
+var (
+	CommitId = "unknown"
+	Date     = "unknown"
+	Number   = "unknown"
+)
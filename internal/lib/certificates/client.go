@@ -0,0 +1,132 @@
+package certificates
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+
+	lib_certificates "github.com/tomwangsvc/lib-svc/certificates"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// Config locates the public keys verifying tokens when they are not downloaded from the certificates bucket, e.g. when running locally or in tests
+type Config struct {
+	// JwksFile is a JSON web key set, the kid of each RSA key is the svc id of the issuer it verifies
+	JwksFile string
+	// KeyFile is a PEM encoded public key or certificate, it verifies every required issuer
+	KeyFile  string
+	Required lib_certificates.Required
+}
+
+// NewClient loads the public keys for the required issuers from the key file or the JWKS file, the JWKS file is preferred when both are configured
+func NewClient(ctx context.Context, config Config) (lib_certificates.Client, error) {
+	lib_log.Info(ctx, "Initializing", lib_log.FmtAny("config", config))
+
+	var certificateByIssuer map[string][]byte
+	var err error
+	switch {
+	case config.JwksFile != "":
+		certificateByIssuer, err = readJwksFile(config.JwksFile)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading jwks file")
+		}
+	case config.KeyFile != "":
+		certificateByIssuer, err = readKeyFile(config.KeyFile, config.Required)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading key file")
+		}
+	default:
+		return nil, lib_errors.New("JwksFile or KeyFile in config not supplied, please add a file for the public keys verifying tokens")
+	}
+
+	for _, issuer := range config.Required {
+		if _, ok := certificateByIssuer[issuer]; !ok {
+			return nil, lib_errors.Errorf("No key for required issuer %q", issuer)
+		}
+	}
+
+	lib_log.Info(ctx, "Initialized", lib_log.FmtInt("len(certificateByIssuer)", len(certificateByIssuer)))
+	return client{
+		certificateByIssuer: certificateByIssuer,
+	}, nil
+}
+
+type client struct {
+	certificateByIssuer map[string][]byte
+}
+
+func (c client) ForIssuer(issuer string) ([]byte, error) {
+	if v, ok := c.certificateByIssuer[issuer]; ok {
+		return v, nil
+	}
+	return nil, lib_errors.Errorf("No cert for %q", issuer)
+}
+
+func readKeyFile(keyFile string, required lib_certificates.Required) (map[string][]byte, error) {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading file")
+	}
+	if block, _ := pem.Decode(key); block == nil {
+		return nil, lib_errors.Errorf("No PEM block in %q", keyFile)
+	}
+
+	certificateByIssuer := make(map[string][]byte)
+	for _, issuer := range required {
+		certificateByIssuer[issuer] = key
+	}
+	return certificateByIssuer, nil
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	E   string `json:"e"`
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+}
+
+// readJwksFile converts each RSA key of the set to a PEM encoded public key as that is the format the token clients verify with
+func readJwksFile(jwksFile string) (map[string][]byte, error) {
+	b, err := ioutil.ReadFile(jwksFile)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading file")
+	}
+	var keySet jwks
+	if err := json.Unmarshal(b, &keySet); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed unmarshalling jwks")
+	}
+
+	certificateByIssuer := make(map[string][]byte)
+	for i, v := range keySet.Keys {
+		if v.Kty != "RSA" || v.Kid == "" {
+			return nil, lib_errors.Errorf("Key not recognized at [%d], an RSA key with a kid is required", i)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(v.N)
+		if err != nil {
+			return nil, lib_errors.Wrapf(err, "Failed decoding modulus for %q", v.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(v.E)
+		if err != nil {
+			return nil, lib_errors.Wrapf(err, "Failed decoding exponent for %q", v.Kid)
+		}
+		publicKey, err := x509.MarshalPKIXPublicKey(&rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		})
+		if err != nil {
+			return nil, lib_errors.Wrapf(err, "Failed marshalling public key for %q", v.Kid)
+		}
+		certificateByIssuer[v.Kid] = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+	}
+	return certificateByIssuer, nil
+}
@@ -0,0 +1,122 @@
+package certificates
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	lib_certificates "github.com/tomwangsvc/lib-svc/certificates"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_NewClient(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(keyFile, publicKeyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	jwksFile := filepath.Join(dir, "jwks.json")
+	jwksJson, err := json.Marshal(jwks{Keys: []jwk{{
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		Kid: "iam-svc",
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(jwksFile, jwksJson, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type expected struct {
+		certificate []byte
+		err         bool
+	}
+	var data = []struct {
+		desc   string
+		config Config
+		expected
+	}{
+		{
+			desc:   "no file",
+			config: Config{Required: lib_certificates.Required{"iam-svc"}},
+			expected: expected{
+				err: true,
+			},
+		},
+		{
+			desc:   "key file",
+			config: Config{KeyFile: keyFile, Required: lib_certificates.Required{"iam-svc"}},
+			expected: expected{
+				certificate: publicKeyPem,
+			},
+		},
+		{
+			desc:   "jwks file",
+			config: Config{JwksFile: jwksFile, Required: lib_certificates.Required{"iam-svc"}},
+			expected: expected{
+				certificate: publicKeyPem,
+			},
+		},
+		{
+			desc:   "jwks file missing required issuer",
+			config: Config{JwksFile: jwksFile, Required: lib_certificates.Required{"iam-svc", "car-svc"}},
+			expected: expected{
+				err: true,
+			},
+		},
+	}
+
+	for i, d := range data {
+		client, err := NewClient(context.Background(), d.config)
+		if d.expected.err {
+			if err == nil {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   "err",
+					Result:     nil,
+				}))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		certificate, err := client.ForIssuer("iam-svc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(certificate, d.expected.certificate) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "certificate",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   string(d.expected.certificate),
+				Result:     string(certificate),
+			}))
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	lib_env "github.com/tomwangsvc/lib-svc/env"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+)
+
+const (
+	// FileEnv and FileFlag locate the optional JSON config file, its keys are the json tags of Settings
+	FileEnv  = "CONFIG_FILE"
+	FileFlag = "config"
+)
+
+// Settings are the settings that differ between deployments of the service.
+// Each setting is read from the config file, its environment variable and its flag, a later source overrides an earlier one.
+type Settings struct {
+	Env              string `env:"ENV" flag:"env" json:"env" usage:"environment of the service, dev, stg, uat or prd"`
+	GcpProjectId     string `env:"GOOGLE_CLOUD_PROJECT,GCP_PROJECT_ID" flag:"gcp-project-id" json:"gcp_project_id" usage:"id of the GCP project"`
+	GcpProjectNumber string `env:"GCP_PROJECT_NUMBER" flag:"gcp-project-number" json:"gcp_project_number" usage:"number of the GCP project"`
+
+	// Local runs the service without the GCP services other than Spanner, events are kept in memory and the keys verifying IAM tokens are read from IamJwksFile or IamKeyFile
+	Local       bool   `env:"LOCAL" flag:"local" json:"local" usage:"run without GCP services other than Spanner"`
+	IamJwksFile string `env:"IAM_JWKS_FILE" flag:"iam-jwks-file" json:"iam_jwks_file" usage:"JSON web key set verifying IAM tokens when running locally"`
+	IamKeyFile  string `env:"IAM_KEY_FILE" flag:"iam-key-file" json:"iam_key_file" usage:"PEM public key verifying IAM tokens when running locally"`
+
+	Port int `env:"PORT" flag:"port" json:"port" usage:"port the HTTP server listens on"`
+	// MetricsPort is not routed to by Cloud Run, the metrics are scraped over localhost by the sidecar deployed with the service
+	MetricsPort int `env:"METRICS_PORT" flag:"metrics-port" json:"metrics_port" usage:"port the metrics server listens on, metrics are not served when it is 0"`
+
+	// PostgresDataSourceName and SpannerInMemory replace Spanner with another implementation of the spanner client
+	PostgresDataSourceName string `env:"POSTGRES_DATA_SOURCE_NAME" flag:"postgres-data-source-name" json:"postgres_data_source_name" usage:"PostgreSQL database used instead of Spanner"`
+	SpannerInMemory        bool   `env:"SPANNER_IN_MEMORY" flag:"spanner-in-memory" json:"spanner_in_memory" usage:"keep the tables in memory instead of Spanner"`
+
+	SpannerDatabaseId   string `env:"SPANNER_DATABASE_ID" flag:"spanner-database-id" json:"spanner_database_id" usage:"id of the Spanner database"`
+	SpannerEmulatorHost string `env:"SPANNER_EMULATOR_HOST" flag:"spanner-emulator-host" json:"spanner_emulator_host" usage:"host:port of the Spanner emulator"`
+	SpannerInstanceId   string `env:"SPANNER_INSTANCE_ID" flag:"spanner-instance-id" json:"spanner_instance_id" usage:"id of the Spanner instance"`
+
+	// The session pool settings are those of spanner.SessionPoolConfig, a MaxOpened of 0 is the default of the spanner client
+	SpannerSessionPoolMaxIdle       uint64  `env:"SPANNER_SESSION_POOL_MAX_IDLE" flag:"spanner-session-pool-max-idle" json:"spanner_session_pool_max_idle" usage:"sessions kept idle in the Spanner session pool"`
+	SpannerSessionPoolMaxOpened     uint64  `env:"SPANNER_SESSION_POOL_MAX_OPENED" flag:"spanner-session-pool-max-opened" json:"spanner_session_pool_max_opened" usage:"maximum sessions of the Spanner session pool"`
+	SpannerSessionPoolMinOpened     uint64  `env:"SPANNER_SESSION_POOL_MIN_OPENED" flag:"spanner-session-pool-min-opened" json:"spanner_session_pool_min_opened" usage:"sessions opened by the Spanner session pool at startup"`
+	SpannerSessionPoolWriteSessions float64 `env:"SPANNER_SESSION_POOL_WRITE_SESSIONS" flag:"spanner-session-pool-write-sessions" json:"spanner_session_pool_write_sessions" usage:"fraction of the Spanner session pool prepared for writes"`
+}
+
+// Load returns the defaults overridden by the config file, the environment and the flags of the args, the flags are registered on the flag set so that a command can add its own.
+// The settings are validated, every invalid setting is reported in the error.
+func Load(flagSet *flag.FlagSet, args []string, defaults Settings) (*Settings, error) {
+	file := flagSet.String(FileFlag, "", fmt.Sprintf("JSON config file, defaults to the environment variable %s", FileEnv))
+	flagByName := make(map[string]*settingFlag)
+	forEachSetting(&defaults, func(field reflect.StructField, _ reflect.Value) {
+		f := &settingFlag{bool: field.Type.Kind() == reflect.Bool}
+		flagSet.Var(f, field.Tag.Get("flag"), field.Tag.Get("usage"))
+		flagByName[field.Tag.Get("flag")] = f
+	})
+	if err := flagSet.Parse(args); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing flags")
+	}
+
+	settings := defaults
+	if *file == "" {
+		*file = os.Getenv(FileEnv)
+	}
+	if *file != "" {
+		if err := readFile(*file, &settings); err != nil {
+			return nil, lib_errors.Wrapf(err, "Failed reading config file %q", *file)
+		}
+	}
+
+	var err error
+	forEachSetting(&settings, func(field reflect.StructField, value reflect.Value) {
+		if err != nil {
+			return
+		}
+		for _, name := range strings.Split(field.Tag.Get("env"), ",") {
+			if v := os.Getenv(name); v != "" {
+				if err = set(value, v); err != nil {
+					err = lib_errors.Wrapf(err, "Failed setting environment variable %s", name)
+					return
+				}
+				break
+			}
+		}
+		if f := flagByName[field.Tag.Get("flag")]; f.set {
+			if err = set(value, f.value); err != nil {
+				err = lib_errors.Wrapf(err, "Failed setting flag %s", field.Tag.Get("flag"))
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := settings.Validate(); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed validating settings")
+	}
+	return &settings, nil
+}
+
+func readFile(file string, settings *Settings) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return lib_errors.Wrap(err, "Failed reading file")
+	}
+	// Unknown keys are rejected so that a misspelt setting is not silently ignored
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(settings); err != nil {
+		return lib_errors.Wrap(err, "Failed decoding file")
+	}
+	return nil
+}
+
+func forEachSetting(settings *Settings, f func(field reflect.StructField, value reflect.Value)) {
+	v := reflect.ValueOf(settings).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f(v.Type().Field(i), v.Field(i))
+	}
+}
+
+func set(value reflect.Value, s string) error {
+	switch value.Kind() {
+	case reflect.Bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return lib_errors.Wrapf(err, "Failed parsing %q as bool", s)
+		}
+		value.SetBool(v)
+	case reflect.Float64:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return lib_errors.Wrapf(err, "Failed parsing %q as float", s)
+		}
+		value.SetFloat(v)
+	case reflect.Int:
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return lib_errors.Wrapf(err, "Failed parsing %q as int", s)
+		}
+		value.SetInt(int64(v))
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Uint64:
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return lib_errors.Wrapf(err, "Failed parsing %q as unsigned int", s)
+		}
+		value.SetUint(v)
+	default:
+		return lib_errors.Errorf("Setting of kind %s not supported", value.Kind())
+	}
+	return nil
+}
+
+// settingFlag records whether the flag was set, so that a flag that is not set does not override the other sources
+type settingFlag struct {
+	bool  bool
+	set   bool
+	value string
+}
+
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.bool
+}
+
+func (f *settingFlag) Set(s string) error {
+	f.set = true
+	f.value = s
+	return nil
+}
+
+func (f *settingFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+// Validate reports every invalid setting in the error, so that a deployment is fixed in one go
+//
+//revive:disable:cyclomatic
+func (s Settings) Validate() error {
+	var problems []string
+	switch s.Env {
+	case lib_env.Dev, lib_env.Prd, lib_env.Stg, lib_env.Uat:
+	default:
+		problems = append(problems, fmt.Sprintf("env %q is not dev, stg, uat or prd", s.Env))
+	}
+	if s.GcpProjectId == "" {
+		problems = append(problems, "gcp_project_id is missing")
+	}
+	if s.GcpProjectNumber == "" {
+		problems = append(problems, "gcp_project_number is missing")
+	}
+	if s.Local && s.IamJwksFile == "" && s.IamKeyFile == "" {
+		problems = append(problems, "iam_jwks_file or iam_key_file is required when running locally")
+	}
+	if s.Port < 0 || s.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port %d is out of range", s.Port))
+	}
+	if s.MetricsPort < 0 || s.MetricsPort > 65535 {
+		problems = append(problems, fmt.Sprintf("metrics_port %d is out of range", s.MetricsPort))
+	} else if s.MetricsPort != 0 && s.MetricsPort == s.Port {
+		problems = append(problems, fmt.Sprintf("metrics_port %d is the port of the HTTP server", s.MetricsPort))
+	}
+	if s.PostgresDataSourceName != "" && s.SpannerInMemory {
+		problems = append(problems, "postgres_data_source_name and spanner_in_memory are exclusive")
+	}
+	if s.SpannerEmulatorHost != "" {
+		if _, _, err := net.SplitHostPort(s.SpannerEmulatorHost); err != nil {
+			problems = append(problems, fmt.Sprintf("spanner_emulator_host %q is not host:port", s.SpannerEmulatorHost))
+		}
+		if s.Env == lib_env.Prd {
+			problems = append(problems, "spanner_emulator_host is not allowed in prd")
+		}
+	}
+	if s.SpannerSessionPoolMaxOpened > 0 && s.SpannerSessionPoolMinOpened > s.SpannerSessionPoolMaxOpened {
+		problems = append(problems, fmt.Sprintf("spanner_session_pool_min_opened %d is greater than spanner_session_pool_max_opened %d", s.SpannerSessionPoolMinOpened, s.SpannerSessionPoolMaxOpened))
+	}
+	if s.SpannerSessionPoolWriteSessions < 0 || s.SpannerSessionPoolWriteSessions > 1 {
+		problems = append(problems, fmt.Sprintf("spanner_session_pool_write_sessions %g is not between 0 and 1", s.SpannerSessionPoolWriteSessions))
+	}
+
+	if len(problems) > 0 {
+		return lib_errors.Errorf("Invalid settings: %s", strings.Join(problems, "; "))
+	}
+	return nil
+	//revive:enable:cyclomatic
+}
+
+// Export sets the environment variables read by lib_env and the spanner client to the settings, so that a setting from the config file or a flag has the effect of its environment variable
+func (s Settings) Export() error {
+	variables := map[string]string{
+		"ENV":                   s.Env,
+		"GCP_PROJECT_ID":        s.GcpProjectId,
+		"GCP_PROJECT_NUMBER":    s.GcpProjectNumber,
+		"GOOGLE_CLOUD_PROJECT":  s.GcpProjectId,
+		"SPANNER_DATABASE_ID":   s.SpannerDatabaseId,
+		"SPANNER_EMULATOR_HOST": s.SpannerEmulatorHost,
+		"SPANNER_INSTANCE_ID":   s.SpannerInstanceId,
+	}
+	if s.Port != 0 {
+		variables["PORT"] = strconv.Itoa(s.Port)
+	}
+	for k, v := range variables {
+		if v == "" {
+			continue
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return lib_errors.Wrapf(err, "Failed setting environment variable %s", k)
+		}
+	}
+	return nil
+}
+
+// SpannerClientConfig is the client config of lib_spanner with the session pool settings applied, MinOpened is 0 on localhost as it is in lib_spanner
+func (s Settings) SpannerClientConfig(env lib_env.Env) spanner.ClientConfig {
+	clientConfig := lib_spanner.ClientConfigWithMinOpened(env, int(s.SpannerSessionPoolMinOpened))
+	clientConfig.SessionPoolConfig.MaxIdle = s.SpannerSessionPoolMaxIdle
+	clientConfig.SessionPoolConfig.MaxOpened = s.SpannerSessionPoolMaxOpened
+	clientConfig.SessionPoolConfig.WriteSessions = s.SpannerSessionPoolWriteSessions
+	return clientConfig
+}
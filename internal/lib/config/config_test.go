@@ -0,0 +1,250 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_Load(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(file, []byte(`{"env":"uat","gcp_project_id":"car-uat","gcp_project_number":"1","spanner_session_pool_max_opened":50}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fileUnknownKey := filepath.Join(dir, "config_unknown_key.json")
+	if err := ioutil.WriteFile(fileUnknownKey, []byte(`{"env":"uat","spaner_instance_id":"car"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := Settings{SpannerSessionPoolMinOpened: 10}
+
+	type input struct {
+		args []string
+		env  map[string]string
+	}
+	type expected struct {
+		settings *Settings
+		err      bool
+	}
+	var data = []struct {
+		desc string
+		input
+		expected
+	}{
+		{
+			desc: "defaults overridden by env",
+			input: input{
+				env: map[string]string{"ENV": "dev", "GCP_PROJECT_ID": "car-dev", "GCP_PROJECT_NUMBER": "1", "SPANNER_EMULATOR_HOST": "localhost:9010"},
+			},
+			expected: expected{settings: &Settings{Env: "dev", GcpProjectId: "car-dev", GcpProjectNumber: "1", SpannerEmulatorHost: "localhost:9010", SpannerSessionPoolMinOpened: 10}},
+		},
+		{
+			desc: "GOOGLE_CLOUD_PROJECT preferred to GCP_PROJECT_ID",
+			input: input{
+				env: map[string]string{"ENV": "dev", "GCP_PROJECT_ID": "car-dev", "GOOGLE_CLOUD_PROJECT": "car-cloud-run", "GCP_PROJECT_NUMBER": "1"},
+			},
+			expected: expected{settings: &Settings{Env: "dev", GcpProjectId: "car-cloud-run", GcpProjectNumber: "1", SpannerSessionPoolMinOpened: 10}},
+		},
+		{
+			desc: "file overridden by env overridden by flags",
+			input: input{
+				args: []string{"-config", file, "-spanner-session-pool-min-opened", "20", "-local", "-iam-key-file", "key.pem"},
+				env:  map[string]string{"ENV": "stg", "SPANNER_SESSION_POOL_MIN_OPENED": "30"},
+			},
+			expected: expected{settings: &Settings{Env: "stg", GcpProjectId: "car-uat", GcpProjectNumber: "1", IamKeyFile: "key.pem", Local: true, SpannerSessionPoolMaxOpened: 50, SpannerSessionPoolMinOpened: 20}},
+		},
+		{
+			desc: "file from env",
+			input: input{
+				env: map[string]string{FileEnv: file},
+			},
+			expected: expected{settings: &Settings{Env: "uat", GcpProjectId: "car-uat", GcpProjectNumber: "1", SpannerSessionPoolMaxOpened: 50, SpannerSessionPoolMinOpened: 10}},
+		},
+		{
+			desc: "unknown key in file",
+			input: input{
+				args: []string{"-config", fileUnknownKey},
+			},
+			expected: expected{err: true},
+		},
+		{
+			desc: "invalid env variable",
+			input: input{
+				env: map[string]string{"ENV": "dev", "GCP_PROJECT_ID": "car-dev", "GCP_PROJECT_NUMBER": "1", "PORT": "http"},
+			},
+			expected: expected{err: true},
+		},
+		{
+			desc: "invalid settings",
+			input: input{
+				args: []string{"-env", "prd", "-gcp-project-id", "car-prd", "-gcp-project-number", "1", "-spanner-emulator-host", "localhost:9010"},
+			},
+			expected: expected{err: true},
+		},
+	}
+
+	for i, d := range data {
+		restoreEnv := setEnv(d.input.env)
+		settings, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), d.input.args, defaults)
+		restoreEnv()
+		if (err != nil) != d.expected.err {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.err,
+				Result:     err,
+			}))
+			continue
+		}
+
+		if !reflect.DeepEqual(settings, d.expected.settings) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "settings",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.settings,
+				Result:     settings,
+			}))
+		}
+	}
+}
+
+func Test_Settings_Validate(t *testing.T) {
+	valid := Settings{Env: "dev", GcpProjectId: "car-dev", GcpProjectNumber: "1"}
+
+	type expected struct {
+		err      bool
+		problems []string
+	}
+	var data = []struct {
+		desc  string
+		input func(Settings) Settings
+		expected
+	}{
+		{
+			desc:  "valid",
+			input: func(s Settings) Settings { return s },
+		},
+		{
+			desc: "valid with emulator and session pool",
+			input: func(s Settings) Settings {
+				s.SpannerEmulatorHost = "localhost:9010"
+				s.SpannerSessionPoolMaxOpened = 100
+				s.SpannerSessionPoolMinOpened = 100
+				s.SpannerSessionPoolWriteSessions = 0.2
+				return s
+			},
+		},
+		{
+			desc: "every problem reported",
+			input: func(s Settings) Settings {
+				s.Env = "test"
+				s.GcpProjectId = ""
+				s.Local = true
+				s.Port = 70000
+				return s
+			},
+			expected: expected{err: true, problems: []string{"env", "gcp_project_id", "iam_jwks_file", "port"}},
+		},
+		{
+			desc: "metrics port of the HTTP server",
+			input: func(s Settings) Settings {
+				s.MetricsPort = 8080
+				s.Port = 8080
+				return s
+			},
+			expected: expected{err: true, problems: []string{"metrics_port"}},
+		},
+		{
+			desc: "emulator host without port",
+			input: func(s Settings) Settings {
+				s.SpannerEmulatorHost = "localhost"
+				return s
+			},
+			expected: expected{err: true, problems: []string{"spanner_emulator_host"}},
+		},
+		{
+			desc: "in memory and postgres",
+			input: func(s Settings) Settings {
+				s.PostgresDataSourceName = "postgres://localhost/car_svc"
+				s.SpannerInMemory = true
+				return s
+			},
+			expected: expected{err: true, problems: []string{"postgres_data_source_name"}},
+		},
+		{
+			desc: "session pool",
+			input: func(s Settings) Settings {
+				s.SpannerSessionPoolMaxOpened = 10
+				s.SpannerSessionPoolMinOpened = 20
+				s.SpannerSessionPoolWriteSessions = 1.5
+				return s
+			},
+			expected: expected{err: true, problems: []string{"spanner_session_pool_min_opened", "spanner_session_pool_write_sessions"}},
+		},
+	}
+
+	for i, d := range data {
+		err := d.input(valid).Validate()
+		if (err != nil) != d.expected.err {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.err,
+				Result:     err,
+			}))
+			continue
+		}
+
+		for _, problem := range d.expected.problems {
+			if !strings.Contains(err.Error(), problem) {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   problem,
+					Result:     err,
+				}))
+			}
+		}
+	}
+}
+
+// setEnv unsets the environment variables of the settings and sets the given ones, the returned func restores the environment
+func setEnv(env map[string]string) func() {
+	previous := make(map[string]*string)
+	names := []string{FileEnv}
+	forEachSetting(&Settings{}, func(field reflect.StructField, _ reflect.Value) {
+		names = append(names, strings.Split(field.Tag.Get("env"), ",")...)
+	})
+	for _, name := range names {
+		if v, ok := os.LookupEnv(name); ok {
+			previous[name] = &v
+		} else {
+			previous[name] = nil
+		}
+		os.Unsetenv(name)
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+
+	return func() {
+		for name, v := range previous {
+			if v == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *v)
+			}
+		}
+	}
+}
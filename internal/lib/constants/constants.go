@@ -1,5 +1,47 @@
 package constants
 
 const (
-	UnprocessableEntityAccessForbiddenByTest = "ACCESS_FORBIDDEN_BY_TEST"
+	ContentTypeCsv         = "text/csv"
+	ContentTypeEventStream = "text/event-stream"
+	ContentTypeNdjson      = "application/x-ndjson"
+)
+
+const (
+	BadRequestAsOfOutsideVersionRetention = "AS_OF_OUTSIDE_VERSION_RETENTION"
+	BadRequestFieldNotRecognized          = "FIELD_NOT_RECOGNIZED"
+	BadRequestIdempotencyKeyTooLong       = "IDEMPOTENCY_KEY_TOO_LONG"
+	BadRequestMalformedAsOf               = "MALFORMED_AS_OF"
+	BadRequestMalformedImport             = "MALFORMED_IMPORT"
+	BadRequestMalformedImportRow          = "MALFORMED_IMPORT_ROW"
+	BadRequestMalformedPatch              = "MALFORMED_PATCH"
+	BadRequestMalformedSince              = "MALFORMED_SINCE"
+	BadRequestMalformedWait               = "MALFORMED_WAIT"
+
+	ConflictCarChangedEarlierInBatch = "CAR_CHANGED_EARLIER_IN_BATCH"
+	ConflictCustomerBlocked          = "CUSTOMER_BLOCKED"
+	ConflictDuplicateImportRow       = "DUPLICATE_IMPORT_ROW"
+	ConflictIdempotencyKeyInProgress = "IDEMPOTENCY_KEY_IN_PROGRESS"
+
+	ForbiddenBranchOutOfScope    = "BRANCH_OUT_OF_SCOPE"
+	ForbiddenPermissionDenied    = "PERMISSION_DENIED"
+	ForbiddenTenantNotRecognized = "TENANT_NOT_RECOGNIZED"
+	ForbiddenTenantOutOfScope    = "TENANT_OUT_OF_SCOPE"
+
+	PreconditionFailedModifiedSince = "MODIFIED_SINCE"
+
+	PreconditionRequiredIfUnmodifiedSince = "IF_UNMODIFIED_SINCE_REQUIRED"
+
+	ServiceUnavailableDependencyFailed = "DEPENDENCY_FAILED"
+	ServiceUnavailableDraining         = "DRAINING"
+
+	TooManyRequestsQuotaExceeded     = "QUOTA_EXCEEDED"
+	TooManyRequestsRateLimitExceeded = "RATE_LIMIT_EXCEEDED"
+
+	UnprocessableEntityAccessForbiddenByTest                    = "ACCESS_FORBIDDEN_BY_TEST"
+	UnprocessableEntityApiKeyRevokedOrExpired                   = "API_KEY_REVOKED_OR_EXPIRED"
+	UnprocessableEntityIdempotencyKeyReusedWithDifferentRequest = "IDEMPOTENCY_KEY_REUSED_WITH_DIFFERENT_REQUEST"
+	UnprocessableEntityPatchCannotBeApplied                     = "PATCH_CANNOT_BE_APPLIED"
+	UnprocessableEntityPatchChangesReadOnlyField                = "PATCH_CHANGES_READ_ONLY_FIELD"
+	UnprocessableEntityPatchRemovesRequiredField                = "PATCH_REMOVES_REQUIRED_FIELD"
+	UnprocessableEntityRevertToDeletedVersion                   = "REVERT_TO_DELETED_VERSION"
 )
@@ -0,0 +1,38 @@
+package drain
+
+import (
+	"sync"
+)
+
+// Drain is started when the service begins shutting down, readiness fails and long running requests end from then on so that in-flight requests drain
+type Drain struct {
+	done chan struct{}
+	once sync.Once
+}
+
+func New() *Drain {
+	return &Drain{
+		done: make(chan struct{}),
+	}
+}
+
+// Start starts the drain, it is safe to call more than once
+func (d *Drain) Start() {
+	d.once.Do(func() {
+		close(d.done)
+	})
+}
+
+// Done is closed when the drain starts
+func (d *Drain) Done() <-chan struct{} {
+	return d.done
+}
+
+func (d *Drain) Draining() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
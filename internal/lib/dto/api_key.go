@@ -0,0 +1,79 @@
+package dto
+
+import (
+	"time"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+// ApiKey is the api key a partner authenticated with, its scopes are the permissions it is granted and its limits are applied to every request made with it
+type ApiKey struct {
+	ApiKeyId          string
+	Burst             int64
+	DailyQuota        int64
+	LineageApiKeyId   string // The key the key was rotated from first, the keys of a lineage share their limits
+	Name              string
+	RequestsPerSecond float64
+	Scopes            []string
+	TenantId          string
+	Test              bool
+}
+
+type ApiKeyCreate struct {
+	KeyHash   string
+	KeyPrefix string
+	Test      bool
+	UserInput ApiKeyCreateUserInput
+}
+
+type ApiKeyCreateUserInput struct {
+	Burst             int64     `json:"burst"`
+	DailyQuota        int64     `json:"daily_quota"`
+	DateExpires       time.Time `json:"date_expires"`
+	Name              string    `json:"name"`
+	RequestsPerSecond float64   `json:"requests_per_second"`
+	Scopes            []string  `json:"scopes"`
+}
+
+// ApiKeyCreated holds the key in plain text, it is only ever returned when the key is created or rotated as only its hash is stored
+type ApiKeyCreated struct {
+	ApiKeyId string `json:"api_key_id"`
+	Key      string `json:"key"`
+}
+
+// Fmt implements lib_log.Formatter so that the key is never logged, including when the response is logged
+func (a ApiKeyCreated) Fmt(m lib_log.Marshal) ([]byte, error) {
+	b, err := m(a)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed marshalling api key created")
+	}
+	return lib_json.ApplyRedactions(b, map[string]lib_json.Redaction{"key": lib_json.DefaultRedaction})
+}
+
+type ApiKeysSearch struct {
+	Pagination lib_pagination.Pagination
+	Test       bool
+}
+
+// ApiKeyRotate replaces the key with a new one, the old key keeps working until the overlap has elapsed so that the partner can switch without downtime
+type ApiKeyRotate struct {
+	Id        string
+	KeyHash   string
+	KeyPrefix string
+	Overlap   time.Duration
+	Test      bool
+	UserInput ApiKeyRotateUserInput
+}
+
+type ApiKeyRotateUserInput struct {
+	DateExpires    time.Time `json:"date_expires"`
+	OverlapSeconds *int64    `json:"overlap_seconds,omitempty"`
+}
+
+type ApiKeyRevoke struct {
+	Id   string
+	Test bool
+}
@@ -1,40 +1,71 @@
 package dto
 
 import (
+	"encoding/json"
+	"time"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
 	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
 	lib_search "github.com/tomwangsvc/lib-svc/search"
 )
 
+// CarFields are the json fields of a car that can be requested with the fields query param, they are those of spanner.Car
+var CarFields = []string{"branch_id", "brand_name", "car_id", "date_created", "date_deleted", "date_updated", "model_name", "test"}
+
+func IsCarField(field string) bool {
+	for _, v := range CarFields {
+		if v == field {
+			return true
+		}
+	}
+	return false
+}
+
 type CarCreate struct {
-	UserInput CarCreateUserInput
-	Test      bool
+	IdempotencyKey *IdempotencyKey
+	UserInput      CarCreateUserInput
+	Test           bool
 }
 
 type CarCreateUserInput struct {
-	BrandName string `json:"brand_name"`
-	ModelName string `json:"model_name"`
+	BranchId  *string `json:"branch_id,omitempty"`
+	BrandName string  `json:"brand_name"`
+	ModelName string  `json:"model_name"`
 }
 
 type CarsSearch struct {
+	AsOf            *time.Time
+	Fields          []string
 	Filters         CarsSearchFilters
 	IntegrationTest bool
 	Pagination      lib_pagination.Pagination
 }
 
 type CarsSearchFilters struct {
-	LinkedFilters []lib_search.LinkedFilter
-	Test          bool `json:"test"`
+	IncludeDeleted bool
+	LinkedFilters  []lib_search.LinkedFilter
+	Test           bool `json:"test"`
+}
+
+type CarsExport struct {
+	ContentType string
+	Fields      []string
+	Filters     CarsSearchFilters
 }
 
 type CarRead struct {
+	AsOf                  *time.Time
+	Fields                []string
 	Id                    string
+	IncludeDeleted        bool
 	IntegrationTest, Test bool
 }
 
 type CarUpdate struct {
-	Id        string
-	UserInput CarUpdateUserInput
-	Test      bool
+	Id                string
+	IfUnmodifiedSince *time.Time
+	UserInput         CarUpdateUserInput
+	Test              bool
 }
 
 type CarUpdateUserInput struct {
@@ -42,7 +73,94 @@ type CarUpdateUserInput struct {
 	ModelName *string `json:"model_name,omitempty"`
 }
 
+type CarPatch struct {
+	ContentType string
+	Id          string
+	Patch       []byte
+	Test        bool
+}
+
 type CarDelete struct {
 	Id   string
 	Test bool
 }
+
+type CarRestore struct {
+	Id   string
+	Test bool
+}
+
+const (
+	CarHistoryOperationCreate  = "CREATE"
+	CarHistoryOperationDelete  = "DELETE"
+	CarHistoryOperationPatch   = "PATCH"
+	CarHistoryOperationRestore = "RESTORE"
+	CarHistoryOperationRevert  = "REVERT"
+	CarHistoryOperationUpdate  = "UPDATE"
+)
+
+type CarHistorySearch struct {
+	CarId      string
+	Pagination lib_pagination.Pagination
+	Test       bool
+}
+
+type CarRevert struct {
+	Id                string
+	IfUnmodifiedSince *time.Time
+	UserInput         CarRevertUserInput
+	Test              bool
+}
+
+type CarRevertUserInput struct {
+	CarHistoryId *string    `json:"car_history_id,omitempty"`
+	Date         *time.Time `json:"date,omitempty"`
+}
+
+const (
+	EventTypeCarCreated  = "car.created"
+	EventTypeCarDeleted  = "car.deleted"
+	EventTypeCarRestored = "car.restored"
+	EventTypeCarUpdated  = "car.updated"
+)
+
+// Event is the message published for a change committed to the database, consumers should de-duplicate by event id as events are delivered at least once
+type Event struct {
+	AggregateId string          `json:"aggregate_id"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	DateCreated time.Time       `json:"date_created"`
+	EventId     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	TenantId    string          `json:"tenant_id"`
+	Test        bool            `json:"test"`
+}
+
+const (
+	CarsBatchModeAllOrNothing = "ALL_OR_NOTHING"
+	CarsBatchModeBestEffort   = "BEST_EFFORT"
+
+	// CarsBatchMaxOperations is the maxItems of the operations of schema/cars_batch.json, an all or nothing batch commits the car, history and outbox mutations of every operation at once and must stay within the mutations a Spanner commit allows
+	CarsBatchMaxOperations = 100
+)
+
+type CarsBatch struct {
+	IdempotencyKey *IdempotencyKey
+	Mode           string
+	Operations     []CarsBatchOperation
+	Test           bool
+}
+
+// CarsBatchOperation holds exactly one of CarCreate, CarUpdate and CarDelete, or the Error from parsing the operation when the batch is best effort
+type CarsBatchOperation struct {
+	CarCreate *CarCreate
+	CarDelete *CarDelete
+	CarUpdate *CarUpdate
+	Error     error
+}
+
+type CarsBatchResult struct {
+	CarId  string            `json:"car_id,omitempty"`
+	Errors []lib_errors.Item `json:"errors,omitempty"`
+	Index  int               `json:"index"`
+	Status int               `json:"status"`
+}
@@ -0,0 +1,34 @@
+package dto
+
+import (
+	"time"
+
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+type CarChangesRead struct {
+	Pagination lib_pagination.Pagination
+	Since      *CarChangesToken
+	Stream     bool
+	Test       bool
+	Wait       time.Duration
+}
+
+// CarChangesToken is the position in the changes feed after a change, changes are ordered by the commit timestamp of the change and then by car history id
+type CarChangesToken struct {
+	CarHistoryId string
+	DateCreated  time.Time
+}
+
+type CarChange struct {
+	CarHistoryId string    `json:"car_history_id"`
+	CarId        string    `json:"car_id"`
+	DateCreated  time.Time `json:"date_created"`
+	Operation    string    `json:"operation"`
+}
+
+type CarChanges struct {
+	Changes   []CarChange     `json:"changes"`
+	Next      CarChangesToken `json:"-"`
+	NextSince string          `json:"next_since"`
+}
@@ -1 +1,20 @@
 package dto
+
+import "time"
+
+const (
+	EventTypeRentalCancelled = "rental.cancelled"
+	EventTypeRentalCreated   = "rental.created"
+)
+
+type CarCustomerAssociationCreate struct {
+	CarId     string
+	UserInput CarCustomerAssociationCreateUserInput
+	Test      bool
+}
+
+type CarCustomerAssociationCreateUserInput struct {
+	CustomerId      string    `json:"customer_id"`
+	DateRentalEnd   time.Time `json:"date_rental_end"`
+	DateRentalStart time.Time `json:"date_rental_start"`
+}
@@ -0,0 +1,44 @@
+package dto
+
+import (
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+)
+
+type CarsImport struct {
+	Format string
+	Rows   []CarsImportRow
+	Test   bool
+}
+
+// CarsImportRow holds the car of a row as a JSON object, or the Error from decoding the row
+type CarsImportRow struct {
+	Body   []byte
+	Error  error
+	Number int
+}
+
+// CarsImportCar is a row that has been validated and normalized and is ready to be created
+type CarsImportCar struct {
+	CarCreate CarCreate
+	Number    int
+}
+
+type CarsImportReport struct {
+	CarsImportId string                `json:"cars_import_id"`
+	Rows         []CarsImportReportRow `json:"rows"`
+	RowsFailed   int                   `json:"rows_failed"`
+	RowsImported int                   `json:"rows_imported"`
+	RowsTotal    int                   `json:"rows_total"`
+}
+
+type CarsImportReportRow struct {
+	CarId  string            `json:"car_id,omitempty"`
+	Errors []lib_errors.Item `json:"errors,omitempty"`
+	Number int               `json:"number"`
+	Status int               `json:"status"`
+}
+
+type CarsImportReportRead struct {
+	Id   string
+	Test bool
+}
@@ -1 +1,18 @@
 package dto
+
+const (
+	EventTypeCustomerBlocked = "customer.blocked"
+	EventTypeCustomerDeleted = "customer.deleted"
+)
+
+// CustomerEvent is a customer lifecycle event pushed by customer-svc, the pubsub message id is recorded when it is consumed so that redeliveries have no effect
+type CustomerEvent struct {
+	CustomerId      string
+	EventType       string
+	PubsubMessageId string
+	Test            bool
+}
+
+type CustomerRead struct {
+	Id string
+}
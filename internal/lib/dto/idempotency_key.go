@@ -0,0 +1,13 @@
+package dto
+
+type IdempotencyKey struct {
+	Key         string
+	RequestHash string
+}
+
+// IdempotentResponse is the response stored against an idempotency key so that it can be replayed for retries
+type IdempotentResponse struct {
+	Body       []byte
+	Location   string
+	StatusCode int
+}
@@ -0,0 +1,62 @@
+package dto
+
+import (
+	"time"
+
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+const (
+	WebhookDeliveryStatusDeadLetter = "DEAD_LETTER"
+	WebhookDeliveryStatusPending    = "PENDING"
+	WebhookDeliveryStatusSucceeded  = "SUCCEEDED"
+)
+
+var (
+	WebhookDeliveryStatuses = []string{WebhookDeliveryStatusDeadLetter, WebhookDeliveryStatusPending, WebhookDeliveryStatusSucceeded}
+
+	// WebhookEventTypes are the event types that can be subscribed to, rental events will be added when rentals are written by this service
+	WebhookEventTypes = []string{EventTypeCarCreated, EventTypeCarDeleted, EventTypeCarRestored, EventTypeCarUpdated}
+)
+
+type WebhookSubscriptionCreate struct {
+	UserInput WebhookSubscriptionCreateUserInput
+	Test      bool
+}
+
+type WebhookSubscriptionCreateUserInput struct {
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+	Url        string   `json:"url"`
+}
+
+type WebhookSubscriptionsSearch struct {
+	Pagination lib_pagination.Pagination
+	Test       bool
+}
+
+type WebhookSubscriptionDelete struct {
+	Id   string
+	Test bool
+}
+
+type WebhookDeliveriesSearch struct {
+	Pagination            lib_pagination.Pagination
+	Status                *string
+	Test                  bool
+	WebhookSubscriptionId string
+}
+
+type WebhookDeliveryRedeliver struct {
+	Id                    string
+	Test                  bool
+	WebhookSubscriptionId string
+}
+
+// WebhookDeliveryAttempt is the outcome of sending a delivery, the delivery is pending again at DateNextAttempt unless it succeeded or was moved to the dead letter status
+type WebhookDeliveryAttempt struct {
+	DateNextAttempt    *time.Time
+	Error              *string
+	ResponseStatusCode *int
+	Status             string
+}
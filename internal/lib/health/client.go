@@ -0,0 +1,85 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// Check returns an error when the dependency cannot be used, it must be cheap as it runs on every readiness probe
+type Check func(ctx context.Context) error
+
+type Client interface {
+	Check(ctx context.Context) []Result
+}
+
+type Config struct {
+	// Timeout bounds each check so that a hung dependency fails readiness instead of the probe timing out
+	Timeout time.Duration
+}
+
+type Result struct {
+	Dependency string
+	Err        error
+	Latency    time.Duration
+}
+
+func NewClient(ctx context.Context, config Config, checkByDependency map[string]Check) Client {
+	lib_log.Info(ctx, "Initializing", lib_log.FmtAny("config", config), lib_log.FmtInt("len(checkByDependency)", len(checkByDependency)))
+	lib_log.Info(ctx, "Initialized")
+	return client{
+		config:            config,
+		checkByDependency: checkByDependency,
+	}
+}
+
+type client struct {
+	config            Config
+	checkByDependency map[string]Check
+}
+
+// Check runs the checks concurrently, the results are sorted by dependency
+func (c client) Check(ctx context.Context) []Result {
+	results := make([]Result, 0, len(c.checkByDependency))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for dependency, check := range c.checkByDependency {
+		wg.Add(1)
+		go func(dependency string, check Check) {
+			defer wg.Done()
+			result := c.check(ctx, dependency, check)
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}(dependency, check)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Dependency < results[j].Dependency
+	})
+	return results
+}
+
+func (c client) check(ctx context.Context, dependency string, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := Result{
+		Dependency: dependency,
+		Latency:    time.Since(start),
+	}
+	if err != nil {
+		result.Err = lib_errors.Wrapf(err, "Failed checking %s", dependency)
+	} else if ctx.Err() != nil {
+		// A check that ignores its context is failed once it returns after the timeout
+		result.Err = lib_errors.Wrapf(ctx.Err(), "Failed checking %s within timeout", dependency)
+	}
+	return result
+}
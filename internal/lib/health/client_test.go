@@ -0,0 +1,71 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_client_Check(t *testing.T) {
+	checkByDependency := map[string]Check{
+		"fail": func(_ context.Context) error {
+			return errors.New("unavailable")
+		},
+		"hang": func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		"ignore timeout": func(_ context.Context) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		},
+		"ok": func(_ context.Context) error {
+			return nil
+		},
+	}
+
+	type expected struct {
+		dependency string
+		err        bool
+	}
+	var data = []expected{
+		{dependency: "fail", err: true},
+		{dependency: "hang", err: true},
+		{dependency: "ignore timeout", err: true},
+		{dependency: "ok"},
+	}
+
+	results := NewClient(context.Background(), Config{Timeout: 10 * time.Millisecond}, checkByDependency).Check(context.Background())
+	if len(results) != len(data) {
+		t.Fatal(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "len(results)",
+			Expected:   len(data),
+			Result:     len(results),
+		}))
+	}
+
+	for i, d := range data {
+		if results[i].Dependency != d.dependency {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "dependency",
+				At:         i,
+				Expected:   d.dependency,
+				Result:     results[i].Dependency,
+			}))
+			continue
+		}
+
+		if (results[i].Err != nil) != d.err {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.dependency,
+				At:         i,
+				Expected:   d.err,
+				Result:     results[i].Err,
+			}))
+		}
+	}
+}
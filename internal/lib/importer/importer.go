@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+)
+
+const (
+	FormatCsv   = "csv"
+	FormatJsonl = "jsonl"
+)
+
+var (
+	reportCsvHeader = []string{"row", "status", "field", "message"}
+)
+
+// FormatForContentType returns the import format for a content type, JSONL files are commonly sent as NDJSON
+func FormatForContentType(contentType string) (string, error) {
+	switch contentType {
+	case constants.ContentTypeCsv:
+		return FormatCsv, nil
+	case constants.ContentTypeNdjson, "application/jsonl":
+		return FormatJsonl, nil
+	}
+	return "", lib_errors.NewCustom(http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType))
+}
+
+// DecodeRows splits a fleet file into rows holding a JSON object per car, rows that cannot be decoded are returned with an error so that they can be reported
+func DecodeRows(format string, r io.Reader) ([]dto.CarsImportRow, error) {
+	switch format {
+	case FormatCsv:
+		return decodeCsvRows(r)
+	case FormatJsonl:
+		return decodeJsonlRows(r)
+	}
+	return nil, lib_errors.NewCustomf(http.StatusBadRequest, "Not recognized: format = %s", format)
+}
+
+// decodeCsvRows expects a header naming the car fields, the row number is the line of the row in the file
+func decodeCsvRows(r io.Reader) ([]dto.CarsImportRow, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, lib_errors.NewCustomWithCause(http.StatusBadRequest, constants.BadRequestMalformedImport, err)
+	}
+	for i, v := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(v))
+	}
+
+	var rows []dto.CarsImportRow
+	for number := 2; ; number++ {
+		record, err := csvReader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, lib_errors.Wrap(err, "Failed reading csv record")
+			}
+			rows = append(rows, dto.CarsImportRow{
+				Error:  lib_errors.NewCustomWithCause(http.StatusBadRequest, constants.BadRequestMalformedImportRow, err),
+				Number: number,
+			})
+			continue
+		}
+		if len(record) != len(header) {
+			rows = append(rows, dto.CarsImportRow{
+				Error:  lib_errors.NewCustom(http.StatusBadRequest, constants.BadRequestMalformedImportRow),
+				Number: number,
+			})
+			continue
+		}
+
+		car := make(map[string]string, len(header))
+		for i, v := range record {
+			if v != "" {
+				car[header[i]] = v
+			}
+		}
+		body, err := json.Marshal(car)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed marshalling csv record")
+		}
+		rows = append(rows, dto.CarsImportRow{
+			Body:   body,
+			Number: number,
+		})
+	}
+
+	return rows, nil
+}
+
+// decodeJsonlRows expects a JSON object per line, blank lines are skipped
+func decodeJsonlRows(r io.Reader) ([]dto.CarsImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var rows []dto.CarsImportRow
+	for number := 1; scanner.Scan(); number++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			rows = append(rows, dto.CarsImportRow{
+				Error:  lib_errors.NewCustom(http.StatusBadRequest, constants.BadRequestMalformedImportRow),
+				Number: number,
+			})
+			continue
+		}
+		rows = append(rows, dto.CarsImportRow{
+			Body:   append([]byte(nil), line...),
+			Number: number,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, lib_errors.NewCustomWithCause(http.StatusBadRequest, constants.BadRequestMalformedImport, err)
+	}
+
+	return rows, nil
+}
+
+// EncodeReportCsv writes a line per error of each failed row so that the report can be opened next to the imported file
+func EncodeReportCsv(carsImportReport dto.CarsImportReport) ([]byte, error) {
+	var b bytes.Buffer
+	csvWriter := csv.NewWriter(&b)
+
+	if err := csvWriter.Write(reportCsvHeader); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed writing csv header")
+	}
+	for _, row := range carsImportReport.Rows {
+		if row.Status < http.StatusBadRequest {
+			continue
+		}
+		errors := row.Errors
+		if len(errors) == 0 {
+			errors = []lib_errors.Item{{Message: http.StatusText(row.Status)}}
+		}
+		for _, v := range errors {
+			if err := csvWriter.Write([]string{strconv.Itoa(row.Number), strconv.Itoa(row.Status), v.Field, v.Message}); err != nil {
+				return nil, lib_errors.Wrap(err, "Failed writing csv record")
+			}
+		}
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed flushing csv")
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"car-svc/internal/lib/dto"
+	"net/http"
+	"strings"
+	"testing"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_DecodeRows(t *testing.T) {
+	type input struct {
+		format string
+		file   string
+	}
+	type expectedRow struct {
+		body     string
+		hasError bool
+		number   int
+	}
+	var data = []struct {
+		desc string
+		input
+		expected []expectedRow
+	}{
+		{
+			desc:  "csv",
+			input: input{format: FormatCsv, file: "Brand_Name,model_name\nford,focus\n\"toyota\",\"\"\nbmw\n"},
+			expected: []expectedRow{
+				{body: `{"brand_name":"ford","model_name":"focus"}`, number: 2},
+				{body: `{"brand_name":"toyota"}`, number: 3},
+				{hasError: true, number: 4},
+			},
+		},
+		{
+			desc:     "csv header only",
+			input:    input{format: FormatCsv, file: "brand_name,model_name\n"},
+			expected: nil,
+		},
+		{
+			desc:  "jsonl",
+			input: input{format: FormatJsonl, file: "{\"brand_name\":\"ford\",\"model_name\":\"focus\"}\n\n{\"brand_name\":\n"},
+			expected: []expectedRow{
+				{body: `{"brand_name":"ford","model_name":"focus"}`, number: 1},
+				{hasError: true, number: 3},
+			},
+		},
+	}
+
+	for i, d := range data {
+		result, err := DecodeRows(d.input.format, strings.NewReader(d.input.file))
+		if err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err exists",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   nil,
+				Result:     err.Error(),
+			}))
+			continue
+		}
+
+		if len(result) != len(d.expected) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "len(result)",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   len(d.expected),
+				Result:     len(result),
+			}))
+			continue
+		}
+		for j, v := range d.expected {
+			if result[j].Number != v.number || (result[j].Error != nil) != v.hasError || string(result[j].Body) != v.body {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "result",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   v,
+					Result:     result[j],
+				}))
+			}
+		}
+	}
+
+	if _, err := DecodeRows("xml", strings.NewReader("")); !lib_errors.IsCustomWithCode(err, http.StatusBadRequest) {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "err code",
+			Desc:       "unrecognized format",
+			Expected:   http.StatusBadRequest,
+			Result:     err,
+		}))
+	}
+}
+
+func Test_EncodeReportCsv(t *testing.T) {
+	carsImportReport := dto.CarsImportReport{
+		Rows: []dto.CarsImportReportRow{
+			{CarId: "car_id", Number: 2, Status: http.StatusCreated},
+			{Errors: []lib_errors.Item{{Field: "model_name", Message: "REQUIRED"}, {Message: "MALFORMED"}}, Number: 3, Status: http.StatusBadRequest},
+			{Number: 4, Status: http.StatusInternalServerError},
+		},
+	}
+	expected := "row,status,field,message\n3,400,model_name,REQUIRED\n3,400,,MALFORMED\n4,500,,Internal Server Error\n"
+
+	result, err := EncodeReportCsv(carsImportReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != expected {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "result",
+			Expected:   expected,
+			Result:     string(result),
+		}))
+	}
+}
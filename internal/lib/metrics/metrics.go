@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// Default is the registry served by the metrics server, metrics are registered with it when their package is initialized
+var Default = NewRegistry()
+
+// Collect updates metrics that are read rather than recorded, it is run by a scrape
+type Collect func(ctx context.Context) error
+
+// Registry is a Prometheus registry that runs its collects before it is gathered, so that the metrics they update are current when scraped
+type Registry struct {
+	*prometheus.Registry
+
+	mu         sync.Mutex
+	collectors []*collector
+}
+
+// NewRegistry returns a registry with the metrics of the Go runtime and of the process
+func NewRegistry() *Registry {
+	r := &Registry{
+		Registry: prometheus.NewRegistry(),
+	}
+	r.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return r
+}
+
+// collector runs its collect at most once per interval, so that a metric that is expensive to read is not read by every scrape
+type collector struct {
+	mu            sync.Mutex
+	collect       Collect
+	dateCollected time.Time
+	interval      time.Duration
+	name          string
+}
+
+// AddCollector adds a collect run by a scrape when the interval has passed since it last ran, a failed collect is logged and the metrics it updates keep their values
+func (r *Registry) AddCollector(name string, interval time.Duration, collect Collect) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, &collector{
+		collect:  collect,
+		interval: interval,
+		name:     name,
+	})
+}
+
+func (c *collector) run(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dateCollected.IsZero() && time.Since(c.dateCollected) < c.interval {
+		return
+	}
+	// The date is set before collecting so that a collect that keeps failing is not retried by every scrape
+	c.dateCollected = time.Now()
+	if err := c.collect(ctx); err != nil {
+		lib_log.Error(ctx, "Failed collecting metrics", lib_log.FmtString("c.name", c.name), lib_log.FmtError(err))
+	}
+}
+
+// Handler runs the collectors and serves the metrics in the format negotiated with the scraper
+func (r *Registry) Handler() http.HandlerFunc {
+	handler := promhttp.HandlerFor(r, promhttp.HandlerOpts{})
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.Collect(req.Context())
+		handler.ServeHTTP(w, req)
+	}
+}
+
+// Collect runs the collectors whose interval has passed
+func (r *Registry) Collect(ctx context.Context) {
+	r.mu.Lock()
+	collectors := append([]*collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, v := range collectors {
+		v.run(ctx)
+	}
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_Registry_Handler(t *testing.T) {
+	r := NewRegistry()
+	requests := promauto.With(r).NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Requests."}, []string{"method", "code"})
+	requests.WithLabelValues("GET", "200").Inc()
+	collected := promauto.With(r).NewGauge(prometheus.GaugeOpts{Name: "collected", Help: "Collected."})
+	r.AddCollector("test", time.Hour, func(_ context.Context) error {
+		collected.Set(1)
+		return nil
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, req)
+	b, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The series of the registry are served with those of the Go runtime and of the process
+	for i, expected := range []string{
+		`requests_total{code="200",method="GET"} 1`,
+		"collected 1",
+		"go_goroutines ",
+		"process_start_time_seconds ",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "metrics",
+				At:         i,
+				Expected:   expected,
+				Result:     string(b),
+			}))
+		}
+	}
+}
+
+func Test_Registry_Collect(t *testing.T) {
+	r := NewRegistry()
+	g := promauto.With(r).NewGauge(prometheus.GaugeOpts{Name: "collected", Help: "Collected."})
+	var runs int
+	r.AddCollector("test", time.Hour, func(_ context.Context) error {
+		runs++
+		g.Set(float64(runs))
+		return nil
+	})
+	var runsFailed int
+	r.AddCollector("test_failed", 0, func(_ context.Context) error {
+		runsFailed++
+		return errors.New("unavailable")
+	})
+
+	for i := 0; i < 3; i++ {
+		r.Collect(context.Background())
+	}
+
+	if runs != 1 {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "runs",
+			Expected:   1,
+			Result:     runs,
+		}))
+	}
+	if runsFailed != 3 {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "runsFailed",
+			Expected:   3,
+			Result:     runsFailed,
+		}))
+	}
+}
@@ -0,0 +1,437 @@
+package patch
+
+import (
+	"bytes"
+	"car-svc/internal/lib/constants"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+)
+
+const (
+	ContentTypeJsonMergePatch = "application/merge-patch+json"
+	ContentTypeJsonPatch      = "application/json-patch+json"
+
+	operationAdd     = "add"
+	operationCopy    = "copy"
+	operationMove    = "move"
+	operationRemove  = "remove"
+	operationReplace = "replace"
+	operationTest    = "test"
+)
+
+// Operation is a single JSON Patch (RFC 6902) operation
+type Operation struct {
+	From  string          `json:"from,omitempty"`
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply applies the patch of the passed content type to the document
+func Apply(contentType string, doc, patch []byte) ([]byte, error) {
+	switch contentType {
+	default:
+		return nil, lib_errors.Errorf("Content type %q not recognized", contentType)
+
+	case ContentTypeJsonMergePatch:
+		return ApplyMergePatch(doc, patch)
+
+	case ContentTypeJsonPatch:
+		return ApplyJsonPatch(doc, patch)
+	}
+}
+
+// Check checks the patch of the passed content type is well formed without applying it
+func Check(contentType string, patch []byte) error {
+	switch contentType {
+	default:
+		return lib_errors.NewCustom(http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType))
+
+	case ContentTypeJsonMergePatch:
+		if _, err := decode(patch); err != nil {
+			return lib_errors.NewCustomWithCause(http.StatusBadRequest, constants.BadRequestMalformedPatch, err)
+		}
+
+	case ContentTypeJsonPatch:
+		if _, err := DecodeJsonPatch(patch); err != nil {
+			return lib_errors.Wrap(err, "Failed decoding json patch")
+		}
+	}
+	return nil
+}
+
+// ApplyMergePatch applies a JSON Merge Patch (RFC 7396) to the document
+func ApplyMergePatch(doc, patch []byte) ([]byte, error) {
+	d, err := decode(doc)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding doc")
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, lib_errors.NewCustomWithCause(http.StatusBadRequest, constants.BadRequestMalformedPatch, err)
+	}
+
+	patched, err := json.Marshal(mergePatch(d, p))
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed marshalling patched doc")
+	}
+	return patched, nil
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for k, v := range patchObject {
+		if v == nil {
+			delete(targetObject, k)
+		} else {
+			targetObject[k] = mergePatch(targetObject[k], v)
+		}
+	}
+	return targetObject
+}
+
+// DecodeJsonPatch decodes and checks the operations of a JSON Patch (RFC 6902)
+func DecodeJsonPatch(patch []byte) ([]Operation, error) {
+	var operations []Operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, lib_errors.NewCustomWithCause(http.StatusBadRequest, constants.BadRequestMalformedPatch, err)
+	}
+	for i, v := range operations {
+		if _, err := parsePointer(v.Path); err != nil {
+			return nil, lib_errors.NewCustomWithCause(http.StatusBadRequest, constants.BadRequestMalformedPatch, lib_errors.Wrapf(err, "Failed parsing path of operation %d", i))
+		}
+		switch v.Op {
+		default:
+			return nil, lib_errors.NewCustomWithCause(http.StatusBadRequest, constants.BadRequestMalformedPatch, lib_errors.Errorf("Operation %d has unrecognized op %q", i, v.Op))
+
+		case operationAdd, operationReplace, operationTest:
+			if v.Value == nil {
+				return nil, lib_errors.NewCustomWithCause(http.StatusBadRequest, constants.BadRequestMalformedPatch, lib_errors.Errorf("Operation %d with op %q is missing value", i, v.Op))
+			}
+
+		case operationCopy, operationMove:
+			if _, err := parsePointer(v.From); err != nil {
+				return nil, lib_errors.NewCustomWithCause(http.StatusBadRequest, constants.BadRequestMalformedPatch, lib_errors.Wrapf(err, "Failed parsing from of operation %d", i))
+			}
+
+		case operationRemove:
+		}
+	}
+	return operations, nil
+}
+
+// ApplyJsonPatch applies a JSON Patch (RFC 6902) to the document, the operations are applied in order and the patch fails as a whole if any operation fails
+func ApplyJsonPatch(doc, patch []byte) ([]byte, error) {
+	operations, err := DecodeJsonPatch(patch)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding json patch")
+	}
+	d, err := decode(doc)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding doc")
+	}
+
+	for i, v := range operations {
+		if d, err = applyOperation(d, v); err != nil {
+			return nil, lib_errors.NewCustomWithCause(http.StatusUnprocessableEntity, constants.UnprocessableEntityPatchCannotBeApplied, lib_errors.Wrapf(err, "Failed applying operation %d", i))
+		}
+	}
+
+	patched, err := json.Marshal(d)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed marshalling patched doc")
+	}
+	return patched, nil
+}
+
+func applyOperation(doc interface{}, operation Operation) (interface{}, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed parsing path")
+	}
+
+	switch operation.Op {
+	default:
+		return nil, lib_errors.Errorf("Op %q not recognized", operation.Op)
+
+	case operationAdd:
+		value, err := decode(operation.Value)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed decoding value")
+		}
+		return add(doc, path, value)
+
+	case operationRemove:
+		doc, _, err := remove(doc, path)
+		return doc, err
+
+	case operationReplace:
+		value, err := decode(operation.Value)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed decoding value")
+		}
+		if doc, _, err = remove(doc, path); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed removing value to replace")
+		}
+		return add(doc, path, value)
+
+	case operationMove:
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed parsing from")
+		}
+		if isProperPrefix(from, path) {
+			return nil, lib_errors.Errorf("Cannot move %q into one of its children %q", operation.From, operation.Path)
+		}
+		doc, value, err := remove(doc, from)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed removing value to move")
+		}
+		return add(doc, path, value)
+
+	case operationCopy:
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed parsing from")
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed getting value to copy")
+		}
+		// Round trip the value so the copy does not share maps or slices with the original
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed marshalling value to copy")
+		}
+		if value, err = decode(b); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed decoding value to copy")
+		}
+		return add(doc, path, value)
+
+	case operationTest:
+		expected, err := decode(operation.Value)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed decoding value")
+		}
+		value, err := get(doc, path)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed getting value to test")
+		}
+		if !reflect.DeepEqual(normalize(value), normalize(expected)) {
+			return nil, lib_errors.Errorf("Value at %q is not equal to the tested value", operation.Path)
+		}
+		return doc, nil
+	}
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting parent")
+	}
+	key := path[len(path)-1]
+
+	switch p := parent.(type) {
+	default:
+		return nil, lib_errors.Errorf("Cannot add %q to a value of type %T", key, parent)
+
+	case map[string]interface{}:
+		p[key] = value
+		return doc, nil
+
+	case []interface{}:
+		index := len(p)
+		if key != "-" {
+			if index, err = arrayIndex(key, len(p)); err != nil {
+				return nil, lib_errors.Wrap(err, "Failed getting array index")
+			}
+		}
+		updated := append(p[:index:index], append([]interface{}{value}, p[index:]...)...)
+		return set(doc, path[:len(path)-1], updated)
+	}
+}
+
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed getting parent")
+	}
+	key := path[len(path)-1]
+
+	switch p := parent.(type) {
+	default:
+		return nil, nil, lib_errors.Errorf("Cannot remove %q from a value of type %T", key, parent)
+
+	case map[string]interface{}:
+		value, ok := p[key]
+		if !ok {
+			return nil, nil, lib_errors.Errorf("Member %q does not exist", key)
+		}
+		delete(p, key)
+		return doc, value, nil
+
+	case []interface{}:
+		index, err := arrayIndex(key, len(p)-1)
+		if err != nil {
+			return nil, nil, lib_errors.Wrap(err, "Failed getting array index")
+		}
+		value := p[index]
+		updated := append(p[:index:index], p[index+1:]...)
+		if doc, err = set(doc, path[:len(path)-1], updated); err != nil {
+			return nil, nil, lib_errors.Wrap(err, "Failed setting updated array")
+		}
+		return doc, value, nil
+	}
+}
+
+// set replaces the value at the path, it is used for arrays because a resized slice must be stored back in its parent
+func set(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting parent")
+	}
+	key := path[len(path)-1]
+
+	switch p := parent.(type) {
+	default:
+		return nil, lib_errors.Errorf("Cannot set %q on a value of type %T", key, parent)
+
+	case map[string]interface{}:
+		p[key] = value
+
+	case []interface{}:
+		index, err := arrayIndex(key, len(p)-1)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed getting array index")
+		}
+		p[index] = value
+	}
+	return doc, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	value := doc
+	for _, key := range path {
+		switch v := value.(type) {
+		default:
+			return nil, lib_errors.Errorf("Cannot get %q from a value of type %T", key, value)
+
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[key]; !ok {
+				return nil, lib_errors.Errorf("Member %q does not exist", key)
+			}
+
+		case []interface{}:
+			index, err := arrayIndex(key, len(v)-1)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed getting array index")
+			}
+			value = v[index]
+		}
+	}
+	return value, nil
+}
+
+func arrayIndex(key string, max int) (int, error) {
+	if key == "" || (len(key) > 1 && key[0] == '0') {
+		return 0, lib_errors.Errorf("Array index %q is not valid", key)
+	}
+	index, err := strconv.Atoi(key)
+	if err != nil {
+		return 0, lib_errors.Wrapf(err, "Failed parsing array index %q", key)
+	}
+	if index < 0 || index > max {
+		return 0, lib_errors.Errorf("Array index %d is out of bounds", index)
+	}
+	return index, nil
+}
+
+// parsePointer parses a JSON Pointer (RFC 6901) into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, lib_errors.Errorf("Pointer %q does not start with /", pointer)
+	}
+	var path []string
+	for _, v := range strings.Split(pointer[1:], "/") {
+		path = append(path, strings.ReplaceAll(strings.ReplaceAll(v, "~1", "/"), "~0", "~"))
+	}
+	return path, nil
+}
+
+func isProperPrefix(prefix, path []string) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+	for i, v := range prefix {
+		if path[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func decode(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding json")
+	}
+	if d.More() {
+		return nil, lib_errors.New("Found trailing data after json")
+	}
+	return v, nil
+}
+
+// normalize makes numbers comparable regardless of how they were written, e.g. 1 and 1.0
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	default:
+		return v
+
+	case json.Number:
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+		return t.String()
+
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, vv := range t {
+			m[k] = normalize(vv)
+		}
+		return m
+
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, vv := range t {
+			s[i] = normalize(vv)
+		}
+		return s
+	}
+}
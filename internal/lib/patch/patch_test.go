@@ -0,0 +1,219 @@
+package patch
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_ApplyMergePatch(t *testing.T) {
+	type input struct {
+		doc   string
+		patch string
+	}
+	var data = []struct {
+		desc string
+		input
+		expected string
+	}{
+		{
+			desc:     "replace",
+			input:    input{doc: `{"a":"b"}`, patch: `{"a":"c"}`},
+			expected: `{"a":"c"}`,
+		},
+		{
+			desc:     "add",
+			input:    input{doc: `{"a":"b"}`, patch: `{"b":"c"}`},
+			expected: `{"a":"b","b":"c"}`,
+		},
+		{
+			desc:     "explicit null removes",
+			input:    input{doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`},
+			expected: `{"b":"c"}`,
+		},
+		{
+			desc:     "nested",
+			input:    input{doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`},
+			expected: `{"a":{"b":"d"}}`,
+		},
+		{
+			desc:     "array replaced as a whole",
+			input:    input{doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`},
+			expected: `{"a":[1]}`,
+		},
+		{
+			desc:     "non object patch replaces doc",
+			input:    input{doc: `{"a":"b"}`, patch: `["c"]`},
+			expected: `["c"]`,
+		},
+	}
+
+	for i, d := range data {
+		result, err := ApplyMergePatch([]byte(d.input.doc), []byte(d.input.patch))
+		if err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err exists",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   nil,
+				Result:     err.Error(),
+			}))
+			continue
+		}
+
+		if !equalJson(t, result, []byte(d.expected)) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     string(result),
+			}))
+		}
+	}
+}
+
+func Test_ApplyJsonPatch(t *testing.T) {
+	type input struct {
+		doc   string
+		patch string
+	}
+	type expected struct {
+		code   int
+		result string
+	}
+	var data = []struct {
+		desc string
+		input
+		expected
+	}{
+		{
+			desc:     "add member",
+			input:    input{doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":"qux"}]`},
+			expected: expected{result: `{"baz":"qux","foo":"bar"}`},
+		},
+		{
+			desc:     "add array element",
+			input:    input{doc: `{"foo":["bar","baz"]}`, patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`},
+			expected: expected{result: `{"foo":["bar","qux","baz"]}`},
+		},
+		{
+			desc:     "add to end of array",
+			input:    input{doc: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`},
+			expected: expected{result: `{"foo":["bar",["abc","def"]]}`},
+		},
+		{
+			desc:     "remove array element",
+			input:    input{doc: `{"foo":["bar","qux","baz"]}`, patch: `[{"op":"remove","path":"/foo/1"}]`},
+			expected: expected{result: `{"foo":["bar","baz"]}`},
+		},
+		{
+			desc:     "replace with explicit null",
+			input:    input{doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":null}]`},
+			expected: expected{result: `{"baz":null,"foo":"bar"}`},
+		},
+		{
+			desc:     "move",
+			input:    input{doc: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`},
+			expected: expected{result: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		},
+		{
+			desc:     "copy",
+			input:    input{doc: `{"foo":{"bar":"baz"}}`, patch: `[{"op":"copy","from":"/foo","path":"/qux"}]`},
+			expected: expected{result: `{"foo":{"bar":"baz"},"qux":{"bar":"baz"}}`},
+		},
+		{
+			desc:     "escaped pointer",
+			input:    input{doc: `{"a/b":1,"m~n":2}`, patch: `[{"op":"test","path":"/a~1b","value":1},{"op":"remove","path":"/m~0n"}]`},
+			expected: expected{result: `{"a/b":1}`},
+		},
+		{
+			desc:     "test success",
+			input:    input{doc: `{"baz":"qux","foo":["a",2,"c"]}`, patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`},
+			expected: expected{result: `{"baz":"qux","foo":["a",2,"c"]}`},
+		},
+		{
+			desc:     "test failure",
+			input:    input{doc: `{"baz":"qux"}`, patch: `[{"op":"test","path":"/baz","value":"bar"}]`},
+			expected: expected{code: http.StatusUnprocessableEntity},
+		},
+		{
+			desc:     "remove missing member",
+			input:    input{doc: `{"foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`},
+			expected: expected{code: http.StatusUnprocessableEntity},
+		},
+		{
+			desc:     "add to missing parent",
+			input:    input{doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`},
+			expected: expected{code: http.StatusUnprocessableEntity},
+		},
+		{
+			desc:     "unrecognized op",
+			input:    input{doc: `{"foo":"bar"}`, patch: `[{"op":"merge","path":"/foo","value":"qux"}]`},
+			expected: expected{code: http.StatusBadRequest},
+		},
+		{
+			desc:     "missing value",
+			input:    input{doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz"}]`},
+			expected: expected{code: http.StatusBadRequest},
+		},
+		{
+			desc:     "not an array",
+			input:    input{doc: `{"foo":"bar"}`, patch: `{"op":"add","path":"/baz","value":"qux"}`},
+			expected: expected{code: http.StatusBadRequest},
+		},
+	}
+
+	for i, d := range data {
+		result, err := ApplyJsonPatch([]byte(d.input.doc), []byte(d.input.patch))
+
+		if d.expected.code != 0 {
+			if !lib_errors.IsCustomWithCode(err, d.expected.code) {
+				var r interface{} = err
+				if err != nil {
+					r = err.Error()
+				}
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err code",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   d.expected.code,
+					Result:     r,
+				}))
+			}
+
+		} else if err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err exists",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   nil,
+				Result:     err.Error(),
+			}))
+
+		} else if !equalJson(t, result, []byte(d.expected.result)) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.result,
+				Result:     string(result),
+			}))
+		}
+	}
+}
+
+func equalJson(t *testing.T, a, b []byte) bool {
+	var x, y interface{}
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(x, y)
+}
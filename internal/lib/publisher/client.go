@@ -0,0 +1,74 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pubsub "github.com/tomwangsvc/lib-svc/pubsub"
+)
+
+// Client publishes messages to topics, it keeps the service independent of Pub/Sub so that it can run locally with the in-memory client
+type Client interface {
+	Close() error
+	Publish(ctx context.Context, topicId string, datas [][]byte) ([]string, error)
+}
+
+func NewClient(ctx context.Context, pubsubClient lib_pubsub.Client) Client {
+	lib_log.Info(ctx, "Initializing")
+	lib_log.Info(ctx, "Initialized")
+	return &client{
+		pubsubClient: pubsubClient,
+		topicById:    make(map[string]*pubsub.Topic),
+	}
+}
+
+type client struct {
+	pubsubClient lib_pubsub.Client
+	topicById    map[string]*pubsub.Topic
+	topicByIdMu  sync.Mutex
+}
+
+func (c *client) Close() error {
+	if err := c.pubsubClient.Close(); err != nil {
+		return lib_errors.Wrap(err, "Failed closing pubsub client")
+	}
+	return nil
+}
+
+// Publish publishes the messages with lib_pubsub which adds the correlation id and test attributes from the context
+func (c *client) Publish(ctx context.Context, topicId string, datas [][]byte) ([]string, error) {
+	lib_log.Info(ctx, "Publishing", lib_log.FmtString("topicId", topicId), lib_log.FmtInt("len(datas)", len(datas)))
+
+	topic, err := c.topic(ctx, topicId)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting topic")
+	}
+
+	messageIds, err := c.pubsubClient.PublishMessages(ctx, topic, datas)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed publishing messages")
+	}
+
+	lib_log.Info(ctx, "Published", lib_log.FmtInt("len(messageIds)", len(messageIds)))
+	return messageIds, nil
+}
+
+func (c *client) topic(ctx context.Context, topicId string) (*pubsub.Topic, error) {
+	c.topicByIdMu.Lock()
+	defer c.topicByIdMu.Unlock()
+
+	if topic, ok := c.topicById[topicId]; ok {
+		return topic, nil
+	}
+
+	topic, err := c.pubsubClient.Topic(ctx, topicId)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting pubsub topic")
+	}
+	c.topicById[topicId] = topic
+
+	return topic, nil
+}
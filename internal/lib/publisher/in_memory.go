@@ -0,0 +1,51 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// InMemoryClient keeps published messages in memory, it is used for local runs where there is no Pub/Sub
+type InMemoryClient struct {
+	datasByTopicId   map[string][][]byte
+	datasByTopicIdMu sync.Mutex
+}
+
+func NewInMemoryClient(ctx context.Context) *InMemoryClient {
+	lib_log.Info(ctx, "Initializing")
+	lib_log.Info(ctx, "Initialized")
+	return &InMemoryClient{
+		datasByTopicId: make(map[string][][]byte),
+	}
+}
+
+func (c *InMemoryClient) Close() error {
+	return nil
+}
+
+func (c *InMemoryClient) Publish(ctx context.Context, topicId string, datas [][]byte) ([]string, error) {
+	lib_log.Info(ctx, "Publishing", lib_log.FmtString("topicId", topicId), lib_log.FmtInt("len(datas)", len(datas)))
+
+	c.datasByTopicIdMu.Lock()
+	defer c.datasByTopicIdMu.Unlock()
+
+	var messageIds []string
+	for _, v := range datas {
+		c.datasByTopicId[topicId] = append(c.datasByTopicId[topicId], v)
+		messageIds = append(messageIds, fmt.Sprintf("%s-%d", topicId, len(c.datasByTopicId[topicId])))
+	}
+
+	lib_log.Info(ctx, "Published", lib_log.FmtInt("len(messageIds)", len(messageIds)))
+	return messageIds, nil
+}
+
+// Messages returns the messages published to the topic in the order they were published
+func (c *InMemoryClient) Messages(topicId string) [][]byte {
+	c.datasByTopicIdMu.Lock()
+	defer c.datasByTopicIdMu.Unlock()
+
+	return append([][]byte(nil), c.datasByTopicId[topicId]...)
+}
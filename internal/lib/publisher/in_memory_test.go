@@ -0,0 +1,85 @@
+package publisher
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_InMemoryClient_Publish(t *testing.T) {
+	type expected struct {
+		messageIds []string
+		messages   [][]byte
+	}
+	var data = []struct {
+		desc    string
+		topicId string
+		datas   [][]byte
+		expected
+	}{
+		{
+			desc:    "first messages",
+			topicId: "car-svc-events",
+			datas:   [][]byte{[]byte("a"), []byte("b")},
+			expected: expected{
+				messageIds: []string{"car-svc-events-1", "car-svc-events-2"},
+				messages:   [][]byte{[]byte("a"), []byte("b")},
+			},
+		},
+		{
+			desc:    "appended messages",
+			topicId: "car-svc-events",
+			datas:   [][]byte{[]byte("c")},
+			expected: expected{
+				messageIds: []string{"car-svc-events-3"},
+				messages:   [][]byte{[]byte("a"), []byte("b"), []byte("c")},
+			},
+		},
+		{
+			desc:    "other topic",
+			topicId: "other",
+			datas:   [][]byte{[]byte("d")},
+			expected: expected{
+				messageIds: []string{"other-1"},
+				messages:   [][]byte{[]byte("d")},
+			},
+		},
+	}
+
+	c := NewInMemoryClient(context.Background())
+	for i, d := range data {
+		messageIds, err := c.Publish(context.Background(), d.topicId, d.datas)
+		if err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err exists",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   nil,
+				Result:     err.Error(),
+			}))
+			continue
+		}
+
+		if !reflect.DeepEqual(messageIds, d.expected.messageIds) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "messageIds",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.messageIds,
+				Result:     messageIds,
+			}))
+		}
+
+		if messages := c.Messages(d.topicId); !reflect.DeepEqual(messages, d.expected.messages) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "messages",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.messages,
+				Result:     messages,
+			}))
+		}
+	}
+}
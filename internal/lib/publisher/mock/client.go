@@ -0,0 +1,41 @@
+package mock
+
+import (
+	"car-svc/internal/lib/publisher"
+	"context"
+	"encoding/binary"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_mock "github.com/tomwangsvc/lib-svc/mock"
+)
+
+var (
+	ClientError   publisher.Client = clientError{}
+	ClientSuccess publisher.Client = clientSuccess{}
+
+	ExpectedErrorClient = lib_errors.NewCustom(int(binary.BigEndian.Uint64([]byte("PUBLISHER_CLIENT"))), "")
+)
+
+type clientError struct{}
+
+func (c clientError) Close() error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) Publish(_ context.Context, _ string, _ [][]byte) ([]string, error) {
+	return nil, ExpectedErrorClient
+}
+
+type clientSuccess struct{}
+
+func (c clientSuccess) Close() error {
+	return nil
+}
+
+func (c clientSuccess) Publish(_ context.Context, _ string, datas [][]byte) ([]string, error) {
+	messageIds := make([]string, len(datas))
+	for i := range datas {
+		messageIds[i] = lib_mock.ExpectedResultString
+	}
+	return messageIds, nil
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/civil"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+)
+
+// Limit is a token bucket refilled at RequestsPerSecond up to Burst tokens and a quota of requests per UTC day
+type Limit struct {
+	Burst             int64
+	DailyQuota        int64
+	RequestsPerSecond float64
+}
+
+// Result describes the limit closest to being exhausted, it is returned in the RateLimit headers of the response
+type Result struct {
+	Allowed       bool
+	Limit         int64
+	QuotaExceeded bool
+	Remaining     int64
+	Reset         time.Duration
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// ConsumeQuota counts a request against the quota of the key for the day and returns the requests counted on the day, a request over the quota is refused with a too many requests error
+type ConsumeQuota func(ctx context.Context, key string, day civil.Date, quota int64) (int64, error)
+
+// NewLimiter returns a limiter that smooths bursts with buckets kept in the memory of the instance and counts the daily quotas with consumeQuota, so that a quota holds whichever instances the requests of a key reach
+func NewLimiter(consumeQuota ConsumeQuota) Limiter {
+	return &limiter{
+		buckets:      make(map[string]*bucket),
+		consumeQuota: consumeQuota,
+		now:          time.Now,
+	}
+}
+
+type limiter struct {
+	mutex        sync.Mutex
+	buckets      map[string]*bucket
+	consumeQuota ConsumeQuota
+	now          func() time.Time
+}
+
+type bucket struct {
+	dateFilled time.Time
+	tokens     float64
+}
+
+func (l *limiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := l.now()
+	tokens, ok := l.take(key, limit, now)
+	if !ok {
+		return Result{
+			Limit: limit.Burst,
+			Reset: secondsToDuration((1 - tokens) / limit.RequestsPerSecond),
+		}, nil
+	}
+
+	day := now.UTC().Truncate(24 * time.Hour)
+	untilQuotaReset := day.Add(24 * time.Hour).Sub(now)
+	used, err := l.consumeQuota(ctx, key, civil.DateOf(day), limit.DailyQuota)
+	if err != nil {
+		if lib_errors.IsCustomWithCode(err, http.StatusTooManyRequests) {
+			return Result{
+				Limit:         limit.DailyQuota,
+				QuotaExceeded: true,
+				Reset:         untilQuotaReset,
+			}, nil
+		}
+		return Result{}, lib_errors.Wrap(err, "Failed consuming quota")
+	}
+
+	if quotaRemaining := limit.DailyQuota - used; quotaRemaining < int64(tokens) {
+		return Result{
+			Allowed:   true,
+			Limit:     limit.DailyQuota,
+			Remaining: quotaRemaining,
+			Reset:     untilQuotaReset,
+		}, nil
+	}
+	return Result{
+		Allowed:   true,
+		Limit:     limit.Burst,
+		Remaining: int64(tokens),
+		Reset:     secondsToDuration((float64(limit.Burst) - tokens) / limit.RequestsPerSecond),
+	}, nil
+}
+
+// take refills the bucket of the key and takes a token from it, the tokens left are returned whether or not a token was taken
+func (l *limiter) take(key string, limit Limit, now time.Time) (float64, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{
+			dateFilled: now,
+			tokens:     float64(limit.Burst),
+		}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.dateFilled).Seconds()*limit.RequestsPerSecond)
+	b.dateFilled = now
+
+	if b.tokens < 1 {
+		return b.tokens, false
+	}
+	b.tokens--
+	return b.tokens, true
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
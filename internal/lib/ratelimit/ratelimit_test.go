@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_limiter_Allow(t *testing.T) {
+	limit := Limit{
+		Burst:             2,
+		DailyQuota:        4,
+		RequestsPerSecond: 1,
+	}
+	start := time.Date(2021, 8, 1, 23, 59, 50, 0, time.UTC)
+
+	var data = []struct {
+		desc     string
+		at       time.Duration
+		key      string
+		expected Result
+	}{
+		{
+			desc:     "first request uses bucket",
+			expected: Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second},
+		},
+		{
+			desc:     "second request empties bucket",
+			expected: Result{Allowed: true, Limit: 2, Remaining: 0, Reset: 2 * time.Second},
+		},
+		{
+			desc:     "bucket empty",
+			expected: Result{Limit: 2, Reset: time.Second},
+		},
+		{
+			desc:     "other key has its own bucket",
+			key:      "other",
+			expected: Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second},
+		},
+		{
+			desc:     "bucket refilled",
+			at:       time.Second,
+			expected: Result{Allowed: true, Limit: 2, Remaining: 0, Reset: 2 * time.Second},
+		},
+		{
+			desc:     "quota closer to being exhausted than bucket",
+			at:       3 * time.Second,
+			expected: Result{Allowed: true, Limit: 4, Remaining: 0, Reset: 7 * time.Second},
+		},
+		{
+			desc:     "quota exceeded",
+			at:       5 * time.Second,
+			expected: Result{Limit: 4, QuotaExceeded: true, Reset: 5 * time.Second},
+		},
+		{
+			desc:     "quota reset the next day",
+			at:       10 * time.Second,
+			expected: Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second},
+		},
+	}
+
+	var now time.Time
+	usedByKeyAndDay := make(map[string]int64)
+	limiter := &limiter{
+		buckets: make(map[string]*bucket),
+		consumeQuota: func(_ context.Context, key string, day civil.Date, quota int64) (int64, error) {
+			keyAndDay := key + day.String()
+			if usedByKeyAndDay[keyAndDay] >= quota {
+				return 0, lib_errors.NewCustom(http.StatusTooManyRequests, "Quota exceeded")
+			}
+			usedByKeyAndDay[keyAndDay]++
+			return usedByKeyAndDay[keyAndDay], nil
+		},
+		now: func() time.Time { return now },
+	}
+	for i, d := range data {
+		now = start.Add(d.at)
+		key := d.key
+		if key == "" {
+			key = "key"
+		}
+		result, err := limiter.Allow(context.Background(), key, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
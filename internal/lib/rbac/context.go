@@ -0,0 +1,106 @@
+package rbac
+
+import (
+	"car-svc/internal/lib/constants"
+	"context"
+	"net/http"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
+)
+
+// Grants are the permissions granted to the caller and the branches each is granted on
+type Grants map[string]Scope
+
+type Scope struct {
+	All       bool
+	BranchIds []string
+}
+
+// Includes reports whether the scope includes the branch, a car without a branch is only included by a scope over all branches
+func (s Scope) Includes(branchId string) bool {
+	if s.All {
+		return true
+	}
+	for _, v := range s.BranchIds {
+		if branchId != "" && v == branchId {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKeyGrants struct{}
+
+type contextKeyScope struct{}
+
+type contextKeyFields struct{}
+
+type contextKeyTrusted struct{}
+
+// WithGrants puts the grants of the caller and the scope of the permission required by the route on the context
+func WithGrants(ctx context.Context, grants Grants, scope Scope) context.Context {
+	ctx = context.WithValue(ctx, contextKeyGrants{}, grants)
+	return context.WithValue(ctx, contextKeyScope{}, scope)
+}
+
+// WithTrusted marks the context of work the service is trusted to do without a policy, e.g. jobs, a context without grants is otherwise denied
+func WithTrusted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeyTrusted{}, true)
+}
+
+func trusted(ctx context.Context) bool {
+	trusted, _ := ctx.Value(contextKeyTrusted{}).(bool)
+	return trusted
+}
+
+// WithFields puts the field policies on the context so that responses can be redacted for the caller
+func WithFields(ctx context.Context, fields map[string][]Field) context.Context {
+	return context.WithValue(ctx, contextKeyFields{}, fields)
+}
+
+// Redactions returns the redactions of the fields of the resource the caller is not permitted to read, the fields of requests that are not authorized by a policy are not redacted
+func Redactions(ctx context.Context, resource string) map[string]lib_json.Redaction {
+	fields, _ := ctx.Value(contextKeyFields{}).(map[string][]Field)
+	redactions := make(map[string]lib_json.Redaction)
+	for _, v := range fields[resource] {
+		if !Permitted(ctx, v.Permission) {
+			redactions[v.Path] = lib_json.DefaultRedaction
+		}
+	}
+	return redactions
+}
+
+// LogRedactions returns the redactions of the sensitive fields of the resource, they are redacted from logs whatever the caller is permitted to read
+func LogRedactions(resource string) map[string]lib_json.Redaction {
+	redactions := make(map[string]lib_json.Redaction)
+	for _, v := range sensitiveFields[resource] {
+		redactions[v] = lib_json.DefaultRedaction
+	}
+	return redactions
+}
+
+// Permitted reports whether the caller is granted the permission, a caller without grants is only permitted when trusted
+func Permitted(ctx context.Context, permission string) bool {
+	grants, ok := ctx.Value(contextKeyGrants{}).(Grants)
+	if !ok {
+		return trusted(ctx)
+	}
+	_, ok = grants[permission]
+	return ok
+}
+
+// CheckBranch checks the branch is in the scope of the permission required by the route, a caller without a scope is only allowed any branch when trusted
+func CheckBranch(ctx context.Context, branchId string) error {
+	scope, ok := ctx.Value(contextKeyScope{}).(Scope)
+	if !ok {
+		if trusted(ctx) {
+			return nil
+		}
+		return lib_errors.NewCustom(http.StatusForbidden, constants.ForbiddenPermissionDenied)
+	}
+	if scope.Includes(branchId) {
+		return nil
+	}
+	return lib_errors.NewCustom(http.StatusForbidden, constants.ForbiddenBranchOutOfScope)
+}
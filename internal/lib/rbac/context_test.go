@@ -0,0 +1,108 @@
+package rbac
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_Redactions(t *testing.T) {
+	policy := newPolicy()
+
+	var data = []struct {
+		desc     string
+		input    func(context.Context) context.Context
+		expected []string
+	}{
+		{
+			desc:     "no grants",
+			input:    func(ctx context.Context) context.Context { return WithFields(ctx, policy.Fields) },
+			expected: []string{"age", "ethnicity", "gender"},
+		},
+		{
+			desc:  "trusted",
+			input: func(ctx context.Context) context.Context { return WithFields(WithTrusted(ctx), policy.Fields) },
+		},
+		{
+			desc: "not permitted to read sensitive fields",
+			input: func(ctx context.Context) context.Context {
+				ctx = WithGrants(ctx, policy.Grants([]string{"viewer"}), Scope{All: true})
+				return WithFields(ctx, policy.Fields)
+			},
+			expected: []string{"age", "ethnicity", "gender"},
+		},
+		{
+			desc: "permitted to read sensitive fields",
+			input: func(ctx context.Context) context.Context {
+				ctx = WithGrants(ctx, policy.Grants([]string{"admin"}), Scope{All: true})
+				return WithFields(ctx, policy.Fields)
+			},
+		},
+	}
+
+	for i, d := range data {
+		var result []string
+		for k := range Redactions(d.input(context.Background()), ResourceCustomer) {
+			result = append(result, k)
+		}
+		sort.Strings(result)
+		if !reflect.DeepEqual(result, d.expected) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_CheckBranch(t *testing.T) {
+	policy := newPolicy()
+
+	var data = []struct {
+		desc     string
+		input    func(context.Context) context.Context
+		expected bool
+	}{
+		{
+			desc:  "no grants",
+			input: func(ctx context.Context) context.Context { return ctx },
+		},
+		{
+			desc:     "trusted",
+			input:    WithTrusted,
+			expected: true,
+		},
+		{
+			desc: "branch out of scope",
+			input: func(ctx context.Context) context.Context {
+				return WithGrants(ctx, policy.Grants([]string{"viewer"}), Scope{BranchIds: []string{"other-branch"}})
+			},
+		},
+		{
+			desc: "branch in scope",
+			input: func(ctx context.Context) context.Context {
+				return WithGrants(ctx, policy.Grants([]string{"viewer"}), Scope{BranchIds: []string{"branch"}})
+			},
+			expected: true,
+		},
+	}
+
+	for i, d := range data {
+		err := CheckBranch(d.input(context.Background()), "branch")
+		if result := err == nil; result != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     err,
+			}))
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package rbac
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_strings "github.com/tomwangsvc/lib-svc/strings"
+)
+
+const (
+	// PolicyVersion is the version of the policy file format supported, the version must be bumped when the format changes
+	PolicyVersion = 1
+
+	PermissionCarReadDeleted = "car:read_deleted"
+
+	ResourceCustomer = "customer"
+)
+
+// requiredPermissions are checked in code rather than per route so they must be declared by every policy
+var requiredPermissions = []string{PermissionCarReadDeleted}
+
+// sensitiveFields are the json paths of the fields of each resource that must have a field policy, they are never logged
+var sensitiveFields = map[string][]string{
+	ResourceCustomer: {"age", "ethnicity", "gender"},
+}
+
+type Config struct {
+	PolicyFile string
+}
+
+// Policy maps each route to the permission it requires, each sensitive field to the permission required to read it and each role to the permissions it grants
+type Policy struct {
+	Fields      map[string][]Field  `json:"fields"`
+	Permissions []string            `json:"permissions"`
+	Roles       map[string]Role     `json:"roles"`
+	Routes      []Route             `json:"routes"`
+	Services    map[string][]string `json:"services"`
+	Version     int                 `json:"version"`
+}
+
+type Role struct {
+	// BranchScoped roles only grant their permissions on the cars and rentals of the branch the role is assigned for
+	BranchScoped bool     `json:"branch_scoped"`
+	Permissions  []string `json:"permissions"`
+}
+
+// Field is redacted from the responses of the resource unless the caller is granted the permission
+type Field struct {
+	Path       string `json:"path"`
+	Permission string `json:"permission"`
+}
+
+type Route struct {
+	Method     string `json:"method"`
+	Pattern    string `json:"pattern"`
+	Permission string `json:"permission"`
+}
+
+// LoadPolicy reads and validates the policy file, an invalid policy fails the start up of the service rather than denying requests later
+func LoadPolicy(ctx context.Context, config Config) (*Policy, error) {
+	lib_log.Info(ctx, "Loading", lib_log.FmtAny("config", config))
+
+	b, err := ioutil.ReadFile(config.PolicyFile)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading policy file")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed decoding policy file")
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed validating policy")
+	}
+
+	lib_log.Info(ctx, "Loaded", lib_log.FmtInt("policy.Version", policy.Version), lib_log.FmtInt("len(policy.Routes)", len(policy.Routes)))
+	return &policy, nil
+}
+
+//revive:disable:cyclomatic
+func (p Policy) Validate() error {
+	if p.Version != PolicyVersion {
+		return lib_errors.Errorf("Version %d not supported, expected %d", p.Version, PolicyVersion)
+	}
+
+	permissions := make(map[string]bool)
+	for _, v := range p.Permissions {
+		if v == "" || permissions[v] {
+			return lib_errors.Errorf("Permission %q empty or declared more than once", v)
+		}
+		permissions[v] = true
+	}
+	for _, v := range requiredPermissions {
+		if !permissions[v] {
+			return lib_errors.Errorf("Required permission %q not declared", v)
+		}
+	}
+
+	for name, role := range p.Roles {
+		if name == "" || strings.Contains(name, roleBranchSeparator) {
+			return lib_errors.Errorf("Role name %q not valid", name)
+		}
+		for _, v := range role.Permissions {
+			if !permissions[v] {
+				return lib_errors.Errorf("Permission %q of role %q not declared", v, name)
+			}
+		}
+	}
+
+	for service, roles := range p.Services {
+		for _, v := range roles {
+			if _, ok := p.Roles[v]; !ok {
+				return lib_errors.Errorf("Role %q of service %q not declared", v, service)
+			}
+		}
+	}
+
+	routes := make(map[string]bool)
+	for i, v := range p.Routes {
+		if v.Method == "" || v.Pattern == "" {
+			return lib_errors.Errorf("Route at [%d] requires a method and pattern", i)
+		}
+		if !permissions[v.Permission] {
+			return lib_errors.Errorf("Permission %q of route %s %s not declared", v.Permission, v.Method, v.Pattern)
+		}
+		key := routeKey(v.Method, v.Pattern)
+		if routes[key] {
+			return lib_errors.Errorf("Route %s %s declared more than once", v.Method, v.Pattern)
+		}
+		routes[key] = true
+	}
+
+	for resource, fields := range p.Fields {
+		paths := make(map[string]bool)
+		for _, v := range fields {
+			if v.Path == "" || paths[v.Path] {
+				return lib_errors.Errorf("Field %q of resource %q empty or declared more than once", v.Path, resource)
+			}
+			if !permissions[v.Permission] {
+				return lib_errors.Errorf("Permission %q of field %q of resource %q not declared", v.Permission, v.Path, resource)
+			}
+			paths[v.Path] = true
+		}
+	}
+	for resource, paths := range sensitiveFields {
+		for _, v := range paths {
+			if !p.hasField(resource, v) {
+				return lib_errors.Errorf("Sensitive field %q of resource %q has no field policy", v, resource)
+			}
+		}
+	}
+
+	return nil
+	//revive:enable:cyclomatic
+}
+
+// CheckRoutes checks that every authorized route of the router has a permission in the policy and that every route of the policy exists
+func (p Policy) CheckRoutes(routes chi.Routes, authorized func(pattern string) bool) error {
+	declared := make(map[string]bool)
+	for _, v := range p.Routes {
+		declared[routeKey(v.Method, v.Pattern)] = false
+	}
+
+	var missing []string
+	if err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if !authorized(route) {
+			return nil
+		}
+		key := routeKey(method, route)
+		if _, ok := declared[key]; !ok {
+			missing = append(missing, key)
+			return nil
+		}
+		declared[key] = true
+		return nil
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed walking routes")
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return lib_errors.Errorf("Routes have no permission in policy: %s", strings.Join(missing, ", "))
+	}
+
+	var unknown []string
+	for k, v := range declared {
+		if !v {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return lib_errors.Errorf("Routes in policy do not exist: %s", strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+func (p Policy) hasField(resource, path string) bool {
+	for _, v := range p.Fields[resource] {
+		if v.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Permission returns the permission required by the route matched by the request
+func (p Policy) Permission(method, pattern string) (string, bool) {
+	for _, v := range p.Routes {
+		if v.Method == method && v.Pattern == pattern {
+			return v.Permission, true
+		}
+	}
+	return "", false
+}
+
+// Grants returns the permissions granted by the roles, a role is assigned for a branch with the suffix /branches/{branch_id}.
+// A branch scoped role that is not assigned for a branch grants nothing.
+func (p Policy) Grants(roles []string) Grants {
+	grants := make(Grants)
+	for _, v := range roles {
+		name, branchId := v, ""
+		if i := strings.Index(v, roleBranchSeparator); i >= 0 {
+			name, branchId = v[:i], v[i+len(roleBranchSeparator):]
+		}
+		role, ok := p.Roles[name]
+		if !ok || (role.BranchScoped && branchId == "") {
+			continue
+		}
+		for _, permission := range role.Permissions {
+			scope := grants[permission]
+			if branchId == "" {
+				scope.All = true
+			} else {
+				scope.BranchIds = append(scope.BranchIds, branchId)
+			}
+			grants[permission] = scope
+		}
+	}
+	return grants
+}
+
+// ScopeGrants returns the permissions in the scopes of an api key over all branches, scopes that are not permissions of the policy grant nothing
+func (p Policy) ScopeGrants(scopes []string) Grants {
+	grants := make(Grants)
+	for _, v := range scopes {
+		if lib_strings.Contains(p.Permissions, v) {
+			grants[v] = Scope{All: true}
+		}
+	}
+	return grants
+}
+
+const (
+	roleBranchSeparator = "/branches/"
+)
+
+func routeKey(method, pattern string) string {
+	return method + " " + pattern
+}
@@ -0,0 +1,275 @@
+package rbac
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func newPolicy() Policy {
+	return Policy{
+		Fields: map[string][]Field{
+			ResourceCustomer: {
+				{Path: "age", Permission: "customer:read_sensitive"},
+				{Path: "ethnicity", Permission: "customer:read_sensitive"},
+				{Path: "gender", Permission: "customer:read_sensitive"},
+			},
+		},
+		Permissions: []string{"car:read", "car:write", "customer:read_sensitive", PermissionCarReadDeleted},
+		Roles: map[string]Role{
+			"admin":        {Permissions: []string{"car:read", "car:write", "customer:read_sensitive", PermissionCarReadDeleted}},
+			"branch_agent": {BranchScoped: true, Permissions: []string{"car:read", "car:write"}},
+			"viewer":       {Permissions: []string{"car:read"}},
+		},
+		Routes: []Route{
+			{Method: http.MethodGet, Pattern: "/cars/{id}", Permission: "car:read"},
+			{Method: http.MethodPatch, Pattern: "/cars/{id}", Permission: "car:write"},
+		},
+		Services: map[string][]string{
+			"customer-svc": {"viewer"},
+		},
+		Version: PolicyVersion,
+	}
+}
+
+func Test_LoadPolicy(t *testing.T) {
+	if _, err := LoadPolicy(context.Background(), Config{PolicyFile: "../../../rbac_policy.json"}); err != nil {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "err",
+			Result:     err,
+		}))
+	}
+}
+
+func Test_Policy_Validate(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    func(Policy) Policy
+		expected bool
+	}{
+		{
+			desc:     "valid",
+			input:    func(p Policy) Policy { return p },
+			expected: true,
+		},
+		{
+			desc:  "version not supported",
+			input: func(p Policy) Policy { p.Version = PolicyVersion + 1; return p },
+		},
+		{
+			desc:  "permission declared more than once",
+			input: func(p Policy) Policy { p.Permissions = append(p.Permissions, "car:read"); return p },
+		},
+		{
+			desc: "required permission not declared",
+			input: func(p Policy) Policy {
+				p.Permissions = []string{"car:read", "car:write", "customer:read_sensitive"}
+				return p
+			},
+		},
+		{
+			desc: "role permission not declared",
+			input: func(p Policy) Policy {
+				p.Roles = map[string]Role{"viewer": {Permissions: []string{"car:unknown"}}}
+				return p
+			},
+		},
+		{
+			desc: "role name with branch separator",
+			input: func(p Policy) Policy {
+				p.Roles = map[string]Role{"viewer/branches/x": {Permissions: []string{"car:read"}}}
+				return p
+			},
+		},
+		{
+			desc:  "service role not declared",
+			input: func(p Policy) Policy { p.Services = map[string][]string{"customer-svc": {"unknown"}}; return p },
+		},
+		{
+			desc: "route permission not declared",
+			input: func(p Policy) Policy {
+				p.Routes = []Route{{Method: http.MethodGet, Pattern: "/cars", Permission: "car:unknown"}}
+				return p
+			},
+		},
+		{
+			desc:  "route declared more than once",
+			input: func(p Policy) Policy { p.Routes = append(p.Routes, p.Routes[0]); return p },
+		},
+		{
+			desc: "field permission not declared",
+			input: func(p Policy) Policy {
+				p.Fields = map[string][]Field{ResourceCustomer: append(p.Fields[ResourceCustomer], Field{Path: "name", Permission: "customer:unknown"})}
+				return p
+			},
+		},
+		{
+			desc: "field declared more than once",
+			input: func(p Policy) Policy {
+				p.Fields = map[string][]Field{ResourceCustomer: append(p.Fields[ResourceCustomer], p.Fields[ResourceCustomer][0])}
+				return p
+			},
+		},
+		{
+			desc: "sensitive field has no field policy",
+			input: func(p Policy) Policy {
+				p.Fields = map[string][]Field{ResourceCustomer: p.Fields[ResourceCustomer][1:]}
+				return p
+			},
+		},
+	}
+
+	for i, d := range data {
+		if err := d.input(newPolicy()).Validate(); (err == nil) != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     err,
+			}))
+		}
+	}
+}
+
+func Test_Policy_Grants(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    []string
+		expected Grants
+	}{
+		{
+			desc:     "no roles",
+			expected: Grants{},
+		},
+		{
+			desc:     "unknown role",
+			input:    []string{"unknown"},
+			expected: Grants{},
+		},
+		{
+			desc:     "branch scoped role not assigned for a branch",
+			input:    []string{"branch_agent"},
+			expected: Grants{},
+		},
+		{
+			desc:  "branch scoped role assigned for branches",
+			input: []string{"branch_agent/branches/a", "branch_agent/branches/b"},
+			expected: Grants{
+				"car:read":  {BranchIds: []string{"a", "b"}},
+				"car:write": {BranchIds: []string{"a", "b"}},
+			},
+		},
+		{
+			desc:  "role not scoped and branch scoped role",
+			input: []string{"viewer", "branch_agent/branches/a"},
+			expected: Grants{
+				"car:read":  {All: true, BranchIds: []string{"a"}},
+				"car:write": {BranchIds: []string{"a"}},
+			},
+		},
+	}
+
+	for i, d := range data {
+		if result := newPolicy().Grants(d.input); !reflect.DeepEqual(result, d.expected) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_Policy_ScopeGrants(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    []string
+		expected Grants
+	}{
+		{
+			desc:     "no scopes",
+			expected: Grants{},
+		},
+		{
+			desc:     "scope not a permission",
+			input:    []string{"car:unknown"},
+			expected: Grants{},
+		},
+		{
+			desc:  "scopes granted over all branches",
+			input: []string{"car:read", "car:write"},
+			expected: Grants{
+				"car:read":  {All: true},
+				"car:write": {All: true},
+			},
+		},
+	}
+
+	for i, d := range data {
+		if result := newPolicy().ScopeGrants(d.input); !reflect.DeepEqual(result, d.expected) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_Policy_CheckRoutes(t *testing.T) {
+	handler := func(http.ResponseWriter, *http.Request) {}
+	authorized := func(pattern string) bool { return pattern != "/health" }
+
+	var data = []struct {
+		desc     string
+		input    func(chi.Router)
+		expected bool
+	}{
+		{
+			desc: "every route declared",
+			input: func(r chi.Router) {
+				r.Get("/health", handler)
+				r.Get("/cars/{id}", handler)
+				r.Patch("/cars/{id}", handler)
+			},
+			expected: true,
+		},
+		{
+			desc: "route has no permission",
+			input: func(r chi.Router) {
+				r.Get("/cars/{id}", handler)
+				r.Patch("/cars/{id}", handler)
+				r.Delete("/cars/{id}", handler)
+			},
+		},
+		{
+			desc: "route in policy does not exist",
+			input: func(r chi.Router) {
+				r.Get("/cars/{id}", handler)
+			},
+		},
+	}
+
+	for i, d := range data {
+		r := chi.NewRouter()
+		d.input(r)
+		if err := newPolicy().CheckRoutes(r, authorized); (err == nil) != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     err,
+			}))
+		}
+	}
+}
@@ -1,19 +1,34 @@
 package schema
 
 const (
+	ApiKeyCreate = "api_key_create.json"
+	ApiKeyRotate = "api_key_rotate.json"
+
 	Car        = "car.json"
 	CarCreate  = "car_create.json"
+	CarRevert  = "car_revert.json"
 	Cars       = "cars.json"
+	CarsBatch  = "cars_batch.json"
 	CarsSearch = "cars_search.json"
 	CarUpdate  = "car_update.json"
+
+	CarCustomerAssociationCreate = "car_customer_association_create.json"
+
+	WebhookSubscriptionCreate = "webhook_subscription_create.json"
 )
 
 func SupportedSchema() []string {
 	return []string{
+		ApiKeyCreate,
+		ApiKeyRotate,
 		Car,
 		CarCreate,
+		CarCustomerAssociationCreate,
+		CarRevert,
+		CarsBatch,
 		CarsSearch,
 		Cars,
 		CarUpdate,
+		WebhookSubscriptionCreate,
 	}
 }
@@ -0,0 +1,382 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_misc "github.com/tomwangsvc/lib-svc/misc"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+)
+
+type ApiKey struct {
+	ApiKeyId            string             `json:"api_key_id" spanner:"api_key_id"`
+	Burst               int64              `json:"burst" spanner:"burst"`
+	DailyQuota          int64              `json:"daily_quota" spanner:"daily_quota"`
+	DateCreated         time.Time          `json:"date_created" spanner:"date_created"`
+	DateExpires         time.Time          `json:"date_expires" spanner:"date_expires"`
+	DateRevoked         spanner.NullTime   `json:"date_revoked" spanner:"date_revoked"`
+	DateUpdated         spanner.NullTime   `json:"date_updated" spanner:"date_updated"`
+	KeyHash             string             `json:"-" spanner:"key_hash"`
+	KeyPrefix           string             `json:"key_prefix" spanner:"key_prefix"`
+	LineageApiKeyId     spanner.NullString `json:"-" spanner:"lineage_api_key_id"`
+	Name                string             `json:"name" spanner:"name"`
+	RequestsPerSecond   float64            `json:"requests_per_second" spanner:"requests_per_second"`
+	RotatedFromApiKeyId spanner.NullString `json:"rotated_from_api_key_id" spanner:"rotated_from_api_key_id"`
+	Scopes              []string           `json:"scopes" spanner:"scopes"`
+	TenantId            spanner.NullString `json:"-" spanner:"tenant_id"`
+	Test                bool               `json:"test" spanner:"test"`
+}
+
+// Usable reports whether requests can be authenticated with the key, a rotated key is usable until the end of the overlap as its expiry is brought forward
+func (a ApiKey) Usable(now time.Time) bool {
+	return !a.DateRevoked.Valid && now.Before(a.DateExpires)
+}
+
+// ApiKeyQuotaUsage counts the requests made with the keys of a lineage in a UTC day, it is kept in storage so that the daily quota holds across the instances of the service
+type ApiKeyQuotaUsage struct {
+	DateUpdated     time.Time  `spanner:"date_updated"`
+	Day             civil.Date `spanner:"day"`
+	LineageApiKeyId string     `spanner:"lineage_api_key_id"`
+	Used            int64      `spanner:"used"`
+}
+
+// Lineage returns the id of the key the key was rotated from first, the keys of a lineage share their daily quota. A key created before lineages were recorded is the first of its own
+func (a ApiKey) Lineage() string {
+	if a.LineageApiKeyId.Valid {
+		return a.LineageApiKeyId.StringVal
+	}
+	return a.ApiKeyId
+}
+
+const (
+	tableApiKey           = "api_key"
+	tableApiKeyQuotaUsage = "api_key_quota_usage"
+)
+
+var (
+	ApiKeyColumns       = lib_misc.StructTaggedFieldNames(reflect.TypeOf(ApiKey{}), "spanner")
+	ApiKeyFieldMetaData = lib_json.StructFieldMetadata(reflect.TypeOf(ApiKey{}))
+)
+
+func (c client) CreateApiKey(ctx context.Context, apiKeyCreate dto.ApiKeyCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtString("apiKeyCreate.UserInput.Name", apiKeyCreate.UserInput.Name), lib_log.FmtString("apiKeyCreate.KeyPrefix", apiKeyCreate.KeyPrefix))
+
+	tenantId, err := newTenantId(ctx)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed getting new tenant id")
+	}
+
+	apiKeyId := uuid.New().String()
+	mutApiKey, err := spanner.InsertStruct(tableApiKey, ApiKey{
+		ApiKeyId:          apiKeyId,
+		Burst:             apiKeyCreate.UserInput.Burst,
+		DailyQuota:        apiKeyCreate.UserInput.DailyQuota,
+		DateCreated:       spanner.CommitTimestamp,
+		DateExpires:       apiKeyCreate.UserInput.DateExpires,
+		KeyHash:           apiKeyCreate.KeyHash,
+		KeyPrefix:         apiKeyCreate.KeyPrefix,
+		LineageApiKeyId:   spanner.NullString{StringVal: apiKeyId, Valid: true},
+		Name:              apiKeyCreate.UserInput.Name,
+		RequestsPerSecond: apiKeyCreate.UserInput.RequestsPerSecond,
+		Scopes:            apiKeyCreate.UserInput.Scopes,
+		TenantId:          tenantId,
+		Test:              apiKeyCreate.Test,
+	})
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating mutApiKey for api key")
+	}
+
+	if _, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{mutApiKey}); err != nil {
+		return "", lib_spanner.WrapError(err, "Failed applying api key mutation")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("apiKeyId", apiKeyId))
+	return apiKeyId, nil
+}
+
+func (c client) SearchApiKeys(ctx context.Context, apiKeysSearch dto.ApiKeysSearch) ([]ApiKey, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("apiKeysSearch", apiKeysSearch))
+
+	sqlWhere, params, err := generateSqlWhereAndParamsForTenantSearch(ctx, "test = @test", map[string]interface{}{
+		"test": apiKeysSearch.Test,
+	}, nil)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed generating sql where and params for tenant search")
+	}
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			%s
+			ORDER BY date_created %s
+			LIMIT %d
+			OFFSET %d
+		`,
+			strings.Join(ApiKeyColumns, ", "),
+			tableApiKey,
+			sqlWhere,
+			apiKeysSearch.Pagination.Order,
+			apiKeysSearch.Pagination.Limit,
+			apiKeysSearch.Pagination.Offset,
+		),
+		Params: params,
+	}
+
+	ro := c.spannerClient.ReadOnlyTransaction()
+	defer ro.Close()
+
+	apiKeys, err := queryApiKeys(ctx, ro, stmt)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed querying api keys")
+	}
+
+	pagination, err := readCountForPagination(ctx, ro, apiKeysSearch.Pagination, spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT count(api_key_id) AS count
+			FROM %s
+			%s
+		`,
+			tableApiKey,
+			sqlWhere,
+		),
+		Params: params,
+	})
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed reading count for pagination")
+	}
+	ro.Close()
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(apiKeys)", len(apiKeys)), lib_log.FmtAny("pagination", pagination))
+	return apiKeys, pagination, nil
+}
+
+func queryApiKeys(ctx context.Context, reader lib_spanner.Reader, stmt spanner.Statement) ([]ApiKey, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := reader.Query(ctx, stmt)
+	defer iter.Stop()
+
+	var apiKeys []ApiKey
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, lib_errors.Wrap(err, "Failed iterating api key")
+		}
+
+		var apiKey ApiKey
+		if err := row.ToStruct(&apiKey); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading api key")
+		}
+
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(apiKeys)", len(apiKeys)))
+	return apiKeys, nil
+}
+
+// ReadApiKeyByKeyHash reads the api key a request is authenticated with, a key that does not exist is not found. The read is not constrained to a tenant as the tenant of the request is the tenant of its key
+func (c client) ReadApiKeyByKeyHash(ctx context.Context, keyHash string) (*ApiKey, error) {
+	lib_log.Info(ctx, "Reading")
+
+	apiKeys, err := queryApiKeys(ctx, c.spannerClient.Single(), spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT %s
+			FROM %s@{FORCE_INDEX=api_key_by_key_hash}
+			WHERE key_hash = @key_hash
+		`,
+			strings.Join(ApiKeyColumns, ", "),
+			tableApiKey,
+		),
+		Params: map[string]interface{}{
+			"key_hash": keyHash,
+		},
+	})
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed querying api keys")
+	}
+	if len(apiKeys) == 0 {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtString("apiKeys[0].ApiKeyId", apiKeys[0].ApiKeyId))
+	return &apiKeys[0], nil
+}
+
+// RotateApiKey creates a new key with the scopes and limits of the key it replaces, the old key expires at the end of the overlap unless it expires sooner
+func (c client) RotateApiKey(ctx context.Context, apiKeyRotate dto.ApiKeyRotate) (string, error) {
+	lib_log.Info(ctx, "Rotating", lib_log.FmtString("apiKeyRotate.Id", apiKeyRotate.Id), lib_log.FmtString("apiKeyRotate.KeyPrefix", apiKeyRotate.KeyPrefix), lib_log.FmtDuration("apiKeyRotate.Overlap", apiKeyRotate.Overlap))
+
+	apiKeyId := uuid.New().String()
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		apiKey, err := readApiKey(ctx, txn, apiKeyRotate.Id, apiKeyRotate.Test)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading api key")
+		}
+		now := time.Now()
+		if !apiKey.Usable(now) {
+			return lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityApiKeyRevokedOrExpired)
+		}
+
+		mutApiKey, err := spanner.InsertStruct(tableApiKey, newRotatedApiKey(*apiKey, apiKeyId, apiKeyRotate))
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating mutApiKey for api key")
+		}
+		mutations := []*spanner.Mutation{mutApiKey}
+
+		if dateOverlapEnd := now.Add(apiKeyRotate.Overlap); dateOverlapEnd.Before(apiKey.DateExpires) {
+			mutations = append(mutations, spanner.Update(tableApiKey, []string{"api_key_id", "date_expires", "date_updated"}, []interface{}{apiKey.ApiKeyId, dateOverlapEnd, spanner.CommitTimestamp}))
+		}
+
+		if err := txn.BufferWrite(mutations); err != nil {
+			return lib_errors.Wrap(err, "Failed buffering mutations")
+		}
+
+		return nil
+	}); err != nil {
+		return "", lib_spanner.WrapError(err, "Failed rotating api key")
+	}
+
+	lib_log.Info(ctx, "Rotated", lib_log.FmtString("apiKeyId", apiKeyId))
+	return apiKeyId, nil
+}
+
+func newRotatedApiKey(apiKey ApiKey, apiKeyId string, apiKeyRotate dto.ApiKeyRotate) ApiKey {
+	return ApiKey{
+		ApiKeyId:            apiKeyId,
+		Burst:               apiKey.Burst,
+		DailyQuota:          apiKey.DailyQuota,
+		DateCreated:         spanner.CommitTimestamp,
+		DateExpires:         apiKeyRotate.UserInput.DateExpires,
+		KeyHash:             apiKeyRotate.KeyHash,
+		KeyPrefix:           apiKeyRotate.KeyPrefix,
+		LineageApiKeyId:     spanner.NullString{StringVal: apiKey.Lineage(), Valid: true},
+		Name:                apiKey.Name,
+		RequestsPerSecond:   apiKey.RequestsPerSecond,
+		RotatedFromApiKeyId: spanner.NullString{StringVal: apiKey.ApiKeyId, Valid: true},
+		Scopes:              apiKey.Scopes,
+		TenantId:            apiKey.TenantId,
+		Test:                apiKey.Test,
+	}
+}
+
+// RevokeApiKey stops the key from authenticating requests at once, revoking a revoked key has no effect
+func (c client) RevokeApiKey(ctx context.Context, apiKeyRevoke dto.ApiKeyRevoke) error {
+	lib_log.Info(ctx, "Revoking", lib_log.FmtAny("apiKeyRevoke", apiKeyRevoke))
+
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		apiKey, err := readApiKey(ctx, txn, apiKeyRevoke.Id, apiKeyRevoke.Test)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading api key")
+		}
+		if apiKey.DateRevoked.Valid {
+			lib_log.Info(ctx, "Api key already revoked", lib_log.FmtTime("apiKey.DateRevoked.Time", apiKey.DateRevoked.Time))
+			return nil
+		}
+
+		if err := txn.BufferWrite([]*spanner.Mutation{spanner.Update(tableApiKey, []string{"api_key_id", "date_revoked", "date_updated"}, []interface{}{apiKey.ApiKeyId, spanner.CommitTimestamp, spanner.CommitTimestamp})}); err != nil {
+			return lib_errors.Wrap(err, "Failed buffering mutations")
+		}
+
+		return nil
+	}); err != nil {
+		return lib_spanner.WrapError(err, "Failed revoking api key")
+	}
+
+	lib_log.Info(ctx, "Revoked")
+	return nil
+}
+
+func readApiKey(ctx context.Context, reader lib_spanner.Reader, apiKeyId string, test bool) (*ApiKey, error) {
+	var apiKey ApiKey
+	if err := readByIdForTenant(ctx, reader, tableApiKey, ApiKeyColumns, apiKeyId, &apiKey); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading api key by id")
+	}
+
+	if apiKey.Test != test {
+		return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+	}
+
+	return &apiKey, nil
+}
+
+// ConsumeApiKeyQuota counts a request against the daily quota of the lineage of a key and returns the requests counted on the day, a request over the quota is not counted and is refused
+func (c client) ConsumeApiKeyQuota(ctx context.Context, lineageApiKeyId string, day civil.Date, dailyQuota int64) (int64, error) {
+	lib_log.Info(ctx, "Consuming", lib_log.FmtString("lineageApiKeyId", lineageApiKeyId), lib_log.FmtString("day", day.String()), lib_log.FmtInt64("dailyQuota", dailyQuota))
+
+	var used int64
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		used = 0
+		row, err := txn.ReadRow(ctx, tableApiKeyQuotaUsage, spanner.Key{lineageApiKeyId, day}, []string{"used"})
+		if err != nil && spanner.ErrCode(err) != codes.NotFound {
+			return lib_errors.Wrap(err, "Failed reading api key quota usage")
+		}
+		if err == nil {
+			if err := row.Column(0, &used); err != nil {
+				return lib_errors.Wrap(err, "Failed reading used of api key quota usage")
+			}
+		}
+		if used >= dailyQuota {
+			return lib_errors.NewCustom(http.StatusTooManyRequests, constants.TooManyRequestsQuotaExceeded)
+		}
+		used++
+
+		mutApiKeyQuotaUsage, err := spanner.InsertOrUpdateStruct(tableApiKeyQuotaUsage, ApiKeyQuotaUsage{
+			DateUpdated:     spanner.CommitTimestamp,
+			Day:             day,
+			LineageApiKeyId: lineageApiKeyId,
+			Used:            used,
+		})
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating mutApiKeyQuotaUsage for api key quota usage")
+		}
+		if err := txn.BufferWrite([]*spanner.Mutation{mutApiKeyQuotaUsage}); err != nil {
+			return lib_errors.Wrap(err, "Failed buffering mutations")
+		}
+
+		return nil
+	}); err != nil {
+		return 0, lib_spanner.WrapError(err, "Failed consuming api key quota")
+	}
+
+	lib_log.Info(ctx, "Consumed", lib_log.FmtInt64("used", used))
+	return used, nil
+}
+
+func (c client) TransformApiKeysToJson(ctx context.Context, apiKeys []ApiKey) ([]byte, error) {
+	lib_log.Info(ctx, "Transforming", lib_log.FmtInt("len(apiKeys)", len(apiKeys)))
+
+	if len(apiKeys) == 0 {
+		lib_log.Info(ctx, "Transformed")
+		return nil, nil
+	}
+	var apiKeysList []interface{}
+	for _, v := range apiKeys {
+		apiKeysList = append(apiKeysList, v)
+	}
+	apiKeysListJson, err := lib_json.GenerateJsonList(apiKeysList, ApiKeyFieldMetaData, "")
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed generating json list")
+	}
+
+	lib_log.Info(ctx, "Transformed", lib_log.FmtInt("len(apiKeysListJson)", len(apiKeysListJson)))
+	return apiKeysListJson, nil
+}
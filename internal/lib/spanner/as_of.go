@@ -0,0 +1,95 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+	"google.golang.org/api/iterator"
+)
+
+// defaultVersionRetentionPeriod is the version_retention_period of a database that has not set it
+const defaultVersionRetentionPeriod = time.Hour
+
+// readVersionRetentionPeriod reads the version_retention_period of the database, it is read when the client is created so a change of the option applies once the service restarts
+func readVersionRetentionPeriod(ctx context.Context, reader lib_spanner.Reader) (time.Duration, error) {
+	stmt := spanner.Statement{
+		SQL: `
+			SELECT OPTION_VALUE
+			FROM INFORMATION_SCHEMA.DATABASE_OPTIONS
+			WHERE SCHEMA_NAME = ''
+			AND OPTION_NAME = 'version_retention_period'
+		`,
+	}
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := reader.Query(ctx, stmt)
+	defer iter.Stop()
+
+	row, err := iter.Next()
+	if err != nil {
+		if err == iterator.Done {
+			lib_log.Info(ctx, "Read, version retention period not set", lib_log.FmtDuration("defaultVersionRetentionPeriod", defaultVersionRetentionPeriod))
+			return defaultVersionRetentionPeriod, nil
+		}
+		return 0, lib_errors.Wrap(err, "Failed iterating database options")
+	}
+	var optionValue string
+	if err := row.Columns(&optionValue); err != nil {
+		return 0, lib_errors.Wrap(err, "Failed reading option value")
+	}
+
+	versionRetentionPeriod, err := parseVersionRetentionPeriod(optionValue)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed parsing version retention period")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtDuration("versionRetentionPeriod", versionRetentionPeriod))
+	return versionRetentionPeriod, nil
+}
+
+// parseVersionRetentionPeriod parses the value of version_retention_period, a number of days with a d suffix or a duration in hours, minutes or seconds e.g. 7d, 36h, 90m or 3600s
+func parseVersionRetentionPeriod(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, lib_errors.Wrapf(err, "Failed parsing days of %q", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	versionRetentionPeriod, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, lib_errors.Wrapf(err, "Failed parsing duration %q", value)
+	}
+	return versionRetentionPeriod, nil
+}
+
+// withAsOf makes the read only transaction an exact timestamp stale read when a time is requested, the time must be within the version retention period of the database as older versions have been garbage collected
+func (c client) withAsOf(ro *spanner.ReadOnlyTransaction, asOf *time.Time) (*spanner.ReadOnlyTransaction, error) {
+	if asOf == nil {
+		return ro, nil
+	}
+
+	if err := checkAsOf(*asOf, c.config.VersionRetentionPeriod); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking as of")
+	}
+
+	return ro.WithTimestampBound(spanner.ReadTimestamp(*asOf)), nil
+}
+
+func checkAsOf(asOf time.Time, versionRetentionPeriod time.Duration) error {
+	now := time.Now()
+	if asOf.After(now) || asOf.Before(now.Add(-versionRetentionPeriod)) {
+		return lib_errors.NewCustomWithMetadata(http.StatusBadRequest, constants.BadRequestAsOfOutsideVersionRetention, map[string]interface{}{
+			"as_of": constants.BadRequestAsOfOutsideVersionRetention,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package spanner
+
+import (
+	"testing"
+	"time"
+
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_parseVersionRetentionPeriod(t *testing.T) {
+	type expected struct {
+		versionRetentionPeriod time.Duration
+		err                    bool
+	}
+	var data = []struct {
+		desc     string
+		input    string
+		expected expected
+	}{
+		{
+			desc:     "days",
+			input:    "7d",
+			expected: expected{versionRetentionPeriod: 7 * 24 * time.Hour},
+		},
+		{
+			desc:     "hours",
+			input:    "36h",
+			expected: expected{versionRetentionPeriod: 36 * time.Hour},
+		},
+		{
+			desc:     "seconds",
+			input:    "3600s",
+			expected: expected{versionRetentionPeriod: time.Hour},
+		},
+		{
+			desc:     "not a number of days",
+			input:    "sevend",
+			expected: expected{err: true},
+		},
+		{
+			desc:     "not a duration",
+			input:    "one hour",
+			expected: expected{err: true},
+		},
+	}
+
+	for i, d := range data {
+		versionRetentionPeriod, err := parseVersionRetentionPeriod(d.input)
+		if (err != nil) != d.expected.err {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.err,
+				Result:     err,
+			}))
+		}
+		if versionRetentionPeriod != d.expected.versionRetentionPeriod {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "versionRetentionPeriod",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.versionRetentionPeriod,
+				Result:     versionRetentionPeriod,
+			}))
+		}
+	}
+}
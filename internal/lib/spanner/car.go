@@ -3,7 +3,10 @@ package spanner
 import (
 	"car-svc/internal/lib/constants"
 	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/patch"
+	"car-svc/internal/lib/rbac"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -18,16 +21,21 @@ import (
 	lib_misc "github.com/tomwangsvc/lib-svc/misc"
 	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
 	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+	lib_strings "github.com/tomwangsvc/lib-svc/strings"
 	"google.golang.org/api/iterator"
 )
 
+// Car fields are tagged with a filter matching their json name so that a list of fields can be passed as the filterBy of lib_json.GenerateJson
 type Car struct {
-	BrandName   string           `json:"brand_name" spanner:"brand_name"`
-	CarId       string           `json:"car_id" spanner:"car_id"`
-	DateCreated time.Time        `json:"date_created" spanner:"date_created"`
-	DateUpdated spanner.NullTime `json:"date_updated" spanner:"date_updated"`
-	ModelName   string           `json:"model_name" spanner:"model_name"`
-	Test        bool             `json:"test" spanner:"test"`
+	BranchId    spanner.NullString `json:"branch_id" spanner:"branch_id" filter:"branch_id"`
+	BrandName   string             `json:"brand_name" spanner:"brand_name" filter:"brand_name"`
+	CarId       string             `json:"car_id" spanner:"car_id" filter:"car_id"`
+	DateCreated time.Time          `json:"date_created" spanner:"date_created" filter:"date_created"`
+	DateDeleted spanner.NullTime   `json:"date_deleted" spanner:"date_deleted" filter:"date_deleted"`
+	DateUpdated spanner.NullTime   `json:"date_updated" spanner:"date_updated" filter:"date_updated"`
+	ModelName   spanner.NullString `json:"model_name" spanner:"model_name" filter:"model_name"`
+	TenantId    spanner.NullString `json:"-" spanner:"tenant_id"`
+	Test        bool               `json:"test" spanner:"test" filter:"test"`
 }
 
 const (
@@ -37,12 +45,24 @@ const (
 var (
 	CarColumns       = lib_misc.StructTaggedFieldNames(reflect.TypeOf(Car{}), "spanner")
 	CarFieldMetaData = lib_json.StructFieldMetadata(reflect.TypeOf(Car{}))
+	// CarExportColumns are exported when no fields are requested, they are listed rather than derived from Car so that a column added to the table is not exported until it is added here
+	CarExportColumns = []string{"branch_id", "brand_name", "car_id", "date_created", "date_deleted", "date_updated", "model_name", "test"}
+
+	// The branch of a car is set when it is created, moving a car to another branch is not supported
+	carFieldsReadOnly = []string{"branch_id", "car_id", "date_created", "date_deleted", "date_updated", "test"}
 )
 
-func (c client) TransformCarToJson(ctx context.Context, car Car) ([]byte, error) {
-	lib_log.Info(ctx, "Transforming", lib_log.FmtAny("car", car))
+const (
+	// sqlWhereCarNotDeleted excludes the tombstones of soft deleted cars
+	sqlWhereCarNotDeleted = "date_deleted IS NULL"
+)
+
+type CheckCar func(ctx context.Context, car []byte) error
+
+func (c client) TransformCarToJson(ctx context.Context, car Car, fields []string) ([]byte, error) {
+	lib_log.Info(ctx, "Transforming", lib_log.FmtAny("car", car), lib_log.FmtStrings("fields", fields))
 
-	ca, err := lib_json.GenerateJson(car, CarFieldMetaData, "")
+	ca, err := lib_json.GenerateJson(car, CarFieldMetaData, strings.Join(fields, ","))
 	if err != nil {
 		return nil, lib_errors.Wrap(err, "Failed generating response")
 	}
@@ -51,8 +71,8 @@ func (c client) TransformCarToJson(ctx context.Context, car Car) ([]byte, error)
 	return ca, nil
 }
 
-func (c client) TransformCarsToJson(ctx context.Context, cars []Car) ([]byte, error) {
-	lib_log.Info(ctx, "Transforming", lib_log.FmtInt("len(cars)", len(cars)))
+func (c client) TransformCarsToJson(ctx context.Context, cars []Car, fields []string) ([]byte, error) {
+	lib_log.Info(ctx, "Transforming", lib_log.FmtInt("len(cars)", len(cars)), lib_log.FmtStrings("fields", fields))
 
 	if len(cars) == 0 {
 		lib_log.Info(ctx, "Transformed")
@@ -62,7 +82,7 @@ func (c client) TransformCarsToJson(ctx context.Context, cars []Car) ([]byte, er
 	for _, v := range cars {
 		carsList = append(carsList, v)
 	}
-	carsListJson, err := lib_json.GenerateJsonList(carsList, CarFieldMetaData, "")
+	carsListJson, err := lib_json.GenerateJsonList(carsList, CarFieldMetaData, strings.Join(fields, ","))
 	if err != nil {
 		return nil, lib_errors.Wrap(err, "Failed generating json list")
 	}
@@ -71,65 +91,193 @@ func (c client) TransformCarsToJson(ctx context.Context, cars []Car) ([]byte, er
 	return carsListJson, nil
 }
 
+// carExportColumnsForFields returns the columns to select for the requested fields of an export, the export columns are returned when no fields are requested
+func carExportColumnsForFields(fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		return CarExportColumns, nil
+	}
+	return carColumnsForFields(fields)
+}
+
+// carColumnsForFields returns the columns to select for the requested fields, all columns are returned when no fields are requested and a field requested twice is selected once
+func carColumnsForFields(fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		return CarColumns, nil
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		if seen[field] {
+			continue
+		}
+		seen[field] = true
+		var recognized bool
+		for _, v := range CarFieldMetaData {
+			if v.JsonTag == field {
+				recognized = true
+				break
+			}
+		}
+		if !recognized {
+			return nil, lib_errors.NewCustomf(http.StatusBadRequest, "Not recognized: fields = %s", field)
+		}
+		columns = append(columns, field)
+	}
+
+	return columns, nil
+}
+
 func (c client) CreateCar(ctx context.Context, carCreate dto.CarCreate) (string, error) {
 	lib_log.Info(ctx, "Creating", lib_log.FmtAny("carCreate", carCreate), lib_log.FmtAny("c.config", c.config))
 
-	var car Car
+	var carId string
 	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
-		count, err := readCount(ctx, tx, spanner.Statement{
-			SQL: fmt.Sprintf(`
-				SELECT count(car_id) AS count
-				FROM %s
-				WHERE brand_name = @brand_name
-				AND model_name = @model_name
-			`,
-				tableCar,
-			),
-			Params: map[string]interface{}{
-				"brand_name": carCreate.UserInput.BrandName,
-				"model_name": carCreate.UserInput.ModelName,
-			}})
-		if err != nil {
-			return lib_errors.Wrap(err, "Failed counting cars")
-		}
-		if count > 0 {
-			return lib_errors.NewCustom(http.StatusConflict, "Already exist")
+		if carCreate.IdempotencyKey != nil {
+			idempotentResponse, err := readIdempotentResponse(ctx, tx, *carCreate.IdempotencyKey)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed reading idempotent response")
+			}
+			if idempotentResponse != nil {
+				lib_log.Info(ctx, "Replaying idempotent response", lib_log.FmtAny("idempotentResponse", idempotentResponse))
+				carId = idempotentResponse.Location
+				return nil
+			}
 		}
 
-		car = newCar(carCreate)
-		mutCar, err := spanner.InsertStruct(tableCar, car)
+		car, mutations, err := newCarCreateMutations(ctx, tx, carCreate)
 		if err != nil {
-			return lib_errors.Wrap(err, "Failed creating mutCar for car")
+			return lib_errors.Wrap(err, "Failed creating car create mutations")
 		}
 
-		if err := tx.BufferWrite([]*spanner.Mutation{mutCar}); err != nil {
+		if carCreate.IdempotencyKey != nil {
+			mutIdempotencyKey, err := newIdempotencyKeyMutation(ctx, *carCreate.IdempotencyKey, dto.IdempotentResponse{
+				Location:   car.CarId,
+				StatusCode: http.StatusCreated,
+			}, c.config.IdempotencyKeyTtl, carCreate.Test)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed creating idempotency key mutation")
+			}
+			mutations = append(mutations, mutIdempotencyKey)
+		}
+
+		if err := tx.BufferWrite(mutations); err != nil {
 			return lib_errors.Wrap(err, "Failed creating car")
 		}
 
+		carId = car.CarId
 		return nil
 
 	}); err != nil {
 		return "", lib_spanner.WrapError(err, "Failed executing read write transaction")
 	}
 
-	lib_log.Info(ctx, "Created", lib_log.FmtAny("car", car))
-	return car.CarId, nil
+	lib_log.Info(ctx, "Created", lib_log.FmtString("carId", carId))
+	return carId, nil
 }
 
-func newCar(carCreate dto.CarCreate) Car {
+// newCarCreateMutations checks that the car is created in a branch of the caller and that no car with the same brand and model exists, and creates the mutations inserting the new car and its history
+func newCarCreateMutations(ctx context.Context, reader lib_spanner.Reader, carCreate dto.CarCreate) (*Car, []*spanner.Mutation, error) {
+	if err := checkCarCreate(ctx, carCreate); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed checking car create")
+	}
+
+	count, err := readCountCarsWithBrandAndModelName(ctx, reader, carCreate.UserInput.BrandName, carCreate.UserInput.ModelName)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed counting cars with brand and model name")
+	}
+	if count > 0 {
+		return nil, nil, lib_errors.NewCustom(http.StatusConflict, "Already exist")
+	}
+
+	car, err := newCar(ctx, carCreate)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating car")
+	}
+	mutations, err := newCarInsertMutations(ctx, car)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating car insert mutations")
+	}
+	return &car, mutations, nil
+}
+
+func checkCarCreate(ctx context.Context, carCreate dto.CarCreate) error {
+	var branchId string
+	if carCreate.UserInput.BranchId != nil {
+		branchId = *carCreate.UserInput.BranchId
+	}
+	if err := rbac.CheckBranch(ctx, branchId); err != nil {
+		return lib_errors.Wrap(err, "Failed checking branch of car")
+	}
+	return nil
+}
+
+// readCountCarsWithBrandAndModelName counts the cars of the tenant with the brand and model name that have not been soft deleted, the names of a car are unique within its tenant
+func readCountCarsWithBrandAndModelName(ctx context.Context, reader lib_spanner.Reader, brandName string, modelName interface{}) (int64, error) {
+	sqlWhere, params, err := generateSqlWhereAndParamsForTenantSearch(ctx, fmt.Sprintf("brand_name = @brand_name AND model_name = @model_name AND %s", sqlWhereCarNotDeleted), map[string]interface{}{
+		"brand_name": brandName,
+		"model_name": modelName,
+	}, nil)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed generating sql where and params for tenant search")
+	}
+
+	return readCount(ctx, reader, spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT count(car_id) AS count
+			FROM %s
+			%s
+		`,
+			tableCar,
+			sqlWhere,
+		),
+		Params: params,
+	})
+}
+
+func newCarInsertMutations(ctx context.Context, car Car) ([]*spanner.Mutation, error) {
+	mutCar, err := spanner.InsertStruct(tableCar, car)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating mutCar for car")
+	}
+	mutCarChanges, err := newCarChangeMutations(ctx, dto.CarHistoryOperationCreate, car.CarId, nil, &car, car.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating car change mutations")
+	}
+	return append([]*spanner.Mutation{mutCar}, mutCarChanges...), nil
+}
+
+// newCar creates a car in the tenant of the caller
+func newCar(ctx context.Context, carCreate dto.CarCreate) (Car, error) {
+	tenantId, err := newTenantId(ctx)
+	if err != nil {
+		return Car{}, lib_errors.Wrap(err, "Failed getting new tenant id")
+	}
+
+	var branchId spanner.NullString
+	if carCreate.UserInput.BranchId != nil {
+		branchId = spanner.NullString{StringVal: *carCreate.UserInput.BranchId, Valid: true}
+	}
 	return Car{
+		BranchId:    branchId,
 		BrandName:   carCreate.UserInput.BrandName,
 		CarId:       uuid.New().String(),
 		DateCreated: spanner.CommitTimestamp,
-		ModelName:   carCreate.UserInput.ModelName,
+		ModelName:   spanner.NullString{StringVal: carCreate.UserInput.ModelName, Valid: true},
+		TenantId:    tenantId,
 		Test:        carCreate.Test,
-	}
+	}, nil
 }
 
 func (c client) SearchCars(ctx context.Context, carsSearch dto.CarsSearch) ([]Car, *lib_pagination.Pagination, error) {
 	lib_log.Info(ctx, "Searching", lib_log.FmtAny("carsSearch", carsSearch))
 
-	sqlFilters, params, err := lib_spanner.GenerateSqlWhereAndParamsForSearchV2(carsSearch.Filters.LinkedFilters)
+	columns, err := carColumnsForFields(carsSearch.Fields)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed getting car columns for fields")
+	}
+
+	sqlFilters, params, err := generateSqlWhereAndParamsForCarsSearch(ctx, carsSearch.Filters)
 	if err != nil {
 		return nil, nil, lib_errors.Wrap(err, "Failed generating sql where and params for search")
 	}
@@ -141,7 +289,7 @@ func (c client) SearchCars(ctx context.Context, carsSearch dto.CarsSearch) ([]Ca
 		LIMIT %d
 		OFFSET %d
 		`,
-		strings.Join(CarColumns, ", "),
+		strings.Join(columns, ", "),
 		tableCar,
 		sqlFilters,
 		carsSearch.Pagination.Order,
@@ -154,8 +302,12 @@ func (c client) SearchCars(ctx context.Context, carsSearch dto.CarsSearch) ([]Ca
 		Params: params,
 	}
 
-	ro := c.spannerClient.ReadOnlyTransaction()
-	defer ro.Close()
+	txn := c.spannerClient.ReadOnlyTransaction()
+	defer txn.Close()
+	ro, err := c.withAsOf(txn, carsSearch.AsOf)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed reading as of")
+	}
 
 	iter := ro.Query(ctx, stmt)
 	defer iter.Stop()
@@ -194,21 +346,33 @@ func (c client) SearchCars(ctx context.Context, carsSearch dto.CarsSearch) ([]Ca
 	if err != nil {
 		return nil, nil, lib_errors.Wrap(err, "Failed reading count for pagination")
 	}
-	ro.Close()
 
 	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(cars)", len(cars)), lib_log.FmtAny("pagination", pagination))
 	return cars, pagination, nil
 }
 
-func readCountForPagination(ctx context.Context, r lib_spanner.Reader, pagination lib_pagination.Pagination, stmt spanner.Statement) (*lib_pagination.Pagination, error) {
+// generateSqlWhereAndParamsForCarsSearch constrains the search to the tenant of the caller and excludes soft deleted cars unless they are included by the filters
+func generateSqlWhereAndParamsForCarsSearch(ctx context.Context, filters dto.CarsSearchFilters) (string, map[string]interface{}, error) {
+	if filters.IncludeDeleted {
+		return generateSqlWhereAndParamsForTenantSearch(ctx, "", nil, filters.LinkedFilters)
+	}
+	return generateSqlWhereAndParamsForTenantSearch(ctx, sqlWhereCarNotDeleted, nil, filters.LinkedFilters)
+}
+
+// readCountForPagination reports the timestamp the transaction read at, so that a page read as of a time is not reported as read now
+func readCountForPagination(ctx context.Context, ro *spanner.ReadOnlyTransaction, pagination lib_pagination.Pagination, stmt spanner.Statement) (*lib_pagination.Pagination, error) {
 	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
-	count, err := readCount(ctx, r, stmt)
+	count, err := readCount(ctx, ro, stmt)
 	if err != nil {
 		return nil, lib_errors.Wrap(err, "Failed reading count")
 	}
 	pagination.Total = &count
-	timeNow := time.Now().UTC()
-	pagination.ReadTimestamp = &timeNow
+	readTimestamp, err := ro.Timestamp()
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting read timestamp")
+	}
+	readTimestamp = readTimestamp.UTC()
+	pagination.ReadTimestamp = &readTimestamp
 	lib_log.Info(ctx, "Read", lib_log.FmtAny("pagination", pagination))
 	return &pagination, nil
 }
@@ -237,20 +401,54 @@ func readCount(ctx context.Context, r lib_spanner.Reader, stmt spanner.Statement
 func (c client) ReadCar(ctx context.Context, carRead dto.CarRead) (*Car, error) {
 	lib_log.Info(ctx, "Reading", lib_log.FmtAny("carRead", carRead))
 
-	car, err := readCar(ctx, c.spannerClient.Single(), carRead.Id)
+	columns, err := carColumnsForFields(carRead.Fields)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting car columns for fields")
+	}
+
+	if !carRead.IncludeDeleted && !lib_strings.Contains(columns, "date_deleted") {
+		columns = append(append([]string(nil), columns...), "date_deleted")
+	}
+
+	txn := c.spannerClient.Single()
+	defer txn.Close()
+	ro, err := c.withAsOf(txn, carRead.AsOf)
 	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading as of")
+	}
+
+	var car Car
+	if err := readByIdForTenant(ctx, ro, tableCar, columns, carRead.Id, &car); err != nil {
 		return nil, lib_errors.Wrap(err, "Failed reading car")
 	}
 
+	if !carRead.IncludeDeleted && car.DateDeleted.Valid {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+
 	lib_log.Info(ctx, "Read", lib_log.FmtAny("car", car))
-	return car, nil
+	return &car, nil
 }
 
+// readCar reads a car that has not been soft deleted, a soft deleted car is not found
 func readCar(ctx context.Context, reader lib_spanner.Reader, carId string) (*Car, error) {
+	car, err := readCarIncludingDeleted(ctx, reader, carId)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car including deleted")
+	}
+
+	if car.DateDeleted.Valid {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+
+	return car, nil
+}
+
+func readCarIncludingDeleted(ctx context.Context, reader lib_spanner.Reader, carId string) (*Car, error) {
 	lib_log.Info(ctx, "reading", lib_log.FmtString("carId", carId))
 
 	var car Car
-	if err := lib_spanner.ReadById(ctx, reader, tableCar, CarColumns, carId, &car); err != nil {
+	if err := readByIdForTenant(ctx, reader, tableCar, CarColumns, carId, &car); err != nil {
 		return nil, lib_errors.Wrap(err, "Failed reading car")
 	}
 
@@ -262,17 +460,13 @@ func (c client) UpdateCar(ctx context.Context, carUpdate dto.CarUpdate) error {
 	lib_log.Info(ctx, "Updating", lib_log.FmtAny("carUpdate", carUpdate))
 
 	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
-		car, err := readCar(ctx, tx, carUpdate.Id)
+		mutations, err := newCarUpdateMutations(ctx, tx, carUpdate)
 		if err != nil {
-			return lib_errors.Wrap(err, "Failed reading car")
+			return lib_errors.Wrap(err, "Failed creating car update mutations")
 		}
 
-		if car.Test != carUpdate.Test {
-			return lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
-		}
-
-		if err := tx.BufferWrite([]*spanner.Mutation{spanner.UpdateMap(tableCar, newCarUpdateMap(carUpdate))}); err != nil {
-			return lib_errors.Wrap(err, "Failed creating car")
+		if err := tx.BufferWrite(mutations); err != nil {
+			return lib_errors.Wrap(err, "Failed updating car")
 		}
 
 		lib_log.Info(ctx, "Updated", lib_log.FmtAny("carUpdate", carUpdate))
@@ -285,39 +479,274 @@ func (c client) UpdateCar(ctx context.Context, carUpdate dto.CarUpdate) error {
 	return nil
 }
 
-func newCarUpdateMap(carUpdate dto.CarUpdate) map[string]interface{} {
-	carUpdateMap := map[string]interface{}{
-		"car_id":       carUpdate.Id,
-		"date_updated": spanner.CommitTimestamp,
+// newCarUpdateMutations checks the car can be accessed and creates the mutations updating it and appending its history
+func newCarUpdateMutations(ctx context.Context, reader lib_spanner.Reader, carUpdate dto.CarUpdate) ([]*spanner.Mutation, error) {
+	car, err := readCarForUpdate(ctx, reader, carUpdate.Id, carUpdate.IfUnmodifiedSince, carUpdate.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car for update")
+	}
+
+	return newCarUpdatedMutations(ctx, dto.CarHistoryOperationUpdate, *car, newUpdatedCar(*car, carUpdate.UserInput))
+}
+
+// newUpdatedCar returns the car with the user input fields that are set
+func newUpdatedCar(car Car, carUpdateUserInput dto.CarUpdateUserInput) Car {
+	if carUpdateUserInput.BrandName != nil {
+		car.BrandName = *carUpdateUserInput.BrandName
+	}
+	if carUpdateUserInput.ModelName != nil {
+		car.ModelName = spanner.NullString{StringVal: *carUpdateUserInput.ModelName, Valid: true}
+	}
+	return car
+}
+
+// readCarForUpdate reads the car to update and checks it can be accessed and has not been modified since the time the caller last read it
+func readCarForUpdate(ctx context.Context, reader lib_spanner.Reader, carId string, ifUnmodifiedSince *time.Time, test bool) (*Car, error) {
+	car, err := readCar(ctx, reader, carId)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car")
+	}
+
+	if err := checkCarForUpdate(ctx, *car, ifUnmodifiedSince, test); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking car for update")
+	}
+
+	return car, nil
+}
+
+func checkCarForUpdate(ctx context.Context, car Car, ifUnmodifiedSince *time.Time, test bool) error {
+	if err := checkCarAccess(ctx, car, test); err != nil {
+		return lib_errors.Wrap(err, "Failed checking car access")
+	}
+
+	if ifUnmodifiedSince != nil {
+		dateModified := car.DateCreated
+		if car.DateUpdated.Valid {
+			dateModified = car.DateUpdated.Time
+		}
+		if dateModified.After(*ifUnmodifiedSince) {
+			return lib_errors.NewCustom(http.StatusPreconditionFailed, constants.PreconditionFailedModifiedSince)
+		}
+	}
+
+	return nil
+}
+
+// checkCarAccess checks the car can be changed by the caller, a car is only changed by a caller with the same test flag and with access to its branch
+func checkCarAccess(ctx context.Context, car Car, test bool) error {
+	if car.Test != test {
+		return lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
 	}
-	if carUpdate.UserInput.BrandName != nil {
-		carUpdateMap["brand_name"] = *carUpdate.UserInput.BrandName
+
+	if err := rbac.CheckBranch(ctx, car.BranchId.StringVal); err != nil {
+		return lib_errors.Wrap(err, "Failed checking branch of car")
 	}
-	if carUpdate.UserInput.ModelName != nil {
-		carUpdateMap["model_name"] = *carUpdate.UserInput.ModelName
+
+	return nil
+}
+
+// newCarUpdatedMutations creates the mutations writing the user input fields of the updated car and appending the change to its history
+func newCarUpdatedMutations(ctx context.Context, operation string, car, updatedCar Car) ([]*spanner.Mutation, error) {
+	mutCarChanges, err := newCarChangeMutations(ctx, operation, car.CarId, &car, &updatedCar, car.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating car change mutations")
 	}
 
-	return carUpdateMap
+	return append([]*spanner.Mutation{spanner.UpdateMap(tableCar, map[string]interface{}{
+		"brand_name":   updatedCar.BrandName,
+		"car_id":       car.CarId,
+		"date_updated": spanner.CommitTimestamp,
+		"model_name":   updatedCar.ModelName,
+	})}, mutCarChanges...), nil
 }
 
 func (c client) DeleteCar(ctx context.Context, carDelete dto.CarDelete) error {
 	lib_log.Info(ctx, "Deleting", lib_log.FmtAny("carDelete", carDelete))
 
 	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
-		car, err := readCar(ctx, tx, carDelete.Id)
+		mutations, err := newCarDeleteMutations(ctx, tx, carDelete)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating car delete mutations")
+		}
+
+		if err := tx.BufferWrite(mutations); err != nil {
+			return lib_errors.Wrap(err, "Failed deleting car")
+		}
+
+		lib_log.Info(ctx, "Deleted", lib_log.FmtAny("carDelete", carDelete))
+
+		return nil
+	}); err != nil {
+		return lib_spanner.WrapError(err, "Failed executing read write transaction")
+	}
+
+	return nil
+}
+
+// newCarDeleteMutations checks the car can be accessed and creates the mutations soft deleting it and appending its history, the tombstone is hard deleted by PurgeCars once the retention has passed
+func newCarDeleteMutations(ctx context.Context, reader lib_spanner.Reader, carDelete dto.CarDelete) ([]*spanner.Mutation, error) {
+	car, err := readCar(ctx, reader, carDelete.Id)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car")
+	}
+
+	if err := checkCarAccess(ctx, *car, carDelete.Test); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking car access")
+	}
+
+	mutCarChanges, err := newCarChangeMutations(ctx, dto.CarHistoryOperationDelete, car.CarId, car, nil, car.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating car change mutations")
+	}
+
+	return append([]*spanner.Mutation{spanner.UpdateMap(tableCar, map[string]interface{}{
+		"car_id":       carDelete.Id,
+		"date_deleted": spanner.CommitTimestamp,
+	})}, mutCarChanges...), nil
+}
+
+func (c client) PatchCar(ctx context.Context, carPatch dto.CarPatch, checkCar CheckCar) error {
+	lib_log.Info(ctx, "Patching", lib_log.FmtAny("carPatch", carPatch))
+
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		car, err := readCar(ctx, tx, carPatch.Id)
 		if err != nil {
 			return lib_errors.Wrap(err, "Failed reading car")
 		}
 
-		if car.Test != carDelete.Test {
-			return lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+		if err := checkCarAccess(ctx, *car, carPatch.Test); err != nil {
+			return lib_errors.Wrap(err, "Failed checking car access")
 		}
 
-		if err := tx.BufferWrite([]*spanner.Mutation{spanner.Delete(tableCar, spanner.Key{carDelete.Id})}); err != nil {
-			return lib_errors.Wrap(err, "Failed deleting car")
+		patchedCar, carPatchMap, err := newPatchedCar(ctx, *car, carPatch, checkCar)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating patched car")
 		}
 
-		lib_log.Info(ctx, "Deleted", lib_log.FmtAny("carDelete", carDelete))
+		mutCarChanges, err := newCarChangeMutations(ctx, dto.CarHistoryOperationPatch, car.CarId, car, patchedCar, car.Test)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating car change mutations")
+		}
+
+		if err := tx.BufferWrite(append([]*spanner.Mutation{spanner.UpdateMap(tableCar, carPatchMap)}, mutCarChanges...)); err != nil {
+			return lib_errors.Wrap(err, "Failed patching car")
+		}
+
+		lib_log.Info(ctx, "Patched", lib_log.FmtAny("carPatchMap", carPatchMap))
+
+		return nil
+	}); err != nil {
+		return lib_spanner.WrapError(err, "Failed executing read write transaction")
+	}
+
+	return nil
+}
+
+// newPatchedCar applies the patch to the car and checks the patched car, the update map of the patched car is returned with it
+func newPatchedCar(ctx context.Context, car Car, carPatch dto.CarPatch, checkCar CheckCar) (*Car, map[string]interface{}, error) {
+	carJson, err := lib_json.GenerateJson(car, CarFieldMetaData, "")
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed generating car json")
+	}
+
+	patchedCarJson, err := patch.Apply(carPatch.ContentType, carJson, carPatch.Patch)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed applying patch")
+	}
+
+	if err := checkCar(ctx, patchedCarJson); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed checking patched car")
+	}
+
+	carPatchMap, err := newCarPatchMap(car.CarId, carJson, patchedCarJson)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating car patch map")
+	}
+
+	patchedCar := car
+	patchedCar.BrandName = carPatchMap["brand_name"].(string)
+	patchedCar.ModelName = carPatchMap["model_name"].(spanner.NullString)
+	return &patchedCar, carPatchMap, nil
+}
+
+// newCarPatchMap creates the update map from the patched car, read only fields must not be changed by the patch and fields which are missing after the patch are set to null
+func newCarPatchMap(carId string, carJson, patchedCarJson []byte) (map[string]interface{}, error) {
+	var car, patchedCar map[string]interface{}
+	if err := json.Unmarshal(carJson, &car); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed unmarshalling car")
+	}
+	if err := json.Unmarshal(patchedCarJson, &patchedCar); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed unmarshalling patched car")
+	}
+
+	for _, v := range carFieldsReadOnly {
+		if !reflect.DeepEqual(car[v], patchedCar[v]) {
+			return nil, lib_errors.NewCustomWithMetadata(http.StatusUnprocessableEntity, constants.UnprocessableEntityPatchChangesReadOnlyField, map[string]interface{}{
+				v: constants.UnprocessableEntityPatchChangesReadOnlyField,
+			})
+		}
+	}
+
+	brandName, ok := patchedCar["brand_name"].(string)
+	if !ok {
+		return nil, lib_errors.NewCustomWithMetadata(http.StatusUnprocessableEntity, constants.UnprocessableEntityPatchRemovesRequiredField, map[string]interface{}{
+			"brand_name": constants.UnprocessableEntityPatchRemovesRequiredField,
+		})
+	}
+	var modelName spanner.NullString
+	if v, ok := patchedCar["model_name"].(string); ok {
+		modelName = spanner.NullString{StringVal: v, Valid: true}
+	}
+
+	return map[string]interface{}{
+		"brand_name":   brandName,
+		"car_id":       carId,
+		"date_updated": spanner.CommitTimestamp,
+		"model_name":   modelName,
+	}, nil
+}
+
+// RestoreCar removes the tombstone of a soft deleted car, restoring a car that is not deleted has no effect
+func (c client) RestoreCar(ctx context.Context, carRestore dto.CarRestore) error {
+	lib_log.Info(ctx, "Restoring", lib_log.FmtAny("carRestore", carRestore))
+
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		car, err := readCarIncludingDeleted(ctx, tx, carRestore.Id)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading car including deleted")
+		}
+
+		if err := checkCarAccess(ctx, *car, carRestore.Test); err != nil {
+			return lib_errors.Wrap(err, "Failed checking car access")
+		}
+
+		if !car.DateDeleted.Valid {
+			lib_log.Info(ctx, "Car not deleted, nothing to restore")
+			return nil
+		}
+
+		count, err := readCountCarsWithBrandAndModelName(ctx, tx, car.BrandName, car.ModelName)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed counting cars with brand and model name")
+		}
+		if count > 0 {
+			return lib_errors.NewCustom(http.StatusConflict, "Already exist")
+		}
+
+		mutCarChanges, err := newCarChangeMutations(ctx, dto.CarHistoryOperationRestore, car.CarId, nil, car, car.Test)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating car change mutations")
+		}
+
+		if err := tx.BufferWrite(append([]*spanner.Mutation{spanner.UpdateMap(tableCar, map[string]interface{}{
+			"car_id":       carRestore.Id,
+			"date_deleted": nil,
+			"date_updated": spanner.CommitTimestamp,
+		})}, mutCarChanges...)); err != nil {
+			return lib_errors.Wrap(err, "Failed restoring car")
+		}
+
+		lib_log.Info(ctx, "Restored", lib_log.FmtAny("carRestore", carRestore))
 
 		return nil
 	}); err != nil {
@@ -326,3 +755,120 @@ func (c client) DeleteCar(ctx context.Context, carDelete dto.CarDelete) error {
 
 	return nil
 }
+
+// purgeCarsChunkSize is the number of cars purged by each partitioned update, so that the car ids bound to its statements stay small
+const purgeCarsChunkSize = 1000
+
+// sqlWhereCarDeletedBefore is the retention predicate of PurgeCars
+const sqlWhereCarDeletedBefore = "date_deleted IS NOT NULL AND date_deleted < @date_deleted_before"
+
+// PurgeCars hard deletes the tombstones of the cars of every tenant soft deleted before the date with their rentals, history and outbox events. It is run by cmd/purge rather than by a route
+// as every chunk is purged with partitioned updates, which are not atomic and may take minutes
+func (c client) PurgeCars(ctx context.Context, dateDeletedBefore time.Time) (int64, error) {
+	lib_log.Info(ctx, "Purging", lib_log.FmtTime("dateDeletedBefore", dateDeletedBefore))
+
+	var count int64
+	for {
+		carIds, err := readCarIds(ctx, c.spannerClient.Single(), spanner.Statement{
+			SQL: fmt.Sprintf(`
+				SELECT car_id
+				FROM %s
+				WHERE %s
+				LIMIT @limit
+			`,
+				tableCar,
+				sqlWhereCarDeletedBefore,
+			),
+			Params: map[string]interface{}{
+				"date_deleted_before": dateDeletedBefore,
+				"limit":               purgeCarsChunkSize,
+			},
+		})
+		if err != nil {
+			return 0, lib_errors.Wrapf(err, "Failed reading car ids after %d cars", count)
+		}
+		if len(carIds) == 0 {
+			break
+		}
+
+		chunkCount, err := c.purgeCarsChunk(ctx, carIds, dateDeletedBefore)
+		if err != nil {
+			return 0, lib_errors.Wrapf(err, "Failed purging chunk after %d cars", count)
+		}
+		count += chunkCount
+		if len(carIds) < purgeCarsChunkSize {
+			break
+		}
+	}
+
+	lib_log.Info(ctx, "Purged", lib_log.FmtInt64("count", count))
+	return count, nil
+}
+
+// purgeCarsChunk deletes the rows of the cars before the cars, so that a purge that fails is completed by the next purge, which reads the same cars again
+func (c client) purgeCarsChunk(ctx context.Context, carIds []string, dateDeletedBefore time.Time) (int64, error) {
+	lib_log.Info(ctx, "Purging chunk", lib_log.FmtInt("len(carIds)", len(carIds)))
+
+	params := map[string]interface{}{
+		"car_ids":             carIds,
+		"date_deleted_before": dateDeletedBefore,
+	}
+	for _, v := range []struct {
+		table  string
+		column string
+	}{
+		{table: tableCarCustomerAssociation, column: "car_id"},
+		{table: tableCarHistory, column: "car_id"},
+		{table: tableOutboxEvent, column: "aggregate_id"},
+	} {
+		stmt := spanner.Statement{
+			SQL:    fmt.Sprintf("DELETE FROM %s WHERE %s IN UNNEST(@car_ids)", v.table, v.column),
+			Params: params,
+		}
+		lib_log.Info(ctx, "Executing", lib_log.FmtAny("stmt", stmt))
+		if _, err := c.spannerClient.PartitionedUpdate(ctx, stmt); err != nil {
+			return 0, lib_spanner.WrapError(err, fmt.Sprintf("Failed deleting rows of %s", v.table))
+		}
+	}
+
+	// The retention predicate is applied again so that a car restored since its id was read is kept
+	stmt := spanner.Statement{
+		SQL:    fmt.Sprintf("DELETE FROM %s WHERE car_id IN UNNEST(@car_ids) AND %s", tableCar, sqlWhereCarDeletedBefore),
+		Params: params,
+	}
+	lib_log.Info(ctx, "Executing", lib_log.FmtAny("stmt", stmt))
+	count, err := c.spannerClient.PartitionedUpdate(ctx, stmt)
+	if err != nil {
+		return 0, lib_spanner.WrapError(err, "Failed deleting cars")
+	}
+
+	lib_log.Info(ctx, "Purged chunk", lib_log.FmtInt64("count", count))
+	return count, nil
+}
+
+func readCarIds(ctx context.Context, reader lib_spanner.Reader, stmt spanner.Statement) ([]string, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := reader.Query(ctx, stmt)
+	defer iter.Stop()
+
+	var carIds []string
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, lib_errors.Wrap(err, "Failed iterating car")
+		}
+
+		var carId string
+		if err := row.Columns(&carId); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car id")
+		}
+		carIds = append(carIds, carId)
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carIds)", len(carIds)))
+	return carIds, nil
+}
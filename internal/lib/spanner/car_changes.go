@@ -0,0 +1,99 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/dto"
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	"google.golang.org/api/iterator"
+)
+
+// ReadCarChanges reads the history rows committed after the since token in commit order, a strong read sees every change committed before its read timestamp so a change cannot be committed behind the position of a reader.
+// When no since token is requested the feed starts at the read timestamp and no changes are returned.
+func (c client) ReadCarChanges(ctx context.Context, carChangesRead dto.CarChangesRead) ([]CarHistory, *dto.CarChangesToken, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("carChangesRead", carChangesRead))
+
+	ro := c.spannerClient.ReadOnlyTransaction()
+	defer ro.Close()
+
+	if carChangesRead.Since == nil {
+		readTimestamp, err := readCurrentTimestamp(ctx, ro)
+		if err != nil {
+			return nil, nil, lib_errors.Wrap(err, "Failed reading current timestamp")
+		}
+		lib_log.Info(ctx, "Read", lib_log.FmtAny("readTimestamp", readTimestamp))
+		return nil, &dto.CarChangesToken{DateCreated: *readTimestamp}, nil
+	}
+
+	sqlWhere, params, err := generateSqlWhereAndParamsForTenantSearch(ctx, "test = @test AND (date_created > @date_created OR (date_created = @date_created AND car_history_id > @car_history_id))", map[string]interface{}{
+		"car_history_id": carChangesRead.Since.CarHistoryId,
+		"date_created":   carChangesRead.Since.DateCreated,
+		"test":           carChangesRead.Test,
+	}, nil)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed generating sql where and params for tenant search")
+	}
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT car_history_id, car_id, date_created, operation
+			FROM %s
+			%s
+			ORDER BY date_created, car_history_id
+			LIMIT %d
+		`,
+			tableCarHistory,
+			sqlWhere,
+			carChangesRead.Pagination.Limit,
+		),
+		Params: params,
+	}
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := ro.Query(ctx, stmt)
+	defer iter.Stop()
+
+	next := *carChangesRead.Since
+	var carHistory []CarHistory
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, nil, lib_errors.Wrap(err, "Failed iterating car changes")
+		}
+
+		var v CarHistory
+		if err := row.ToStruct(&v); err != nil {
+			return nil, nil, lib_errors.Wrap(err, "Failed reading car change")
+		}
+
+		carHistory = append(carHistory, v)
+		next = dto.CarChangesToken{
+			CarHistoryId: v.CarHistoryId,
+			DateCreated:  v.DateCreated,
+		}
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carHistory)", len(carHistory)), lib_log.FmtAny("next", next))
+	return carHistory, &next, nil
+}
+
+func readCurrentTimestamp(ctx context.Context, ro *spanner.ReadOnlyTransaction) (*time.Time, error) {
+	iter := ro.Query(ctx, spanner.Statement{SQL: "SELECT CURRENT_TIMESTAMP() AS now"})
+	defer iter.Stop()
+
+	row, err := iter.Next()
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed iterating current timestamp")
+	}
+	var currentTimestamp time.Time
+	if err := row.Column(0, &currentTimestamp); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading current timestamp")
+	}
+	return &currentTimestamp, nil
+}
@@ -0,0 +1,155 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"net/http"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_misc "github.com/tomwangsvc/lib-svc/misc"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+)
+
+type CarCustomerAssociation struct {
+	CarId           string             `json:"car_id" spanner:"car_id"`
+	CustomerId      string             `json:"customer_id" spanner:"customer_id"`
+	DateCancelled   spanner.NullTime   `json:"date_cancelled" spanner:"date_cancelled"`
+	DateCreated     time.Time          `json:"date_created" spanner:"date_created"`
+	DateRentalEnd   time.Time          `json:"date_rental_end" spanner:"date_rental_end"`
+	DateRentalStart time.Time          `json:"date_rental_start" spanner:"DateRentalStart"`
+	DateUpdated     time.Time          `json:"date_updated" spanner:"date_updated"`
+	Id              string             `json:"id" spanner:"id"`
+	TenantId        spanner.NullString `json:"-" spanner:"tenant_id"`
+	Test            bool               `json:"test" spanner:"test"`
+}
+
+var (
+	CarCustomerAssociationColumns       = lib_misc.StructTaggedFieldNames(reflect.TypeOf(CarCustomerAssociation{}), "spanner")
+	CarCustomerAssociationFieldMetaData = lib_json.StructFieldMetadata(reflect.TypeOf(CarCustomerAssociation{}))
+)
+
+const (
+	tableCarCustomerAssociation = "car_customer_association"
+)
+
+var ()
+
+// CreateCarCustomerAssociation rents the car to the customer, the customer block is read in the same transaction as the rental is inserted so that no rental is created for a customer once BlockCustomer has committed.
+// A rental.created event is recorded in the outbox in the same transaction so that the rental is published like the changes to cars
+func (c client) CreateCarCustomerAssociation(ctx context.Context, carCustomerAssociationCreate dto.CarCustomerAssociationCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtAny("carCustomerAssociationCreate", carCustomerAssociationCreate))
+
+	carCustomerAssociation, err := newCarCustomerAssociation(ctx, carCustomerAssociationCreate)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating car customer association")
+	}
+	outboxEvent, err := newRentalCreatedOutboxEvent(ctx, carCustomerAssociation)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating rental created outbox event")
+	}
+	mutOutboxEvent, err := spanner.InsertStruct(tableOutboxEvent, outboxEvent)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating mutOutboxEvent for outbox event")
+	}
+
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		car, err := readCar(ctx, tx, carCustomerAssociationCreate.CarId)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading car")
+		}
+		if err := checkCarAccess(ctx, *car, carCustomerAssociationCreate.Test); err != nil {
+			return lib_errors.Wrap(err, "Failed checking car access")
+		}
+
+		blocked, err := readCustomerBlocked(ctx, tx, carCustomerAssociation.CustomerId)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading customer blocked")
+		}
+		if blocked {
+			return lib_errors.NewCustom(http.StatusConflict, constants.ConflictCustomerBlocked)
+		}
+
+		if err := tx.BufferWrite([]*spanner.Mutation{newCarCustomerAssociationInsertMutation(carCustomerAssociation), mutOutboxEvent}); err != nil {
+			return lib_errors.Wrap(err, "Failed creating car customer association")
+		}
+		return nil
+
+	}); err != nil {
+		return "", lib_spanner.WrapError(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("carCustomerAssociation.Id", carCustomerAssociation.Id))
+	return carCustomerAssociation.Id, nil
+}
+
+// newCarCustomerAssociation creates a rental in the tenant of the caller
+func newCarCustomerAssociation(ctx context.Context, carCustomerAssociationCreate dto.CarCustomerAssociationCreate) (CarCustomerAssociation, error) {
+	tenantId, err := newTenantId(ctx)
+	if err != nil {
+		return CarCustomerAssociation{}, lib_errors.Wrap(err, "Failed getting new tenant id")
+	}
+
+	return CarCustomerAssociation{
+		CarId:           carCustomerAssociationCreate.CarId,
+		CustomerId:      carCustomerAssociationCreate.UserInput.CustomerId,
+		DateCreated:     spanner.CommitTimestamp,
+		DateRentalEnd:   carCustomerAssociationCreate.UserInput.DateRentalEnd.UTC(),
+		DateRentalStart: carCustomerAssociationCreate.UserInput.DateRentalStart.UTC(),
+		Id:              uuid.New().String(),
+		TenantId:        tenantId,
+		Test:            carCustomerAssociationCreate.Test,
+	}, nil
+}
+
+// newCarCustomerAssociationInsertMutation maps the columns by name as the spanner tag of the start of a rental does not match its column
+func newCarCustomerAssociationInsertMutation(carCustomerAssociation CarCustomerAssociation) *spanner.Mutation {
+	return spanner.InsertMap(tableCarCustomerAssociation, map[string]interface{}{
+		"car_id":            carCustomerAssociation.CarId,
+		"customer_id":       carCustomerAssociation.CustomerId,
+		"date_created":      carCustomerAssociation.DateCreated,
+		"date_rental_end":   carCustomerAssociation.DateRentalEnd,
+		"date_rental_start": carCustomerAssociation.DateRentalStart,
+		"id":                carCustomerAssociation.Id,
+		"tenant_id":         carCustomerAssociation.TenantId,
+		"test":              carCustomerAssociation.Test,
+	})
+}
+
+func (c client) TransformBrandClassAssociationToJson(ctx context.Context, carCustomerAssociation CarCustomerAssociation) ([]byte, error) {
+	lib_log.Info(ctx, "Transforming", lib_log.FmtAny("carCustomerAssociation", carCustomerAssociation))
+
+	carCustomerAssociationListJson, err := lib_json.GenerateJson(carCustomerAssociation, CarCustomerAssociationFieldMetaData, "")
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed generating json list")
+	}
+
+	lib_log.Info(ctx, "Transformed", lib_log.FmtInt("len(carCustomerAssociationListJson)", len(carCustomerAssociationListJson)))
+	return carCustomerAssociationListJson, nil
+}
+
+func (c client) TransformBrandClassAssociationsToJson(ctx context.Context, carCustomerAssociations []CarCustomerAssociation) ([]byte, error) {
+	lib_log.Info(ctx, "Transforming", lib_log.FmtInt("len(carCustomerAssociations)", len(carCustomerAssociations)))
+
+	if len(carCustomerAssociations) == 0 {
+		lib_log.Info(ctx, "Transformed")
+		return nil, nil
+	}
+	var carCustomerAssociationsList []interface{}
+	for _, v := range carCustomerAssociationsList {
+		carCustomerAssociationsList = append(carCustomerAssociationsList, v)
+	}
+	carCustomerAssociationsListJson, err := lib_json.GenerateJsonList(carCustomerAssociationsList, CarCustomerAssociationFieldMetaData, "")
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed generating json list")
+	}
+
+	lib_log.Info(ctx, "Transformed", lib_log.FmtInt("len(carCustomerAssociationsListJson)", len(carCustomerAssociationsListJson)))
+	return carCustomerAssociationsListJson, nil
+}
@@ -0,0 +1,295 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/actor"
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_misc "github.com/tomwangsvc/lib-svc/misc"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+	"google.golang.org/api/iterator"
+)
+
+type CarHistory struct {
+	Actor         string             `json:"actor" spanner:"actor"`
+	After         spanner.NullString `json:"after" spanner:"after" transform:"raw"`
+	Before        spanner.NullString `json:"before" spanner:"before" transform:"raw"`
+	CarHistoryId  string             `json:"car_history_id" spanner:"car_history_id"`
+	CarId         string             `json:"car_id" spanner:"car_id"`
+	CorrelationId string             `json:"correlation_id" spanner:"correlation_id"`
+	DateCreated   time.Time          `json:"date_created" spanner:"date_created"`
+	Operation     string             `json:"operation" spanner:"operation"`
+	TenantId      spanner.NullString `json:"-" spanner:"tenant_id"`
+	Test          bool               `json:"test" spanner:"test"`
+}
+
+const (
+	tableCarHistory = "car_history"
+)
+
+var (
+	CarHistoryColumns       = lib_misc.StructTaggedFieldNames(reflect.TypeOf(CarHistory{}), "spanner")
+	CarHistoryFieldMetaData = lib_json.StructFieldMetadata(reflect.TypeOf(CarHistory{}))
+
+	// carHistoryStateFields are the fields of a car recorded before and after a change, the dates are omitted as they are set to the commit timestamp of the change
+	carHistoryStateFields = []string{"branch_id", "brand_name", "car_id", "model_name", "test"}
+)
+
+// newCarHistory creates the history row for a change to a car, it must be written in the transaction making the change so that the row is committed with the change
+func newCarHistory(ctx context.Context, operation, carId string, before, after *Car, tenantId spanner.NullString, test bool) (CarHistory, error) {
+	beforeState, err := newCarHistoryState(before)
+	if err != nil {
+		return CarHistory{}, lib_errors.Wrap(err, "Failed creating before state")
+	}
+	afterState, err := newCarHistoryState(after)
+	if err != nil {
+		return CarHistory{}, lib_errors.Wrap(err, "Failed creating after state")
+	}
+
+	return CarHistory{
+		Actor:         actor.Actor(ctx),
+		After:         afterState,
+		Before:        beforeState,
+		CarHistoryId:  uuid.New().String(),
+		CarId:         carId,
+		CorrelationId: lib_context.CorrelationId(ctx),
+		DateCreated:   spanner.CommitTimestamp,
+		Operation:     operation,
+		TenantId:      tenantId,
+		Test:          test,
+	}, nil
+}
+
+// newCarHistoryState returns the state of the car as json, a car that does not exist before or after the change has a null state
+func newCarHistoryState(car *Car) (spanner.NullString, error) {
+	if car == nil {
+		return spanner.NullString{}, nil
+	}
+	state, err := lib_json.GenerateJson(*car, CarFieldMetaData, strings.Join(carHistoryStateFields, ","))
+	if err != nil {
+		return spanner.NullString{}, lib_errors.Wrap(err, "Failed generating car json")
+	}
+	return spanner.NullString{StringVal: string(state), Valid: true}, nil
+}
+
+func (c client) SearchCarHistory(ctx context.Context, carHistorySearch dto.CarHistorySearch) ([]CarHistory, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("carHistorySearch", carHistorySearch))
+
+	sqlWhere, params, err := generateSqlWhereAndParamsForTenantSearch(ctx, "car_id = @car_id AND test = @test", map[string]interface{}{
+		"car_id": carHistorySearch.CarId,
+		"test":   carHistorySearch.Test,
+	}, nil)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed generating sql where and params for tenant search")
+	}
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			%s
+			ORDER BY date_created %s
+			LIMIT %d
+			OFFSET %d
+		`,
+			strings.Join(CarHistoryColumns, ", "),
+			tableCarHistory,
+			sqlWhere,
+			carHistorySearch.Pagination.Order,
+			carHistorySearch.Pagination.Limit,
+			carHistorySearch.Pagination.Offset,
+		),
+		Params: params,
+	}
+
+	ro := c.spannerClient.ReadOnlyTransaction()
+	defer ro.Close()
+
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := ro.Query(ctx, stmt)
+	defer iter.Stop()
+
+	var carHistory []CarHistory
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, nil, lib_errors.Wrap(err, "Failed iterating car history")
+		}
+
+		var v CarHistory
+		if err := row.ToStruct(&v); err != nil {
+			return nil, nil, lib_errors.Wrap(err, "Failed reading car history")
+		}
+
+		carHistory = append(carHistory, v)
+	}
+
+	pagination, err := readCountForPagination(ctx, ro, carHistorySearch.Pagination, spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT count(car_history_id) AS count
+			FROM %s
+			%s
+		`,
+			tableCarHistory,
+			sqlWhere,
+		),
+		Params: params,
+	})
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed reading count for pagination")
+	}
+	ro.Close()
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carHistory)", len(carHistory)), lib_log.FmtAny("pagination", pagination))
+	return carHistory, pagination, nil
+}
+
+func (c client) TransformCarHistoryToJson(ctx context.Context, carHistory []CarHistory) ([]byte, error) {
+	lib_log.Info(ctx, "Transforming", lib_log.FmtInt("len(carHistory)", len(carHistory)))
+
+	if len(carHistory) == 0 {
+		lib_log.Info(ctx, "Transformed")
+		return nil, nil
+	}
+	var carHistoryList []interface{}
+	for _, v := range carHistory {
+		carHistoryList = append(carHistoryList, v)
+	}
+	carHistoryListJson, err := lib_json.GenerateJsonList(carHistoryList, CarHistoryFieldMetaData, "")
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed generating json list")
+	}
+
+	lib_log.Info(ctx, "Transformed", lib_log.FmtInt("len(carHistoryListJson)", len(carHistoryListJson)))
+	return carHistoryListJson, nil
+}
+
+// RevertCar updates the car to the values it had after the change recorded by a history row, the revert is recorded as a new change so that it can be reverted in turn
+func (c client) RevertCar(ctx context.Context, carRevert dto.CarRevert) error {
+	lib_log.Info(ctx, "Reverting", lib_log.FmtAny("carRevert", carRevert))
+
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		car, err := readCarForUpdate(ctx, tx, carRevert.Id, carRevert.IfUnmodifiedSince, carRevert.Test)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading car for update")
+		}
+
+		carHistory, err := readCarHistoryForRevert(ctx, tx, carRevert)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading car history for revert")
+		}
+
+		revertedCar, err := newRevertedCar(*car, *carHistory)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating reverted car")
+		}
+
+		mutations, err := newCarUpdatedMutations(ctx, dto.CarHistoryOperationRevert, *car, *revertedCar)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating car updated mutations")
+		}
+
+		if err := tx.BufferWrite(mutations); err != nil {
+			return lib_errors.Wrap(err, "Failed reverting car")
+		}
+
+		lib_log.Info(ctx, "Reverted", lib_log.FmtString("carHistory.CarHistoryId", carHistory.CarHistoryId))
+
+		return nil
+	}); err != nil {
+		return lib_spanner.WrapError(err, "Failed executing read write transaction")
+	}
+
+	return nil
+}
+
+// newRevertedCar returns the car with the user input fields it had after the change recorded by the history row, a car cannot be reverted to the version a delete left
+func newRevertedCar(car Car, carHistory CarHistory) (*Car, error) {
+	if !carHistory.After.Valid {
+		return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityRevertToDeletedVersion)
+	}
+	var state struct {
+		BrandName string  `json:"brand_name"`
+		ModelName *string `json:"model_name"`
+	}
+	if err := json.Unmarshal([]byte(carHistory.After.StringVal), &state); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed unmarshalling car history after state")
+	}
+
+	car.BrandName = state.BrandName
+	car.ModelName = spanner.NullString{}
+	if state.ModelName != nil {
+		car.ModelName = spanner.NullString{StringVal: *state.ModelName, Valid: true}
+	}
+	return &car, nil
+}
+
+// readCarHistoryForRevert reads the history row requested by id, or the latest history row at the requested date
+func readCarHistoryForRevert(ctx context.Context, reader lib_spanner.Reader, carRevert dto.CarRevert) (*CarHistory, error) {
+	var carHistory CarHistory
+	if carRevert.UserInput.CarHistoryId != nil {
+		if err := readByIdForTenant(ctx, reader, tableCarHistory, CarHistoryColumns, *carRevert.UserInput.CarHistoryId, &carHistory); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car history")
+		}
+		if carHistory.CarId != carRevert.Id {
+			return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+		}
+		return &carHistory, nil
+	}
+
+	sqlWhere, params, err := generateSqlWhereAndParamsForTenantSearch(ctx, "car_id = @car_id AND date_created <= @date", map[string]interface{}{
+		"car_id": carRevert.Id,
+		"date":   carRevert.UserInput.Date,
+	}, nil)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed generating sql where and params for tenant search")
+	}
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			%s
+			ORDER BY date_created DESC
+			LIMIT 1
+		`,
+			strings.Join(CarHistoryColumns, ", "),
+			tableCarHistory,
+			sqlWhere,
+		),
+		Params: params,
+	}
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := reader.Query(ctx, stmt)
+	defer iter.Stop()
+
+	row, err := iter.Next()
+	if err != nil {
+		if err == iterator.Done {
+			return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+		}
+		return nil, lib_errors.Wrap(err, "Failed iterating car history")
+	}
+	if err := row.ToStruct(&carHistory); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car history")
+	}
+
+	return &carHistory, nil
+}
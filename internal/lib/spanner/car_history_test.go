@@ -0,0 +1,44 @@
+package spanner
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_newCarHistoryState(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    *Car
+		expected spanner.NullString
+	}{
+		{
+			desc:     "no car",
+			input:    nil,
+			expected: spanner.NullString{},
+		},
+		{
+			desc:     "car of a branch",
+			input:    &Car{BranchId: spanner.NullString{StringVal: "branch-id", Valid: true}, BrandName: "Toyota", CarId: "car-id", ModelName: spanner.NullString{StringVal: "Corolla", Valid: true}},
+			expected: spanner.NullString{StringVal: `{"branch_id":"branch-id","brand_name":"Toyota","car_id":"car-id","model_name":"Corolla","test":false}`, Valid: true},
+		},
+	}
+
+	for i, d := range data {
+		result, err := newCarHistoryState(d.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, d.expected) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/dto"
+	"reflect"
+	"testing"
+
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_carColumnsForFields(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    []string
+		expected []string
+	}{
+		{
+			desc:     "no fields",
+			input:    nil,
+			expected: CarColumns,
+		},
+		{
+			desc:     "field requested twice",
+			input:    []string{"car_id", "car_id", "brand_name"},
+			expected: []string{"car_id", "brand_name"},
+		},
+		{
+			desc:     "every field the parser accepts",
+			input:    dto.CarFields,
+			expected: dto.CarFields,
+		},
+	}
+
+	for i, d := range data {
+		result, err := carColumnsForFields(d.input)
+		if err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Result:     err,
+			}))
+			continue
+		}
+		if !reflect.DeepEqual(result, d.expected) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+)
+
+const (
+	metadataKeyOperationIndex = "operation_index"
+)
+
+func (c client) BatchCars(ctx context.Context, carsBatch dto.CarsBatch) ([]dto.CarsBatchResult, error) {
+	lib_log.Info(ctx, "Batching", lib_log.FmtString("carsBatch.Mode", carsBatch.Mode), lib_log.FmtInt("len(carsBatch.Operations)", len(carsBatch.Operations)))
+
+	var results []dto.CarsBatchResult
+	var err error
+	if carsBatch.Mode == dto.CarsBatchModeAllOrNothing {
+		results, err = c.batchCarsAllOrNothing(ctx, carsBatch)
+	} else {
+		results, err = batchCarsBestEffort(ctx, c, carsBatch)
+	}
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed batching cars")
+	}
+
+	lib_log.Info(ctx, "Batched", lib_log.FmtInt("len(results)", len(results)))
+	return results, nil
+}
+
+// batchCarsAllOrNothing buffers the mutations of every operation in a single transaction, the first failed operation aborts the batch
+func (c client) batchCarsAllOrNothing(ctx context.Context, carsBatch dto.CarsBatch) ([]dto.CarsBatchResult, error) {
+	var results []dto.CarsBatchResult
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		results = nil
+
+		if carsBatch.IdempotencyKey != nil {
+			idempotentResponse, err := readIdempotentResponse(ctx, tx, *carsBatch.IdempotencyKey)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed reading idempotent response")
+			}
+			if idempotentResponse != nil {
+				lib_log.Info(ctx, "Replaying idempotent response", lib_log.FmtAny("idempotentResponse", idempotentResponse))
+				if err := json.Unmarshal(idempotentResponse.Body, &results); err != nil {
+					return lib_errors.Wrap(err, "Failed unmarshalling idempotent response body into []dto.CarsBatchResult")
+				}
+				return nil
+			}
+		}
+
+		// Mutations are only visible to reads once committed, so the cars changed earlier in the batch are tracked to detect conflicts within the batch
+		changes := newCarsBatchChanges()
+
+		var mutations []*spanner.Mutation
+		for i, operation := range carsBatch.Operations {
+			result := dto.CarsBatchResult{
+				Index: i,
+			}
+
+			var operationMutations []*spanner.Mutation
+			var err error
+			switch {
+			case operation.CarCreate != nil:
+				if err := changes.checkCreate(*operation.CarCreate); err != nil {
+					return withCarsBatchOperationIndex(err, i)
+				}
+
+				var car *Car
+				car, operationMutations, err = newCarCreateMutations(ctx, tx, *operation.CarCreate)
+				if err == nil {
+					changes.addCreated(*operation.CarCreate, car.CarId)
+					result.CarId = car.CarId
+					result.Status = http.StatusCreated
+				}
+
+			case operation.CarUpdate != nil:
+				if err := changes.checkChange(operation.CarUpdate.Id); err != nil {
+					return withCarsBatchOperationIndex(err, i)
+				}
+				operationMutations, err = newCarUpdateMutations(ctx, tx, *operation.CarUpdate)
+				result.CarId = operation.CarUpdate.Id
+				result.Status = http.StatusNoContent
+
+			case operation.CarDelete != nil:
+				if err := changes.checkChange(operation.CarDelete.Id); err != nil {
+					return withCarsBatchOperationIndex(err, i)
+				}
+				operationMutations, err = newCarDeleteMutations(ctx, tx, *operation.CarDelete)
+				if err == nil {
+					changes.addDeleted(operation.CarDelete.Id)
+				}
+				result.CarId = operation.CarDelete.Id
+				result.Status = http.StatusNoContent
+
+			default:
+				err = lib_errors.New("Operation has no car create, update or delete")
+			}
+			if err != nil {
+				return withCarsBatchOperationIndex(lib_errors.Wrapf(err, "Failed creating mutations for operation %d", i), i)
+			}
+
+			mutations = append(mutations, operationMutations...)
+			results = append(results, result)
+		}
+
+		if carsBatch.IdempotencyKey != nil {
+			mutIdempotencyKey, err := newCarsBatchIdempotencyKeyMutation(ctx, *carsBatch.IdempotencyKey, results, c.config.IdempotencyKeyTtl, carsBatch.Test)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed creating idempotency key mutation")
+			}
+			mutations = append(mutations, mutIdempotencyKey)
+		}
+
+		if err := tx.BufferWrite(mutations); err != nil {
+			return lib_errors.Wrap(err, "Failed batching cars")
+		}
+
+		return nil
+	}); err != nil {
+		return nil, lib_spanner.WrapError(err, "Failed executing read write transaction")
+	}
+
+	return results, nil
+}
+
+// carsBatchChanges tracks the cars created and deleted by the earlier operations of an all or nothing batch, as the reads of an operation do not see the changes of the operations before it
+type carsBatchChanges struct {
+	brandAndModelNames map[[2]string]bool
+	carIds             map[string]bool
+}
+
+func newCarsBatchChanges() carsBatchChanges {
+	return carsBatchChanges{
+		brandAndModelNames: make(map[[2]string]bool),
+		carIds:             make(map[string]bool),
+	}
+}
+
+// checkCreate returns a conflict when a car with the same brand and model name was created earlier in the batch
+func (c carsBatchChanges) checkCreate(carCreate dto.CarCreate) error {
+	if c.brandAndModelNames[[2]string{carCreate.UserInput.BrandName, carCreate.UserInput.ModelName}] {
+		return lib_errors.NewCustom(http.StatusConflict, "Already exist")
+	}
+	return nil
+}
+
+// checkChange returns a conflict when the car was created or deleted earlier in the batch, the change would be made to the car as it was before the batch
+func (c carsBatchChanges) checkChange(carId string) error {
+	if c.carIds[carId] {
+		return lib_errors.NewCustomWithMetadata(http.StatusConflict, constants.ConflictCarChangedEarlierInBatch, map[string]interface{}{
+			"car_id": constants.ConflictCarChangedEarlierInBatch,
+		})
+	}
+	return nil
+}
+
+func (c carsBatchChanges) addCreated(carCreate dto.CarCreate, carId string) {
+	c.brandAndModelNames[[2]string{carCreate.UserInput.BrandName, carCreate.UserInput.ModelName}] = true
+	c.carIds[carId] = true
+}
+
+func (c carsBatchChanges) addDeleted(carId string) {
+	c.carIds[carId] = true
+}
+
+// batchCarsBestEffort executes every operation in its own transaction and records the outcome of each operation in its result, it claims the idempotency key before executing any operation so that a concurrent retry cannot execute the operations again, a batch that crashes leaves its key pending until the key expires
+func batchCarsBestEffort(ctx context.Context, c Client, carsBatch dto.CarsBatch) ([]dto.CarsBatchResult, error) {
+	if carsBatch.IdempotencyKey != nil {
+		idempotentResponse, err := c.ClaimIdempotencyKey(ctx, *carsBatch.IdempotencyKey, carsBatch.Test)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed claiming idempotency key")
+		}
+		if idempotentResponse != nil {
+			lib_log.Info(ctx, "Replaying idempotent response", lib_log.FmtAny("idempotentResponse", idempotentResponse))
+			var results []dto.CarsBatchResult
+			if err := json.Unmarshal(idempotentResponse.Body, &results); err != nil {
+				return nil, lib_errors.Wrap(err, "Failed unmarshalling idempotent response body into []dto.CarsBatchResult")
+			}
+			return results, nil
+		}
+	}
+
+	results := make([]dto.CarsBatchResult, len(carsBatch.Operations))
+	for i, operation := range carsBatch.Operations {
+		results[i] = executeCarsBatchOperation(ctx, c, i, operation)
+	}
+
+	// Operations have already been committed individually, the key is completed once all of them have been executed so that a retry replays every result
+	if carsBatch.IdempotencyKey != nil {
+		idempotentResponse, err := newCarsBatchIdempotentResponse(results)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating cars batch idempotent response")
+		}
+		if err := c.CompleteIdempotencyKey(ctx, *carsBatch.IdempotencyKey, *idempotentResponse, carsBatch.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed completing idempotency key")
+		}
+	}
+
+	return results, nil
+}
+
+// executeCarsBatchOperation executes an operation of a best effort batch in its own transaction, a failed operation is recorded in its result
+func executeCarsBatchOperation(ctx context.Context, c Client, index int, operation dto.CarsBatchOperation) dto.CarsBatchResult {
+	result := dto.CarsBatchResult{
+		Index: index,
+	}
+
+	err := operation.Error
+	if err == nil {
+		switch {
+		case operation.CarCreate != nil:
+			result.CarId, err = c.CreateCar(ctx, *operation.CarCreate)
+			result.Status = http.StatusCreated
+
+		case operation.CarUpdate != nil:
+			err = c.UpdateCar(ctx, *operation.CarUpdate)
+			result.CarId = operation.CarUpdate.Id
+			result.Status = http.StatusNoContent
+
+		case operation.CarDelete != nil:
+			err = c.DeleteCar(ctx, *operation.CarDelete)
+			result.CarId = operation.CarDelete.Id
+			result.Status = http.StatusNoContent
+
+		default:
+			err = lib_errors.New("Operation has no car create, update or delete")
+		}
+	}
+	if err != nil {
+		lib_log.Info(ctx, "Failed executing operation, will continue with next operation", lib_log.FmtInt("index", index), lib_log.FmtError(err))
+		return newCarsBatchErrorResult(index, err)
+	}
+
+	return result
+}
+
+// newCarsBatchErrorResult exposes the same status and error messages that the single car route would render for the error
+func newCarsBatchErrorResult(index int, err error) dto.CarsBatchResult {
+	result := dto.CarsBatchResult{
+		Index:  index,
+		Status: http.StatusInternalServerError,
+	}
+	if cerr, ok := err.(lib_errors.Custom); ok {
+		result.Status = cerr.Code
+		if body, _ := cerr.Render(); body != nil {
+			result.Errors, _ = lib_errors.ItemsFromRenderedCustomError(body)
+		}
+	}
+	return result
+}
+
+// withCarsBatchOperationIndex adds the index of the failed operation to the metadata of a custom error so that it is rendered with the error
+func withCarsBatchOperationIndex(err error, index int) error {
+	cerr, ok := err.(lib_errors.Custom)
+	if !ok {
+		return err
+	}
+	metadata := map[string]interface{}{
+		metadataKeyOperationIndex: strconv.Itoa(index),
+	}
+	for k, v := range cerr.Metadata {
+		metadata[k] = v
+	}
+	cerr.Metadata = metadata
+	return cerr
+}
+
+func newCarsBatchIdempotencyKeyMutation(ctx context.Context, idempotencyKey dto.IdempotencyKey, results []dto.CarsBatchResult, ttl time.Duration, test bool) (*spanner.Mutation, error) {
+	idempotentResponse, err := newCarsBatchIdempotentResponse(results)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating cars batch idempotent response")
+	}
+	return newIdempotencyKeyMutation(ctx, idempotencyKey, *idempotentResponse, ttl, test)
+}
+
+func newCarsBatchIdempotentResponse(results []dto.CarsBatchResult) (*dto.IdempotentResponse, error) {
+	body, err := json.Marshal(results)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed marshalling results")
+	}
+	return &dto.IdempotentResponse{
+		Body:       body,
+		StatusCode: http.StatusOK,
+	}, nil
+}
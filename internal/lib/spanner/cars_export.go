@@ -0,0 +1,73 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/dto"
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	"google.golang.org/api/iterator"
+)
+
+// ExportCar is called for each car of an export in the order of the result set
+type ExportCar func(car Car) error
+
+// ExportCars iterates every car matching the filters without pagination, each car is passed to exportCar as it is read so that the result set is never buffered
+func (c client) ExportCars(ctx context.Context, carsExport dto.CarsExport, exportCar ExportCar) (int, error) {
+	lib_log.Info(ctx, "Exporting", lib_log.FmtAny("carsExport", carsExport))
+
+	columns, err := carExportColumnsForFields(carsExport.Fields)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed getting car export columns for fields")
+	}
+
+	sqlFilters, params, err := generateSqlWhereAndParamsForCarsSearch(ctx, carsExport.Filters)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed generating sql where and params for search")
+	}
+
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			%s
+			ORDER BY date_created ASC, car_id ASC
+		`,
+			strings.Join(columns, ", "),
+			tableCar,
+			sqlFilters,
+		),
+		Params: params,
+	}
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := c.spannerClient.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var count int
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return 0, lib_errors.Wrap(err, "Failed iterating car")
+		}
+
+		var car Car
+		if err := row.ToStruct(&car); err != nil {
+			return 0, lib_errors.Wrap(err, "Failed reading car")
+		}
+
+		if err := exportCar(car); err != nil {
+			return 0, lib_errors.Wrap(err, "Failed exporting car")
+		}
+		count++
+	}
+
+	lib_log.Info(ctx, "Exported", lib_log.FmtInt("count", count))
+	return count, nil
+}
@@ -0,0 +1,373 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_misc "github.com/tomwangsvc/lib-svc/misc"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+	"google.golang.org/api/iterator"
+)
+
+type CarsImport struct {
+	CarsImportId string    `spanner:"cars_import_id"`
+	DateCreated  time.Time `spanner:"date_created"`
+	// Report is only set for imports created before the rows of the report were stored in cars_import_report_row
+	Report       []byte             `spanner:"report"`
+	RowsFailed   int64              `spanner:"rows_failed"`
+	RowsImported int64              `spanner:"rows_imported"`
+	RowsTotal    int64              `spanner:"rows_total"`
+	TenantId     spanner.NullString `spanner:"tenant_id"`
+	Test         bool               `spanner:"test"`
+}
+
+// CarsImportReportRow is interleaved in cars_import, so that the size of a report is not limited by the size of a single cell
+type CarsImportReportRow struct {
+	CarId        spanner.NullString `spanner:"car_id"`
+	CarsImportId string             `spanner:"cars_import_id"`
+	Errors       spanner.NullString `spanner:"errors"`
+	Number       int64              `spanner:"number"`
+	Status       int64              `spanner:"status"`
+}
+
+const (
+	tableCarsImport          = "cars_import"
+	tableCarsImportReportRow = "cars_import_report_row"
+)
+
+var (
+	CarsImportColumns          = lib_misc.StructTaggedFieldNames(reflect.TypeOf(CarsImport{}), "spanner")
+	CarsImportReportRowColumns = lib_misc.StructTaggedFieldNames(reflect.TypeOf(CarsImportReportRow{}), "spanner")
+)
+
+func newCarsImportReportRow(carsImportId string, carsImportReportRow dto.CarsImportReportRow) (*CarsImportReportRow, error) {
+	var errors spanner.NullString
+	if len(carsImportReportRow.Errors) > 0 {
+		b, err := json.Marshal(carsImportReportRow.Errors)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed marshalling errors")
+		}
+		errors = spanner.NullString{StringVal: string(b), Valid: true}
+	}
+	return &CarsImportReportRow{
+		CarId:        spanner.NullString{StringVal: carsImportReportRow.CarId, Valid: carsImportReportRow.CarId != ""},
+		CarsImportId: carsImportId,
+		Errors:       errors,
+		Number:       int64(carsImportReportRow.Number),
+		Status:       int64(carsImportReportRow.Status),
+	}, nil
+}
+
+func newDtoCarsImportReportRow(carsImportReportRow CarsImportReportRow) (*dto.CarsImportReportRow, error) {
+	var errors []lib_errors.Item
+	if carsImportReportRow.Errors.Valid {
+		if err := json.Unmarshal([]byte(carsImportReportRow.Errors.StringVal), &errors); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed unmarshalling errors")
+		}
+	}
+	return &dto.CarsImportReportRow{
+		CarId:  carsImportReportRow.CarId.StringVal,
+		Errors: errors,
+		Number: int(carsImportReportRow.Number),
+		Status: int(carsImportReportRow.Status),
+	}, nil
+}
+
+// newCarsImportReportRowChunks splits the rows of the report in chunks of the size of the chunks of the import so that each chunk stays within the mutation limits of a commit, there is always a first chunk as the cars import is committed with it
+func newCarsImportReportRowChunks(rows []dto.CarsImportReportRow, chunkSize int) [][]dto.CarsImportReportRow {
+	if len(rows) == 0 {
+		return [][]dto.CarsImportReportRow{nil}
+	}
+	if chunkSize <= 0 {
+		chunkSize = len(rows)
+	}
+	var chunks [][]dto.CarsImportReportRow
+	for start := 0; start < len(rows); start += chunkSize {
+		end := start + chunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunks = append(chunks, rows[start:end])
+	}
+	return chunks
+}
+
+// ImportCars creates the cars in chunks, each chunk is committed in its own transaction so that large files stay within the mutation limits of a commit
+func (c client) ImportCars(ctx context.Context, carsImportCars []dto.CarsImportCar) ([]dto.CarsImportReportRow, error) {
+	lib_log.Info(ctx, "Importing", lib_log.FmtInt("len(carsImportCars)", len(carsImportCars)), lib_log.FmtInt("c.config.ImportChunkSize", c.config.ImportChunkSize))
+
+	var rows []dto.CarsImportReportRow
+	for start := 0; start < len(carsImportCars); start += c.config.ImportChunkSize {
+		end := start + c.config.ImportChunkSize
+		if end > len(carsImportCars) {
+			end = len(carsImportCars)
+		}
+
+		chunkRows, err := c.importCarsChunk(ctx, carsImportCars[start:end])
+		if err != nil {
+			return nil, lib_errors.Wrapf(err, "Failed importing chunk starting at %d", start)
+		}
+		rows = append(rows, chunkRows...)
+	}
+
+	lib_log.Info(ctx, "Imported", lib_log.FmtInt("len(rows)", len(rows)))
+	return rows, nil
+}
+
+func (c client) importCarsChunk(ctx context.Context, carsImportCars []dto.CarsImportCar) ([]dto.CarsImportReportRow, error) {
+	lib_log.Info(ctx, "Importing chunk", lib_log.FmtInt("len(carsImportCars)", len(carsImportCars)))
+
+	var rows []dto.CarsImportReportRow
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		rows = nil
+
+		existing, err := readExistingBrandAndModelNames(ctx, tx, carsImportCars)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading existing brand and model names")
+		}
+
+		var mutations []*spanner.Mutation
+		for _, v := range carsImportCars {
+			if existing[brandAndModelNameKey(v.CarCreate.UserInput.BrandName, v.CarCreate.UserInput.ModelName)] {
+				rows = append(rows, dto.CarsImportReportRow{
+					Errors: []lib_errors.Item{{Message: "Already exist"}},
+					Number: v.Number,
+					Status: http.StatusConflict,
+				})
+				continue
+			}
+
+			car, err := newCar(ctx, v.CarCreate)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed creating car")
+			}
+			carMutations, err := newCarInsertMutations(ctx, car)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed creating car insert mutations")
+			}
+			mutations = append(mutations, carMutations...)
+
+			rows = append(rows, dto.CarsImportReportRow{
+				CarId:  car.CarId,
+				Number: v.Number,
+				Status: http.StatusCreated,
+			})
+		}
+
+		if len(mutations) == 0 {
+			return nil
+		}
+		if err := tx.BufferWrite(mutations); err != nil {
+			return lib_errors.Wrap(err, "Failed creating cars")
+		}
+
+		return nil
+	}); err != nil {
+		return nil, lib_spanner.WrapError(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Imported chunk", lib_log.FmtInt("len(rows)", len(rows)))
+	return rows, nil
+}
+
+// readExistingBrandAndModelNames returns the keys of the existing cars matching the brand and model names of the cars, names are matched exactly as they are when a single car is created
+func readExistingBrandAndModelNames(ctx context.Context, reader lib_spanner.Reader, carsImportCars []dto.CarsImportCar) (map[string]bool, error) {
+	var brandNames []string
+	for _, v := range carsImportCars {
+		brandNames = append(brandNames, v.CarCreate.UserInput.BrandName)
+	}
+
+	sqlWhere, params, err := generateSqlWhereAndParamsForTenantSearch(ctx, fmt.Sprintf("brand_name IN UNNEST(@brand_names) AND %s", sqlWhereCarNotDeleted), map[string]interface{}{
+		"brand_names": brandNames,
+	}, nil)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed generating sql where and params for tenant search")
+	}
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT brand_name, model_name
+			FROM %s
+			%s
+		`,
+			tableCar,
+			sqlWhere,
+		),
+		Params: params,
+	}
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := reader.Query(ctx, stmt)
+	defer iter.Stop()
+
+	existing := make(map[string]bool)
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, lib_errors.Wrap(err, "Failed iterating car")
+		}
+
+		var brandName string
+		var modelName spanner.NullString
+		if err := row.Columns(&brandName, &modelName); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading brand and model name")
+		}
+		existing[brandAndModelNameKey(brandName, modelName.StringVal)] = true
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(existing)", len(existing)))
+	return existing, nil
+}
+
+func brandAndModelNameKey(brandName, modelName string) string {
+	return fmt.Sprintf("%s\x00%s", brandName, modelName)
+}
+
+// CreateCarsImport stores the rows of the report in chunks after the import, each chunk is committed in its own transaction so that large reports stay within the mutation limits of a commit
+func (c client) CreateCarsImport(ctx context.Context, carsImportReport dto.CarsImportReport, test bool) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtInt("carsImportReport.RowsTotal", carsImportReport.RowsTotal))
+
+	tenantId, err := newTenantId(ctx)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed getting new tenant id")
+	}
+
+	carsImportReport.CarsImportId = uuid.New().String()
+	mutCarsImport, err := spanner.InsertStruct(tableCarsImport, CarsImport{
+		CarsImportId: carsImportReport.CarsImportId,
+		DateCreated:  spanner.CommitTimestamp,
+		RowsFailed:   int64(carsImportReport.RowsFailed),
+		RowsImported: int64(carsImportReport.RowsImported),
+		RowsTotal:    int64(carsImportReport.RowsTotal),
+		TenantId:     tenantId,
+		Test:         test,
+	})
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating mutCarsImport for cars import")
+	}
+
+	// The cars import is committed with the first chunk of rows as the rows are interleaved in it
+	mutations := []*spanner.Mutation{mutCarsImport}
+	chunks := newCarsImportReportRowChunks(carsImportReport.Rows, c.config.ImportChunkSize)
+	for _, chunk := range chunks {
+		for _, v := range chunk {
+			carsImportReportRow, err := newCarsImportReportRow(carsImportReport.CarsImportId, v)
+			if err != nil {
+				return "", lib_errors.Wrap(err, "Failed creating cars import report row")
+			}
+			mutCarsImportReportRow, err := spanner.InsertStruct(tableCarsImportReportRow, carsImportReportRow)
+			if err != nil {
+				return "", lib_errors.Wrap(err, "Failed creating mutCarsImportReportRow for cars import report row")
+			}
+			mutations = append(mutations, mutCarsImportReportRow)
+		}
+
+		if _, err := c.spannerClient.Apply(ctx, mutations); err != nil {
+			return "", lib_spanner.WrapError(err, "Failed applying cars import mutations")
+		}
+		mutations = nil
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("carsImportReport.CarsImportId", carsImportReport.CarsImportId))
+	return carsImportReport.CarsImportId, nil
+}
+
+// ReadCarsImportReport reads the rows of the report from cars_import_report_row, the report stored in the cars import is returned for imports created before the rows were stored separately
+func (c client) ReadCarsImportReport(ctx context.Context, carsImportReportRead dto.CarsImportReportRead) (*dto.CarsImportReport, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("carsImportReportRead", carsImportReportRead))
+
+	ro := c.spannerClient.ReadOnlyTransaction()
+	defer ro.Close()
+
+	var carsImport CarsImport
+	if err := readByIdForTenant(ctx, ro, tableCarsImport, CarsImportColumns, carsImportReportRead.Id, &carsImport); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading cars import")
+	}
+
+	if carsImport.Test != carsImportReportRead.Test {
+		return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+	}
+
+	if carsImport.Report != nil {
+		var carsImportReport dto.CarsImportReport
+		if err := json.Unmarshal(carsImport.Report, &carsImportReport); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed unmarshalling cars import report")
+		}
+		lib_log.Info(ctx, "Read", lib_log.FmtInt("carsImportReport.RowsTotal", carsImportReport.RowsTotal))
+		return &carsImportReport, nil
+	}
+
+	rows, err := readCarsImportReportRows(ctx, ro, carsImport.CarsImportId)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading cars import report rows")
+	}
+
+	carsImportReport := dto.CarsImportReport{
+		CarsImportId: carsImport.CarsImportId,
+		Rows:         rows,
+		RowsFailed:   int(carsImport.RowsFailed),
+		RowsImported: int(carsImport.RowsImported),
+		RowsTotal:    int(carsImport.RowsTotal),
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("carsImportReport.RowsTotal", carsImportReport.RowsTotal))
+	return &carsImportReport, nil
+}
+
+func readCarsImportReportRows(ctx context.Context, reader lib_spanner.Reader, carsImportId string) ([]dto.CarsImportReportRow, error) {
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			WHERE cars_import_id = @cars_import_id
+			ORDER BY number
+		`,
+			strings.Join(CarsImportReportRowColumns, ", "),
+			tableCarsImportReportRow,
+		),
+		Params: map[string]interface{}{
+			"cars_import_id": carsImportId,
+		},
+	}
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := reader.Query(ctx, stmt)
+	defer iter.Stop()
+
+	var rows []dto.CarsImportReportRow
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, lib_errors.Wrap(err, "Failed iterating cars import report row")
+		}
+
+		var carsImportReportRow CarsImportReportRow
+		if err := row.ToStruct(&carsImportReportRow); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading cars import report row")
+		}
+		dtoCarsImportReportRow, err := newDtoCarsImportReportRow(carsImportReportRow)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating dto cars import report row")
+		}
+		rows = append(rows, *dtoCarsImportReportRow)
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(rows)", len(rows)))
+	return rows, nil
+}
@@ -4,10 +4,13 @@ import (
 	"car-svc/internal/lib/dto"
 	"context"
 	"fmt"
+	"time"
 
+	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
 	lib_env "github.com/tomwangsvc/lib-svc/env"
 	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
 	lib_log "github.com/tomwangsvc/lib-svc/log"
 	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
 	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
@@ -15,13 +18,54 @@ import (
 
 type Client interface {
 	Close()
-	TransformCarToJson(ctx context.Context, car Car) ([]byte, error)
-	TransformCarsToJson(ctx context.Context, cars []Car) ([]byte, error)
+	Ping(ctx context.Context) error
+	ReadFleetCounts(ctx context.Context) (*FleetCounts, error)
+	TransformCarToJson(ctx context.Context, car Car, fields []string) ([]byte, error)
+	TransformCarsToJson(ctx context.Context, cars []Car, fields []string) ([]byte, error)
 	CreateCar(ctx context.Context, carCreate dto.CarCreate) (string, error)
 	SearchCars(ctx context.Context, carsSearch dto.CarsSearch) ([]Car, *lib_pagination.Pagination, error)
+	ExportCars(ctx context.Context, carsExport dto.CarsExport, exportCar ExportCar) (int, error)
 	ReadCar(ctx context.Context, carRead dto.CarRead) (*Car, error)
 	UpdateCar(ctx context.Context, carUpdate dto.CarUpdate) error
+	PatchCar(ctx context.Context, carPatch dto.CarPatch, checkCar CheckCar) error
 	DeleteCar(ctx context.Context, carDelete dto.CarDelete) error
+	RestoreCar(ctx context.Context, carRestore dto.CarRestore) error
+	PurgeCars(ctx context.Context, dateDeletedBefore time.Time) (int64, error)
+	BatchCars(ctx context.Context, carsBatch dto.CarsBatch) ([]dto.CarsBatchResult, error)
+	ClaimIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, test bool) (*dto.IdempotentResponse, error)
+	CompleteIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, idempotentResponse dto.IdempotentResponse, test bool) error
+	ReleaseIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey) error
+	ImportCars(ctx context.Context, carsImportCars []dto.CarsImportCar) ([]dto.CarsImportReportRow, error)
+	CreateCarsImport(ctx context.Context, carsImportReport dto.CarsImportReport, test bool) (string, error)
+	ReadCarsImportReport(ctx context.Context, carsImportReportRead dto.CarsImportReportRead) (*dto.CarsImportReport, error)
+	SearchCarHistory(ctx context.Context, carHistorySearch dto.CarHistorySearch) ([]CarHistory, *lib_pagination.Pagination, error)
+	TransformCarHistoryToJson(ctx context.Context, carHistory []CarHistory) ([]byte, error)
+	RevertCar(ctx context.Context, carRevert dto.CarRevert) error
+	ReadCarChanges(ctx context.Context, carChangesRead dto.CarChangesRead) ([]CarHistory, *dto.CarChangesToken, error)
+	CreateCarCustomerAssociation(ctx context.Context, carCustomerAssociationCreate dto.CarCustomerAssociationCreate) (string, error)
+	ReadOutboxEventsUnpublished(ctx context.Context, limit int) ([]OutboxEvent, error)
+	UpdateOutboxEventsPublished(ctx context.Context, outboxEventIds []string) error
+	ReadCustomer(ctx context.Context, customerRead dto.CustomerRead) (*Customer, error)
+	TransformCustomerToJson(ctx context.Context, customer Customer, redactions map[string]lib_json.Redaction) ([]byte, error)
+	BlockCustomer(ctx context.Context, customerEvent dto.CustomerEvent) error
+	CreateWebhookSubscription(ctx context.Context, webhookSubscriptionCreate dto.WebhookSubscriptionCreate) (string, error)
+	SearchWebhookSubscriptions(ctx context.Context, webhookSubscriptionsSearch dto.WebhookSubscriptionsSearch) ([]WebhookSubscription, *lib_pagination.Pagination, error)
+	DeleteWebhookSubscription(ctx context.Context, webhookSubscriptionDelete dto.WebhookSubscriptionDelete) error
+	ReadWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error)
+	CreateWebhookDeliveries(ctx context.Context, events []dto.Event, webhookSubscriptions []WebhookSubscription) (int, error)
+	ReadWebhookDeliveriesDue(ctx context.Context, limit int) ([]WebhookDeliveryDue, error)
+	UpdateWebhookDeliveryAttempted(ctx context.Context, webhookDelivery WebhookDelivery, webhookDeliveryAttempt dto.WebhookDeliveryAttempt) error
+	SearchWebhookDeliveries(ctx context.Context, webhookDeliveriesSearch dto.WebhookDeliveriesSearch) ([]WebhookDelivery, *lib_pagination.Pagination, error)
+	RedeliverWebhookDelivery(ctx context.Context, webhookDeliveryRedeliver dto.WebhookDeliveryRedeliver) error
+	TransformWebhookSubscriptionsToJson(ctx context.Context, webhookSubscriptions []WebhookSubscription) ([]byte, error)
+	TransformWebhookDeliveriesToJson(ctx context.Context, webhookDeliveries []WebhookDelivery) ([]byte, error)
+	CreateApiKey(ctx context.Context, apiKeyCreate dto.ApiKeyCreate) (string, error)
+	SearchApiKeys(ctx context.Context, apiKeysSearch dto.ApiKeysSearch) ([]ApiKey, *lib_pagination.Pagination, error)
+	ReadApiKeyByKeyHash(ctx context.Context, keyHash string) (*ApiKey, error)
+	RotateApiKey(ctx context.Context, apiKeyRotate dto.ApiKeyRotate) (string, error)
+	RevokeApiKey(ctx context.Context, apiKeyRevoke dto.ApiKeyRevoke) error
+	ConsumeApiKeyQuota(ctx context.Context, lineageApiKeyId string, day civil.Date, dailyQuota int64) (int64, error)
+	TransformApiKeysToJson(ctx context.Context, apiKeys []ApiKey) ([]byte, error)
 
 	TransformBrandClassAssociationToJson(ctx context.Context, carCustomerAssociation CarCustomerAssociation) ([]byte, error)
 	TransformBrandClassAssociationsToJson(ctx context.Context, carCustomerAssociations []CarCustomerAssociation) ([]byte, error)
@@ -29,34 +73,83 @@ type Client interface {
 
 type Config struct {
 	spanner.ClientConfig
-	DatabaseId string
-	Env        lib_env.Env
-	InstanceId string
-	ProjectId  string
+	DatabaseId        string
+	Env               lib_env.Env
+	IdempotencyKeyTtl time.Duration
+	ImportChunkSize   int
+	InstanceId        string
+	ProjectId         string
+
+	// IdempotencyKeyPendingTtl is how long a claimed key is pending, so that a retry can claim the key of a request that crashed or failed to complete it once that request can no longer be running
+	IdempotencyKeyPendingTtl time.Duration
+
+	// InMemory selects the in-memory client so that the service runs without a Spanner database, as it does locally and in tests
+	InMemory bool
+
+	// PostgresDataSourceName selects the PostgreSQL client when it is set, so that the service runs on a PostgreSQL database with the schema of scripts/postgres
+	PostgresDataSourceName string `json:"-"`
+
+	// VersionRetentionPeriod limits the stale reads of the in-memory client, the spanner client reads the version_retention_period of the database instead
+	VersionRetentionPeriod time.Duration
+}
+
+// idempotencyKeyPendingTtl falls back to the ttl of a completed key, so that a key is never reclaimed while its request may still be running
+func (c Config) idempotencyKeyPendingTtl() time.Duration {
+	if c.IdempotencyKeyPendingTtl > 0 {
+		return c.IdempotencyKeyPendingTtl
+	}
+	return c.IdempotencyKeyTtl
 }
 
 func NewClient(ctx context.Context, config Config) (Client, error) {
+	if config.InMemory {
+		return NewInMemoryClient(ctx, config), nil
+	}
+	if config.PostgresDataSourceName != "" {
+		return NewPostgresClient(ctx, config)
+	}
+
 	lib_log.Info(ctx, "Initializing", lib_log.FmtAny("config", config))
+	// The stat views are enabled before the client is created so that the sessions it opens on creation are recorded
+	if err := enableSessionPoolMetrics(); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed enabling session pool metrics")
+	}
 	spannerClient, err := spanner.NewClientWithConfig(ctx, fmt.Sprintf("projects/%s/instances/%s/databases/%s", config.ProjectId, config.InstanceId, config.DatabaseId), config.ClientConfig)
 	if err != nil {
 		return nil, lib_errors.Wrap(err, "Failed creating spanner client with config")
 	}
+	config.VersionRetentionPeriod, err = readVersionRetentionPeriod(ctx, spannerClient.Single())
+	if err != nil {
+		spannerClient.Close()
+		return nil, lib_errors.Wrap(err, "Failed reading version retention period")
+	}
 	lib_log.Info(ctx, "Initialized")
 	return client{
 		config:        config,
-		spannerClient: spannerClient,
+		spannerClient: instrumentedClient{spannerClient},
 	}, nil
 }
 
 type client struct {
 	config        Config
-	spannerClient *spanner.Client
+	spannerClient instrumentedClient
 }
 
 func (c client) Close() {
 	c.spannerClient.Close()
 }
 
+// Ping runs SELECT 1 so that readiness reports whether a session can be taken and a query run
+func (c client) Ping(ctx context.Context) error {
+	iter := c.spannerClient.Single().Query(ctx, spanner.Statement{SQL: "SELECT 1"})
+	defer iter.Stop()
+
+	if _, err := iter.Next(); err != nil {
+		return lib_errors.Wrap(err, "Failed iterating select 1")
+	}
+	return nil
+}
+
 type ReadWriteTransaction func(context.Context, *spanner.ReadWriteTransaction) error
 
 type searchFilters map[string]searchFilter
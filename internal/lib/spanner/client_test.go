@@ -0,0 +1,2079 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/actor"
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/patch"
+	"car-svc/internal/lib/rbac"
+	"car-svc/internal/lib/tenant"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	lib_brand "github.com/tomwangsvc/lib-svc/brand"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+	lib_search "github.com/tomwangsvc/lib-svc/search"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_Client_CreateCar(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+
+	var data = []struct {
+		desc     string
+		ctx      context.Context
+		input    dto.CarCreate
+		expected int
+	}{
+		{
+			desc:  "car",
+			ctx:   ctxBoxer,
+			input: dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}},
+		},
+		{
+			desc:     "car with the same brand and model name",
+			ctx:      ctxBoxer,
+			input:    dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}},
+			expected: http.StatusConflict,
+		},
+		{
+			desc:  "car with the same brand and model name in another tenant",
+			ctx:   ctxTomWang,
+			input: dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}},
+		},
+		{
+			desc:     "car without tenant",
+			ctx:      rbac.WithTrusted(context.Background()),
+			input:    dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Honda", ModelName: "Civic"}},
+			expected: -1,
+		},
+		{
+			desc:     "car without grants",
+			ctx:      tenant.WithTenantId(context.Background(), lib_brand.BoxerId),
+			input:    dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Honda", ModelName: "Civic"}},
+			expected: http.StatusForbidden,
+		},
+	}
+
+	for _, testClient := range newTestClients(t) {
+		for i, d := range data {
+			_, err := testClient.CreateCar(d.ctx, d.input)
+			if ok := checkClientErr(err, d.expected); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     err,
+				}))
+			}
+		}
+	}
+}
+
+func Test_Client_UpdateCar(t *testing.T) {
+	for _, testClient := range newTestClients(t) {
+		testUpdateCar(t, testClient)
+	}
+}
+
+func testUpdateCar(t *testing.T, c testClient) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+
+	carId, err := c.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCarId, err := c.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Yaris"}, Test: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	car, err := c.ReadCar(ctxBoxer, dto.CarRead{Id: carId})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aygo := "Aygo"
+	camry := "Camry"
+	toyota := "Toyota"
+
+	var data = []struct {
+		desc     string
+		ctx      context.Context
+		input    dto.CarUpdate
+		expected int
+	}{
+		{
+			desc:  "car of tenant",
+			ctx:   ctxBoxer,
+			input: dto.CarUpdate{Id: carId, UserInput: dto.CarUpdateUserInput{BrandName: &toyota, ModelName: &camry}},
+		},
+		{
+			desc:     "car modified since",
+			ctx:      ctxBoxer,
+			input:    dto.CarUpdate{Id: carId, IfUnmodifiedSince: &car.DateCreated, UserInput: dto.CarUpdateUserInput{BrandName: &toyota, ModelName: &aygo}},
+			expected: http.StatusPreconditionFailed,
+		},
+		{
+			desc:     "car of another tenant",
+			ctx:      ctxTomWang,
+			input:    dto.CarUpdate{Id: carId, UserInput: dto.CarUpdateUserInput{BrandName: &toyota, ModelName: &camry}},
+			expected: http.StatusNotFound,
+		},
+		{
+			desc:     "test car without test",
+			ctx:      ctxBoxer,
+			input:    dto.CarUpdate{Id: testCarId, UserInput: dto.CarUpdateUserInput{BrandName: &toyota, ModelName: &aygo}},
+			expected: http.StatusUnprocessableEntity,
+		},
+		{
+			desc:  "test car with test",
+			ctx:   ctxBoxer,
+			input: dto.CarUpdate{Id: testCarId, UserInput: dto.CarUpdateUserInput{BrandName: &toyota, ModelName: &aygo}, Test: true},
+		},
+	}
+
+	for i, d := range data {
+		err := c.UpdateCar(d.ctx, d.input)
+		if ok := checkClientErr(err, d.expected); !ok {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       c.desc(d.desc),
+				At:         i,
+				Expected:   d.expected,
+				Result:     err,
+			}))
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		car, err := c.ReadCar(d.ctx, dto.CarRead{Id: d.input.Id})
+		if err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err exists",
+				Desc:       c.desc(d.desc),
+				At:         i,
+				Expected:   nil,
+				Result:     err.Error(),
+			}))
+			continue
+		}
+		if car.ModelName.StringVal != *d.input.UserInput.ModelName {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "car.ModelName",
+				Desc:       c.desc(d.desc),
+				At:         i,
+				Expected:   *d.input.UserInput.ModelName,
+				Result:     car.ModelName,
+			}))
+		}
+	}
+}
+
+func Test_Client_ReadCar(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+
+	for _, testClient := range newTestClients(t) {
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		deletedCarId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Yaris"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.DeleteCar(ctxBoxer, dto.CarDelete{Id: deletedCarId}); err != nil {
+			t.Fatal(err)
+		}
+
+		type expected struct {
+			brandName string
+			code      int
+			modelName string
+		}
+		var data = []struct {
+			desc  string
+			ctx   context.Context
+			input dto.CarRead
+			expected
+		}{
+			{
+				desc:     "car of tenant",
+				ctx:      ctxBoxer,
+				input:    dto.CarRead{Id: carId},
+				expected: expected{brandName: "Toyota", modelName: "Corolla"},
+			},
+			{
+				desc:     "fields of car of tenant",
+				ctx:      ctxBoxer,
+				input:    dto.CarRead{Fields: []string{"car_id", "model_name"}, Id: carId},
+				expected: expected{modelName: "Corolla"},
+			},
+			{
+				desc:     "car of another tenant",
+				ctx:      ctxTomWang,
+				input:    dto.CarRead{Id: carId},
+				expected: expected{code: http.StatusNotFound},
+			},
+			{
+				desc:     "car not existing",
+				ctx:      ctxBoxer,
+				input:    dto.CarRead{Id: "car-id"},
+				expected: expected{code: http.StatusNotFound},
+			},
+			{
+				desc:     "deleted car",
+				ctx:      ctxBoxer,
+				input:    dto.CarRead{Id: deletedCarId},
+				expected: expected{code: http.StatusNotFound},
+			},
+			{
+				desc:     "deleted car including deleted",
+				ctx:      ctxBoxer,
+				input:    dto.CarRead{Id: deletedCarId, IncludeDeleted: true},
+				expected: expected{brandName: "Toyota", modelName: "Yaris"},
+			},
+		}
+
+		for i, d := range data {
+			car, err := testClient.ReadCar(d.ctx, d.input)
+			if ok := checkClientErr(err, d.expected.code); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected.code,
+					Result:     err,
+				}))
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			if car.CarId != d.input.Id || car.BrandName != d.expected.brandName || car.ModelName.StringVal != d.expected.modelName {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "car",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     car,
+				}))
+			}
+		}
+	}
+}
+
+func Test_Client_PatchCar(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+	checkCar := func(_ context.Context, _ []byte) error { return nil }
+
+	for _, testClient := range newTestClients(t) {
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var data = []struct {
+			desc     string
+			ctx      context.Context
+			input    dto.CarPatch
+			expected int
+		}{
+			{
+				desc:     "patch changing a read only field",
+				ctx:      ctxBoxer,
+				input:    dto.CarPatch{ContentType: patch.ContentTypeJsonMergePatch, Id: carId, Patch: []byte(`{"car_id":"car-id"}`)},
+				expected: http.StatusUnprocessableEntity,
+			},
+			{
+				desc:     "patch removing a required field",
+				ctx:      ctxBoxer,
+				input:    dto.CarPatch{ContentType: patch.ContentTypeJsonMergePatch, Id: carId, Patch: []byte(`{"brand_name":null}`)},
+				expected: http.StatusUnprocessableEntity,
+			},
+			{
+				desc:     "car of another tenant",
+				ctx:      ctxTomWang,
+				input:    dto.CarPatch{ContentType: patch.ContentTypeJsonMergePatch, Id: carId, Patch: []byte(`{"model_name":"Yaris"}`)},
+				expected: http.StatusNotFound,
+			},
+			{
+				desc:  "car of tenant",
+				ctx:   ctxBoxer,
+				input: dto.CarPatch{ContentType: patch.ContentTypeJsonMergePatch, Id: carId, Patch: []byte(`{"model_name":"Camry"}`)},
+			},
+		}
+
+		for i, d := range data {
+			err := testClient.PatchCar(d.ctx, d.input, checkCar)
+			if ok := checkClientErr(err, d.expected); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     err,
+				}))
+			}
+		}
+
+		// Only the last patch is applied
+		car, err := testClient.ReadCar(ctxBoxer, dto.CarRead{Id: carId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if car.BrandName != "Toyota" || car.ModelName.StringVal != "Camry" {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "car",
+				Desc:       testClient.desc("patched car"),
+				Expected:   "Toyota Camry",
+				Result:     car,
+			}))
+		}
+	}
+}
+
+func Test_Client_DeleteCar(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+
+	for _, testClient := range newTestClients(t) {
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		testCarId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Yaris"}, Test: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var data = []struct {
+			desc     string
+			ctx      context.Context
+			input    dto.CarDelete
+			expected int
+		}{
+			{
+				desc:     "car of another tenant",
+				ctx:      ctxTomWang,
+				input:    dto.CarDelete{Id: carId},
+				expected: http.StatusNotFound,
+			},
+			{
+				desc:     "test car without test",
+				ctx:      ctxBoxer,
+				input:    dto.CarDelete{Id: testCarId},
+				expected: http.StatusUnprocessableEntity,
+			},
+			{
+				desc:  "car of tenant",
+				ctx:   ctxBoxer,
+				input: dto.CarDelete{Id: carId},
+			},
+			{
+				desc:     "deleted car",
+				ctx:      ctxBoxer,
+				input:    dto.CarDelete{Id: carId},
+				expected: http.StatusNotFound,
+			},
+		}
+
+		for i, d := range data {
+			err := testClient.DeleteCar(d.ctx, d.input)
+			if ok := checkClientErr(err, d.expected); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     err,
+				}))
+			}
+		}
+
+		// A deleted car is kept as a tombstone so that it can be restored
+		car, err := testClient.ReadCar(ctxBoxer, dto.CarRead{Id: carId, IncludeDeleted: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !car.DateDeleted.Valid {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "car.DateDeleted",
+				Desc:       testClient.desc("deleted car"),
+				Result:     car.DateDeleted,
+			}))
+		}
+	}
+}
+
+func Test_Client_RestoreCar(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+
+	for _, testClient := range newTestClients(t) {
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.DeleteCar(ctxBoxer, dto.CarDelete{Id: carId}); err != nil {
+			t.Fatal(err)
+		}
+		replacedCarId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Yaris"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.DeleteCar(ctxBoxer, dto.CarDelete{Id: replacedCarId}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Yaris"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		var data = []struct {
+			desc     string
+			ctx      context.Context
+			input    dto.CarRestore
+			expected int
+		}{
+			{
+				desc:     "car of another tenant",
+				ctx:      ctxTomWang,
+				input:    dto.CarRestore{Id: carId},
+				expected: http.StatusNotFound,
+			},
+			{
+				desc:     "car whose brand and model name have been reused",
+				ctx:      ctxBoxer,
+				input:    dto.CarRestore{Id: replacedCarId},
+				expected: http.StatusConflict,
+			},
+			{
+				desc:  "deleted car",
+				ctx:   ctxBoxer,
+				input: dto.CarRestore{Id: carId},
+			},
+			{
+				desc:  "car not deleted",
+				ctx:   ctxBoxer,
+				input: dto.CarRestore{Id: carId},
+			},
+		}
+
+		for i, d := range data {
+			err := testClient.RestoreCar(d.ctx, d.input)
+			if ok := checkClientErr(err, d.expected); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     err,
+				}))
+			}
+		}
+
+		if _, err := testClient.ReadCar(ctxBoxer, dto.CarRead{Id: carId}); err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       testClient.desc("restored car"),
+				Result:     err,
+			}))
+		}
+	}
+}
+
+func Test_Client_SearchCarHistory(t *testing.T) {
+	ctxBoxer := actor.WithActor(tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId), "tom@example.com")
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+	camry := "Camry"
+
+	for _, testClient := range newTestClients(t) {
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.UpdateCar(ctxBoxer, dto.CarUpdate{Id: carId, UserInput: dto.CarUpdateUserInput{ModelName: &camry}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.DeleteCar(ctxBoxer, dto.CarDelete{Id: carId}); err != nil {
+			t.Fatal(err)
+		}
+
+		type expected struct {
+			operations []string
+			total      int64
+		}
+		var data = []struct {
+			desc  string
+			ctx   context.Context
+			input dto.CarHistorySearch
+			expected
+		}{
+			{
+				desc:  "history of car oldest first",
+				ctx:   ctxBoxer,
+				input: dto.CarHistorySearch{CarId: carId, Pagination: lib_pagination.Pagination{Limit: 10, Order: "ASC"}},
+				expected: expected{
+					operations: []string{dto.CarHistoryOperationCreate, dto.CarHistoryOperationUpdate, dto.CarHistoryOperationDelete},
+					total:      3,
+				},
+			},
+			{
+				desc:  "last page of history of car newest first",
+				ctx:   ctxBoxer,
+				input: dto.CarHistorySearch{CarId: carId, Pagination: lib_pagination.Pagination{Limit: 2, Offset: 2, Order: "DESC"}},
+				expected: expected{
+					operations: []string{dto.CarHistoryOperationCreate},
+					total:      3,
+				},
+			},
+			{
+				desc:  "history of car of another tenant",
+				ctx:   ctxTomWang,
+				input: dto.CarHistorySearch{CarId: carId, Pagination: lib_pagination.Pagination{Limit: 10, Order: "ASC"}},
+			},
+			{
+				desc:  "history of car with test",
+				ctx:   ctxBoxer,
+				input: dto.CarHistorySearch{CarId: carId, Pagination: lib_pagination.Pagination{Limit: 10, Order: "ASC"}, Test: true},
+			},
+		}
+
+		for i, d := range data {
+			carHistory, pagination, err := testClient.SearchCarHistory(d.ctx, d.input)
+			if err != nil {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err exists",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   nil,
+					Result:     err.Error(),
+				}))
+				continue
+			}
+
+			var operations []string
+			for _, v := range carHistory {
+				operations = append(operations, v.Operation)
+				if v.Actor != "tom@example.com" {
+					t.Error(lib_testing.Errorf(lib_testing.Error{
+						Unexpected: "carHistory.Actor",
+						Desc:       testClient.desc(d.desc),
+						At:         i,
+						Expected:   "tom@example.com",
+						Result:     v.Actor,
+					}))
+				}
+			}
+			if !reflect.DeepEqual(operations, d.expected.operations) {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "operations",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected.operations,
+					Result:     operations,
+				}))
+			}
+			if pagination.Total == nil || *pagination.Total != d.expected.total {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "pagination.Total",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected.total,
+					Result:     pagination.Total,
+				}))
+			}
+		}
+	}
+}
+
+func Test_Client_RevertCar(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+	camry := "Camry"
+
+	for _, testClient := range newTestClients(t) {
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.UpdateCar(ctxBoxer, dto.CarUpdate{Id: carId, UserInput: dto.CarUpdateUserInput{ModelName: &camry}}); err != nil {
+			t.Fatal(err)
+		}
+		otherCarId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Yaris"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.DeleteCar(ctxBoxer, dto.CarDelete{Id: otherCarId}); err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.RestoreCar(ctxBoxer, dto.CarRestore{Id: otherCarId}); err != nil {
+			t.Fatal(err)
+		}
+
+		car, err := testClient.ReadCar(ctxBoxer, dto.CarRead{Id: carId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		carHistory, _, err := testClient.SearchCarHistory(ctxBoxer, dto.CarHistorySearch{CarId: carId, Pagination: lib_pagination.Pagination{Limit: 1, Order: "ASC"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherCarHistory, _, err := testClient.SearchCarHistory(ctxBoxer, dto.CarHistorySearch{CarId: otherCarId, Pagination: lib_pagination.Pagination{Limit: 10, Order: "ASC"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(carHistory) != 1 || len(otherCarHistory) != 3 {
+			t.Fatalf("Expected the history of the cars, got %v and %v", carHistory, otherCarHistory)
+		}
+		dateUpdated := car.DateUpdated.Time
+
+		var data = []struct {
+			desc     string
+			ctx      context.Context
+			input    dto.CarRevert
+			expected int
+		}{
+			{
+				desc:     "car modified since",
+				ctx:      ctxBoxer,
+				input:    dto.CarRevert{Id: carId, IfUnmodifiedSince: &car.DateCreated, UserInput: dto.CarRevertUserInput{CarHistoryId: &carHistory[0].CarHistoryId}},
+				expected: http.StatusPreconditionFailed,
+			},
+			{
+				desc:     "car of another tenant",
+				ctx:      ctxTomWang,
+				input:    dto.CarRevert{Id: carId, IfUnmodifiedSince: &dateUpdated, UserInput: dto.CarRevertUserInput{CarHistoryId: &carHistory[0].CarHistoryId}},
+				expected: http.StatusNotFound,
+			},
+			{
+				desc:     "history of another car",
+				ctx:      ctxBoxer,
+				input:    dto.CarRevert{Id: carId, IfUnmodifiedSince: &dateUpdated, UserInput: dto.CarRevertUserInput{CarHistoryId: &otherCarHistory[0].CarHistoryId}},
+				expected: http.StatusNotFound,
+			},
+			{
+				desc:     "deleted version of car",
+				ctx:      ctxBoxer,
+				input:    dto.CarRevert{Id: otherCarId, UserInput: dto.CarRevertUserInput{CarHistoryId: &otherCarHistory[1].CarHistoryId}},
+				expected: http.StatusUnprocessableEntity,
+			},
+			{
+				desc:  "car not modified since",
+				ctx:   ctxBoxer,
+				input: dto.CarRevert{Id: carId, IfUnmodifiedSince: &dateUpdated, UserInput: dto.CarRevertUserInput{CarHistoryId: &carHistory[0].CarHistoryId}},
+			},
+		}
+
+		for i, d := range data {
+			err := testClient.RevertCar(d.ctx, d.input)
+			if ok := checkClientErr(err, d.expected); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     err,
+				}))
+			}
+		}
+
+		// The revert is recorded as a change of its own
+		car, err = testClient.ReadCar(ctxBoxer, dto.CarRead{Id: carId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if car.ModelName.StringVal != "Corolla" {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "car.ModelName",
+				Desc:       testClient.desc("reverted car"),
+				Expected:   "Corolla",
+				Result:     car.ModelName,
+			}))
+		}
+		carHistory, _, err = testClient.SearchCarHistory(ctxBoxer, dto.CarHistorySearch{CarId: carId, Pagination: lib_pagination.Pagination{Limit: 1, Order: "DESC"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(carHistory) != 1 || carHistory[0].Operation != dto.CarHistoryOperationRevert {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "carHistory",
+				Desc:       testClient.desc("reverted car"),
+				Expected:   dto.CarHistoryOperationRevert,
+				Result:     carHistory,
+			}))
+		}
+	}
+}
+
+func Test_Client_ReadCarChanges(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+	camry := "Camry"
+
+	for _, testClient := range newTestClients(t) {
+		// The feed starts at the read timestamp when no since token is requested
+		_, since, err := testClient.ReadCarChanges(ctxBoxer, dto.CarChangesRead{Pagination: lib_pagination.Pagination{Limit: 10}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.UpdateCar(ctxBoxer, dto.CarUpdate{Id: carId, UserInput: dto.CarUpdateUserInput{ModelName: &camry}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := testClient.CreateCar(ctxTomWang, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Yaris"}, Test: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		changes, next, err := testClient.ReadCarChanges(ctxBoxer, dto.CarChangesRead{Pagination: lib_pagination.Pagination{Limit: 1}, Since: since})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastChanges, last, err := testClient.ReadCarChanges(ctxBoxer, dto.CarChangesRead{Pagination: lib_pagination.Pagination{Limit: 10}, Since: next})
+		if err != nil {
+			t.Fatal(err)
+		}
+		noChanges, _, err := testClient.ReadCarChanges(ctxBoxer, dto.CarChangesRead{Pagination: lib_pagination.Pagination{Limit: 10}, Since: last})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Each page of the feed continues after the last change of the previous page, the changes of other tenants and of test cars are not in it
+		for i, v := range []struct {
+			desc       string
+			changes    []CarHistory
+			operations []string
+		}{
+			{desc: "first page", changes: changes, operations: []string{dto.CarHistoryOperationCreate}},
+			{desc: "last page", changes: lastChanges, operations: []string{dto.CarHistoryOperationUpdate}},
+			{desc: "no changes", changes: noChanges},
+		} {
+			var operations []string
+			for _, change := range v.changes {
+				if change.CarId != carId {
+					t.Error(lib_testing.Errorf(lib_testing.Error{
+						Unexpected: "change.CarId",
+						Desc:       testClient.desc(v.desc),
+						At:         i,
+						Expected:   carId,
+						Result:     change.CarId,
+					}))
+				}
+				operations = append(operations, change.Operation)
+			}
+			if !reflect.DeepEqual(operations, v.operations) {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "operations",
+					Desc:       testClient.desc(v.desc),
+					At:         i,
+					Expected:   v.operations,
+					Result:     operations,
+				}))
+			}
+		}
+		if len(lastChanges) == 1 && (last.CarHistoryId != lastChanges[0].CarHistoryId || !last.DateCreated.Equal(lastChanges[0].DateCreated)) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "last",
+				Desc:       testClient.desc("token after last change"),
+				Expected:   lastChanges[0],
+				Result:     last,
+			}))
+		}
+	}
+}
+
+func Test_Client_SearchCars(t *testing.T) {
+	for _, testClient := range newTestClients(t) {
+		testSearchCars(t, testClient)
+	}
+}
+
+func testSearchCars(t *testing.T, c testClient) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+
+	for _, v := range []string{"Corolla", "Camry", "Yaris"} {
+		if _, err := c.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: v}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Honda", ModelName: "Civic"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateCar(tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId), dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	type expected struct {
+		modelNames []string
+		total      int64
+	}
+	var data = []struct {
+		desc  string
+		input dto.CarsSearch
+		expected
+	}{
+		{
+			desc: "first page of brand",
+			input: dto.CarsSearch{
+				Filters:    dto.CarsSearchFilters{LinkedFilters: []lib_search.LinkedFilter{{Filter: &lib_search.Filter{Key: "brand_name", Value: "Toyota"}}}},
+				Pagination: lib_pagination.Pagination{Limit: 2, Order: "ASC"},
+			},
+			expected: expected{
+				modelNames: []string{"Corolla", "Camry"},
+				total:      3,
+			},
+		},
+		{
+			desc: "last page of brand",
+			input: dto.CarsSearch{
+				Filters:    dto.CarsSearchFilters{LinkedFilters: []lib_search.LinkedFilter{{Filter: &lib_search.Filter{Key: "brand_name", Value: "Toyota"}}}},
+				Pagination: lib_pagination.Pagination{Limit: 2, Offset: 2, Order: "ASC"},
+			},
+			expected: expected{
+				modelNames: []string{"Yaris"},
+				total:      3,
+			},
+		},
+		{
+			desc: "all cars of tenant newest first",
+			input: dto.CarsSearch{
+				Pagination: lib_pagination.Pagination{Limit: 10, Order: "DESC"},
+			},
+			expected: expected{
+				modelNames: []string{"Civic", "Yaris", "Camry", "Corolla"},
+				total:      4,
+			},
+		},
+	}
+
+	for i, d := range data {
+		cars, pagination, err := c.SearchCars(ctxBoxer, d.input)
+		if err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err exists",
+				Desc:       c.desc(d.desc),
+				At:         i,
+				Expected:   nil,
+				Result:     err.Error(),
+			}))
+			continue
+		}
+
+		var modelNames []string
+		for _, v := range cars {
+			modelNames = append(modelNames, v.ModelName.StringVal)
+		}
+		if !reflect.DeepEqual(modelNames, d.expected.modelNames) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "modelNames",
+				Desc:       c.desc(d.desc),
+				At:         i,
+				Expected:   d.expected.modelNames,
+				Result:     modelNames,
+			}))
+		}
+
+		if pagination.Total == nil || *pagination.Total != d.expected.total {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "pagination.Total",
+				Desc:       c.desc(d.desc),
+				At:         i,
+				Expected:   d.expected.total,
+				Result:     pagination.Total,
+			}))
+		}
+	}
+}
+
+func Test_Client_ClaimIdempotencyKey(t *testing.T) {
+	ctxBoxer := actor.WithActor(tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId), "tom@example.com")
+	ctxBoxerOtherCaller := actor.WithActor(tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId), "api_key:api-key-id")
+	ctxTomWang := actor.WithActor(tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId), "tom@example.com")
+
+	idempotencyKey := dto.IdempotencyKey{Key: "key", RequestHash: "hash"}
+	created := dto.IdempotentResponse{Location: "car-id", StatusCode: http.StatusCreated}
+
+	var data = []struct {
+		desc     string
+		input    func(c Client) (*dto.IdempotentResponse, error)
+		expected *dto.IdempotentResponse
+		code     int
+	}{
+		{
+			desc: "key not used",
+			input: func(c Client) (*dto.IdempotentResponse, error) {
+				return c.ClaimIdempotencyKey(ctxBoxer, idempotencyKey, false)
+			},
+		},
+		{
+			desc: "key claimed by a request that has not completed",
+			input: func(c Client) (*dto.IdempotentResponse, error) {
+				return c.ClaimIdempotencyKey(ctxBoxer, idempotencyKey, false)
+			},
+			code: http.StatusConflict,
+		},
+		{
+			desc: "key claimed for a different request",
+			input: func(c Client) (*dto.IdempotentResponse, error) {
+				return c.ClaimIdempotencyKey(ctxBoxer, dto.IdempotencyKey{Key: idempotencyKey.Key, RequestHash: "other-hash"}, false)
+			},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			desc: "key claimed by another caller of the tenant",
+			input: func(c Client) (*dto.IdempotentResponse, error) {
+				return c.ClaimIdempotencyKey(ctxBoxerOtherCaller, idempotencyKey, false)
+			},
+		},
+		{
+			desc: "key claimed by the caller in another tenant",
+			input: func(c Client) (*dto.IdempotentResponse, error) {
+				return c.ClaimIdempotencyKey(ctxTomWang, idempotencyKey, false)
+			},
+		},
+		{
+			desc: "key completed",
+			input: func(c Client) (*dto.IdempotentResponse, error) {
+				if err := c.CompleteIdempotencyKey(ctxBoxer, idempotencyKey, created, false); err != nil {
+					return nil, err
+				}
+				return c.ClaimIdempotencyKey(ctxBoxer, idempotencyKey, false)
+			},
+			expected: &created,
+		},
+		{
+			desc: "key released",
+			input: func(c Client) (*dto.IdempotentResponse, error) {
+				if err := c.ReleaseIdempotencyKey(ctxBoxerOtherCaller, idempotencyKey); err != nil {
+					return nil, err
+				}
+				return c.ClaimIdempotencyKey(ctxBoxerOtherCaller, idempotencyKey, false)
+			},
+		},
+		{
+			desc: "key without tenant",
+			input: func(c Client) (*dto.IdempotentResponse, error) {
+				return c.ClaimIdempotencyKey(context.Background(), idempotencyKey, false)
+			},
+			code: -1,
+		},
+	}
+
+	for _, testClient := range newTestClients(t) {
+		for i, d := range data {
+			result, err := d.input(testClient)
+			if ok := checkClientErr(err, d.code); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.code,
+					Result:     err,
+				}))
+			}
+			if !reflect.DeepEqual(result, d.expected) {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "result",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     result,
+				}))
+			}
+		}
+	}
+}
+
+func Test_InMemoryClient_ClaimIdempotencyKey_pendingTtl(t *testing.T) {
+	ctxBoxer := actor.WithActor(tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId), "tom@example.com")
+	c := NewInMemoryClient(context.Background(), Config{IdempotencyKeyPendingTtl: time.Millisecond, IdempotencyKeyTtl: time.Hour})
+
+	idempotencyKey := dto.IdempotencyKey{Key: "key", RequestHash: "hash"}
+	created := dto.IdempotentResponse{Location: "car-id", StatusCode: http.StatusCreated}
+
+	var data = []struct {
+		desc     string
+		input    func() (*dto.IdempotentResponse, error)
+		expected *dto.IdempotentResponse
+	}{
+		{
+			desc: "key not used",
+			input: func() (*dto.IdempotentResponse, error) {
+				return c.ClaimIdempotencyKey(ctxBoxer, idempotencyKey, false)
+			},
+		},
+		{
+			desc: "key left pending past its pending ttl",
+			input: func() (*dto.IdempotentResponse, error) {
+				time.Sleep(10 * time.Millisecond)
+				return c.ClaimIdempotencyKey(ctxBoxer, idempotencyKey, false)
+			},
+		},
+		{
+			desc: "key completed past its pending ttl",
+			input: func() (*dto.IdempotentResponse, error) {
+				if err := c.CompleteIdempotencyKey(ctxBoxer, idempotencyKey, created, false); err != nil {
+					return nil, err
+				}
+				time.Sleep(10 * time.Millisecond)
+				return c.ClaimIdempotencyKey(ctxBoxer, idempotencyKey, false)
+			},
+			expected: &created,
+		},
+	}
+
+	for i, d := range data {
+		result, err := d.input()
+		if err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Result:     err,
+			}))
+		}
+		if !reflect.DeepEqual(result, d.expected) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_Client_BatchCars(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+
+	corolla := "Corolla"
+	newCarsBatch := func(operations ...dto.CarsBatchOperation) dto.CarsBatch {
+		return dto.CarsBatch{Mode: dto.CarsBatchModeAllOrNothing, Operations: operations}
+	}
+	newCarCreates := func(n int) []dto.CarsBatchOperation {
+		operations := make([]dto.CarsBatchOperation, n)
+		for i := range operations {
+			operations[i] = dto.CarsBatchOperation{CarCreate: &dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Honda", ModelName: fmt.Sprintf("Model %d", i)}}}
+		}
+		return operations
+	}
+
+	for _, testClient := range newTestClients(t) {
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var data = []struct {
+			desc     string
+			input    dto.CarsBatch
+			expected int
+		}{
+			{
+				desc: "creates with the same brand and model name",
+				input: newCarsBatch(
+					dto.CarsBatchOperation{CarCreate: &dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Yaris"}}},
+					dto.CarsBatchOperation{CarCreate: &dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Yaris"}}},
+				),
+				expected: http.StatusConflict,
+			},
+			{
+				desc: "update of a car deleted earlier in the batch",
+				input: newCarsBatch(
+					dto.CarsBatchOperation{CarDelete: &dto.CarDelete{Id: carId}},
+					dto.CarsBatchOperation{CarUpdate: &dto.CarUpdate{Id: carId, UserInput: dto.CarUpdateUserInput{ModelName: &corolla}}},
+				),
+				expected: http.StatusConflict,
+			},
+			{
+				desc: "delete of a car deleted earlier in the batch",
+				input: newCarsBatch(
+					dto.CarsBatchOperation{CarDelete: &dto.CarDelete{Id: carId}},
+					dto.CarsBatchOperation{CarDelete: &dto.CarDelete{Id: carId}},
+				),
+				expected: http.StatusConflict,
+			},
+			{
+				// The emulator enforces the mutations a Spanner commit allows, so the limit is checked against it when it runs
+				desc:  "creates at the limit of operations",
+				input: newCarsBatch(newCarCreates(dto.CarsBatchMaxOperations)...),
+			},
+		}
+
+		for i, d := range data {
+			results, err := testClient.BatchCars(ctxBoxer, d.input)
+			if ok := checkClientErr(err, d.expected); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     err,
+				}))
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			if len(results) != len(d.input.Operations) {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "len(results)",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   len(d.input.Operations),
+					Result:     len(results),
+				}))
+			}
+		}
+
+		// Nothing is committed by a batch that is aborted
+		if _, err := testClient.ReadCar(ctxBoxer, dto.CarRead{Id: carId}); err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       testClient.desc("car deleted by an aborted batch"),
+				Result:     err,
+			}))
+		}
+	}
+}
+
+func Test_Client_BatchCars_bestEffort(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	camry := "Camry"
+
+	for _, testClient := range newTestClients(t) {
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := testClient.BatchCars(ctxBoxer, dto.CarsBatch{Mode: dto.CarsBatchModeBestEffort, Operations: []dto.CarsBatchOperation{
+			{CarCreate: &dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Yaris"}}},
+			{CarCreate: &dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}}},
+			{CarUpdate: &dto.CarUpdate{Id: carId, UserInput: dto.CarUpdateUserInput{ModelName: &camry}}},
+			{CarDelete: &dto.CarDelete{Id: "car-id"}},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A failed operation does not abort the operations after it
+		expected := []int{http.StatusCreated, http.StatusConflict, http.StatusNoContent, http.StatusNotFound}
+		if len(results) != len(expected) {
+			t.Fatal(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "len(results)",
+				Desc:       testClient.desc("results"),
+				Expected:   len(expected),
+				Result:     len(results),
+			}))
+		}
+		for i, v := range results {
+			if v.Index != i || v.Status != expected[i] {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "result",
+					Desc:       testClient.desc("results"),
+					At:         i,
+					Expected:   expected[i],
+					Result:     v,
+				}))
+			}
+		}
+		if _, err := testClient.ReadCar(ctxBoxer, dto.CarRead{Id: results[0].CarId}); err != nil {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       testClient.desc("car created by batch"),
+				Result:     err,
+			}))
+		}
+		car, err := testClient.ReadCar(ctxBoxer, dto.CarRead{Id: carId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if car.ModelName.StringVal != camry {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "car.ModelName",
+				Desc:       testClient.desc("car updated by batch"),
+				Expected:   camry,
+				Result:     car.ModelName,
+			}))
+		}
+	}
+}
+
+func Test_Client_UpdateOutboxEventsPublished(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	camry := "Camry"
+
+	for _, testClient := range newTestClients(t) {
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.UpdateCar(ctxBoxer, dto.CarUpdate{Id: carId, UserInput: dto.CarUpdateUserInput{ModelName: &camry}}); err != nil {
+			t.Fatal(err)
+		}
+
+		// The events are read oldest first and a page of them is published at a time
+		outboxEvents, err := testClient.ReadOutboxEventsUnpublished(ctxBoxer, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outboxEvents) != 1 || outboxEvents[0].AggregateId != carId || outboxEvents[0].EventType != dto.EventTypeCarCreated {
+			t.Fatal(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "outboxEvents",
+				Desc:       testClient.desc("first page of unpublished events"),
+				Expected:   dto.EventTypeCarCreated,
+				Result:     outboxEvents,
+			}))
+		}
+		if err := testClient.UpdateOutboxEventsPublished(ctxBoxer, []string{outboxEvents[0].OutboxEventId}); err != nil {
+			t.Fatal(err)
+		}
+
+		var eventTypes []string
+		for i := 0; i < 2; i++ {
+			outboxEvents, err = testClient.ReadOutboxEventsUnpublished(ctxBoxer, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var outboxEventIds []string
+			for _, v := range outboxEvents {
+				eventTypes = append(eventTypes, v.EventType)
+				outboxEventIds = append(outboxEventIds, v.OutboxEventId)
+			}
+			if err := testClient.UpdateOutboxEventsPublished(ctxBoxer, outboxEventIds); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(eventTypes, []string{dto.EventTypeCarUpdated}) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "eventTypes",
+				Desc:       testClient.desc("unpublished events"),
+				Expected:   []string{dto.EventTypeCarUpdated},
+				Result:     eventTypes,
+			}))
+		}
+	}
+}
+
+func Test_Client_WebhookSubscriptions(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+	newWebhookSubscriptionCreate := func(test bool) dto.WebhookSubscriptionCreate {
+		return dto.WebhookSubscriptionCreate{UserInput: dto.WebhookSubscriptionCreateUserInput{EventTypes: []string{dto.EventTypeCarCreated}, Secret: "secret", Url: "https://example.com/webhook"}, Test: test}
+	}
+
+	for _, testClient := range newTestClients(t) {
+		webhookSubscriptionId, err := testClient.CreateWebhookSubscription(ctxBoxer, newWebhookSubscriptionCreate(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := testClient.CreateWebhookSubscription(ctxBoxer, newWebhookSubscriptionCreate(true)); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, d := range []struct {
+			desc     string
+			ctx      context.Context
+			expected int64
+		}{
+			{desc: "subscriptions of tenant", ctx: ctxBoxer, expected: 1},
+			{desc: "subscriptions of another tenant", ctx: ctxTomWang},
+		} {
+			webhookSubscriptions, pagination, err := testClient.SearchWebhookSubscriptions(d.ctx, dto.WebhookSubscriptionsSearch{Pagination: lib_pagination.Pagination{Limit: 10, Order: "ASC"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(webhookSubscriptions)) != d.expected || pagination.Total == nil || *pagination.Total != d.expected {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "webhookSubscriptions",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     webhookSubscriptions,
+				}))
+			}
+		}
+
+		var data = []struct {
+			desc     string
+			ctx      context.Context
+			input    dto.WebhookSubscriptionDelete
+			expected int
+		}{
+			{
+				desc:     "subscription of another tenant",
+				ctx:      ctxTomWang,
+				input:    dto.WebhookSubscriptionDelete{Id: webhookSubscriptionId},
+				expected: http.StatusNotFound,
+			},
+			{
+				desc:     "subscription with test",
+				ctx:      ctxBoxer,
+				input:    dto.WebhookSubscriptionDelete{Id: webhookSubscriptionId, Test: true},
+				expected: http.StatusUnprocessableEntity,
+			},
+			{
+				desc:  "subscription of tenant",
+				ctx:   ctxBoxer,
+				input: dto.WebhookSubscriptionDelete{Id: webhookSubscriptionId},
+			},
+			{
+				desc:     "deleted subscription",
+				ctx:      ctxBoxer,
+				input:    dto.WebhookSubscriptionDelete{Id: webhookSubscriptionId},
+				expected: http.StatusNotFound,
+			},
+		}
+
+		for i, d := range data {
+			err := testClient.DeleteWebhookSubscription(d.ctx, d.input)
+			if ok := checkClientErr(err, d.expected); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     err,
+				}))
+			}
+		}
+
+		// The subscriptions read for delivery are those of all tenants
+		webhookSubscriptions, err := testClient.ReadWebhookSubscriptions(ctxBoxer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(webhookSubscriptions) != 1 || !webhookSubscriptions[0].Test {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "webhookSubscriptions",
+				Desc:       testClient.desc("subscriptions read for delivery"),
+				Expected:   "test subscription",
+				Result:     webhookSubscriptions,
+			}))
+		}
+	}
+}
+
+func Test_Client_WebhookDeliveries(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	deadLetter := dto.WebhookDeliveryStatusDeadLetter
+
+	for _, testClient := range newTestClients(t) {
+		webhookSubscriptionId, err := testClient.CreateWebhookSubscription(ctxBoxer, dto.WebhookSubscriptionCreate{UserInput: dto.WebhookSubscriptionCreateUserInput{EventTypes: []string{dto.EventTypeCarCreated}, Secret: "secret", Url: "https://example.com/webhook"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		webhookSubscriptions, err := testClient.ReadWebhookSubscriptions(ctxBoxer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Only the event of the tenant, of the test flag and of the event type subscribed to is delivered
+		events := []dto.Event{
+			{AggregateId: "car-id", DateCreated: time.Now().UTC(), EventId: "event-id", EventType: dto.EventTypeCarCreated, TenantId: lib_brand.BoxerId},
+			{AggregateId: "car-id", DateCreated: time.Now().UTC(), EventId: "event-id-updated", EventType: dto.EventTypeCarUpdated, TenantId: lib_brand.BoxerId},
+			{AggregateId: "car-id", DateCreated: time.Now().UTC(), EventId: "event-id-test", EventType: dto.EventTypeCarCreated, TenantId: lib_brand.BoxerId, Test: true},
+			{AggregateId: "car-id", DateCreated: time.Now().UTC(), EventId: "event-id-tom-wang", EventType: dto.EventTypeCarCreated, TenantId: lib_brand.TomWangId},
+		}
+		for i, expected := range []int{1, 0} {
+			count, err := testClient.CreateWebhookDeliveries(ctxBoxer, events, webhookSubscriptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// An event published again is not delivered again
+			if count != expected {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "count",
+					Desc:       testClient.desc("deliveries created"),
+					At:         i,
+					Expected:   expected,
+					Result:     count,
+				}))
+			}
+		}
+
+		webhookDeliveriesDue, err := testClient.ReadWebhookDeliveriesDue(ctxBoxer, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(webhookDeliveriesDue) != 1 || webhookDeliveriesDue[0].EventId != "event-id" || webhookDeliveriesDue[0].Secret != "secret" || webhookDeliveriesDue[0].Url != "https://example.com/webhook" {
+			t.Fatal(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "webhookDeliveriesDue",
+				Desc:       testClient.desc("deliveries due"),
+				Expected:   "event-id",
+				Result:     webhookDeliveriesDue,
+			}))
+		}
+		webhookDeliveryId := webhookDeliveriesDue[0].WebhookDeliveryId
+
+		responseStatusCode := http.StatusGone
+		if err := testClient.UpdateWebhookDeliveryAttempted(ctxBoxer, webhookDeliveriesDue[0].WebhookDelivery, dto.WebhookDeliveryAttempt{ResponseStatusCode: &responseStatusCode, Status: dto.WebhookDeliveryStatusDeadLetter}); err != nil {
+			t.Fatal(err)
+		}
+
+		webhookDeliveries, _, err := testClient.SearchWebhookDeliveries(ctxBoxer, dto.WebhookDeliveriesSearch{Pagination: lib_pagination.Pagination{Limit: 10, Order: "ASC"}, Status: &deadLetter, WebhookSubscriptionId: webhookSubscriptionId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(webhookDeliveries) != 1 || webhookDeliveries[0].Attempts != 1 || webhookDeliveries[0].LastResponseStatusCode.Int64 != int64(responseStatusCode) || webhookDeliveries[0].DateNextAttempt.Valid {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "webhookDeliveries",
+				Desc:       testClient.desc("dead letter deliveries"),
+				Expected:   webhookDeliveryId,
+				Result:     webhookDeliveries,
+			}))
+		}
+
+		var data = []struct {
+			desc     string
+			input    dto.WebhookDeliveryRedeliver
+			expected int
+		}{
+			{
+				desc:     "delivery of another subscription",
+				input:    dto.WebhookDeliveryRedeliver{Id: webhookDeliveryId, WebhookSubscriptionId: "webhook-subscription-id"},
+				expected: http.StatusNotFound,
+			},
+			{
+				desc:     "delivery not existing",
+				input:    dto.WebhookDeliveryRedeliver{Id: "webhook-delivery-id", WebhookSubscriptionId: webhookSubscriptionId},
+				expected: http.StatusNotFound,
+			},
+			{
+				desc:  "delivery",
+				input: dto.WebhookDeliveryRedeliver{Id: webhookDeliveryId, WebhookSubscriptionId: webhookSubscriptionId},
+			},
+		}
+
+		for i, d := range data {
+			err := testClient.RedeliverWebhookDelivery(ctxBoxer, d.input)
+			if ok := checkClientErr(err, d.expected); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     err,
+				}))
+			}
+		}
+
+		// A redelivered delivery is due again with its attempts reset
+		webhookDeliveriesDue, err = testClient.ReadWebhookDeliveriesDue(ctxBoxer, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(webhookDeliveriesDue) != 1 || webhookDeliveriesDue[0].WebhookDeliveryId != webhookDeliveryId || webhookDeliveriesDue[0].Attempts != 0 {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "webhookDeliveriesDue",
+				Desc:       testClient.desc("redelivered delivery"),
+				Expected:   webhookDeliveryId,
+				Result:     webhookDeliveriesDue,
+			}))
+		}
+	}
+}
+
+func Test_Client_ImportCars(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+
+	var data = []struct {
+		desc     string
+		input    dto.CarsImportCar
+		expected int
+	}{
+		{
+			desc:     "car with the brand and model name of an existing car",
+			input:    dto.CarsImportCar{CarCreate: dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}}, Number: 1},
+			expected: http.StatusConflict,
+		},
+		{
+			desc:     "car with the brand and model name of an existing car in another case",
+			input:    dto.CarsImportCar{CarCreate: dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "TOYOTA", ModelName: "Corolla"}}, Number: 2},
+			expected: http.StatusCreated,
+		},
+	}
+
+	for _, testClient := range newTestClients(t) {
+		if _, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, d := range data {
+			rows, err := testClient.ImportCars(ctxBoxer, []dto.CarsImportCar{d.input})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 || rows[0].Status != d.expected {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "rows",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     rows,
+				}))
+			}
+		}
+	}
+}
+
+func Test_Client_ReadCarsImportReport(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+
+	carsImportReport := dto.CarsImportReport{
+		Rows: []dto.CarsImportReportRow{
+			{CarId: "car-id", Number: 1, Status: http.StatusCreated},
+			{Errors: []lib_errors.Item{{Message: "Already exist"}}, Number: 2, Status: http.StatusConflict},
+			{CarId: "other-car-id", Number: 3, Status: http.StatusCreated},
+		},
+		RowsFailed:   1,
+		RowsImported: 2,
+		RowsTotal:    3,
+	}
+
+	for _, testClient := range newTestClients(t) {
+		carsImportId, err := testClient.CreateCarsImport(ctxBoxer, carsImportReport, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := carsImportReport
+		expected.CarsImportId = carsImportId
+
+		var data = []struct {
+			desc     string
+			ctx      context.Context
+			input    dto.CarsImportReportRead
+			expected *dto.CarsImportReport
+			code     int
+		}{
+			{
+				desc:     "report of tenant",
+				ctx:      ctxBoxer,
+				input:    dto.CarsImportReportRead{Id: carsImportId},
+				expected: &expected,
+			},
+			{
+				desc:  "report of another tenant",
+				ctx:   ctxTomWang,
+				input: dto.CarsImportReportRead{Id: carsImportId},
+				code:  http.StatusNotFound,
+			},
+			{
+				desc:  "report with test",
+				ctx:   ctxBoxer,
+				input: dto.CarsImportReportRead{Id: carsImportId, Test: true},
+				code:  http.StatusUnprocessableEntity,
+			},
+		}
+
+		for i, d := range data {
+			result, err := testClient.ReadCarsImportReport(d.ctx, d.input)
+			if ok := checkClientErr(err, d.code); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.code,
+					Result:     err,
+				}))
+			}
+			if !reflect.DeepEqual(result, d.expected) {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "result",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     result,
+				}))
+			}
+		}
+	}
+}
+
+func Test_Client_PurgeCars(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	ctxTomWang := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.TomWangId)
+
+	for _, testClient := range newTestClients(t) {
+		deletedCarId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.DeleteCar(ctxBoxer, dto.CarDelete{Id: deletedCarId}); err != nil {
+			t.Fatal(err)
+		}
+		deletedCarIdOtherTenant, err := testClient.CreateCar(ctxTomWang, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.DeleteCar(ctxTomWang, dto.CarDelete{Id: deletedCarIdOtherTenant}); err != nil {
+			t.Fatal(err)
+		}
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Yaris"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		putTestCarCustomerAssociation(t, testClient, "deleted-car-rental", deletedCarId, time.Now())
+		putTestCarCustomerAssociation(t, testClient, "car-rental", carId, time.Now())
+
+		// The purge is not run by a caller of a tenant, it purges the cars of every tenant
+		count, err := testClient.PurgeCars(context.Background(), time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 2 {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "count",
+				Desc:       testClient.desc("purged cars"),
+				Expected:   2,
+				Result:     count,
+			}))
+		}
+
+		type input struct {
+			table  string
+			column string
+			value  string
+		}
+		var data = []struct {
+			desc string
+			input
+			expected int
+		}{
+			{
+				desc:     "purged car",
+				input:    input{table: tableCar, column: "car_id", value: deletedCarId},
+				expected: 0,
+			},
+			{
+				desc:     "purged car of another tenant",
+				input:    input{table: tableCar, column: "car_id", value: deletedCarIdOtherTenant},
+				expected: 0,
+			},
+			{
+				desc:     "rentals of purged car",
+				input:    input{table: tableCarCustomerAssociation, column: "car_id", value: deletedCarId},
+				expected: 0,
+			},
+			{
+				desc:     "history of purged car",
+				input:    input{table: tableCarHistory, column: "car_id", value: deletedCarId},
+				expected: 0,
+			},
+			{
+				desc:     "outbox events of purged car",
+				input:    input{table: tableOutboxEvent, column: "aggregate_id", value: deletedCarId},
+				expected: 0,
+			},
+			{
+				desc:     "car",
+				input:    input{table: tableCar, column: "car_id", value: carId},
+				expected: 1,
+			},
+			{
+				desc:     "rentals of car",
+				input:    input{table: tableCarCustomerAssociation, column: "car_id", value: carId},
+				expected: 1,
+			},
+			{
+				desc:     "history of car",
+				input:    input{table: tableCarHistory, column: "car_id", value: carId},
+				expected: 1,
+			},
+			{
+				desc:     "outbox events of car",
+				input:    input{table: tableOutboxEvent, column: "aggregate_id", value: carId},
+				expected: 1,
+			},
+		}
+
+		for i, d := range data {
+			result := countTestRows(t, testClient, d.input.table, d.input.column, d.input.value)
+			if result != d.expected {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "result",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     result,
+				}))
+			}
+		}
+	}
+}
+
+func Test_Client_BlockCustomer(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+
+	for _, testClient := range newTestClients(t) {
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		putTestCarCustomerAssociation(t, testClient, "started-rental", carId, time.Now().Add(-time.Minute))
+		putTestCarCustomerAssociation(t, testClient, "future-rental", carId, time.Now().Add(time.Hour))
+
+		if err := testClient.BlockCustomer(context.Background(), dto.CustomerEvent{CustomerId: "customer-id", EventType: dto.EventTypeCustomerBlocked, PubsubMessageId: "pubsub-message-id"}); err != nil {
+			t.Fatal(err)
+		}
+
+		outboxEvents, err := testClient.ReadOutboxEventsUnpublished(context.Background(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []string
+		for _, v := range outboxEvents {
+			if v.EventType == dto.EventTypeRentalCancelled {
+				result = append(result, v.AggregateId)
+			}
+		}
+		expected := []string{"future-rental"}
+		if !reflect.DeepEqual(result, expected) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       testClient.desc("rental cancelled events"),
+				Expected:   expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_Client_CreateCarCustomerAssociation(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(rbac.WithTrusted(context.Background()), lib_brand.BoxerId)
+	dateRentalStart := time.Now().Add(time.Hour).UTC()
+
+	for _, testClient := range newTestClients(t) {
+		carId, err := testClient.CreateCar(ctxBoxer, dto.CarCreate{UserInput: dto.CarCreateUserInput{BrandName: "Toyota", ModelName: "Corolla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testClient.BlockCustomer(context.Background(), dto.CustomerEvent{CustomerId: "blocked-customer-id", EventType: dto.EventTypeCustomerBlocked, PubsubMessageId: "pubsub-message-id"}); err != nil {
+			t.Fatal(err)
+		}
+
+		var data = []struct {
+			desc       string
+			customerId string
+			expected   int
+		}{
+			{
+				desc:       "blocked customer",
+				customerId: "blocked-customer-id",
+				expected:   http.StatusConflict,
+			},
+			{
+				desc:       "customer",
+				customerId: "customer-id",
+				expected:   0,
+			},
+		}
+
+		var carCustomerAssociationIds []string
+		for i, d := range data {
+			carCustomerAssociationId, err := testClient.CreateCarCustomerAssociation(ctxBoxer, dto.CarCustomerAssociationCreate{
+				CarId: carId,
+				UserInput: dto.CarCustomerAssociationCreateUserInput{
+					CustomerId:      d.customerId,
+					DateRentalEnd:   dateRentalStart.Add(time.Hour),
+					DateRentalStart: dateRentalStart,
+				},
+			})
+			if ok := checkClientErr(err, d.expected); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected,
+					Result:     err,
+				}))
+			}
+			if carCustomerAssociationId != "" {
+				carCustomerAssociationIds = append(carCustomerAssociationIds, carCustomerAssociationId)
+			}
+		}
+
+		if result, expected := countTestCarCustomerAssociations(t, testClient, carId), 1; result != expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "count of car customer associations",
+				Desc:       testClient.desc("car customer associations"),
+				Expected:   expected,
+				Result:     result,
+			}))
+		}
+
+		// The event is committed with the rental, so there is none for the rental of the blocked customer
+		outboxEvents, err := testClient.ReadOutboxEventsUnpublished(context.Background(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []string
+		for _, v := range outboxEvents {
+			if v.EventType == dto.EventTypeRentalCreated {
+				result = append(result, v.AggregateId)
+			}
+		}
+		if !reflect.DeepEqual(result, carCustomerAssociationIds) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       testClient.desc("rental created events"),
+				Expected:   carCustomerAssociationIds,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_Client_ConsumeApiKeyQuota(t *testing.T) {
+	ctxBoxer := tenant.WithTenantId(context.Background(), lib_brand.BoxerId)
+	day := civil.DateOf(time.Now().UTC())
+
+	for _, testClient := range newTestClients(t) {
+		apiKeyId, err := testClient.CreateApiKey(ctxBoxer, dto.ApiKeyCreate{KeyHash: "key-hash", KeyPrefix: "key-prefix", UserInput: dto.ApiKeyCreateUserInput{DailyQuota: 2, DateExpires: time.Now().Add(time.Hour), Name: "partner"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := testClient.RotateApiKey(ctxBoxer, dto.ApiKeyRotate{Id: apiKeyId, KeyHash: "rotated-key-hash", KeyPrefix: "key-prefix", Overlap: time.Hour, UserInput: dto.ApiKeyRotateUserInput{DateExpires: time.Now().Add(time.Hour)}}); err != nil {
+			t.Fatal(err)
+		}
+		apiKey, err := testClient.ReadApiKeyByKeyHash(ctxBoxer, "key-hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rotatedApiKey, err := testClient.ReadApiKeyByKeyHash(ctxBoxer, "rotated-key-hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		type expected struct {
+			code int
+			used int64
+		}
+		var data = []struct {
+			desc   string
+			apiKey *ApiKey
+			day    civil.Date
+			expected
+		}{
+			{
+				desc:     "key",
+				apiKey:   apiKey,
+				day:      day,
+				expected: expected{used: 1},
+			},
+			{
+				desc:     "rotated key shares quota of key",
+				apiKey:   rotatedApiKey,
+				day:      day,
+				expected: expected{used: 2},
+			},
+			{
+				desc:     "quota exceeded",
+				apiKey:   apiKey,
+				day:      day,
+				expected: expected{code: http.StatusTooManyRequests},
+			},
+			{
+				desc:     "quota of next day",
+				apiKey:   rotatedApiKey,
+				day:      day.AddDays(1),
+				expected: expected{used: 1},
+			},
+		}
+
+		for i, d := range data {
+			used, err := testClient.ConsumeApiKeyQuota(ctxBoxer, d.apiKey.Lineage(), d.day, d.apiKey.DailyQuota)
+			if ok := checkClientErr(err, d.expected.code); !ok {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "err",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected.code,
+					Result:     err,
+				}))
+				continue
+			}
+			if used != d.expected.used {
+				t.Error(lib_testing.Errorf(lib_testing.Error{
+					Unexpected: "used",
+					Desc:       testClient.desc(d.desc),
+					At:         i,
+					Expected:   d.expected.used,
+					Result:     used,
+				}))
+			}
+		}
+	}
+}
+
+// putTestCarCustomerAssociation seeds a rental of the car for an hour from the start, rentals that have already started cannot be created through the clients
+func putTestCarCustomerAssociation(t *testing.T, c testClient, id, carId string, dateRentalStart time.Time) {
+	dateRentalStart = dateRentalStart.UTC()
+	switch client := c.Client.(type) {
+	case *InMemoryClient:
+		client.PutCarCustomerAssociation(CarCustomerAssociation{CarId: carId, CustomerId: "customer-id", DateRentalEnd: dateRentalStart.Add(time.Hour), DateRentalStart: dateRentalStart, Id: id, TenantId: spanner.NullString{StringVal: lib_brand.BoxerId, Valid: true}})
+	case client:
+		if _, err := client.spannerClient.Apply(context.Background(), []*spanner.Mutation{spanner.Insert(tableCarCustomerAssociation, []string{"car_id", "customer_id", "date_created", "date_rental_end", "date_rental_start", "id", "tenant_id", "test"}, []interface{}{carId, "customer-id", spanner.CommitTimestamp, dateRentalStart.Add(time.Hour), dateRentalStart, id, lib_brand.BoxerId, false})}); err != nil {
+			t.Fatal(err)
+		}
+	case *PostgresClient:
+		if _, err := client.db.Exec(fmt.Sprintf("INSERT INTO %s (car_id, customer_id, date_created, date_rental_end, date_rental_start, id, tenant_id, test) VALUES ($1, $2, $3, $4, $5, $6, $7, false)", tableCarCustomerAssociation), carId, "customer-id", time.Now().UTC(), dateRentalStart.Add(time.Hour), dateRentalStart, id, lib_brand.BoxerId); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("Not recognized: c.Client = %T", c.Client)
+	}
+}
+
+func countTestCarCustomerAssociations(t *testing.T, c testClient, carId string) int {
+	return countTestRows(t, c, tableCarCustomerAssociation, "car_id", carId)
+}
+
+// countTestRows counts the rows of the table whose column has the value, the column of the in-memory client is that of the spanner client
+func countTestRows(t *testing.T, c testClient, table, column, value string) int {
+	var count int
+	switch client := c.Client.(type) {
+	case *InMemoryClient:
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		var values []string
+		switch table + "." + column {
+		// A purged car keeps its versions with a last version that has no car
+		case tableCar + ".car_id":
+			for k := range client.carVersionsById {
+				if client.carAsOf(k, nil) != nil {
+					values = append(values, k)
+				}
+			}
+		case tableCarCustomerAssociation + ".car_id":
+			for _, v := range client.carCustomerAssociations {
+				values = append(values, v.CarId)
+			}
+		case tableCarHistory + ".car_id":
+			for _, v := range client.carHistoryById {
+				values = append(values, v.CarId)
+			}
+		case tableOutboxEvent + ".aggregate_id":
+			for _, v := range client.outboxEventById {
+				values = append(values, v.AggregateId)
+			}
+		default:
+			t.Fatalf("Not recognized: %s.%s", table, column)
+		}
+		for _, v := range values {
+			if v == value {
+				count++
+			}
+		}
+	case client:
+		iter := client.spannerClient.Single().Query(context.Background(), spanner.Statement{SQL: fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = @value", table, column), Params: map[string]interface{}{"value": value}})
+		defer iter.Stop()
+		row, err := iter.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v int64
+		if err := row.Column(0, &v); err != nil {
+			t.Fatal(err)
+		}
+		count = int(v)
+	case *PostgresClient:
+		if err := client.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = $1", table, column), value).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("Not recognized: c.Client = %T", c.Client)
+	}
+	return count
+}
+
+// checkClientErr reports whether the error is the custom error with the code, a code of 0 expects no error and a code of -1 expects an error that is not custom
+func checkClientErr(err error, code int) bool {
+	switch code {
+	case 0:
+		return err == nil
+	case -1:
+		return err != nil && !lib_errors.IsCustom(err)
+	}
+	return lib_errors.IsCustomWithCode(err, code)
+}
+
+// testClient is an implementation of Client that the behavioural tests run against
+type testClient struct {
+	Client
+	name string
+}
+
+func (c testClient) desc(desc string) string {
+	return fmt.Sprintf("%s: %s", c.name, desc)
+}
+
+// testConfig keeps idempotency keys for longer than a test runs
+var testConfig = Config{IdempotencyKeyTtl: time.Hour}
+
+// testTables are emptied before each test that runs against a database
+var testTables = []string{tableApiKey, tableApiKeyQuotaUsage, tableCar, tableCarCustomerAssociation, tableCarHistory, tableCarsImport, tableCarsImportReportRow, tableCustomer, tableCustomerBlock, tableIdempotencyKey, tableOutboxEvent, tablePubsubMessage, tableWebhookDelivery, tableWebhookSubscription}
+
+// newTestClients returns an empty in-memory client, an empty PostgreSQL client when POSTGRES_TEST_DATA_SOURCE_NAME is set and an empty Spanner client when SPANNER_EMULATOR_HOST is set, so that the same tests hold for all of them
+func newTestClients(t *testing.T) []testClient {
+	testClients := []testClient{{Client: NewInMemoryClient(context.Background(), testConfig), name: "in memory"}}
+
+	if dataSourceName := os.Getenv("POSTGRES_TEST_DATA_SOURCE_NAME"); dataSourceName != "" {
+		c, err := NewPostgresClient(context.Background(), Config{IdempotencyKeyTtl: testConfig.IdempotencyKeyTtl, PostgresDataSourceName: dataSourceName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(c.Close)
+		if _, err := c.db.Exec(fmt.Sprintf("TRUNCATE %s", strings.Join(testTables, ", "))); err != nil {
+			t.Fatal(err)
+		}
+		testClients = append(testClients, testClient{Client: c, name: "postgres"})
+	}
+
+	// The spanner client connects to the emulator at SPANNER_EMULATOR_HOST by itself, the database is created and migrated as in scripts/spanner/README.md
+	if os.Getenv("SPANNER_EMULATOR_HOST") != "" {
+		c, err := NewClient(context.Background(), Config{DatabaseId: testSpannerDatabaseId, IdempotencyKeyTtl: testConfig.IdempotencyKeyTtl, InstanceId: testSpannerInstanceId, ProjectId: testSpannerProjectId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(c.Close)
+		var mutations []*spanner.Mutation
+		for _, table := range testTables {
+			mutations = append(mutations, spanner.Delete(table, spanner.AllKeys()))
+		}
+		if _, err := c.(client).spannerClient.Apply(context.Background(), mutations); err != nil {
+			t.Fatal(err)
+		}
+		testClients = append(testClients, testClient{Client: c, name: "spanner"})
+	}
+	return testClients
+}
+
+const (
+	testSpannerDatabaseId = "car-svc-test"
+	testSpannerInstanceId = "test-instance"
+	testSpannerProjectId  = "test-project"
+)
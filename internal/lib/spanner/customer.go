@@ -1 +1,236 @@
 package spanner
+
+import (
+	"car-svc/internal/lib/dto"
+	"car-svc/internal/lib/rbac"
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_misc "github.com/tomwangsvc/lib-svc/misc"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+	"google.golang.org/api/iterator"
+)
+
+// Customer holds sensitive fields, it is formatted for logs with the sensitive fields redacted
+type Customer struct {
+	Age         int64              `json:"age" spanner:"age"`
+	CustomerId  string             `json:"customer_id" spanner:"customer_id"`
+	DateCreated time.Time          `json:"date_created" spanner:"date_created"`
+	DateUpdated spanner.NullTime   `json:"date_updated" spanner:"date_updated"`
+	Ethnicity   string             `json:"ethnicity" spanner:"ethnicity"`
+	Gender      string             `json:"gender" spanner:"gender"`
+	Name        string             `json:"name" spanner:"name"`
+	PhoneNumber spanner.NullString `json:"phone_number" spanner:"phone_number"`
+	TenantId    spanner.NullString `json:"-" spanner:"tenant_id"`
+	Test        bool               `json:"test" spanner:"test"`
+}
+
+// Fmt implements lib_log.Formatter so that lib_log.FmtAny never prints the sensitive fields of a customer
+func (c Customer) Fmt(m lib_log.Marshal) ([]byte, error) {
+	b, err := m(c)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed marshalling customer")
+	}
+	return lib_json.ApplyRedactions(b, rbac.LogRedactions(rbac.ResourceCustomer))
+}
+
+type CustomerBlock struct {
+	CustomerId  string    `spanner:"customer_id"`
+	DateCreated time.Time `spanner:"date_created"`
+	EventType   string    `spanner:"event_type"`
+	Test        bool      `spanner:"test"`
+}
+
+type PubsubMessage struct {
+	DateCreated     time.Time `spanner:"date_created"`
+	PubsubMessageId string    `spanner:"pubsub_message_id"`
+	Test            bool      `spanner:"test"`
+}
+
+const (
+	tableCustomer      = "customer"
+	tableCustomerBlock = "customer_block"
+	tablePubsubMessage = "pubsub_message"
+)
+
+var (
+	CustomerColumns       = lib_misc.StructTaggedFieldNames(reflect.TypeOf(Customer{}), "spanner")
+	CustomerFieldMetaData = lib_json.StructFieldMetadata(reflect.TypeOf(Customer{}))
+
+	CustomerBlockColumns = lib_misc.StructTaggedFieldNames(reflect.TypeOf(CustomerBlock{}), "spanner")
+	PubsubMessageColumns = lib_misc.StructTaggedFieldNames(reflect.TypeOf(PubsubMessage{}), "spanner")
+)
+
+func (c client) ReadCustomer(ctx context.Context, customerRead dto.CustomerRead) (*Customer, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("customerRead", customerRead))
+
+	var customer Customer
+	if err := readByIdForTenant(ctx, c.spannerClient.Single(), tableCustomer, CustomerColumns, customerRead.Id, &customer); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading customer")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtAny("customer", customer))
+	return &customer, nil
+}
+
+// TransformCustomerToJson generates the response for the customer and applies the redactions of the fields the caller is not permitted to read
+func (c client) TransformCustomerToJson(ctx context.Context, customer Customer, redactions map[string]lib_json.Redaction) ([]byte, error) {
+	lib_log.Info(ctx, "Transforming", lib_log.FmtAny("customer", customer), lib_log.FmtInt("len(redactions)", len(redactions)))
+
+	cu, err := lib_json.GenerateJson(customer, CustomerFieldMetaData, "")
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed generating response")
+	}
+	cu, err = lib_json.ApplyRedactions(cu, redactions)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed applying redactions")
+	}
+
+	lib_log.Info(ctx, "Transformed", lib_log.FmtInt("len(cu)", len(cu)))
+	return cu, nil
+}
+
+// BlockCustomer cancels the rentals of the customer that have not started and blocks new ones, the pubsub message is recorded in the same transaction so that a redelivery has no effect.
+// A rental.cancelled event is recorded in the outbox for each cancelled rental so that the cancellations are published like the changes to cars
+func (c client) BlockCustomer(ctx context.Context, customerEvent dto.CustomerEvent) error {
+	lib_log.Info(ctx, "Blocking", lib_log.FmtAny("customerEvent", customerEvent))
+
+	var countCancelled int
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		countCancelled = 0
+
+		consumed, err := readPubsubMessageConsumed(ctx, txn, customerEvent.PubsubMessageId)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading pubsub message consumed")
+		}
+		if consumed {
+			lib_log.Info(ctx, "Pubsub message already consumed", lib_log.FmtString("customerEvent.PubsubMessageId", customerEvent.PubsubMessageId))
+			return nil
+		}
+
+		carCustomerAssociations, err := readCarCustomerAssociationsNotStarted(ctx, txn, customerEvent.CustomerId)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading car customer associations not started")
+		}
+
+		var mutations []*spanner.Mutation
+		for _, v := range carCustomerAssociations {
+			outboxEvent, err := newRentalCancelledOutboxEvent(ctx, v)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed creating rental cancelled outbox event")
+			}
+			mutOutboxEvent, err := spanner.InsertStruct(tableOutboxEvent, outboxEvent)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed creating mutOutboxEvent for outbox event")
+			}
+			mutations = append(mutations, spanner.UpdateMap(tableCarCustomerAssociation, map[string]interface{}{
+				"date_cancelled": spanner.CommitTimestamp,
+				"date_updated":   spanner.CommitTimestamp,
+				"id":             v.Id,
+			}), mutOutboxEvent)
+		}
+
+		mutCustomerBlock, err := spanner.InsertOrUpdateStruct(tableCustomerBlock, CustomerBlock{
+			CustomerId:  customerEvent.CustomerId,
+			DateCreated: spanner.CommitTimestamp,
+			EventType:   customerEvent.EventType,
+			Test:        customerEvent.Test,
+		})
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating mutCustomerBlock for customer block")
+		}
+
+		mutPubsubMessage, err := spanner.InsertStruct(tablePubsubMessage, PubsubMessage{
+			DateCreated:     spanner.CommitTimestamp,
+			PubsubMessageId: customerEvent.PubsubMessageId,
+			Test:            customerEvent.Test,
+		})
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating mutPubsubMessage for pubsub message")
+		}
+
+		if err := txn.BufferWrite(append(mutations, mutCustomerBlock, mutPubsubMessage)); err != nil {
+			return lib_errors.Wrap(err, "Failed buffering mutations")
+		}
+		countCancelled = len(carCustomerAssociations)
+
+		return nil
+	}); err != nil {
+		return lib_spanner.WrapError(err, "Failed blocking customer")
+	}
+
+	lib_log.Info(ctx, "Blocked", lib_log.FmtInt("countCancelled", countCancelled))
+	return nil
+}
+
+func readPubsubMessageConsumed(ctx context.Context, reader lib_spanner.Reader, pubsubMessageId string) (bool, error) {
+	var pubsubMessage PubsubMessage
+	if err := lib_spanner.ReadById(ctx, reader, tablePubsubMessage, PubsubMessageColumns, pubsubMessageId, &pubsubMessage); err != nil {
+		if lib_errors.IsCustomWithCode(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, lib_errors.Wrap(err, "Failed reading pubsub message")
+	}
+	return true, nil
+}
+
+// readCustomerBlocked reads whether customer-svc has blocked or deleted the customer, a blocked customer cannot rent a car
+func readCustomerBlocked(ctx context.Context, reader lib_spanner.Reader, customerId string) (bool, error) {
+	var customerBlock CustomerBlock
+	if err := lib_spanner.ReadById(ctx, reader, tableCustomerBlock, CustomerBlockColumns, customerId, &customerBlock); err != nil {
+		if lib_errors.IsCustomWithCode(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, lib_errors.Wrap(err, "Failed reading customer block")
+	}
+	return true, nil
+}
+
+// readCarCustomerAssociationsNotStarted reads the columns of the rentals of the customer that have not started needed to cancel them, the column of the start of a rental is queried by name as the spanner tag of CarCustomerAssociation does not match it
+func readCarCustomerAssociationsNotStarted(ctx context.Context, txn *spanner.ReadWriteTransaction, customerId string) ([]CarCustomerAssociation, error) {
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT car_id, customer_id, id, tenant_id, test
+			FROM %s
+			WHERE customer_id = @customer_id
+			AND date_cancelled IS NULL
+			AND date_rental_start > CURRENT_TIMESTAMP()
+		`,
+			tableCarCustomerAssociation,
+		),
+		Params: map[string]interface{}{
+			"customer_id": customerId,
+		},
+	}
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := txn.Query(ctx, stmt)
+	defer iter.Stop()
+
+	var carCustomerAssociations []CarCustomerAssociation
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, lib_errors.Wrap(err, "Failed iterating car customer association")
+		}
+
+		var v CarCustomerAssociation
+		if err := row.Columns(&v.CarId, &v.CustomerId, &v.Id, &v.TenantId, &v.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car customer association")
+		}
+		carCustomerAssociations = append(carCustomerAssociations, v)
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carCustomerAssociations)", len(carCustomerAssociations)))
+	return carCustomerAssociations, nil
+}
@@ -0,0 +1,211 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/actor"
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_misc "github.com/tomwangsvc/lib-svc/misc"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+)
+
+// IdempotencyKey is keyed by the hash of the tenant, the caller and the key, so that a caller can neither replay nor block the requests of another caller that picked the same key
+type IdempotencyKey struct {
+	Caller             string             `spanner:"caller"`
+	DateCreated        time.Time          `spanner:"date_created"`
+	DateExpires        time.Time          `spanner:"date_expires"`
+	IdempotencyKey     string             `spanner:"idempotency_key"`
+	RequestHash        string             `spanner:"request_hash"`
+	ResponseBody       []byte             `spanner:"response_body"`
+	ResponseLocation   spanner.NullString `spanner:"response_location"`
+	ResponseStatusCode int64              `spanner:"response_status_code"`
+	TenantId           string             `spanner:"tenant_id"`
+	Test               bool               `spanner:"test"`
+}
+
+const (
+	// idempotencyKeyPendingStatusCode is stored against a key that has been claimed by a request that has not completed
+	idempotencyKeyPendingStatusCode = 0
+
+	tableIdempotencyKey = "idempotency_key"
+)
+
+var (
+	IdempotencyKeyColumns = lib_misc.StructTaggedFieldNames(reflect.TypeOf(IdempotencyKey{}), "spanner")
+
+	idempotencyKeyKeyColumns = []string{"idempotency_key"}
+)
+
+// newIdempotencyKeyId returns the primary key of the idempotency key of the caller, the key is hashed with the tenant and the caller as the table keeps the primary key it was created with
+func newIdempotencyKeyId(ctx context.Context, idempotencyKey dto.IdempotencyKey) (string, error) {
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+	return hashIdempotencyKey(tenantId, actor.Actor(ctx), idempotencyKey.Key), nil
+}
+
+func hashIdempotencyKey(tenantId, caller, key string) string {
+	hash := sha256.New()
+	for _, v := range []string{tenantId, caller, key} {
+		// The length prefixes the value so that the values cannot be shifted across their boundaries to hash the same
+		fmt.Fprintf(hash, "%d:%s", len(v), v)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// readIdempotentResponse returns the stored response for a retry of the same request, nil is returned when the key has not been used or has expired
+func readIdempotentResponse(ctx context.Context, reader lib_spanner.Reader, idempotencyKey dto.IdempotencyKey) (*dto.IdempotentResponse, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("idempotencyKey", idempotencyKey))
+
+	id, err := newIdempotencyKeyId(ctx, idempotencyKey)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating idempotency key id")
+	}
+
+	var storedIdempotencyKey IdempotencyKey
+	if err := lib_spanner.ReadByIds(ctx, reader, tableIdempotencyKey, IdempotencyKeyColumns, []string{id}, &storedIdempotencyKey); err != nil {
+		if lib_errors.IsCustomWithCode(err, http.StatusNotFound) {
+			lib_log.Info(ctx, "Read, idempotency key not used")
+			return nil, nil
+		}
+		return nil, lib_errors.Wrap(err, "Failed reading idempotency key")
+	}
+
+	idempotentResponse, err := newIdempotentResponse(ctx, storedIdempotencyKey, idempotencyKey)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating idempotent response")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtAny("idempotentResponse", idempotentResponse))
+	return idempotentResponse, nil
+}
+
+// newIdempotentResponse returns the response stored against the key for a retry of the same request, nil is returned when the key has expired and a conflict when the request that claimed the key has not completed
+func newIdempotentResponse(ctx context.Context, storedIdempotencyKey IdempotencyKey, idempotencyKey dto.IdempotencyKey) (*dto.IdempotentResponse, error) {
+	if time.Now().After(storedIdempotencyKey.DateExpires) {
+		lib_log.Info(ctx, "Idempotency key expired", lib_log.FmtTime("storedIdempotencyKey.DateExpires", storedIdempotencyKey.DateExpires))
+		return nil, nil
+	}
+
+	if storedIdempotencyKey.RequestHash != idempotencyKey.RequestHash {
+		return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityIdempotencyKeyReusedWithDifferentRequest)
+	}
+
+	if storedIdempotencyKey.ResponseStatusCode == idempotencyKeyPendingStatusCode {
+		return nil, lib_errors.NewCustom(http.StatusConflict, constants.ConflictIdempotencyKeyInProgress)
+	}
+
+	return &dto.IdempotentResponse{
+		Body:       storedIdempotencyKey.ResponseBody,
+		Location:   storedIdempotencyKey.ResponseLocation.StringVal,
+		StatusCode: int(storedIdempotencyKey.ResponseStatusCode),
+	}, nil
+}
+
+// newIdempotencyKeyMutation creates the mutation storing the response against the idempotency key, it must be buffered in the same transaction as the request it belongs to
+func newIdempotencyKeyMutation(ctx context.Context, idempotencyKey dto.IdempotencyKey, idempotentResponse dto.IdempotentResponse, ttl time.Duration, test bool) (*spanner.Mutation, error) {
+	storedIdempotencyKey, err := newIdempotencyKey(ctx, idempotencyKey, idempotentResponse, ttl, test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating idempotency key")
+	}
+	mutIdempotencyKey, err := spanner.InsertOrUpdateStruct(tableIdempotencyKey, storedIdempotencyKey)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating mutIdempotencyKey for idempotency key")
+	}
+	return mutIdempotencyKey, nil
+}
+
+func newIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, idempotentResponse dto.IdempotentResponse, ttl time.Duration, test bool) (*IdempotencyKey, error) {
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+	caller := actor.Actor(ctx)
+	return &IdempotencyKey{
+		Caller:             caller,
+		DateCreated:        spanner.CommitTimestamp,
+		DateExpires:        time.Now().UTC().Add(ttl),
+		IdempotencyKey:     hashIdempotencyKey(tenantId, caller, idempotencyKey.Key),
+		RequestHash:        idempotencyKey.RequestHash,
+		ResponseBody:       idempotentResponse.Body,
+		ResponseLocation:   spanner.NullString{StringVal: idempotentResponse.Location, Valid: idempotentResponse.Location != ""},
+		ResponseStatusCode: int64(idempotentResponse.StatusCode),
+		TenantId:           tenantId,
+		Test:               test,
+	}, nil
+}
+
+// ClaimIdempotencyKey returns the stored response for a retry of the same request, otherwise the key is stored as pending so that a concurrent retry is rejected until the key is completed, released or its pending ttl expires
+func (c client) ClaimIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, test bool) (*dto.IdempotentResponse, error) {
+	lib_log.Info(ctx, "Claiming", lib_log.FmtAny("idempotencyKey", idempotencyKey))
+
+	var idempotentResponse *dto.IdempotentResponse
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		var err error
+		idempotentResponse, err = readIdempotentResponse(ctx, tx, idempotencyKey)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading idempotent response")
+		}
+		if idempotentResponse != nil {
+			return nil
+		}
+
+		mutIdempotencyKey, err := newIdempotencyKeyMutation(ctx, idempotencyKey, dto.IdempotentResponse{StatusCode: idempotencyKeyPendingStatusCode}, c.config.idempotencyKeyPendingTtl(), test)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating idempotency key mutation")
+		}
+		if err := tx.BufferWrite([]*spanner.Mutation{mutIdempotencyKey}); err != nil {
+			return lib_errors.Wrap(err, "Failed claiming idempotency key")
+		}
+		return nil
+
+	}); err != nil {
+		return nil, lib_spanner.WrapError(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Claimed", lib_log.FmtAny("idempotentResponse", idempotentResponse))
+	return idempotentResponse, nil
+}
+
+// CompleteIdempotencyKey stores the response against a claimed key so that it is replayed for retries
+func (c client) CompleteIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, idempotentResponse dto.IdempotentResponse, test bool) error {
+	lib_log.Info(ctx, "Completing", lib_log.FmtAny("idempotencyKey", idempotencyKey), lib_log.FmtInt("idempotentResponse.StatusCode", idempotentResponse.StatusCode))
+
+	mutIdempotencyKey, err := newIdempotencyKeyMutation(ctx, idempotencyKey, idempotentResponse, c.config.IdempotencyKeyTtl, test)
+	if err != nil {
+		return lib_errors.Wrap(err, "Failed creating idempotency key mutation")
+	}
+	if _, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{mutIdempotencyKey}); err != nil {
+		return lib_spanner.WrapError(err, "Failed applying idempotency key mutation")
+	}
+
+	lib_log.Info(ctx, "Completed")
+	return nil
+}
+
+// ReleaseIdempotencyKey deletes a claimed key, so that a request that failed can be retried with the same key
+func (c client) ReleaseIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey) error {
+	lib_log.Info(ctx, "Releasing", lib_log.FmtAny("idempotencyKey", idempotencyKey))
+
+	id, err := newIdempotencyKeyId(ctx, idempotencyKey)
+	if err != nil {
+		return lib_errors.Wrap(err, "Failed creating idempotency key id")
+	}
+	if _, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{spanner.Delete(tableIdempotencyKey, spanner.Key{id})}); err != nil {
+		return lib_spanner.WrapError(err, "Failed applying idempotency key delete mutation")
+	}
+
+	lib_log.Info(ctx, "Released")
+	return nil
+}
@@ -0,0 +1,502 @@
+package spanner
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+	lib_search "github.com/tomwangsvc/lib-svc/search"
+	lib_strings "github.com/tomwangsvc/lib-svc/strings"
+)
+
+// InMemoryClient keeps the tables in memory, it is used for local runs and tests where there is no Spanner database.
+// A read write transaction holds the lock of the store and its writes are applied when it commits, so that as with Spanner the reads of a transaction do not see its own writes.
+type InMemoryClient struct {
+	config Config
+
+	mu                sync.Mutex
+	dateCommittedLast time.Time
+
+	apiKeyById               map[string]ApiKey
+	apiKeyQuotaUsageByIds    map[apiKeyQuotaUsageIds]ApiKeyQuotaUsage
+	carCustomerAssociations  []CarCustomerAssociation
+	carHistoryById           map[string]CarHistory
+	carVersionsById          map[string][]carVersion
+	carsImportById           map[string]CarsImport
+	carsImportReportRowsById map[string][]CarsImportReportRow
+	customerBlockById        map[string]CustomerBlock
+	customerById             map[string]Customer
+	idempotencyKeyByIds      map[string]IdempotencyKey
+	outboxEventById          map[string]OutboxEvent
+	pubsubMessageById        map[string]PubsubMessage
+	webhookDeliveryById      map[string]WebhookDelivery
+	webhookSubscriptionById  map[string]WebhookSubscription
+}
+
+// carVersion is the car committed at a timestamp, a purged car has a nil car. Versions are kept so that cars can be read as of a time
+type carVersion struct {
+	car           *Car
+	dateCommitted time.Time
+}
+
+// inMemoryWrite applies a write of a transaction at its commit timestamp
+type inMemoryWrite func(dateCommitted time.Time)
+
+func NewInMemoryClient(ctx context.Context, config Config) *InMemoryClient {
+	lib_log.Info(ctx, "Initializing", lib_log.FmtAny("config", config))
+	lib_log.Info(ctx, "Initialized")
+	return &InMemoryClient{
+		config:                   config,
+		apiKeyById:               make(map[string]ApiKey),
+		apiKeyQuotaUsageByIds:    make(map[apiKeyQuotaUsageIds]ApiKeyQuotaUsage),
+		carHistoryById:           make(map[string]CarHistory),
+		carVersionsById:          make(map[string][]carVersion),
+		carsImportById:           make(map[string]CarsImport),
+		carsImportReportRowsById: make(map[string][]CarsImportReportRow),
+		customerBlockById:        make(map[string]CustomerBlock),
+		customerById:             make(map[string]Customer),
+		idempotencyKeyByIds:      make(map[string]IdempotencyKey),
+		outboxEventById:          make(map[string]OutboxEvent),
+		pubsubMessageById:        make(map[string]PubsubMessage),
+		webhookDeliveryById:      make(map[string]WebhookDelivery),
+		webhookSubscriptionById:  make(map[string]WebhookSubscription),
+	}
+}
+
+func (c *InMemoryClient) Close() {}
+
+func (c *InMemoryClient) Ping(_ context.Context) error {
+	return nil
+}
+
+func (c *InMemoryClient) ReadFleetCounts(_ context.Context) (*FleetCounts, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var fleetCounts FleetCounts
+	for carId := range c.carVersionsById {
+		car := c.carAsOf(carId, nil)
+		switch {
+		case car == nil || car.Test:
+		case car.DateDeleted.Valid:
+			fleetCounts.CarsDeleted++
+		default:
+			fleetCounts.CarsActive++
+		}
+	}
+	now := time.Now()
+	for _, v := range c.carCustomerAssociations {
+		if !v.Test && !v.DateCancelled.Valid && !v.DateRentalStart.After(now) && v.DateRentalEnd.After(now) {
+			fleetCounts.RentalsActive++
+		}
+	}
+	return &fleetCounts, nil
+}
+
+// readWrite executes the transaction with the lock of the store held and commits its writes when it succeeds
+func (c *InMemoryClient) readWrite(transaction func() ([]inMemoryWrite, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writes, err := transaction()
+	if err != nil {
+		return err
+	}
+
+	dateCommitted := c.readTimestamp()
+	c.dateCommittedLast = dateCommitted
+	for _, write := range writes {
+		write(dateCommitted)
+	}
+	return nil
+}
+
+// readTimestamp returns the current time, it is after every commit so that commit timestamps increase strictly with the precision of Spanner
+func (c *InMemoryClient) readTimestamp() time.Time {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if !now.After(c.dateCommittedLast) {
+		return c.dateCommittedLast.Add(time.Microsecond)
+	}
+	return now
+}
+
+// withDateCommitted replaces the spanner.CommitTimestamp placeholders of the dates of a row with the commit timestamp
+func withDateCommitted(row interface{}, dateCommitted time.Time) {
+	v := reflect.ValueOf(row).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		switch field := v.Field(i).Addr().Interface().(type) {
+		case *time.Time:
+			if field.Equal(spanner.CommitTimestamp) {
+				*field = dateCommitted
+			}
+		case *spanner.NullTime:
+			if field.Valid && field.Time.Equal(spanner.CommitTimestamp) {
+				field.Time = dateCommitted
+			}
+		}
+	}
+}
+
+// inMemoryColumns returns the values of a row by column name, null values are nil as they are for comparisons in SQL
+func inMemoryColumns(row interface{}) map[string]interface{} {
+	v := reflect.ValueOf(row)
+	columns := make(map[string]interface{})
+	for i := 0; i < v.NumField(); i++ {
+		column := v.Type().Field(i).Tag.Get("spanner")
+		if column == "" {
+			continue
+		}
+		switch value := v.Field(i).Interface().(type) {
+		case spanner.NullBool:
+			columns[column] = nullable(value.Bool, value.Valid)
+		case spanner.NullFloat64:
+			columns[column] = nullable(value.Float64, value.Valid)
+		case spanner.NullInt64:
+			columns[column] = nullable(value.Int64, value.Valid)
+		case spanner.NullString:
+			columns[column] = nullable(value.StringVal, value.Valid)
+		case spanner.NullTime:
+			columns[column] = nullable(value.Time, value.Valid)
+		default:
+			columns[column] = value
+		}
+	}
+	return columns
+}
+
+func nullable(value interface{}, valid bool) interface{} {
+	if !valid {
+		return nil
+	}
+	return value
+}
+
+// inMemoryProject clears the fields of a row that are not in the columns, as a query only reads the columns it selects
+func inMemoryProject(row interface{}, columns []string) {
+	v := reflect.ValueOf(row).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if !lib_strings.Contains(columns, v.Type().Field(i).Tag.Get("spanner")) {
+			v.Field(i).Set(reflect.Zero(v.Field(i).Type()))
+		}
+	}
+}
+
+// matchLinkedFilters evaluates linked filters against the columns of a row as the where clause generated by lib_spanner.GenerateSqlWhereAndParamsForSearchWithInitialWhereV2 would, AND binds tighter than OR
+func matchLinkedFilters(columns map[string]interface{}, linkedFilters []lib_search.LinkedFilter) (bool, error) {
+	if len(linkedFilters) == 0 {
+		return true, nil
+	}
+
+	p := linkedFiltersParser{
+		columns:       columns,
+		linkedFilters: linkedFilters,
+	}
+	match, err := p.or()
+	if err != nil {
+		return false, lib_errors.Wrap(err, "Failed parsing linked filters")
+	}
+	if p.i < len(linkedFilters) {
+		return false, lib_errors.Errorf("Linked filter %d not expected", p.i)
+	}
+	return match, nil
+}
+
+type linkedFiltersParser struct {
+	columns       map[string]interface{}
+	i             int
+	linkedFilters []lib_search.LinkedFilter
+}
+
+func (p *linkedFiltersParser) or() (bool, error) {
+	match, err := p.and()
+	if err != nil {
+		return false, err
+	}
+	for p.next(lib_search.LinkedFilterTypeOr) {
+		m, err := p.and()
+		if err != nil {
+			return false, err
+		}
+		match = match || m
+	}
+	return match, nil
+}
+
+func (p *linkedFiltersParser) and() (bool, error) {
+	match, err := p.operand()
+	if err != nil {
+		return false, err
+	}
+	for p.next(lib_search.LinkedFilterTypeAnd) {
+		m, err := p.operand()
+		if err != nil {
+			return false, err
+		}
+		match = match && m
+	}
+	return match, nil
+}
+
+func (p *linkedFiltersParser) operand() (bool, error) {
+	if p.i >= len(p.linkedFilters) {
+		return false, lib_errors.New("Linked filters end before operand")
+	}
+
+	if p.next(lib_search.LinkedFilterTypeOpenBracket) {
+		match, err := p.or()
+		if err != nil {
+			return false, err
+		}
+		if !p.next(lib_search.LinkedFilterTypeCloseBracket) {
+			return false, lib_errors.Errorf("Linked filter %d not close bracket", p.i)
+		}
+		return match, nil
+	}
+
+	linkedFilter := p.linkedFilters[p.i]
+	if linkedFilter.Filter == nil || (linkedFilter.Type != nil && *linkedFilter.Type != lib_search.LinkedFilterTypeFilter) {
+		return false, lib_errors.Errorf("Linked filter %d not filter", p.i)
+	}
+	p.i++
+	return matchFilter(p.columns, *linkedFilter.Filter)
+}
+
+func (p *linkedFiltersParser) next(linkedFilterType string) bool {
+	if p.i < len(p.linkedFilters) && p.linkedFilters[p.i].Type != nil && *p.linkedFilters[p.i].Type == linkedFilterType {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// matchFilter evaluates a filter against the columns of a row, a comparison with a null value is not a match whatever the condition as in SQL
+//
+//revive:disable:cyclomatic
+func matchFilter(columns map[string]interface{}, filter lib_search.Filter) (bool, error) {
+	value, ok := columns[filter.Key]
+	if !ok {
+		return false, lib_errors.NewCustomf(http.StatusBadRequest, "Not recognized: filter = %s", filter.Key)
+	}
+
+	if filter.IsNull {
+		return (value == nil) != filter.NotCondition, nil
+	}
+	if value == nil {
+		return false, nil
+	}
+
+	switch {
+	case filter.ArrayContains:
+		return inMemoryContains(value, filter.Value) != filter.NotCondition, nil
+
+	case filter.InArray:
+		return inMemoryContains(filter.Value, value) != filter.NotCondition, nil
+
+	case filter.InRange:
+		bounds := reflect.ValueOf(filter.Value)
+		if bounds.Kind() != reflect.Slice || bounds.Len() != 2 {
+			return false, lib_errors.Errorf("Filter with key %q of type %T, expected slice of length 2 for range search", filter.Key, filter.Value)
+		}
+		start, err := inMemoryCompare(value, bounds.Index(0).Interface())
+		if err != nil {
+			return false, lib_errors.Wrap(err, "Failed comparing with start of range")
+		}
+		end, err := inMemoryCompare(value, bounds.Index(1).Interface())
+		if err != nil {
+			return false, lib_errors.Wrap(err, "Failed comparing with end of range")
+		}
+		if filter.NotCondition {
+			return start < 0 && end > 0, nil
+		}
+		return start >= 0 && end <= 0, nil
+
+	case filter.IsGreaterThan, filter.IsGreaterThanOrEqualTo, filter.IsLessThan, filter.IsLessThanOrEqualTo:
+		cmp, err := inMemoryCompare(value, filter.Value)
+		if err != nil {
+			return false, lib_errors.Wrap(err, "Failed comparing")
+		}
+		var match bool
+		switch {
+		case filter.IsGreaterThan:
+			match = cmp > 0
+		case filter.IsGreaterThanOrEqualTo:
+			match = cmp >= 0
+		case filter.IsLessThan:
+			match = cmp < 0
+		default:
+			match = cmp <= 0
+		}
+		return match != filter.NotCondition, nil
+	}
+
+	if filter.CaseInsensitiveString || filter.PartialMatchString {
+		s, ok := value.(string)
+		if !ok {
+			return false, lib_errors.Errorf("Column %q of type %T, expected string for string search", filter.Key, value)
+		}
+		filterValue, ok := filter.Value.(string)
+		if !ok {
+			return false, lib_errors.Errorf("Filter with key %q of type %T, expected string for string search", filter.Key, filter.Value)
+		}
+		if filter.CaseInsensitiveString {
+			s, filterValue = strings.ToUpper(s), strings.ToUpper(filterValue)
+		}
+		if filter.PartialMatchString {
+			return strings.Contains(s, filterValue) != filter.NotCondition, nil
+		}
+		return (s == filterValue) != filter.NotCondition, nil
+	}
+
+	cmp, err := inMemoryCompare(value, filter.Value)
+	if err != nil {
+		return false, lib_errors.Wrap(err, "Failed comparing")
+	}
+	return (cmp == 0) != filter.NotCondition, nil
+	//revive:enable:cyclomatic
+}
+
+// inMemoryContains reports whether the array contains the value
+func inMemoryContains(array, value interface{}) bool {
+	v := reflect.ValueOf(array)
+	if v.Kind() != reflect.Slice {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if cmp, err := inMemoryCompare(v.Index(i).Interface(), value); err == nil && cmp == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// inMemoryCompare orders two values of the same SQL type, integers and floats are compared as numbers
+func inMemoryCompare(a, b interface{}) (int, error) {
+	switch a := a.(type) {
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, nil
+			case b:
+				return -1, nil
+			}
+			return 1, nil
+		}
+
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			switch {
+			case a.Before(b):
+				return -1, nil
+			case a.After(b):
+				return 1, nil
+			}
+			return 0, nil
+		}
+
+	case int64, float64:
+		af, bf, ok := inMemoryFloat64(a), float64(0), false
+		switch b := b.(type) {
+		case int64:
+			bf, ok = float64(b), true
+		case float64:
+			bf, ok = b, true
+		}
+		if ok {
+			switch {
+			case af < bf:
+				return -1, nil
+			case af > bf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, lib_errors.Errorf("Cannot compare %T with %T", a, b)
+}
+
+func inMemoryFloat64(v interface{}) float64 {
+	if i, ok := v.(int64); ok {
+		return float64(i)
+	}
+	return v.(float64)
+}
+
+// lessByDateCreated orders rows by date created in the order of the pagination, rows created at the same time are ordered by id so that pages are stable
+func lessByDateCreated(dateCreatedI, dateCreatedJ time.Time, idI, idJ, order string) bool {
+	if dateCreatedI.Equal(dateCreatedJ) {
+		return idI < idJ
+	}
+	if strings.EqualFold(order, "ASC") {
+		return dateCreatedI.Before(dateCreatedJ)
+	}
+	return dateCreatedI.After(dateCreatedJ)
+}
+
+// paginate returns the bounds of the page of a result of the length, and the pagination with the total of the result
+func (c *InMemoryClient) paginate(length int, pagination lib_pagination.Pagination) (int, int, *lib_pagination.Pagination) {
+	total := int64(length)
+	readTimestamp := c.readTimestamp()
+	pagination.Total = &total
+	pagination.ReadTimestamp = &readTimestamp
+
+	start, end := pagination.Offset, pagination.Offset+pagination.Limit
+	if start > length {
+		start = length
+	}
+	if end > length {
+		end = length
+	}
+	return start, end, &pagination
+}
+
+// The transforms do not read the database, they are those of the spanner client
+
+func (c *InMemoryClient) TransformCarToJson(ctx context.Context, car Car, fields []string) ([]byte, error) {
+	return client{}.TransformCarToJson(ctx, car, fields)
+}
+
+func (c *InMemoryClient) TransformCarsToJson(ctx context.Context, cars []Car, fields []string) ([]byte, error) {
+	return client{}.TransformCarsToJson(ctx, cars, fields)
+}
+
+func (c *InMemoryClient) TransformCarHistoryToJson(ctx context.Context, carHistory []CarHistory) ([]byte, error) {
+	return client{}.TransformCarHistoryToJson(ctx, carHistory)
+}
+
+func (c *InMemoryClient) TransformCustomerToJson(ctx context.Context, customer Customer, redactions map[string]lib_json.Redaction) ([]byte, error) {
+	return client{}.TransformCustomerToJson(ctx, customer, redactions)
+}
+
+func (c *InMemoryClient) TransformWebhookSubscriptionsToJson(ctx context.Context, webhookSubscriptions []WebhookSubscription) ([]byte, error) {
+	return client{}.TransformWebhookSubscriptionsToJson(ctx, webhookSubscriptions)
+}
+
+func (c *InMemoryClient) TransformWebhookDeliveriesToJson(ctx context.Context, webhookDeliveries []WebhookDelivery) ([]byte, error) {
+	return client{}.TransformWebhookDeliveriesToJson(ctx, webhookDeliveries)
+}
+
+func (c *InMemoryClient) TransformApiKeysToJson(ctx context.Context, apiKeys []ApiKey) ([]byte, error) {
+	return client{}.TransformApiKeysToJson(ctx, apiKeys)
+}
+
+func (c *InMemoryClient) TransformBrandClassAssociationToJson(ctx context.Context, carCustomerAssociation CarCustomerAssociation) ([]byte, error) {
+	return client{}.TransformBrandClassAssociationToJson(ctx, carCustomerAssociation)
+}
+
+func (c *InMemoryClient) TransformBrandClassAssociationsToJson(ctx context.Context, carCustomerAssociations []CarCustomerAssociation) ([]byte, error) {
+	return client{}.TransformBrandClassAssociationsToJson(ctx, carCustomerAssociations)
+}
@@ -0,0 +1,235 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+func (c *InMemoryClient) CreateApiKey(ctx context.Context, apiKeyCreate dto.ApiKeyCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtString("apiKeyCreate.UserInput.Name", apiKeyCreate.UserInput.Name), lib_log.FmtString("apiKeyCreate.KeyPrefix", apiKeyCreate.KeyPrefix))
+
+	tenantId, err := newTenantId(ctx)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed getting new tenant id")
+	}
+
+	apiKeyId := uuid.New().String()
+	apiKey := ApiKey{
+		ApiKeyId:          apiKeyId,
+		Burst:             apiKeyCreate.UserInput.Burst,
+		DailyQuota:        apiKeyCreate.UserInput.DailyQuota,
+		DateCreated:       spanner.CommitTimestamp,
+		DateExpires:       apiKeyCreate.UserInput.DateExpires,
+		KeyHash:           apiKeyCreate.KeyHash,
+		KeyPrefix:         apiKeyCreate.KeyPrefix,
+		LineageApiKeyId:   spanner.NullString{StringVal: apiKeyId, Valid: true},
+		Name:              apiKeyCreate.UserInput.Name,
+		RequestsPerSecond: apiKeyCreate.UserInput.RequestsPerSecond,
+		Scopes:            apiKeyCreate.UserInput.Scopes,
+		TenantId:          tenantId,
+		Test:              apiKeyCreate.Test,
+	}
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		if err := c.checkApiKeyHashUnique(apiKey.KeyHash); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking api key hash unique")
+		}
+		return []inMemoryWrite{c.putApiKey(apiKey)}, nil
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("apiKeyId", apiKey.ApiKeyId))
+	return apiKey.ApiKeyId, nil
+}
+
+// checkApiKeyHashUnique enforces the unique index api_key_by_key_hash
+func (c *InMemoryClient) checkApiKeyHashUnique(keyHash string) error {
+	for _, v := range c.apiKeyById {
+		if v.KeyHash == keyHash {
+			return lib_errors.NewCustom(http.StatusConflict, "Already exist")
+		}
+	}
+	return nil
+}
+
+func (c *InMemoryClient) putApiKey(apiKey ApiKey) inMemoryWrite {
+	return func(dateCommitted time.Time) {
+		withDateCommitted(&apiKey, dateCommitted)
+		c.apiKeyById[apiKey.ApiKeyId] = apiKey
+	}
+}
+
+func (c *InMemoryClient) SearchApiKeys(ctx context.Context, apiKeysSearch dto.ApiKeysSearch) ([]ApiKey, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("apiKeysSearch", apiKeysSearch))
+
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var apiKeys []ApiKey
+	for _, v := range c.apiKeyById {
+		if v.Test == apiKeysSearch.Test && checkTenant(v, tenantId) == nil {
+			apiKeys = append(apiKeys, v)
+		}
+	}
+	sort.Slice(apiKeys, func(i, j int) bool {
+		return lessByDateCreated(apiKeys[i].DateCreated, apiKeys[j].DateCreated, apiKeys[i].ApiKeyId, apiKeys[j].ApiKeyId, apiKeysSearch.Pagination.Order)
+	})
+
+	start, end, pagination := c.paginate(len(apiKeys), apiKeysSearch.Pagination)
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(apiKeys)", end-start), lib_log.FmtAny("pagination", pagination))
+	return apiKeys[start:end], pagination, nil
+}
+
+// ReadApiKeyByKeyHash is not constrained to a tenant as the tenant of the request is the tenant of its key
+func (c *InMemoryClient) ReadApiKeyByKeyHash(ctx context.Context, keyHash string) (*ApiKey, error) {
+	lib_log.Info(ctx, "Reading")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, v := range c.apiKeyById {
+		if v.KeyHash == keyHash {
+			apiKey := v
+			lib_log.Info(ctx, "Read", lib_log.FmtString("apiKey.ApiKeyId", apiKey.ApiKeyId))
+			return &apiKey, nil
+		}
+	}
+	return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+}
+
+func (c *InMemoryClient) RotateApiKey(ctx context.Context, apiKeyRotate dto.ApiKeyRotate) (string, error) {
+	lib_log.Info(ctx, "Rotating", lib_log.FmtString("apiKeyRotate.Id", apiKeyRotate.Id), lib_log.FmtString("apiKeyRotate.KeyPrefix", apiKeyRotate.KeyPrefix), lib_log.FmtDuration("apiKeyRotate.Overlap", apiKeyRotate.Overlap))
+
+	apiKeyId := uuid.New().String()
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		apiKey, err := c.readApiKey(ctx, apiKeyRotate.Id, apiKeyRotate.Test)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading api key")
+		}
+		now := time.Now()
+		if !apiKey.Usable(now) {
+			return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityApiKeyRevokedOrExpired)
+		}
+
+		if err := c.checkApiKeyHashUnique(apiKeyRotate.KeyHash); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking api key hash unique")
+		}
+		writes := []inMemoryWrite{c.putApiKey(newRotatedApiKey(*apiKey, apiKeyId, apiKeyRotate))}
+
+		if dateOverlapEnd := now.Add(apiKeyRotate.Overlap); dateOverlapEnd.Before(apiKey.DateExpires) {
+			apiKey.DateExpires = dateOverlapEnd
+			apiKey.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+			writes = append(writes, c.putApiKey(*apiKey))
+		}
+
+		return writes, nil
+
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed rotating api key")
+	}
+
+	lib_log.Info(ctx, "Rotated", lib_log.FmtString("apiKeyId", apiKeyId))
+	return apiKeyId, nil
+}
+
+func (c *InMemoryClient) RevokeApiKey(ctx context.Context, apiKeyRevoke dto.ApiKeyRevoke) error {
+	lib_log.Info(ctx, "Revoking", lib_log.FmtAny("apiKeyRevoke", apiKeyRevoke))
+
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		apiKey, err := c.readApiKey(ctx, apiKeyRevoke.Id, apiKeyRevoke.Test)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading api key")
+		}
+		if apiKey.DateRevoked.Valid {
+			lib_log.Info(ctx, "Api key already revoked", lib_log.FmtTime("apiKey.DateRevoked.Time", apiKey.DateRevoked.Time))
+			return nil, nil
+		}
+
+		apiKey.DateRevoked = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		apiKey.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		return []inMemoryWrite{c.putApiKey(*apiKey)}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed revoking api key")
+	}
+
+	lib_log.Info(ctx, "Revoked")
+	return nil
+}
+
+func (c *InMemoryClient) ConsumeApiKeyQuota(ctx context.Context, lineageApiKeyId string, day civil.Date, dailyQuota int64) (int64, error) {
+	lib_log.Info(ctx, "Consuming", lib_log.FmtString("lineageApiKeyId", lineageApiKeyId), lib_log.FmtString("day", day.String()), lib_log.FmtInt64("dailyQuota", dailyQuota))
+
+	var used int64
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		apiKeyQuotaUsage := c.apiKeyQuotaUsageByIds[apiKeyQuotaUsageIds{lineageApiKeyId, day}]
+		if apiKeyQuotaUsage.Used >= dailyQuota {
+			return nil, lib_errors.NewCustom(http.StatusTooManyRequests, constants.TooManyRequestsQuotaExceeded)
+		}
+		used = apiKeyQuotaUsage.Used + 1
+
+		return []inMemoryWrite{c.putApiKeyQuotaUsage(ApiKeyQuotaUsage{
+			DateUpdated:     spanner.CommitTimestamp,
+			Day:             day,
+			LineageApiKeyId: lineageApiKeyId,
+			Used:            used,
+		})}, nil
+
+	}); err != nil {
+		return 0, lib_errors.Wrap(err, "Failed consuming api key quota")
+	}
+
+	lib_log.Info(ctx, "Consumed", lib_log.FmtInt64("used", used))
+	return used, nil
+}
+
+// apiKeyQuotaUsageIds is the primary key of api_key_quota_usage
+type apiKeyQuotaUsageIds struct {
+	lineageApiKeyId string
+	day             civil.Date
+}
+
+func (c *InMemoryClient) putApiKeyQuotaUsage(apiKeyQuotaUsage ApiKeyQuotaUsage) inMemoryWrite {
+	return func(dateCommitted time.Time) {
+		withDateCommitted(&apiKeyQuotaUsage, dateCommitted)
+		c.apiKeyQuotaUsageByIds[apiKeyQuotaUsageIds{apiKeyQuotaUsage.LineageApiKeyId, apiKeyQuotaUsage.Day}] = apiKeyQuotaUsage
+	}
+}
+
+func (c *InMemoryClient) readApiKey(ctx context.Context, apiKeyId string, test bool) (*ApiKey, error) {
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	apiKey, ok := c.apiKeyById[apiKeyId]
+	if !ok {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+	if err := checkTenant(apiKey, tenantId); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking tenant")
+	}
+
+	if apiKey.Test != test {
+		return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+	}
+
+	return &apiKey, nil
+}
@@ -0,0 +1,1065 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+	lib_strings "github.com/tomwangsvc/lib-svc/strings"
+)
+
+func (c *InMemoryClient) CreateCar(ctx context.Context, carCreate dto.CarCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtAny("carCreate", carCreate))
+
+	var carId string
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		if carCreate.IdempotencyKey != nil {
+			idempotentResponse, err := c.readIdempotentResponse(ctx, *carCreate.IdempotencyKey)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed reading idempotent response")
+			}
+			if idempotentResponse != nil {
+				lib_log.Info(ctx, "Replaying idempotent response", lib_log.FmtAny("idempotentResponse", idempotentResponse))
+				carId = idempotentResponse.Location
+				return nil, nil
+			}
+		}
+
+		car, writes, err := c.newCarCreateWrites(ctx, carCreate)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating car create writes")
+		}
+
+		if carCreate.IdempotencyKey != nil {
+			writeIdempotencyKey, err := c.newIdempotencyKeyWrite(ctx, *carCreate.IdempotencyKey, dto.IdempotentResponse{
+				Location:   car.CarId,
+				StatusCode: http.StatusCreated,
+			}, c.config.IdempotencyKeyTtl, carCreate.Test)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed creating idempotency key write")
+			}
+			writes = append(writes, writeIdempotencyKey)
+		}
+
+		carId = car.CarId
+		return writes, nil
+
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("carId", carId))
+	return carId, nil
+}
+
+func (c *InMemoryClient) newCarCreateWrites(ctx context.Context, carCreate dto.CarCreate) (*Car, []inMemoryWrite, error) {
+	if err := checkCarCreate(ctx, carCreate); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed checking car create")
+	}
+
+	count, err := c.countCarsWithBrandAndModelName(ctx, carCreate.UserInput.BrandName, spanner.NullString{StringVal: carCreate.UserInput.ModelName, Valid: true})
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed counting cars with brand and model name")
+	}
+	if count > 0 {
+		return nil, nil, lib_errors.NewCustom(http.StatusConflict, "Already exist")
+	}
+
+	car, err := newCar(ctx, carCreate)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating car")
+	}
+	writes, err := c.newCarInsertWrites(ctx, car)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating car insert writes")
+	}
+	return &car, writes, nil
+}
+
+// countCarsWithBrandAndModelName counts the cars of the tenant with the brand and model name that have not been soft deleted, a null model name is equal to no model name as in SQL
+func (c *InMemoryClient) countCarsWithBrandAndModelName(ctx context.Context, brandName string, modelName spanner.NullString) (int64, error) {
+	cars, err := c.carsOfTenant(ctx, nil)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed getting cars of tenant")
+	}
+
+	var count int64
+	for _, v := range cars {
+		if !v.DateDeleted.Valid && v.BrandName == brandName && modelName.Valid && v.ModelName.Valid && v.ModelName.StringVal == modelName.StringVal {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (c *InMemoryClient) newCarInsertWrites(ctx context.Context, car Car) ([]inMemoryWrite, error) {
+	carHistory, outboxEvent, err := newCarChange(ctx, dto.CarHistoryOperationCreate, car.CarId, nil, &car, car.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating car change")
+	}
+	return []inMemoryWrite{c.putCar(car), c.putCarChange(carHistory, outboxEvent)}, nil
+}
+
+// putCar writes a new version of the car
+func (c *InMemoryClient) putCar(car Car) inMemoryWrite {
+	return func(dateCommitted time.Time) {
+		withDateCommitted(&car, dateCommitted)
+		c.carVersionsById[car.CarId] = append(c.carVersionsById[car.CarId], carVersion{
+			car:           &car,
+			dateCommitted: dateCommitted,
+		})
+	}
+}
+
+func (c *InMemoryClient) putCarChange(carHistory CarHistory, outboxEvent OutboxEvent) inMemoryWrite {
+	return func(dateCommitted time.Time) {
+		withDateCommitted(&carHistory, dateCommitted)
+		c.carHistoryById[carHistory.CarHistoryId] = carHistory
+		withDateCommitted(&outboxEvent, dateCommitted)
+		c.outboxEventById[outboxEvent.OutboxEventId] = outboxEvent
+	}
+}
+
+// carAsOf returns the version of the car committed at the time, or its latest version when no time is requested. Nil is returned for a car that did not exist or had been purged
+func (c *InMemoryClient) carAsOf(carId string, asOf *time.Time) *Car {
+	versions := c.carVersionsById[carId]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if asOf == nil || !versions[i].dateCommitted.After(*asOf) {
+			if versions[i].car == nil {
+				return nil
+			}
+			car := *versions[i].car
+			return &car
+		}
+	}
+	return nil
+}
+
+// carsOfTenant returns the cars of the tenant of the caller as of the time, ordered by id
+func (c *InMemoryClient) carsOfTenant(ctx context.Context, asOf *time.Time) ([]Car, error) {
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	var cars []Car
+	for carId := range c.carVersionsById {
+		if car := c.carAsOf(carId, asOf); car != nil && checkTenant(*car, tenantId) == nil {
+			cars = append(cars, *car)
+		}
+	}
+	sort.Slice(cars, func(i, j int) bool { return cars[i].CarId < cars[j].CarId })
+	return cars, nil
+}
+
+// readCarIncludingDeleted reads a car of the tenant of the caller, a car of another tenant is not found
+func (c *InMemoryClient) readCarIncludingDeleted(ctx context.Context, carId string, asOf *time.Time) (*Car, error) {
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	car := c.carAsOf(carId, asOf)
+	if car == nil {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+	if err := checkTenant(*car, tenantId); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking tenant")
+	}
+	return car, nil
+}
+
+func (c *InMemoryClient) readCar(ctx context.Context, carId string) (*Car, error) {
+	car, err := c.readCarIncludingDeleted(ctx, carId, nil)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car including deleted")
+	}
+
+	if car.DateDeleted.Valid {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+
+	return car, nil
+}
+
+func (c *InMemoryClient) SearchCars(ctx context.Context, carsSearch dto.CarsSearch) ([]Car, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("carsSearch", carsSearch))
+
+	columns, err := carColumnsForFields(carsSearch.Fields)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed getting car columns for fields")
+	}
+	if carsSearch.AsOf != nil {
+		if err := checkAsOf(*carsSearch.AsOf, c.config.VersionRetentionPeriod); err != nil {
+			return nil, nil, lib_errors.Wrap(err, "Failed checking as of")
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cars, err := c.searchCars(ctx, carsSearch.Filters, carsSearch.AsOf)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed searching cars")
+	}
+	sort.Slice(cars, func(i, j int) bool {
+		return lessByDateCreated(cars[i].DateCreated, cars[j].DateCreated, cars[i].CarId, cars[j].CarId, carsSearch.Pagination.Order)
+	})
+
+	start, end, pagination := c.paginate(len(cars), carsSearch.Pagination)
+	cars = cars[start:end]
+	for i := range cars {
+		inMemoryProject(&cars[i], columns)
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(cars)", len(cars)), lib_log.FmtAny("pagination", pagination))
+	return cars, pagination, nil
+}
+
+// searchCars returns the cars of the tenant of the caller matching the filters, soft deleted cars are excluded unless they are included by the filters
+func (c *InMemoryClient) searchCars(ctx context.Context, filters dto.CarsSearchFilters, asOf *time.Time) ([]Car, error) {
+	cars, err := c.carsOfTenant(ctx, asOf)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting cars of tenant")
+	}
+
+	var matches []Car
+	for _, v := range cars {
+		if v.DateDeleted.Valid && !filters.IncludeDeleted {
+			continue
+		}
+		match, err := matchLinkedFilters(inMemoryColumns(v), filters.LinkedFilters)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed matching linked filters")
+		}
+		if match {
+			matches = append(matches, v)
+		}
+	}
+	return matches, nil
+}
+
+// ExportCars passes the cars to exportCar once they have been read, so that the store is not locked while they are exported
+func (c *InMemoryClient) ExportCars(ctx context.Context, carsExport dto.CarsExport, exportCar ExportCar) (int, error) {
+	lib_log.Info(ctx, "Exporting", lib_log.FmtAny("carsExport", carsExport))
+
+	columns, err := carExportColumnsForFields(carsExport.Fields)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed getting car export columns for fields")
+	}
+
+	c.mu.Lock()
+	cars, err := c.searchCars(ctx, carsExport.Filters, nil)
+	c.mu.Unlock()
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed searching cars")
+	}
+	sort.Slice(cars, func(i, j int) bool {
+		return lessByDateCreated(cars[i].DateCreated, cars[j].DateCreated, cars[i].CarId, cars[j].CarId, "ASC")
+	})
+
+	for _, v := range cars {
+		inMemoryProject(&v, columns)
+		if err := exportCar(v); err != nil {
+			return 0, lib_errors.Wrap(err, "Failed exporting car")
+		}
+	}
+
+	lib_log.Info(ctx, "Exported", lib_log.FmtInt("len(cars)", len(cars)))
+	return len(cars), nil
+}
+
+func (c *InMemoryClient) ReadCar(ctx context.Context, carRead dto.CarRead) (*Car, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("carRead", carRead))
+
+	columns, err := carColumnsForFields(carRead.Fields)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting car columns for fields")
+	}
+	if carRead.AsOf != nil {
+		if err := checkAsOf(*carRead.AsOf, c.config.VersionRetentionPeriod); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking as of")
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	car, err := c.readCarIncludingDeleted(ctx, carRead.Id, carRead.AsOf)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car")
+	}
+
+	if !carRead.IncludeDeleted && car.DateDeleted.Valid {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+	if !carRead.IncludeDeleted && !lib_strings.Contains(columns, "date_deleted") {
+		columns = append(append([]string(nil), columns...), "date_deleted")
+	}
+	inMemoryProject(car, append(append([]string(nil), columns...), columnTenantId))
+
+	lib_log.Info(ctx, "Read", lib_log.FmtAny("car", car))
+	return car, nil
+}
+
+func (c *InMemoryClient) UpdateCar(ctx context.Context, carUpdate dto.CarUpdate) error {
+	lib_log.Info(ctx, "Updating", lib_log.FmtAny("carUpdate", carUpdate))
+
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		return c.newCarUpdateWrites(ctx, carUpdate)
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Updated", lib_log.FmtAny("carUpdate", carUpdate))
+	return nil
+}
+
+func (c *InMemoryClient) newCarUpdateWrites(ctx context.Context, carUpdate dto.CarUpdate) ([]inMemoryWrite, error) {
+	car, err := c.readCarForUpdate(ctx, carUpdate.Id, carUpdate.IfUnmodifiedSince, carUpdate.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car for update")
+	}
+
+	return c.newCarUpdatedWrites(ctx, dto.CarHistoryOperationUpdate, *car, newUpdatedCar(*car, carUpdate.UserInput))
+}
+
+func (c *InMemoryClient) readCarForUpdate(ctx context.Context, carId string, ifUnmodifiedSince *time.Time, test bool) (*Car, error) {
+	car, err := c.readCar(ctx, carId)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car")
+	}
+
+	if err := checkCarForUpdate(ctx, *car, ifUnmodifiedSince, test); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking car for update")
+	}
+
+	return car, nil
+}
+
+func (c *InMemoryClient) newCarUpdatedWrites(ctx context.Context, operation string, car, updatedCar Car) ([]inMemoryWrite, error) {
+	carHistory, outboxEvent, err := newCarChange(ctx, operation, car.CarId, &car, &updatedCar, car.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating car change")
+	}
+
+	updatedCar.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+	return []inMemoryWrite{c.putCar(updatedCar), c.putCarChange(carHistory, outboxEvent)}, nil
+}
+
+func (c *InMemoryClient) DeleteCar(ctx context.Context, carDelete dto.CarDelete) error {
+	lib_log.Info(ctx, "Deleting", lib_log.FmtAny("carDelete", carDelete))
+
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		return c.newCarDeleteWrites(ctx, carDelete)
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Deleted", lib_log.FmtAny("carDelete", carDelete))
+	return nil
+}
+
+func (c *InMemoryClient) newCarDeleteWrites(ctx context.Context, carDelete dto.CarDelete) ([]inMemoryWrite, error) {
+	car, err := c.readCar(ctx, carDelete.Id)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car")
+	}
+
+	if err := checkCarAccess(ctx, *car, carDelete.Test); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking car access")
+	}
+
+	carHistory, outboxEvent, err := newCarChange(ctx, dto.CarHistoryOperationDelete, car.CarId, car, nil, car.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating car change")
+	}
+
+	deletedCar := *car
+	deletedCar.DateDeleted = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+	return []inMemoryWrite{c.putCar(deletedCar), c.putCarChange(carHistory, outboxEvent)}, nil
+}
+
+func (c *InMemoryClient) PatchCar(ctx context.Context, carPatch dto.CarPatch, checkCar CheckCar) error {
+	lib_log.Info(ctx, "Patching", lib_log.FmtAny("carPatch", carPatch))
+
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		car, err := c.readCar(ctx, carPatch.Id)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car")
+		}
+
+		if err := checkCarAccess(ctx, *car, carPatch.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking car access")
+		}
+
+		patchedCar, _, err := newPatchedCar(ctx, *car, carPatch, checkCar)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating patched car")
+		}
+
+		return c.newCarUpdatedWrites(ctx, dto.CarHistoryOperationPatch, *car, *patchedCar)
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Patched")
+	return nil
+}
+
+func (c *InMemoryClient) RestoreCar(ctx context.Context, carRestore dto.CarRestore) error {
+	lib_log.Info(ctx, "Restoring", lib_log.FmtAny("carRestore", carRestore))
+
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		car, err := c.readCarIncludingDeleted(ctx, carRestore.Id, nil)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car including deleted")
+		}
+
+		if err := checkCarAccess(ctx, *car, carRestore.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking car access")
+		}
+
+		if !car.DateDeleted.Valid {
+			lib_log.Info(ctx, "Car not deleted, nothing to restore")
+			return nil, nil
+		}
+
+		count, err := c.countCarsWithBrandAndModelName(ctx, car.BrandName, car.ModelName)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed counting cars with brand and model name")
+		}
+		if count > 0 {
+			return nil, lib_errors.NewCustom(http.StatusConflict, "Already exist")
+		}
+
+		carHistory, outboxEvent, err := newCarChange(ctx, dto.CarHistoryOperationRestore, car.CarId, nil, car, car.Test)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating car change")
+		}
+
+		restoredCar := *car
+		restoredCar.DateDeleted = spanner.NullTime{}
+		restoredCar.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		return []inMemoryWrite{c.putCar(restoredCar), c.putCarChange(carHistory, outboxEvent)}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Restored", lib_log.FmtAny("carRestore", carRestore))
+	return nil
+}
+
+// PurgeCars removes the tombstones of the cars of every tenant soft deleted before the date with their rentals, history and outbox events, their versions are kept so that they can still be read as of a time before the purge
+func (c *InMemoryClient) PurgeCars(ctx context.Context, dateDeletedBefore time.Time) (int64, error) {
+	lib_log.Info(ctx, "Purging", lib_log.FmtTime("dateDeletedBefore", dateDeletedBefore))
+
+	var count int64
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		count = 0
+
+		var writes []inMemoryWrite
+		for carId := range c.carVersionsById {
+			car := c.carAsOf(carId, nil)
+			if car == nil || !car.DateDeleted.Valid || !car.DateDeleted.Time.Before(dateDeletedBefore) {
+				continue
+			}
+			carId := carId
+			writes = append(writes, func(dateCommitted time.Time) {
+				c.carVersionsById[carId] = append(c.carVersionsById[carId], carVersion{
+					dateCommitted: dateCommitted,
+				})
+				c.deleteCarCustomerAssociations(carId)
+				for k, v := range c.carHistoryById {
+					if v.CarId == carId {
+						delete(c.carHistoryById, k)
+					}
+				}
+				for k, v := range c.outboxEventById {
+					if v.AggregateId == carId {
+						delete(c.outboxEventById, k)
+					}
+				}
+			})
+			count++
+		}
+		return writes, nil
+
+	}); err != nil {
+		return 0, lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Purged", lib_log.FmtInt64("count", count))
+	return count, nil
+}
+
+// deleteCarCustomerAssociations removes the rentals of the car, the lock of the store must be held
+func (c *InMemoryClient) deleteCarCustomerAssociations(carId string) {
+	var carCustomerAssociations []CarCustomerAssociation
+	for _, v := range c.carCustomerAssociations {
+		if v.CarId != carId {
+			carCustomerAssociations = append(carCustomerAssociations, v)
+		}
+	}
+	c.carCustomerAssociations = carCustomerAssociations
+}
+
+func (c *InMemoryClient) BatchCars(ctx context.Context, carsBatch dto.CarsBatch) ([]dto.CarsBatchResult, error) {
+	lib_log.Info(ctx, "Batching", lib_log.FmtString("carsBatch.Mode", carsBatch.Mode), lib_log.FmtInt("len(carsBatch.Operations)", len(carsBatch.Operations)))
+
+	var results []dto.CarsBatchResult
+	var err error
+	if carsBatch.Mode == dto.CarsBatchModeAllOrNothing {
+		results, err = c.batchCarsAllOrNothing(ctx, carsBatch)
+	} else {
+		results, err = batchCarsBestEffort(ctx, c, carsBatch)
+	}
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed batching cars")
+	}
+
+	lib_log.Info(ctx, "Batched", lib_log.FmtInt("len(results)", len(results)))
+	return results, nil
+}
+
+func (c *InMemoryClient) batchCarsAllOrNothing(ctx context.Context, carsBatch dto.CarsBatch) ([]dto.CarsBatchResult, error) {
+	var results []dto.CarsBatchResult
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		results = nil
+
+		if carsBatch.IdempotencyKey != nil {
+			idempotentResponse, err := c.readIdempotentResponse(ctx, *carsBatch.IdempotencyKey)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed reading idempotent response")
+			}
+			if idempotentResponse != nil {
+				lib_log.Info(ctx, "Replaying idempotent response", lib_log.FmtAny("idempotentResponse", idempotentResponse))
+				if err := json.Unmarshal(idempotentResponse.Body, &results); err != nil {
+					return nil, lib_errors.Wrap(err, "Failed unmarshalling idempotent response body into []dto.CarsBatchResult")
+				}
+				return nil, nil
+			}
+		}
+
+		// Writes are only applied once the reads are done, so the cars changed earlier in the batch are tracked to detect conflicts within the batch
+		changes := newCarsBatchChanges()
+
+		var writes []inMemoryWrite
+		for i, operation := range carsBatch.Operations {
+			result := dto.CarsBatchResult{
+				Index: i,
+			}
+
+			var operationWrites []inMemoryWrite
+			var err error
+			switch {
+			case operation.CarCreate != nil:
+				if err := changes.checkCreate(*operation.CarCreate); err != nil {
+					return nil, withCarsBatchOperationIndex(err, i)
+				}
+
+				var car *Car
+				car, operationWrites, err = c.newCarCreateWrites(ctx, *operation.CarCreate)
+				if err == nil {
+					changes.addCreated(*operation.CarCreate, car.CarId)
+					result.CarId = car.CarId
+					result.Status = http.StatusCreated
+				}
+
+			case operation.CarUpdate != nil:
+				if err := changes.checkChange(operation.CarUpdate.Id); err != nil {
+					return nil, withCarsBatchOperationIndex(err, i)
+				}
+				operationWrites, err = c.newCarUpdateWrites(ctx, *operation.CarUpdate)
+				result.CarId = operation.CarUpdate.Id
+				result.Status = http.StatusNoContent
+
+			case operation.CarDelete != nil:
+				if err := changes.checkChange(operation.CarDelete.Id); err != nil {
+					return nil, withCarsBatchOperationIndex(err, i)
+				}
+				operationWrites, err = c.newCarDeleteWrites(ctx, *operation.CarDelete)
+				if err == nil {
+					changes.addDeleted(operation.CarDelete.Id)
+				}
+				result.CarId = operation.CarDelete.Id
+				result.Status = http.StatusNoContent
+
+			default:
+				err = lib_errors.New("Operation has no car create, update or delete")
+			}
+			if err != nil {
+				return nil, withCarsBatchOperationIndex(lib_errors.Wrapf(err, "Failed creating writes for operation %d", i), i)
+			}
+
+			writes = append(writes, operationWrites...)
+			results = append(results, result)
+		}
+
+		if carsBatch.IdempotencyKey != nil {
+			idempotentResponse, err := newCarsBatchIdempotentResponse(results)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed creating cars batch idempotent response")
+			}
+			writeIdempotencyKey, err := c.newIdempotencyKeyWrite(ctx, *carsBatch.IdempotencyKey, *idempotentResponse, c.config.IdempotencyKeyTtl, carsBatch.Test)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed creating idempotency key write")
+			}
+			writes = append(writes, writeIdempotencyKey)
+		}
+
+		return writes, nil
+
+	}); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	return results, nil
+}
+
+// readIdempotentResponse returns the stored response for a retry of the same request, nil is returned when the key has not been used or has expired
+func (c *InMemoryClient) readIdempotentResponse(ctx context.Context, idempotencyKey dto.IdempotencyKey) (*dto.IdempotentResponse, error) {
+	id, err := newIdempotencyKeyId(ctx, idempotencyKey)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating idempotency key id")
+	}
+	storedIdempotencyKey, ok := c.idempotencyKeyByIds[id]
+	if !ok {
+		return nil, nil
+	}
+	return newIdempotentResponse(ctx, storedIdempotencyKey, idempotencyKey)
+}
+
+func (c *InMemoryClient) newIdempotencyKeyWrite(ctx context.Context, idempotencyKey dto.IdempotencyKey, idempotentResponse dto.IdempotentResponse, ttl time.Duration, test bool) (inMemoryWrite, error) {
+	storedIdempotencyKey, err := newIdempotencyKey(ctx, idempotencyKey, idempotentResponse, ttl, test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating idempotency key")
+	}
+	return func(dateCommitted time.Time) {
+		withDateCommitted(storedIdempotencyKey, dateCommitted)
+		c.idempotencyKeyByIds[storedIdempotencyKey.IdempotencyKey] = *storedIdempotencyKey
+	}, nil
+}
+
+// ClaimIdempotencyKey returns the stored response for a retry of the same request, otherwise the key is stored as pending so that a concurrent retry is rejected until the key is completed, released or its pending ttl expires
+func (c *InMemoryClient) ClaimIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, test bool) (*dto.IdempotentResponse, error) {
+	lib_log.Info(ctx, "Claiming", lib_log.FmtAny("idempotencyKey", idempotencyKey))
+
+	var idempotentResponse *dto.IdempotentResponse
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		var err error
+		idempotentResponse, err = c.readIdempotentResponse(ctx, idempotencyKey)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading idempotent response")
+		}
+		if idempotentResponse != nil {
+			return nil, nil
+		}
+
+		writeIdempotencyKey, err := c.newIdempotencyKeyWrite(ctx, idempotencyKey, dto.IdempotentResponse{StatusCode: idempotencyKeyPendingStatusCode}, c.config.idempotencyKeyPendingTtl(), test)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating idempotency key write")
+		}
+		return []inMemoryWrite{writeIdempotencyKey}, nil
+
+	}); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Claimed", lib_log.FmtAny("idempotentResponse", idempotentResponse))
+	return idempotentResponse, nil
+}
+
+// CompleteIdempotencyKey stores the response against a claimed key so that it is replayed for retries
+func (c *InMemoryClient) CompleteIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, idempotentResponse dto.IdempotentResponse, test bool) error {
+	lib_log.Info(ctx, "Completing", lib_log.FmtAny("idempotencyKey", idempotencyKey), lib_log.FmtInt("idempotentResponse.StatusCode", idempotentResponse.StatusCode))
+
+	writeIdempotencyKey, err := c.newIdempotencyKeyWrite(ctx, idempotencyKey, idempotentResponse, c.config.IdempotencyKeyTtl, test)
+	if err != nil {
+		return lib_errors.Wrap(err, "Failed creating idempotency key write")
+	}
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		return []inMemoryWrite{writeIdempotencyKey}, nil
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Completed")
+	return nil
+}
+
+// ReleaseIdempotencyKey deletes a claimed key, so that a request that failed can be retried with the same key
+func (c *InMemoryClient) ReleaseIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey) error {
+	lib_log.Info(ctx, "Releasing", lib_log.FmtAny("idempotencyKey", idempotencyKey))
+
+	id, err := newIdempotencyKeyId(ctx, idempotencyKey)
+	if err != nil {
+		return lib_errors.Wrap(err, "Failed creating idempotency key id")
+	}
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		return []inMemoryWrite{func(_ time.Time) {
+			delete(c.idempotencyKeyByIds, id)
+		}}, nil
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Released")
+	return nil
+}
+
+// ImportCars creates the cars in chunks committed in their own transactions, as the spanner client does
+func (c *InMemoryClient) ImportCars(ctx context.Context, carsImportCars []dto.CarsImportCar) ([]dto.CarsImportReportRow, error) {
+	lib_log.Info(ctx, "Importing", lib_log.FmtInt("len(carsImportCars)", len(carsImportCars)), lib_log.FmtInt("c.config.ImportChunkSize", c.config.ImportChunkSize))
+
+	chunkSize := c.config.ImportChunkSize
+	if chunkSize <= 0 {
+		chunkSize = len(carsImportCars)
+	}
+
+	var rows []dto.CarsImportReportRow
+	for start := 0; start < len(carsImportCars); start += chunkSize {
+		end := start + chunkSize
+		if end > len(carsImportCars) {
+			end = len(carsImportCars)
+		}
+
+		chunkRows, err := c.importCarsChunk(ctx, carsImportCars[start:end])
+		if err != nil {
+			return nil, lib_errors.Wrapf(err, "Failed importing chunk starting at %d", start)
+		}
+		rows = append(rows, chunkRows...)
+	}
+
+	lib_log.Info(ctx, "Imported", lib_log.FmtInt("len(rows)", len(rows)))
+	return rows, nil
+}
+
+func (c *InMemoryClient) importCarsChunk(ctx context.Context, carsImportCars []dto.CarsImportCar) ([]dto.CarsImportReportRow, error) {
+	var rows []dto.CarsImportReportRow
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		rows = nil
+
+		cars, err := c.carsOfTenant(ctx, nil)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed getting cars of tenant")
+		}
+		existing := make(map[string]bool)
+		for _, v := range cars {
+			if !v.DateDeleted.Valid {
+				existing[brandAndModelNameKey(v.BrandName, v.ModelName.StringVal)] = true
+			}
+		}
+
+		var writes []inMemoryWrite
+		for _, v := range carsImportCars {
+			if existing[brandAndModelNameKey(v.CarCreate.UserInput.BrandName, v.CarCreate.UserInput.ModelName)] {
+				rows = append(rows, dto.CarsImportReportRow{
+					Errors: []lib_errors.Item{{Message: "Already exist"}},
+					Number: v.Number,
+					Status: http.StatusConflict,
+				})
+				continue
+			}
+
+			car, err := newCar(ctx, v.CarCreate)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed creating car")
+			}
+			carWrites, err := c.newCarInsertWrites(ctx, car)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed creating car insert writes")
+			}
+			writes = append(writes, carWrites...)
+
+			rows = append(rows, dto.CarsImportReportRow{
+				CarId:  car.CarId,
+				Number: v.Number,
+				Status: http.StatusCreated,
+			})
+		}
+
+		return writes, nil
+
+	}); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	return rows, nil
+}
+
+func (c *InMemoryClient) CreateCarsImport(ctx context.Context, carsImportReport dto.CarsImportReport, test bool) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtInt("carsImportReport.RowsTotal", carsImportReport.RowsTotal))
+
+	tenantId, err := newTenantId(ctx)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed getting new tenant id")
+	}
+
+	carsImportReport.CarsImportId = uuid.New().String()
+	var carsImportReportRows []CarsImportReportRow
+	for _, v := range carsImportReport.Rows {
+		carsImportReportRow, err := newCarsImportReportRow(carsImportReport.CarsImportId, v)
+		if err != nil {
+			return "", lib_errors.Wrap(err, "Failed creating cars import report row")
+		}
+		carsImportReportRows = append(carsImportReportRows, *carsImportReportRow)
+	}
+
+	carsImport := CarsImport{
+		CarsImportId: carsImportReport.CarsImportId,
+		DateCreated:  spanner.CommitTimestamp,
+		RowsFailed:   int64(carsImportReport.RowsFailed),
+		RowsImported: int64(carsImportReport.RowsImported),
+		RowsTotal:    int64(carsImportReport.RowsTotal),
+		TenantId:     tenantId,
+		Test:         test,
+	}
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		return []inMemoryWrite{func(dateCommitted time.Time) {
+			withDateCommitted(&carsImport, dateCommitted)
+			c.carsImportById[carsImport.CarsImportId] = carsImport
+			c.carsImportReportRowsById[carsImport.CarsImportId] = carsImportReportRows
+		}}, nil
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("carsImportReport.CarsImportId", carsImportReport.CarsImportId))
+	return carsImportReport.CarsImportId, nil
+}
+
+func (c *InMemoryClient) ReadCarsImportReport(ctx context.Context, carsImportReportRead dto.CarsImportReportRead) (*dto.CarsImportReport, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("carsImportReportRead", carsImportReportRead))
+
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	c.mu.Lock()
+	carsImport, ok := c.carsImportById[carsImportReportRead.Id]
+	carsImportReportRows := c.carsImportReportRowsById[carsImportReportRead.Id]
+	c.mu.Unlock()
+	if !ok {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+	if err := checkTenant(carsImport, tenantId); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking tenant")
+	}
+
+	if carsImport.Test != carsImportReportRead.Test {
+		return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+	}
+
+	carsImportReport := dto.CarsImportReport{
+		CarsImportId: carsImport.CarsImportId,
+		RowsFailed:   int(carsImport.RowsFailed),
+		RowsImported: int(carsImport.RowsImported),
+		RowsTotal:    int(carsImport.RowsTotal),
+	}
+	for _, v := range carsImportReportRows {
+		carsImportReportRow, err := newDtoCarsImportReportRow(v)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating dto cars import report row")
+		}
+		carsImportReport.Rows = append(carsImportReport.Rows, *carsImportReportRow)
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("carsImportReport.RowsTotal", carsImportReport.RowsTotal))
+	return &carsImportReport, nil
+}
+
+func (c *InMemoryClient) SearchCarHistory(ctx context.Context, carHistorySearch dto.CarHistorySearch) ([]CarHistory, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("carHistorySearch", carHistorySearch))
+
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var carHistory []CarHistory
+	for _, v := range c.carHistoryById {
+		if v.CarId == carHistorySearch.CarId && v.Test == carHistorySearch.Test && checkTenant(v, tenantId) == nil {
+			carHistory = append(carHistory, v)
+		}
+	}
+	sort.Slice(carHistory, func(i, j int) bool {
+		return lessByDateCreated(carHistory[i].DateCreated, carHistory[j].DateCreated, carHistory[i].CarHistoryId, carHistory[j].CarHistoryId, carHistorySearch.Pagination.Order)
+	})
+
+	start, end, pagination := c.paginate(len(carHistory), carHistorySearch.Pagination)
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carHistory)", end-start), lib_log.FmtAny("pagination", pagination))
+	return carHistory[start:end], pagination, nil
+}
+
+func (c *InMemoryClient) RevertCar(ctx context.Context, carRevert dto.CarRevert) error {
+	lib_log.Info(ctx, "Reverting", lib_log.FmtAny("carRevert", carRevert))
+
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		car, err := c.readCarForUpdate(ctx, carRevert.Id, carRevert.IfUnmodifiedSince, carRevert.Test)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car for update")
+		}
+
+		carHistory, err := c.readCarHistoryForRevert(ctx, carRevert)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car history for revert")
+		}
+
+		revertedCar, err := newRevertedCar(*car, *carHistory)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating reverted car")
+		}
+
+		return c.newCarUpdatedWrites(ctx, dto.CarHistoryOperationRevert, *car, *revertedCar)
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Reverted")
+	return nil
+}
+
+// readCarHistoryForRevert reads the history row requested by id, or the latest history row at the requested date
+func (c *InMemoryClient) readCarHistoryForRevert(ctx context.Context, carRevert dto.CarRevert) (*CarHistory, error) {
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	if carRevert.UserInput.CarHistoryId != nil {
+		carHistory, ok := c.carHistoryById[*carRevert.UserInput.CarHistoryId]
+		if !ok || checkTenant(carHistory, tenantId) != nil || carHistory.CarId != carRevert.Id {
+			return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+		}
+		return &carHistory, nil
+	}
+
+	var latest *CarHistory
+	for _, v := range c.carHistoryById {
+		if v.CarId != carRevert.Id || checkTenant(v, tenantId) != nil || carRevert.UserInput.Date == nil || v.DateCreated.After(*carRevert.UserInput.Date) {
+			continue
+		}
+		if latest == nil || v.DateCreated.After(latest.DateCreated) {
+			carHistory := v
+			latest = &carHistory
+		}
+	}
+	if latest == nil {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+	return latest, nil
+}
+
+// ReadCarChanges reads the history rows committed after the since token in commit order, when no since token is requested the feed starts at the read timestamp
+func (c *InMemoryClient) ReadCarChanges(ctx context.Context, carChangesRead dto.CarChangesRead) ([]CarHistory, *dto.CarChangesToken, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("carChangesRead", carChangesRead))
+
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if carChangesRead.Since == nil {
+		readTimestamp := c.readTimestamp()
+		lib_log.Info(ctx, "Read", lib_log.FmtAny("readTimestamp", readTimestamp))
+		return nil, &dto.CarChangesToken{DateCreated: readTimestamp}, nil
+	}
+	since := *carChangesRead.Since
+
+	var carHistory []CarHistory
+	for _, v := range c.carHistoryById {
+		if v.Test != carChangesRead.Test || checkTenant(v, tenantId) != nil {
+			continue
+		}
+		if v.DateCreated.After(since.DateCreated) || (v.DateCreated.Equal(since.DateCreated) && v.CarHistoryId > since.CarHistoryId) {
+			carHistory = append(carHistory, v)
+		}
+	}
+	sort.Slice(carHistory, func(i, j int) bool {
+		return lessByDateCreated(carHistory[i].DateCreated, carHistory[j].DateCreated, carHistory[i].CarHistoryId, carHistory[j].CarHistoryId, "ASC")
+	})
+	if len(carHistory) > carChangesRead.Pagination.Limit {
+		carHistory = carHistory[:carChangesRead.Pagination.Limit]
+	}
+
+	next := since
+	for i := range carHistory {
+		inMemoryProject(&carHistory[i], []string{"car_history_id", "car_id", "date_created", "operation"})
+		next = dto.CarChangesToken{
+			CarHistoryId: carHistory[i].CarHistoryId,
+			DateCreated:  carHistory[i].DateCreated,
+		}
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carHistory)", len(carHistory)), lib_log.FmtAny("next", next))
+	return carHistory, &next, nil
+}
+
+func (c *InMemoryClient) ReadOutboxEventsUnpublished(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtInt("limit", limit))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var outboxEvents []OutboxEvent
+	for _, v := range c.outboxEventById {
+		if !v.DatePublished.Valid {
+			outboxEvents = append(outboxEvents, v)
+		}
+	}
+	sort.Slice(outboxEvents, func(i, j int) bool {
+		return lessByDateCreated(outboxEvents[i].DateCreated, outboxEvents[j].DateCreated, outboxEvents[i].OutboxEventId, outboxEvents[j].OutboxEventId, "ASC")
+	})
+	if len(outboxEvents) > limit {
+		outboxEvents = outboxEvents[:limit]
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(outboxEvents)", len(outboxEvents)))
+	return outboxEvents, nil
+}
+
+func (c *InMemoryClient) UpdateOutboxEventsPublished(ctx context.Context, outboxEventIds []string) error {
+	lib_log.Info(ctx, "Updating", lib_log.FmtInt("len(outboxEventIds)", len(outboxEventIds)))
+
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		var writes []inMemoryWrite
+		for _, v := range outboxEventIds {
+			outboxEvent, ok := c.outboxEventById[v]
+			if !ok {
+				return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+			}
+			writes = append(writes, func(dateCommitted time.Time) {
+				outboxEvent.DatePublished = spanner.NullTime{Time: dateCommitted, Valid: true}
+				c.outboxEventById[outboxEvent.OutboxEventId] = outboxEvent
+			})
+		}
+		return writes, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Updated", lib_log.FmtInt("len(outboxEventIds)", len(outboxEventIds)))
+	return nil
+}
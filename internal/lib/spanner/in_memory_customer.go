@@ -0,0 +1,152 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+// PutCustomer stores the customer, customers are created by another service so it is how they are seeded for local runs and tests
+func (c *InMemoryClient) PutCustomer(customer Customer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.customerById[customer.CustomerId] = customer
+}
+
+// PutCarCustomerAssociation stores the rental as it is, without the checks of CreateCarCustomerAssociation, so that rentals that have already started are seeded for local runs and tests
+func (c *InMemoryClient) PutCarCustomerAssociation(carCustomerAssociation CarCustomerAssociation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.carCustomerAssociations = append(c.carCustomerAssociations, carCustomerAssociation)
+}
+
+func (c *InMemoryClient) ReadCustomer(ctx context.Context, customerRead dto.CustomerRead) (*Customer, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("customerRead", customerRead))
+
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	c.mu.Lock()
+	customer, ok := c.customerById[customerRead.Id]
+	c.mu.Unlock()
+	if !ok {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+	if err := checkTenant(customer, tenantId); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking tenant")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtAny("customer", customer))
+	return &customer, nil
+}
+
+func (c *InMemoryClient) BlockCustomer(ctx context.Context, customerEvent dto.CustomerEvent) error {
+	lib_log.Info(ctx, "Blocking", lib_log.FmtAny("customerEvent", customerEvent))
+
+	var countCancelled int
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		countCancelled = 0
+
+		if _, consumed := c.pubsubMessageById[customerEvent.PubsubMessageId]; consumed {
+			lib_log.Info(ctx, "Pubsub message already consumed", lib_log.FmtString("customerEvent.PubsubMessageId", customerEvent.PubsubMessageId))
+			return nil, nil
+		}
+
+		now := time.Now()
+		var indexes []int
+		var outboxEvents []OutboxEvent
+		for i, v := range c.carCustomerAssociations {
+			if v.CustomerId == customerEvent.CustomerId && !v.DateCancelled.Valid && v.DateRentalStart.After(now) {
+				outboxEvent, err := newRentalCancelledOutboxEvent(ctx, v)
+				if err != nil {
+					return nil, lib_errors.Wrap(err, "Failed creating rental cancelled outbox event")
+				}
+				indexes = append(indexes, i)
+				outboxEvents = append(outboxEvents, outboxEvent)
+			}
+		}
+		countCancelled = len(indexes)
+
+		customerBlock := CustomerBlock{
+			CustomerId:  customerEvent.CustomerId,
+			DateCreated: spanner.CommitTimestamp,
+			EventType:   customerEvent.EventType,
+			Test:        customerEvent.Test,
+		}
+		pubsubMessage := PubsubMessage{
+			DateCreated:     spanner.CommitTimestamp,
+			PubsubMessageId: customerEvent.PubsubMessageId,
+			Test:            customerEvent.Test,
+		}
+		return []inMemoryWrite{func(dateCommitted time.Time) {
+			for _, i := range indexes {
+				c.carCustomerAssociations[i].DateCancelled = spanner.NullTime{Time: dateCommitted, Valid: true}
+				c.carCustomerAssociations[i].DateUpdated = dateCommitted
+			}
+			for _, v := range outboxEvents {
+				withDateCommitted(&v, dateCommitted)
+				c.outboxEventById[v.OutboxEventId] = v
+			}
+			withDateCommitted(&customerBlock, dateCommitted)
+			c.customerBlockById[customerBlock.CustomerId] = customerBlock
+			withDateCommitted(&pubsubMessage, dateCommitted)
+			c.pubsubMessageById[pubsubMessage.PubsubMessageId] = pubsubMessage
+		}}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed blocking customer")
+	}
+
+	lib_log.Info(ctx, "Blocked", lib_log.FmtInt("countCancelled", countCancelled))
+	return nil
+}
+
+func (c *InMemoryClient) CreateCarCustomerAssociation(ctx context.Context, carCustomerAssociationCreate dto.CarCustomerAssociationCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtAny("carCustomerAssociationCreate", carCustomerAssociationCreate))
+
+	carCustomerAssociation, err := newCarCustomerAssociation(ctx, carCustomerAssociationCreate)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating car customer association")
+	}
+	outboxEvent, err := newRentalCreatedOutboxEvent(ctx, carCustomerAssociation)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating rental created outbox event")
+	}
+
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		car, err := c.readCar(ctx, carCustomerAssociationCreate.CarId)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car")
+		}
+		if err := checkCarAccess(ctx, *car, carCustomerAssociationCreate.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking car access")
+		}
+
+		if _, blocked := c.customerBlockById[carCustomerAssociation.CustomerId]; blocked {
+			return nil, lib_errors.NewCustom(http.StatusConflict, constants.ConflictCustomerBlocked)
+		}
+
+		return []inMemoryWrite{func(dateCommitted time.Time) {
+			withDateCommitted(&carCustomerAssociation, dateCommitted)
+			c.carCustomerAssociations = append(c.carCustomerAssociations, carCustomerAssociation)
+			withDateCommitted(&outboxEvent, dateCommitted)
+			c.outboxEventById[outboxEvent.OutboxEventId] = outboxEvent
+		}}, nil
+
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("carCustomerAssociation.Id", carCustomerAssociation.Id))
+	return carCustomerAssociation.Id, nil
+}
@@ -0,0 +1,162 @@
+package spanner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	lib_search "github.com/tomwangsvc/lib-svc/search"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_matchLinkedFilters(t *testing.T) {
+	linkedFilterTypeAnd := lib_search.LinkedFilterTypeAnd
+	linkedFilterTypeCloseBracket := lib_search.LinkedFilterTypeCloseBracket
+	linkedFilterTypeOpenBracket := lib_search.LinkedFilterTypeOpenBracket
+	linkedFilterTypeOr := lib_search.LinkedFilterTypeOr
+
+	columns := map[string]interface{}{
+		"brand_name": "Toyota",
+		"model_name": nil,
+		"seats":      int64(5),
+	}
+
+	type expected struct {
+		match bool
+		err   bool
+	}
+	var data = []struct {
+		desc  string
+		input []lib_search.LinkedFilter
+		expected
+	}{
+		{
+			desc:     "no filters",
+			expected: expected{match: true},
+		},
+		{
+			desc: "AND binds tighter than OR",
+			input: []lib_search.LinkedFilter{
+				{Filter: &lib_search.Filter{Key: "brand_name", Value: "Toyota"}},
+				{Type: &linkedFilterTypeOr},
+				{Filter: &lib_search.Filter{Key: "brand_name", Value: "Honda"}},
+				{Type: &linkedFilterTypeAnd},
+				{Filter: &lib_search.Filter{Key: "seats", Value: int64(2)}},
+			},
+			expected: expected{match: true},
+		},
+		{
+			desc: "brackets bind before AND",
+			input: []lib_search.LinkedFilter{
+				{Type: &linkedFilterTypeOpenBracket},
+				{Filter: &lib_search.Filter{Key: "brand_name", Value: "Toyota"}},
+				{Type: &linkedFilterTypeOr},
+				{Filter: &lib_search.Filter{Key: "brand_name", Value: "Honda"}},
+				{Type: &linkedFilterTypeCloseBracket},
+				{Type: &linkedFilterTypeAnd},
+				{Filter: &lib_search.Filter{Key: "seats", Value: int64(2)}},
+			},
+		},
+		{
+			desc: "case insensitive partial match",
+			input: []lib_search.LinkedFilter{
+				{Filter: &lib_search.Filter{Key: "brand_name", Value: "yot", CaseInsensitiveString: true, PartialMatchString: true}},
+			},
+			expected: expected{match: true},
+		},
+		{
+			desc: "range",
+			input: []lib_search.LinkedFilter{
+				{Filter: &lib_search.Filter{Key: "seats", Value: []int64{2, 5}, InRange: true}},
+			},
+			expected: expected{match: true},
+		},
+		{
+			desc: "null is not equal to a value with a not condition",
+			input: []lib_search.LinkedFilter{
+				{Filter: &lib_search.Filter{Key: "model_name", Value: "Corolla", NotCondition: true}},
+			},
+		},
+		{
+			desc: "null",
+			input: []lib_search.LinkedFilter{
+				{Filter: &lib_search.Filter{Key: "model_name", IsNull: true}},
+			},
+			expected: expected{match: true},
+		},
+		{
+			desc: "unknown column",
+			input: []lib_search.LinkedFilter{
+				{Filter: &lib_search.Filter{Key: "colour", Value: "red"}},
+			},
+			expected: expected{err: true},
+		},
+		{
+			desc: "bracket not closed",
+			input: []lib_search.LinkedFilter{
+				{Type: &linkedFilterTypeOpenBracket},
+				{Filter: &lib_search.Filter{Key: "brand_name", Value: "Toyota"}},
+			},
+			expected: expected{err: true},
+		},
+	}
+
+	for i, d := range data {
+		match, err := matchLinkedFilters(columns, d.input)
+		if (err != nil) != d.expected.err {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.err,
+				Result:     err,
+			}))
+			continue
+		}
+
+		if match != d.expected.match {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "match",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.match,
+				Result:     match,
+			}))
+		}
+	}
+}
+
+func Test_InMemoryClient_ReadFleetCounts(t *testing.T) {
+	now := time.Now()
+	c := NewInMemoryClient(context.Background(), Config{})
+	c.carVersionsById = map[string][]carVersion{
+		"active":   {{car: &Car{CarId: "active"}}},
+		"deleted":  {{car: &Car{CarId: "deleted", DateDeleted: spanner.NullTime{Time: now, Valid: true}}}},
+		"purged":   {{car: &Car{CarId: "purged"}}, {}},
+		"restored": {{car: &Car{CarId: "restored", DateDeleted: spanner.NullTime{Time: now, Valid: true}}}, {car: &Car{CarId: "restored"}}},
+		"test":     {{car: &Car{CarId: "test", Test: true}}},
+	}
+	c.carCustomerAssociations = []CarCustomerAssociation{
+		{CarId: "active", DateRentalStart: now.Add(-time.Hour), DateRentalEnd: now.Add(time.Hour)},
+		{CarId: "cancelled", DateCancelled: spanner.NullTime{Time: now, Valid: true}, DateRentalStart: now.Add(-time.Hour), DateRentalEnd: now.Add(time.Hour)},
+		{CarId: "ended", DateRentalStart: now.Add(-2 * time.Hour), DateRentalEnd: now.Add(-time.Hour)},
+		{CarId: "future", DateRentalStart: now.Add(time.Hour), DateRentalEnd: now.Add(2 * time.Hour)},
+		{CarId: "test", DateRentalStart: now.Add(-time.Hour), DateRentalEnd: now.Add(time.Hour), Test: true},
+	}
+
+	fleetCounts, err := c.ReadFleetCounts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &FleetCounts{CarsActive: 2, CarsDeleted: 1, RentalsActive: 1}
+	if !reflect.DeepEqual(fleetCounts, expected) {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "fleetCounts",
+			Expected:   expected,
+			Result:     fleetCounts,
+		}))
+	}
+}
@@ -0,0 +1,313 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+func (c *InMemoryClient) CreateWebhookSubscription(ctx context.Context, webhookSubscriptionCreate dto.WebhookSubscriptionCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtString("webhookSubscriptionCreate.UserInput.Url", webhookSubscriptionCreate.UserInput.Url))
+
+	tenantId, err := newTenantId(ctx)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed getting new tenant id")
+	}
+
+	webhookSubscription := WebhookSubscription{
+		DateCreated:           spanner.CommitTimestamp,
+		EventTypes:            webhookSubscriptionCreate.UserInput.EventTypes,
+		Secret:                webhookSubscriptionCreate.UserInput.Secret,
+		TenantId:              tenantId,
+		Test:                  webhookSubscriptionCreate.Test,
+		Url:                   webhookSubscriptionCreate.UserInput.Url,
+		WebhookSubscriptionId: uuid.New().String(),
+	}
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		return []inMemoryWrite{func(dateCommitted time.Time) {
+			withDateCommitted(&webhookSubscription, dateCommitted)
+			c.webhookSubscriptionById[webhookSubscription.WebhookSubscriptionId] = webhookSubscription
+		}}, nil
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("webhookSubscriptionId", webhookSubscription.WebhookSubscriptionId))
+	return webhookSubscription.WebhookSubscriptionId, nil
+}
+
+func (c *InMemoryClient) SearchWebhookSubscriptions(ctx context.Context, webhookSubscriptionsSearch dto.WebhookSubscriptionsSearch) ([]WebhookSubscription, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("webhookSubscriptionsSearch", webhookSubscriptionsSearch))
+
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var webhookSubscriptions []WebhookSubscription
+	for _, v := range c.webhookSubscriptionById {
+		if v.Test == webhookSubscriptionsSearch.Test && checkTenant(v, tenantId) == nil {
+			webhookSubscriptions = append(webhookSubscriptions, v)
+		}
+	}
+	sort.Slice(webhookSubscriptions, func(i, j int) bool {
+		return lessByDateCreated(webhookSubscriptions[i].DateCreated, webhookSubscriptions[j].DateCreated, webhookSubscriptions[i].WebhookSubscriptionId, webhookSubscriptions[j].WebhookSubscriptionId, webhookSubscriptionsSearch.Pagination.Order)
+	})
+
+	start, end, pagination := c.paginate(len(webhookSubscriptions), webhookSubscriptionsSearch.Pagination)
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(webhookSubscriptions)", end-start), lib_log.FmtAny("pagination", pagination))
+	return webhookSubscriptions[start:end], pagination, nil
+}
+
+func (c *InMemoryClient) DeleteWebhookSubscription(ctx context.Context, webhookSubscriptionDelete dto.WebhookSubscriptionDelete) error {
+	lib_log.Info(ctx, "Deleting", lib_log.FmtAny("webhookSubscriptionDelete", webhookSubscriptionDelete))
+
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		if _, err := c.readWebhookSubscription(ctx, webhookSubscriptionDelete.Id, webhookSubscriptionDelete.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading webhook subscription")
+		}
+
+		return []inMemoryWrite{func(dateCommitted time.Time) {
+			delete(c.webhookSubscriptionById, webhookSubscriptionDelete.Id)
+			for k, v := range c.webhookDeliveryById {
+				if v.WebhookSubscriptionId == webhookSubscriptionDelete.Id {
+					delete(c.webhookDeliveryById, k)
+				}
+			}
+		}}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed deleting webhook subscription")
+	}
+
+	lib_log.Info(ctx, "Deleted")
+	return nil
+}
+
+func (c *InMemoryClient) readWebhookSubscription(ctx context.Context, webhookSubscriptionId string, test bool) (*WebhookSubscription, error) {
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	webhookSubscription, ok := c.webhookSubscriptionById[webhookSubscriptionId]
+	if !ok {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+	if err := checkTenant(webhookSubscription, tenantId); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking tenant")
+	}
+
+	if webhookSubscription.Test != test {
+		return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+	}
+
+	return &webhookSubscription, nil
+}
+
+func (c *InMemoryClient) ReadWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	lib_log.Info(ctx, "Reading")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var webhookSubscriptions []WebhookSubscription
+	for _, v := range c.webhookSubscriptionById {
+		webhookSubscriptions = append(webhookSubscriptions, v)
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(webhookSubscriptions)", len(webhookSubscriptions)))
+	return webhookSubscriptions, nil
+}
+
+// CreateWebhookDeliveries skips deliveries that already exist and deliveries to subscriptions deleted since they were read
+func (c *InMemoryClient) CreateWebhookDeliveries(ctx context.Context, events []dto.Event, webhookSubscriptions []WebhookSubscription) (int, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtInt("len(events)", len(events)), lib_log.FmtInt("len(webhookSubscriptions)", len(webhookSubscriptions)))
+
+	var count int
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		count = 0
+
+		webhookDeliveries, err := newWebhookDeliveries(events, webhookSubscriptions)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating webhook deliveries")
+		}
+
+		var writes []inMemoryWrite
+		for _, v := range webhookDeliveries {
+			if _, ok := c.webhookDeliveryById[v.WebhookDeliveryId]; ok {
+				continue
+			}
+			if _, ok := c.webhookSubscriptionById[v.WebhookSubscriptionId]; !ok {
+				continue
+			}
+			webhookDelivery := v
+			writes = append(writes, func(dateCommitted time.Time) {
+				withDateCommitted(&webhookDelivery, dateCommitted)
+				c.webhookDeliveryById[webhookDelivery.WebhookDeliveryId] = webhookDelivery
+			})
+		}
+		count = len(writes)
+
+		return writes, nil
+
+	}); err != nil {
+		return 0, lib_errors.Wrap(err, "Failed creating webhook deliveries")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtInt("count", count))
+	return count, nil
+}
+
+func (c *InMemoryClient) ReadWebhookDeliveriesDue(ctx context.Context, limit int) ([]WebhookDeliveryDue, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtInt("limit", limit))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.readTimestamp()
+	var webhookDeliveries []WebhookDelivery
+	for _, v := range c.webhookDeliveryById {
+		if v.Status == dto.WebhookDeliveryStatusPending && v.DateNextAttempt.Valid && !v.DateNextAttempt.Time.After(now) {
+			webhookDeliveries = append(webhookDeliveries, v)
+		}
+	}
+	sort.Slice(webhookDeliveries, func(i, j int) bool {
+		return lessByDateCreated(webhookDeliveries[i].DateNextAttempt.Time, webhookDeliveries[j].DateNextAttempt.Time, webhookDeliveries[i].WebhookDeliveryId, webhookDeliveries[j].WebhookDeliveryId, "ASC")
+	})
+	if len(webhookDeliveries) > limit {
+		webhookDeliveries = webhookDeliveries[:limit]
+	}
+
+	var webhookDeliveriesDue []WebhookDeliveryDue
+	for _, v := range webhookDeliveries {
+		webhookSubscription, ok := c.webhookSubscriptionById[v.WebhookSubscriptionId]
+		if !ok {
+			continue
+		}
+		webhookDeliveriesDue = append(webhookDeliveriesDue, WebhookDeliveryDue{
+			WebhookDelivery: v,
+			Secret:          webhookSubscription.Secret,
+			Url:             webhookSubscription.Url,
+		})
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(webhookDeliveriesDue)", len(webhookDeliveriesDue)))
+	return webhookDeliveriesDue, nil
+}
+
+func (c *InMemoryClient) UpdateWebhookDeliveryAttempted(ctx context.Context, webhookDelivery WebhookDelivery, webhookDeliveryAttempt dto.WebhookDeliveryAttempt) error {
+	lib_log.Info(ctx, "Updating", lib_log.FmtString("webhookDelivery.WebhookDeliveryId", webhookDelivery.WebhookDeliveryId), lib_log.FmtAny("webhookDeliveryAttempt", webhookDeliveryAttempt))
+
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		storedWebhookDelivery, ok := c.webhookDeliveryById[webhookDelivery.WebhookDeliveryId]
+		if !ok || storedWebhookDelivery.WebhookSubscriptionId != webhookDelivery.WebhookSubscriptionId {
+			return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+		}
+
+		storedWebhookDelivery.Attempts = webhookDelivery.Attempts + 1
+		storedWebhookDelivery.DateNextAttempt = spanner.NullTime{}
+		storedWebhookDelivery.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		storedWebhookDelivery.LastError = spanner.NullString{}
+		storedWebhookDelivery.LastResponseStatusCode = spanner.NullInt64{}
+		storedWebhookDelivery.Status = webhookDeliveryAttempt.Status
+		if webhookDeliveryAttempt.DateNextAttempt != nil {
+			storedWebhookDelivery.DateNextAttempt = spanner.NullTime{Time: *webhookDeliveryAttempt.DateNextAttempt, Valid: true}
+		}
+		if webhookDeliveryAttempt.Error != nil {
+			storedWebhookDelivery.LastError = spanner.NullString{StringVal: *webhookDeliveryAttempt.Error, Valid: true}
+		}
+		if webhookDeliveryAttempt.ResponseStatusCode != nil {
+			storedWebhookDelivery.LastResponseStatusCode = spanner.NullInt64{Int64: int64(*webhookDeliveryAttempt.ResponseStatusCode), Valid: true}
+		}
+
+		return []inMemoryWrite{c.putWebhookDelivery(storedWebhookDelivery)}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed updating webhook delivery")
+	}
+
+	lib_log.Info(ctx, "Updated")
+	return nil
+}
+
+func (c *InMemoryClient) putWebhookDelivery(webhookDelivery WebhookDelivery) inMemoryWrite {
+	return func(dateCommitted time.Time) {
+		withDateCommitted(&webhookDelivery, dateCommitted)
+		c.webhookDeliveryById[webhookDelivery.WebhookDeliveryId] = webhookDelivery
+	}
+}
+
+func (c *InMemoryClient) SearchWebhookDeliveries(ctx context.Context, webhookDeliveriesSearch dto.WebhookDeliveriesSearch) ([]WebhookDelivery, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("webhookDeliveriesSearch", webhookDeliveriesSearch))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.readWebhookSubscription(ctx, webhookDeliveriesSearch.WebhookSubscriptionId, webhookDeliveriesSearch.Test); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed reading webhook subscription")
+	}
+
+	var webhookDeliveries []WebhookDelivery
+	for _, v := range c.webhookDeliveryById {
+		if v.WebhookSubscriptionId != webhookDeliveriesSearch.WebhookSubscriptionId {
+			continue
+		}
+		if webhookDeliveriesSearch.Status != nil && v.Status != *webhookDeliveriesSearch.Status {
+			continue
+		}
+		webhookDeliveries = append(webhookDeliveries, v)
+	}
+	sort.Slice(webhookDeliveries, func(i, j int) bool {
+		return lessByDateCreated(webhookDeliveries[i].DateCreated, webhookDeliveries[j].DateCreated, webhookDeliveries[i].WebhookDeliveryId, webhookDeliveries[j].WebhookDeliveryId, webhookDeliveriesSearch.Pagination.Order)
+	})
+
+	start, end, pagination := c.paginate(len(webhookDeliveries), webhookDeliveriesSearch.Pagination)
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(webhookDeliveries)", end-start), lib_log.FmtAny("pagination", pagination))
+	return webhookDeliveries[start:end], pagination, nil
+}
+
+func (c *InMemoryClient) RedeliverWebhookDelivery(ctx context.Context, webhookDeliveryRedeliver dto.WebhookDeliveryRedeliver) error {
+	lib_log.Info(ctx, "Redelivering", lib_log.FmtAny("webhookDeliveryRedeliver", webhookDeliveryRedeliver))
+
+	if err := c.readWrite(func() ([]inMemoryWrite, error) {
+		if _, err := c.readWebhookSubscription(ctx, webhookDeliveryRedeliver.WebhookSubscriptionId, webhookDeliveryRedeliver.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading webhook subscription")
+		}
+
+		webhookDelivery, ok := c.webhookDeliveryById[webhookDeliveryRedeliver.Id]
+		if !ok || webhookDelivery.WebhookSubscriptionId != webhookDeliveryRedeliver.WebhookSubscriptionId {
+			return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+		}
+
+		if webhookDelivery.Test != webhookDeliveryRedeliver.Test {
+			return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+		}
+
+		webhookDelivery.Attempts = 0
+		webhookDelivery.DateNextAttempt = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		webhookDelivery.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		webhookDelivery.Status = dto.WebhookDeliveryStatusPending
+		return []inMemoryWrite{c.putWebhookDelivery(webhookDelivery)}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed redelivering webhook delivery")
+	}
+
+	lib_log.Info(ctx, "Redelivered")
+	return nil
+}
@@ -0,0 +1,195 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/metrics"
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+	"go.opencensus.io/stats/view"
+)
+
+const (
+	// fleetCountsMaxStaleness allows the fleet counts to be read from any replica without a lock, they are gauges that need not be exact
+	fleetCountsMaxStaleness = 15 * time.Second
+
+	transactionOutcomeAborted   = "aborted"
+	transactionOutcomeCommitted = "committed"
+	transactionOutcomeFailed    = "failed"
+)
+
+var (
+	spannerTransactionDurationSeconds = promauto.With(metrics.Default).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "spanner_transaction_duration_seconds",
+		Help:    "Read write transaction latency in seconds including retries by outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"outcome"})
+	spannerTransactionAbortsTotal = promauto.With(metrics.Default).NewCounter(prometheus.CounterOpts{
+		Name: "spanner_transaction_aborts_total",
+		Help: "Read write transactions that failed as aborted once the client stopped retrying.",
+	})
+	spannerTransactionRetriesTotal = promauto.With(metrics.Default).NewCounter(prometheus.CounterOpts{
+		Name: "spanner_transaction_retries_total",
+		Help: "Attempts of read write transactions after the first, the client retries a transaction that is aborted.",
+	})
+
+	// The counts of the session pool views are cumulative, so the totals are counters
+	sessionPoolMetrics = []struct {
+		desc      *prometheus.Desc
+		valueType prometheus.ValueType
+		view      *view.View
+	}{
+		{prometheus.NewDesc("spanner_session_pool_open_sessions", "Sessions open in the session pool.", nil, nil), prometheus.GaugeValue, spanner.OpenSessionCountView},
+		{prometheus.NewDesc("spanner_session_pool_max_allowed_sessions", "Sessions the session pool is allowed to open.", nil, nil), prometheus.GaugeValue, spanner.MaxAllowedSessionsCountView},
+		{prometheus.NewDesc("spanner_session_pool_max_in_use_sessions", "Sessions in use at once at most in the last 10 minutes.", nil, nil), prometheus.GaugeValue, spanner.MaxInUseSessionsCountView},
+		{prometheus.NewDesc("spanner_session_pool_acquired_sessions_total", "Sessions taken from the session pool.", nil, nil), prometheus.CounterValue, spanner.AcquiredSessionsCountView},
+		{prometheus.NewDesc("spanner_session_pool_released_sessions_total", "Sessions returned to the session pool.", nil, nil), prometheus.CounterValue, spanner.ReleasedSessionsCountView},
+		{prometheus.NewDesc("spanner_session_pool_get_session_timeouts_total", "Requests for a session that timed out waiting for the session pool.", nil, nil), prometheus.CounterValue, spanner.GetSessionTimeoutsCountView},
+	}
+	spannerSessionPoolSessions = prometheus.NewDesc("spanner_session_pool_sessions", "Sessions of the session pool by type.", []string{"type"}, nil)
+)
+
+// FleetCounts are the counts of the business gauges across tenants, test rows are not counted
+type FleetCounts struct {
+	CarsActive    int64
+	CarsDeleted   int64
+	RentalsActive int64
+}
+
+// instrumentedClient records the duration, retries and aborts of read write transactions, it embeds the spanner client so that every other method is that of the spanner client
+type instrumentedClient struct {
+	*spanner.Client
+}
+
+func (c instrumentedClient) ReadWriteTransaction(ctx context.Context, f func(context.Context, *spanner.ReadWriteTransaction) error) (time.Time, error) {
+	start := time.Now()
+
+	// The client runs the attempts of a transaction one after the other, so the count needs no lock
+	var attempts int
+	dateCommitted, err := c.Client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		attempts++
+		return f(ctx, tx)
+	})
+
+	outcome := transactionOutcomeCommitted
+	if err != nil {
+		outcome = transactionOutcomeFailed
+		if lib_spanner.IsAborted(lib_spanner.WrapError(err, "Failed executing spanner read write transaction")) {
+			outcome = transactionOutcomeAborted
+			spannerTransactionAbortsTotal.Inc()
+		}
+	}
+	if attempts > 1 {
+		spannerTransactionRetriesTotal.Add(float64(attempts - 1))
+	}
+	spannerTransactionDurationSeconds.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+
+	return dateCommitted, err
+}
+
+// enableSessionPoolMetrics records the session pool stats of the spanner client as views and registers the collector that reads them on a scrape
+func enableSessionPoolMetrics() error {
+	if err := spanner.EnableStatViews(); err != nil {
+		return lib_errors.Wrap(err, "Failed enabling spanner stat views")
+	}
+	// The collector reads the views of every spanner client, so it is registered once however many clients are created
+	if err := metrics.Default.Register(sessionPoolCollector{}); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			return lib_errors.Wrap(err, "Failed registering session pool collector")
+		}
+	}
+	return nil
+}
+
+// sessionPoolCollector reads the session pool stats from their views, a view that cannot be read is logged and left out of the scrape
+type sessionPoolCollector struct{}
+
+func (sessionPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, v := range sessionPoolMetrics {
+		ch <- v.desc
+	}
+	ch <- spannerSessionPoolSessions
+}
+
+// Collect sums the rows of each view, there is a row per spanner client and a row per type for the sessions
+func (sessionPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	for _, v := range sessionPoolMetrics {
+		rows, err := view.RetrieveData(v.view.Name)
+		if err != nil {
+			lib_log.Error(ctx, "Failed retrieving data of view", lib_log.FmtString("v.view.Name", v.view.Name), lib_log.FmtError(err))
+			continue
+		}
+		var value float64
+		for _, row := range rows {
+			value += viewRowValue(row)
+		}
+		ch <- prometheus.MustNewConstMetric(v.desc, v.valueType, value)
+	}
+
+	rows, err := view.RetrieveData(spanner.SessionsCountView.Name)
+	if err != nil {
+		lib_log.Error(ctx, "Failed retrieving data of view", lib_log.FmtString("spanner.SessionsCountView.Name", spanner.SessionsCountView.Name), lib_log.FmtError(err))
+		return
+	}
+	valueByType := make(map[string]float64)
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if tag.Key.Name() == "type" {
+				valueByType[tag.Value] += viewRowValue(row)
+			}
+		}
+	}
+	for k, v := range valueByType {
+		ch <- prometheus.MustNewConstMetric(spannerSessionPoolSessions, prometheus.GaugeValue, v, k)
+	}
+}
+
+func viewRowValue(row *view.Row) float64 {
+	switch data := row.Data.(type) {
+	case *view.CountData:
+		return float64(data.Value)
+	case *view.LastValueData:
+		return data.Value
+	case *view.SumData:
+		return data.Value
+	}
+	return 0
+}
+
+// ReadFleetCounts reads the counts of cars and rentals across tenants with a stale read, rentals are active from their start until their end unless cancelled
+func (c client) ReadFleetCounts(ctx context.Context) (*FleetCounts, error) {
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT
+				(SELECT COUNT(*) FROM %[1]s WHERE test = false AND date_deleted IS NULL),
+				(SELECT COUNT(*) FROM %[1]s WHERE test = false AND date_deleted IS NOT NULL),
+				(SELECT COUNT(*) FROM %[2]s WHERE test = false AND date_cancelled IS NULL AND date_rental_start <= @now AND date_rental_end > @now)
+		`,
+			tableCar,
+			tableCarCustomerAssociation,
+		),
+		Params: map[string]interface{}{
+			"now": time.Now(),
+		},
+	}
+
+	iter := c.spannerClient.Single().WithTimestampBound(spanner.MaxStaleness(fleetCountsMaxStaleness)).Query(ctx, stmt)
+	defer iter.Stop()
+
+	row, err := iter.Next()
+	if err != nil {
+		return nil, lib_spanner.WrapError(err, "Failed iterating fleet counts")
+	}
+	var fleetCounts FleetCounts
+	if err := row.Columns(&fleetCounts.CarsActive, &fleetCounts.CarsDeleted, &fleetCounts.RentalsActive); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading columns of fleet counts")
+	}
+	return &fleetCounts, nil
+}
@@ -5,8 +5,11 @@ import (
 	"car-svc/internal/lib/spanner"
 	"context"
 	"encoding/binary"
+	"time"
 
+	"cloud.google.com/go/civil"
 	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
 	lib_mock "github.com/tomwangsvc/lib-svc/mock"
 	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
 )
@@ -23,11 +26,19 @@ type clientError struct{}
 
 func (c clientError) Close() {}
 
-func (c clientError) TransformCarToJson(_ context.Context, _ spanner.Car) ([]byte, error) {
+func (c clientError) Ping(_ context.Context) error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) ReadFleetCounts(_ context.Context) (*spanner.FleetCounts, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) TransformCarToJson(_ context.Context, _ spanner.Car, _ []string) ([]byte, error) {
 	return nil, ExpectedErrorClient
 }
 
-func (c clientError) TransformCarsToJson(_ context.Context, _ []spanner.Car) ([]byte, error) {
+func (c clientError) TransformCarsToJson(_ context.Context, _ []spanner.Car, _ []string) ([]byte, error) {
 	return nil, ExpectedErrorClient
 }
 
@@ -39,6 +50,10 @@ func (c clientError) SearchCars(_ context.Context, _ dto.CarsSearch) ([]spanner.
 	return nil, nil, ExpectedErrorClient
 }
 
+func (c clientError) ExportCars(_ context.Context, _ dto.CarsExport, _ spanner.ExportCar) (int, error) {
+	return 0, ExpectedErrorClient
+}
+
 func (c clientError) ReadCar(_ context.Context, _ dto.CarRead) (*spanner.Car, error) {
 	return nil, ExpectedErrorClient
 }
@@ -47,10 +62,162 @@ func (c clientError) UpdateCar(_ context.Context, _ dto.CarUpdate) error {
 	return ExpectedErrorClient
 }
 
+func (c clientError) PatchCar(_ context.Context, _ dto.CarPatch, _ spanner.CheckCar) error {
+	return ExpectedErrorClient
+}
+
 func (c clientError) DeleteCar(_ context.Context, _ dto.CarDelete) error {
 	return ExpectedErrorClient
 }
 
+func (c clientError) RestoreCar(_ context.Context, _ dto.CarRestore) error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) PurgeCars(_ context.Context, _ time.Time) (int64, error) {
+	return 0, ExpectedErrorClient
+}
+
+func (c clientError) BatchCars(_ context.Context, _ dto.CarsBatch) ([]dto.CarsBatchResult, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) ClaimIdempotencyKey(_ context.Context, _ dto.IdempotencyKey, _ bool) (*dto.IdempotentResponse, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) CompleteIdempotencyKey(_ context.Context, _ dto.IdempotencyKey, _ dto.IdempotentResponse, _ bool) error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) ReleaseIdempotencyKey(_ context.Context, _ dto.IdempotencyKey) error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) ImportCars(_ context.Context, _ []dto.CarsImportCar) ([]dto.CarsImportReportRow, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) CreateCarsImport(_ context.Context, _ dto.CarsImportReport, _ bool) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (c clientError) ReadCarsImportReport(_ context.Context, _ dto.CarsImportReportRead) (*dto.CarsImportReport, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) SearchCarHistory(_ context.Context, _ dto.CarHistorySearch) ([]spanner.CarHistory, *lib_pagination.Pagination, error) {
+	return nil, nil, ExpectedErrorClient
+}
+
+func (c clientError) TransformCarHistoryToJson(_ context.Context, _ []spanner.CarHistory) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) RevertCar(_ context.Context, _ dto.CarRevert) error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) ReadCarChanges(_ context.Context, _ dto.CarChangesRead) ([]spanner.CarHistory, *dto.CarChangesToken, error) {
+	return nil, nil, ExpectedErrorClient
+}
+
+func (c clientError) CreateCarCustomerAssociation(_ context.Context, _ dto.CarCustomerAssociationCreate) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (c clientError) ReadOutboxEventsUnpublished(_ context.Context, _ int) ([]spanner.OutboxEvent, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) UpdateOutboxEventsPublished(_ context.Context, _ []string) error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) ReadCustomer(_ context.Context, _ dto.CustomerRead) (*spanner.Customer, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) TransformCustomerToJson(_ context.Context, _ spanner.Customer, _ map[string]lib_json.Redaction) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) BlockCustomer(_ context.Context, _ dto.CustomerEvent) error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) CreateWebhookSubscription(_ context.Context, _ dto.WebhookSubscriptionCreate) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (c clientError) SearchWebhookSubscriptions(_ context.Context, _ dto.WebhookSubscriptionsSearch) ([]spanner.WebhookSubscription, *lib_pagination.Pagination, error) {
+	return nil, nil, ExpectedErrorClient
+}
+
+func (c clientError) DeleteWebhookSubscription(_ context.Context, _ dto.WebhookSubscriptionDelete) error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) ReadWebhookSubscriptions(_ context.Context) ([]spanner.WebhookSubscription, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) CreateWebhookDeliveries(_ context.Context, _ []dto.Event, _ []spanner.WebhookSubscription) (int, error) {
+	return 0, ExpectedErrorClient
+}
+
+func (c clientError) ReadWebhookDeliveriesDue(_ context.Context, _ int) ([]spanner.WebhookDeliveryDue, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) UpdateWebhookDeliveryAttempted(_ context.Context, _ spanner.WebhookDelivery, _ dto.WebhookDeliveryAttempt) error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) SearchWebhookDeliveries(_ context.Context, _ dto.WebhookDeliveriesSearch) ([]spanner.WebhookDelivery, *lib_pagination.Pagination, error) {
+	return nil, nil, ExpectedErrorClient
+}
+
+func (c clientError) RedeliverWebhookDelivery(_ context.Context, _ dto.WebhookDeliveryRedeliver) error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) TransformWebhookSubscriptionsToJson(_ context.Context, _ []spanner.WebhookSubscription) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) TransformWebhookDeliveriesToJson(_ context.Context, _ []spanner.WebhookDelivery) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) CreateApiKey(_ context.Context, _ dto.ApiKeyCreate) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (c clientError) SearchApiKeys(_ context.Context, _ dto.ApiKeysSearch) ([]spanner.ApiKey, *lib_pagination.Pagination, error) {
+	return nil, nil, ExpectedErrorClient
+}
+
+func (c clientError) ReadApiKeyByKeyHash(_ context.Context, _ string) (*spanner.ApiKey, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientError) RotateApiKey(_ context.Context, _ dto.ApiKeyRotate) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (c clientError) RevokeApiKey(_ context.Context, _ dto.ApiKeyRevoke) error {
+	return ExpectedErrorClient
+}
+
+func (c clientError) ConsumeApiKeyQuota(_ context.Context, _ string, _ civil.Date, _ int64) (int64, error) {
+	return 0, ExpectedErrorClient
+}
+
+func (c clientError) TransformApiKeysToJson(_ context.Context, _ []spanner.ApiKey) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
 func (c clientError) TransformBrandClassAssociationToJson(_ context.Context, _ spanner.CarCustomerAssociation) ([]byte, error) {
 	return nil, ExpectedErrorClient
 }
@@ -63,11 +230,19 @@ type clientErrorTransform struct{}
 
 func (c clientErrorTransform) Close() {}
 
-func (c clientErrorTransform) TransformCarToJson(_ context.Context, _ spanner.Car) ([]byte, error) {
+func (c clientErrorTransform) Ping(_ context.Context) error {
+	return nil
+}
+
+func (c clientErrorTransform) ReadFleetCounts(_ context.Context) (*spanner.FleetCounts, error) {
+	return &spanner.FleetCounts{}, nil
+}
+
+func (c clientErrorTransform) TransformCarToJson(_ context.Context, _ spanner.Car, _ []string) ([]byte, error) {
 	return nil, ExpectedErrorClient
 }
 
-func (c clientErrorTransform) TransformCarsToJson(_ context.Context, _ []spanner.Car) ([]byte, error) {
+func (c clientErrorTransform) TransformCarsToJson(_ context.Context, _ []spanner.Car, _ []string) ([]byte, error) {
 	return nil, ExpectedErrorClient
 }
 
@@ -79,6 +254,10 @@ func (c clientErrorTransform) SearchCars(_ context.Context, _ dto.CarsSearch) ([
 	return nil, nil, ExpectedErrorClient
 }
 
+func (c clientErrorTransform) ExportCars(_ context.Context, _ dto.CarsExport, _ spanner.ExportCar) (int, error) {
+	return 0, ExpectedErrorClient
+}
+
 func (c clientErrorTransform) ReadCar(_ context.Context, _ dto.CarRead) (*spanner.Car, error) {
 	return nil, ExpectedErrorClient
 }
@@ -87,10 +266,162 @@ func (c clientErrorTransform) UpdateCar(_ context.Context, _ dto.CarUpdate) erro
 	return ExpectedErrorClient
 }
 
+func (c clientErrorTransform) PatchCar(_ context.Context, _ dto.CarPatch, _ spanner.CheckCar) error {
+	return ExpectedErrorClient
+}
+
 func (c clientErrorTransform) DeleteCar(_ context.Context, _ dto.CarDelete) error {
 	return ExpectedErrorClient
 }
 
+func (c clientErrorTransform) RestoreCar(_ context.Context, _ dto.CarRestore) error {
+	return ExpectedErrorClient
+}
+
+func (c clientErrorTransform) PurgeCars(_ context.Context, _ time.Time) (int64, error) {
+	return 0, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) BatchCars(_ context.Context, _ dto.CarsBatch) ([]dto.CarsBatchResult, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) ClaimIdempotencyKey(_ context.Context, _ dto.IdempotencyKey, _ bool) (*dto.IdempotentResponse, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) CompleteIdempotencyKey(_ context.Context, _ dto.IdempotencyKey, _ dto.IdempotentResponse, _ bool) error {
+	return ExpectedErrorClient
+}
+
+func (c clientErrorTransform) ReleaseIdempotencyKey(_ context.Context, _ dto.IdempotencyKey) error {
+	return ExpectedErrorClient
+}
+
+func (c clientErrorTransform) ImportCars(_ context.Context, _ []dto.CarsImportCar) ([]dto.CarsImportReportRow, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) CreateCarsImport(_ context.Context, _ dto.CarsImportReport, _ bool) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (c clientErrorTransform) ReadCarsImportReport(_ context.Context, _ dto.CarsImportReportRead) (*dto.CarsImportReport, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) SearchCarHistory(_ context.Context, _ dto.CarHistorySearch) ([]spanner.CarHistory, *lib_pagination.Pagination, error) {
+	return []spanner.CarHistory{{}}, nil, nil
+}
+
+func (c clientErrorTransform) TransformCarHistoryToJson(_ context.Context, _ []spanner.CarHistory) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) RevertCar(_ context.Context, _ dto.CarRevert) error {
+	return ExpectedErrorClient
+}
+
+func (c clientErrorTransform) ReadCarChanges(_ context.Context, _ dto.CarChangesRead) ([]spanner.CarHistory, *dto.CarChangesToken, error) {
+	return nil, nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) CreateCarCustomerAssociation(_ context.Context, _ dto.CarCustomerAssociationCreate) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (c clientErrorTransform) ReadOutboxEventsUnpublished(_ context.Context, _ int) ([]spanner.OutboxEvent, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) UpdateOutboxEventsPublished(_ context.Context, _ []string) error {
+	return ExpectedErrorClient
+}
+
+func (c clientErrorTransform) ReadCustomer(_ context.Context, _ dto.CustomerRead) (*spanner.Customer, error) {
+	return &spanner.Customer{}, nil
+}
+
+func (c clientErrorTransform) TransformCustomerToJson(_ context.Context, _ spanner.Customer, _ map[string]lib_json.Redaction) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) BlockCustomer(_ context.Context, _ dto.CustomerEvent) error {
+	return ExpectedErrorClient
+}
+
+func (c clientErrorTransform) CreateWebhookSubscription(_ context.Context, _ dto.WebhookSubscriptionCreate) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (c clientErrorTransform) SearchWebhookSubscriptions(_ context.Context, _ dto.WebhookSubscriptionsSearch) ([]spanner.WebhookSubscription, *lib_pagination.Pagination, error) {
+	return []spanner.WebhookSubscription{{}}, nil, nil
+}
+
+func (c clientErrorTransform) DeleteWebhookSubscription(_ context.Context, _ dto.WebhookSubscriptionDelete) error {
+	return ExpectedErrorClient
+}
+
+func (c clientErrorTransform) ReadWebhookSubscriptions(_ context.Context) ([]spanner.WebhookSubscription, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) CreateWebhookDeliveries(_ context.Context, _ []dto.Event, _ []spanner.WebhookSubscription) (int, error) {
+	return 0, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) ReadWebhookDeliveriesDue(_ context.Context, _ int) ([]spanner.WebhookDeliveryDue, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) UpdateWebhookDeliveryAttempted(_ context.Context, _ spanner.WebhookDelivery, _ dto.WebhookDeliveryAttempt) error {
+	return ExpectedErrorClient
+}
+
+func (c clientErrorTransform) SearchWebhookDeliveries(_ context.Context, _ dto.WebhookDeliveriesSearch) ([]spanner.WebhookDelivery, *lib_pagination.Pagination, error) {
+	return []spanner.WebhookDelivery{{}}, nil, nil
+}
+
+func (c clientErrorTransform) RedeliverWebhookDelivery(_ context.Context, _ dto.WebhookDeliveryRedeliver) error {
+	return ExpectedErrorClient
+}
+
+func (c clientErrorTransform) TransformWebhookSubscriptionsToJson(_ context.Context, _ []spanner.WebhookSubscription) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) TransformWebhookDeliveriesToJson(_ context.Context, _ []spanner.WebhookDelivery) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) CreateApiKey(_ context.Context, _ dto.ApiKeyCreate) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (c clientErrorTransform) SearchApiKeys(_ context.Context, _ dto.ApiKeysSearch) ([]spanner.ApiKey, *lib_pagination.Pagination, error) {
+	return []spanner.ApiKey{{}}, nil, nil
+}
+
+func (c clientErrorTransform) ReadApiKeyByKeyHash(_ context.Context, _ string) (*spanner.ApiKey, error) {
+	return nil, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) RotateApiKey(_ context.Context, _ dto.ApiKeyRotate) (string, error) {
+	return "", ExpectedErrorClient
+}
+
+func (c clientErrorTransform) RevokeApiKey(_ context.Context, _ dto.ApiKeyRevoke) error {
+	return ExpectedErrorClient
+}
+
+func (c clientErrorTransform) ConsumeApiKeyQuota(_ context.Context, _ string, _ civil.Date, _ int64) (int64, error) {
+	return 0, ExpectedErrorClient
+}
+
+func (c clientErrorTransform) TransformApiKeysToJson(_ context.Context, _ []spanner.ApiKey) ([]byte, error) {
+	return nil, ExpectedErrorClient
+}
+
 func (c clientErrorTransform) TransformBrandClassAssociationToJson(_ context.Context, _ spanner.CarCustomerAssociation) ([]byte, error) {
 	return nil, ExpectedErrorClient
 }
@@ -103,11 +434,19 @@ type clientSuccess struct{}
 
 func (c clientSuccess) Close() {}
 
-func (c clientSuccess) TransformCarToJson(_ context.Context, _ spanner.Car) ([]byte, error) {
+func (c clientSuccess) Ping(_ context.Context) error {
+	return nil
+}
+
+func (c clientSuccess) ReadFleetCounts(_ context.Context) (*spanner.FleetCounts, error) {
+	return &spanner.FleetCounts{}, nil
+}
+
+func (c clientSuccess) TransformCarToJson(_ context.Context, _ spanner.Car, _ []string) ([]byte, error) {
 	return lib_mock.ExpectedResultBytes, nil
 }
 
-func (c clientSuccess) TransformCarsToJson(_ context.Context, _ []spanner.Car) ([]byte, error) {
+func (c clientSuccess) TransformCarsToJson(_ context.Context, _ []spanner.Car, _ []string) ([]byte, error) {
 	return lib_mock.ExpectedResultBytes, nil
 }
 
@@ -119,6 +458,10 @@ func (c clientSuccess) SearchCars(_ context.Context, _ dto.CarsSearch) ([]spanne
 	return []spanner.Car{{}}, nil, nil
 }
 
+func (c clientSuccess) ExportCars(_ context.Context, _ dto.CarsExport, exportCar spanner.ExportCar) (int, error) {
+	return 1, exportCar(spanner.Car{})
+}
+
 func (c clientSuccess) ReadCar(_ context.Context, _ dto.CarRead) (*spanner.Car, error) {
 	return &spanner.Car{}, nil
 }
@@ -127,10 +470,162 @@ func (c clientSuccess) UpdateCar(_ context.Context, _ dto.CarUpdate) error {
 	return nil
 }
 
+func (c clientSuccess) PatchCar(_ context.Context, _ dto.CarPatch, _ spanner.CheckCar) error {
+	return nil
+}
+
 func (c clientSuccess) DeleteCar(_ context.Context, _ dto.CarDelete) error {
 	return nil
 }
 
+func (c clientSuccess) RestoreCar(_ context.Context, _ dto.CarRestore) error {
+	return nil
+}
+
+func (c clientSuccess) PurgeCars(_ context.Context, _ time.Time) (int64, error) {
+	return 1, nil
+}
+
+func (c clientSuccess) BatchCars(_ context.Context, _ dto.CarsBatch) ([]dto.CarsBatchResult, error) {
+	return []dto.CarsBatchResult{{}}, nil
+}
+
+func (c clientSuccess) ClaimIdempotencyKey(_ context.Context, _ dto.IdempotencyKey, _ bool) (*dto.IdempotentResponse, error) {
+	return nil, nil
+}
+
+func (c clientSuccess) CompleteIdempotencyKey(_ context.Context, _ dto.IdempotencyKey, _ dto.IdempotentResponse, _ bool) error {
+	return nil
+}
+
+func (c clientSuccess) ReleaseIdempotencyKey(_ context.Context, _ dto.IdempotencyKey) error {
+	return nil
+}
+
+func (c clientSuccess) ImportCars(_ context.Context, _ []dto.CarsImportCar) ([]dto.CarsImportReportRow, error) {
+	return []dto.CarsImportReportRow{{}}, nil
+}
+
+func (c clientSuccess) CreateCarsImport(_ context.Context, _ dto.CarsImportReport, _ bool) (string, error) {
+	return lib_mock.ExpectedResultString, nil
+}
+
+func (c clientSuccess) ReadCarsImportReport(_ context.Context, _ dto.CarsImportReportRead) (*dto.CarsImportReport, error) {
+	return &dto.CarsImportReport{}, nil
+}
+
+func (c clientSuccess) SearchCarHistory(_ context.Context, _ dto.CarHistorySearch) ([]spanner.CarHistory, *lib_pagination.Pagination, error) {
+	return []spanner.CarHistory{{}}, nil, nil
+}
+
+func (c clientSuccess) TransformCarHistoryToJson(_ context.Context, _ []spanner.CarHistory) ([]byte, error) {
+	return lib_mock.ExpectedResultBytes, nil
+}
+
+func (c clientSuccess) RevertCar(_ context.Context, _ dto.CarRevert) error {
+	return nil
+}
+
+func (c clientSuccess) ReadCarChanges(_ context.Context, _ dto.CarChangesRead) ([]spanner.CarHistory, *dto.CarChangesToken, error) {
+	return []spanner.CarHistory{{}}, &dto.CarChangesToken{}, nil
+}
+
+func (c clientSuccess) CreateCarCustomerAssociation(_ context.Context, _ dto.CarCustomerAssociationCreate) (string, error) {
+	return lib_mock.ExpectedResultString, nil
+}
+
+func (c clientSuccess) ReadOutboxEventsUnpublished(_ context.Context, _ int) ([]spanner.OutboxEvent, error) {
+	return []spanner.OutboxEvent{{}}, nil
+}
+
+func (c clientSuccess) UpdateOutboxEventsPublished(_ context.Context, _ []string) error {
+	return nil
+}
+
+func (c clientSuccess) ReadCustomer(_ context.Context, _ dto.CustomerRead) (*spanner.Customer, error) {
+	return &spanner.Customer{}, nil
+}
+
+func (c clientSuccess) TransformCustomerToJson(_ context.Context, _ spanner.Customer, _ map[string]lib_json.Redaction) ([]byte, error) {
+	return lib_mock.ExpectedResultBytes, nil
+}
+
+func (c clientSuccess) BlockCustomer(_ context.Context, _ dto.CustomerEvent) error {
+	return nil
+}
+
+func (c clientSuccess) CreateWebhookSubscription(_ context.Context, _ dto.WebhookSubscriptionCreate) (string, error) {
+	return lib_mock.ExpectedResultString, nil
+}
+
+func (c clientSuccess) SearchWebhookSubscriptions(_ context.Context, _ dto.WebhookSubscriptionsSearch) ([]spanner.WebhookSubscription, *lib_pagination.Pagination, error) {
+	return []spanner.WebhookSubscription{{}}, nil, nil
+}
+
+func (c clientSuccess) DeleteWebhookSubscription(_ context.Context, _ dto.WebhookSubscriptionDelete) error {
+	return nil
+}
+
+func (c clientSuccess) ReadWebhookSubscriptions(_ context.Context) ([]spanner.WebhookSubscription, error) {
+	return []spanner.WebhookSubscription{{}}, nil
+}
+
+func (c clientSuccess) CreateWebhookDeliveries(_ context.Context, _ []dto.Event, _ []spanner.WebhookSubscription) (int, error) {
+	return 1, nil
+}
+
+func (c clientSuccess) ReadWebhookDeliveriesDue(_ context.Context, _ int) ([]spanner.WebhookDeliveryDue, error) {
+	return []spanner.WebhookDeliveryDue{{}}, nil
+}
+
+func (c clientSuccess) UpdateWebhookDeliveryAttempted(_ context.Context, _ spanner.WebhookDelivery, _ dto.WebhookDeliveryAttempt) error {
+	return nil
+}
+
+func (c clientSuccess) SearchWebhookDeliveries(_ context.Context, _ dto.WebhookDeliveriesSearch) ([]spanner.WebhookDelivery, *lib_pagination.Pagination, error) {
+	return []spanner.WebhookDelivery{{}}, nil, nil
+}
+
+func (c clientSuccess) RedeliverWebhookDelivery(_ context.Context, _ dto.WebhookDeliveryRedeliver) error {
+	return nil
+}
+
+func (c clientSuccess) TransformWebhookSubscriptionsToJson(_ context.Context, _ []spanner.WebhookSubscription) ([]byte, error) {
+	return lib_mock.ExpectedResultBytes, nil
+}
+
+func (c clientSuccess) TransformWebhookDeliveriesToJson(_ context.Context, _ []spanner.WebhookDelivery) ([]byte, error) {
+	return lib_mock.ExpectedResultBytes, nil
+}
+
+func (c clientSuccess) CreateApiKey(_ context.Context, _ dto.ApiKeyCreate) (string, error) {
+	return lib_mock.ExpectedResultString, nil
+}
+
+func (c clientSuccess) SearchApiKeys(_ context.Context, _ dto.ApiKeysSearch) ([]spanner.ApiKey, *lib_pagination.Pagination, error) {
+	return []spanner.ApiKey{{}}, &lib_pagination.Pagination{}, nil
+}
+
+func (c clientSuccess) ReadApiKeyByKeyHash(_ context.Context, _ string) (*spanner.ApiKey, error) {
+	return &spanner.ApiKey{DateExpires: time.Now().Add(time.Hour)}, nil
+}
+
+func (c clientSuccess) RotateApiKey(_ context.Context, _ dto.ApiKeyRotate) (string, error) {
+	return lib_mock.ExpectedResultString, nil
+}
+
+func (c clientSuccess) RevokeApiKey(_ context.Context, _ dto.ApiKeyRevoke) error {
+	return nil
+}
+
+func (c clientSuccess) ConsumeApiKeyQuota(_ context.Context, _ string, _ civil.Date, _ int64) (int64, error) {
+	return 1, nil
+}
+
+func (c clientSuccess) TransformApiKeysToJson(_ context.Context, _ []spanner.ApiKey) ([]byte, error) {
+	return lib_mock.ExpectedResultBytes, nil
+}
+
 func (c clientSuccess) TransformBrandClassAssociationToJson(_ context.Context, _ spanner.CarCustomerAssociation) ([]byte, error) {
 	return lib_mock.ExpectedResultBytes, nil
 }
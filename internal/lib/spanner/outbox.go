@@ -0,0 +1,208 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/dto"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	lib_context "github.com/tomwangsvc/lib-svc/context"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_misc "github.com/tomwangsvc/lib-svc/misc"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+	"google.golang.org/api/iterator"
+)
+
+type OutboxEvent struct {
+	AggregateId   string             `spanner:"aggregate_id"`
+	CorrelationId string             `spanner:"correlation_id"`
+	Data          spanner.NullString `spanner:"data"`
+	DateCreated   time.Time          `spanner:"date_created"`
+	DatePublished spanner.NullTime   `spanner:"date_published"`
+	EventType     string             `spanner:"event_type"`
+	OutboxEventId string             `spanner:"outbox_event_id"`
+	TenantId      spanner.NullString `spanner:"tenant_id"`
+	Test          bool               `spanner:"test"`
+}
+
+const (
+	tableOutboxEvent = "outbox_event"
+)
+
+var (
+	OutboxEventColumns = lib_misc.StructTaggedFieldNames(reflect.TypeOf(OutboxEvent{}), "spanner")
+
+	eventTypeByCarHistoryOperation = map[string]string{
+		dto.CarHistoryOperationCreate:  dto.EventTypeCarCreated,
+		dto.CarHistoryOperationDelete:  dto.EventTypeCarDeleted,
+		dto.CarHistoryOperationPatch:   dto.EventTypeCarUpdated,
+		dto.CarHistoryOperationRestore: dto.EventTypeCarRestored,
+		dto.CarHistoryOperationRevert:  dto.EventTypeCarUpdated,
+		dto.CarHistoryOperationUpdate:  dto.EventTypeCarUpdated,
+	}
+)
+
+// newCarChangeMutations creates the mutations recording a change to a car in its history and in the outbox, they must be buffered in the transaction making the change so that an event is published if and only if the change is committed
+// The change is recorded in the tenant of the car rather than of the caller, they are the same as the car has been read for the caller
+func newCarChangeMutations(ctx context.Context, operation, carId string, before, after *Car, test bool) ([]*spanner.Mutation, error) {
+	carHistory, outboxEvent, err := newCarChange(ctx, operation, carId, before, after, test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating car change")
+	}
+
+	mutCarHistory, err := spanner.InsertStruct(tableCarHistory, carHistory)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating mutCarHistory for car history")
+	}
+	mutOutboxEvent, err := spanner.InsertStruct(tableOutboxEvent, outboxEvent)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating mutOutboxEvent for outbox event")
+	}
+
+	return []*spanner.Mutation{mutCarHistory, mutOutboxEvent}, nil
+}
+
+// newCarChange creates the history row and the outbox event recording a change to a car
+func newCarChange(ctx context.Context, operation, carId string, before, after *Car, test bool) (CarHistory, OutboxEvent, error) {
+	car := after
+	if car == nil {
+		car = before
+	}
+
+	carHistory, err := newCarHistory(ctx, operation, carId, before, after, car.TenantId, test)
+	if err != nil {
+		return CarHistory{}, OutboxEvent{}, lib_errors.Wrap(err, "Failed creating car history")
+	}
+
+	eventType, ok := eventTypeByCarHistoryOperation[operation]
+	if !ok {
+		return CarHistory{}, OutboxEvent{}, lib_errors.Errorf("Not recognized: operation = %s", operation)
+	}
+	data, err := newCarHistoryState(car)
+	if err != nil {
+		return CarHistory{}, OutboxEvent{}, lib_errors.Wrap(err, "Failed creating event data")
+	}
+
+	return carHistory, OutboxEvent{
+		AggregateId:   carId,
+		CorrelationId: lib_context.CorrelationId(ctx),
+		Data:          data,
+		DateCreated:   spanner.CommitTimestamp,
+		EventType:     eventType,
+		OutboxEventId: uuid.New().String(),
+		TenantId:      car.TenantId,
+		Test:          test,
+	}, nil
+}
+
+// newRentalCreatedOutboxEvent creates the outbox event recording the creation of a rental, it is recorded in the transaction inserting the rental so that the rental is published if and only if it is committed
+func newRentalCreatedOutboxEvent(ctx context.Context, carCustomerAssociation CarCustomerAssociation) (OutboxEvent, error) {
+	return newRentalOutboxEvent(ctx, dto.EventTypeRentalCreated, carCustomerAssociation, map[string]interface{}{
+		"car_id":            carCustomerAssociation.CarId,
+		"customer_id":       carCustomerAssociation.CustomerId,
+		"date_rental_end":   carCustomerAssociation.DateRentalEnd,
+		"date_rental_start": carCustomerAssociation.DateRentalStart,
+		"id":                carCustomerAssociation.Id,
+		"test":              carCustomerAssociation.Test,
+	})
+}
+
+// newRentalCancelledOutboxEvent creates the outbox event recording the cancellation of a rental, rentals are owned by another service so the cancellations made here are published for it
+func newRentalCancelledOutboxEvent(ctx context.Context, carCustomerAssociation CarCustomerAssociation) (OutboxEvent, error) {
+	return newRentalOutboxEvent(ctx, dto.EventTypeRentalCancelled, carCustomerAssociation, map[string]interface{}{
+		"car_id":      carCustomerAssociation.CarId,
+		"customer_id": carCustomerAssociation.CustomerId,
+		"id":          carCustomerAssociation.Id,
+		"test":        carCustomerAssociation.Test,
+	})
+}
+
+func newRentalOutboxEvent(ctx context.Context, eventType string, carCustomerAssociation CarCustomerAssociation, data map[string]interface{}) (OutboxEvent, error) {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return OutboxEvent{}, lib_errors.Wrap(err, "Failed marshalling event data")
+	}
+
+	return OutboxEvent{
+		AggregateId:   carCustomerAssociation.Id,
+		CorrelationId: lib_context.CorrelationId(ctx),
+		Data:          spanner.NullString{StringVal: string(dataBytes), Valid: true},
+		DateCreated:   spanner.CommitTimestamp,
+		EventType:     eventType,
+		OutboxEventId: uuid.New().String(),
+		TenantId:      carCustomerAssociation.TenantId,
+		Test:          carCustomerAssociation.Test,
+	}, nil
+}
+
+// ReadOutboxEventsUnpublished reads the oldest events that have not been published, in the order they were committed
+func (c client) ReadOutboxEventsUnpublished(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtInt("limit", limit))
+
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			WHERE date_published IS NULL
+			ORDER BY date_created, outbox_event_id
+			LIMIT %d
+		`,
+			strings.Join(OutboxEventColumns, ", "),
+			tableOutboxEvent,
+			limit,
+		),
+	}
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := c.spannerClient.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var outboxEvents []OutboxEvent
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, lib_errors.Wrap(err, "Failed iterating outbox event")
+		}
+
+		var outboxEvent OutboxEvent
+		if err := row.ToStruct(&outboxEvent); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading outbox event")
+		}
+
+		outboxEvents = append(outboxEvents, outboxEvent)
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(outboxEvents)", len(outboxEvents)))
+	return outboxEvents, nil
+}
+
+func (c client) UpdateOutboxEventsPublished(ctx context.Context, outboxEventIds []string) error {
+	lib_log.Info(ctx, "Updating", lib_log.FmtInt("len(outboxEventIds)", len(outboxEventIds)))
+
+	var mutations []*spanner.Mutation
+	for _, v := range outboxEventIds {
+		mutations = append(mutations, spanner.UpdateMap(tableOutboxEvent, map[string]interface{}{
+			"date_published":  spanner.CommitTimestamp,
+			"outbox_event_id": v,
+		}))
+	}
+	if len(mutations) == 0 {
+		return nil
+	}
+
+	if _, err := c.spannerClient.Apply(ctx, mutations); err != nil {
+		return lib_spanner.WrapError(err, "Failed applying outbox event mutations")
+	}
+
+	lib_log.Info(ctx, "Updated", lib_log.FmtInt("len(outboxEventIds)", len(outboxEventIds)))
+	return nil
+}
@@ -0,0 +1,540 @@
+package spanner
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/lib/pq"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+const (
+	// postgresCommitLockId is the advisory lock a read write transaction holds from taking its commit timestamp until it commits, so that commit timestamps increase in commit order as they do in Spanner
+	postgresCommitLockId = 4051
+
+	// postgresReadWriteAttempts limits the attempts of a read write transaction that fails to serialize, as Spanner retries an aborted transaction
+	postgresReadWriteAttempts = 10
+
+	postgresErrorCodeDeadlockDetected     = "40P01"
+	postgresErrorCodeSerializationFailure = "40001"
+	postgresErrorCodeUniqueViolation      = "23505"
+)
+
+// PostgresClient keeps the tables in a PostgreSQL database with the schema of scripts/postgres, it is a second implementation of Client for deployments without Spanner.
+// A read write transaction is serializable and its writes are applied when it has finished reading, so that as with Spanner the reads of a transaction do not see its own writes.
+type PostgresClient struct {
+	config Config
+	db     *sql.DB
+}
+
+// postgresWrite applies a write of a transaction at its commit timestamp
+type postgresWrite func(ctx context.Context, tx *sql.Tx, dateCommitted time.Time) error
+
+// postgresQueryer is a database or a transaction
+type postgresQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func NewPostgresClient(ctx context.Context, config Config) (*PostgresClient, error) {
+	// The data source name is not logged as it holds the password of the database
+	lib_log.Info(ctx, "Initializing", lib_log.FmtDuration("config.IdempotencyKeyTtl", config.IdempotencyKeyTtl), lib_log.FmtInt("config.ImportChunkSize", config.ImportChunkSize))
+
+	db, err := sql.Open("postgres", config.PostgresDataSourceName)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed opening postgres database")
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, lib_errors.Wrap(err, "Failed pinging postgres database")
+	}
+
+	lib_log.Info(ctx, "Initialized")
+	return &PostgresClient{
+		config: config,
+		db:     db,
+	}, nil
+}
+
+func (c *PostgresClient) Close() {
+	c.db.Close()
+}
+
+func (c *PostgresClient) Ping(ctx context.Context) error {
+	var one int
+	if err := c.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return lib_errors.Wrap(err, "Failed querying select 1")
+	}
+	return nil
+}
+
+func (c *PostgresClient) ReadFleetCounts(ctx context.Context) (*FleetCounts, error) {
+	var fleetCounts FleetCounts
+	if err := c.db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT
+			(SELECT COUNT(*) FROM %[1]s WHERE test = false AND date_deleted IS NULL),
+			(SELECT COUNT(*) FROM %[1]s WHERE test = false AND date_deleted IS NOT NULL),
+			(SELECT COUNT(*) FROM %[2]s WHERE test = false AND date_cancelled IS NULL AND date_rental_start <= $1 AND date_rental_end > $1)
+	`,
+		tableCar,
+		tableCarCustomerAssociation,
+	), time.Now()).Scan(&fleetCounts.CarsActive, &fleetCounts.CarsDeleted, &fleetCounts.RentalsActive); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed querying fleet counts")
+	}
+	return &fleetCounts, nil
+}
+
+// readWrite executes the transaction and commits its writes, a transaction that fails to serialize is retried from the start so it must not have effects outside the database
+func (c *PostgresClient) readWrite(ctx context.Context, transaction func(tx *sql.Tx) ([]postgresWrite, error)) error {
+	for attempt := 1; ; attempt++ {
+		err := c.readWriteAttempt(ctx, transaction)
+		if err == nil {
+			return nil
+		}
+
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			switch pqErr.Code {
+			case postgresErrorCodeDeadlockDetected, postgresErrorCodeSerializationFailure:
+				if attempt < postgresReadWriteAttempts {
+					lib_log.Info(ctx, "Retrying read write transaction", lib_log.FmtInt("attempt", attempt), lib_log.FmtError(err))
+					continue
+				}
+			case postgresErrorCodeUniqueViolation:
+				return lib_errors.NewCustomWithCause(http.StatusConflict, "Already exist", err)
+			}
+		}
+		return err
+	}
+}
+
+func (c *PostgresClient) readWriteAttempt(ctx context.Context, transaction func(tx *sql.Tx) ([]postgresWrite, error)) error {
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return lib_errors.Wrap(err, "Failed beginning transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	writes, err := transaction(tx)
+	if err != nil {
+		return err
+	}
+
+	if len(writes) > 0 {
+		dateCommitted, err := readPostgresCommitTimestamp(ctx, tx)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading commit timestamp")
+		}
+		for _, write := range writes {
+			if err := write(ctx, tx, dateCommitted); err != nil {
+				return lib_errors.Wrap(err, "Failed writing")
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return lib_errors.Wrap(err, "Failed committing transaction")
+	}
+	return nil
+}
+
+// readOnly executes the reads in a read only transaction, so that they read a single snapshot as the reads of a Spanner read only transaction do
+func (c *PostgresClient) readOnly(ctx context.Context, read func(tx *sql.Tx) error) error {
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return lib_errors.Wrap(err, "Failed beginning transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := read(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return lib_errors.Wrap(err, "Failed committing transaction")
+	}
+	return nil
+}
+
+// readPostgresCommitTimestamp takes the commit lock, which is released when the transaction ends, and reads the commit timestamp of the transaction with the precision of Spanner
+func readPostgresCommitTimestamp(ctx context.Context, tx *sql.Tx) (time.Time, error) {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", postgresCommitLockId); err != nil {
+		return time.Time{}, lib_errors.Wrap(err, "Failed taking commit lock")
+	}
+	return readPostgresTimestamp(ctx, tx)
+}
+
+func readPostgresTimestamp(ctx context.Context, q postgresQueryer) (time.Time, error) {
+	rows, err := q.QueryContext(ctx, "SELECT date_trunc('microseconds', clock_timestamp())")
+	if err != nil {
+		return time.Time{}, lib_errors.Wrap(err, "Failed querying clock timestamp")
+	}
+	defer rows.Close()
+
+	var timestamp time.Time
+	if !rows.Next() {
+		return time.Time{}, lib_errors.New("Query returned no rows")
+	}
+	if err := rows.Scan(&timestamp); err != nil {
+		return time.Time{}, lib_errors.Wrap(err, "Failed scanning clock timestamp")
+	}
+	return timestamp.UTC(), nil
+}
+
+// postgresSelect appends the rows of the query to the slice pointed to by dst, the columns of the query are scanned into the fields of a row by their spanner tags
+func postgresSelect(ctx context.Context, q postgresQueryer, dst interface{}, columns []string, query string, args ...interface{}) error {
+	slice := reflect.ValueOf(dst).Elem()
+	return postgresEach(ctx, q, slice.Type().Elem(), columns, query, args, func(row reflect.Value) error {
+		slice.Set(reflect.Append(slice, row))
+		return nil
+	})
+}
+
+// postgresEach passes each row of the query to f as it is read, so that the result set is not buffered
+func postgresEach(ctx context.Context, q postgresQueryer, rowType reflect.Type, columns []string, query string, args []interface{}, f func(row reflect.Value) error) error {
+	lib_log.Info(ctx, "Reading", lib_log.FmtString("query", query))
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return lib_errors.Wrap(err, "Failed querying")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row := reflect.New(rowType).Elem()
+		dest, err := newPostgresColumns(row, columns)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating postgres columns")
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return lib_errors.Wrap(err, "Failed scanning row")
+		}
+		if err := f(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return lib_errors.Wrap(err, "Failed iterating rows")
+	}
+	return nil
+}
+
+// postgresSelectOne reads the row of the query into the struct pointed to by dst, a query without rows is not found
+func postgresSelectOne(ctx context.Context, q postgresQueryer, dst interface{}, columns []string, query string, args ...interface{}) error {
+	rows := reflect.New(reflect.SliceOf(reflect.TypeOf(dst).Elem()))
+	if err := postgresSelect(ctx, q, rows.Interface(), columns, query, args...); err != nil {
+		return lib_errors.Wrap(err, "Failed selecting")
+	}
+	if rows.Elem().Len() == 0 {
+		return lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+	reflect.ValueOf(dst).Elem().Set(rows.Elem().Index(0))
+	return nil
+}
+
+func readPostgresCount(ctx context.Context, q postgresQueryer, query string, args ...interface{}) (int64, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtString("query", query))
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed querying count")
+	}
+	defer rows.Close()
+
+	var count int64
+	if !rows.Next() {
+		return 0, lib_errors.New("Query returned no rows")
+	}
+	if err := rows.Scan(&count); err != nil {
+		return 0, lib_errors.Wrap(err, "Failed scanning count")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt64("count", count))
+	return count, nil
+}
+
+// readPostgresCountForPagination returns the pagination with the total of the count query
+func readPostgresCountForPagination(ctx context.Context, q postgresQueryer, pagination lib_pagination.Pagination, query string, args ...interface{}) (*lib_pagination.Pagination, error) {
+	count, err := readPostgresCount(ctx, q, query, args...)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading count")
+	}
+	pagination.Total = &count
+	timeNow := time.Now().UTC()
+	pagination.ReadTimestamp = &timeNow
+	return &pagination, nil
+}
+
+// newPostgresColumns returns the scan destinations of the columns in the fields of the row
+func newPostgresColumns(row reflect.Value, columns []string) ([]interface{}, error) {
+	fieldByColumn := make(map[string]reflect.Value)
+	for i := 0; i < row.NumField(); i++ {
+		if column := row.Type().Field(i).Tag.Get("spanner"); column != "" {
+			fieldByColumn[column] = row.Field(i)
+		}
+	}
+
+	var dest []interface{}
+	for _, column := range columns {
+		field, ok := fieldByColumn[column]
+		if !ok {
+			return nil, lib_errors.Errorf("Column %q not found in %s", column, row.Type())
+		}
+		dest = append(dest, postgresColumn{field: field})
+	}
+	return dest, nil
+}
+
+// postgresColumn scans a column into a field of the type it has in the spanner client, timestamps are read in UTC as they are from Spanner
+type postgresColumn struct {
+	field reflect.Value
+}
+
+//revive:disable:cyclomatic
+func (c postgresColumn) Scan(src interface{}) error {
+	switch field := c.field.Addr().Interface().(type) {
+	case *[]byte:
+		*field = nil
+		if src != nil {
+			b, ok := src.([]byte)
+			if !ok {
+				return lib_errors.Errorf("Cannot scan %T into []byte", src)
+			}
+			*field = append([]byte(nil), b...)
+		}
+
+	case *[]string:
+		return pq.Array(field).Scan(src)
+
+	case *bool, *spanner.NullBool:
+		var v sql.NullBool
+		if err := v.Scan(src); err != nil {
+			return err
+		}
+		if field, ok := field.(*spanner.NullBool); ok {
+			*field = spanner.NullBool{Bool: v.Bool, Valid: v.Valid}
+			return nil
+		}
+		*field.(*bool) = v.Bool
+
+	case *float64, *spanner.NullFloat64:
+		var v sql.NullFloat64
+		if err := v.Scan(src); err != nil {
+			return err
+		}
+		if field, ok := field.(*spanner.NullFloat64); ok {
+			*field = spanner.NullFloat64{Float64: v.Float64, Valid: v.Valid}
+			return nil
+		}
+		*field.(*float64) = v.Float64
+
+	case *int64, *spanner.NullInt64:
+		var v sql.NullInt64
+		if err := v.Scan(src); err != nil {
+			return err
+		}
+		if field, ok := field.(*spanner.NullInt64); ok {
+			*field = spanner.NullInt64{Int64: v.Int64, Valid: v.Valid}
+			return nil
+		}
+		*field.(*int64) = v.Int64
+
+	case *string, *spanner.NullString:
+		var v sql.NullString
+		if err := v.Scan(src); err != nil {
+			return err
+		}
+		if field, ok := field.(*spanner.NullString); ok {
+			*field = spanner.NullString{StringVal: v.String, Valid: v.Valid}
+			return nil
+		}
+		*field.(*string) = v.String
+
+	case *time.Time, *spanner.NullTime:
+		var v sql.NullTime
+		if err := v.Scan(src); err != nil {
+			return err
+		}
+		if field, ok := field.(*spanner.NullTime); ok {
+			*field = spanner.NullTime{Time: v.Time.UTC(), Valid: v.Valid}
+			return nil
+		}
+		*field.(*time.Time) = v.Time.UTC()
+
+	default:
+		return lib_errors.Errorf("Cannot scan into %T", field)
+	}
+	return nil
+	//revive:enable:cyclomatic
+}
+
+// postgresArg converts a value of the spanner client into an argument of a query, arrays are passed as PostgreSQL arrays and invalid null values as NULL
+func postgresArg(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []time.Time:
+		// pq does not encode arrays of timestamps, they are passed as text and cast by the column they are compared with
+		s := make([]string, len(v))
+		for i := range v {
+			s[i] = v[i].Format(time.RFC3339Nano)
+		}
+		return pq.Array(s)
+	case []bool, []float64, []int64, []string, [][]byte:
+		return pq.Array(v)
+	case civil.Date:
+		// pq does not encode dates, they are passed as text and cast by the column they are compared with
+		return v.String()
+	case spanner.NullBool:
+		return nullable(v.Bool, v.Valid)
+	case spanner.NullFloat64:
+		return nullable(v.Float64, v.Valid)
+	case spanner.NullInt64:
+		return nullable(v.Int64, v.Valid)
+	case spanner.NullString:
+		return nullable(v.StringVal, v.Valid)
+	case spanner.NullTime:
+		return nullable(v.Time, v.Valid)
+	}
+	return value
+}
+
+// postgresValues returns the columns of a row ordered by name and their values, the commit timestamp placeholders of the row are replaced with the commit timestamp
+func postgresValues(row interface{}, dateCommitted time.Time) ([]string, []interface{}) {
+	v := reflect.New(reflect.TypeOf(row))
+	v.Elem().Set(reflect.ValueOf(row))
+	withDateCommitted(v.Interface(), dateCommitted)
+
+	valueByColumn := inMemoryColumns(v.Elem().Interface())
+	var columns []string
+	for k := range valueByColumn {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		values[i] = postgresArg(valueByColumn[column])
+	}
+	return columns, values
+}
+
+// postgresInsert inserts the row, a row with the same key is a unique violation as it is with spanner.InsertStruct
+func postgresInsert(table string, row interface{}) postgresWrite {
+	return func(ctx context.Context, tx *sql.Tx, dateCommitted time.Time) error {
+		columns, values := postgresValues(row, dateCommitted)
+		placeholders := make([]string, len(columns))
+		for i := range columns {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), strings.Join(placeholders, ", ")), values...); err != nil {
+			return lib_errors.Wrapf(err, "Failed inserting into %s", table)
+		}
+		return nil
+	}
+}
+
+// postgresUpsert inserts the row or replaces the row with the same key, as spanner.InsertOrUpdateStruct does
+func postgresUpsert(table string, keyColumns []string, row interface{}) postgresWrite {
+	return func(ctx context.Context, tx *sql.Tx, dateCommitted time.Time) error {
+		columns, values := postgresValues(row, dateCommitted)
+		placeholders := make([]string, len(columns))
+		isKeyColumn := make(map[string]bool)
+		for _, v := range keyColumns {
+			isKeyColumn[v] = true
+		}
+		var sets []string
+		for i, column := range columns {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+			if !isKeyColumn[column] {
+				sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s", table, strings.Join(columns, ", "), strings.Join(placeholders, ", "), strings.Join(keyColumns, ", "), strings.Join(sets, ", ")), values...); err != nil {
+			return lib_errors.Wrapf(err, "Failed upserting into %s", table)
+		}
+		return nil
+	}
+}
+
+// postgresUpdate replaces the columns of the row with the key, the row must have been read for update by the transaction
+func postgresUpdate(table, keyColumn string, row interface{}) postgresWrite {
+	return func(ctx context.Context, tx *sql.Tx, dateCommitted time.Time) error {
+		columns, values := postgresValues(row, dateCommitted)
+		var sets []string
+		var key interface{}
+		var args []interface{}
+		for i, column := range columns {
+			if column == keyColumn {
+				key = values[i]
+				continue
+			}
+			args = append(args, values[i])
+			sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+		}
+		args = append(args, key)
+
+		result, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s WHERE %s = $%d", table, strings.Join(sets, ", "), keyColumn, len(args)), args...)
+		if err != nil {
+			return lib_errors.Wrapf(err, "Failed updating %s", table)
+		}
+		if count, err := result.RowsAffected(); err != nil || count == 0 {
+			return lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+		}
+		return nil
+	}
+}
+
+// The transforms do not read the database, they are those of the spanner client
+
+func (c *PostgresClient) TransformCarToJson(ctx context.Context, car Car, fields []string) ([]byte, error) {
+	return client{}.TransformCarToJson(ctx, car, fields)
+}
+
+func (c *PostgresClient) TransformCarsToJson(ctx context.Context, cars []Car, fields []string) ([]byte, error) {
+	return client{}.TransformCarsToJson(ctx, cars, fields)
+}
+
+func (c *PostgresClient) TransformCarHistoryToJson(ctx context.Context, carHistory []CarHistory) ([]byte, error) {
+	return client{}.TransformCarHistoryToJson(ctx, carHistory)
+}
+
+func (c *PostgresClient) TransformCustomerToJson(ctx context.Context, customer Customer, redactions map[string]lib_json.Redaction) ([]byte, error) {
+	return client{}.TransformCustomerToJson(ctx, customer, redactions)
+}
+
+func (c *PostgresClient) TransformWebhookSubscriptionsToJson(ctx context.Context, webhookSubscriptions []WebhookSubscription) ([]byte, error) {
+	return client{}.TransformWebhookSubscriptionsToJson(ctx, webhookSubscriptions)
+}
+
+func (c *PostgresClient) TransformWebhookDeliveriesToJson(ctx context.Context, webhookDeliveries []WebhookDelivery) ([]byte, error) {
+	return client{}.TransformWebhookDeliveriesToJson(ctx, webhookDeliveries)
+}
+
+func (c *PostgresClient) TransformApiKeysToJson(ctx context.Context, apiKeys []ApiKey) ([]byte, error) {
+	return client{}.TransformApiKeysToJson(ctx, apiKeys)
+}
+
+func (c *PostgresClient) TransformBrandClassAssociationToJson(ctx context.Context, carCustomerAssociation CarCustomerAssociation) ([]byte, error) {
+	return client{}.TransformBrandClassAssociationToJson(ctx, carCustomerAssociation)
+}
+
+func (c *PostgresClient) TransformBrandClassAssociationsToJson(ctx context.Context, carCustomerAssociations []CarCustomerAssociation) ([]byte, error) {
+	return client{}.TransformBrandClassAssociationsToJson(ctx, carCustomerAssociations)
+}
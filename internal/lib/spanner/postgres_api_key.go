@@ -0,0 +1,219 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+func (c *PostgresClient) CreateApiKey(ctx context.Context, apiKeyCreate dto.ApiKeyCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtString("apiKeyCreate.UserInput.Name", apiKeyCreate.UserInput.Name), lib_log.FmtString("apiKeyCreate.KeyPrefix", apiKeyCreate.KeyPrefix))
+
+	tenantId, err := newTenantId(ctx)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed getting new tenant id")
+	}
+
+	apiKeyId := uuid.New().String()
+	apiKey := ApiKey{
+		ApiKeyId:          apiKeyId,
+		Burst:             apiKeyCreate.UserInput.Burst,
+		DailyQuota:        apiKeyCreate.UserInput.DailyQuota,
+		DateCreated:       spanner.CommitTimestamp,
+		DateExpires:       apiKeyCreate.UserInput.DateExpires,
+		KeyHash:           apiKeyCreate.KeyHash,
+		KeyPrefix:         apiKeyCreate.KeyPrefix,
+		LineageApiKeyId:   spanner.NullString{StringVal: apiKeyId, Valid: true},
+		Name:              apiKeyCreate.UserInput.Name,
+		RequestsPerSecond: apiKeyCreate.UserInput.RequestsPerSecond,
+		Scopes:            apiKeyCreate.UserInput.Scopes,
+		TenantId:          tenantId,
+		Test:              apiKeyCreate.Test,
+	}
+	// A key hash that is not unique violates the unique index api_key_by_key_hash, which readWrite returns as a conflict
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		return []postgresWrite{postgresInsert(tableApiKey, apiKey)}, nil
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("apiKeyId", apiKey.ApiKeyId))
+	return apiKey.ApiKeyId, nil
+}
+
+func (c *PostgresClient) SearchApiKeys(ctx context.Context, apiKeysSearch dto.ApiKeysSearch) ([]ApiKey, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("apiKeysSearch", apiKeysSearch))
+
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("test = %s", where.arg(apiKeysSearch.Test)))
+
+	var apiKeys []ApiKey
+	var pagination *lib_pagination.Pagination
+	if err := c.readOnly(ctx, func(tx *sql.Tx) error {
+		apiKeys = nil
+		if err := postgresSelect(ctx, tx, &apiKeys, ApiKeyColumns, fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			%s
+			ORDER BY date_created %s, api_key_id
+			LIMIT %d
+			OFFSET %d
+		`,
+			strings.Join(ApiKeyColumns, ", "),
+			tableApiKey,
+			where,
+			apiKeysSearch.Pagination.Order,
+			apiKeysSearch.Pagination.Limit,
+			apiKeysSearch.Pagination.Offset,
+		), where.args...); err != nil {
+			return lib_errors.Wrap(err, "Failed selecting api keys")
+		}
+
+		var err error
+		pagination, err = readPostgresCountForPagination(ctx, tx, apiKeysSearch.Pagination, fmt.Sprintf("SELECT count(api_key_id) FROM %s %s", tableApiKey, where), where.args...)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading count for pagination")
+		}
+		return nil
+
+	}); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed executing read only transaction")
+	}
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(apiKeys)", len(apiKeys)), lib_log.FmtAny("pagination", pagination))
+	return apiKeys, pagination, nil
+}
+
+// ReadApiKeyByKeyHash is not constrained to a tenant as the tenant of the request is the tenant of its key
+func (c *PostgresClient) ReadApiKeyByKeyHash(ctx context.Context, keyHash string) (*ApiKey, error) {
+	lib_log.Info(ctx, "Reading")
+
+	var apiKey ApiKey
+	if err := postgresSelectOne(ctx, c.db, &apiKey, ApiKeyColumns, fmt.Sprintf("SELECT %s FROM %s WHERE key_hash = $1", strings.Join(ApiKeyColumns, ", "), tableApiKey), keyHash); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading api key")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtString("apiKey.ApiKeyId", apiKey.ApiKeyId))
+	return &apiKey, nil
+}
+
+func (c *PostgresClient) RotateApiKey(ctx context.Context, apiKeyRotate dto.ApiKeyRotate) (string, error) {
+	lib_log.Info(ctx, "Rotating", lib_log.FmtString("apiKeyRotate.Id", apiKeyRotate.Id), lib_log.FmtString("apiKeyRotate.KeyPrefix", apiKeyRotate.KeyPrefix), lib_log.FmtDuration("apiKeyRotate.Overlap", apiKeyRotate.Overlap))
+
+	apiKeyId := uuid.New().String()
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		apiKey, err := c.readApiKey(ctx, tx, apiKeyRotate.Id, apiKeyRotate.Test)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading api key")
+		}
+		now := time.Now()
+		if !apiKey.Usable(now) {
+			return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityApiKeyRevokedOrExpired)
+		}
+
+		writes := []postgresWrite{postgresInsert(tableApiKey, newRotatedApiKey(*apiKey, apiKeyId, apiKeyRotate))}
+
+		if dateOverlapEnd := now.Add(apiKeyRotate.Overlap); dateOverlapEnd.Before(apiKey.DateExpires) {
+			apiKey.DateExpires = dateOverlapEnd
+			apiKey.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+			writes = append(writes, postgresUpdate(tableApiKey, "api_key_id", *apiKey))
+		}
+
+		return writes, nil
+
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed rotating api key")
+	}
+
+	lib_log.Info(ctx, "Rotated", lib_log.FmtString("apiKeyId", apiKeyId))
+	return apiKeyId, nil
+}
+
+func (c *PostgresClient) RevokeApiKey(ctx context.Context, apiKeyRevoke dto.ApiKeyRevoke) error {
+	lib_log.Info(ctx, "Revoking", lib_log.FmtAny("apiKeyRevoke", apiKeyRevoke))
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		apiKey, err := c.readApiKey(ctx, tx, apiKeyRevoke.Id, apiKeyRevoke.Test)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading api key")
+		}
+		if apiKey.DateRevoked.Valid {
+			lib_log.Info(ctx, "Api key already revoked", lib_log.FmtTime("apiKey.DateRevoked.Time", apiKey.DateRevoked.Time))
+			return nil, nil
+		}
+
+		apiKey.DateRevoked = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		apiKey.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		return []postgresWrite{postgresUpdate(tableApiKey, "api_key_id", *apiKey)}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed revoking api key")
+	}
+
+	lib_log.Info(ctx, "Revoked")
+	return nil
+}
+
+func (c *PostgresClient) ConsumeApiKeyQuota(ctx context.Context, lineageApiKeyId string, day civil.Date, dailyQuota int64) (int64, error) {
+	lib_log.Info(ctx, "Consuming", lib_log.FmtString("lineageApiKeyId", lineageApiKeyId), lib_log.FmtString("day", day.String()), lib_log.FmtInt64("dailyQuota", dailyQuota))
+
+	var used int64
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		var apiKeyQuotaUsage ApiKeyQuotaUsage
+		if err := postgresSelectOne(ctx, tx, &apiKeyQuotaUsage, []string{"used"}, fmt.Sprintf("SELECT used FROM %s WHERE lineage_api_key_id = $1 AND day = $2 FOR UPDATE", tableApiKeyQuotaUsage), lineageApiKeyId, postgresArg(day)); err != nil && !lib_errors.IsCustomWithCode(err, http.StatusNotFound) {
+			return nil, lib_errors.Wrap(err, "Failed reading api key quota usage")
+		}
+		if apiKeyQuotaUsage.Used >= dailyQuota {
+			return nil, lib_errors.NewCustom(http.StatusTooManyRequests, constants.TooManyRequestsQuotaExceeded)
+		}
+		used = apiKeyQuotaUsage.Used + 1
+
+		return []postgresWrite{postgresUpsert(tableApiKeyQuotaUsage, []string{"lineage_api_key_id", "day"}, ApiKeyQuotaUsage{
+			DateUpdated:     spanner.CommitTimestamp,
+			Day:             day,
+			LineageApiKeyId: lineageApiKeyId,
+			Used:            used,
+		})}, nil
+
+	}); err != nil {
+		return 0, lib_errors.Wrap(err, "Failed consuming api key quota")
+	}
+
+	lib_log.Info(ctx, "Consumed", lib_log.FmtInt64("used", used))
+	return used, nil
+}
+
+// readApiKey reads and locks a key of the tenant of the caller
+func (c *PostgresClient) readApiKey(ctx context.Context, tx *sql.Tx, apiKeyId string, test bool) (*ApiKey, error) {
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("api_key_id = %s", where.arg(apiKeyId)))
+
+	var apiKey ApiKey
+	if err := postgresSelectOne(ctx, tx, &apiKey, ApiKeyColumns, fmt.Sprintf("SELECT %s FROM %s %s FOR UPDATE", strings.Join(ApiKeyColumns, ", "), tableApiKey, where), where.args...); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading api key")
+	}
+
+	if apiKey.Test != test {
+		return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+	}
+
+	return &apiKey, nil
+}
@@ -0,0 +1,1074 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+	lib_strings "github.com/tomwangsvc/lib-svc/strings"
+)
+
+func (c *PostgresClient) CreateCar(ctx context.Context, carCreate dto.CarCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtAny("carCreate", carCreate))
+
+	var carId string
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		if carCreate.IdempotencyKey != nil {
+			idempotentResponse, err := c.readIdempotentResponse(ctx, tx, *carCreate.IdempotencyKey)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed reading idempotent response")
+			}
+			if idempotentResponse != nil {
+				lib_log.Info(ctx, "Replaying idempotent response", lib_log.FmtAny("idempotentResponse", idempotentResponse))
+				carId = idempotentResponse.Location
+				return nil, nil
+			}
+		}
+
+		car, writes, err := c.newCarCreateWrites(ctx, tx, carCreate)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating car create writes")
+		}
+
+		if carCreate.IdempotencyKey != nil {
+			writeIdempotencyKey, err := c.newIdempotencyKeyWrite(ctx, *carCreate.IdempotencyKey, dto.IdempotentResponse{
+				Location:   car.CarId,
+				StatusCode: http.StatusCreated,
+			}, c.config.IdempotencyKeyTtl, carCreate.Test)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed creating idempotency key write")
+			}
+			writes = append(writes, writeIdempotencyKey)
+		}
+
+		carId = car.CarId
+		return writes, nil
+
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("carId", carId))
+	return carId, nil
+}
+
+func (c *PostgresClient) newCarCreateWrites(ctx context.Context, tx *sql.Tx, carCreate dto.CarCreate) (*Car, []postgresWrite, error) {
+	if err := checkCarCreate(ctx, carCreate); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed checking car create")
+	}
+
+	count, err := c.countCarsWithBrandAndModelName(ctx, tx, carCreate.UserInput.BrandName, spanner.NullString{StringVal: carCreate.UserInput.ModelName, Valid: true})
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed counting cars with brand and model name")
+	}
+	if count > 0 {
+		return nil, nil, lib_errors.NewCustom(http.StatusConflict, "Already exist")
+	}
+
+	car, err := newCar(ctx, carCreate)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating car")
+	}
+	writes, err := newPostgresCarInsertWrites(ctx, car)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating car insert writes")
+	}
+	return &car, writes, nil
+}
+
+// countCarsWithBrandAndModelName counts the cars of the tenant with the brand and model name that have not been soft deleted, a serializable transaction inserting a car fails to commit when a concurrent transaction has inserted the same names
+func (c *PostgresClient) countCarsWithBrandAndModelName(ctx context.Context, tx *sql.Tx, brandName string, modelName spanner.NullString) (int64, error) {
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("brand_name = %s AND model_name = %s AND %s", where.arg(brandName), where.arg(modelName), sqlWhereCarNotDeleted))
+
+	return readPostgresCount(ctx, tx, fmt.Sprintf("SELECT count(car_id) FROM %s %s", tableCar, where), where.args...)
+}
+
+func newPostgresCarInsertWrites(ctx context.Context, car Car) ([]postgresWrite, error) {
+	carHistory, outboxEvent, err := newCarChange(ctx, dto.CarHistoryOperationCreate, car.CarId, nil, &car, car.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating car change")
+	}
+	return []postgresWrite{postgresInsert(tableCar, car), postgresInsert(tableCarHistory, carHistory), postgresInsert(tableOutboxEvent, outboxEvent)}, nil
+}
+
+// readCarIncludingDeleted reads a car of the tenant of the caller and locks it until the transaction ends, a car of another tenant is not found
+func (c *PostgresClient) readCarIncludingDeleted(ctx context.Context, tx *sql.Tx, carId string) (*Car, error) {
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("car_id = %s", where.arg(carId)))
+
+	var car Car
+	if err := postgresSelectOne(ctx, tx, &car, CarColumns, fmt.Sprintf("SELECT %s FROM %s %s FOR UPDATE", strings.Join(CarColumns, ", "), tableCar, where), where.args...); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car")
+	}
+	return &car, nil
+}
+
+func (c *PostgresClient) readCar(ctx context.Context, tx *sql.Tx, carId string) (*Car, error) {
+	car, err := c.readCarIncludingDeleted(ctx, tx, carId)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car including deleted")
+	}
+
+	if car.DateDeleted.Valid {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+
+	return car, nil
+}
+
+// newPostgresCarsSearchWhere constrains a search to the tenant of the caller and excludes soft deleted cars unless they are included by the filters
+func newPostgresCarsSearchWhere(ctx context.Context, filters dto.CarsSearchFilters) (*postgresWhere, error) {
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	if !filters.IncludeDeleted {
+		where.and(sqlWhereCarNotDeleted)
+	}
+	if err := where.linkedFilters(CarColumns, filters.LinkedFilters); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed adding linked filters")
+	}
+	return where, nil
+}
+
+// SearchCars cannot search as of a time, PostgreSQL keeps no versions of rows so every time is outside the version retention
+func (c *PostgresClient) SearchCars(ctx context.Context, carsSearch dto.CarsSearch) ([]Car, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("carsSearch", carsSearch))
+
+	columns, err := carColumnsForFields(carsSearch.Fields)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed getting car columns for fields")
+	}
+	if carsSearch.AsOf != nil {
+		if err := checkAsOf(*carsSearch.AsOf, 0); err != nil {
+			return nil, nil, lib_errors.Wrap(err, "Failed checking as of")
+		}
+	}
+
+	where, err := newPostgresCarsSearchWhere(ctx, carsSearch.Filters)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating postgres cars search where")
+	}
+
+	var cars []Car
+	var pagination *lib_pagination.Pagination
+	if err := c.readOnly(ctx, func(tx *sql.Tx) error {
+		cars = nil
+		if err := postgresSelect(ctx, tx, &cars, columns, fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			%s
+			ORDER BY date_created %s, car_id
+			LIMIT %d
+			OFFSET %d
+		`,
+			strings.Join(columns, ", "),
+			tableCar,
+			where,
+			carsSearch.Pagination.Order,
+			carsSearch.Pagination.Limit,
+			carsSearch.Pagination.Offset,
+		), where.args...); err != nil {
+			return lib_errors.Wrap(err, "Failed selecting cars")
+		}
+
+		pagination, err = readPostgresCountForPagination(ctx, tx, carsSearch.Pagination, fmt.Sprintf("SELECT count(car_id) FROM %s %s", tableCar, where), where.args...)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading count for pagination")
+		}
+		return nil
+
+	}); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed executing read only transaction")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(cars)", len(cars)), lib_log.FmtAny("pagination", pagination))
+	return cars, pagination, nil
+}
+
+// ExportCars passes each car to exportCar as it is read, so that the result set is never buffered
+func (c *PostgresClient) ExportCars(ctx context.Context, carsExport dto.CarsExport, exportCar ExportCar) (int, error) {
+	lib_log.Info(ctx, "Exporting", lib_log.FmtAny("carsExport", carsExport))
+
+	columns, err := carExportColumnsForFields(carsExport.Fields)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed getting car export columns for fields")
+	}
+
+	where, err := newPostgresCarsSearchWhere(ctx, carsExport.Filters)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed creating postgres cars search where")
+	}
+
+	var count int
+	if err := postgresEach(ctx, c.db, reflect.TypeOf(Car{}), columns, fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		%s
+		ORDER BY date_created ASC, car_id ASC
+	`,
+		strings.Join(columns, ", "),
+		tableCar,
+		where,
+	), where.args, func(row reflect.Value) error {
+		if err := exportCar(row.Interface().(Car)); err != nil {
+			return lib_errors.Wrap(err, "Failed exporting car")
+		}
+		count++
+		return nil
+	}); err != nil {
+		return 0, lib_errors.Wrap(err, "Failed reading cars")
+	}
+
+	lib_log.Info(ctx, "Exported", lib_log.FmtInt("count", count))
+	return count, nil
+}
+
+// ReadCar cannot read as of a time, PostgreSQL keeps no versions of rows so every time is outside the version retention
+func (c *PostgresClient) ReadCar(ctx context.Context, carRead dto.CarRead) (*Car, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("carRead", carRead))
+
+	columns, err := carColumnsForFields(carRead.Fields)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting car columns for fields")
+	}
+	if carRead.AsOf != nil {
+		if err := checkAsOf(*carRead.AsOf, 0); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking as of")
+		}
+	}
+
+	if !carRead.IncludeDeleted && !lib_strings.Contains(columns, "date_deleted") {
+		columns = append(append([]string(nil), columns...), "date_deleted")
+	}
+	if !lib_strings.Contains(columns, columnTenantId) {
+		columns = append(append([]string(nil), columns...), columnTenantId)
+	}
+
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("car_id = %s", where.arg(carRead.Id)))
+
+	var car Car
+	if err := postgresSelectOne(ctx, c.db, &car, columns, fmt.Sprintf("SELECT %s FROM %s %s", strings.Join(columns, ", "), tableCar, where), where.args...); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car")
+	}
+
+	if !carRead.IncludeDeleted && car.DateDeleted.Valid {
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtAny("car", car))
+	return &car, nil
+}
+
+func (c *PostgresClient) UpdateCar(ctx context.Context, carUpdate dto.CarUpdate) error {
+	lib_log.Info(ctx, "Updating", lib_log.FmtAny("carUpdate", carUpdate))
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		return c.newCarUpdateWrites(ctx, tx, carUpdate)
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Updated", lib_log.FmtAny("carUpdate", carUpdate))
+	return nil
+}
+
+func (c *PostgresClient) newCarUpdateWrites(ctx context.Context, tx *sql.Tx, carUpdate dto.CarUpdate) ([]postgresWrite, error) {
+	car, err := c.readCarForUpdate(ctx, tx, carUpdate.Id, carUpdate.IfUnmodifiedSince, carUpdate.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car for update")
+	}
+
+	return newPostgresCarUpdatedWrites(ctx, dto.CarHistoryOperationUpdate, *car, newUpdatedCar(*car, carUpdate.UserInput))
+}
+
+func (c *PostgresClient) readCarForUpdate(ctx context.Context, tx *sql.Tx, carId string, ifUnmodifiedSince *time.Time, test bool) (*Car, error) {
+	car, err := c.readCar(ctx, tx, carId)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car")
+	}
+
+	if err := checkCarForUpdate(ctx, *car, ifUnmodifiedSince, test); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking car for update")
+	}
+
+	return car, nil
+}
+
+func newPostgresCarUpdatedWrites(ctx context.Context, operation string, car, updatedCar Car) ([]postgresWrite, error) {
+	carHistory, outboxEvent, err := newCarChange(ctx, operation, car.CarId, &car, &updatedCar, car.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating car change")
+	}
+
+	updatedCar.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+	return []postgresWrite{postgresUpdate(tableCar, "car_id", updatedCar), postgresInsert(tableCarHistory, carHistory), postgresInsert(tableOutboxEvent, outboxEvent)}, nil
+}
+
+func (c *PostgresClient) DeleteCar(ctx context.Context, carDelete dto.CarDelete) error {
+	lib_log.Info(ctx, "Deleting", lib_log.FmtAny("carDelete", carDelete))
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		return c.newCarDeleteWrites(ctx, tx, carDelete)
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Deleted", lib_log.FmtAny("carDelete", carDelete))
+	return nil
+}
+
+func (c *PostgresClient) newCarDeleteWrites(ctx context.Context, tx *sql.Tx, carDelete dto.CarDelete) ([]postgresWrite, error) {
+	car, err := c.readCar(ctx, tx, carDelete.Id)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car")
+	}
+
+	if err := checkCarAccess(ctx, *car, carDelete.Test); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed checking car access")
+	}
+
+	carHistory, outboxEvent, err := newCarChange(ctx, dto.CarHistoryOperationDelete, car.CarId, car, nil, car.Test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating car change")
+	}
+
+	deletedCar := *car
+	deletedCar.DateDeleted = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+	return []postgresWrite{postgresUpdate(tableCar, "car_id", deletedCar), postgresInsert(tableCarHistory, carHistory), postgresInsert(tableOutboxEvent, outboxEvent)}, nil
+}
+
+func (c *PostgresClient) PatchCar(ctx context.Context, carPatch dto.CarPatch, checkCar CheckCar) error {
+	lib_log.Info(ctx, "Patching", lib_log.FmtAny("carPatch", carPatch))
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		car, err := c.readCar(ctx, tx, carPatch.Id)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car")
+		}
+
+		if err := checkCarAccess(ctx, *car, carPatch.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking car access")
+		}
+
+		patchedCar, _, err := newPatchedCar(ctx, *car, carPatch, checkCar)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating patched car")
+		}
+
+		return newPostgresCarUpdatedWrites(ctx, dto.CarHistoryOperationPatch, *car, *patchedCar)
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Patched")
+	return nil
+}
+
+func (c *PostgresClient) RestoreCar(ctx context.Context, carRestore dto.CarRestore) error {
+	lib_log.Info(ctx, "Restoring", lib_log.FmtAny("carRestore", carRestore))
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		car, err := c.readCarIncludingDeleted(ctx, tx, carRestore.Id)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car including deleted")
+		}
+
+		if err := checkCarAccess(ctx, *car, carRestore.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking car access")
+		}
+
+		if !car.DateDeleted.Valid {
+			lib_log.Info(ctx, "Car not deleted, nothing to restore")
+			return nil, nil
+		}
+
+		count, err := c.countCarsWithBrandAndModelName(ctx, tx, car.BrandName, car.ModelName)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed counting cars with brand and model name")
+		}
+		if count > 0 {
+			return nil, lib_errors.NewCustom(http.StatusConflict, "Already exist")
+		}
+
+		carHistory, outboxEvent, err := newCarChange(ctx, dto.CarHistoryOperationRestore, car.CarId, nil, car, car.Test)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating car change")
+		}
+
+		restoredCar := *car
+		restoredCar.DateDeleted = spanner.NullTime{}
+		restoredCar.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		return []postgresWrite{postgresUpdate(tableCar, "car_id", restoredCar), postgresInsert(tableCarHistory, carHistory), postgresInsert(tableOutboxEvent, outboxEvent)}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Restored", lib_log.FmtAny("carRestore", carRestore))
+	return nil
+}
+
+// PurgeCars hard deletes the tombstones of the cars of every tenant soft deleted before the date with their rentals, history and outbox events
+func (c *PostgresClient) PurgeCars(ctx context.Context, dateDeletedBefore time.Time) (int64, error) {
+	lib_log.Info(ctx, "Purging", lib_log.FmtTime("dateDeletedBefore", dateDeletedBefore))
+
+	sqlWhere := "WHERE date_deleted IS NOT NULL AND date_deleted < $1"
+
+	var count int64
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		return []postgresWrite{func(ctx context.Context, tx *sql.Tx, dateCommitted time.Time) error {
+			for _, v := range []struct {
+				table  string
+				column string
+			}{
+				{table: tableCarCustomerAssociation, column: "car_id"},
+				{table: tableCarHistory, column: "car_id"},
+				{table: tableOutboxEvent, column: "aggregate_id"},
+			} {
+				if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s IN (SELECT car_id FROM %s %s)", v.table, v.column, tableCar, sqlWhere), dateDeletedBefore); err != nil {
+					return lib_errors.Wrapf(err, "Failed deleting rows of %s", v.table)
+				}
+			}
+			result, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s %s", tableCar, sqlWhere), dateDeletedBefore)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed deleting cars")
+			}
+			count, err = result.RowsAffected()
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed getting rows affected")
+			}
+			return nil
+		}}, nil
+	}); err != nil {
+		return 0, lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Purged", lib_log.FmtInt64("count", count))
+	return count, nil
+}
+
+func (c *PostgresClient) BatchCars(ctx context.Context, carsBatch dto.CarsBatch) ([]dto.CarsBatchResult, error) {
+	lib_log.Info(ctx, "Batching", lib_log.FmtString("carsBatch.Mode", carsBatch.Mode), lib_log.FmtInt("len(carsBatch.Operations)", len(carsBatch.Operations)))
+
+	var results []dto.CarsBatchResult
+	var err error
+	if carsBatch.Mode == dto.CarsBatchModeAllOrNothing {
+		results, err = c.batchCarsAllOrNothing(ctx, carsBatch)
+	} else {
+		results, err = batchCarsBestEffort(ctx, c, carsBatch)
+	}
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed batching cars")
+	}
+
+	lib_log.Info(ctx, "Batched", lib_log.FmtInt("len(results)", len(results)))
+	return results, nil
+}
+
+func (c *PostgresClient) batchCarsAllOrNothing(ctx context.Context, carsBatch dto.CarsBatch) ([]dto.CarsBatchResult, error) {
+	var results []dto.CarsBatchResult
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		results = nil
+
+		if carsBatch.IdempotencyKey != nil {
+			idempotentResponse, err := c.readIdempotentResponse(ctx, tx, *carsBatch.IdempotencyKey)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed reading idempotent response")
+			}
+			if idempotentResponse != nil {
+				lib_log.Info(ctx, "Replaying idempotent response", lib_log.FmtAny("idempotentResponse", idempotentResponse))
+				if err := json.Unmarshal(idempotentResponse.Body, &results); err != nil {
+					return nil, lib_errors.Wrap(err, "Failed unmarshalling idempotent response body into []dto.CarsBatchResult")
+				}
+				return nil, nil
+			}
+		}
+
+		// Writes are only applied once the reads are done, so the cars changed earlier in the batch are tracked to detect conflicts within the batch
+		changes := newCarsBatchChanges()
+
+		var writes []postgresWrite
+		for i, operation := range carsBatch.Operations {
+			result := dto.CarsBatchResult{
+				Index: i,
+			}
+
+			var operationWrites []postgresWrite
+			var err error
+			switch {
+			case operation.CarCreate != nil:
+				if err := changes.checkCreate(*operation.CarCreate); err != nil {
+					return nil, withCarsBatchOperationIndex(err, i)
+				}
+
+				var car *Car
+				car, operationWrites, err = c.newCarCreateWrites(ctx, tx, *operation.CarCreate)
+				if err == nil {
+					changes.addCreated(*operation.CarCreate, car.CarId)
+					result.CarId = car.CarId
+					result.Status = http.StatusCreated
+				}
+
+			case operation.CarUpdate != nil:
+				if err := changes.checkChange(operation.CarUpdate.Id); err != nil {
+					return nil, withCarsBatchOperationIndex(err, i)
+				}
+				operationWrites, err = c.newCarUpdateWrites(ctx, tx, *operation.CarUpdate)
+				result.CarId = operation.CarUpdate.Id
+				result.Status = http.StatusNoContent
+
+			case operation.CarDelete != nil:
+				if err := changes.checkChange(operation.CarDelete.Id); err != nil {
+					return nil, withCarsBatchOperationIndex(err, i)
+				}
+				operationWrites, err = c.newCarDeleteWrites(ctx, tx, *operation.CarDelete)
+				if err == nil {
+					changes.addDeleted(operation.CarDelete.Id)
+				}
+				result.CarId = operation.CarDelete.Id
+				result.Status = http.StatusNoContent
+
+			default:
+				err = lib_errors.New("Operation has no car create, update or delete")
+			}
+			if err != nil {
+				return nil, withCarsBatchOperationIndex(lib_errors.Wrapf(err, "Failed creating writes for operation %d", i), i)
+			}
+
+			writes = append(writes, operationWrites...)
+			results = append(results, result)
+		}
+
+		if carsBatch.IdempotencyKey != nil {
+			idempotentResponse, err := newCarsBatchIdempotentResponse(results)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed creating cars batch idempotent response")
+			}
+			writeIdempotencyKey, err := c.newIdempotencyKeyWrite(ctx, *carsBatch.IdempotencyKey, *idempotentResponse, c.config.IdempotencyKeyTtl, carsBatch.Test)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed creating idempotency key write")
+			}
+			writes = append(writes, writeIdempotencyKey)
+		}
+
+		return writes, nil
+
+	}); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	return results, nil
+}
+
+// readIdempotentResponse returns the stored response for a retry of the same request, nil is returned when the key has not been used or has expired
+func (c *PostgresClient) readIdempotentResponse(ctx context.Context, q postgresQueryer, idempotencyKey dto.IdempotencyKey) (*dto.IdempotentResponse, error) {
+	id, err := newIdempotencyKeyId(ctx, idempotencyKey)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating idempotency key id")
+	}
+
+	var storedIdempotencyKey IdempotencyKey
+	if err := postgresSelectOne(ctx, q, &storedIdempotencyKey, IdempotencyKeyColumns, fmt.Sprintf("SELECT %s FROM %s WHERE idempotency_key = $1", strings.Join(IdempotencyKeyColumns, ", "), tableIdempotencyKey), id); err != nil {
+		if lib_errors.IsCustomWithCode(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, lib_errors.Wrap(err, "Failed reading idempotency key")
+	}
+	return newIdempotentResponse(ctx, storedIdempotencyKey, idempotencyKey)
+}
+
+func (c *PostgresClient) newIdempotencyKeyWrite(ctx context.Context, idempotencyKey dto.IdempotencyKey, idempotentResponse dto.IdempotentResponse, ttl time.Duration, test bool) (postgresWrite, error) {
+	storedIdempotencyKey, err := newIdempotencyKey(ctx, idempotencyKey, idempotentResponse, ttl, test)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating idempotency key")
+	}
+	return postgresUpsert(tableIdempotencyKey, idempotencyKeyKeyColumns, *storedIdempotencyKey), nil
+}
+
+// ClaimIdempotencyKey returns the stored response for a retry of the same request, otherwise the key is stored as pending so that a concurrent retry is rejected until the key is completed, released or its pending ttl expires
+func (c *PostgresClient) ClaimIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, test bool) (*dto.IdempotentResponse, error) {
+	lib_log.Info(ctx, "Claiming", lib_log.FmtAny("idempotencyKey", idempotencyKey))
+
+	var idempotentResponse *dto.IdempotentResponse
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		var err error
+		idempotentResponse, err = c.readIdempotentResponse(ctx, tx, idempotencyKey)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading idempotent response")
+		}
+		if idempotentResponse != nil {
+			return nil, nil
+		}
+
+		writeIdempotencyKey, err := c.newIdempotencyKeyWrite(ctx, idempotencyKey, dto.IdempotentResponse{StatusCode: idempotencyKeyPendingStatusCode}, c.config.idempotencyKeyPendingTtl(), test)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating idempotency key write")
+		}
+		return []postgresWrite{writeIdempotencyKey}, nil
+
+	}); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Claimed", lib_log.FmtAny("idempotentResponse", idempotentResponse))
+	return idempotentResponse, nil
+}
+
+// CompleteIdempotencyKey stores the response against a claimed key so that it is replayed for retries
+func (c *PostgresClient) CompleteIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey, idempotentResponse dto.IdempotentResponse, test bool) error {
+	lib_log.Info(ctx, "Completing", lib_log.FmtAny("idempotencyKey", idempotencyKey), lib_log.FmtInt("idempotentResponse.StatusCode", idempotentResponse.StatusCode))
+
+	writeIdempotencyKey, err := c.newIdempotencyKeyWrite(ctx, idempotencyKey, idempotentResponse, c.config.IdempotencyKeyTtl, test)
+	if err != nil {
+		return lib_errors.Wrap(err, "Failed creating idempotency key write")
+	}
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		return []postgresWrite{writeIdempotencyKey}, nil
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Completed")
+	return nil
+}
+
+// ReleaseIdempotencyKey deletes a claimed key, so that a request that failed can be retried with the same key
+func (c *PostgresClient) ReleaseIdempotencyKey(ctx context.Context, idempotencyKey dto.IdempotencyKey) error {
+	lib_log.Info(ctx, "Releasing", lib_log.FmtAny("idempotencyKey", idempotencyKey))
+
+	id, err := newIdempotencyKeyId(ctx, idempotencyKey)
+	if err != nil {
+		return lib_errors.Wrap(err, "Failed creating idempotency key id")
+	}
+	if _, err := c.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE idempotency_key = $1", tableIdempotencyKey), id); err != nil {
+		return lib_errors.Wrap(err, "Failed deleting idempotency key")
+	}
+
+	lib_log.Info(ctx, "Released")
+	return nil
+}
+
+// ImportCars creates the cars in chunks committed in their own transactions, as the spanner client does
+func (c *PostgresClient) ImportCars(ctx context.Context, carsImportCars []dto.CarsImportCar) ([]dto.CarsImportReportRow, error) {
+	lib_log.Info(ctx, "Importing", lib_log.FmtInt("len(carsImportCars)", len(carsImportCars)), lib_log.FmtInt("c.config.ImportChunkSize", c.config.ImportChunkSize))
+
+	chunkSize := c.config.ImportChunkSize
+	if chunkSize <= 0 {
+		chunkSize = len(carsImportCars)
+	}
+
+	var rows []dto.CarsImportReportRow
+	for start := 0; start < len(carsImportCars); start += chunkSize {
+		end := start + chunkSize
+		if end > len(carsImportCars) {
+			end = len(carsImportCars)
+		}
+
+		chunkRows, err := c.importCarsChunk(ctx, carsImportCars[start:end])
+		if err != nil {
+			return nil, lib_errors.Wrapf(err, "Failed importing chunk starting at %d", start)
+		}
+		rows = append(rows, chunkRows...)
+	}
+
+	lib_log.Info(ctx, "Imported", lib_log.FmtInt("len(rows)", len(rows)))
+	return rows, nil
+}
+
+func (c *PostgresClient) importCarsChunk(ctx context.Context, carsImportCars []dto.CarsImportCar) ([]dto.CarsImportReportRow, error) {
+	var rows []dto.CarsImportReportRow
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		rows = nil
+
+		existing, err := c.readExistingBrandAndModelNames(ctx, tx, carsImportCars)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading existing brand and model names")
+		}
+
+		var writes []postgresWrite
+		for _, v := range carsImportCars {
+			if existing[brandAndModelNameKey(v.CarCreate.UserInput.BrandName, v.CarCreate.UserInput.ModelName)] {
+				rows = append(rows, dto.CarsImportReportRow{
+					Errors: []lib_errors.Item{{Message: "Already exist"}},
+					Number: v.Number,
+					Status: http.StatusConflict,
+				})
+				continue
+			}
+
+			car, err := newCar(ctx, v.CarCreate)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed creating car")
+			}
+			carWrites, err := newPostgresCarInsertWrites(ctx, car)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed creating car insert writes")
+			}
+			writes = append(writes, carWrites...)
+
+			rows = append(rows, dto.CarsImportReportRow{
+				CarId:  car.CarId,
+				Number: v.Number,
+				Status: http.StatusCreated,
+			})
+		}
+
+		return writes, nil
+
+	}); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	return rows, nil
+}
+
+// readExistingBrandAndModelNames returns the keys of the existing cars matching the brand and model names of the cars, names are matched exactly as they are when a single car is created
+func (c *PostgresClient) readExistingBrandAndModelNames(ctx context.Context, tx *sql.Tx, carsImportCars []dto.CarsImportCar) (map[string]bool, error) {
+	var brandNames []string
+	for _, v := range carsImportCars {
+		brandNames = append(brandNames, v.CarCreate.UserInput.BrandName)
+	}
+
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("brand_name = ANY(%s) AND %s", where.arg(brandNames), sqlWhereCarNotDeleted))
+
+	var cars []Car
+	if err := postgresSelect(ctx, tx, &cars, []string{"brand_name", "model_name"}, fmt.Sprintf("SELECT brand_name, model_name FROM %s %s", tableCar, where), where.args...); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed selecting cars")
+	}
+
+	existing := make(map[string]bool)
+	for _, v := range cars {
+		existing[brandAndModelNameKey(v.BrandName, v.ModelName.StringVal)] = true
+	}
+	return existing, nil
+}
+
+func (c *PostgresClient) CreateCarsImport(ctx context.Context, carsImportReport dto.CarsImportReport, test bool) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtInt("carsImportReport.RowsTotal", carsImportReport.RowsTotal))
+
+	tenantId, err := newTenantId(ctx)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed getting new tenant id")
+	}
+
+	carsImportReport.CarsImportId = uuid.New().String()
+	writes := []postgresWrite{postgresInsert(tableCarsImport, CarsImport{
+		CarsImportId: carsImportReport.CarsImportId,
+		DateCreated:  spanner.CommitTimestamp,
+		RowsFailed:   int64(carsImportReport.RowsFailed),
+		RowsImported: int64(carsImportReport.RowsImported),
+		RowsTotal:    int64(carsImportReport.RowsTotal),
+		TenantId:     tenantId,
+		Test:         test,
+	})}
+	for _, v := range carsImportReport.Rows {
+		carsImportReportRow, err := newCarsImportReportRow(carsImportReport.CarsImportId, v)
+		if err != nil {
+			return "", lib_errors.Wrap(err, "Failed creating cars import report row")
+		}
+		writes = append(writes, postgresInsert(tableCarsImportReportRow, *carsImportReportRow))
+	}
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		return writes, nil
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("carsImportReport.CarsImportId", carsImportReport.CarsImportId))
+	return carsImportReport.CarsImportId, nil
+}
+
+func (c *PostgresClient) ReadCarsImportReport(ctx context.Context, carsImportReportRead dto.CarsImportReportRead) (*dto.CarsImportReport, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("carsImportReportRead", carsImportReportRead))
+
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("cars_import_id = %s", where.arg(carsImportReportRead.Id)))
+
+	var carsImport CarsImport
+	if err := postgresSelectOne(ctx, c.db, &carsImport, CarsImportColumns, fmt.Sprintf("SELECT %s FROM %s %s", strings.Join(CarsImportColumns, ", "), tableCarsImport, where), where.args...); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading cars import")
+	}
+
+	if carsImport.Test != carsImportReportRead.Test {
+		return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+	}
+
+	if carsImport.Report != nil {
+		var carsImportReport dto.CarsImportReport
+		if err := json.Unmarshal(carsImport.Report, &carsImportReport); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed unmarshalling cars import report")
+		}
+		lib_log.Info(ctx, "Read", lib_log.FmtInt("carsImportReport.RowsTotal", carsImportReport.RowsTotal))
+		return &carsImportReport, nil
+	}
+
+	var carsImportReportRows []CarsImportReportRow
+	if err := postgresSelect(ctx, c.db, &carsImportReportRows, CarsImportReportRowColumns, fmt.Sprintf("SELECT %s FROM %s WHERE cars_import_id = $1 ORDER BY number", strings.Join(CarsImportReportRowColumns, ", "), tableCarsImportReportRow), carsImport.CarsImportId); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed selecting cars import report rows")
+	}
+
+	carsImportReport := dto.CarsImportReport{
+		CarsImportId: carsImport.CarsImportId,
+		RowsFailed:   int(carsImport.RowsFailed),
+		RowsImported: int(carsImport.RowsImported),
+		RowsTotal:    int(carsImport.RowsTotal),
+	}
+	for _, v := range carsImportReportRows {
+		carsImportReportRow, err := newDtoCarsImportReportRow(v)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating dto cars import report row")
+		}
+		carsImportReport.Rows = append(carsImportReport.Rows, *carsImportReportRow)
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("carsImportReport.RowsTotal", carsImportReport.RowsTotal))
+	return &carsImportReport, nil
+}
+
+func (c *PostgresClient) SearchCarHistory(ctx context.Context, carHistorySearch dto.CarHistorySearch) ([]CarHistory, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("carHistorySearch", carHistorySearch))
+
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("car_id = %s AND test = %s", where.arg(carHistorySearch.CarId), where.arg(carHistorySearch.Test)))
+
+	var carHistory []CarHistory
+	var pagination *lib_pagination.Pagination
+	if err := c.readOnly(ctx, func(tx *sql.Tx) error {
+		carHistory = nil
+		if err := postgresSelect(ctx, tx, &carHistory, CarHistoryColumns, fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			%s
+			ORDER BY date_created %s, car_history_id
+			LIMIT %d
+			OFFSET %d
+		`,
+			strings.Join(CarHistoryColumns, ", "),
+			tableCarHistory,
+			where,
+			carHistorySearch.Pagination.Order,
+			carHistorySearch.Pagination.Limit,
+			carHistorySearch.Pagination.Offset,
+		), where.args...); err != nil {
+			return lib_errors.Wrap(err, "Failed selecting car history")
+		}
+
+		var err error
+		pagination, err = readPostgresCountForPagination(ctx, tx, carHistorySearch.Pagination, fmt.Sprintf("SELECT count(car_history_id) FROM %s %s", tableCarHistory, where), where.args...)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading count for pagination")
+		}
+		return nil
+
+	}); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed executing read only transaction")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carHistory)", len(carHistory)), lib_log.FmtAny("pagination", pagination))
+	return carHistory, pagination, nil
+}
+
+func (c *PostgresClient) RevertCar(ctx context.Context, carRevert dto.CarRevert) error {
+	lib_log.Info(ctx, "Reverting", lib_log.FmtAny("carRevert", carRevert))
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		car, err := c.readCarForUpdate(ctx, tx, carRevert.Id, carRevert.IfUnmodifiedSince, carRevert.Test)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car for update")
+		}
+
+		carHistory, err := c.readCarHistoryForRevert(ctx, tx, carRevert)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car history for revert")
+		}
+
+		revertedCar, err := newRevertedCar(*car, *carHistory)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating reverted car")
+		}
+
+		return newPostgresCarUpdatedWrites(ctx, dto.CarHistoryOperationRevert, *car, *revertedCar)
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Reverted")
+	return nil
+}
+
+// readCarHistoryForRevert reads the history row requested by id, or the latest history row at the requested date, history rows are never updated so they are not locked
+func (c *PostgresClient) readCarHistoryForRevert(ctx context.Context, tx *sql.Tx, carRevert dto.CarRevert) (*CarHistory, error) {
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("car_id = %s", where.arg(carRevert.Id)))
+
+	var orderBy string
+	switch {
+	case carRevert.UserInput.CarHistoryId != nil:
+		where.and(fmt.Sprintf("car_history_id = %s", where.arg(*carRevert.UserInput.CarHistoryId)))
+	case carRevert.UserInput.Date != nil:
+		where.and(fmt.Sprintf("date_created <= %s", where.arg(*carRevert.UserInput.Date)))
+		orderBy = "ORDER BY date_created DESC LIMIT 1"
+	default:
+		return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+
+	var carHistory CarHistory
+	if err := postgresSelectOne(ctx, tx, &carHistory, CarHistoryColumns, fmt.Sprintf("SELECT %s FROM %s %s %s", strings.Join(CarHistoryColumns, ", "), tableCarHistory, where, orderBy), where.args...); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading car history")
+	}
+	return &carHistory, nil
+}
+
+// ReadCarChanges reads the history rows committed after the since token in commit order, when no since token is requested the feed starts at the read timestamp.
+// The reads hold the commit lock shared so that no transaction is between taking its commit timestamp and committing, a later commit therefore has a later timestamp than any row read.
+func (c *PostgresClient) ReadCarChanges(ctx context.Context, carChangesRead dto.CarChangesRead) ([]CarHistory, *dto.CarChangesToken, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("carChangesRead", carChangesRead))
+
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted, ReadOnly: true})
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed beginning transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock_shared($1)", postgresCommitLockId); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed taking commit lock shared")
+	}
+
+	if carChangesRead.Since == nil {
+		readTimestamp, err := readPostgresTimestamp(ctx, tx)
+		if err != nil {
+			return nil, nil, lib_errors.Wrap(err, "Failed reading current timestamp")
+		}
+		lib_log.Info(ctx, "Read", lib_log.FmtAny("readTimestamp", readTimestamp))
+		return nil, &dto.CarChangesToken{DateCreated: readTimestamp}, nil
+	}
+	since := *carChangesRead.Since
+
+	dateCreated := where.arg(since.DateCreated)
+	where.and(fmt.Sprintf("test = %s AND (date_created > %s OR (date_created = %s AND car_history_id > %s))", where.arg(carChangesRead.Test), dateCreated, dateCreated, where.arg(since.CarHistoryId)))
+
+	columns := []string{"car_history_id", "car_id", "date_created", "operation"}
+	var carHistory []CarHistory
+	if err := postgresSelect(ctx, tx, &carHistory, columns, fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		%s
+		ORDER BY date_created, car_history_id
+		LIMIT %d
+	`,
+		strings.Join(columns, ", "),
+		tableCarHistory,
+		where,
+		carChangesRead.Pagination.Limit,
+	), where.args...); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed selecting car changes")
+	}
+
+	next := since
+	for _, v := range carHistory {
+		next = dto.CarChangesToken{
+			CarHistoryId: v.CarHistoryId,
+			DateCreated:  v.DateCreated,
+		}
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carHistory)", len(carHistory)), lib_log.FmtAny("next", next))
+	return carHistory, &next, nil
+}
+
+func (c *PostgresClient) ReadOutboxEventsUnpublished(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtInt("limit", limit))
+
+	var outboxEvents []OutboxEvent
+	if err := postgresSelect(ctx, c.db, &outboxEvents, OutboxEventColumns, fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		WHERE date_published IS NULL
+		ORDER BY date_created, outbox_event_id
+		LIMIT %d
+	`,
+		strings.Join(OutboxEventColumns, ", "),
+		tableOutboxEvent,
+		limit,
+	)); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed selecting outbox events")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(outboxEvents)", len(outboxEvents)))
+	return outboxEvents, nil
+}
+
+func (c *PostgresClient) UpdateOutboxEventsPublished(ctx context.Context, outboxEventIds []string) error {
+	lib_log.Info(ctx, "Updating", lib_log.FmtInt("len(outboxEventIds)", len(outboxEventIds)))
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		count, err := readPostgresCount(ctx, tx, fmt.Sprintf("SELECT count(*) FROM (SELECT outbox_event_id FROM %s WHERE outbox_event_id = ANY($1) FOR UPDATE) AS locked", tableOutboxEvent), pq.Array(outboxEventIds))
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading count of outbox events")
+		}
+		if count != int64(len(outboxEventIds)) {
+			return nil, lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+		}
+
+		return []postgresWrite{func(ctx context.Context, tx *sql.Tx, dateCommitted time.Time) error {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET date_published = $1 WHERE outbox_event_id = ANY($2)", tableOutboxEvent), dateCommitted, pq.Array(outboxEventIds)); err != nil {
+				return lib_errors.Wrap(err, "Failed updating outbox events")
+			}
+			return nil
+		}}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Updated", lib_log.FmtInt("len(outboxEventIds)", len(outboxEventIds)))
+	return nil
+}
@@ -0,0 +1,191 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/lib/pq"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+func (c *PostgresClient) ReadCustomer(ctx context.Context, customerRead dto.CustomerRead) (*Customer, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("customerRead", customerRead))
+
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("customer_id = %s", where.arg(customerRead.Id)))
+
+	var customer Customer
+	if err := postgresSelectOne(ctx, c.db, &customer, CustomerColumns, fmt.Sprintf("SELECT %s FROM %s %s", strings.Join(CustomerColumns, ", "), tableCustomer, where), where.args...); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading customer")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtAny("customer", customer))
+	return &customer, nil
+}
+
+// BlockCustomer cancels the rentals of the customer that have not started and blocks new ones, the pubsub message is recorded in the same transaction so that a redelivery has no effect
+func (c *PostgresClient) BlockCustomer(ctx context.Context, customerEvent dto.CustomerEvent) error {
+	lib_log.Info(ctx, "Blocking", lib_log.FmtAny("customerEvent", customerEvent))
+
+	var countCancelled int
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		countCancelled = 0
+
+		count, err := readPostgresCount(ctx, tx, fmt.Sprintf("SELECT count(pubsub_message_id) FROM %s WHERE pubsub_message_id = $1", tablePubsubMessage), customerEvent.PubsubMessageId)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading count of pubsub message")
+		}
+		if count > 0 {
+			lib_log.Info(ctx, "Pubsub message already consumed", lib_log.FmtString("customerEvent.PubsubMessageId", customerEvent.PubsubMessageId))
+			return nil, nil
+		}
+
+		carCustomerAssociations, err := readPostgresCarCustomerAssociationsNotStarted(ctx, tx, customerEvent.CustomerId)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car customer associations not started")
+		}
+		countCancelled = len(carCustomerAssociations)
+
+		var carCustomerAssociationIds []string
+		var writes []postgresWrite
+		for _, v := range carCustomerAssociations {
+			outboxEvent, err := newRentalCancelledOutboxEvent(ctx, v)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed creating rental cancelled outbox event")
+			}
+			carCustomerAssociationIds = append(carCustomerAssociationIds, v.Id)
+			writes = append(writes, postgresInsert(tableOutboxEvent, outboxEvent))
+		}
+
+		return append(writes,
+			func(ctx context.Context, tx *sql.Tx, dateCommitted time.Time) error {
+				if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET date_cancelled = $1, date_updated = $1 WHERE id = ANY($2)", tableCarCustomerAssociation), dateCommitted, pq.Array(carCustomerAssociationIds)); err != nil {
+					return lib_errors.Wrap(err, "Failed updating car customer associations")
+				}
+				return nil
+			},
+			postgresUpsert(tableCustomerBlock, []string{"customer_id"}, CustomerBlock{
+				CustomerId:  customerEvent.CustomerId,
+				DateCreated: spanner.CommitTimestamp,
+				EventType:   customerEvent.EventType,
+				Test:        customerEvent.Test,
+			}),
+			postgresInsert(tablePubsubMessage, PubsubMessage{
+				DateCreated:     spanner.CommitTimestamp,
+				PubsubMessageId: customerEvent.PubsubMessageId,
+				Test:            customerEvent.Test,
+			}),
+		), nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed blocking customer")
+	}
+
+	lib_log.Info(ctx, "Blocked", lib_log.FmtInt("countCancelled", countCancelled))
+	return nil
+}
+
+// CreateCarCustomerAssociation rents the car to the customer, the customer block is read in the same serializable transaction as the rental is inserted so that no rental is created for a customer once BlockCustomer has committed.
+// A rental.created event is recorded in the outbox in the same transaction so that the rental is published like the changes to cars
+func (c *PostgresClient) CreateCarCustomerAssociation(ctx context.Context, carCustomerAssociationCreate dto.CarCustomerAssociationCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtAny("carCustomerAssociationCreate", carCustomerAssociationCreate))
+
+	carCustomerAssociation, err := newCarCustomerAssociation(ctx, carCustomerAssociationCreate)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating car customer association")
+	}
+	outboxEvent, err := newRentalCreatedOutboxEvent(ctx, carCustomerAssociation)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating rental created outbox event")
+	}
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		car, err := c.readCar(ctx, tx, carCustomerAssociationCreate.CarId)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading car")
+		}
+		if err := checkCarAccess(ctx, *car, carCustomerAssociationCreate.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed checking car access")
+		}
+
+		count, err := readPostgresCount(ctx, tx, fmt.Sprintf("SELECT count(customer_id) FROM %s WHERE customer_id = $1", tableCustomerBlock), carCustomerAssociation.CustomerId)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading count of customer block")
+		}
+		if count > 0 {
+			return nil, lib_errors.NewCustom(http.StatusConflict, constants.ConflictCustomerBlocked)
+		}
+
+		// The columns are named as the spanner tag of the start of a rental does not match its column
+		return []postgresWrite{func(ctx context.Context, tx *sql.Tx, dateCommitted time.Time) error {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (car_id, customer_id, date_created, date_rental_end, date_rental_start, id, tenant_id, test) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)", tableCarCustomerAssociation),
+				carCustomerAssociation.CarId,
+				carCustomerAssociation.CustomerId,
+				dateCommitted,
+				carCustomerAssociation.DateRentalEnd,
+				carCustomerAssociation.DateRentalStart,
+				carCustomerAssociation.Id,
+				carCustomerAssociation.TenantId.StringVal,
+				carCustomerAssociation.Test,
+			); err != nil {
+				return lib_errors.Wrap(err, "Failed inserting car customer association")
+			}
+			return nil
+		}, postgresInsert(tableOutboxEvent, outboxEvent)}, nil
+
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("carCustomerAssociation.Id", carCustomerAssociation.Id))
+	return carCustomerAssociation.Id, nil
+}
+
+// readPostgresCarCustomerAssociationsNotStarted reads and locks the rentals of the customer that have not started, the column of the start of a rental is queried by name as the spanner tag of CarCustomerAssociation does not match it
+func readPostgresCarCustomerAssociationsNotStarted(ctx context.Context, tx *sql.Tx, customerId string) ([]CarCustomerAssociation, error) {
+	query := fmt.Sprintf(`
+		SELECT car_id, customer_id, id, tenant_id, test
+		FROM %s
+		WHERE customer_id = $1
+		AND date_cancelled IS NULL
+		AND date_rental_start > now()
+		FOR UPDATE
+	`,
+		tableCarCustomerAssociation,
+	)
+	lib_log.Info(ctx, "Reading", lib_log.FmtString("query", query))
+
+	rows, err := tx.QueryContext(ctx, query, customerId)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed querying car customer association")
+	}
+	defer rows.Close()
+
+	var carCustomerAssociations []CarCustomerAssociation
+	for rows.Next() {
+		var v CarCustomerAssociation
+		var tenantId sql.NullString
+		if err := rows.Scan(&v.CarId, &v.CustomerId, &v.Id, &tenantId, &v.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed scanning car customer association")
+		}
+		v.TenantId = spanner.NullString{StringVal: tenantId.String, Valid: tenantId.Valid}
+		carCustomerAssociations = append(carCustomerAssociations, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed iterating car customer association")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(carCustomerAssociations)", len(carCustomerAssociations)))
+	return carCustomerAssociations, nil
+}
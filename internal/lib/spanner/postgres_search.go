@@ -0,0 +1,172 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_search "github.com/tomwangsvc/lib-svc/search"
+	lib_strings "github.com/tomwangsvc/lib-svc/strings"
+)
+
+// postgresWhere builds the where clause of a query, its arguments are numbered in the order they are added
+type postgresWhere struct {
+	args       []interface{}
+	conditions []string
+}
+
+// newPostgresTenantWhere returns a where clause constrained to the tenant of the caller, as generateSqlWhereAndParamsForTenantSearch does for Spanner
+func newPostgresTenantWhere(ctx context.Context) (*postgresWhere, error) {
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	var w postgresWhere
+	w.and(fmt.Sprintf("%s = %s", columnTenantId, w.arg(tenantId)))
+	return &w, nil
+}
+
+// arg adds an argument and returns its placeholder
+func (w *postgresWhere) arg(value interface{}) string {
+	w.args = append(w.args, postgresArg(value))
+	return fmt.Sprintf("$%d", len(w.args))
+}
+
+// and adds a condition, conditions are bracketed so that an OR in one cannot escape the others
+func (w *postgresWhere) and(condition string) {
+	w.conditions = append(w.conditions, condition)
+}
+
+func (w *postgresWhere) String() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("WHERE (%s)", strings.Join(w.conditions, ") AND ("))
+}
+
+// linkedFilters adds the condition of the linked filters as lib_spanner.GenerateSqlWhereAndParamsForSearchWithInitialWhereV2 generates it for Spanner.
+// The key of a filter is interpolated as a column so it must be one of the columns of the table.
+func (w *postgresWhere) linkedFilters(columns []string, linkedFilters []lib_search.LinkedFilter) error {
+	if len(linkedFilters) == 0 {
+		return nil
+	}
+
+	var condition []string
+	for i, linkedFilter := range linkedFilters {
+		if linkedFilter.Type != nil && *linkedFilter.Type != lib_search.LinkedFilterTypeFilter {
+			switch *linkedFilter.Type {
+			default:
+				return lib_errors.Errorf("Linked filter type %q not recognized", *linkedFilter.Type)
+			case lib_search.LinkedFilterTypeAnd:
+				condition = append(condition, "AND")
+			case lib_search.LinkedFilterTypeCloseBracket:
+				condition = append(condition, ")")
+			case lib_search.LinkedFilterTypeOpenBracket:
+				condition = append(condition, "(")
+			case lib_search.LinkedFilterTypeOr:
+				condition = append(condition, "OR")
+			}
+			continue
+		}
+		if linkedFilter.Filter == nil {
+			continue
+		}
+
+		sqlFilter, err := w.filter(columns, *linkedFilter.Filter)
+		if err != nil {
+			return lib_errors.Wrapf(err, "Failed generating sql for linked filter %d", i)
+		}
+		condition = append(condition, sqlFilter)
+	}
+
+	w.and(strings.Join(condition, " "))
+	return nil
+}
+
+// filter returns the condition of the filter, arrays are searched with ANY and ALL where Spanner uses UNNEST
+//
+//revive:disable:cyclomatic
+func (w *postgresWhere) filter(columns []string, filter lib_search.Filter) (string, error) {
+	if err := lib_search.CheckFilterOptionsForExclusivity(filter); err != nil {
+		return "", lib_errors.Wrap(err, "Failed checking filter options for exclusivity")
+	}
+	if !lib_strings.Contains(columns, filter.Key) {
+		return "", lib_errors.NewCustomf(http.StatusBadRequest, "Not recognized: filter = %s", filter.Key)
+	}
+	column, value := filter.Key, filter.Value
+
+	switch {
+	case filter.ArrayContains:
+		if filter.NotCondition {
+			return fmt.Sprintf("%s <> ALL(%s)", w.arg(value), column), nil
+		}
+		return fmt.Sprintf("%s = ANY(%s)", w.arg(value), column), nil
+
+	case filter.InArray:
+		if filter.NotCondition {
+			return fmt.Sprintf("%s <> ALL(%s)", column, w.arg(value)), nil
+		}
+		return fmt.Sprintf("%s = ANY(%s)", column, w.arg(value)), nil
+
+	case filter.InRange:
+		bounds := reflect.ValueOf(value)
+		if bounds.Kind() != reflect.Slice || bounds.Len() != 2 {
+			return "", lib_errors.Errorf("Filter with key %q of type %T, expected slice of length 2 for range search", filter.Key, value)
+		}
+		start, end := w.arg(bounds.Index(0).Interface()), w.arg(bounds.Index(1).Interface())
+		if filter.NotCondition {
+			return fmt.Sprintf("NOT(%s >= %s) AND NOT(%s <= %s)", column, start, column, end), nil
+		}
+		return fmt.Sprintf("%s >= %s AND %s <= %s", column, start, column, end), nil
+
+	case filter.IsGreaterThan, filter.IsGreaterThanOrEqualTo, filter.IsLessThan, filter.IsLessThanOrEqualTo:
+		var operator string
+		switch {
+		case filter.IsGreaterThan:
+			operator = ">"
+		case filter.IsGreaterThanOrEqualTo:
+			operator = ">="
+		case filter.IsLessThan:
+			operator = "<"
+		default:
+			operator = "<="
+		}
+		if filter.NotCondition {
+			return fmt.Sprintf("NOT(%s %s %s)", column, operator, w.arg(value)), nil
+		}
+		return fmt.Sprintf("%s %s %s", column, operator, w.arg(value)), nil
+
+	case filter.IsNull:
+		if filter.NotCondition {
+			return fmt.Sprintf("%s IS NOT NULL", column), nil
+		}
+		return fmt.Sprintf("%s IS NULL", column), nil
+	}
+
+	if filter.CaseInsensitiveString {
+		s, ok := value.(string)
+		if !ok {
+			return "", lib_errors.Errorf("Filter with key %q of type %T, expected string for case insensitive string search", filter.Key, value)
+		}
+		column, value = fmt.Sprintf("UPPER(%s)", column), strings.ToUpper(s)
+	}
+	if filter.PartialMatchString {
+		s, ok := value.(string)
+		if !ok {
+			return "", lib_errors.Errorf("Filter with key %q of type %T, expected string for partial match string search", filter.Key, value)
+		}
+		if filter.NotCondition {
+			return fmt.Sprintf("%s NOT LIKE %s", column, w.arg(fmt.Sprintf("%%%s%%", s))), nil
+		}
+		return fmt.Sprintf("%s LIKE %s", column, w.arg(fmt.Sprintf("%%%s%%", s))), nil
+	}
+	if filter.NotCondition {
+		return fmt.Sprintf("%s != %s", column, w.arg(value)), nil
+	}
+	return fmt.Sprintf("%s = %s", column, w.arg(value)), nil
+	//revive:enable:cyclomatic
+}
@@ -0,0 +1,133 @@
+package spanner
+
+import (
+	"reflect"
+	"testing"
+
+	lib_search "github.com/tomwangsvc/lib-svc/search"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_postgresWhere_linkedFilters(t *testing.T) {
+	linkedFilterTypeAnd := lib_search.LinkedFilterTypeAnd
+	linkedFilterTypeCloseBracket := lib_search.LinkedFilterTypeCloseBracket
+	linkedFilterTypeOpenBracket := lib_search.LinkedFilterTypeOpenBracket
+	linkedFilterTypeOr := lib_search.LinkedFilterTypeOr
+
+	columns := []string{"brand_name", "model_name", "seats", "tags"}
+
+	type expected struct {
+		sql  string
+		args []interface{}
+		err  bool
+	}
+	var data = []struct {
+		desc  string
+		input []lib_search.LinkedFilter
+		expected
+	}{
+		{
+			desc: "no filters",
+		},
+		{
+			desc: "brackets and operators",
+			input: []lib_search.LinkedFilter{
+				{Type: &linkedFilterTypeOpenBracket},
+				{Filter: &lib_search.Filter{Key: "brand_name", Value: "Toyota"}},
+				{Type: &linkedFilterTypeOr},
+				{Filter: &lib_search.Filter{Key: "brand_name", Value: "Honda", NotCondition: true}},
+				{Type: &linkedFilterTypeCloseBracket},
+				{Type: &linkedFilterTypeAnd},
+				{Filter: &lib_search.Filter{Key: "seats", Value: int64(2), IsGreaterThan: true}},
+			},
+			expected: expected{
+				sql:  "WHERE (( brand_name = $1 OR brand_name != $2 ) AND seats > $3)",
+				args: []interface{}{"Toyota", "Honda", int64(2)},
+			},
+		},
+		{
+			desc: "case insensitive partial match",
+			input: []lib_search.LinkedFilter{
+				{Filter: &lib_search.Filter{Key: "model_name", Value: "rol", CaseInsensitiveString: true, PartialMatchString: true}},
+			},
+			expected: expected{
+				sql:  "WHERE (UPPER(model_name) LIKE $1)",
+				args: []interface{}{"%ROL%"},
+			},
+		},
+		{
+			desc: "range",
+			input: []lib_search.LinkedFilter{
+				{Filter: &lib_search.Filter{Key: "seats", Value: []int64{2, 5}, InRange: true}},
+			},
+			expected: expected{
+				sql:  "WHERE (seats >= $1 AND seats <= $2)",
+				args: []interface{}{int64(2), int64(5)},
+			},
+		},
+		{
+			desc: "null",
+			input: []lib_search.LinkedFilter{
+				{Filter: &lib_search.Filter{Key: "model_name", IsNull: true, NotCondition: true}},
+			},
+			expected: expected{
+				sql: "WHERE (model_name IS NOT NULL)",
+			},
+		},
+		{
+			desc: "array contains",
+			input: []lib_search.LinkedFilter{
+				{Filter: &lib_search.Filter{Key: "tags", Value: "sport", ArrayContains: true}},
+			},
+			expected: expected{
+				sql:  "WHERE ($1 = ANY(tags))",
+				args: []interface{}{"sport"},
+			},
+		},
+		{
+			desc: "column not recognized",
+			input: []lib_search.LinkedFilter{
+				{Filter: &lib_search.Filter{Key: "brand_name; DROP TABLE car", Value: "Toyota"}},
+			},
+			expected: expected{err: true},
+		},
+	}
+
+	for i, d := range data {
+		var where postgresWhere
+		err := where.linkedFilters(columns, d.input)
+		if (err != nil) != d.expected.err {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.err,
+				Result:     err,
+			}))
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if where.String() != d.expected.sql {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "where.String()",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.sql,
+				Result:     where.String(),
+			}))
+		}
+
+		if !reflect.DeepEqual(where.args, d.expected.args) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "where.args",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.args,
+				Result:     where.args,
+			}))
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+)
+
+func (c *PostgresClient) CreateWebhookSubscription(ctx context.Context, webhookSubscriptionCreate dto.WebhookSubscriptionCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtString("webhookSubscriptionCreate.UserInput.Url", webhookSubscriptionCreate.UserInput.Url))
+
+	tenantId, err := newTenantId(ctx)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed getting new tenant id")
+	}
+
+	webhookSubscription := WebhookSubscription{
+		DateCreated:           spanner.CommitTimestamp,
+		EventTypes:            webhookSubscriptionCreate.UserInput.EventTypes,
+		Secret:                webhookSubscriptionCreate.UserInput.Secret,
+		TenantId:              tenantId,
+		Test:                  webhookSubscriptionCreate.Test,
+		Url:                   webhookSubscriptionCreate.UserInput.Url,
+		WebhookSubscriptionId: uuid.New().String(),
+	}
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		return []postgresWrite{postgresInsert(tableWebhookSubscription, webhookSubscription)}, nil
+	}); err != nil {
+		return "", lib_errors.Wrap(err, "Failed executing read write transaction")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("webhookSubscriptionId", webhookSubscription.WebhookSubscriptionId))
+	return webhookSubscription.WebhookSubscriptionId, nil
+}
+
+func (c *PostgresClient) SearchWebhookSubscriptions(ctx context.Context, webhookSubscriptionsSearch dto.WebhookSubscriptionsSearch) ([]WebhookSubscription, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("webhookSubscriptionsSearch", webhookSubscriptionsSearch))
+
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("test = %s", where.arg(webhookSubscriptionsSearch.Test)))
+
+	var webhookSubscriptions []WebhookSubscription
+	var pagination *lib_pagination.Pagination
+	if err := c.readOnly(ctx, func(tx *sql.Tx) error {
+		webhookSubscriptions = nil
+		if err := postgresSelect(ctx, tx, &webhookSubscriptions, WebhookSubscriptionColumns, fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			%s
+			ORDER BY date_created %s, webhook_subscription_id
+			LIMIT %d
+			OFFSET %d
+		`,
+			strings.Join(WebhookSubscriptionColumns, ", "),
+			tableWebhookSubscription,
+			where,
+			webhookSubscriptionsSearch.Pagination.Order,
+			webhookSubscriptionsSearch.Pagination.Limit,
+			webhookSubscriptionsSearch.Pagination.Offset,
+		), where.args...); err != nil {
+			return lib_errors.Wrap(err, "Failed selecting webhook subscriptions")
+		}
+
+		var err error
+		pagination, err = readPostgresCountForPagination(ctx, tx, webhookSubscriptionsSearch.Pagination, fmt.Sprintf("SELECT count(webhook_subscription_id) FROM %s %s", tableWebhookSubscription, where), where.args...)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading count for pagination")
+		}
+		return nil
+
+	}); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed executing read only transaction")
+	}
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(webhookSubscriptions)", len(webhookSubscriptions)), lib_log.FmtAny("pagination", pagination))
+	return webhookSubscriptions, pagination, nil
+}
+
+// DeleteWebhookSubscription deletes the subscription, its deliveries are deleted with it by the foreign key of webhook_delivery
+func (c *PostgresClient) DeleteWebhookSubscription(ctx context.Context, webhookSubscriptionDelete dto.WebhookSubscriptionDelete) error {
+	lib_log.Info(ctx, "Deleting", lib_log.FmtAny("webhookSubscriptionDelete", webhookSubscriptionDelete))
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		if _, err := c.readWebhookSubscription(ctx, tx, webhookSubscriptionDelete.Id, webhookSubscriptionDelete.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading webhook subscription")
+		}
+
+		return []postgresWrite{func(ctx context.Context, tx *sql.Tx, dateCommitted time.Time) error {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE webhook_subscription_id = $1", tableWebhookSubscription), webhookSubscriptionDelete.Id); err != nil {
+				return lib_errors.Wrap(err, "Failed deleting webhook subscription")
+			}
+			return nil
+		}}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed deleting webhook subscription")
+	}
+
+	lib_log.Info(ctx, "Deleted")
+	return nil
+}
+
+// readWebhookSubscription reads and locks a subscription of the tenant of the caller
+func (c *PostgresClient) readWebhookSubscription(ctx context.Context, tx *sql.Tx, webhookSubscriptionId string, test bool) (*WebhookSubscription, error) {
+	where, err := newPostgresTenantWhere(ctx)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed creating postgres tenant where")
+	}
+	where.and(fmt.Sprintf("webhook_subscription_id = %s", where.arg(webhookSubscriptionId)))
+
+	var webhookSubscription WebhookSubscription
+	if err := postgresSelectOne(ctx, tx, &webhookSubscription, WebhookSubscriptionColumns, fmt.Sprintf("SELECT %s FROM %s %s FOR UPDATE", strings.Join(WebhookSubscriptionColumns, ", "), tableWebhookSubscription, where), where.args...); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading webhook subscription")
+	}
+
+	if webhookSubscription.Test != test {
+		return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+	}
+
+	return &webhookSubscription, nil
+}
+
+func (c *PostgresClient) ReadWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	lib_log.Info(ctx, "Reading")
+
+	var webhookSubscriptions []WebhookSubscription
+	if err := postgresSelect(ctx, c.db, &webhookSubscriptions, WebhookSubscriptionColumns, fmt.Sprintf("SELECT %s FROM %s", strings.Join(WebhookSubscriptionColumns, ", "), tableWebhookSubscription)); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed selecting webhook subscriptions")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(webhookSubscriptions)", len(webhookSubscriptions)))
+	return webhookSubscriptions, nil
+}
+
+// CreateWebhookDeliveries creates a delivery of each event for each of the subscriptions to its type, deliveries that exist already are skipped so that an event relayed twice has a single delivery, as are deliveries to subscriptions deleted since they were read
+func (c *PostgresClient) CreateWebhookDeliveries(ctx context.Context, events []dto.Event, webhookSubscriptions []WebhookSubscription) (int, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtInt("len(events)", len(events)), lib_log.FmtInt("len(webhookSubscriptions)", len(webhookSubscriptions)))
+
+	webhookDeliveries, err := newWebhookDeliveries(events, webhookSubscriptions)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed creating webhook deliveries")
+	}
+	if len(webhookDeliveries) == 0 {
+		lib_log.Info(ctx, "Created")
+		return 0, nil
+	}
+
+	var count int
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		count = 0
+
+		var webhookSubscriptionIds []string
+		for _, v := range webhookSubscriptions {
+			webhookSubscriptionIds = append(webhookSubscriptionIds, v.WebhookSubscriptionId)
+		}
+		var existingWebhookSubscriptions []WebhookSubscription
+		if err := postgresSelect(ctx, tx, &existingWebhookSubscriptions, []string{"webhook_subscription_id"}, fmt.Sprintf("SELECT webhook_subscription_id FROM %s WHERE webhook_subscription_id = ANY($1)", tableWebhookSubscription), pq.Array(webhookSubscriptionIds)); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed selecting existing webhook subscriptions")
+		}
+		existingWebhookSubscription := make(map[string]bool)
+		for _, v := range existingWebhookSubscriptions {
+			existingWebhookSubscription[v.WebhookSubscriptionId] = true
+		}
+
+		var webhookDeliveryIds []string
+		for _, v := range webhookDeliveries {
+			webhookDeliveryIds = append(webhookDeliveryIds, v.WebhookDeliveryId)
+		}
+		var existingWebhookDeliveries []WebhookDelivery
+		if err := postgresSelect(ctx, tx, &existingWebhookDeliveries, []string{"webhook_delivery_id"}, fmt.Sprintf("SELECT webhook_delivery_id FROM %s WHERE webhook_delivery_id = ANY($1)", tableWebhookDelivery), pq.Array(webhookDeliveryIds)); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed selecting existing webhook deliveries")
+		}
+		existing := make(map[string]bool)
+		for _, v := range existingWebhookDeliveries {
+			existing[v.WebhookDeliveryId] = true
+		}
+
+		var writes []postgresWrite
+		for _, v := range webhookDeliveries {
+			if existing[v.WebhookDeliveryId] || !existingWebhookSubscription[v.WebhookSubscriptionId] {
+				continue
+			}
+			writes = append(writes, postgresInsert(tableWebhookDelivery, v))
+		}
+		count = len(writes)
+
+		return writes, nil
+
+	}); err != nil {
+		return 0, lib_errors.Wrap(err, "Failed creating webhook deliveries")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtInt("count", count))
+	return count, nil
+}
+
+func (c *PostgresClient) ReadWebhookDeliveriesDue(ctx context.Context, limit int) ([]WebhookDeliveryDue, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtInt("limit", limit))
+
+	columns := make([]string, len(WebhookDeliveryColumns))
+	for i, v := range WebhookDeliveryColumns {
+		columns[i] = "d." + v
+	}
+	query := fmt.Sprintf(`
+		SELECT %s, s.secret, s.url
+		FROM %s d
+		JOIN %s s ON s.webhook_subscription_id = d.webhook_subscription_id
+		WHERE d.status = $1
+		AND d.date_next_attempt <= now()
+		ORDER BY d.date_next_attempt, d.webhook_delivery_id
+		LIMIT %d
+	`,
+		strings.Join(columns, ", "),
+		tableWebhookDelivery,
+		tableWebhookSubscription,
+		limit,
+	)
+	lib_log.Info(ctx, "Reading", lib_log.FmtString("query", query))
+
+	rows, err := c.db.QueryContext(ctx, query, dto.WebhookDeliveryStatusPending)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed querying webhook deliveries due")
+	}
+	defer rows.Close()
+
+	var webhookDeliveriesDue []WebhookDeliveryDue
+	for rows.Next() {
+		var webhookDeliveryDue WebhookDeliveryDue
+		dest, err := newPostgresColumns(reflect.ValueOf(&webhookDeliveryDue.WebhookDelivery).Elem(), WebhookDeliveryColumns)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed creating postgres columns")
+		}
+		if err := rows.Scan(append(dest, &webhookDeliveryDue.Secret, &webhookDeliveryDue.Url)...); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed scanning webhook delivery due")
+		}
+		webhookDeliveriesDue = append(webhookDeliveriesDue, webhookDeliveryDue)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed iterating webhook deliveries due")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(webhookDeliveriesDue)", len(webhookDeliveriesDue)))
+	return webhookDeliveriesDue, nil
+}
+
+func (c *PostgresClient) UpdateWebhookDeliveryAttempted(ctx context.Context, webhookDelivery WebhookDelivery, webhookDeliveryAttempt dto.WebhookDeliveryAttempt) error {
+	lib_log.Info(ctx, "Updating", lib_log.FmtString("webhookDelivery.WebhookDeliveryId", webhookDelivery.WebhookDeliveryId), lib_log.FmtAny("webhookDeliveryAttempt", webhookDeliveryAttempt))
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		storedWebhookDelivery, err := c.readWebhookDelivery(ctx, tx, webhookDelivery.WebhookSubscriptionId, webhookDelivery.WebhookDeliveryId)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading webhook delivery")
+		}
+
+		storedWebhookDelivery.Attempts = webhookDelivery.Attempts + 1
+		storedWebhookDelivery.DateNextAttempt = spanner.NullTime{}
+		storedWebhookDelivery.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		storedWebhookDelivery.LastError = spanner.NullString{}
+		storedWebhookDelivery.LastResponseStatusCode = spanner.NullInt64{}
+		storedWebhookDelivery.Status = webhookDeliveryAttempt.Status
+		if webhookDeliveryAttempt.DateNextAttempt != nil {
+			storedWebhookDelivery.DateNextAttempt = spanner.NullTime{Time: *webhookDeliveryAttempt.DateNextAttempt, Valid: true}
+		}
+		if webhookDeliveryAttempt.Error != nil {
+			storedWebhookDelivery.LastError = spanner.NullString{StringVal: *webhookDeliveryAttempt.Error, Valid: true}
+		}
+		if webhookDeliveryAttempt.ResponseStatusCode != nil {
+			storedWebhookDelivery.LastResponseStatusCode = spanner.NullInt64{Int64: int64(*webhookDeliveryAttempt.ResponseStatusCode), Valid: true}
+		}
+
+		return []postgresWrite{postgresUpdate(tableWebhookDelivery, "webhook_delivery_id", *storedWebhookDelivery)}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed updating webhook delivery")
+	}
+
+	lib_log.Info(ctx, "Updated")
+	return nil
+}
+
+// readWebhookDelivery reads and locks a delivery of the subscription
+func (c *PostgresClient) readWebhookDelivery(ctx context.Context, tx *sql.Tx, webhookSubscriptionId, webhookDeliveryId string) (*WebhookDelivery, error) {
+	var webhookDelivery WebhookDelivery
+	if err := postgresSelectOne(ctx, tx, &webhookDelivery, WebhookDeliveryColumns, fmt.Sprintf("SELECT %s FROM %s WHERE webhook_subscription_id = $1 AND webhook_delivery_id = $2 FOR UPDATE", strings.Join(WebhookDeliveryColumns, ", "), tableWebhookDelivery), webhookSubscriptionId, webhookDeliveryId); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading webhook delivery")
+	}
+	return &webhookDelivery, nil
+}
+
+func (c *PostgresClient) SearchWebhookDeliveries(ctx context.Context, webhookDeliveriesSearch dto.WebhookDeliveriesSearch) ([]WebhookDelivery, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("webhookDeliveriesSearch", webhookDeliveriesSearch))
+
+	var where postgresWhere
+	where.and(fmt.Sprintf("webhook_subscription_id = %s", where.arg(webhookDeliveriesSearch.WebhookSubscriptionId)))
+	if webhookDeliveriesSearch.Status != nil {
+		where.and(fmt.Sprintf("status = %s", where.arg(*webhookDeliveriesSearch.Status)))
+	}
+
+	var webhookDeliveries []WebhookDelivery
+	var pagination *lib_pagination.Pagination
+	if err := c.readOnly(ctx, func(tx *sql.Tx) error {
+		webhookDeliveries = nil
+
+		// The subscription is read in the same transaction so that a subscription of another tenant is not found
+		subscriptionWhere, err := newPostgresTenantWhere(ctx)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed creating postgres tenant where")
+		}
+		subscriptionWhere.and(fmt.Sprintf("webhook_subscription_id = %s", subscriptionWhere.arg(webhookDeliveriesSearch.WebhookSubscriptionId)))
+		var webhookSubscription WebhookSubscription
+		if err := postgresSelectOne(ctx, tx, &webhookSubscription, WebhookSubscriptionColumns, fmt.Sprintf("SELECT %s FROM %s %s", strings.Join(WebhookSubscriptionColumns, ", "), tableWebhookSubscription, subscriptionWhere), subscriptionWhere.args...); err != nil {
+			return lib_errors.Wrap(err, "Failed reading webhook subscription")
+		}
+		if webhookSubscription.Test != webhookDeliveriesSearch.Test {
+			return lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+		}
+
+		if err := postgresSelect(ctx, tx, &webhookDeliveries, WebhookDeliveryColumns, fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			%s
+			ORDER BY date_created %s, webhook_delivery_id
+			LIMIT %d
+			OFFSET %d
+		`,
+			strings.Join(WebhookDeliveryColumns, ", "),
+			tableWebhookDelivery,
+			&where,
+			webhookDeliveriesSearch.Pagination.Order,
+			webhookDeliveriesSearch.Pagination.Limit,
+			webhookDeliveriesSearch.Pagination.Offset,
+		), where.args...); err != nil {
+			return lib_errors.Wrap(err, "Failed selecting webhook deliveries")
+		}
+
+		pagination, err = readPostgresCountForPagination(ctx, tx, webhookDeliveriesSearch.Pagination, fmt.Sprintf("SELECT count(webhook_delivery_id) FROM %s %s", tableWebhookDelivery, &where), where.args...)
+		if err != nil {
+			return lib_errors.Wrap(err, "Failed reading count for pagination")
+		}
+		return nil
+
+	}); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed executing read only transaction")
+	}
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(webhookDeliveries)", len(webhookDeliveries)), lib_log.FmtAny("pagination", pagination))
+	return webhookDeliveries, pagination, nil
+}
+
+func (c *PostgresClient) RedeliverWebhookDelivery(ctx context.Context, webhookDeliveryRedeliver dto.WebhookDeliveryRedeliver) error {
+	lib_log.Info(ctx, "Redelivering", lib_log.FmtAny("webhookDeliveryRedeliver", webhookDeliveryRedeliver))
+
+	if err := c.readWrite(ctx, func(tx *sql.Tx) ([]postgresWrite, error) {
+		if _, err := c.readWebhookSubscription(ctx, tx, webhookDeliveryRedeliver.WebhookSubscriptionId, webhookDeliveryRedeliver.Test); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading webhook subscription")
+		}
+
+		webhookDelivery, err := c.readWebhookDelivery(ctx, tx, webhookDeliveryRedeliver.WebhookSubscriptionId, webhookDeliveryRedeliver.Id)
+		if err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading webhook delivery")
+		}
+
+		if webhookDelivery.Test != webhookDeliveryRedeliver.Test {
+			return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+		}
+
+		webhookDelivery.Attempts = 0
+		webhookDelivery.DateNextAttempt = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		webhookDelivery.DateUpdated = spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true}
+		webhookDelivery.Status = dto.WebhookDeliveryStatusPending
+		return []postgresWrite{postgresUpdate(tableWebhookDelivery, "webhook_delivery_id", *webhookDelivery)}, nil
+
+	}); err != nil {
+		return lib_errors.Wrap(err, "Failed redelivering webhook delivery")
+	}
+
+	lib_log.Info(ctx, "Redelivered")
+	return nil
+}
@@ -0,0 +1,106 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/tenant"
+	"context"
+	"fmt"
+	"net/http"
+
+	"cloud.google.com/go/spanner"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_search "github.com/tomwangsvc/lib-svc/search"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+	lib_strings "github.com/tomwangsvc/lib-svc/strings"
+)
+
+const (
+	columnTenantId = "tenant_id"
+
+	// sqlWhereTenant constrains a query to the tenant of the caller, the tenant is bound to the parameter named by the column
+	sqlWhereTenant = "tenant_id = @tenant_id"
+)
+
+// tenanted is an entity that belongs to a single brand
+type tenanted interface {
+	tenant() spanner.NullString
+}
+
+func (c Car) tenant() spanner.NullString                    { return c.TenantId }
+func (c CarCustomerAssociation) tenant() spanner.NullString { return c.TenantId }
+func (c CarHistory) tenant() spanner.NullString             { return c.TenantId }
+func (c CarsImport) tenant() spanner.NullString             { return c.TenantId }
+func (c Customer) tenant() spanner.NullString               { return c.TenantId }
+func (c ApiKey) tenant() spanner.NullString                 { return c.TenantId }
+func (c WebhookSubscription) tenant() spanner.NullString    { return c.TenantId }
+
+// tenantId returns the tenant of the caller, there is no default tenant so that data cannot be reached by a caller whose tenant is unknown
+func tenantId(ctx context.Context) (string, error) {
+	tenantId, ok := tenant.TenantId(ctx)
+	if !ok {
+		return "", lib_errors.Errorf("Tenant not found in context")
+	}
+	return tenantId, nil
+}
+
+// newTenantId returns the tenant recorded against an entity created by the caller
+func newTenantId(ctx context.Context) (spanner.NullString, error) {
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return spanner.NullString{}, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+	return spanner.NullString{StringVal: tenantId, Valid: true}, nil
+}
+
+// readByIdForTenant reads an entity with lib_spanner.ReadById and checks it belongs to the tenant of the caller, an entity of another tenant is not found so that its existence is not revealed
+func readByIdForTenant(ctx context.Context, reader lib_spanner.Reader, table string, columns []string, id string, dst tenanted) error {
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	if !lib_strings.Contains(columns, columnTenantId) {
+		columns = append(append([]string(nil), columns...), columnTenantId)
+	}
+	if err := lib_spanner.ReadById(ctx, reader, table, columns, id, dst); err != nil {
+		return lib_errors.Wrap(err, "Failed reading by id")
+	}
+
+	if err := checkTenant(dst, tenantId); err != nil {
+		return lib_errors.Wrap(err, "Failed checking tenant")
+	}
+	return nil
+}
+
+func checkTenant(entity tenanted, tenantId string) error {
+	if v := entity.tenant(); !v.Valid || v.StringVal != tenantId {
+		return lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+	}
+	return nil
+}
+
+// generateSqlWhereAndParamsForTenantSearch generates the where clause of a search with lib_spanner.GenerateSqlWhereAndParamsForSearchWithInitialWhereV2 constrained to the tenant of the caller.
+// The initial where and the linked filters are bracketed so that an OR in either cannot escape the tenant.
+func generateSqlWhereAndParamsForTenantSearch(ctx context.Context, initialWhere string, initialWhereParams map[string]interface{}, linkedFilters []lib_search.LinkedFilter) (string, map[string]interface{}, error) {
+	tenantId, err := tenantId(ctx)
+	if err != nil {
+		return "", nil, lib_errors.Wrap(err, "Failed getting tenant id")
+	}
+
+	sqlWhere := sqlWhereTenant
+	if initialWhere != "" {
+		sqlWhere = fmt.Sprintf("%s AND (%s)", sqlWhere, initialWhere)
+	}
+	params := make(map[string]interface{})
+	for k, v := range initialWhereParams {
+		params[k] = v
+	}
+	// The tenant is bound last so that it cannot be replaced by a parameter of the initial where
+	params[columnTenantId] = tenantId
+
+	if len(linkedFilters) > 0 {
+		linkedFilterTypeOpenBracket, linkedFilterTypeCloseBracket := lib_search.LinkedFilterTypeOpenBracket, lib_search.LinkedFilterTypeCloseBracket
+		linkedFilters = append([]lib_search.LinkedFilter{{Type: &linkedFilterTypeOpenBracket}}, linkedFilters...)
+		linkedFilters = append(linkedFilters, lib_search.LinkedFilter{Type: &linkedFilterTypeCloseBracket})
+	}
+	return lib_spanner.GenerateSqlWhereAndParamsForSearchWithInitialWhereV2(sqlWhere, params, linkedFilters)
+}
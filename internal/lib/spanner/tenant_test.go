@@ -0,0 +1,130 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/tenant"
+	"context"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	lib_brand "github.com/tomwangsvc/lib-svc/brand"
+	lib_search "github.com/tomwangsvc/lib-svc/search"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_checkTenant(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    tenanted
+		expected bool
+	}{
+		{
+			desc:     "entity of tenant",
+			input:    Car{TenantId: spanner.NullString{StringVal: lib_brand.BoxerId, Valid: true}},
+			expected: true,
+		},
+		{
+			desc:  "entity of another tenant",
+			input: Car{TenantId: spanner.NullString{StringVal: lib_brand.TomWangId, Valid: true}},
+		},
+		{
+			desc:  "entity without tenant",
+			input: Customer{},
+		},
+	}
+
+	for i, d := range data {
+		if err := checkTenant(d.input, lib_brand.BoxerId); (err == nil) != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     err,
+			}))
+		}
+	}
+}
+
+func Test_generateSqlWhereAndParamsForTenantSearch(t *testing.T) {
+	linkedFilterTypeOr := lib_search.LinkedFilterTypeOr
+	linkedFilters := []lib_search.LinkedFilter{
+		{Filter: &lib_search.Filter{Key: "brand_name", Value: "a"}},
+		{Type: &linkedFilterTypeOr},
+		{Filter: &lib_search.Filter{Key: "brand_name", Value: "b"}},
+	}
+
+	type input struct {
+		ctx                context.Context
+		initialWhere       string
+		initialWhereParams map[string]interface{}
+		linkedFilters      []lib_search.LinkedFilter
+	}
+	type expected struct {
+		err      bool
+		params   map[string]interface{}
+		sqlWhere string
+	}
+	var data = []struct {
+		desc string
+		input
+		expected
+	}{
+		{
+			desc:     "tenant not in context",
+			input:    input{ctx: context.Background(), initialWhere: "test = @test", initialWhereParams: map[string]interface{}{"test": false}},
+			expected: expected{err: true},
+		},
+		{
+			desc:  "no initial where and no filters",
+			input: input{ctx: tenant.WithTenantId(context.Background(), lib_brand.BoxerId)},
+			expected: expected{
+				params:   map[string]interface{}{"tenant_id": lib_brand.BoxerId},
+				sqlWhere: "WHERE tenant_id = @tenant_id",
+			},
+		},
+		{
+			desc:  "initial where and filters with or",
+			input: input{ctx: tenant.WithTenantId(context.Background(), lib_brand.BoxerId), initialWhere: "test = @test OR test IS NULL", initialWhereParams: map[string]interface{}{"test": false}, linkedFilters: linkedFilters},
+			expected: expected{
+				params: map[string]interface{}{
+					"__PARAM__1_brand_name": "a",
+					"__PARAM__3_brand_name": "b",
+					"tenant_id":             lib_brand.BoxerId,
+					"test":                  false,
+				},
+				sqlWhere: "WHERE tenant_id = @tenant_id AND (test = @test OR test IS NULL) AND ( brand_name = @__PARAM__1_brand_name OR brand_name = @__PARAM__3_brand_name )",
+			},
+		},
+		{
+			desc:  "initial where param named as tenant",
+			input: input{ctx: tenant.WithTenantId(context.Background(), lib_brand.BoxerId), initialWhere: "test = @test", initialWhereParams: map[string]interface{}{"tenant_id": lib_brand.TomWangId, "test": false}},
+			expected: expected{
+				params:   map[string]interface{}{"tenant_id": lib_brand.BoxerId, "test": false},
+				sqlWhere: "WHERE tenant_id = @tenant_id AND (test = @test)",
+			},
+		},
+	}
+
+	for i, d := range data {
+		sqlWhere, params, err := generateSqlWhereAndParamsForTenantSearch(d.input.ctx, d.input.initialWhere, d.input.initialWhereParams, d.input.linkedFilters)
+		if (err != nil) != d.expected.err {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.err,
+				Result:     err,
+			}))
+		}
+		if sqlWhere != d.expected.sqlWhere || !reflect.DeepEqual(params, d.expected.params) {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     []interface{}{sqlWhere, params},
+			}))
+		}
+	}
+}
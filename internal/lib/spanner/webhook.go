@@ -0,0 +1,622 @@
+package spanner
+
+import (
+	"car-svc/internal/lib/constants"
+	"car-svc/internal/lib/dto"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_json "github.com/tomwangsvc/lib-svc/json"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+	lib_misc "github.com/tomwangsvc/lib-svc/misc"
+	lib_pagination "github.com/tomwangsvc/lib-svc/pagination"
+	lib_spanner "github.com/tomwangsvc/lib-svc/spanner"
+	lib_strings "github.com/tomwangsvc/lib-svc/strings"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+)
+
+type WebhookSubscription struct {
+	DateCreated           time.Time          `json:"date_created" spanner:"date_created"`
+	DateUpdated           spanner.NullTime   `json:"date_updated" spanner:"date_updated"`
+	EventTypes            []string           `json:"event_types" spanner:"event_types"`
+	Secret                string             `json:"-" spanner:"secret"`
+	TenantId              spanner.NullString `json:"-" spanner:"tenant_id"`
+	Test                  bool               `json:"test" spanner:"test"`
+	Url                   string             `json:"url" spanner:"url"`
+	WebhookSubscriptionId string             `json:"webhook_subscription_id" spanner:"webhook_subscription_id"`
+}
+
+type WebhookDelivery struct {
+	Attempts               int64              `json:"attempts" spanner:"attempts"`
+	DateCreated            time.Time          `json:"date_created" spanner:"date_created"`
+	DateNextAttempt        spanner.NullTime   `json:"date_next_attempt" spanner:"date_next_attempt"`
+	DateUpdated            spanner.NullTime   `json:"date_updated" spanner:"date_updated"`
+	EventId                string             `json:"event_id" spanner:"event_id"`
+	EventType              string             `json:"event_type" spanner:"event_type"`
+	LastError              spanner.NullString `json:"last_error" spanner:"last_error"`
+	LastResponseStatusCode spanner.NullInt64  `json:"last_response_status_code" spanner:"last_response_status_code"`
+	Payload                string             `json:"payload" spanner:"payload" transform:"raw"`
+	Status                 string             `json:"status" spanner:"status"`
+	Test                   bool               `json:"test" spanner:"test"`
+	WebhookDeliveryId      string             `json:"webhook_delivery_id" spanner:"webhook_delivery_id"`
+	WebhookSubscriptionId  string             `json:"webhook_subscription_id" spanner:"webhook_subscription_id"`
+}
+
+// WebhookDeliveryDue is a pending delivery whose next attempt is due, with the url and secret of its subscription
+type WebhookDeliveryDue struct {
+	WebhookDelivery
+	Secret string
+	Url    string
+}
+
+const (
+	tableWebhookDelivery     = "webhook_delivery"
+	tableWebhookSubscription = "webhook_subscription"
+)
+
+var (
+	WebhookDeliveryColumns           = lib_misc.StructTaggedFieldNames(reflect.TypeOf(WebhookDelivery{}), "spanner")
+	WebhookDeliveryFieldMetaData     = lib_json.StructFieldMetadata(reflect.TypeOf(WebhookDelivery{}))
+	WebhookSubscriptionColumns       = lib_misc.StructTaggedFieldNames(reflect.TypeOf(WebhookSubscription{}), "spanner")
+	WebhookSubscriptionFieldMetaData = lib_json.StructFieldMetadata(reflect.TypeOf(WebhookSubscription{}))
+
+	// webhookDeliveryIdNamespace makes the id of a delivery a function of its subscription and event, so that an event relayed twice has a single delivery
+	webhookDeliveryIdNamespace = uuid.MustParse("6f1f7d43-4f0b-4c39-9c7e-2b8a4e0f3d15")
+)
+
+func (c client) CreateWebhookSubscription(ctx context.Context, webhookSubscriptionCreate dto.WebhookSubscriptionCreate) (string, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtString("webhookSubscriptionCreate.UserInput.Url", webhookSubscriptionCreate.UserInput.Url))
+
+	tenantId, err := newTenantId(ctx)
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed getting new tenant id")
+	}
+
+	webhookSubscriptionId := uuid.New().String()
+	mutWebhookSubscription, err := spanner.InsertStruct(tableWebhookSubscription, WebhookSubscription{
+		DateCreated:           spanner.CommitTimestamp,
+		EventTypes:            webhookSubscriptionCreate.UserInput.EventTypes,
+		Secret:                webhookSubscriptionCreate.UserInput.Secret,
+		TenantId:              tenantId,
+		Test:                  webhookSubscriptionCreate.Test,
+		Url:                   webhookSubscriptionCreate.UserInput.Url,
+		WebhookSubscriptionId: webhookSubscriptionId,
+	})
+	if err != nil {
+		return "", lib_errors.Wrap(err, "Failed creating mutWebhookSubscription for webhook subscription")
+	}
+
+	if _, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{mutWebhookSubscription}); err != nil {
+		return "", lib_spanner.WrapError(err, "Failed applying webhook subscription mutation")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtString("webhookSubscriptionId", webhookSubscriptionId))
+	return webhookSubscriptionId, nil
+}
+
+func (c client) SearchWebhookSubscriptions(ctx context.Context, webhookSubscriptionsSearch dto.WebhookSubscriptionsSearch) ([]WebhookSubscription, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("webhookSubscriptionsSearch", webhookSubscriptionsSearch))
+
+	sqlWhere, params, err := generateSqlWhereAndParamsForTenantSearch(ctx, "test = @test", map[string]interface{}{
+		"test": webhookSubscriptionsSearch.Test,
+	}, nil)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed generating sql where and params for tenant search")
+	}
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			%s
+			ORDER BY date_created %s
+			LIMIT %d
+			OFFSET %d
+		`,
+			strings.Join(WebhookSubscriptionColumns, ", "),
+			tableWebhookSubscription,
+			sqlWhere,
+			webhookSubscriptionsSearch.Pagination.Order,
+			webhookSubscriptionsSearch.Pagination.Limit,
+			webhookSubscriptionsSearch.Pagination.Offset,
+		),
+		Params: params,
+	}
+
+	ro := c.spannerClient.ReadOnlyTransaction()
+	defer ro.Close()
+
+	webhookSubscriptions, err := queryWebhookSubscriptions(ctx, ro, stmt)
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed querying webhook subscriptions")
+	}
+
+	pagination, err := readCountForPagination(ctx, ro, webhookSubscriptionsSearch.Pagination, spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT count(webhook_subscription_id) AS count
+			FROM %s
+			%s
+		`,
+			tableWebhookSubscription,
+			sqlWhere,
+		),
+		Params: params,
+	})
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed reading count for pagination")
+	}
+	ro.Close()
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(webhookSubscriptions)", len(webhookSubscriptions)), lib_log.FmtAny("pagination", pagination))
+	return webhookSubscriptions, pagination, nil
+}
+
+func queryWebhookSubscriptions(ctx context.Context, reader lib_spanner.Reader, stmt spanner.Statement) ([]WebhookSubscription, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := reader.Query(ctx, stmt)
+	defer iter.Stop()
+
+	var webhookSubscriptions []WebhookSubscription
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, lib_errors.Wrap(err, "Failed iterating webhook subscription")
+		}
+
+		var webhookSubscription WebhookSubscription
+		if err := row.ToStruct(&webhookSubscription); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading webhook subscription")
+		}
+
+		webhookSubscriptions = append(webhookSubscriptions, webhookSubscription)
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(webhookSubscriptions)", len(webhookSubscriptions)))
+	return webhookSubscriptions, nil
+}
+
+// DeleteWebhookSubscription deletes the subscription, its deliveries are deleted with it as they are interleaved in it
+func (c client) DeleteWebhookSubscription(ctx context.Context, webhookSubscriptionDelete dto.WebhookSubscriptionDelete) error {
+	lib_log.Info(ctx, "Deleting", lib_log.FmtAny("webhookSubscriptionDelete", webhookSubscriptionDelete))
+
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		if _, err := readWebhookSubscription(ctx, txn, webhookSubscriptionDelete.Id, webhookSubscriptionDelete.Test); err != nil {
+			return lib_errors.Wrap(err, "Failed reading webhook subscription")
+		}
+
+		if err := txn.BufferWrite([]*spanner.Mutation{spanner.Delete(tableWebhookSubscription, spanner.Key{webhookSubscriptionDelete.Id})}); err != nil {
+			return lib_errors.Wrap(err, "Failed buffering mutations")
+		}
+
+		return nil
+	}); err != nil {
+		return lib_spanner.WrapError(err, "Failed deleting webhook subscription")
+	}
+
+	lib_log.Info(ctx, "Deleted")
+	return nil
+}
+
+func readWebhookSubscription(ctx context.Context, reader lib_spanner.Reader, webhookSubscriptionId string, test bool) (*WebhookSubscription, error) {
+	var webhookSubscription WebhookSubscription
+	if err := readByIdForTenant(ctx, reader, tableWebhookSubscription, WebhookSubscriptionColumns, webhookSubscriptionId, &webhookSubscription); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading webhook subscription by id")
+	}
+
+	if webhookSubscription.Test != test {
+		return nil, lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+	}
+
+	return &webhookSubscription, nil
+}
+
+// ReadWebhookSubscriptions reads the subscriptions of all tenants, the relay reads them once for all the events it relays in a tick
+func (c client) ReadWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	lib_log.Info(ctx, "Reading")
+
+	webhookSubscriptions, err := queryWebhookSubscriptions(ctx, c.spannerClient.Single(), spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+		`,
+			strings.Join(WebhookSubscriptionColumns, ", "),
+			tableWebhookSubscription,
+		),
+	})
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed querying webhook subscriptions")
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(webhookSubscriptions)", len(webhookSubscriptions)))
+	return webhookSubscriptions, nil
+}
+
+// CreateWebhookDeliveries creates a pending delivery of each event to each of the subscriptions of its tenant to its event type, deliveries that already exist and deliveries to subscriptions deleted since they were read are skipped
+func (c client) CreateWebhookDeliveries(ctx context.Context, events []dto.Event, webhookSubscriptions []WebhookSubscription) (int, error) {
+	lib_log.Info(ctx, "Creating", lib_log.FmtInt("len(events)", len(events)), lib_log.FmtInt("len(webhookSubscriptions)", len(webhookSubscriptions)))
+
+	webhookDeliveries, err := newWebhookDeliveries(events, webhookSubscriptions)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed creating webhook deliveries")
+	}
+	if len(webhookDeliveries) == 0 {
+		lib_log.Info(ctx, "Created")
+		return 0, nil
+	}
+
+	var count int
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		count = 0
+
+		keysWebhookSubscription := spanner.KeySets()
+		for _, v := range webhookSubscriptions {
+			keysWebhookSubscription = spanner.KeySets(keysWebhookSubscription, spanner.Key{v.WebhookSubscriptionId})
+		}
+		existingWebhookSubscription := make(map[string]bool)
+		if err := txn.Read(ctx, tableWebhookSubscription, keysWebhookSubscription, []string{"webhook_subscription_id"}).Do(func(row *spanner.Row) error {
+			var webhookSubscriptionId string
+			if err := row.Column(0, &webhookSubscriptionId); err != nil {
+				return lib_errors.Wrap(err, "Failed reading webhook subscription id")
+			}
+			existingWebhookSubscription[webhookSubscriptionId] = true
+			return nil
+		}); err != nil {
+			return lib_errors.Wrap(err, "Failed reading existing webhook subscriptions")
+		}
+
+		keys := spanner.KeySets()
+		for _, v := range webhookDeliveries {
+			keys = spanner.KeySets(keys, spanner.Key{v.WebhookSubscriptionId, v.WebhookDeliveryId})
+		}
+
+		existing := make(map[string]bool)
+		if err := txn.Read(ctx, tableWebhookDelivery, keys, []string{"webhook_delivery_id"}).Do(func(row *spanner.Row) error {
+			var webhookDeliveryId string
+			if err := row.Column(0, &webhookDeliveryId); err != nil {
+				return lib_errors.Wrap(err, "Failed reading webhook delivery id")
+			}
+			existing[webhookDeliveryId] = true
+			return nil
+		}); err != nil {
+			return lib_errors.Wrap(err, "Failed reading existing webhook deliveries")
+		}
+
+		var mutations []*spanner.Mutation
+		for _, v := range webhookDeliveries {
+			if existing[v.WebhookDeliveryId] || !existingWebhookSubscription[v.WebhookSubscriptionId] {
+				continue
+			}
+			mutWebhookDelivery, err := spanner.InsertStruct(tableWebhookDelivery, v)
+			if err != nil {
+				return lib_errors.Wrap(err, "Failed creating mutWebhookDelivery for webhook delivery")
+			}
+			mutations = append(mutations, mutWebhookDelivery)
+		}
+
+		if err := txn.BufferWrite(mutations); err != nil {
+			return lib_errors.Wrap(err, "Failed buffering mutations")
+		}
+		count = len(mutations)
+
+		return nil
+	}); err != nil {
+		return 0, lib_spanner.WrapError(err, "Failed creating webhook deliveries")
+	}
+
+	lib_log.Info(ctx, "Created", lib_log.FmtInt("count", count))
+	return count, nil
+}
+
+// newWebhookDeliveries creates a pending delivery of each event to each subscription of its tenant to its event type
+func newWebhookDeliveries(events []dto.Event, webhookSubscriptions []WebhookSubscription) ([]WebhookDelivery, error) {
+	var webhookDeliveries []WebhookDelivery
+	for _, event := range events {
+		for _, webhookSubscription := range webhookSubscriptions {
+			if checkTenant(webhookSubscription, event.TenantId) != nil || webhookSubscription.Test != event.Test || !lib_strings.Contains(webhookSubscription.EventTypes, event.EventType) {
+				continue
+			}
+
+			payload, err := json.Marshal(event)
+			if err != nil {
+				return nil, lib_errors.Wrap(err, "Failed marshalling event")
+			}
+			webhookDeliveries = append(webhookDeliveries, WebhookDelivery{
+				DateCreated:           spanner.CommitTimestamp,
+				DateNextAttempt:       spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true},
+				EventId:               event.EventId,
+				EventType:             event.EventType,
+				Payload:               string(payload),
+				Status:                dto.WebhookDeliveryStatusPending,
+				Test:                  event.Test,
+				WebhookDeliveryId:     uuid.NewSHA1(webhookDeliveryIdNamespace, []byte(webhookSubscription.WebhookSubscriptionId+event.EventId)).String(),
+				WebhookSubscriptionId: webhookSubscription.WebhookSubscriptionId,
+			})
+		}
+	}
+	return webhookDeliveries, nil
+}
+
+// ReadWebhookDeliveriesDue reads the oldest pending deliveries whose next attempt is due
+func (c client) ReadWebhookDeliveriesDue(ctx context.Context, limit int) ([]WebhookDeliveryDue, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtInt("limit", limit))
+
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			WHERE status = @status
+			AND date_next_attempt <= CURRENT_TIMESTAMP()
+			ORDER BY date_next_attempt
+			LIMIT %d
+		`,
+			strings.Join(WebhookDeliveryColumns, ", "),
+			tableWebhookDelivery,
+			limit,
+		),
+		Params: map[string]interface{}{
+			"status": dto.WebhookDeliveryStatusPending,
+		},
+	}
+
+	ro := c.spannerClient.ReadOnlyTransaction()
+	defer ro.Close()
+
+	webhookDeliveries, err := queryWebhookDeliveries(ctx, ro, stmt)
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed querying webhook deliveries")
+	}
+	if len(webhookDeliveries) == 0 {
+		lib_log.Info(ctx, "Read")
+		return nil, nil
+	}
+
+	keys := spanner.KeySets()
+	for _, v := range webhookDeliveries {
+		keys = spanner.KeySets(keys, spanner.Key{v.WebhookSubscriptionId})
+	}
+	webhookSubscriptionById := make(map[string]WebhookSubscription)
+	if err := ro.Read(ctx, tableWebhookSubscription, keys, WebhookSubscriptionColumns).Do(func(row *spanner.Row) error {
+		var webhookSubscription WebhookSubscription
+		if err := row.ToStruct(&webhookSubscription); err != nil {
+			return lib_errors.Wrap(err, "Failed reading webhook subscription")
+		}
+		webhookSubscriptionById[webhookSubscription.WebhookSubscriptionId] = webhookSubscription
+		return nil
+	}); err != nil {
+		return nil, lib_errors.Wrap(err, "Failed reading webhook subscriptions")
+	}
+
+	var webhookDeliveriesDue []WebhookDeliveryDue
+	for _, v := range webhookDeliveries {
+		webhookSubscription, ok := webhookSubscriptionById[v.WebhookSubscriptionId]
+		if !ok {
+			continue
+		}
+		webhookDeliveriesDue = append(webhookDeliveriesDue, WebhookDeliveryDue{
+			WebhookDelivery: v,
+			Secret:          webhookSubscription.Secret,
+			Url:             webhookSubscription.Url,
+		})
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(webhookDeliveriesDue)", len(webhookDeliveriesDue)))
+	return webhookDeliveriesDue, nil
+}
+
+func queryWebhookDeliveries(ctx context.Context, reader lib_spanner.Reader, stmt spanner.Statement) ([]WebhookDelivery, error) {
+	lib_log.Info(ctx, "Reading", lib_log.FmtAny("stmt", stmt))
+
+	iter := reader.Query(ctx, stmt)
+	defer iter.Stop()
+
+	var webhookDeliveries []WebhookDelivery
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, lib_errors.Wrap(err, "Failed iterating webhook delivery")
+		}
+
+		var webhookDelivery WebhookDelivery
+		if err := row.ToStruct(&webhookDelivery); err != nil {
+			return nil, lib_errors.Wrap(err, "Failed reading webhook delivery")
+		}
+
+		webhookDeliveries = append(webhookDeliveries, webhookDelivery)
+	}
+
+	lib_log.Info(ctx, "Read", lib_log.FmtInt("len(webhookDeliveries)", len(webhookDeliveries)))
+	return webhookDeliveries, nil
+}
+
+// UpdateWebhookDeliveryAttempted records the outcome of an attempt to send a delivery
+func (c client) UpdateWebhookDeliveryAttempted(ctx context.Context, webhookDelivery WebhookDelivery, webhookDeliveryAttempt dto.WebhookDeliveryAttempt) error {
+	lib_log.Info(ctx, "Updating", lib_log.FmtString("webhookDelivery.WebhookDeliveryId", webhookDelivery.WebhookDeliveryId), lib_log.FmtAny("webhookDeliveryAttempt", webhookDeliveryAttempt))
+
+	values := map[string]interface{}{
+		"attempts":                  webhookDelivery.Attempts + 1,
+		"date_next_attempt":         spanner.NullTime{},
+		"date_updated":              spanner.CommitTimestamp,
+		"last_error":                spanner.NullString{},
+		"last_response_status_code": spanner.NullInt64{},
+		"status":                    webhookDeliveryAttempt.Status,
+		"webhook_delivery_id":       webhookDelivery.WebhookDeliveryId,
+		"webhook_subscription_id":   webhookDelivery.WebhookSubscriptionId,
+	}
+	if webhookDeliveryAttempt.DateNextAttempt != nil {
+		values["date_next_attempt"] = *webhookDeliveryAttempt.DateNextAttempt
+	}
+	if webhookDeliveryAttempt.Error != nil {
+		values["last_error"] = *webhookDeliveryAttempt.Error
+	}
+	if webhookDeliveryAttempt.ResponseStatusCode != nil {
+		values["last_response_status_code"] = int64(*webhookDeliveryAttempt.ResponseStatusCode)
+	}
+
+	if _, err := c.spannerClient.Apply(ctx, []*spanner.Mutation{spanner.UpdateMap(tableWebhookDelivery, values)}); err != nil {
+		return lib_spanner.WrapError(err, "Failed applying webhook delivery mutation")
+	}
+
+	lib_log.Info(ctx, "Updated")
+	return nil
+}
+
+func (c client) SearchWebhookDeliveries(ctx context.Context, webhookDeliveriesSearch dto.WebhookDeliveriesSearch) ([]WebhookDelivery, *lib_pagination.Pagination, error) {
+	lib_log.Info(ctx, "Searching", lib_log.FmtAny("webhookDeliveriesSearch", webhookDeliveriesSearch))
+
+	ro := c.spannerClient.ReadOnlyTransaction()
+	defer ro.Close()
+
+	if _, err := readWebhookSubscription(ctx, ro, webhookDeliveriesSearch.WebhookSubscriptionId, webhookDeliveriesSearch.Test); err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed reading webhook subscription")
+	}
+
+	sqlWhere := "WHERE webhook_subscription_id = @webhook_subscription_id"
+	params := map[string]interface{}{
+		"webhook_subscription_id": webhookDeliveriesSearch.WebhookSubscriptionId,
+	}
+	if webhookDeliveriesSearch.Status != nil {
+		sqlWhere += " AND status = @status"
+		params["status"] = *webhookDeliveriesSearch.Status
+	}
+
+	webhookDeliveries, err := queryWebhookDeliveries(ctx, ro, spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT %s
+			FROM %s
+			%s
+			ORDER BY date_created %s
+			LIMIT %d
+			OFFSET %d
+		`,
+			strings.Join(WebhookDeliveryColumns, ", "),
+			tableWebhookDelivery,
+			sqlWhere,
+			webhookDeliveriesSearch.Pagination.Order,
+			webhookDeliveriesSearch.Pagination.Limit,
+			webhookDeliveriesSearch.Pagination.Offset,
+		),
+		Params: params,
+	})
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed querying webhook deliveries")
+	}
+
+	pagination, err := readCountForPagination(ctx, ro, webhookDeliveriesSearch.Pagination, spanner.Statement{
+		SQL: fmt.Sprintf(`
+			SELECT count(webhook_delivery_id) AS count
+			FROM %s
+			%s
+		`,
+			tableWebhookDelivery,
+			sqlWhere,
+		),
+		Params: params,
+	})
+	if err != nil {
+		return nil, nil, lib_errors.Wrap(err, "Failed reading count for pagination")
+	}
+	ro.Close()
+
+	lib_log.Info(ctx, "Searched", lib_log.FmtInt("len(webhookDeliveries)", len(webhookDeliveries)), lib_log.FmtAny("pagination", pagination))
+	return webhookDeliveries, pagination, nil
+}
+
+// RedeliverWebhookDelivery makes the delivery pending again with a new set of attempts, whatever its status
+func (c client) RedeliverWebhookDelivery(ctx context.Context, webhookDeliveryRedeliver dto.WebhookDeliveryRedeliver) error {
+	lib_log.Info(ctx, "Redelivering", lib_log.FmtAny("webhookDeliveryRedeliver", webhookDeliveryRedeliver))
+
+	if _, err := c.spannerClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		if _, err := readWebhookSubscription(ctx, txn, webhookDeliveryRedeliver.WebhookSubscriptionId, webhookDeliveryRedeliver.Test); err != nil {
+			return lib_errors.Wrap(err, "Failed reading webhook subscription")
+		}
+
+		row, err := txn.ReadRow(ctx, tableWebhookDelivery, spanner.Key{webhookDeliveryRedeliver.WebhookSubscriptionId, webhookDeliveryRedeliver.Id}, WebhookDeliveryColumns)
+		if err != nil {
+			if spanner.ErrCode(err) == codes.NotFound {
+				return lib_errors.NewCustom(http.StatusNotFound, "Entity not found")
+			}
+			return lib_errors.Wrap(err, "Failed reading webhook delivery")
+		}
+		var webhookDelivery WebhookDelivery
+		if err := row.ToStruct(&webhookDelivery); err != nil {
+			return lib_errors.Wrap(err, "Failed reading webhook delivery")
+		}
+
+		if webhookDelivery.Test != webhookDeliveryRedeliver.Test {
+			return lib_errors.NewCustom(http.StatusUnprocessableEntity, constants.UnprocessableEntityAccessForbiddenByTest)
+		}
+
+		if err := txn.BufferWrite([]*spanner.Mutation{spanner.UpdateMap(tableWebhookDelivery, map[string]interface{}{
+			"attempts":                0,
+			"date_next_attempt":       spanner.CommitTimestamp,
+			"date_updated":            spanner.CommitTimestamp,
+			"status":                  dto.WebhookDeliveryStatusPending,
+			"webhook_delivery_id":     webhookDelivery.WebhookDeliveryId,
+			"webhook_subscription_id": webhookDelivery.WebhookSubscriptionId,
+		})}); err != nil {
+			return lib_errors.Wrap(err, "Failed buffering mutations")
+		}
+
+		return nil
+	}); err != nil {
+		return lib_spanner.WrapError(err, "Failed redelivering webhook delivery")
+	}
+
+	lib_log.Info(ctx, "Redelivered")
+	return nil
+}
+
+func (c client) TransformWebhookSubscriptionsToJson(ctx context.Context, webhookSubscriptions []WebhookSubscription) ([]byte, error) {
+	lib_log.Info(ctx, "Transforming", lib_log.FmtInt("len(webhookSubscriptions)", len(webhookSubscriptions)))
+
+	if len(webhookSubscriptions) == 0 {
+		lib_log.Info(ctx, "Transformed")
+		return nil, nil
+	}
+	var webhookSubscriptionsList []interface{}
+	for _, v := range webhookSubscriptions {
+		webhookSubscriptionsList = append(webhookSubscriptionsList, v)
+	}
+	webhookSubscriptionsListJson, err := lib_json.GenerateJsonList(webhookSubscriptionsList, WebhookSubscriptionFieldMetaData, "")
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed generating json list")
+	}
+
+	lib_log.Info(ctx, "Transformed", lib_log.FmtInt("len(webhookSubscriptionsListJson)", len(webhookSubscriptionsListJson)))
+	return webhookSubscriptionsListJson, nil
+}
+
+func (c client) TransformWebhookDeliveriesToJson(ctx context.Context, webhookDeliveries []WebhookDelivery) ([]byte, error) {
+	lib_log.Info(ctx, "Transforming", lib_log.FmtInt("len(webhookDeliveries)", len(webhookDeliveries)))
+
+	if len(webhookDeliveries) == 0 {
+		lib_log.Info(ctx, "Transformed")
+		return nil, nil
+	}
+	var webhookDeliveriesList []interface{}
+	for _, v := range webhookDeliveries {
+		webhookDeliveriesList = append(webhookDeliveriesList, v)
+	}
+	webhookDeliveriesListJson, err := lib_json.GenerateJsonList(webhookDeliveriesList, WebhookDeliveryFieldMetaData, "")
+	if err != nil {
+		return nil, lib_errors.Wrap(err, "Failed generating json list")
+	}
+
+	lib_log.Info(ctx, "Transformed", lib_log.FmtInt("len(webhookDeliveriesListJson)", len(webhookDeliveriesListJson)))
+	return webhookDeliveriesListJson, nil
+}
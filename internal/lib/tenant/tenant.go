@@ -0,0 +1,71 @@
+package tenant
+
+import (
+	"car-svc/internal/lib/constants"
+	"context"
+	"net/http"
+
+	lib_brand "github.com/tomwangsvc/lib-svc/brand"
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_token_iam "github.com/tomwangsvc/lib-svc/token/iam"
+)
+
+const (
+	// HeaderKeyXLcTenantId names the brand of a request made by a service with its api token, it is never accepted from a user
+	HeaderKeyXLcTenantId = "X-Lc-Tenant-Id"
+)
+
+// FromIdentityProvider returns the brand of the identity provider of an IAM token, ok is false for an identity provider that does not belong to a brand
+func FromIdentityProvider(identityProvider string) (tenantId string, ok bool) {
+	switch {
+	case lib_brand.IsBoxerIdentityProvider(identityProvider):
+		return lib_brand.BoxerId, true
+	case lib_brand.IsTomWangIdentityProvider(identityProvider):
+		return lib_brand.TomWangId, true
+	}
+	return "", false
+}
+
+// FromRequest returns the tenant of a request authorized with a token, a user is always in the brand of their identity provider so only a service without an identity may name a brand with the header
+func FromRequest(r *http.Request, claims lib_token_iam.Claims) (string, error) {
+	header := r.Header.Get(HeaderKeyXLcTenantId)
+
+	if tenantId, ok := FromIdentityProvider(claims.IdentityProvider); ok {
+		if header != "" && header != tenantId {
+			return "", lib_errors.NewCustomWithMetadata(http.StatusForbidden, constants.ForbiddenTenantOutOfScope, map[string]interface{}{
+				HeaderKeyXLcTenantId: constants.ForbiddenTenantOutOfScope,
+			})
+		}
+		return tenantId, nil
+	}
+
+	if claims.IdentityId != "" {
+		if header != "" {
+			return "", lib_errors.NewCustomWithMetadata(http.StatusForbidden, constants.ForbiddenTenantOutOfScope, map[string]interface{}{
+				HeaderKeyXLcTenantId: constants.ForbiddenTenantOutOfScope,
+			})
+		}
+		return "", lib_errors.NewCustomWithMetadata(http.StatusForbidden, constants.ForbiddenTenantNotRecognized, map[string]interface{}{
+			"identity_provider": constants.ForbiddenTenantNotRecognized,
+		})
+	}
+
+	if !lib_brand.Recognized(header) {
+		return "", lib_errors.NewCustomWithMetadata(http.StatusForbidden, constants.ForbiddenTenantNotRecognized, map[string]interface{}{
+			HeaderKeyXLcTenantId: constants.ForbiddenTenantNotRecognized,
+		})
+	}
+	return header, nil
+}
+
+type contextKey struct{}
+
+func WithTenantId(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenantId)
+}
+
+// TenantId returns the brand whose data the request reaches, ok is false when the request was not authorized for a brand
+func TenantId(ctx context.Context) (tenantId string, ok bool) {
+	tenantId, ok = ctx.Value(contextKey{}).(string)
+	return tenantId, ok && tenantId != ""
+}
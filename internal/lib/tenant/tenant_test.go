@@ -0,0 +1,133 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	lib_brand "github.com/tomwangsvc/lib-svc/brand"
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+	lib_token_iam "github.com/tomwangsvc/lib-svc/token/iam"
+)
+
+func Test_FromRequest(t *testing.T) {
+	type input struct {
+		header           string
+		identityId       string
+		identityProvider string
+	}
+	type expected struct {
+		err      bool
+		tenantId string
+	}
+	var data = []struct {
+		desc string
+		input
+		expected
+	}{
+		{
+			desc:     "identity provider of a brand",
+			input:    input{identityProvider: lib_brand.BoxerIdentityProvider},
+			expected: expected{tenantId: lib_brand.BoxerId},
+		},
+		{
+			desc:     "identity provider of a brand naming its brand",
+			input:    input{header: lib_brand.TomWangId, identityProvider: lib_brand.TomWangIdentityProvider},
+			expected: expected{tenantId: lib_brand.TomWangId},
+		},
+		{
+			desc:     "identity provider of a brand naming another brand",
+			input:    input{header: lib_brand.TomWangId, identityProvider: lib_brand.BoxerIdentityProvider},
+			expected: expected{err: true},
+		},
+		{
+			desc:     "identity provider not of a brand without header",
+			input:    input{identityId: "identity-id", identityProvider: "identity-provider"},
+			expected: expected{err: true},
+		},
+		{
+			desc:     "identity provider not of a brand naming brand not recognized",
+			input:    input{header: "UNKNOWN", identityId: "identity-id", identityProvider: "identity-provider"},
+			expected: expected{err: true},
+		},
+		{
+			desc:     "user of identity provider not of a brand naming a brand",
+			input:    input{header: lib_brand.TomWangId, identityId: "identity-id", identityProvider: "identity-provider"},
+			expected: expected{err: true},
+		},
+		{
+			desc:     "service naming brand not recognized",
+			input:    input{header: "UNKNOWN"},
+			expected: expected{err: true},
+		},
+		{
+			desc:     "service naming a brand",
+			input:    input{header: lib_brand.BoxerId},
+			expected: expected{tenantId: lib_brand.BoxerId},
+		},
+	}
+
+	for i, d := range data {
+		r, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.input.header != "" {
+			r.Header.Set(HeaderKeyXLcTenantId, d.input.header)
+		}
+
+		result, err := FromRequest(r, lib_token_iam.Claims{IdentityId: d.input.identityId, IdentityProvider: d.input.identityProvider})
+		if (err != nil) != d.expected.err {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.err,
+				Result:     err,
+			}))
+		}
+		if result != d.expected.tenantId {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.tenantId,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_TenantId(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    context.Context
+		expected bool
+	}{
+		{
+			desc:  "tenant not in context",
+			input: context.Background(),
+		},
+		{
+			desc:  "empty tenant in context",
+			input: WithTenantId(context.Background(), ""),
+		},
+		{
+			desc:     "tenant in context",
+			input:    WithTenantId(context.Background(), lib_brand.BoxerId),
+			expected: true,
+		},
+	}
+
+	for i, d := range data {
+		if _, ok := TenantId(d.input); ok != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "ok",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     ok,
+			}))
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+const (
+	HeaderKeyXCarSvcDeliveryId = "X-Car-Svc-Delivery-Id"
+	HeaderKeyXCarSvcEventId    = "X-Car-Svc-Event-Id"
+	HeaderKeyXCarSvcEventType  = "X-Car-Svc-Event-Type"
+	HeaderKeyXCarSvcSignature  = "X-Car-Svc-Signature"
+	HeaderKeyXCarSvcTimestamp  = "X-Car-Svc-Timestamp"
+
+	signaturePrefix = "sha256="
+)
+
+// Client sends webhook deliveries to the urls of partners
+type Client interface {
+	Send(ctx context.Context, delivery Delivery) (int, error)
+}
+
+type Config struct {
+	Timeout time.Duration
+}
+
+type Delivery struct {
+	DeliveryId string
+	EventId    string
+	EventType  string
+	Payload    []byte
+	Secret     string
+	Url        string
+}
+
+func NewClient(config Config) Client {
+	return client{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: config.Timeout,
+		},
+	}
+}
+
+type client struct {
+	config     Config
+	httpClient *http.Client
+}
+
+// Send posts the payload signed with the secret of the subscription and returns the status code of the response, an error is only returned when there is no response
+func (c client) Send(ctx context.Context, delivery Delivery) (int, error) {
+	lib_log.Info(ctx, "Sending", lib_log.FmtString("delivery.DeliveryId", delivery.DeliveryId), lib_log.FmtString("delivery.Url", delivery.Url))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed creating request")
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderKeyXCarSvcDeliveryId, delivery.DeliveryId)
+	req.Header.Set(HeaderKeyXCarSvcEventId, delivery.EventId)
+	req.Header.Set(HeaderKeyXCarSvcEventType, delivery.EventType)
+	req.Header.Set(HeaderKeyXCarSvcSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+	req.Header.Set(HeaderKeyXCarSvcTimestamp, strconv.FormatInt(timestamp, 10))
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, lib_errors.Wrap(err, "Failed doing request")
+	}
+	defer res.Body.Close()
+	if _, err := io.Copy(ioutil.Discard, res.Body); err != nil {
+		lib_log.Warn(ctx, "Failed discarding response body", lib_log.FmtError(err))
+	}
+
+	lib_log.Info(ctx, "Sent", lib_log.FmtInt("res.StatusCode", res.StatusCode))
+	return res.StatusCode, nil
+}
+
+// Sign returns the signature partners verify a delivery with, the HMAC-SHA256 of the timestamp and the payload joined by a dot, keyed by the secret of the subscription
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.", timestamp)))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// RetryDelay returns the delay before the next attempt after the number of attempts made so far, doubling from the base delay up to the max delay
+func RetryDelay(attempts int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	lib_testing "github.com/tomwangsvc/lib-svc/testing"
+)
+
+func Test_Sign(t *testing.T) {
+	var data = []struct {
+		desc      string
+		secret    string
+		timestamp int64
+		payload   []byte
+		expected  string
+	}{
+		{
+			desc:      "payload",
+			secret:    "secret",
+			timestamp: 1600000000,
+			payload:   []byte(`{"event_id":"1"}`),
+			expected:  "sha256=09e881e93f1e415c046792d7365260ed2324c081a51f85c124ab1da912a7c232",
+		},
+	}
+
+	for i, d := range data {
+		if result := Sign(d.secret, d.timestamp, d.payload); result != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_RetryDelay(t *testing.T) {
+	var data = []struct {
+		desc     string
+		attempts int
+		expected time.Duration
+	}{
+		{
+			desc:     "first attempt",
+			attempts: 1,
+			expected: time.Minute,
+		},
+		{
+			desc:     "doubles",
+			attempts: 3,
+			expected: 4 * time.Minute,
+		},
+		{
+			desc:     "capped",
+			attempts: 20,
+			expected: time.Hour,
+		},
+	}
+
+	for i, d := range data {
+		if result := RetryDelay(d.attempts, time.Minute, time.Hour); result != d.expected {
+			t.Error(lib_testing.Errorf(lib_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_client_Send(t *testing.T) {
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(HeaderKeyXCarSvcSignature)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	statusCode, err := NewClient(Config{Timeout: time.Second}).Send(context.Background(), Delivery{
+		DeliveryId: "delivery",
+		Payload:    []byte("{}"),
+		Secret:     "secret",
+		Url:        server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusAccepted {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "statusCode",
+			Expected:   http.StatusAccepted,
+			Result:     statusCode,
+		}))
+	}
+	if signature == "" {
+		t.Error(lib_testing.Errorf(lib_testing.Error{
+			Unexpected: "signature missing",
+			Expected:   "signature",
+			Result:     signature,
+		}))
+	}
+}
@@ -0,0 +1,32 @@
+package mock
+
+import (
+	"car-svc/internal/lib/webhook"
+	"context"
+	"encoding/binary"
+	"net/http"
+
+	lib_errors "github.com/tomwangsvc/lib-svc/errors"
+)
+
+var (
+	ClientError                 webhook.Client = clientError{}
+	ClientSuccess               webhook.Client = clientSuccess{statusCode: http.StatusOK}
+	ClientSuccessStatusNotFound webhook.Client = clientSuccess{statusCode: http.StatusNotFound}
+
+	ExpectedErrorClient = lib_errors.NewCustom(int(binary.BigEndian.Uint64([]byte("WEBHOOK_CLIENT"))), "")
+)
+
+type clientError struct{}
+
+func (c clientError) Send(_ context.Context, _ webhook.Delivery) (int, error) {
+	return 0, ExpectedErrorClient
+}
+
+type clientSuccess struct {
+	statusCode int
+}
+
+func (c clientSuccess) Send(_ context.Context, _ webhook.Delivery) (int, error) {
+	return c.statusCode, nil
+}
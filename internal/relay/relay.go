@@ -0,0 +1,65 @@
+package relay
+
+import (
+	"car-svc/internal/app"
+	"context"
+	"sync"
+	"time"
+
+	lib_log "github.com/tomwangsvc/lib-svc/log"
+)
+
+type Config struct {
+	Interval time.Duration
+
+	// DispatchTimeout and RelayTimeout bound each tick of their loop, so that slow webhook endpoints cannot hold up the relay of the outbox or a tick run on into the next
+	DispatchTimeout time.Duration
+	RelayTimeout    time.Duration
+}
+
+// Run relays outbox events and dispatches webhook deliveries every interval until the context is done, each on its own loop so that neither waits for the other. It is intended to run in its own goroutine and returns once both loops have stopped
+func Run(ctx context.Context, config Config, appClient app.Client) {
+	lib_log.Info(ctx, "Running", lib_log.FmtAny("config", config))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		runEvery(ctx, config.Interval, config.RelayTimeout, func(ctx context.Context) {
+			if _, err := appClient.RelayOutboxEvents(ctx); err != nil {
+				// Unpublished events are left in the outbox and retried on the next tick
+				lib_log.Error(ctx, "Failed relaying outbox events", lib_log.FmtError(err))
+			}
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		runEvery(ctx, config.Interval, config.DispatchTimeout, func(ctx context.Context) {
+			if _, err := appClient.DispatchWebhookDeliveries(ctx); err != nil {
+				// Deliveries that were not attempted are still due and retried on the next tick
+				lib_log.Error(ctx, "Failed dispatching webhook deliveries", lib_log.FmtError(err))
+			}
+		})
+	}()
+	wg.Wait()
+
+	lib_log.Info(ctx, "Stopped")
+}
+
+// runEvery runs the tick every interval with a deadline of the timeout until the context is done, a tick that runs past the interval delays the next one rather than overlapping it
+func runEvery(ctx context.Context, interval, timeout time.Duration, tick func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			ctxTick, cancel := context.WithTimeout(ctx, timeout)
+			tick(ctxTick)
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,202 @@
+CREATE TABLE car (
+  branch_id text,
+  brand_name text NOT NULL,
+  car_id text NOT NULL,
+  date_created timestamptz NOT NULL,
+  date_deleted timestamptz,
+  date_updated timestamptz,
+  model_name text,
+  tenant_id text NOT NULL,
+  test boolean NOT NULL,
+  PRIMARY KEY (car_id)
+);
+
+CREATE INDEX car_by_brand_name ON car(brand_name);
+CREATE INDEX car_by_tenant_id_and_date_created ON car(tenant_id, date_created);
+
+CREATE TABLE customer (
+  age bigint NOT NULL,
+  customer_id text NOT NULL,
+  date_created timestamptz NOT NULL,
+  date_updated timestamptz,
+  ethnicity text NOT NULL,
+  gender text NOT NULL,
+  name text NOT NULL,
+  phone_number text,
+  tenant_id text NOT NULL,
+  test boolean NOT NULL,
+  PRIMARY KEY (customer_id)
+);
+
+CREATE TABLE car_customer_association (
+  car_id text NOT NULL,
+  customer_id text NOT NULL,
+  date_cancelled timestamptz,
+  date_created timestamptz NOT NULL,
+  date_rental_end timestamptz,
+  date_rental_start timestamptz,
+  date_updated timestamptz,
+  id text NOT NULL,
+  tenant_id text NOT NULL,
+  test boolean NOT NULL,
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX car_customer_association_by_date_rental_end_and_date_rental_start ON car_customer_association(date_rental_end, date_rental_start);
+CREATE INDEX car_customer_association_by_customer_id_and_date_rental_start ON car_customer_association(customer_id, date_rental_start);
+
+CREATE TABLE idempotency_key (
+  caller text NOT NULL,
+  date_created timestamptz NOT NULL,
+  date_expires timestamptz NOT NULL,
+  idempotency_key text NOT NULL,
+  request_hash text NOT NULL,
+  response_body bytea,
+  response_location text,
+  response_status_code bigint NOT NULL,
+  tenant_id text NOT NULL,
+  test boolean NOT NULL,
+  PRIMARY KEY (idempotency_key)
+);
+
+-- PostgreSQL has no row deletion policy, expired keys are ignored when read and can be deleted with:
+-- DELETE FROM idempotency_key WHERE date_expires < now();
+CREATE INDEX idempotency_key_by_date_expires ON idempotency_key(date_expires);
+
+CREATE TABLE cars_import (
+  cars_import_id text NOT NULL,
+  date_created timestamptz NOT NULL,
+  report bytea,
+  rows_failed bigint NOT NULL,
+  rows_imported bigint NOT NULL,
+  rows_total bigint NOT NULL,
+  tenant_id text NOT NULL,
+  test boolean NOT NULL,
+  PRIMARY KEY (cars_import_id)
+);
+
+CREATE TABLE cars_import_report_row (
+  car_id text,
+  cars_import_id text NOT NULL REFERENCES cars_import(cars_import_id) ON DELETE CASCADE,
+  errors text,
+  number bigint NOT NULL,
+  status bigint NOT NULL,
+  PRIMARY KEY (cars_import_id, number)
+);
+
+CREATE TABLE car_history (
+  actor text NOT NULL,
+  after text,
+  before text,
+  car_history_id text NOT NULL,
+  car_id text NOT NULL,
+  correlation_id text NOT NULL,
+  date_created timestamptz NOT NULL,
+  operation text NOT NULL,
+  tenant_id text NOT NULL,
+  test boolean NOT NULL,
+  PRIMARY KEY (car_history_id)
+);
+
+CREATE INDEX car_history_by_car_id_and_date_created ON car_history(car_id, date_created DESC);
+CREATE INDEX car_history_by_test_and_date_created ON car_history(test, date_created) INCLUDE (car_id, operation);
+CREATE INDEX car_history_by_tenant_id_and_test_and_date_created ON car_history(tenant_id, test, date_created) INCLUDE (car_id, operation);
+
+CREATE TABLE outbox_event (
+  aggregate_id text NOT NULL,
+  correlation_id text NOT NULL,
+  data text,
+  date_created timestamptz NOT NULL,
+  date_published timestamptz,
+  event_type text NOT NULL,
+  outbox_event_id text NOT NULL,
+  tenant_id text NOT NULL,
+  test boolean NOT NULL,
+  PRIMARY KEY (outbox_event_id)
+);
+
+CREATE INDEX outbox_event_by_date_published_and_date_created ON outbox_event(date_published, date_created);
+
+CREATE TABLE customer_block (
+  customer_id text NOT NULL,
+  date_created timestamptz NOT NULL,
+  event_type text NOT NULL,
+  test boolean NOT NULL,
+  PRIMARY KEY (customer_id)
+);
+
+CREATE TABLE pubsub_message (
+  date_created timestamptz NOT NULL,
+  pubsub_message_id text NOT NULL,
+  test boolean NOT NULL,
+  PRIMARY KEY (pubsub_message_id)
+);
+
+-- PostgreSQL has no row deletion policy, consumed messages are no longer redelivered after the retention of the subscription and can be deleted with:
+-- DELETE FROM pubsub_message WHERE date_created < now() - interval '7 days';
+
+CREATE TABLE webhook_subscription (
+  date_created timestamptz NOT NULL,
+  date_updated timestamptz,
+  event_types text[] NOT NULL,
+  secret text NOT NULL,
+  tenant_id text NOT NULL,
+  test boolean NOT NULL,
+  url text NOT NULL,
+  webhook_subscription_id text NOT NULL,
+  PRIMARY KEY (webhook_subscription_id)
+);
+
+-- The foreign key stands in for the interleaving of webhook_delivery in webhook_subscription
+CREATE TABLE webhook_delivery (
+  attempts bigint NOT NULL,
+  date_created timestamptz NOT NULL,
+  date_next_attempt timestamptz,
+  date_updated timestamptz,
+  event_id text NOT NULL,
+  event_type text NOT NULL,
+  last_error text,
+  last_response_status_code bigint,
+  payload text NOT NULL,
+  status text NOT NULL,
+  test boolean NOT NULL,
+  webhook_delivery_id text NOT NULL,
+  webhook_subscription_id text NOT NULL REFERENCES webhook_subscription(webhook_subscription_id) ON DELETE CASCADE,
+  PRIMARY KEY (webhook_subscription_id, webhook_delivery_id)
+);
+
+CREATE UNIQUE INDEX webhook_delivery_by_webhook_delivery_id ON webhook_delivery(webhook_delivery_id);
+CREATE INDEX webhook_delivery_by_status_and_date_next_attempt ON webhook_delivery(status, date_next_attempt);
+
+CREATE TABLE api_key (
+  api_key_id text NOT NULL,
+  burst bigint NOT NULL,
+  daily_quota bigint NOT NULL,
+  date_created timestamptz NOT NULL,
+  date_expires timestamptz NOT NULL,
+  date_revoked timestamptz,
+  date_updated timestamptz,
+  key_hash text NOT NULL,
+  key_prefix text NOT NULL,
+  lineage_api_key_id text,
+  name text NOT NULL,
+  requests_per_second double precision NOT NULL,
+  rotated_from_api_key_id text,
+  scopes text[] NOT NULL,
+  tenant_id text NOT NULL,
+  test boolean NOT NULL,
+  PRIMARY KEY (api_key_id)
+);
+
+CREATE UNIQUE INDEX api_key_by_key_hash ON api_key(key_hash);
+
+CREATE TABLE api_key_quota_usage (
+  date_updated timestamptz NOT NULL,
+  day date NOT NULL,
+  lineage_api_key_id text NOT NULL,
+  used bigint NOT NULL,
+  PRIMARY KEY (lineage_api_key_id, day)
+);
+
+-- PostgreSQL has no row deletion policy, the usage of past days is no longer read and can be deleted with:
+-- DELETE FROM api_key_quota_usage WHERE date_updated < now() - interval '2 days';
@@ -1 +0,0 @@
-ALTER TABLE customer ADD COLUMN phone_number STRING(1024);
\ No newline at end of file
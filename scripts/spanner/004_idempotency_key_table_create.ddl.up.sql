@@ -0,0 +1,11 @@
+CREATE TABLE idempotency_key (
+  date_created TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  date_expires TIMESTAMP NOT NULL,
+  idempotency_key STRING(255) NOT NULL,
+  request_hash STRING(64) NOT NULL,
+  response_body BYTES(MAX),
+  response_location STRING(1024),
+  response_status_code INT64 NOT NULL,
+  test BOOL NOT NULL
+) PRIMARY KEY (idempotency_key),
+  ROW DELETION POLICY (OLDER_THAN(date_expires, INTERVAL 0 DAY));
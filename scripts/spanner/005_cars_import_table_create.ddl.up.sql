@@ -0,0 +1,9 @@
+CREATE TABLE cars_import (
+  cars_import_id STRING(1024) NOT NULL,
+  date_created TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  report BYTES(MAX) NOT NULL,
+  rows_failed INT64 NOT NULL,
+  rows_imported INT64 NOT NULL,
+  rows_total INT64 NOT NULL,
+  test BOOL NOT NULL
+) PRIMARY KEY (cars_import_id);
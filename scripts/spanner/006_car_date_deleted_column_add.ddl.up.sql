@@ -0,0 +1 @@
+ALTER TABLE car ADD COLUMN date_deleted TIMESTAMP OPTIONS (allow_commit_timestamp = true);
@@ -0,0 +1,13 @@
+CREATE TABLE car_history (
+  actor STRING(1024) NOT NULL,
+  after STRING(MAX),
+  before STRING(MAX),
+  car_history_id STRING(1024) NOT NULL,
+  car_id STRING(1024) NOT NULL,
+  correlation_id STRING(1024) NOT NULL,
+  date_created TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  operation STRING(1024) NOT NULL,
+  test BOOL NOT NULL
+) PRIMARY KEY (car_history_id);
+
+CREATE INDEX car_history_by_car_id_and_date_created ON car_history(car_id, date_created DESC);
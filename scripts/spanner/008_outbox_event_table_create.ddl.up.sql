@@ -0,0 +1,12 @@
+CREATE TABLE outbox_event (
+  aggregate_id STRING(1024) NOT NULL,
+  correlation_id STRING(1024) NOT NULL,
+  data STRING(MAX),
+  date_created TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  date_published TIMESTAMP OPTIONS (allow_commit_timestamp = true),
+  event_type STRING(1024) NOT NULL,
+  outbox_event_id STRING(1024) NOT NULL,
+  test BOOL NOT NULL
+) PRIMARY KEY (outbox_event_id);
+
+CREATE INDEX outbox_event_by_date_published_and_date_created ON outbox_event(date_published, date_created);
@@ -0,0 +1,16 @@
+ALTER TABLE car_customer_association ADD COLUMN date_cancelled TIMESTAMP OPTIONS (allow_commit_timestamp = true);
+
+CREATE TABLE customer_block (
+  customer_id STRING(1024) NOT NULL,
+  date_created TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  event_type STRING(1024) NOT NULL,
+  test BOOL NOT NULL
+) PRIMARY KEY (customer_id);
+
+CREATE TABLE pubsub_message (
+  date_created TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  pubsub_message_id STRING(1024) NOT NULL,
+  test BOOL NOT NULL
+) PRIMARY KEY (pubsub_message_id);
+
+CREATE INDEX car_customer_association_by_customer_id_and_date_rental_start ON car_customer_association(customer_id, date_rental_start);
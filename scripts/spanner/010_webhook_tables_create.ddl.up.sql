@@ -0,0 +1,28 @@
+CREATE TABLE webhook_subscription (
+  date_created TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  date_updated TIMESTAMP OPTIONS (allow_commit_timestamp = true),
+  event_types ARRAY<STRING(1024)> NOT NULL,
+  secret STRING(1024) NOT NULL,
+  test BOOL NOT NULL,
+  url STRING(2048) NOT NULL,
+  webhook_subscription_id STRING(1024) NOT NULL
+) PRIMARY KEY (webhook_subscription_id);
+
+CREATE TABLE webhook_delivery (
+  attempts INT64 NOT NULL,
+  date_created TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  date_next_attempt TIMESTAMP OPTIONS (allow_commit_timestamp = true),
+  date_updated TIMESTAMP OPTIONS (allow_commit_timestamp = true),
+  event_id STRING(1024) NOT NULL,
+  event_type STRING(1024) NOT NULL,
+  last_error STRING(MAX),
+  last_response_status_code INT64,
+  payload STRING(MAX) NOT NULL,
+  status STRING(1024) NOT NULL,
+  test BOOL NOT NULL,
+  webhook_delivery_id STRING(1024) NOT NULL,
+  webhook_subscription_id STRING(1024) NOT NULL
+) PRIMARY KEY (webhook_subscription_id, webhook_delivery_id),
+  INTERLEAVE IN PARENT webhook_subscription ON DELETE CASCADE;
+
+CREATE INDEX webhook_delivery_by_status_and_date_next_attempt ON webhook_delivery(status, date_next_attempt);
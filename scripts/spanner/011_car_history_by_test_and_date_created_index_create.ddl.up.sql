@@ -0,0 +1 @@
+CREATE INDEX car_history_by_test_and_date_created ON car_history(test, date_created) STORING (car_id, operation);
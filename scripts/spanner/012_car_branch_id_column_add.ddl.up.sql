@@ -0,0 +1 @@
+ALTER TABLE car ADD COLUMN branch_id STRING(1024);
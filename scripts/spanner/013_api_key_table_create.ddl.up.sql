@@ -0,0 +1,18 @@
+CREATE TABLE api_key (
+  api_key_id STRING(1024) NOT NULL,
+  burst INT64 NOT NULL,
+  daily_quota INT64 NOT NULL,
+  date_created TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  date_expires TIMESTAMP NOT NULL,
+  date_revoked TIMESTAMP OPTIONS (allow_commit_timestamp = true),
+  date_updated TIMESTAMP OPTIONS (allow_commit_timestamp = true),
+  key_hash STRING(1024) NOT NULL,
+  key_prefix STRING(1024) NOT NULL,
+  name STRING(1024) NOT NULL,
+  requests_per_second FLOAT64 NOT NULL,
+  rotated_from_api_key_id STRING(1024),
+  scopes ARRAY<STRING(1024)> NOT NULL,
+  test BOOL NOT NULL
+) PRIMARY KEY (api_key_id);
+
+CREATE UNIQUE INDEX api_key_by_key_hash ON api_key(key_hash);
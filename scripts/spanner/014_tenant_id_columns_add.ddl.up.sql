@@ -0,0 +1,11 @@
+ALTER TABLE api_key ADD COLUMN tenant_id STRING(1024);
+ALTER TABLE car ADD COLUMN tenant_id STRING(1024);
+ALTER TABLE car_customer_association ADD COLUMN tenant_id STRING(1024);
+ALTER TABLE car_history ADD COLUMN tenant_id STRING(1024);
+ALTER TABLE cars_import ADD COLUMN tenant_id STRING(1024);
+ALTER TABLE customer ADD COLUMN tenant_id STRING(1024);
+ALTER TABLE outbox_event ADD COLUMN tenant_id STRING(1024);
+ALTER TABLE webhook_subscription ADD COLUMN tenant_id STRING(1024);
+
+CREATE INDEX car_by_tenant_id_and_date_created ON car(tenant_id, date_created);
+CREATE INDEX car_history_by_tenant_id_and_test_and_date_created ON car_history(tenant_id, test, date_created) STORING (car_id, operation);
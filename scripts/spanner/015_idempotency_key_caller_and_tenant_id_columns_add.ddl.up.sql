@@ -0,0 +1,2 @@
+ALTER TABLE idempotency_key ADD COLUMN caller STRING(1024);
+ALTER TABLE idempotency_key ADD COLUMN tenant_id STRING(1024);
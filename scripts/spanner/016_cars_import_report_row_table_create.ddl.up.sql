@@ -0,0 +1,10 @@
+ALTER TABLE cars_import ALTER COLUMN report BYTES(MAX);
+
+CREATE TABLE cars_import_report_row (
+  cars_import_id STRING(1024) NOT NULL,
+  number INT64 NOT NULL,
+  car_id STRING(1024),
+  errors STRING(MAX),
+  status INT64 NOT NULL
+) PRIMARY KEY (cars_import_id, number),
+  INTERLEAVE IN PARENT cars_import ON DELETE CASCADE;
@@ -0,0 +1 @@
+ALTER TABLE outbox_event ADD ROW DELETION POLICY (OLDER_THAN(date_published, INTERVAL 7 DAY));
@@ -0,0 +1 @@
+ALTER TABLE pubsub_message ADD ROW DELETION POLICY (OLDER_THAN(date_created, INTERVAL 7 DAY));
@@ -0,0 +1,9 @@
+ALTER TABLE api_key ADD COLUMN lineage_api_key_id STRING(1024);
+
+CREATE TABLE api_key_quota_usage (
+  date_updated TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  day DATE NOT NULL,
+  lineage_api_key_id STRING(1024) NOT NULL,
+  used INT64 NOT NULL
+) PRIMARY KEY (lineage_api_key_id, day),
+  ROW DELETION POLICY (OLDER_THAN(date_updated, INTERVAL 2 DAY));
@@ -0,0 +1,8 @@
+UPDATE api_key SET tenant_id = "@TENANT_ID@" WHERE tenant_id IS NULL;
+UPDATE car SET tenant_id = "@TENANT_ID@" WHERE tenant_id IS NULL;
+UPDATE car_customer_association SET tenant_id = "@TENANT_ID@" WHERE tenant_id IS NULL;
+UPDATE car_history SET tenant_id = "@TENANT_ID@" WHERE tenant_id IS NULL;
+UPDATE cars_import SET tenant_id = "@TENANT_ID@" WHERE tenant_id IS NULL;
+UPDATE customer SET tenant_id = "@TENANT_ID@" WHERE tenant_id IS NULL;
+UPDATE outbox_event SET tenant_id = "@TENANT_ID@" WHERE tenant_id IS NULL;
+UPDATE webhook_subscription SET tenant_id = "@TENANT_ID@" WHERE tenant_id IS NULL;
@@ -0,0 +1,8 @@
+ALTER TABLE api_key ALTER COLUMN tenant_id STRING(1024) NOT NULL;
+ALTER TABLE car ALTER COLUMN tenant_id STRING(1024) NOT NULL;
+ALTER TABLE car_customer_association ALTER COLUMN tenant_id STRING(1024) NOT NULL;
+ALTER TABLE car_history ALTER COLUMN tenant_id STRING(1024) NOT NULL;
+ALTER TABLE cars_import ALTER COLUMN tenant_id STRING(1024) NOT NULL;
+ALTER TABLE customer ALTER COLUMN tenant_id STRING(1024) NOT NULL;
+ALTER TABLE outbox_event ALTER COLUMN tenant_id STRING(1024) NOT NULL;
+ALTER TABLE webhook_subscription ALTER COLUMN tenant_id STRING(1024) NOT NULL;
@@ -186,7 +186,7 @@ func determineMigrations(dir string) (ddl []string, dml []string) {
 		if strings.HasSuffix(v.Name(), ".ddl.up.sql") {
 			ddl = append(ddl, v.Name())
 
-		} else if strings.HasSuffix(v.Name(), ".all.dml.sql") {
+		} else if strings.HasSuffix(v.Name(), ".all.dml.sql") || strings.HasSuffix(v.Name(), ".all.pdml.sql") {
 			dml = append(dml, v.Name())
 
 		} else if strings.HasSuffix(v.Name(), fmt.Sprintf(".%s.dml.sql", envId)) {
@@ -326,6 +326,9 @@ func applyAllMigrations(ctx context.Context, spannerClient *spanner.Client, dir
 		} else if strings.HasSuffix(v, ".all.dml.sql") {
 			currentDmlMigrationVersion = applyDmlMigration(ctx, spannerClient, dir, currentDmlMigrationVersion, v)
 
+		} else if strings.HasSuffix(v, ".all.pdml.sql") {
+			currentDmlMigrationVersion = applyPartitionedDmlMigration(ctx, spannerClient, dir, currentDmlMigrationVersion, v)
+
 		} else if strings.HasSuffix(v, fmt.Sprintf(".%s.dml.sql", envId)) {
 			currentDmlMigrationVersion = applyDmlMigration(ctx, spannerClient, dir, currentDmlMigrationVersion, v)
 
@@ -338,6 +341,41 @@ func applyAllMigrations(ctx context.Context, spannerClient *spanner.Client, dir
 func applyDmlMigration(ctx context.Context, spannerClient *spanner.Client, dir string, currentDmlMigrationVersion int64, migration string) int64 {
 	logInfo(fmt.Sprintf("Appyling next DML migration %q from directory %q", migration, dir))
 
+	nextDmlMigrationVersion, statements := readDmlMigration(dir, migration)
+
+	setDataMigrationsDirty(ctx, spannerClient, nextDmlMigrationVersion)
+
+	statements = append(statements, newDataMigrationsStatements(currentDmlMigrationVersion, nextDmlMigrationVersion)...)
+
+	applyDmlStatements(ctx, spannerClient, currentDmlMigrationVersion, nextDmlMigrationVersion, statements)
+
+	return nextDmlMigrationVersion
+}
+
+// applyPartitionedDmlMigration applies each statement as partitioned DML, for updates of whole tables that exceed the mutation limit of a transaction.
+// The statements are not applied atomically so they must be idempotent, a migration that fails leaves DataMigrations dirty and can be applied again once it is cleaned
+func applyPartitionedDmlMigration(ctx context.Context, spannerClient *spanner.Client, dir string, currentDmlMigrationVersion int64, migration string) int64 {
+	logInfo(fmt.Sprintf("Appyling next partitioned DML migration %q from directory %q", migration, dir))
+
+	nextDmlMigrationVersion, statements := readDmlMigration(dir, migration)
+
+	setDataMigrationsDirty(ctx, spannerClient, nextDmlMigrationVersion)
+
+	for _, v := range statements {
+		rowCount, err := spannerClient.PartitionedUpdate(ctx, v)
+		if err != nil {
+			logFatal(fmt.Sprintf("Failed applying partitioned DML statement %q of migration version '%d': %v", v.SQL, nextDmlMigrationVersion, err))
+		}
+		logInfo(fmt.Sprintf("Applied partitioned DML statement %q. Lower bound of updated row count '%d'", v.SQL, rowCount))
+	}
+
+	applyDmlStatements(ctx, spannerClient, currentDmlMigrationVersion, nextDmlMigrationVersion, newDataMigrationsStatements(currentDmlMigrationVersion, nextDmlMigrationVersion))
+
+	return nextDmlMigrationVersion
+}
+
+// readDmlMigration returns the version of the migration and its statements with the values of its migration data file replaced
+func readDmlMigration(dir string, migration string) (int64, []spanner.Statement) {
 	var nextDmlMigrationVersion int64
 	var err error
 	if nextDmlMigrationVersion, err = strconv.ParseInt(strings.Split(migration, "_")[0], 10, 64); err != nil {
@@ -373,8 +411,6 @@ func applyDmlMigration(ctx context.Context, spannerClient *spanner.Client, dir s
 		}
 	}
 
-	setDataMigrationsDirty(ctx, spannerClient, nextDmlMigrationVersion)
-
 	var statements []spanner.Statement
 	for _, v := range strings.Split(migrationFileString, ";") {
 		v = replaceWhiteSpaceWithSpace(strings.TrimSpace(v)) + ";"
@@ -383,13 +419,19 @@ func applyDmlMigration(ctx context.Context, spannerClient *spanner.Client, dir s
 			logDebug(fmt.Sprintf("-> Created statement from SQL %q", v))
 		}
 	}
-	statements = append(statements, spanner.Statement{
+
+	return nextDmlMigrationVersion, statements
+}
+
+// newDataMigrationsStatements marks the migration version clean and deletes the prior version from DataMigrations
+func newDataMigrationsStatements(currentDmlMigrationVersion, nextDmlMigrationVersion int64) []spanner.Statement {
+	statements := []spanner.Statement{{
 		SQL: "UPDATE DataMigrations	SET Dirty=@dirty WHERE Version=@version",
 		Params: map[string]interface{}{
 			"dirty":   false,
 			"version": nextDmlMigrationVersion,
 		},
-	})
+	}}
 
 	if currentDmlMigrationVersion > 0 {
 		logInfo(fmt.Sprintf("Prior DML migration version '%d' will be deleted from DML migration tracking table 'DataMigrations'", currentDmlMigrationVersion))
@@ -403,9 +445,7 @@ func applyDmlMigration(ctx context.Context, spannerClient *spanner.Client, dir s
 		logInfo("No prior DML migration versions need to be deleted from DML migration tracking table 'DataMigrations'")
 	}
 
-	applyDmlStatements(ctx, spannerClient, currentDmlMigrationVersion, nextDmlMigrationVersion, statements)
-
-	return nextDmlMigrationVersion
+	return statements
 }
 
 func applyDmlStatements(ctx context.Context, spannerClient *spanner.Client, currentDmlMigrationVersion, nextDmlMigrationVersion int64, statements []spanner.Statement) {
@@ -66,7 +66,9 @@ mkdir bin
 echo
 
 echo "Building..."
-go build -mod=vendor -o ./bin/${SVC} ./cmd/service
+BUILD_DATE=`date -u '+%Y-%m-%dT%H:%M:%SZ'`
+COMMIT_ID=`git rev-parse HEAD 2>/dev/null || echo unknown`
+go build -mod=vendor -ldflags "-X ${SVC}/internal/lib/build.CommitId=${COMMIT_ID} -X ${SVC}/internal/lib/build.Date=${BUILD_DATE} -X ${SVC}/internal/lib/build.Number=local" -o ./bin/${SVC} ./cmd/service
 echo
 
 echo "Running..."